@@ -214,9 +214,24 @@ func (m *Miner) process(ctx context.Context) {
 			switch reqType {
 			case pool.RequestMessage:
 				req := msg.(*pool.Request)
+				var resp *pool.Response
 				switch req.Method {
-				// Process requests from the mining pool. There are none
-				// expected currently.
+				case pool.GetVersion:
+					resp = pool.NewResponse(*req.ID, "cpuminer/"+version(),
+						nil)
+
+				case pool.Ping:
+					resp = pool.NewResponse(*req.ID, "pong", nil)
+
+				default:
+					log.Errorf("Unknown method for request: %s", req.Method)
+					resp = pool.NewResponse(*req.ID, nil,
+						pool.NewStratumError(pool.Unknown, nil))
+				}
+				err := m.encoder.Encode(resp)
+				if err != nil {
+					log.Errorf("Unable to respond to %s request: %v",
+						req.Method, err)
 				}
 
 			case pool.ResponseMessage:
@@ -359,6 +374,15 @@ func (m *Miner) process(ctx context.Context) {
 					// Notify the miner of received work.
 					m.chainCh <- struct{}{}
 
+				case pool.ShowMessage:
+					message, err := pool.ParseShowMessageNotification(notif)
+					if err != nil {
+						log.Errorf("Parse show message notification error: %v", err)
+						continue
+					}
+
+					log.Infof("Message from pool: %s", message)
+
 				default:
 					log.Errorf("Unknown method for notification: %s", notif.Method)
 				}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"sort"
 	"strconv"
@@ -42,11 +43,19 @@ const (
 	defaultWalletGRPCHost        = "127.0.0.1:51028"
 	defaultPoolFeeAddr           = ""
 	defaultMaxGenTime            = 15
+	defaultMaxShareRate          = 1.0
 	defaultPoolFee               = 0.01
 	defaultLastNPeriod           = 86400 // 1 day
 	defaultWalletPass            = ""
 	defaultMaxTxFeeReserve       = 0.1
+	defaultMaxPaymentOutputs     = 1000
+	defaultMaxPaymentTxSize      = 50000
+	defaultMaxPaymentRetries     = 5
+	defaultPaymentRetryBackoff   = 60  // 1 minute
+	defaultBalanceRetryInterval  = 600 // 10 minutes
 	defaultSoloPool              = false
+	defaultRepairDB              = false
+	defaultReporting             = false
 	defaultGUIPort               = 8080
 	defaultGUIDir                = "gui"
 	defaultUseLEHTTPS            = false
@@ -56,20 +65,61 @@ const (
 	defaultDR5Port               = 5554
 	defaultD1Port                = 5555
 	defaultDesignation           = "YourPoolNameHere"
-	defaultMaxConnectionsPerHost = 100 // 100 connected clients per host
+	defaultMaxConnectionsPerHost = 100  // 100 connected clients per host
+	defaultMaxEndpointClients    = 1000 // 1000 connected clients per endpoint
+	defaultWorkerOfflinePeriod   = 600  // 10 minutes
+	defaultWorkerRetention       = 30   // 30 days
+	defaultConnAuditRetention    = 90   // 90 days
+	defaultMinNotifyInterval     = 1    // 1 second
+	defaultInitialWorkDelay      = 0    // no delay
+	defaultStaleJobWindow        = 0    // reject all jobs of superseded tips
+	defaultStaleGracePeriod      = 0    // no grace period
+	defaultMaxJobs               = 32   // 32 jobs
+	defaultStatsInterval         = 300  // 5 minutes
+	defaultResyncInterval        = 60   // 1 minute
+	defaultKeepAlivePeriod       = 30   // 30 seconds
+	defaultWriteTimeout          = 10   // 10 seconds
+	defaultMaxInFlight           = 16   // 16 unprocessed messages per client
+	defaultAuthorizeLimit        = 6    // 6 authorizations per minute
+	defaultSubscribeLimit        = 6    // 6 subscriptions per minute
+	defaultSubmitLimit           = 5    // 5 submissions per second
+	defaultAuthTokenLifetime     = 720  // 30 days
+	defaultMaxAuthFailures       = 5    // 5 failed authorizations per hour
+	defaultAuthFailureBan        = 60   // 1 hour
+	defaultMaintenanceWarning    = 5    // 5 minutes
+	defaultSpotCheckRate         = pool.DefaultSpotCheckRate
+	defaultMaxClockSkew          = 300 // 5 minutes
+
+	defaultMaxReadMessageSize  = pool.MaxReadMessageSize
+	defaultMaxWriteMessageSize = pool.MaxWriteMessageSize
+
+	defaultShareLogMaxSize      = 100 // 100 MB
+	defaultShareLogMaxRolls     = 10  // 10 rotated files
+	defaultShareLogSyncInterval = 1   // 1 second
+
+	defaultCaptureDuration = 30 // 30 minutes
+	defaultCaptureMaxSize  = 10 // 10 MB
+
+	defaultInstanceID   = 0
+	defaultInstanceBits = 0 // unpartitioned nonce space
+
+	defaultMaxWorkerNameLength = pool.MaxWorkerNameLength
 )
 
 var (
-	defaultActiveNet     = chaincfg.SimNetParams().Name
-	defaultPaymentMethod = pool.PPLNS
-	defaultMinPayment    = 0.2
-	eacrpoolHomeDir       = dcrutil.AppDataDir("eacrpool", false)
-	defaultConfigFile    = filepath.Join(eacrpoolHomeDir, defaultConfigFilename)
-	defaultDataDir       = filepath.Join(eacrpoolHomeDir, defaultDataDirname)
-	defaultDBFile        = filepath.Join(defaultDataDir, defaultDBFilename)
-	defaultLogDir        = filepath.Join(eacrpoolHomeDir, defaultLogDirname)
-	defaultTLSCertFile   = filepath.Join(eacrpoolHomeDir, defaultTLSCertFilename)
-	defaultTLSKeyFile    = filepath.Join(eacrpoolHomeDir, defaultTLSKeyFilename)
+	defaultActiveNet      = chaincfg.SimNetParams().Name
+	defaultPaymentMethod  = pool.PPLNS
+	defaultShareLogSync   = pool.ShareLogSyncInterval
+	defaultMinPayment     = 0.2
+	defaultHealthCritical = []string{pool.HealthDaemon, pool.HealthWallet,
+		pool.HealthDB, pool.HealthEndpoints, pool.HealthTargets}
+	eacrpoolHomeDir    = dcrutil.AppDataDir("eacrpool", false)
+	defaultConfigFile  = filepath.Join(eacrpoolHomeDir, defaultConfigFilename)
+	defaultDataDir     = filepath.Join(eacrpoolHomeDir, defaultDataDirname)
+	defaultDBFile      = filepath.Join(defaultDataDir, defaultDBFilename)
+	defaultLogDir      = filepath.Join(eacrpoolHomeDir, defaultLogDirname)
+	defaultTLSCertFile = filepath.Join(eacrpoolHomeDir, defaultTLSCertFilename)
+	defaultTLSKeyFile  = filepath.Join(eacrpoolHomeDir, defaultTLSKeyFilename)
 )
 
 // runServiceCommand is only set to a real function on Windows.  It is used
@@ -83,9 +133,12 @@ type config struct {
 	DataDir               string   `long:"datadir" ini-name:"datadir" description:"The data directory."`
 	ActiveNet             string   `long:"activenet" ini-name:"activenet" description:"The active network being mined on. {testnet3, mainnet, simnet}"`
 	GUIPort               uint32   `long:"guiport" ini-name:"guiport" description:"The pool GUI port."`
+	APIPort               uint32   `long:"apiport" ini-name:"apiport" description:"The port the public pool statistics API is served on over http, 0 to disable the API."`
 	DebugLevel            string   `long:"debuglevel" ini-name:"debuglevel" description:"Logging level for all subsystems. {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
 	LogDir                string   `long:"logdir" ini-name:"logdir" description:"Directory to log output."`
 	DBFile                string   `long:"dbfile" ini-name:"dbfile" description:"Path to the database file."`
+	RepairDB              bool     `long:"repairdb" ini-name:"repairdb" description:"Quarantine inconsistent database records found by the startup integrity check instead of refusing to start."`
+	Reporting             bool     `long:"reporting" ini-name:"reporting" description:"Reporting mode. Opens the database read-only and only serves the GUI and API, the database should be a backup copy of a live pool's database."`
 	DcrdRPCHost           string   `long:"dcrdrpchost" ini-name:"dcrdrpchost" description:"The ip:port to establish an RPC connection for dcrd."`
 	DcrdRPCCert           string   `long:"dcrdrpccert" ini-name:"dcrdrpccert" description:"The dcrd RPC certificate."`
 	WalletGRPCHost        string   `long:"walletgrpchost" ini-name:"walletgrpchost" description:"The ip:port to establish a GRPC connection for the wallet."`
@@ -93,9 +146,17 @@ type config struct {
 	RPCUser               string   `long:"rpcuser" ini-name:"rpcuser" description:"Username for RPC connections."`
 	RPCPass               string   `long:"rpcpass" ini-name:"rpcpass" default-mask:"-" description:"Password for RPC connections."`
 	PoolFeeAddrs          []string `long:"poolfeeaddrs" ini-name:"poolfeeaddrs" description:"Payment addresses to use for pool fee transactions. These addresses should be generated from a dedicated wallet account for pool fees."`
+	DonationAddr          string   `long:"donationaddress" ini-name:"donationaddress" description:"The payment address account donations are paid to. Donations are disabled if not set."`
 	PoolFee               float64  `long:"poolfee" ini-name:"poolfee" description:"The fee charged for pool participation. eg. 0.01 (1%), 0.05 (5%)."`
 	MaxTxFeeReserve       float64  `long:"maxtxfeereserve" ini-name:"maxtxfeereserve" description:"The maximum amount reserved for transaction fees, in DCR."`
+	MaxPaymentOutputs     uint32   `long:"maxpaymentoutputs" ini-name:"maxpaymentoutputs" description:"The maximum number of payout outputs in a single payment transaction. Payouts exceeding this are split across multiple transactions. 0 disables the limit."`
+	MaxPaymentTxSize      uint32   `long:"maxpaymenttxsize" ini-name:"maxpaymenttxsize" description:"The maximum estimated size, in bytes, of the payout outputs in a single payment transaction. This should leave room for transaction inputs below the network's standard transaction size limit. 0 disables the limit."`
+	MaxPaymentRetries     uint32   `long:"maxpaymentretries" ini-name:"maxpaymentretries" description:"The maximum number of times a failed payment dispatch is retried before it requires attention from the pool admin."`
+	PaymentRetryBackoff   uint32   `long:"paymentretrybackoff" ini-name:"paymentretrybackoff" description:"The delay, in seconds, before the first retry of a failed payment dispatch. The delay doubles with every failed retry."`
+	BalanceRetryInterval  uint32   `long:"balanceretryinterval" ini-name:"balanceretryinterval" description:"The delay, in seconds, before the wallet balance is checked again when payments are deferred because the spendable balance does not cover them."`
+	PaymentDryRun         bool     `long:"paymentdryrun" ini-name:"paymentdryrun" description:"Plan payment cycles without dispatching them. Planned payments are recorded for review and payment state is left untouched."`
 	MaxGenTime            uint64   `long:"maxgentime" ini-name:"maxgentime" description:"The share creation target time for the pool in seconds. This currently should be below 30 seconds to increase the likelihood a work submission for clients between new work distributions by the pool."`
+	MaxShareRate          float64  `long:"maxsharerate" ini-name:"maxsharerate" description:"The maximum number of shares per second a client is expected to submit. Pool difficulties are not set below the floor this implies for each miner type."`
 	PaymentMethod         string   `long:"paymentmethod" ini-name:"paymentmethod" description:"The payment method of the pool. {pps, pplns}"`
 	LastNPeriod           uint32   `long:"lastnperiod" ini-name:"lastnperiod" description:"The time period of interest, in seconds, when using PPLNS payment scheme."`
 	WalletPass            string   `long:"walletpass" ini-name:"walletpass" description:"The wallet passphrase."`
@@ -109,17 +170,144 @@ type config struct {
 	TLSKey                string   `long:"tlskey" ini-name:"tlskey" description:"Path to the TLS key file."`
 	Designation           string   `long:"designation" ini-name:"designation" description:"The designated codename for this pool. Customises the logo in the top toolbar."`
 	MaxConnectionsPerHost uint32   `long:"maxconnperhost" init-name:"maxconnperhost" description:"The maximum number of connections allowed per host."`
+	MinNotifyInterval     uint32   `long:"minnotifyinterval" ini-name:"minnotifyinterval" description:"The minimum interval, in seconds, between work notifications that do not invalidate previous jobs sent to a client."`
+	InitialWorkDelay      uint32   `long:"initialworkdelay" ini-name:"initialworkdelay" description:"The delay, in milliseconds, between a client completing its authorize and subscribe handshake and it being sent its initial work, for miners that need a gap before their first job."`
+	KeepAlivePeriod       uint32   `long:"keepaliveperiod" ini-name:"keepaliveperiod" description:"The period, in seconds, between TCP keepalive probes of client connections, 0 to disable keepalives."`
+	WriteTimeout          uint32   `long:"writetimeout" ini-name:"writetimeout" description:"The duration, in seconds, a message write to a client can block for before the client is disconnected, 0 for no timeout."`
+	MaxReadMessageSize    uint32   `long:"maxreadmessagesize" ini-name:"maxreadmessagesize" description:"The maximum size, in bytes, of a message read from a client, clients sending larger messages are disconnected."`
+	MaxWriteMessageSize   uint32   `long:"maxwritemessagesize" ini-name:"maxwritemessagesize" description:"The maximum size, in bytes, of a message written to a client, larger messages are logged and dropped."`
+	AuthorizeLimit        uint32   `long:"authorizelimit" ini-name:"authorizelimit" description:"The number of authorize requests allowed per minute for each client host."`
+	SubscribeLimit        uint32   `long:"subscribelimit" ini-name:"subscribelimit" description:"The number of subscribe requests allowed per minute for each client host."`
+	SubmitLimit           uint32   `long:"submitlimit" ini-name:"submitlimit" description:"The minimum number of work submissions allowed per second for each client host, the limit scales up with the expected share rate of the client at its difficulty."`
+	MaxInFlight           uint32   `long:"maxinflight" ini-name:"maxinflight" description:"The maximum number of unprocessed messages allowed per client, messages beyond it are refused and clients repeatedly exceeding it are disconnected. 0 for no limit."`
+	StaleJobWindow        uint32   `long:"stalejobwindow" ini-name:"stalejobwindow" description:"The number of blocks below the current height, inclusive, work submissions for superseded chain tips are still accepted for, 0 to reject all of them."`
+	StaleGracePeriod      uint32   `long:"stalegraceperiod" ini-name:"stalegraceperiod" description:"The period, in milliseconds, after a clean job notification during which work for the job notified before it is credited as late instead of rejected as stale. Late work is never submitted to the network. 0 to disable."`
+	MaxJobs               uint32   `long:"maxjobs" ini-name:"maxjobs" description:"The maximum number of jobs retained for validating work submissions, the least recently notified jobs are evicted first. Evicted jobs remain valid until the read deadline of clients notified of them passes. 0 for no limit."`
+	SelfServeSettings     bool     `long:"selfservesettings" ini-name:"selfservesettings" description:"Let miners of locked accounts change their minimum payout and activity digest period from the miner through the non-standard pool.set_option stratum method."`
+	LatencyMetrics        bool     `long:"latencymetrics" ini-name:"latencymetrics" description:"Record rolling histograms of the time spent in each stage of work submissions, served with the pool stats."`
+	SlowSubmitThreshold   uint32   `long:"slowsubmitthreshold" ini-name:"slowsubmitthreshold" description:"The duration, in milliseconds, above which work submissions are logged with their stage latencies when latency metrics are enabled, 0 to disable."`
+	StatsInterval         uint32   `long:"statsinterval" ini-name:"statsinterval" description:"The interval, in seconds, pool statistics are recorded at for historical charts, 0 to disable recording."`
+	ResyncInterval        uint32   `long:"resyncinterval" ini-name:"resyncinterval" description:"The interval, in seconds, the pool's chain state is compared against the daemon's best block to replay missed block notifications, 0 to only resync on daemon reconnects."`
+	MaxEndpointClients    uint32   `long:"maxendpointclients" ini-name:"maxendpointclients" description:"The maximum number of clients allowed per miner endpoint, 0 for no limit."`
+	WebhookURLs           []string `long:"webhookurls" ini-name:"webhookurls" description:"The webhook urls pool events are posted to."`
+	WebhookEvents         []string `long:"webhookevents" ini-name:"webhookevents" description:"The pool events posted to webhooks, all events are posted if none are provided. {blockfound, blockaccepted, paymentsent, paymentsdeferred, workeroffline, workeronline, maintenancestarted, maintenanceended, blocklost, accountdigest, accountidcollision}"`
+	HealthCritical        []string `long:"healthcritical" ini-name:"healthcritical" description:"The components whose failure marks the pool unhealthy on the /health endpoint. {daemon, wallet, db, endpoints, work, chainstate, payments, targets}"`
+	AuthTokenLifetime     uint32   `long:"authtokenlifetime" ini-name:"authtokenlifetime" description:"The period, in hours, authorization tokens of locked accounts remain valid for."`
+	MaxAuthFailures       uint32   `long:"maxauthfailures" ini-name:"maxauthfailures" description:"The number of failed authorizations of locked accounts or api keys within an hour after which a host is banned, 0 for no limit."`
+	AuthFailureBan        uint32   `long:"authfailureban" ini-name:"authfailureban" description:"The duration, in minutes, hosts exceeding the failed authorization limit are banned for."`
+	WorkerOfflinePeriod   uint32   `long:"workerofflineperiod" ini-name:"workerofflineperiod" description:"The period, in seconds, without shares after which an active worker is considered offline."`
+	WorkerRetention       uint32   `long:"workerretention" ini-name:"workerretention" description:"The period, in days, after which workers no longer seen are pruned. 0 keeps all workers."`
+	ConnAuditRetention    uint32   `long:"connauditretention" ini-name:"connauditretention" description:"The period, in days, audit records of client connections are kept for. 0 disables the connection audit log."`
+	WebhookSecret         string   `long:"webhooksecret" ini-name:"webhooksecret" default-mask:"-" description:"The secret used in signing webhook requests. Signatures are provided as hex encoded HMAC-SHA256 digests of the request body in the X-Eacrpool-Signature header."`
+	ShareLogFile          string   `long:"sharelogfile" ini-name:"sharelogfile" description:"The file accepted and rejected shares are appended to as JSON lines for external analytics, share logging is disabled if not set."`
+	ShareLogMaxSize       uint32   `long:"sharelogmaxsize" ini-name:"sharelogmaxsize" description:"The size, in megabytes, the share log is rotated at, 0 to disable rotation."`
+	ShareLogMaxRolls      uint32   `long:"sharelogmaxrolls" ini-name:"sharelogmaxrolls" description:"The number of rotated share log files kept."`
+	ShareLogSync          string   `long:"sharelogsync" ini-name:"sharelogsync" description:"When the share log is synced to disk. {none, write, interval}"`
+	ShareLogSyncInterval  uint32   `long:"sharelogsyncinterval" ini-name:"sharelogsyncinterval" description:"The interval, in seconds, the share log is synced to disk at with the interval sync policy."`
+	CaptureDir            string   `long:"capturedir" ini-name:"capturedir" description:"The directory client trace captures started by admins are written to as JSON lines, captures are only kept in memory if not set."`
+	CaptureDuration       uint32   `long:"captureduration" ini-name:"captureduration" description:"The period, in minutes, a client trace capture runs for before it is disabled."`
+	CaptureMaxSize        uint32   `long:"capturemaxsize" ini-name:"capturemaxsize" description:"The size, in megabytes, of the frames captured by a client trace capture before it is disabled."`
+	InstanceID            uint32   `long:"instanceid" ini-name:"instanceid" description:"The id of the pool instance, used to partition the extraNonce1 space between pool instances sharing an address. Every instance sharing the address must use a distinct id."`
+	InstanceBits          uint32   `long:"instancebits" ini-name:"instancebits" description:"The number of leading extraNonce1 bits reserved for the instance id, at most 8. 0 when the pool instance does not share its nonce space."`
+	MaxWorkerNameLength   uint32   `long:"maxworkernamelength" ini-name:"maxworkernamelength" description:"The maximum length of worker names, longer names are truncated or refused with strict worker names."`
+	StrictWorkerNames     bool     `long:"strictworkernames" ini-name:"strictworkernames" description:"Refuse authorizations with worker names containing characters other than letters, digits, dashes and underscores or exceeding the maximum length, instead of sanitizing them."`
 	Profile               string   `long:"profile" init-name:"profile" description:"Enable HTTP profiling on given [addr:]port -- NOTE port must be between 1024 and 65536"`
+	MinerPolicies         []string `long:"minerpolicies" ini-name:"minerpolicies" description:"The policies of miner types, as miner=policy. CPU miners are rejected on mainnet and all other miner types are allowed by default. {allow, reject, noreward}"`
+	ExtraEndpoints        []string `long:"extraendpoints" ini-name:"extraendpoints" description:"Additional miner endpoints with scaled difficulties, as miner:port:multiplier. eg. antminerdr5:5564:4 serves Antminer DR5 clients at four times the default difficulty on port 5564."`
+	Maintenance           []string `long:"maintenance" ini-name:"maintenance" description:"The scheduled maintenance windows miner endpoints are paused for, as a cron expression in UTC or RFC3339 timestamp followed by the window duration. eg. \"0 2 * * 0 15m\" pauses mining every Sunday from 02:00 to 02:15 UTC."`
+	MaintenanceMessage    string   `long:"maintenancemessage" ini-name:"maintenancemessage" description:"The message miners are sent when maintenance starts, a message describing the maintenance window is sent if not set."`
+	MaintenanceWarning    uint32   `long:"maintenancewarning" ini-name:"maintenancewarning" description:"The period, in minutes, before a maintenance window miners are warned of it, 0 to disable warnings."`
+	FastPath              bool     `long:"fastpath" ini-name:"fastpath" description:"Validate shares of trusted clients, whose workers have a long record of accepted shares with few rejections at a stable difficulty, on a fast path that skips job lookups and difficulty computations."`
+	SpotCheckRate         float64  `long:"spotcheckrate" ini-name:"spotcheckrate" description:"The fraction of the shares of trusted clients still fully validated with the fast path, between 0 and 1. eg. 0.1 (10%)"`
+	MaxClockSkew          uint32   `long:"maxclockskew" ini-name:"maxclockskew" description:"The median difference, in seconds, between the timestamps of a client's shares and the pool's clock beyond which its miner is advised to synchronize its clock, 0 to disable the advice."`
+	MaintenanceBackup     bool     `long:"maintenancebackup" ini-name:"maintenancebackup" description:"Save a compacted backup of the database next to it at the start of every maintenance window."`
+	ListenAddrs           []string `long:"listenaddrs" ini-name:"listenaddrs" description:"The addresses miner endpoints listen on, as port=host:port. eg. 5550=[::]:5550 serves the endpoint on port 5550 on all IPv6 interfaces. Endpoints listen on all IPv4 interfaces on their port by default."`
 	CPUPort               uint32   `long:"cpuport" ini-name:"cpuport" description:"CPU miner connection port."`
 	D9Port                uint32   `long:"d9port" ini-name:"d9port" description:"Innosilicon D9 connection port."`
 	DR3Port               uint32   `long:"dr3port" ini-name:"dr3port" description:"Antminer DR3 connection port."`
 	DR5Port               uint32   `long:"dr5port" ini-name:"dr5port" description:"Antminer DR5 connection port."`
 	D1Port                uint32   `long:"d1port" ini-name:"d1port" description:"Whatsminer D1 connection port."`
 	poolFeeAddrs          []dcrutil.Address
+	donationAddr          dcrutil.Address
+	minerPolicies         map[string]string
+	extraEndpoints        []*pool.EndpointSpec
+	listenAddrs           map[uint32][]string
+	maintenance           []*pool.MaintenanceEntry
 	dcrdRPCCerts          []byte
 	net                   *chaincfg.Params
 }
 
+// runtimeOptions represents the options applied when the configuration is
+// reloaded, changing any other option requires a restart.
+var runtimeOptions = map[string]struct{}{
+	"debuglevel":           {},
+	"poolfee":              {},
+	"minpayment":           {},
+	"lastnperiod":          {},
+	"maxtxfeereserve":      {},
+	"maxpaymentoutputs":    {},
+	"maxpaymenttxsize":     {},
+	"maxpaymentretries":    {},
+	"paymentretrybackoff":  {},
+	"balanceretryinterval": {},
+	"maxgentime":           {},
+	"maxsharerate":         {},
+	"authorizelimit":       {},
+	"subscribelimit":       {},
+	"submitlimit":          {},
+	"workerofflineperiod":  {},
+	"workerretention":      {},
+	"extraendpoints":       {},
+}
+
+// sameEndpoints returns if the provided additional endpoints serve the same
+// miners on the same ports, regardless of their difficulty multipliers.
+func sameEndpoints(a []*pool.EndpointSpec, b []*pool.EndpointSpec) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	miners := make(map[uint32]string, len(a))
+	for _, spec := range a {
+		miners[spec.Port] = spec.Miner
+	}
+	for _, spec := range b {
+		miner, ok := miners[spec.Port]
+		if !ok || miner != spec.Miner {
+			return false
+		}
+	}
+	return true
+}
+
+// configChanges returns the options that differ between the provided
+// configurations, split into the options applied at runtime and the options
+// requiring a restart. Changing the miners or ports of additional endpoints
+// requires a restart, their difficulty multipliers are applied at runtime.
+func configChanges(current *config, reloaded *config) ([]string, []string) {
+	var applied, restart []string
+	cv := reflect.ValueOf(current).Elem()
+	rv := reflect.ValueOf(reloaded).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		option := cv.Type().Field(i).Tag.Get("long")
+		if option == "" {
+			continue
+		}
+		if reflect.DeepEqual(cv.Field(i).Interface(), rv.Field(i).Interface()) {
+			continue
+		}
+		_, ok := runtimeOptions[option]
+		if option == "extraendpoints" {
+			ok = sameEndpoints(current.extraEndpoints, reloaded.extraEndpoints)
+		}
+		if !ok {
+			restart = append(restart, option)
+			continue
+		}
+		applied = append(applied, option)
+	}
+	return applied, restart
+}
+
 // serviceOptions defines the configuration options for the daemon as a service on
 // Windows.
 type serviceOptions struct {
@@ -166,7 +354,8 @@ func parseAndSetDebugLevels(debugLevel string) error {
 	}
 
 	// Split the specified string into subsystem/level pairs while detecting
-	// issues and update the log levels accordingly.
+	// issues, the log levels are only updated once all pairs are valid.
+	levels := make(map[string]string)
 	for _, logLevelPair := range strings.Split(debugLevel, ",") {
 		if !strings.Contains(logLevelPair, "=") {
 			str := "the specified debug level contains an invalid " +
@@ -191,6 +380,9 @@ func parseAndSetDebugLevels(debugLevel string) error {
 			return fmt.Errorf(str, logLevel)
 		}
 
+		levels[subsysID] = logLevel
+	}
+	for subsysID, logLevel := range levels {
 		setLogLevel(subsysID, logLevel)
 	}
 
@@ -308,6 +500,22 @@ func cleanAndExpandPath(path string) string {
 // while still allowing the user to override settings with config files and
 // command line options.  Command line options always take precedence.
 func loadConfig() (*config, []string, error) {
+	return parseConfig(true)
+}
+
+// reloadConfig re-reads the configuration file and command line options the
+// pool was started with and validates them. Unlike loadConfig it does not
+// run service commands or initialize logging, debug levels of the reloaded
+// configuration are left for the caller to apply.
+func reloadConfig() (*config, error) {
+	cfg, _, err := parseConfig(false)
+	return cfg, err
+}
+
+// parseConfig parses and validates the configuration, as described by
+// loadConfig. Service commands, logging and debug levels are only set up
+// at startup.
+func parseConfig(startup bool) (*config, []string, error) {
 	// Default config.
 	cfg := config{
 		HomeDir:               eacrpoolHomeDir,
@@ -321,15 +529,24 @@ func loadConfig() (*config, []string, error) {
 		DcrdRPCHost:           defaultDcrdRPCHost,
 		WalletGRPCHost:        defaultWalletGRPCHost,
 		PoolFeeAddrs:          []string{defaultPoolFeeAddr},
+		HealthCritical:        defaultHealthCritical,
 		PoolFee:               defaultPoolFee,
 		MaxTxFeeReserve:       defaultMaxTxFeeReserve,
+		MaxPaymentOutputs:     defaultMaxPaymentOutputs,
+		MaxPaymentTxSize:      defaultMaxPaymentTxSize,
+		MaxPaymentRetries:     defaultMaxPaymentRetries,
+		PaymentRetryBackoff:   defaultPaymentRetryBackoff,
+		BalanceRetryInterval:  defaultBalanceRetryInterval,
 		MaxGenTime:            defaultMaxGenTime,
+		MaxShareRate:          defaultMaxShareRate,
 		ActiveNet:             defaultActiveNet,
 		PaymentMethod:         defaultPaymentMethod,
 		LastNPeriod:           defaultLastNPeriod,
 		WalletPass:            defaultWalletPass,
 		MinPayment:            defaultMinPayment,
 		SoloPool:              defaultSoloPool,
+		RepairDB:              defaultRepairDB,
+		Reporting:             defaultReporting,
 		GUIPort:               defaultGUIPort,
 		GUIDir:                defaultGUIDir,
 		UseLEHTTPS:            defaultUseLEHTTPS,
@@ -337,6 +554,40 @@ func loadConfig() (*config, []string, error) {
 		TLSKey:                defaultTLSKeyFile,
 		Designation:           defaultDesignation,
 		MaxConnectionsPerHost: defaultMaxConnectionsPerHost,
+		MaxEndpointClients:    defaultMaxEndpointClients,
+		MinNotifyInterval:     defaultMinNotifyInterval,
+		InitialWorkDelay:      defaultInitialWorkDelay,
+		KeepAlivePeriod:       defaultKeepAlivePeriod,
+		WriteTimeout:          defaultWriteTimeout,
+		MaxReadMessageSize:    defaultMaxReadMessageSize,
+		MaxWriteMessageSize:   defaultMaxWriteMessageSize,
+		MaxInFlight:           defaultMaxInFlight,
+		AuthorizeLimit:        defaultAuthorizeLimit,
+		SubscribeLimit:        defaultSubscribeLimit,
+		SubmitLimit:           defaultSubmitLimit,
+		StaleJobWindow:        defaultStaleJobWindow,
+		StaleGracePeriod:      defaultStaleGracePeriod,
+		MaxJobs:               defaultMaxJobs,
+		StatsInterval:         defaultStatsInterval,
+		ResyncInterval:        defaultResyncInterval,
+		WorkerOfflinePeriod:   defaultWorkerOfflinePeriod,
+		WorkerRetention:       defaultWorkerRetention,
+		ConnAuditRetention:    defaultConnAuditRetention,
+		AuthTokenLifetime:     defaultAuthTokenLifetime,
+		MaxAuthFailures:       defaultMaxAuthFailures,
+		AuthFailureBan:        defaultAuthFailureBan,
+		MaintenanceWarning:    defaultMaintenanceWarning,
+		SpotCheckRate:         defaultSpotCheckRate,
+		MaxClockSkew:          defaultMaxClockSkew,
+		InstanceID:            defaultInstanceID,
+		InstanceBits:          defaultInstanceBits,
+		MaxWorkerNameLength:   defaultMaxWorkerNameLength,
+		ShareLogMaxSize:       defaultShareLogMaxSize,
+		ShareLogMaxRolls:      defaultShareLogMaxRolls,
+		ShareLogSync:          defaultShareLogSync,
+		ShareLogSyncInterval:  defaultShareLogSyncInterval,
+		CaptureDuration:       defaultCaptureDuration,
+		CaptureMaxSize:        defaultCaptureMaxSize,
 		CPUPort:               defaultCPUPort,
 		D9Port:                defaultD9Port,
 		DR3Port:               defaultDR3Port,
@@ -376,7 +627,7 @@ func loadConfig() (*config, []string, error) {
 	// Perform service command and exit if specified.  Invalid service
 	// commands show an appropriate error.  Only runs on Windows since
 	// the runServiceCommand function will be nil when not on Windows.
-	if serviceOpts.ServiceCommand != "" && runServiceCommand != nil {
+	if startup && serviceOpts.ServiceCommand != "" && runServiceCommand != nil {
 		err := runServiceCommand(serviceOpts.ServiceCommand)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
@@ -489,11 +740,19 @@ func loadConfig() (*config, []string, error) {
 
 	cfg.DataDir = cleanAndExpandPath(cfg.DataDir)
 	cfg.LogDir = cleanAndExpandPath(cfg.LogDir)
-	logRotator = nil
+	if cfg.ShareLogFile != "" {
+		cfg.ShareLogFile = cleanAndExpandPath(cfg.ShareLogFile)
+	}
+	if cfg.CaptureDir != "" {
+		cfg.CaptureDir = cleanAndExpandPath(cfg.CaptureDir)
+	}
+	if startup {
+		logRotator = nil
 
-	// Initialize log rotation.  After log rotation has been initialized, the
-	// logger variables may be used.
-	initLogRotator(filepath.Join(cfg.LogDir, defaultLogFilename))
+		// Initialize log rotation.  After log rotation has been initialized,
+		// the logger variables may be used.
+		initLogRotator(filepath.Join(cfg.LogDir, defaultLogFilename))
+	}
 
 	// Ensure the backup password is set.
 	if cfg.BackupPass == "" {
@@ -502,6 +761,39 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Ensure the maximum share rate is positive.
+	if cfg.MaxShareRate <= 0 {
+		str := "%s: maxsharerate must be greater than zero"
+		err := fmt.Errorf(str, funcName)
+		return nil, nil, err
+	}
+
+	// Ensure the spot check rate is a fraction.
+	if cfg.SpotCheckRate < 0 || cfg.SpotCheckRate > 1 {
+		str := "%s: spotcheckrate must be between 0 and 1"
+		err := fmt.Errorf(str, funcName)
+		return nil, nil, err
+	}
+
+	// Ensure the instance id fits the reserved extraNonce1 bits.
+	err = pool.ValidateInstanceID(cfg.InstanceID, cfg.InstanceBits)
+	if err != nil {
+		str := "%s: invalid instanceid: %v"
+		err := fmt.Errorf(str, funcName, err)
+		return nil, nil, err
+	}
+
+	// Ensure a valid share log sync policy is set.
+	switch cfg.ShareLogSync {
+	case pool.ShareLogSyncNone, pool.ShareLogSyncWrite,
+		pool.ShareLogSyncInterval:
+	default:
+		str := "%s: sharelogsync must be one of %s, %s or %s"
+		err := fmt.Errorf(str, funcName, pool.ShareLogSyncNone,
+			pool.ShareLogSyncWrite, pool.ShareLogSyncInterval)
+		return nil, nil, err
+	}
+
 	// Create the data directory.
 	err = os.MkdirAll(cfg.DataDir, 0700)
 	if err != nil {
@@ -517,11 +809,13 @@ func loadConfig() (*config, []string, error) {
 	}
 
 	// Parse, validate, and set debug log level(s).
-	if err := parseAndSetDebugLevels(cfg.DebugLevel); err != nil {
-		err := fmt.Errorf("%s: %v", funcName, err.Error())
-		fmt.Fprintln(os.Stderr, err)
-		fmt.Fprintln(os.Stderr, usageMessage)
-		return nil, nil, err
+	if startup {
+		if err := parseAndSetDebugLevels(cfg.DebugLevel); err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err.Error())
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
 	}
 
 	// Set the mining active network.
@@ -537,6 +831,114 @@ func loadConfig() (*config, []string, error) {
 			cfg.ActiveNet)
 	}
 
+	// Parse and validate the miner policies.
+	cfg.minerPolicies = make(map[string]string, len(cfg.MinerPolicies))
+	for _, entry := range cfg.MinerPolicies {
+		parts := strings.Split(entry, "=")
+		if len(parts) != 2 {
+			str := "%s: miner policy '%v' is not of the form miner=policy"
+			err := fmt.Errorf(str, funcName, entry)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		miner := strings.TrimSpace(parts[0])
+		policy := strings.TrimSpace(parts[1])
+		err := pool.ValidateMinerPolicy(miner, policy)
+		if err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.minerPolicies[miner] = policy
+	}
+
+	// Parse and validate the additional miner endpoints.
+	for _, entry := range cfg.ExtraEndpoints {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			str := "%s: endpoint '%v' is not of the form miner:port:multiplier"
+			err := fmt.Errorf(str, funcName, entry)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		miner := strings.TrimSpace(parts[0])
+		port, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 16)
+		if err != nil || port == 0 {
+			str := "%s: invalid port for endpoint '%v'"
+			err := fmt.Errorf(str, funcName, entry)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		multiplier, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+		if err != nil || multiplier <= 0 {
+			str := "%s: invalid difficulty multiplier for endpoint '%v'"
+			err := fmt.Errorf(str, funcName, entry)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		err = pool.ValidateMiner(miner)
+		if err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.extraEndpoints = append(cfg.extraEndpoints, &pool.EndpointSpec{
+			Miner:          miner,
+			Port:           uint32(port),
+			DiffMultiplier: multiplier,
+		})
+	}
+
+	// Parse and validate the endpoint listen addresses.
+	cfg.listenAddrs = make(map[uint32][]string)
+	for _, entry := range cfg.ListenAddrs {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			str := "%s: listen address '%v' is not of the form port=host:port"
+			err := fmt.Errorf(str, funcName, entry)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		port, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 16)
+		if err != nil || port == 0 {
+			str := "%s: invalid endpoint port for listen address '%v'"
+			err := fmt.Errorf(str, funcName, entry)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		addr := strings.TrimSpace(parts[1])
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil || (host != "" && net.ParseIP(host) == nil) {
+			str := "%s: invalid listen address '%v'"
+			err := fmt.Errorf(str, funcName, entry)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.listenAddrs[uint32(port)] = append(cfg.listenAddrs[uint32(port)],
+			addr)
+	}
+
+	// Parse and validate the maintenance schedule.
+	for _, spec := range cfg.Maintenance {
+		entry, err := pool.ParseMaintenanceEntry(spec)
+		if err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.maintenance = append(cfg.maintenance, entry)
+	}
+
 	if !cfg.SoloPool {
 		// Ensure a valid payment method is set.
 		if cfg.PaymentMethod != pool.PPS && cfg.PaymentMethod != pool.PPLNS {
@@ -557,6 +959,19 @@ func loadConfig() (*config, []string, error) {
 
 			cfg.poolFeeAddrs = append(cfg.poolFeeAddrs, addr)
 		}
+
+		if cfg.DonationAddr != "" {
+			addr, err := dcrutil.DecodeAddress(cfg.DonationAddr, cfg.net)
+			if err != nil {
+				str := "%s: donation address '%v' failed to decode: %v"
+				err := fmt.Errorf(str, funcName, cfg.DonationAddr, err)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+
+			cfg.donationAddr = addr
+		}
 	}
 
 	// Warn about missing config file only after all other configuration is
@@ -14,6 +14,9 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Eacred/eacrd/dcrutil"
 	"github.com/Eacred/eacrd/rpcclient"
@@ -26,10 +29,104 @@ type miningPool struct {
 	cfg    *config
 	ctx    context.Context
 	cancel context.CancelFunc
+	pool   *pool.Pool
 	hub    *pool.Hub
 	gui    *gui.GUI
 }
 
+// hubConfig creates the hub configuration of the provided pool
+// configuration. The database, the consensus daemon RPC configuration and
+// the miner ports are left for the caller to set.
+func hubConfig(cfg *config) (*pool.HubConfig, error) {
+	minPmt, err := dcrutil.NewAmount(cfg.MinPayment)
+	if err != nil {
+		return nil, err
+	}
+	maxTxFeeReserve, err := dcrutil.NewAmount(cfg.MaxTxFeeReserve)
+	if err != nil {
+		return nil, err
+	}
+	powLimit := cfg.net.PowLimit
+	powLimitF, _ := new(big.Float).SetInt(powLimit).Float64()
+	iterations := math.Pow(2, 256-math.Floor(math.Log2(powLimitF)))
+	return &pool.HubConfig{
+		ActiveNet:             cfg.net,
+		WalletRPCCertFile:     cfg.WalletRPCCert,
+		WalletGRPCHost:        cfg.WalletGRPCHost,
+		PoolFee:               cfg.PoolFee,
+		MaxTxFeeReserve:       maxTxFeeReserve,
+		MaxPaymentOutputs:     cfg.MaxPaymentOutputs,
+		MaxPaymentTxSize:      cfg.MaxPaymentTxSize,
+		MaxPaymentRetries:     cfg.MaxPaymentRetries,
+		PaymentRetryBackoff:   time.Second * time.Duration(cfg.PaymentRetryBackoff),
+		BalanceRetryInterval:  time.Second * time.Duration(cfg.BalanceRetryInterval),
+		PaymentDryRun:         cfg.PaymentDryRun,
+		ConnAuditRetention:    time.Hour * 24 * time.Duration(cfg.ConnAuditRetention),
+		MaintenanceSchedule:   cfg.maintenance,
+		MaintenanceMessage:    cfg.MaintenanceMessage,
+		MaintenanceWarning:    time.Minute * time.Duration(cfg.MaintenanceWarning),
+		MaintenanceBackup:     cfg.MaintenanceBackup,
+		MaxGenTime:            cfg.MaxGenTime,
+		MaxShareRate:          cfg.MaxShareRate,
+		PaymentMethod:         cfg.PaymentMethod,
+		LastNPeriod:           cfg.LastNPeriod,
+		WalletPass:            cfg.WalletPass,
+		MinPayment:            minPmt,
+		PoolFeeAddrs:          cfg.poolFeeAddrs,
+		DonationAddr:          cfg.donationAddr,
+		SoloPool:              cfg.SoloPool,
+		NonceIterations:       iterations,
+		MinerPolicies:         cfg.minerPolicies,
+		ExtraEndpoints:        cfg.extraEndpoints,
+		ListenAddrs:           cfg.listenAddrs,
+		MaxConnectionsPerHost: cfg.MaxConnectionsPerHost,
+		MaxEndpointClients:    cfg.MaxEndpointClients,
+		MinNotifyInterval:     time.Second * time.Duration(cfg.MinNotifyInterval),
+		InitialWorkDelay:      time.Millisecond * time.Duration(cfg.InitialWorkDelay),
+		KeepAlivePeriod:       time.Second * time.Duration(cfg.KeepAlivePeriod),
+		WriteTimeout:          time.Second * time.Duration(cfg.WriteTimeout),
+		MaxReadSize:           cfg.MaxReadMessageSize,
+		MaxWriteSize:          cfg.MaxWriteMessageSize,
+		MaxInFlight:           cfg.MaxInFlight,
+		InstanceID:            cfg.InstanceID,
+		InstanceBits:          cfg.InstanceBits,
+		MaxWorkerNameLength:   cfg.MaxWorkerNameLength,
+		StrictWorkerNames:     cfg.StrictWorkerNames,
+		FastPath:              cfg.FastPath,
+		SpotCheckRate:         cfg.SpotCheckRate,
+		MaxClockSkew:          time.Second * time.Duration(cfg.MaxClockSkew),
+		AuthorizeLimit:        float64(cfg.AuthorizeLimit) / 60,
+		SubscribeLimit:        float64(cfg.SubscribeLimit) / 60,
+		SubmitLimit:           float64(cfg.SubmitLimit),
+		StaleJobWindow:        cfg.StaleJobWindow,
+		StaleGracePeriod:      time.Millisecond * time.Duration(cfg.StaleGracePeriod),
+		MaxJobs:               cfg.MaxJobs,
+		SelfServeSettings:     cfg.SelfServeSettings,
+		LatencyMetrics:        cfg.LatencyMetrics,
+		SlowSubmitThreshold:   time.Millisecond * time.Duration(cfg.SlowSubmitThreshold),
+		StatsInterval:         time.Second * time.Duration(cfg.StatsInterval),
+		ResyncInterval:        time.Second * time.Duration(cfg.ResyncInterval),
+		AuthTokenLifetime:     time.Hour * time.Duration(cfg.AuthTokenLifetime),
+		MaxAuthFailures:       cfg.MaxAuthFailures,
+		AuthFailureBan:        time.Minute * time.Duration(cfg.AuthFailureBan),
+		WebhookURLs:           cfg.WebhookURLs,
+		WebhookEvents:         cfg.WebhookEvents,
+		WebhookSecret:         cfg.WebhookSecret,
+		WorkerOfflinePeriod:   time.Second * time.Duration(cfg.WorkerOfflinePeriod),
+		WorkerRetention:       time.Hour * 24 * time.Duration(cfg.WorkerRetention),
+		HealthCritical:        cfg.HealthCritical,
+		Reporting:             cfg.Reporting,
+		ShareLogFile:          cfg.ShareLogFile,
+		ShareLogMaxSize:       int64(cfg.ShareLogMaxSize) * 1024 * 1024,
+		ShareLogMaxRolls:      int(cfg.ShareLogMaxRolls),
+		ShareLogSync:          cfg.ShareLogSync,
+		ShareLogSyncInterval:  time.Second * time.Duration(cfg.ShareLogSyncInterval),
+		CaptureDir:            cfg.CaptureDir,
+		CaptureDuration:       time.Minute * time.Duration(cfg.CaptureDuration),
+		CaptureMaxSize:        int64(cfg.CaptureMaxSize) * 1024 * 1024,
+	}, nil
+}
+
 // newPool initializes the mining pool.
 func newPool(cfg *config) (*miningPool, error) {
 	p := new(miningPool)
@@ -41,19 +138,8 @@ func newPool(cfg *config) (*miningPool, error) {
 		Pass:         cfg.RPCPass,
 		Certificates: cfg.dcrdRPCCerts,
 	}
-	minPmt, err := dcrutil.NewAmount(cfg.MinPayment)
-	if err != nil {
-		return nil, err
-	}
-	maxTxFeeReserve, err := dcrutil.NewAmount(cfg.MaxTxFeeReserve)
-	if err != nil {
-		return nil, err
-	}
 
 	p.ctx, p.cancel = context.WithCancel(context.Background())
-	powLimit := cfg.net.PowLimit
-	powLimitF, _ := new(big.Float).SetInt(powLimit).Float64()
-	iterations := math.Pow(2, 256-math.Floor(math.Log2(powLimitF)))
 	addPort := func(ports map[string]uint32, key string, entry uint32) error {
 		var match bool
 		var miner string
@@ -74,7 +160,7 @@ func newPool(cfg *config) (*miningPool, error) {
 	// Ensure provided miner ports are unique.
 	minerPorts := make(map[string]uint32)
 	_ = addPort(minerPorts, pool.CPU, cfg.CPUPort)
-	err = addPort(minerPorts, pool.InnosiliconD9, cfg.D9Port)
+	err := addPort(minerPorts, pool.InnosiliconD9, cfg.D9Port)
 	if err != nil {
 		return nil, err
 	}
@@ -91,90 +177,189 @@ func newPool(cfg *config) (*miningPool, error) {
 		return nil, err
 	}
 
-	db, err := pool.InitDB(cfg.DBFile, cfg.SoloPool)
-	if err != nil {
-		return nil, err
+	// Ensure additional endpoint ports are unique.
+	endpointPorts := make(map[string]uint32, len(minerPorts))
+	for miner, port := range minerPorts {
+		endpointPorts[miner] = port
+	}
+	for _, spec := range cfg.extraEndpoints {
+		key := fmt.Sprintf("%s:%d:%v", spec.Miner, spec.Port,
+			spec.DiffMultiplier)
+		err = addPort(endpointPorts, key, spec.Port)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	hcfg := &pool.HubConfig{
-		DB:                    db,
-		ActiveNet:             cfg.net,
-		WalletRPCCertFile:     cfg.WalletRPCCert,
-		WalletGRPCHost:        cfg.WalletGRPCHost,
-		DcrdRPCCfg:            dcrdRPCCfg,
-		PoolFee:               cfg.PoolFee,
-		MaxTxFeeReserve:       maxTxFeeReserve,
-		MaxGenTime:            cfg.MaxGenTime,
-		PaymentMethod:         cfg.PaymentMethod,
-		LastNPeriod:           cfg.LastNPeriod,
-		WalletPass:            cfg.WalletPass,
-		MinPayment:            minPmt,
-		PoolFeeAddrs:          cfg.poolFeeAddrs,
-		SoloPool:              cfg.SoloPool,
-		NonceIterations:       iterations,
-		MinerPorts:            minerPorts,
-		MaxConnectionsPerHost: cfg.MaxConnectionsPerHost,
+	// Ensure listen addresses are only provided for known endpoints.
+	knownPorts := make(map[uint32]struct{}, len(endpointPorts))
+	for _, port := range endpointPorts {
+		knownPorts[port] = struct{}{}
 	}
-	p.hub, err = pool.NewHub(p.cancel, hcfg)
-	if err != nil {
-		return nil, err
+	for port := range cfg.listenAddrs {
+		if _, ok := knownPorts[port]; !ok {
+			return nil, fmt.Errorf("listen addresses provided for "+
+				"unknown endpoint port %d", port)
+		}
 	}
-	err = p.hub.Connect()
+
+	hcfg, err := hubConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
-	err = p.hub.Listen()
+	hcfg.DcrdRPCCfg = dcrdRPCCfg
+	hcfg.MinerPorts = minerPorts
+	p.pool, err = pool.New(&pool.Config{
+		Hub:      hcfg,
+		DBFile:   cfg.DBFile,
+		RepairDB: cfg.RepairDB,
+	})
 	if err != nil {
 		return nil, err
 	}
+	p.hub = p.pool.Hub()
 
 	csrfSecret, err := p.hub.CSRFSecret()
 	if err != nil {
+		p.pool.Shutdown()
 		return nil, err
 	}
 
 	gcfg := &gui.Config{
-		SoloPool:                cfg.SoloPool,
-		GUIDir:                  cfg.GUIDir,
-		BackupPass:              cfg.BackupPass,
-		GUIPort:                 cfg.GUIPort,
-		UseLEHTTPS:              cfg.UseLEHTTPS,
-		Domain:                  cfg.Domain,
-		TLSCertFile:             cfg.TLSCert,
-		TLSKeyFile:              cfg.TLSKey,
-		ActiveNet:               cfg.net,
-		PaymentMethod:           cfg.PaymentMethod,
-		Designation:             cfg.Designation,
-		PoolFee:                 cfg.PoolFee,
-		CSRFSecret:              csrfSecret,
-		MinerPorts:              minerPorts,
-		WithinLimit:             p.hub.WithinLimit,
-		FetchLastWorkHeight:     p.hub.FetchLastWorkHeight,
-		FetchLastPaymentHeight:  p.hub.FetchLastPaymentHeight,
-		AddPaymentRequest:       p.hub.AddPaymentRequest,
-		FetchMinedWork:          p.hub.FetchMinedWork,
-		FetchWorkQuotas:         p.hub.FetchWorkQuotas,
-		FetchPoolHashRate:       p.hub.FetchPoolHashRate,
-		BackupDB:                p.hub.BackupDB,
-		FetchClientInfo:         p.hub.FetchClientInfo,
-		AccountExists:           p.hub.AccountExists,
-		FetchMinedWorkByAccount: p.hub.FetchMinedWorkByAccount,
-		FetchPaymentsForAccount: p.hub.FetchPaymentsForAccount,
-		FetchAccountClientInfo:  p.hub.FetchAccountClientInfo,
+		SoloPool:                 cfg.SoloPool,
+		GUIDir:                   cfg.GUIDir,
+		BackupPass:               cfg.BackupPass,
+		GUIPort:                  cfg.GUIPort,
+		APIPort:                  cfg.APIPort,
+		UseLEHTTPS:               cfg.UseLEHTTPS,
+		Domain:                   cfg.Domain,
+		TLSCertFile:              cfg.TLSCert,
+		TLSKeyFile:               cfg.TLSKey,
+		ActiveNet:                cfg.net,
+		Designation:              cfg.Designation,
+		FetchPoolMetadata:        p.hub.FetchPoolMetadata,
+		CSRFSecret:               csrfSecret,
+		WithinLimit:              p.hub.WithinLimit,
+		FetchLastWorkHeight:      p.hub.FetchLastWorkHeight,
+		FetchLastPaymentHeight:   p.hub.FetchLastPaymentHeight,
+		AddPaymentRequest:        p.hub.AddPaymentRequest,
+		FetchMinedWork:           p.hub.FetchMinedWork,
+		FetchWorkQuotas:          p.hub.FetchWorkQuotas,
+		FetchPoolHashRate:        p.hub.FetchPoolHashRate,
+		BackupDB:                 p.hub.BackupDB,
+		FetchClientInfo:          p.hub.FetchClientInfo,
+		FindClients:              p.hub.FindClients,
+		AccountExists:            p.hub.AccountExists,
+		FetchMinedWorkByAccount:  p.hub.FetchMinedWorkByAccount,
+		FetchPaymentsForAccount:  p.hub.FetchPaymentsForAccount,
+		FetchAccountClientInfo:   p.hub.FetchAccountClientInfo,
+		FetchPaymentFailure:      p.hub.FetchPaymentFailure,
+		FetchPaymentDeferral:     p.hub.FetchPaymentDeferral,
+		ResetPaymentFailure:      p.hub.ResetPaymentFailure,
+		FetchAccountWorkers:      p.hub.FetchAccountWorkers,
+		FetchEndpointCapacity:    p.hub.FetchEndpointCapacity,
+		FetchEndpointChurn:       p.hub.FetchEndpointChurn,
+		PauseEndpoints:           p.hub.PauseEndpoints,
+		ResumeEndpoints:          p.hub.ResumeEndpoints,
+		EndpointsPaused:          p.hub.EndpointsPaused,
+		FetchMaintenance:         p.hub.FetchMaintenance,
+		CancelMaintenance:        p.hub.CancelMaintenance,
+		ScheduleMaintenance:      p.hub.ScheduleMaintenance,
+		FetchRejectCounts:        p.hub.FetchRejectCounts,
+		FetchPoolStats:           p.hub.FetchPoolStats,
+		FetchRecentMinedWork:     p.hub.FetchRecentMinedWork,
+		FetchAccountDashboard:    p.hub.FetchAccountDashboard,
+		FetchAccountPayments:     p.hub.FetchAccountPayments,
+		FetchPaymentSources:      p.hub.FetchPaymentSources,
+		FetchBlockPayments:       p.hub.FetchBlockPayments,
+		DisconnectClient:         p.hub.DisconnectClient,
+		DisconnectAccount:        p.hub.DisconnectAccount,
+		BanIP:                    p.hub.BanIP,
+		UnbanIP:                  p.hub.UnbanIP,
+		FetchBans:                p.hub.FetchBans,
+		FetchBanAuditLog:         p.hub.FetchBanAuditLog,
+		SetTrace:                 p.hub.SetTrace,
+		FetchTraced:              p.hub.FetchTraced,
+		StartCapture:             p.hub.StartCapture,
+		StopCapture:              p.hub.StopCapture,
+		FetchCapture:             p.hub.FetchCapture,
+		FetchCaptures:            p.hub.FetchCaptures,
+		SetAccountFee:            p.hub.SetAccountFee,
+		FetchAccountFees:         p.hub.FetchAccountFees,
+		SetAccountDonation:       p.hub.SetAccountDonation,
+		FetchAccountDonations:    p.hub.FetchAccountDonations,
+		SetAccountPaymentsHeld:   p.hub.SetAccountPaymentsHeld,
+		SetAccountDigest:         p.hub.SetAccountDigest,
+		FetchHeldAccounts:        p.hub.FetchHeldAccounts,
+		FetchQuarantinedPayments: p.hub.FetchQuarantinedPayments,
+		CorrectAccountAddress:    p.hub.CorrectAccountAddress,
+		MergeAccounts:            p.hub.MergeAccounts,
+		FetchAccountMerges:       p.hub.FetchAccountMerges,
+		SetAccountLock:           p.hub.SetAccountLock,
+		GenerateAuthToken:        p.hub.GenerateAuthToken,
+		SetAPIKey:                p.hub.SetAPIKey,
+		ResetAPIKey:              p.hub.ResetAPIKey,
+		VerifyAPIKey:             p.hub.VerifyAPIKey,
+		HealthStatus:             p.hub.HealthStatus,
+		FetchShareWindow:         p.hub.FetchShareWindow,
+		VerifyShareWindowOwner:   p.hub.VerifyShareWindowOwner,
+		FetchConnectionRecords:   p.hub.FetchConnectionRecords,
+		FetchLostBlocks:          p.hub.FetchLostBlocks,
+		SetAccountMetadata:       p.hub.SetAccountMetadata,
+		FetchAccountAdminView:    p.hub.FetchAccountAdminView,
 	}
 	p.gui, err = gui.NewGUI(gcfg)
 	if err != nil {
-		p.hub.CloseListeners()
+		p.pool.Shutdown()
 		return nil, err
 	}
 	return p, nil
 }
 
+// reload re-reads the configuration and applies the changed options that
+// are safe to change at runtime. The reload is refused, leaving the running
+// configuration untouched, if options requiring a restart changed.
+func (p *miningPool) reload() error {
+	cfg, err := reloadConfig()
+	if err != nil {
+		return err
+	}
+	applied, restart := configChanges(p.cfg, cfg)
+	if len(restart) > 0 {
+		return fmt.Errorf("changes to %s require a restart",
+			strings.Join(restart, ", "))
+	}
+	if len(applied) == 0 {
+		mpLog.Infof("No configuration changes to apply")
+		return nil
+	}
+	err = parseAndSetDebugLevels(cfg.DebugLevel)
+	if err != nil {
+		return err
+	}
+	hcfg, err := hubConfig(cfg)
+	if err != nil {
+		return err
+	}
+	err = p.hub.ApplyConfig(hcfg)
+	if err != nil {
+		return err
+	}
+	p.cfg = cfg
+	mpLog.Infof("Applied configuration changes to %s",
+		strings.Join(applied, ", "))
+	return nil
+}
+
 func main() {
 	// Listen for interrupt signals.
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
+	// Listen for hangup signals, which reload the configuration.
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
 	// Load configuration and parse command line. This also initializes logging
 	// and configures it accordingly.
 	cfg, _, err := loadConfig()
@@ -217,14 +402,23 @@ func main() {
 	mpLog.Infof("Started eacrpool.")
 
 	go func() {
-		select {
-		case <-p.ctx.Done():
-			return
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+
+			case <-interrupt:
+				p.cancel()
 
-		case <-interrupt:
-			p.cancel()
+			case <-hangup:
+				mpLog.Infof("Reloading configuration")
+				err := p.reload()
+				if err != nil {
+					mpLog.Errorf("Configuration reload failed: %v", err)
+				}
+			}
 		}
 	}()
 	p.gui.Run(p.ctx)
-	p.hub.Run(p.ctx)
+	p.pool.Run(p.ctx)
 }
@@ -0,0 +1,84 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package gui
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Eacred/eacrpool/pool"
+)
+
+// apiAuthToken represents an authorization token of a locked account served
+// by the api, the expiry is in seconds.
+type apiAuthToken struct {
+	Token  string `json:"token"`
+	Expiry int64  `json:"expiry"`
+}
+
+// writeAPILockError writes the provided account lock error as a json
+// response.
+func writeAPILockError(w http.ResponseWriter, address string, err error) {
+	switch {
+	case pool.IsError(err, pool.ErrUnauthorized):
+		writeAPIError(w, http.StatusUnauthorized, err.Error())
+	case pool.IsError(err, pool.ErrDecode):
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+	case pool.IsError(err, pool.ErrValueNotFound):
+		writeAPIError(w, http.StatusNotFound, "account not found")
+	case pool.IsError(err, pool.ErrNotSupported):
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Errorf("unable to process account lock request for %s: %v",
+			address, err)
+		writeAPIError(w, http.StatusInternalServerError,
+			"unable to process request")
+	}
+}
+
+// PostAPIAccountLock locks or unlocks the account of the provided address,
+// authenticated by a signed lock or unlock challenge.
+func (ui *GUI) PostAPIAccountLock(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+	locked, err := strconv.ParseBool(r.FormValue("locked"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid locked value")
+		return
+	}
+	err = ui.cfg.SetAccountLock(address, r.FormValue("challenge"),
+		r.FormValue("signature"), locked)
+	if err != nil {
+		writeAPILockError(w, address, err)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, map[string]bool{"locked": locked})
+}
+
+// PostAPIAuthToken serves an authorization token for the locked account of
+// the provided address, authenticated by a signed token challenge.
+func (ui *GUI) PostAPIAuthToken(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+	token, expiry, err := ui.cfg.GenerateAuthToken(address,
+		r.FormValue("challenge"), r.FormValue("signature"))
+	if err != nil {
+		writeAPILockError(w, address, err)
+		return
+	}
+
+	// Tokens must not be cached by intermediaries.
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(&apiAuthToken{
+		Token:  token,
+		Expiry: expiry.Unix(),
+	})
+	if err != nil {
+		log.Errorf("unable to encode api response: %v", err)
+	}
+}
@@ -5,19 +5,39 @@
 package gui
 
 import (
+	"encoding/json"
+	"fmt"
 	"html/template"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/csrf"
 
+	"github.com/Eacred/eacrd/dcrutil"
 	"github.com/Eacred/eacrpool/pool"
 )
 
 type adminPageData struct {
-	Connections map[string][]*pool.ClientInfo
-	CSRF        template.HTML
-	Designation string
+	Connections     map[string][]*pool.ClientInfo
+	ClientQuery     string
+	Capacity        []*pool.EndpointCapacity
+	EndpointsPaused bool
+	Maintenance     *pool.MaintenanceStatus
+	Rejects         map[string]uint32
+	AccountFees     map[string]float64
+	Donations       map[string]float64
+	HeldAccounts    map[string]dcrutil.Amount
+	Quarantined     []*pool.Payment
+	Merges          []*pool.AccountMerge
+	Traced          []string
+	Captures        []*pool.CaptureStatus
+	PaymentFailure  *pool.DispatchFailure
+	PaymentDeferral *pool.PaymentDeferral
+	CSRF            template.HTML
+	Designation     string
 }
 
 func (ui *GUI) GetAdmin(w http.ResponseWriter, r *http.Request) {
@@ -46,7 +66,40 @@ func (ui *GUI) GetAdmin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pageData.Connections = ui.cfg.FetchClientInfo()
+	pageData.ClientQuery = strings.TrimSpace(r.FormValue("client"))
+	if pageData.ClientQuery != "" {
+		pageData.Connections = ui.cfg.FindClients(pageData.ClientQuery)
+	} else {
+		pageData.Connections = ui.cfg.FetchClientInfo()
+	}
+	pageData.Capacity = ui.cfg.FetchEndpointCapacity()
+	pageData.EndpointsPaused = ui.cfg.EndpointsPaused()
+	pageData.Maintenance = ui.cfg.FetchMaintenance()
+	pageData.Rejects = ui.cfg.FetchRejectCounts()
+	pageData.AccountFees, err = ui.cfg.FetchAccountFees()
+	if err != nil {
+		log.Errorf("unable to fetch account fees: %v", err)
+	}
+	pageData.Donations, err = ui.cfg.FetchAccountDonations()
+	if err != nil {
+		log.Errorf("unable to fetch account donations: %v", err)
+	}
+	pageData.HeldAccounts, err = ui.cfg.FetchHeldAccounts()
+	if err != nil {
+		log.Errorf("unable to fetch held accounts: %v", err)
+	}
+	pageData.Quarantined, err = ui.cfg.FetchQuarantinedPayments()
+	if err != nil {
+		log.Errorf("unable to fetch quarantined payments: %v", err)
+	}
+	pageData.Merges, err = ui.cfg.FetchAccountMerges()
+	if err != nil {
+		log.Errorf("unable to fetch account merges: %v", err)
+	}
+	pageData.Traced = ui.cfg.FetchTraced()
+	pageData.Captures = ui.cfg.FetchCaptures()
+	pageData.PaymentFailure = ui.cfg.FetchPaymentFailure()
+	pageData.PaymentDeferral = ui.cfg.FetchPaymentDeferral()
 	ui.renderTemplate(w, r, "admin", pageData)
 }
 
@@ -105,6 +158,246 @@ func (ui *GUI) PostLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
+func (ui *GUI) PostRetryPayments(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	err = ui.cfg.ResetPaymentFailure()
+	if err != nil {
+		log.Errorf("unable to retry payments: %v", err)
+		http.Error(w, fmt.Sprintf("Unable to retry payments: %v", err),
+			http.StatusConflict)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (ui *GUI) PostDisconnect(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	reason := r.FormValue("reason")
+	var n int
+	if id := r.FormValue("id"); id != "" {
+		n = ui.cfg.DisconnectClient(id, reason)
+	} else {
+		n = ui.cfg.DisconnectAccount(r.FormValue("account"), reason)
+	}
+	log.Infof("Disconnected %d connection(s)", n)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (ui *GUI) PostBan(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	minutes, err := strconv.ParseUint(r.FormValue("duration"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid ban duration", http.StatusBadRequest)
+		return
+	}
+	duration := time.Minute * time.Duration(minutes)
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	n, err := ui.cfg.BanIP(r.FormValue("ip"), duration, r.FormValue("reason"),
+		"admin@"+host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Infof("Ban disconnected %d connection(s)", n)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (ui *GUI) PostUnban(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	err = ui.cfg.UnbanIP(r.FormValue("ip"), "admin@"+host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (ui *GUI) PostTrace(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	id := strings.TrimSpace(r.FormValue("id"))
+	if id == "" {
+		http.Error(w, "Invalid client or account id", http.StatusBadRequest)
+		return
+	}
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		http.Error(w, "Invalid trace toggle", http.StatusBadRequest)
+		return
+	}
+	ui.cfg.SetTrace(id, enabled)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// PostCapture starts or stops the trace capture of the frames exchanged
+// with a client. Captures can be written to a capture file as well as kept
+// in memory.
+func (ui *GUI) PostCapture(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	id := strings.TrimSpace(r.FormValue("id"))
+	if id == "" {
+		http.Error(w, "Invalid client id", http.StatusBadRequest)
+		return
+	}
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		http.Error(w, "Invalid capture toggle", http.StatusBadRequest)
+		return
+	}
+	if !enabled {
+		err := ui.cfg.StopCapture(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	var toFile bool
+	if v := r.FormValue("file"); v != "" {
+		toFile, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid capture file toggle", http.StatusBadRequest)
+			return
+		}
+	}
+	_, err = ui.cfg.StartCapture(id, toFile)
+	if err != nil {
+		switch {
+		case pool.IsError(err, pool.ErrValueNotFound),
+			pool.IsError(err, pool.ErrNotSupported),
+			pool.IsError(err, pool.ErrOther):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Errorf("unable to start trace capture of %s: %v", id, err)
+			http.Error(w, "Unable to start trace capture",
+				http.StatusInternalServerError)
+		}
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
 func (ui *GUI) PostBackup(w http.ResponseWriter, r *http.Request) {
 	session, err := ui.cookieStore.Get(r, "session")
 	if err != nil {
@@ -135,3 +428,942 @@ func (ui *GUI) PostBackup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// PostAccountFee sets the fee charged to the provided account in place of
+// the pool fee, an empty fee restores the pool fee.
+func (ui *GUI) PostAccountFee(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	var fee *float64
+	if feeStr := r.FormValue("fee"); feeStr != "" {
+		f, err := strconv.ParseFloat(feeStr, 64)
+		if err != nil {
+			http.Error(w, "Invalid account fee", http.StatusBadRequest)
+			return
+		}
+		fee = &f
+	}
+	accountID := r.FormValue("account")
+	err = ui.cfg.SetAccountFee(accountID, fee)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Infof("Updated the fee of account %s", accountID)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// PostAccountDonation sets the fraction of the provided account's payouts
+// donated to the pool, a zero donation disables it.
+func (ui *GUI) PostAccountDonation(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	donation, err := strconv.ParseFloat(r.FormValue("donation"), 64)
+	if err != nil {
+		http.Error(w, "Invalid account donation", http.StatusBadRequest)
+		return
+	}
+	accountID := r.FormValue("account")
+	err = ui.cfg.SetAccountDonation(accountID, donation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Infof("Updated the donation of account %s", accountID)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// PostAccountPaymentHold holds or releases payouts to the provided account.
+func (ui *GUI) PostAccountPaymentHold(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	held, err := strconv.ParseBool(r.FormValue("held"))
+	if err != nil {
+		http.Error(w, "Invalid payment hold", http.StatusBadRequest)
+		return
+	}
+	accountID := r.FormValue("account")
+	err = ui.cfg.SetAccountPaymentsHeld(accountID, held)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if held {
+		log.Infof("Held payments of account %s", accountID)
+	} else {
+		log.Infof("Released payments of account %s", accountID)
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// PostAccountDigest opts the provided account into activity digests
+// covering the provided number of hours, zero hours opts it out.
+func (ui *GUI) PostAccountDigest(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	hours, err := strconv.ParseUint(r.FormValue("hours"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid digest interval", http.StatusBadRequest)
+		return
+	}
+	accountID := r.FormValue("account")
+	interval := time.Hour * time.Duration(hours)
+	err = ui.cfg.SetAccountDigest(accountID, interval)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if interval == 0 {
+		log.Infof("Account %s opted out of activity digests", accountID)
+	} else {
+		log.Infof("Account %s opted into activity digests every %v",
+			accountID, interval)
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// PostAccountAPIKey rotates or revokes the api key of the provided account.
+// A rotated key is served once, for the admin to hand to the account owner.
+func (ui *GUI) PostAccountAPIKey(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	revoke, err := strconv.ParseBool(r.FormValue("revoke"))
+	if err != nil {
+		http.Error(w, "Invalid api key action", http.StatusBadRequest)
+		return
+	}
+	accountID := strings.TrimSpace(r.FormValue("account"))
+	key, err := ui.cfg.ResetAPIKey(accountID, revoke)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if revoke {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, &apiKey{Key: key})
+}
+
+// PostAccountAddress corrects the payout address of the provided account and
+// requeues its quarantined payments. The address of a locked account is only
+// corrected with a signed address challenge.
+func (ui *GUI) PostAccountAddress(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	accountID := r.FormValue("account")
+	requeued, err := ui.cfg.CorrectAccountAddress(accountID,
+		strings.TrimSpace(r.FormValue("address")),
+		r.FormValue("challenge"), r.FormValue("signature"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Infof("Corrected the address of account %s, requeued %d "+
+		"payment(s)", accountID, requeued)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// PostMergeAccounts merges the history of the provided account into another
+// account, clients of the merged account are disconnected to reauthorize.
+func (ui *GUI) PostMergeAccounts(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	fromID := strings.TrimSpace(r.FormValue("from"))
+	toID := strings.TrimSpace(r.FormValue("to"))
+	_, err = ui.cfg.MergeAccounts(fromID, toID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// PostPauseEndpoints pauses or resumes the miner endpoints, miners are sent
+// the provided message when paused.
+func (ui *GUI) PostPauseEndpoints(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	paused, err := strconv.ParseBool(r.FormValue("paused"))
+	if err != nil {
+		http.Error(w, "Invalid pause toggle", http.StatusBadRequest)
+		return
+	}
+	if paused {
+		ui.cfg.PauseEndpoints(strings.TrimSpace(r.FormValue("message")))
+	} else {
+		ui.cfg.ResumeEndpoints()
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// PostMaintenance cancels the maintenance window in progress or schedules a
+// one-shot maintenance window starting at the provided unix time, in
+// seconds, for the provided number of minutes.
+func (ui *GUI) PostMaintenance(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "cancel":
+		err = ui.cfg.CancelMaintenance()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+	case "schedule":
+		start, err := parseUnixTime(strings.TrimSpace(r.FormValue("start")))
+		if err != nil || start == 0 {
+			http.Error(w, "Invalid maintenance start", http.StatusBadRequest)
+			return
+		}
+		minutes, err := strconv.ParseUint(
+			strings.TrimSpace(r.FormValue("minutes")), 10, 32)
+		if err != nil || minutes == 0 {
+			http.Error(w, "Invalid maintenance duration",
+				http.StatusBadRequest)
+			return
+		}
+		err = ui.cfg.ScheduleMaintenance(time.Unix(0, start),
+			time.Minute*time.Duration(minutes))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+	default:
+		http.Error(w, "Invalid maintenance action", http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// adminConnection represents the audit record of a client connection served
+// by the admin api, timestamps are in seconds.
+type adminConnection struct {
+	ClientID       string `json:"clientid"`
+	IP             string `json:"ip"`
+	Miner          string `json:"miner"`
+	Account        string `json:"account,omitempty"`
+	Worker         string `json:"worker,omitempty"`
+	ConnectedOn    int64  `json:"connectedon"`
+	DisconnectedOn int64  `json:"disconnectedon"`
+	Accepted       int64  `json:"accepted"`
+	Rejected       int64  `json:"rejected"`
+	Reason         string `json:"reason"`
+}
+
+// maxAdminConnections is the maximum number of connection records served
+// per admin api request.
+const maxAdminConnections = 1000
+
+// GetAdminConnections serves the audit records of client connections
+// matching the ip, account and time range, in unix seconds, of the request.
+// Only admin sessions are served.
+func (ui *GUI) GetAdminConnections(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		writeAdminResponse(w, http.StatusUnauthorized,
+			map[string]string{"error": "admin session required"})
+		return
+	}
+
+	q := &pool.ConnectionQuery{
+		IP:      strings.TrimSpace(r.FormValue("ip")),
+		Account: strings.TrimSpace(r.FormValue("account")),
+		Limit:   100,
+	}
+	q.Since, err = parseUnixTime(r.FormValue("since"))
+	if err != nil {
+		writeAdminResponse(w, http.StatusBadRequest,
+			map[string]string{"error": "invalid since time"})
+		return
+	}
+	q.Until, err = parseUnixTime(r.FormValue("until"))
+	if err != nil {
+		writeAdminResponse(w, http.StatusBadRequest,
+			map[string]string{"error": "invalid until time"})
+		return
+	}
+	if v := r.FormValue("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxAdminConnections {
+			writeAdminResponse(w, http.StatusBadRequest,
+				map[string]string{"error": fmt.Sprintf("limit must be "+
+					"between 1 and %d", maxAdminConnections)})
+			return
+		}
+		q.Limit = limit
+	}
+
+	records, err := ui.cfg.FetchConnectionRecords(q)
+	if err != nil {
+		log.Errorf("unable to fetch connection records: %v", err)
+		writeAdminResponse(w, http.StatusInternalServerError,
+			map[string]string{"error": "unable to fetch connection records"})
+		return
+	}
+	resp := make([]*adminConnection, 0, len(records))
+	for _, record := range records {
+		resp = append(resp, &adminConnection{
+			ClientID:       record.ClientID,
+			IP:             record.IP,
+			Miner:          record.Miner,
+			Account:        record.Account,
+			Worker:         record.Worker,
+			ConnectedOn:    nanoToSeconds(record.ConnectedOn),
+			DisconnectedOn: nanoToSeconds(record.DisconnectedOn),
+			Accepted:       record.Accepted,
+			Rejected:       record.Rejected,
+			Reason:         record.Reason,
+		})
+	}
+	writeAdminResponse(w, http.StatusOK, resp)
+}
+
+// adminConnFailure represents a recent connection failure of a miner
+// endpoint served by the admin api, the failure time is in seconds.
+type adminConnFailure struct {
+	IP     string `json:"ip"`
+	Reason string `json:"reason"`
+	Time   int64  `json:"time"`
+}
+
+// adminEndpointChurn represents the accepted connections and connection
+// failures of a miner endpoint served by the admin api.
+type adminEndpointChurn struct {
+	Miner    string              `json:"miner"`
+	Port     uint32              `json:"port"`
+	Accepted uint64              `json:"accepted"`
+	Failures map[string]uint64   `json:"failures"`
+	Recent   []*adminConnFailure `json:"recent"`
+}
+
+// GetAdminChurn serves the accepted connections, connection failures and
+// recent connection failures of all miner endpoints. Only admin sessions
+// are served.
+func (ui *GUI) GetAdminChurn(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		writeAdminResponse(w, http.StatusUnauthorized,
+			map[string]string{"error": "admin session required"})
+		return
+	}
+
+	churn := ui.cfg.FetchEndpointChurn()
+	resp := make([]*adminEndpointChurn, 0, len(churn))
+	for _, endpoint := range churn {
+		recent := make([]*adminConnFailure, 0, len(endpoint.Recent))
+		for _, sample := range endpoint.Recent {
+			recent = append(recent, &adminConnFailure{
+				IP:     sample.IP,
+				Reason: sample.Reason,
+				Time:   sample.Time,
+			})
+		}
+		resp = append(resp, &adminEndpointChurn{
+			Miner:    endpoint.Miner,
+			Port:     endpoint.Port,
+			Accepted: endpoint.Accepted,
+			Failures: endpoint.Failures,
+			Recent:   recent,
+		})
+	}
+	writeAdminResponse(w, http.StatusOK, resp)
+}
+
+// adminLostBlock represents a block candidate which failed submission to
+// the consensus daemon served by the admin api, the time it was lost is in
+// seconds.
+type adminLostBlock struct {
+	Height    uint32 `json:"height"`
+	BlockHash string `json:"blockhash"`
+	Header    string `json:"header"`
+	Account   string `json:"account"`
+	Worker    string `json:"worker"`
+	Miner     string `json:"miner"`
+	Reason    string `json:"reason"`
+	CreatedOn int64  `json:"createdon"`
+}
+
+// GetAdminLostBlocks serves the block candidates which failed submission to
+// the consensus daemon, most recently lost candidate first.
+func (ui *GUI) GetAdminLostBlocks(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		writeAdminResponse(w, http.StatusUnauthorized,
+			map[string]string{"error": "admin session required"})
+		return
+	}
+
+	lost, err := ui.cfg.FetchLostBlocks()
+	if err != nil {
+		log.Errorf("unable to fetch lost block candidates: %v", err)
+		writeAdminResponse(w, http.StatusInternalServerError,
+			map[string]string{"error": "unable to fetch lost block candidates"})
+		return
+	}
+	resp := make([]*adminLostBlock, 0, len(lost))
+	for _, candidate := range lost {
+		resp = append(resp, &adminLostBlock{
+			Height:    candidate.Height,
+			BlockHash: candidate.BlockHash,
+			Header:    candidate.Header,
+			Account:   candidate.Account,
+			Worker:    candidate.Worker,
+			Miner:     candidate.Miner,
+			Reason:    candidate.Reason,
+			CreatedOn: nanoToSeconds(candidate.CreatedOn),
+		})
+	}
+	writeAdminResponse(w, http.StatusOK, resp)
+}
+
+// adminBan represents a ban in effect served by the admin api, times are
+// in seconds and bans without an expiry are permanent.
+type adminBan struct {
+	Target    string `json:"target"`
+	Reason    string `json:"reason"`
+	CreatedOn int64  `json:"createdon"`
+	ExpiresOn int64  `json:"expireson,omitempty"`
+	CreatedBy string `json:"createdby"`
+}
+
+// adminBanAuditEntry represents the audit record of a ban list change
+// served by the admin api, the change time is in seconds.
+type adminBanAuditEntry struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Reason string `json:"reason,omitempty"`
+	By     string `json:"by"`
+	On     int64  `json:"on"`
+}
+
+// GetAdminBans serves the bans in effect and the most recent ban list
+// audit entries, most recent entry first.
+func (ui *GUI) GetAdminBans(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		writeAdminResponse(w, http.StatusUnauthorized,
+			map[string]string{"error": "admin session required"})
+		return
+	}
+
+	entries, err := ui.cfg.FetchBanAuditLog()
+	if err != nil {
+		log.Errorf("unable to fetch ban audit log: %v", err)
+		writeAdminResponse(w, http.StatusInternalServerError,
+			map[string]string{"error": "unable to fetch ban audit log"})
+		return
+	}
+	bans := ui.cfg.FetchBans()
+	resp := struct {
+		Bans  []*adminBan           `json:"bans"`
+		Audit []*adminBanAuditEntry `json:"audit"`
+	}{
+		Bans:  make([]*adminBan, 0, len(bans)),
+		Audit: make([]*adminBanAuditEntry, 0, len(entries)),
+	}
+	for _, ban := range bans {
+		resp.Bans = append(resp.Bans, &adminBan{
+			Target:    ban.Target,
+			Reason:    ban.Reason,
+			CreatedOn: nanoToSeconds(ban.CreatedOn),
+			ExpiresOn: nanoToSeconds(ban.ExpiresOn),
+			CreatedBy: ban.CreatedBy,
+		})
+	}
+	for _, entry := range entries {
+		resp.Audit = append(resp.Audit, &adminBanAuditEntry{
+			Action: entry.Action,
+			Target: entry.Target,
+			Reason: entry.Reason,
+			By:     entry.By,
+			On:     nanoToSeconds(entry.On),
+		})
+	}
+	writeAdminResponse(w, http.StatusOK, resp)
+}
+
+// adminCaptureStatus represents the state of a client trace capture served
+// by the admin api, times are in seconds and the stop time and reason are
+// omitted while the capture runs.
+type adminCaptureStatus struct {
+	ClientID string `json:"clientid"`
+	File     string `json:"file,omitempty"`
+	Started  int64  `json:"started"`
+	Stopped  int64  `json:"stopped,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Frames   uint64 `json:"frames"`
+	Bytes    int64  `json:"bytes"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// newAdminCaptureStatus returns the admin api representation of the
+// provided capture state.
+func newAdminCaptureStatus(status *pool.CaptureStatus) *adminCaptureStatus {
+	return &adminCaptureStatus{
+		ClientID: status.ClientID,
+		File:     status.File,
+		Started:  nanoToSeconds(status.Started),
+		Stopped:  nanoToSeconds(status.Stopped),
+		Reason:   status.Reason,
+		Frames:   status.Frames,
+		Bytes:    status.Bytes,
+		Dropped:  status.Dropped,
+	}
+}
+
+// adminCapturedFrame represents a captured frame served by the admin api,
+// its time is in nanoseconds to preserve the spacing of frames.
+type adminCapturedFrame struct {
+	Direction string `json:"direction"`
+	Time      int64  `json:"time"`
+	Data      string `json:"data"`
+}
+
+// GetAdminCapture serves the most recent trace capture of the client of
+// the provided id along with its recent frames, oldest frame first, or the
+// state of all captures if no id is provided.
+func (ui *GUI) GetAdminCapture(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		writeAdminResponse(w, http.StatusUnauthorized,
+			map[string]string{"error": "admin session required"})
+		return
+	}
+
+	id := strings.TrimSpace(r.FormValue("id"))
+	if id == "" {
+		captures := ui.cfg.FetchCaptures()
+		resp := make([]*adminCaptureStatus, 0, len(captures))
+		for _, status := range captures {
+			resp = append(resp, newAdminCaptureStatus(status))
+		}
+		writeAdminResponse(w, http.StatusOK, resp)
+		return
+	}
+	snapshot, err := ui.cfg.FetchCapture(id)
+	if err != nil {
+		if pool.IsError(err, pool.ErrValueNotFound) {
+			writeAdminResponse(w, http.StatusNotFound,
+				map[string]string{"error": "capture not found"})
+			return
+		}
+		log.Errorf("unable to fetch trace capture of %s: %v", id, err)
+		writeAdminResponse(w, http.StatusInternalServerError,
+			map[string]string{"error": "unable to fetch capture"})
+		return
+	}
+	resp := struct {
+		*adminCaptureStatus
+		Recent []*adminCapturedFrame `json:"recent"`
+	}{
+		adminCaptureStatus: newAdminCaptureStatus(&snapshot.CaptureStatus),
+		Recent:             make([]*adminCapturedFrame, 0, len(snapshot.Recent)),
+	}
+	for _, frame := range snapshot.Recent {
+		resp.Recent = append(resp.Recent, &adminCapturedFrame{
+			Direction: frame.Direction,
+			Time:      frame.Time,
+			Data:      frame.Data,
+		})
+	}
+	writeAdminResponse(w, http.StatusOK, resp)
+}
+
+// adminMetadataChange represents the audit record of an account metadata
+// change served by the admin api, the change time is in seconds.
+type adminMetadataChange struct {
+	Field    string `json:"field"`
+	Previous string `json:"previous"`
+	Value    string `json:"value"`
+	By       string `json:"by"`
+	On       int64  `json:"on"`
+}
+
+// adminAccount represents the admin view of an account served by the admin
+// api, the creation time is in seconds.
+type adminAccount struct {
+	AccountID    string                 `json:"accountid"`
+	Address      string                 `json:"address"`
+	CreatedOn    int64                  `json:"createdon"`
+	FeeOverride  *float64               `json:"feeoverride,omitempty"`
+	Donation     float64                `json:"donation"`
+	PaymentsHeld bool                   `json:"paymentsheld"`
+	Locked       bool                   `json:"locked"`
+	APIKey       bool                   `json:"apikey"`
+	DigestHours  int64                  `json:"digesthours"`
+	MinPayout    float64                `json:"minpayout"`
+	Label        string                 `json:"label"`
+	Contact      string                 `json:"contact"`
+	Note         string                 `json:"note"`
+	MetadataLog  []*adminMetadataChange `json:"metadatalog"`
+}
+
+// GetAdminAccount serves the admin view of the requested account, including
+// its support metadata and the audit log of metadata changes. Only admin
+// sessions are served.
+func (ui *GUI) GetAdminAccount(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		writeAdminResponse(w, http.StatusUnauthorized,
+			map[string]string{"error": "admin session required"})
+		return
+	}
+
+	accountID := strings.TrimSpace(r.FormValue("account"))
+	view, err := ui.cfg.FetchAccountAdminView(accountID)
+	if err != nil {
+		if pool.IsError(err, pool.ErrValueNotFound) {
+			writeAdminResponse(w, http.StatusNotFound,
+				map[string]string{"error": "account not found"})
+			return
+		}
+		log.Errorf("unable to fetch account %s: %v", accountID, err)
+		writeAdminResponse(w, http.StatusInternalServerError,
+			map[string]string{"error": "unable to fetch account"})
+		return
+	}
+	resp := &adminAccount{
+		AccountID:    view.AccountID,
+		Address:      view.Address,
+		CreatedOn:    int64(view.CreatedOn),
+		FeeOverride:  view.FeeOverride,
+		Donation:     view.Donation,
+		PaymentsHeld: view.PaymentsHeld,
+		Locked:       view.Locked,
+		APIKey:       view.APIKey,
+		DigestHours:  int64(view.Digest / time.Hour),
+		MinPayout:    view.MinPayout.ToCoin(),
+		Label:        view.Metadata.Label,
+		Contact:      view.Metadata.Contact,
+		Note:         view.Metadata.Note,
+		MetadataLog:  make([]*adminMetadataChange, 0, len(view.MetadataLog)),
+	}
+	for _, change := range view.MetadataLog {
+		resp.MetadataLog = append(resp.MetadataLog, &adminMetadataChange{
+			Field:    change.Field,
+			Previous: change.Previous,
+			Value:    change.Value,
+			By:       change.By,
+			On:       nanoToSeconds(change.On),
+		})
+	}
+	writeAdminResponse(w, http.StatusOK, resp)
+}
+
+// PostAccountMetadata replaces the label, contact and note of the provided
+// account. Changes are attributed to the admin's host.
+func (ui *GUI) PostAccountMetadata(w http.ResponseWriter, r *http.Request) {
+	session, err := ui.cookieStore.Get(r, "session")
+	if err != nil {
+		if !strings.Contains(err.Error(), "value is not valid") {
+			log.Errorf("session error: %v", err)
+			return
+		}
+
+		log.Errorf("session error: %v, new session generated", err)
+	}
+
+	if !ui.cfg.WithinLimit(session.ID, pool.APIClient) {
+		http.Error(w, "Request limit exceeded", http.StatusBadRequest)
+		return
+	}
+
+	if session.Values["IsAdmin"] != true {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	metadata := &pool.AccountMetadata{
+		Label:   strings.TrimSpace(r.FormValue("label")),
+		Contact: strings.TrimSpace(r.FormValue("contact")),
+		Note:    strings.TrimSpace(r.FormValue("note")),
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	accountID := strings.TrimSpace(r.FormValue("account"))
+	err = ui.cfg.SetAccountMetadata(accountID, metadata, "admin@"+host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// parseUnixTime parses the provided unix time in seconds, returning it in
+// nanoseconds. An empty time parses as zero.
+func parseUnixTime(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if secs < 0 {
+		return 0, fmt.Errorf("negative unix time %d", secs)
+	}
+	return time.Unix(secs, 0).UnixNano(), nil
+}
+
+// writeAdminResponse writes the provided data as an uncacheable json
+// response.
+func writeAdminResponse(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Errorf("unable to encode admin response: %v", err)
+	}
+}
@@ -0,0 +1,706 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package gui
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Eacred/eacrpool/pool"
+)
+
+var (
+	// apiSnapshotTTL represents the period api snapshots are served for
+	// before being refreshed.
+	apiSnapshotTTL = time.Second * 15
+
+	// apiBlockLimit represents the maximum number of recent blocks held in
+	// the blocks snapshot.
+	apiBlockLimit = 500
+
+	// apiPaymentLimit represents the maximum number of recent payments
+	// held in an account snapshot.
+	apiPaymentLimit = uint(100)
+
+	// apiAccountLimit represents the maximum number of account snapshots
+	// held.
+	apiAccountLimit = 1000
+
+	// apiDefaultPageSize represents the page size of paginated responses
+	// when none is requested.
+	apiDefaultPageSize = 20
+
+	// apiMaxPageSize represents the maximum page size of paginated
+	// responses.
+	apiMaxPageSize = 100
+
+	// apiStatusHashRateDigits represents the significant figures the hash
+	// rate of account statuses served without an api key is rounded to.
+	apiStatusHashRateDigits = 2
+)
+
+// apiPoolSummary represents the pool summary served by the api.
+type apiPoolSummary struct {
+	HashRate        float64            `json:"hashrate"`
+	Workers         uint32             `json:"workers"`
+	LastBlockHeight uint32             `json:"lastblockheight"`
+	LastBlockHash   string             `json:"lastblockhash"`
+	LastBlockTime   int64              `json:"lastblocktime"`
+	PoolFee         float64            `json:"poolfee"`
+	PaymentMethod   string             `json:"paymentmethod"`
+	SoloPool        bool               `json:"solopool"`
+	Network         string             `json:"network"`
+	MetadataHash    string             `json:"metadatahash"`
+	SubmitLatencies []*apiStageLatency `json:"submitlatencies,omitempty"`
+	Solo            *apiSoloSummary    `json:"solo,omitempty"`
+	Miners          []*apiMinerStats   `json:"miners"`
+	Targets         *apiMinerTargets   `json:"targets,omitempty"`
+	Disconnects     map[string]uint64  `json:"disconnects"`
+	AuthRejects     *apiAuthRejects    `json:"authrejects"`
+}
+
+// apiAuthRejects represents the authorization rejection counts of the pool
+// served by the api. Early rejections are refused before any database
+// access, cached rejections are the early rejections of recently refused
+// usernames.
+type apiAuthRejects struct {
+	Early   uint64 `json:"early"`
+	Cached  uint64 `json:"cached"`
+	Backend uint64 `json:"backend"`
+}
+
+// apiMinerTarget represents the pool target and share difficulty assigned
+// to the clients of a miner endpoint served by the api, the target is hex
+// encoded.
+type apiMinerTarget struct {
+	Miner           string  `json:"miner"`
+	Port            uint32  `json:"port"`
+	DiffMultiplier  float64 `json:"diffmultiplier"`
+	Target          string  `json:"target"`
+	Difficulty      float64 `json:"difficulty"`
+	DifficultyRatio float64 `json:"difficultyratio"`
+	NonceIterations float64 `json:"nonceiterations"`
+	ShareWeight     float64 `json:"shareweight"`
+}
+
+// apiMinerTargets represents the pool targets of all miner endpoints served
+// by the api along with the network difficulty they were generated at.
+type apiMinerTargets struct {
+	NetworkDifficulty float64           `json:"networkdifficulty"`
+	GeneratedOn       int64             `json:"generatedon"`
+	Endpoints         []*apiMinerTarget `json:"endpoints"`
+}
+
+// apiMinerStats represents the composition and share acceptance of the
+// pool by miner type served by the api, the hash rate is the average of the
+// type's connected clients. Skewed counts the connected clients with clocks
+// skewed beyond the maximum allowed, Late the accepted shares credited under
+// the stale grace period.
+type apiMinerStats struct {
+	Miner       string  `json:"miner"`
+	Connected   uint32  `json:"connected"`
+	Skewed      uint32  `json:"skewed"`
+	Accepted    uint64  `json:"accepted"`
+	Rejected    uint64  `json:"rejected"`
+	Stale       uint64  `json:"stale"`
+	Late        uint64  `json:"late"`
+	BlocksFound uint64  `json:"blocksfound"`
+	HashRate    float64 `json:"hashrate"`
+}
+
+// apiSoloSummary represents the solo mining summary served by the api,
+// blocks found and connected workers are keyed by solo miner address.
+type apiSoloSummary struct {
+	BlocksFound    map[string]uint32 `json:"blocksfound"`
+	SinceLastBlock int64             `json:"sincelastblock"`
+	Workers        map[string]uint32 `json:"workers"`
+}
+
+// apiStageLatency represents the latency histogram of a work submission
+// stage served by the api, durations are in milliseconds.
+type apiStageLatency struct {
+	Stage   string   `json:"stage"`
+	Count   uint64   `json:"count"`
+	Mean    float64  `json:"mean"`
+	Max     float64  `json:"max"`
+	Buckets []uint64 `json:"buckets"`
+}
+
+// apiBlock represents a block mined by the pool served by the api.
+type apiBlock struct {
+	Height  uint32  `json:"height"`
+	Hash    string  `json:"hash"`
+	MinedBy string  `json:"minedby"`
+	FoundBy string  `json:"foundby"`
+	Miner   string  `json:"miner"`
+	Time    int64   `json:"time"`
+	Reward  float64 `json:"reward"`
+}
+
+// apiBlocksPage represents a page of blocks mined by the pool.
+type apiBlocksPage struct {
+	Page   int         `json:"page"`
+	Limit  int         `json:"limit"`
+	Total  int         `json:"total"`
+	Blocks []*apiBlock `json:"blocks"`
+}
+
+// apiWorker represents a worker of an account served by the api.
+type apiWorker struct {
+	Name            string  `json:"name"`
+	HashRate        float64 `json:"hashrate"`
+	AverageHashRate float64 `json:"averagehashrate"`
+	Uptime          int64   `json:"uptime"`
+	Accepted        uint64  `json:"accepted"`
+	Rejected        uint64  `json:"rejected"`
+	LastShare       int64   `json:"lastshare"`
+	Offline         bool    `json:"offline"`
+}
+
+// apiPayment represents a payment of an account served by the api.
+type apiPayment struct {
+	Height        uint32  `json:"height"`
+	BlockHash     string  `json:"blockhash,omitempty"`
+	Percentage    float64 `json:"percentage,omitempty"`
+	Amount        float64 `json:"amount"`
+	CreatedOn     int64   `json:"createdon"`
+	PaidOnHeight  uint32  `json:"paidonheight"`
+	TransactionID string  `json:"transactionid"`
+}
+
+// apiPaymentSources represents the payments of an account paid out by a
+// transaction served by the api, each recording the block it derives from.
+type apiPaymentSources struct {
+	TransactionID string        `json:"transactionid"`
+	Payments      []*apiPayment `json:"payments"`
+}
+
+// apiBlockPayments represents the payments of an account funded by a block
+// mined by the pool served by the api.
+type apiBlockPayments struct {
+	Height   uint32        `json:"height"`
+	Payments []*apiPayment `json:"payments"`
+}
+
+// apiAccount represents the account details served by the api.
+type apiAccount struct {
+	AccountID          string        `json:"accountid"`
+	HashRate           float64       `json:"hashrate"`
+	Workers            []*apiWorker  `json:"workers"`
+	UnpaidBalance      float64       `json:"unpaidbalance"`
+	PendingBalance     float64       `json:"pendingbalance"`
+	ImmatureBalance    float64       `json:"immaturebalance"`
+	CarriedOverBalance float64       `json:"carriedoverbalance"`
+	HeldBalance        float64       `json:"heldbalance"`
+	PaymentsHeld       bool          `json:"paymentsheld"`
+	Locked             bool          `json:"locked"`
+	TotalPaid          float64       `json:"totalpaid"`
+	Page               int           `json:"page"`
+	Limit              int           `json:"limit"`
+	TotalPayments      int           `json:"totalpayments"`
+	Payments           []*apiPayment `json:"payments"`
+}
+
+// accountSnapshot represents a cached account lookup.
+type accountSnapshot struct {
+	account  *apiAccount
+	payments []*apiPayment
+	taken    time.Time
+}
+
+// apiSnapshots caches the data served by the api.
+type apiSnapshots struct {
+	summary  *apiPoolSummary
+	metadata *pool.PoolMetadata
+	blocks   []*apiBlock
+	accounts map[string]*accountSnapshot
+	mtx      sync.RWMutex
+}
+
+// ratToFloat returns the float64 representation of the provided rational.
+func ratToFloat(r *big.Rat) float64 {
+	f, _ := r.Float64()
+	return f
+}
+
+// newAPIPayment returns the api representation of the provided payment.
+func newAPIPayment(pmt *pool.Payment) *apiPayment {
+	payment := &apiPayment{
+		Height:        pmt.Height,
+		BlockHash:     pmt.BlockHash,
+		Amount:        pmt.Amount.ToCoin(),
+		CreatedOn:     pmt.CreatedOn,
+		PaidOnHeight:  pmt.PaidOnHeight,
+		TransactionID: pmt.TransactionID,
+	}
+	if pmt.Percentage != nil {
+		payment.Percentage = ratToFloat(pmt.Percentage)
+	}
+	return payment
+}
+
+// refreshAPISnapshots updates the pool summary and blocks snapshots and
+// prunes expired account snapshots.
+func (ui *GUI) refreshAPISnapshots() error {
+	stats, err := ui.cfg.FetchPoolStats()
+	if err != nil {
+		return err
+	}
+	work, err := ui.cfg.FetchRecentMinedWork(apiBlockLimit)
+	if err != nil {
+		return err
+	}
+
+	summary := &apiPoolSummary{
+		HashRate:        ratToFloat(stats.HashRate),
+		Workers:         stats.Workers,
+		LastBlockHeight: stats.LastBlockHeight,
+		LastBlockHash:   stats.LastBlockHash,
+		LastBlockTime:   stats.LastBlockTime,
+		PoolFee:         stats.Metadata.PoolFee,
+		PaymentMethod:   stats.Metadata.PaymentMethod,
+		SoloPool:        stats.Metadata.SoloPool,
+		Network:         stats.Metadata.Network,
+		MetadataHash:    stats.Metadata.Hash,
+		Miners:          make([]*apiMinerStats, 0, len(stats.Miners)),
+		Disconnects:     stats.Disconnects,
+		AuthRejects: &apiAuthRejects{
+			Early:   stats.AuthRejects.Early,
+			Cached:  stats.AuthRejects.Cached,
+			Backend: stats.AuthRejects.Backend,
+		},
+	}
+	for _, miner := range stats.Miners {
+		summary.Miners = append(summary.Miners, &apiMinerStats{
+			Miner:       miner.Miner,
+			Connected:   miner.Connected,
+			Skewed:      miner.Skewed,
+			Accepted:    miner.Accepted,
+			Rejected:    miner.Rejected,
+			Stale:       miner.Stale,
+			Late:        miner.Late,
+			BlocksFound: miner.BlocksFound,
+			HashRate:    ratToFloat(miner.HashRate),
+		})
+	}
+	for _, latency := range stats.SubmitLatencies {
+		summary.SubmitLatencies = append(summary.SubmitLatencies,
+			&apiStageLatency{
+				Stage:   latency.Stage,
+				Count:   latency.Count,
+				Mean:    latency.Mean.Seconds() * 1000,
+				Max:     latency.Max.Seconds() * 1000,
+				Buckets: latency.Buckets,
+			})
+	}
+	if stats.Targets != nil {
+		summary.Targets = &apiMinerTargets{
+			NetworkDifficulty: stats.Targets.NetworkDifficulty,
+			GeneratedOn:       stats.Targets.GeneratedOn,
+			Endpoints: make([]*apiMinerTarget, 0,
+				len(stats.Targets.Targets)),
+		}
+		for _, t := range stats.Targets.Targets {
+			summary.Targets.Endpoints = append(summary.Targets.Endpoints,
+				&apiMinerTarget{
+					Miner:           t.Miner,
+					Port:            t.Port,
+					DiffMultiplier:  t.DiffMultiplier,
+					Target:          fmt.Sprintf("%064x", t.Target),
+					Difficulty:      ratToFloat(t.Difficulty),
+					DifficultyRatio: t.DifficultyRatio,
+					NonceIterations: t.NonceIterations,
+					ShareWeight:     ratToFloat(t.ShareWeight),
+				})
+		}
+	}
+	if stats.Solo != nil {
+		summary.Solo = &apiSoloSummary{
+			BlocksFound:    stats.Solo.BlocksFound,
+			SinceLastBlock: int64(stats.Solo.SinceLastBlock.Seconds()),
+			Workers:        make(map[string]uint32, len(stats.Solo.Workers)),
+		}
+		for address, clients := range stats.Solo.Workers {
+			summary.Solo.Workers[address] = uint32(len(clients))
+		}
+	}
+	blocks := make([]*apiBlock, 0, len(work))
+	for _, w := range work {
+		blocks = append(blocks, &apiBlock{
+			Height:  w.Height,
+			Hash:    w.BlockHash,
+			MinedBy: w.MinedBy,
+			FoundBy: w.Worker,
+			Miner:   w.Miner,
+			Time:    w.CreatedOn,
+			Reward:  w.Reward.ToCoin(),
+		})
+	}
+
+	now := time.Now()
+	ui.api.mtx.Lock()
+	ui.api.summary = summary
+	ui.api.metadata = stats.Metadata
+	ui.api.blocks = blocks
+	for id, snapshot := range ui.api.accounts {
+		if now.Sub(snapshot.taken) > apiSnapshotTTL {
+			delete(ui.api.accounts, id)
+		}
+	}
+	ui.api.mtx.Unlock()
+	return nil
+}
+
+// fetchAccountSnapshot returns the snapshot of the provided account id,
+// taking a new snapshot if there is none or it has expired.
+func (ui *GUI) fetchAccountSnapshot(accountID string) (*accountSnapshot, error) {
+	ui.api.mtx.RLock()
+	snapshot, ok := ui.api.accounts[accountID]
+	ui.api.mtx.RUnlock()
+	if ok && time.Since(snapshot.taken) <= apiSnapshotTTL {
+		return snapshot, nil
+	}
+
+	dash, err := ui.cfg.FetchAccountDashboard(accountID)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := ui.cfg.FetchAccountPayments(accountID, apiPaymentLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &apiAccount{
+		AccountID:          accountID,
+		HashRate:           ratToFloat(dash.HashRate),
+		Workers:            make([]*apiWorker, 0, len(dash.Workers)),
+		UnpaidBalance:      dash.PendingBalance.ToCoin(),
+		PendingBalance:     dash.Balance.Pending.ToCoin(),
+		ImmatureBalance:    dash.Balance.Immature.ToCoin(),
+		CarriedOverBalance: dash.Balance.CarriedOver.ToCoin(),
+		HeldBalance:        dash.Balance.Held.ToCoin(),
+		PaymentsHeld:       dash.PaymentsHeld,
+		Locked:             dash.Locked,
+		TotalPaid:          dash.TotalPaid.ToCoin(),
+	}
+	for _, worker := range dash.Workers {
+		account.Workers = append(account.Workers, &apiWorker{
+			Name:            worker.Name,
+			HashRate:        ratToFloat(worker.HashRate),
+			AverageHashRate: ratToFloat(worker.AverageHashRate),
+			Uptime:          worker.Uptime,
+			Accepted:        worker.Accepted,
+			Rejected:        worker.Rejected,
+			LastShare:       worker.LastShare,
+			Offline:         worker.Offline,
+		})
+	}
+	snapshot = &accountSnapshot{
+		account:  account,
+		payments: make([]*apiPayment, 0, len(payments)),
+		taken:    time.Now(),
+	}
+	for _, pmt := range payments {
+		snapshot.payments = append(snapshot.payments, newAPIPayment(pmt))
+	}
+
+	ui.api.mtx.Lock()
+	if len(ui.api.accounts) < apiAccountLimit {
+		ui.api.accounts[accountID] = snapshot
+	}
+	ui.api.mtx.Unlock()
+	return snapshot, nil
+}
+
+// paginate returns the page and page size requested, defaulting to the
+// first page of the default page size.
+func paginate(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || page < 0 {
+		page = 0
+	}
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil || limit <= 0 {
+		limit = apiDefaultPageSize
+	}
+	if limit > apiMaxPageSize {
+		limit = apiMaxPageSize
+	}
+	return page, limit
+}
+
+// pageBounds returns the bounds of the requested page of a list of the
+// provided size.
+func pageBounds(page int, limit int, size int) (int, int) {
+	start := size
+	if page < size {
+		start = page * limit
+	}
+	if start > size {
+		start = size
+	}
+	end := start + limit
+	if end > size {
+		end = size
+	}
+	return start, end
+}
+
+// encodeAPIResponse writes the provided data as a json response with the
+// provided cache policy.
+func encodeAPIResponse(w http.ResponseWriter, status int, cacheControl string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Errorf("unable to encode api response: %v", err)
+	}
+}
+
+// writeAPIResponse writes the provided data as a cacheable json response.
+func writeAPIResponse(w http.ResponseWriter, status int, data interface{}) {
+	encodeAPIResponse(w, status, fmt.Sprintf("public, max-age=%d",
+		int(apiSnapshotTTL.Seconds())), data)
+}
+
+// writePrivateAPIResponse writes the provided data as a json response which
+// must not be cached, for data only served to authorized requests.
+func writePrivateAPIResponse(w http.ResponseWriter, status int, data interface{}) {
+	encodeAPIResponse(w, status, "private, no-store", data)
+}
+
+// writeAPIError writes the provided error message as a json response.
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeAPIResponse(w, status, map[string]string{"error": msg})
+}
+
+// requestHost returns the host of the remote address of the provided
+// request.
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitAPI rejects requests from hosts exceeding their request limits.
+func (ui *GUI) limitAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := requestHost(r)
+		if !ui.cfg.WithinLimit(host, pool.APIClient) {
+			writeAPIError(w, http.StatusTooManyRequests,
+				"request limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetAPIPool serves the pool summary.
+func (ui *GUI) GetAPIPool(w http.ResponseWriter, r *http.Request) {
+	ui.api.mtx.RLock()
+	summary := ui.api.summary
+	ui.api.mtx.RUnlock()
+	if summary == nil {
+		writeAPIError(w, http.StatusServiceUnavailable,
+			"pool statistics unavailable")
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, summary)
+}
+
+// GetAPIPoolMetadata serves the pool metadata. The metadata hash is its
+// entity tag, requests for the current hash are answered without a body.
+func (ui *GUI) GetAPIPoolMetadata(w http.ResponseWriter, r *http.Request) {
+	ui.api.mtx.RLock()
+	meta := ui.api.metadata
+	ui.api.mtx.RUnlock()
+	if meta == nil {
+		writeAPIError(w, http.StatusServiceUnavailable,
+			"pool metadata unavailable")
+		return
+	}
+	etag := fmt.Sprintf("%q", meta.Hash)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, meta)
+}
+
+// GetAPIBlocks serves a page of the recent blocks mined by the pool.
+func (ui *GUI) GetAPIBlocks(w http.ResponseWriter, r *http.Request) {
+	page, limit := paginate(r)
+	ui.api.mtx.RLock()
+	start, end := pageBounds(page, limit, len(ui.api.blocks))
+	resp := &apiBlocksPage{
+		Page:   page,
+		Limit:  limit,
+		Total:  len(ui.api.blocks),
+		Blocks: append([]*apiBlock{}, ui.api.blocks[start:end]...),
+	}
+	ui.api.mtx.RUnlock()
+	writeAPIResponse(w, http.StatusOK, resp)
+}
+
+// GetAPIAccount serves the account details of the provided address along
+// with a page of its payment history to requests authorized by the api key
+// of the account, other requests are served the coarse status of the
+// account.
+func (ui *GUI) GetAPIAccount(w http.ResponseWriter, r *http.Request) {
+	auth := accountAuthFromRequest(r)
+	accountID := auth.accountID
+	snapshot, err := ui.fetchAccountSnapshot(accountID)
+	if err != nil {
+		switch {
+		case pool.IsError(err, pool.ErrValueNotFound):
+			writeAPIError(w, http.StatusNotFound, "account not found")
+		case pool.IsError(err, pool.ErrNotSupported):
+			writeAPIError(w, http.StatusNotImplemented,
+				"account lookups are not supported in solo pool mode")
+		default:
+			log.Errorf("unable to fetch account %s: %v", accountID, err)
+			writeAPIError(w, http.StatusInternalServerError,
+				"unable to fetch account")
+		}
+		return
+	}
+	if !auth.authorized {
+		writeAPIResponse(w, http.StatusOK, newAPIAccountStatus(snapshot.account))
+		return
+	}
+
+	page, limit := paginate(r)
+	start, end := pageBounds(page, limit, len(snapshot.payments))
+	account := *snapshot.account
+	account.Page = page
+	account.Limit = limit
+	account.TotalPayments = len(snapshot.payments)
+	account.Payments = snapshot.payments[start:end]
+	writePrivateAPIResponse(w, http.StatusOK, &account)
+}
+
+// accountIDFromRequest returns the account id of the address of the
+// provided request, writing an error response if the address is invalid or
+// account lookups are not supported.
+func (ui *GUI) accountIDFromRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if ui.cfg.SoloPool {
+		writeAPIError(w, http.StatusNotImplemented,
+			"account lookups are not supported in solo pool mode")
+		return "", false
+	}
+	accountID, err := pool.AccountID(mux.Vars(r)["address"], ui.cfg.ActiveNet)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid address")
+		return "", false
+	}
+	return accountID, true
+}
+
+// GetAPIPaymentSources serves the payments of the provided address paid
+// out by the provided transaction along with the blocks they derive from
+// and the share percentages used in calculating them.
+func (ui *GUI) GetAPIPaymentSources(w http.ResponseWriter, r *http.Request) {
+	accountID := accountAuthFromRequest(r).accountID
+	txid := mux.Vars(r)["txid"]
+	if b, err := hex.DecodeString(txid); err != nil || len(b) != 32 {
+		writeAPIError(w, http.StatusBadRequest, "invalid transaction id")
+		return
+	}
+	payments, err := ui.cfg.FetchPaymentSources(accountID, txid)
+	if err != nil {
+		log.Errorf("unable to fetch payment sources of %s for %s: %v",
+			txid, accountID, err)
+		writeAPIError(w, http.StatusInternalServerError,
+			"unable to fetch payment sources")
+		return
+	}
+	if len(payments) == 0 {
+		writeAPIError(w, http.StatusNotFound, "payment not found")
+		return
+	}
+	resp := &apiPaymentSources{
+		TransactionID: txid,
+		Payments:      make([]*apiPayment, 0, len(payments)),
+	}
+	for _, pmt := range payments {
+		resp.Payments = append(resp.Payments, newAPIPayment(pmt))
+	}
+	writePrivateAPIResponse(w, http.StatusOK, resp)
+}
+
+// GetAPIBlockPayments serves the payments of the provided address funded
+// by the block mined by the pool at the provided height.
+func (ui *GUI) GetAPIBlockPayments(w http.ResponseWriter, r *http.Request) {
+	accountID := accountAuthFromRequest(r).accountID
+	height, err := strconv.ParseUint(mux.Vars(r)["height"], 10, 32)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid block height")
+		return
+	}
+	payments, err := ui.cfg.FetchBlockPayments(uint32(height))
+	if err != nil {
+		log.Errorf("unable to fetch payments of block #%d: %v", height, err)
+		writeAPIError(w, http.StatusInternalServerError,
+			"unable to fetch block payments")
+		return
+	}
+	resp := &apiBlockPayments{
+		Height:   uint32(height),
+		Payments: make([]*apiPayment, 0),
+	}
+	for _, pmt := range payments {
+		if pmt.Account == accountID {
+			resp.Payments = append(resp.Payments, newAPIPayment(pmt))
+		}
+	}
+	writePrivateAPIResponse(w, http.StatusOK, resp)
+}
+
+// routeAPI configures the http router of the api.
+func (ui *GUI) routeAPI() {
+	ui.apiRouter = mux.NewRouter()
+	ui.apiRouter.Use(ui.limitAPI)
+	ui.apiRouter.HandleFunc("/api/v1/pool", ui.GetAPIPool).Methods("GET")
+	ui.apiRouter.HandleFunc("/api/v1/pool/metadata",
+		ui.GetAPIPoolMetadata).Methods("GET")
+	ui.apiRouter.HandleFunc("/api/v1/blocks", ui.GetAPIBlocks).Methods("GET")
+	ui.apiRouter.HandleFunc("/api/v1/sharewindow",
+		ui.GetAPIShareWindow).Methods("GET")
+	ui.apiRouter.HandleFunc("/health", ui.GetHealth).Methods("GET")
+	ui.apiRouter.HandleFunc("/api/v1/account/{address}",
+		ui.authorizeAccount(false, ui.GetAPIAccount)).Methods("GET")
+	ui.apiRouter.HandleFunc("/api/v1/account/{address}/payments/{txid}",
+		ui.authorizeAccount(true, ui.GetAPIPaymentSources)).Methods("GET")
+	ui.apiRouter.HandleFunc("/api/v1/account/{address}/blocks/{height}",
+		ui.authorizeAccount(true, ui.GetAPIBlockPayments)).Methods("GET")
+	ui.apiRouter.HandleFunc("/api/v1/account/{address}/lock",
+		ui.PostAPIAccountLock).Methods("POST")
+	ui.apiRouter.HandleFunc("/api/v1/account/{address}/token",
+		ui.PostAPIAuthToken).Methods("POST")
+	ui.apiRouter.HandleFunc("/api/v1/account/{address}/apikey",
+		ui.PostAPIKey).Methods("POST")
+}
+
+// runAPI serves the api until its server is shut down.
+func (ui *GUI) runAPI() {
+	log.Tracef("Starting API server on port %d (http)", ui.cfg.APIPort)
+	err := ui.apiServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Error(err)
+	}
+}
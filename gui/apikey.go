@@ -0,0 +1,161 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package gui
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Eacred/eacrpool/pool"
+)
+
+// apiKey represents an account api key served by the api, the key is empty
+// when it was revoked.
+type apiKey struct {
+	Key     string `json:"key,omitempty"`
+	Revoked bool   `json:"revoked"`
+}
+
+// apiAccountStatus represents the coarse status of an account served by the
+// api to requests without an api key of the account.
+type apiAccountStatus struct {
+	Online   bool    `json:"online"`
+	HashRate float64 `json:"hashrate"`
+}
+
+// accountAuthKey is the context key of the account authorization of api
+// requests.
+type accountAuthKey struct{}
+
+// accountAuth represents the account of an api request and whether the
+// request is authorized by the api key of the account.
+type accountAuth struct {
+	accountID  string
+	authorized bool
+}
+
+// accountAuthFromRequest returns the account authorization of the provided
+// request, set by authorizeAccount.
+func accountAuthFromRequest(r *http.Request) *accountAuth {
+	auth, _ := r.Context().Value(accountAuthKey{}).(*accountAuth)
+	if auth == nil {
+		return &accountAuth{}
+	}
+	return auth
+}
+
+// roundSignificant rounds the provided value to the provided number of
+// significant figures.
+func roundSignificant(f float64, digits int) float64 {
+	if f == 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return f
+	}
+	scale := math.Pow(10, float64(digits)-math.Ceil(math.Log10(math.Abs(f))))
+	return math.Round(f*scale) / scale
+}
+
+// newAPIAccountStatus returns the coarse status of the provided account,
+// online if any of its workers is.
+func newAPIAccountStatus(account *apiAccount) *apiAccountStatus {
+	status := &apiAccountStatus{
+		HashRate: roundSignificant(account.HashRate, apiStatusHashRateDigits),
+	}
+	for _, worker := range account.Workers {
+		if !worker.Offline {
+			status.Online = true
+			break
+		}
+	}
+	return status
+}
+
+// bearerToken returns the bearer token of the authorization header of the
+// provided request, if it has one.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false
+	}
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", true
+	}
+	return strings.TrimSpace(parts[1]), true
+}
+
+// writeAPIUnauthorized writes an unauthorized json response challenging the
+// client for an api key.
+func writeAPIUnauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="eacrpool"`)
+	writeAPIError(w, http.StatusUnauthorized, msg)
+}
+
+// authorizeAccount resolves the account of the address of api requests and
+// verifies the api key they carry as a bearer token against it before
+// passing them to the provided handler. Requests carrying an invalid key are
+// refused, requests without a key are refused if a key is required.
+func (ui *GUI) authorizeAccount(required bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+		accountID, ok := ui.accountIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+		auth := &accountAuth{accountID: accountID}
+		key, ok := bearerToken(r)
+		switch {
+		case !ok && required:
+			writeAPIUnauthorized(w, "api key required")
+			return
+		case ok:
+			err := ui.cfg.VerifyAPIKey(accountID, key, requestHost(r))
+			if err != nil {
+				if pool.IsError(err, pool.ErrUnauthorized) {
+					writeAPIUnauthorized(w, "invalid api key")
+					return
+				}
+				log.Errorf("unable to verify api key of %s: %v", accountID,
+					err)
+				writeAPIError(w, http.StatusInternalServerError,
+					"unable to verify api key")
+				return
+			}
+			auth.authorized = true
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(),
+			accountAuthKey{}, auth)))
+	}
+}
+
+// PostAPIKey rotates or revokes the api key of the account of the provided
+// address, authenticated by a signed api key challenge. A rotated key is
+// served once, the pool only keeps its hash.
+func (ui *GUI) PostAPIKey(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+	var revoke bool
+	if v := r.FormValue("revoke"); v != "" {
+		var err error
+		revoke, err = strconv.ParseBool(v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid revoke value")
+			return
+		}
+	}
+	key, err := ui.cfg.SetAPIKey(address, r.FormValue("challenge"),
+		r.FormValue("signature"), revoke)
+	if err != nil {
+		writeAPILockError(w, address, err)
+		return
+	}
+	writePrivateAPIResponse(w, http.StatusOK, &apiKey{
+		Key:     key,
+		Revoked: revoke,
+	})
+}
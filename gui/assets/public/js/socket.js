@@ -69,6 +69,7 @@ function updateMinedBlocks(minedBlocks) {
             newRow.insertCell(0).appendChild(a);
             newRow.insertCell(1).innerHTML = minedBlocks[i].miner;
             newRow.insertCell(2).innerHTML = minedBlocks[i].minedby;
+            newRow.insertCell(3).textContent = minedBlocks[i].foundby;
             flashElement(newRow);
             changeMade = true;
         }
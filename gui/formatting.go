@@ -80,6 +80,11 @@ func formatUnixTime(unix int64) string {
 	return time.Unix(0, unix).Format("2-Jan-2006 15:04:05 MST")
 }
 
+// formatUptime formats the provided number of seconds as a duration.
+func formatUptime(seconds int64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
 // floatToPercent formats the provided float64 as a percentage,
 // rounded to the nearest decimal place. eg. "10.5%"
 func floatToPercent(rat float64) string {
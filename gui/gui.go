@@ -26,14 +26,13 @@ import (
 	"github.com/gorilla/sessions"
 
 	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
 	"github.com/Eacred/eacrpool/pool"
 )
 
 type Config struct {
 	// SoloPool represents the solo pool mining mode.
 	SoloPool bool
-	// PaymentMethod represents the pool payment method.
-	PaymentMethod string
 	// GUIDir represents the GUI directory.
 	GUIDir string
 	// CSRFSecret represents the frontend's CSRF secret.
@@ -42,6 +41,9 @@ type Config struct {
 	BackupPass string
 	// GUIPort represents the port the frontend is served on.
 	GUIPort uint32
+	// APIPort represents the port the public api is served on, zero to
+	// disable the api.
+	APIPort uint32
 	// TLSCertFile represents the TLS certificate file path.
 	TLSCertFile string
 	// TLSKeyFile represents the TLS key file path.
@@ -56,10 +58,9 @@ type Config struct {
 	BlockExplorerURL string
 	// Designation represents the codename of the pool.
 	Designation string
-	// PoolFee represents the fee charged to participating accounts of the pool.
-	PoolFee float64
-	// MinerPorts represents the configured ports for supported miners.
-	MinerPorts map[string]uint32
+	// FetchPoolMetadata returns the metadata of the pool, the source of
+	// the pool configuration shown to miners.
+	FetchPoolMetadata func() (*pool.PoolMetadata, error)
 	// WithinLimit returns if a client is within its request limits.
 	WithinLimit func(string, int) bool
 	// FetchLastWorkHeight returns the last work height of the pool.
@@ -80,6 +81,9 @@ type Config struct {
 	BackupDB func(w http.ResponseWriter) error
 	// FetchClientInfo returns connection details about all pool clients.
 	FetchClientInfo func() map[string][]*pool.ClientInfo
+	// FindClients returns connection details about the pool clients
+	// matching the provided id, address or worker name query.
+	FindClients func(query string) map[string][]*pool.ClientInfo
 	// AccountExists checks if the provided account id references a pool account.
 	AccountExists func(accountID string) bool
 	// FetchMinedWorkByAccount returns a list of mined work by the provided address.
@@ -89,6 +93,161 @@ type Config struct {
 	// FetchAccountClientInfo returns all clients belonging to the provided
 	// account id.
 	FetchAccountClientInfo func(accountID string) []*pool.ClientInfo
+	// FetchPaymentFailure returns the failed payment dispatch awaiting a
+	// retry or requiring attention.
+	FetchPaymentFailure func() *pool.DispatchFailure
+	// FetchPaymentDeferral returns the payment cycle deferred for an
+	// insufficient wallet balance.
+	FetchPaymentDeferral func() *pool.PaymentDeferral
+	// ResetPaymentFailure clears the failed payment dispatch and deferred
+	// payment cycle states, it errors if the wallet balance does not cover
+	// the pending payments.
+	ResetPaymentFailure func() error
+	// FetchAccountWorkers returns the activity states of all workers
+	// belonging to the provided account id.
+	FetchAccountWorkers func(accountID string) []*pool.WorkerState
+	// FetchEndpointCapacity returns the connected and maximum clients of
+	// all miner endpoints.
+	FetchEndpointCapacity func() []*pool.EndpointCapacity
+	// FetchEndpointChurn returns the accepted connections, connection
+	// failures and recent connection failures of all miner endpoints.
+	FetchEndpointChurn func() []*pool.EndpointChurn
+	// PauseEndpoints stops notifying miners of work while keeping them
+	// connected, miners are sent the provided message if it is not empty.
+	PauseEndpoints func(message string)
+	// ResumeEndpoints resumes paused miner endpoints.
+	ResumeEndpoints func()
+	// EndpointsPaused returns if the miner endpoints are paused.
+	EndpointsPaused func() bool
+	// FetchMaintenance returns the state of the maintenance schedule.
+	FetchMaintenance func() *pool.MaintenanceStatus
+	// CancelMaintenance cancels the maintenance window in progress.
+	CancelMaintenance func() error
+	// ScheduleMaintenance adds a one-shot maintenance window of the
+	// provided duration starting at the provided time.
+	ScheduleMaintenance func(start time.Time, duration time.Duration) error
+	// FetchRejectCounts returns the number of block submissions rejected
+	// by the consensus daemon, keyed by reject category.
+	FetchRejectCounts func() map[string]uint32
+	// FetchPoolStats returns a summary of the pool's mining activity.
+	FetchPoolStats func() (*pool.PoolStats, error)
+	// FetchRecentMinedWork returns the n most recent blocks mined by the
+	// pool.
+	FetchRecentMinedWork func(n int) ([]*pool.AcceptedWork, error)
+	// FetchAccountDashboard returns the mining activity and payment
+	// details of the provided account id.
+	FetchAccountDashboard func(accountID string) (*pool.AccountDashboard, error)
+	// FetchAccountPayments returns the n most recent payments of the
+	// provided account id.
+	FetchAccountPayments func(accountID string, n uint) ([]*pool.Payment, error)
+	// FetchPaymentSources returns the payments of the provided account id
+	// paid out by the provided transaction.
+	FetchPaymentSources func(accountID string, txid string) ([]*pool.Payment, error)
+	// FetchBlockPayments returns the payments funded by the block mined by
+	// the pool at the provided height.
+	FetchBlockPayments func(height uint32) ([]*pool.Payment, error)
+	// DisconnectClient disconnects the client with the provided id.
+	DisconnectClient func(id string, reason string) int
+	// DisconnectAccount disconnects all clients of the provided account id.
+	DisconnectAccount func(accountID string, reason string) int
+	// BanIP bans the provided ip or ip range from connecting to the pool
+	// for the provided duration and disconnects its clients, attributing
+	// the ban to the provided banner.
+	BanIP func(target string, duration time.Duration, reason string, by string) (int, error)
+	// UnbanIP lifts the ban of the provided ip or ip range, attributing it
+	// to the provided remover.
+	UnbanIP func(target string, by string) error
+	// FetchBans returns the bans in effect.
+	FetchBans func() []*pool.Ban
+	// FetchBanAuditLog returns the most recent ban list audit entries.
+	FetchBanAuditLog func() ([]*pool.BanAuditEntry, error)
+	// SetTrace elevates logging of the provided client id or account id
+	// to trace level when enabled.
+	SetTrace func(id string, enabled bool)
+	// FetchTraced returns the client and account ids with logging
+	// elevated to trace level.
+	FetchTraced func() []string
+	// StartCapture starts capturing the frames exchanged with the client
+	// of the provided id, to a capture file as well if requested.
+	StartCapture func(id string, toFile bool) (*pool.CaptureStatus, error)
+	// StopCapture stops the running trace capture of the provided client
+	// id.
+	StopCapture func(id string) error
+	// FetchCapture returns the most recent trace capture of the provided
+	// client id along with its recent frames.
+	FetchCapture func(id string) (*pool.CaptureSnapshot, error)
+	// FetchCaptures returns the state of the trace captures of clients.
+	FetchCaptures func() []*pool.CaptureStatus
+	// SetAccountFee sets the fee charged to the provided account id in
+	// place of the pool fee, a nil fee restores the pool fee.
+	SetAccountFee func(accountID string, fee *float64) error
+	// FetchAccountFees returns the fee overrides of all accounts that have
+	// one, keyed by account id.
+	FetchAccountFees func() (map[string]float64, error)
+	// SetAccountDonation sets the fraction of the provided account id's
+	// payouts donated to the pool.
+	SetAccountDonation func(accountID string, donation float64) error
+	// FetchAccountDonations returns the donation fractions of all
+	// donating accounts, keyed by account id.
+	FetchAccountDonations func() (map[string]float64, error)
+	// SetAccountPaymentsHeld holds or releases payouts to the provided
+	// account id.
+	SetAccountPaymentsHeld func(accountID string, held bool) error
+	// SetAccountDigest opts the provided account id into activity
+	// digests of the provided interval, zero opts the account out.
+	SetAccountDigest func(accountID string, interval time.Duration) error
+	// FetchHeldAccounts returns the unpaid balances of all accounts with
+	// held payments, keyed by account id.
+	FetchHeldAccounts func() (map[string]dcrutil.Amount, error)
+	// FetchQuarantinedPayments returns the pending payments requiring
+	// attention before they can be paid out.
+	FetchQuarantinedPayments func() ([]*pool.Payment, error)
+	// CorrectAccountAddress corrects the payout address of the provided
+	// account id and requeues its quarantined payments.
+	CorrectAccountAddress func(accountID string, address string, challenge string, signature string) (int, error)
+	// MergeAccounts merges the history of the account referenced by the
+	// first id into the account referenced by the second id.
+	MergeAccounts func(fromID string, toID string) (*pool.AccountMerge, error)
+	// FetchAccountMerges returns the audit records of merged accounts.
+	FetchAccountMerges func() ([]*pool.AccountMerge, error)
+	// SetAccountLock locks or unlocks the account of the provided address,
+	// authenticated by the provided signed challenge.
+	SetAccountLock func(address string, challenge string, signature string, locked bool) error
+	// GenerateAuthToken returns an authorization token for the locked
+	// account of the provided address along with its expiry,
+	// authenticated by the provided signed challenge.
+	GenerateAuthToken func(address string, challenge string, signature string) (string, time.Time, error)
+	// SetAPIKey rotates the api key of the account of the provided
+	// address, returning the new key, or revokes it, authenticated by the
+	// provided signed challenge.
+	SetAPIKey func(address string, challenge string, signature string, revoke bool) (string, error)
+	// ResetAPIKey rotates the api key of the provided account id,
+	// returning the new key, or revokes it.
+	ResetAPIKey func(accountID string, revoke bool) (string, error)
+	// VerifyAPIKey asserts the provided key is the api key of the
+	// provided account id, recording failures against the provided host.
+	VerifyAPIKey func(accountID string, key string, host string) error
+	// HealthStatus returns the readiness of the pool and the state of its
+	// components.
+	HealthStatus func() *pool.HealthStatus
+	// FetchShareWindow returns the unpaid shares the next payout is
+	// calculated from, grouped by account.
+	FetchShareWindow func() (*pool.ShareWindow, error)
+	// VerifyShareWindowOwner returns the account id of the provided
+	// address, authenticated by the provided signed challenge.
+	VerifyShareWindowOwner func(address string, challenge string, signature string) (string, error)
+	// FetchConnectionRecords returns the audit records of client
+	// connections matching the provided query.
+	FetchConnectionRecords func(q *pool.ConnectionQuery) ([]*pool.ConnectionRecord, error)
+	// SetAccountMetadata replaces the label, contact and note of the
+	// provided account id, attributing the change to the provided editor.
+	SetAccountMetadata func(accountID string, metadata *pool.AccountMetadata, by string) error
+	// FetchAccountAdminView returns the settings, metadata and metadata
+	// audit log of the provided account id.
+	FetchAccountAdminView func(accountID string) (*pool.AccountAdminView, error)
+	// FetchLostBlocks returns the block candidates which failed submission
+	// to the consensus daemon.
+	FetchLostBlocks func() ([]*pool.LostBlock, error)
 }
 
 // GUI represents the the mining pool user interface.
@@ -100,6 +259,9 @@ type GUI struct {
 	cookieStore *sessions.CookieStore
 	router      *mux.Router
 	server      *http.Server
+	apiRouter   *mux.Router
+	apiServer   *http.Server
+	api         apiSnapshots
 
 	// The following fields cache pool data.
 	minedWork     []minedWork
@@ -131,7 +293,30 @@ func (ui *GUI) route() {
 	ui.router.HandleFunc("/admin", ui.GetAdmin).Methods("GET")
 	ui.router.HandleFunc("/admin", ui.PostAdmin).Methods("POST")
 	ui.router.HandleFunc("/backup", ui.PostBackup).Methods("POST")
+	ui.router.HandleFunc("/retrypayments", ui.PostRetryPayments).Methods("POST")
+	ui.router.HandleFunc("/disconnect", ui.PostDisconnect).Methods("POST")
+	ui.router.HandleFunc("/ban", ui.PostBan).Methods("POST")
+	ui.router.HandleFunc("/unban", ui.PostUnban).Methods("POST")
+	ui.router.HandleFunc("/trace", ui.PostTrace).Methods("POST")
+	ui.router.HandleFunc("/capture", ui.PostCapture).Methods("POST")
+	ui.router.HandleFunc("/accountfee", ui.PostAccountFee).Methods("POST")
+	ui.router.HandleFunc("/accountdonation", ui.PostAccountDonation).Methods("POST")
+	ui.router.HandleFunc("/accountpaymenthold", ui.PostAccountPaymentHold).Methods("POST")
+	ui.router.HandleFunc("/accountdigest", ui.PostAccountDigest).Methods("POST")
+	ui.router.HandleFunc("/accountapikey", ui.PostAccountAPIKey).Methods("POST")
+	ui.router.HandleFunc("/accountaddress", ui.PostAccountAddress).Methods("POST")
+	ui.router.HandleFunc("/mergeaccounts", ui.PostMergeAccounts).Methods("POST")
+	ui.router.HandleFunc("/pauseendpoints", ui.PostPauseEndpoints).Methods("POST")
+	ui.router.HandleFunc("/maintenance", ui.PostMaintenance).Methods("POST")
+	ui.router.HandleFunc("/admin/connections", ui.GetAdminConnections).Methods("GET")
+	ui.router.HandleFunc("/admin/account", ui.GetAdminAccount).Methods("GET")
+	ui.router.HandleFunc("/admin/churn", ui.GetAdminChurn).Methods("GET")
+	ui.router.HandleFunc("/admin/lostblocks", ui.GetAdminLostBlocks).Methods("GET")
+	ui.router.HandleFunc("/admin/bans", ui.GetAdminBans).Methods("GET")
+	ui.router.HandleFunc("/admin/capture", ui.GetAdminCapture).Methods("GET")
+	ui.router.HandleFunc("/accountmetadata", ui.PostAccountMetadata).Methods("POST")
 	ui.router.HandleFunc("/logout", ui.PostLogout).Methods("POST")
+	ui.router.HandleFunc("/health", ui.GetHealth).Methods("GET")
 
 	// Websocket endpoint allows the GUI to receive updated values
 	ui.router.HandleFunc("/ws", ui.registerWebSocket).Methods("GET")
@@ -157,9 +342,12 @@ func (ui *GUI) renderTemplate(w http.ResponseWriter, _ *http.Request, name strin
 func NewGUI(cfg *Config) (*GUI, error) {
 	ui := &GUI{
 		cfg:        cfg,
-		limiter:    pool.NewRateLimiter(),
+		limiter:    pool.NewRateLimiter(nil),
 		minedWork:  make([]minedWork, 0),
 		workQuotas: make([]workQuota, 0),
+		api: apiSnapshots{
+			accounts: make(map[string]*accountSnapshot),
+		},
 	}
 
 	switch cfg.ActiveNet.Name {
@@ -179,6 +367,7 @@ func NewGUI(cfg *Config) (*GUI, error) {
 	}
 
 	ui.route()
+	ui.routeAPI()
 
 	return ui, nil
 }
@@ -209,6 +398,7 @@ func (ui *GUI) loadTemplates() error {
 		"ratToPercent":      ratToPercent,
 		"floatToPercent":    floatToPercent,
 		"time":              formatUnixTime,
+		"uptime":            formatUptime,
 		"truncateAccountID": truncateAccountID,
 		"blockURL":          blockURL,
 		"txURL":             txURL,
@@ -228,6 +418,21 @@ func (ui *GUI) loadTemplates() error {
 
 // Run starts the user interface.
 func (ui *GUI) Run(ctx context.Context) {
+	if ui.cfg.APIPort != 0 {
+		err := ui.refreshAPISnapshots()
+		if err != nil {
+			log.Errorf("unable to refresh api snapshots: %v", err)
+		}
+		ui.apiServer = &http.Server{
+			WriteTimeout: time.Second * 30,
+			ReadTimeout:  time.Second * 30,
+			IdleTimeout:  time.Second * 30,
+			Addr:         fmt.Sprintf("0.0.0.0:%v", ui.cfg.APIPort),
+			Handler:      ui.apiRouter,
+		}
+		go ui.runAPI()
+	}
+
 	go func() {
 		if !ui.cfg.UseLEHTTPS {
 			log.Tracef("Starting GUI server on port %d (https)", ui.cfg.GUIPort)
@@ -314,6 +519,14 @@ func (ui *GUI) Run(ctx context.Context) {
 
 				// After three ticks (15 seconds) update cached pool data.
 				if ticks == 3 {
+					if ui.apiServer != nil {
+						err := ui.refreshAPISnapshots()
+						if err != nil {
+							log.Errorf("unable to refresh api "+
+								"snapshots: %v", err)
+						}
+					}
+
 					var err error
 					work, err := ui.cfg.FetchMinedWork()
 					if err != nil {
@@ -328,6 +541,7 @@ func (ui *GUI) Run(ctx context.Context) {
 							BlockHeight: work.Height,
 							BlockURL:    blockURL(ui.cfg.BlockExplorerURL, work.Height),
 							MinedBy:     truncateAccountID(work.MinedBy),
+							FoundBy:     work.Worker,
 							Miner:       work.Miner,
 						})
 					}
@@ -370,6 +584,12 @@ func (ui *GUI) Run(ctx context.Context) {
 				ui.updateWS()
 
 			case <-ctx.Done():
+				if ui.apiServer != nil {
+					err := ui.apiServer.Close()
+					if err != nil {
+						log.Errorf("unable to close api server: %v", err)
+					}
+				}
 				return
 			}
 		}
@@ -0,0 +1,196 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package gui
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Eacred/eacrpool/pool"
+)
+
+// apiComponentStatus represents the last success and last error of a pool
+// component, timestamps are in seconds.
+type apiComponentStatus struct {
+	LastSuccess int64  `json:"lastsuccess"`
+	LastError   string `json:"lasterror,omitempty"`
+	LastErrorOn int64  `json:"lasterroron"`
+}
+
+// apiDaemonHealth represents the consensus daemon state, the tip age is in
+// seconds.
+type apiDaemonHealth struct {
+	Reachable bool   `json:"reachable"`
+	Synced    bool   `json:"synced"`
+	TipHeight int64  `json:"tipheight"`
+	TipAge    int64  `json:"tipage"`
+	Error     string `json:"error,omitempty"`
+}
+
+// apiWalletHealth represents the wallet state.
+type apiWalletHealth struct {
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// apiListenerHealth represents the state of a listener of a miner endpoint.
+type apiListenerHealth struct {
+	Addr      string `json:"addr"`
+	Listening bool   `json:"listening"`
+}
+
+// apiEndpointHealth represents the state of a miner endpoint.
+type apiEndpointHealth struct {
+	Miner     string               `json:"miner"`
+	Port      uint32               `json:"port"`
+	Listening bool                 `json:"listening"`
+	Paused    bool                 `json:"paused"`
+	Clients   uint32               `json:"clients"`
+	Listeners []*apiListenerHealth `json:"listeners"`
+	Accepted  uint64               `json:"accepted"`
+	Failures  map[string]uint64    `json:"failures"`
+}
+
+// apiHealth represents the readiness of the pool served by the health
+// endpoint.
+type apiHealth struct {
+	Healthy             bool                 `json:"healthy"`
+	Failing             []string             `json:"failing"`
+	Daemon              *apiDaemonHealth     `json:"daemon"`
+	Wallet              *apiWalletHealth     `json:"wallet,omitempty"`
+	DBWritable          bool                 `json:"dbwritable"`
+	DBError             string               `json:"dberror,omitempty"`
+	Endpoints           []*apiEndpointHealth `json:"endpoints"`
+	EndpointsPaused     bool                 `json:"endpointspaused"`
+	LastWorkUpdate      int64                `json:"lastworkupdate"`
+	ChainState          *apiComponentStatus  `json:"chainstate"`
+	Payments            *apiComponentStatus  `json:"payments,omitempty"`
+	WorkIntegrity       *apiComponentStatus  `json:"workintegrity"`
+	PoolTargets         *apiComponentStatus  `json:"pooltargets"`
+	PaymentsDeferral    *apiPaymentDeferral  `json:"paymentsdeferral,omitempty"`
+	QuarantinedPayments uint32               `json:"quarantinedpayments,omitempty"`
+	Shutdown            *apiShutdownStatus   `json:"shutdown"`
+}
+
+// apiShutdownStatus represents the shutdown phase of the pool, the time it
+// was entered is in seconds.
+type apiShutdownStatus struct {
+	Phase    string `json:"phase"`
+	Since    int64  `json:"since"`
+	KillSafe bool   `json:"killsafe"`
+}
+
+// apiPaymentDeferral represents a payment cycle deferred for an
+// insufficient wallet balance, amounts are in atoms and timestamps are in
+// seconds.
+type apiPaymentDeferral struct {
+	Height    uint32 `json:"height"`
+	Required  int64  `json:"required"`
+	Spendable int64  `json:"spendable"`
+	Since     int64  `json:"since"`
+	NextCheck int64  `json:"nextcheck"`
+}
+
+// nanoToSeconds converts the provided nanosecond timestamp to seconds,
+// unset timestamps remain zero.
+func nanoToSeconds(nano int64) int64 {
+	if nano == 0 {
+		return 0
+	}
+	return time.Unix(0, nano).Unix()
+}
+
+// toAPIComponentStatus converts the provided component status for the
+// health endpoint.
+func toAPIComponentStatus(status *pool.ComponentStatus) *apiComponentStatus {
+	if status == nil {
+		return nil
+	}
+	return &apiComponentStatus{
+		LastSuccess: nanoToSeconds(status.LastSuccess),
+		LastError:   status.LastError,
+		LastErrorOn: nanoToSeconds(status.LastErrorOn),
+	}
+}
+
+// GetHealth serves the readiness of the pool, responding with a service
+// unavailable status when a critical component is failing.
+func (ui *GUI) GetHealth(w http.ResponseWriter, r *http.Request) {
+	status := ui.cfg.HealthStatus()
+	resp := &apiHealth{
+		Healthy: status.Healthy,
+		Failing: status.Failing,
+		Daemon: &apiDaemonHealth{
+			Reachable: status.Daemon.Reachable,
+			Synced:    status.Daemon.Synced,
+			TipHeight: status.Daemon.TipHeight,
+			TipAge:    int64(status.Daemon.TipAge.Seconds()),
+			Error:     status.Daemon.Error,
+		},
+		DBWritable:          status.DBWritable,
+		DBError:             status.DBError,
+		Endpoints:           make([]*apiEndpointHealth, 0, len(status.Endpoints)),
+		EndpointsPaused:     status.EndpointsPaused,
+		LastWorkUpdate:      nanoToSeconds(status.LastWorkUpdate),
+		ChainState:          toAPIComponentStatus(status.ChainState),
+		Payments:            toAPIComponentStatus(status.Payments),
+		WorkIntegrity:       toAPIComponentStatus(status.WorkIntegrity),
+		PoolTargets:         toAPIComponentStatus(status.PoolTargets),
+		QuarantinedPayments: status.QuarantinedPayments,
+		Shutdown: &apiShutdownStatus{
+			Phase:    status.Shutdown.Phase,
+			Since:    nanoToSeconds(status.Shutdown.Since),
+			KillSafe: status.Shutdown.KillSafe,
+		},
+	}
+	if status.PaymentDeferral != nil {
+		resp.PaymentsDeferral = &apiPaymentDeferral{
+			Height:    status.PaymentDeferral.Height,
+			Required:  int64(status.PaymentDeferral.Required),
+			Spendable: int64(status.PaymentDeferral.Spendable),
+			Since:     nanoToSeconds(status.PaymentDeferral.Since),
+			NextCheck: nanoToSeconds(status.PaymentDeferral.NextCheck),
+		}
+	}
+	if status.Wallet != nil {
+		resp.Wallet = &apiWalletHealth{
+			Reachable: status.Wallet.Reachable,
+			Error:     status.Wallet.Error,
+		}
+	}
+	for _, endpoint := range status.Endpoints {
+		apiEndpoint := &apiEndpointHealth{
+			Miner:     endpoint.Miner,
+			Port:      endpoint.Port,
+			Listening: endpoint.Listening,
+			Paused:    endpoint.Paused,
+			Clients:   endpoint.Clients,
+			Listeners: make([]*apiListenerHealth, 0, len(endpoint.Listeners)),
+			Accepted:  endpoint.Accepted,
+			Failures:  endpoint.Failures,
+		}
+		for _, l := range endpoint.Listeners {
+			apiEndpoint.Listeners = append(apiEndpoint.Listeners,
+				&apiListenerHealth{
+					Addr:      l.Addr,
+					Listening: l.Listening,
+				})
+		}
+		resp.Endpoints = append(resp.Endpoints, apiEndpoint)
+	}
+
+	code := http.StatusOK
+	if !status.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.Errorf("unable to encode health response: %v", err)
+	}
+}
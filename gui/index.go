@@ -14,6 +14,7 @@ import (
 
 type indexData struct {
 	MinerPorts        map[string]uint32
+	MinerPolicies     map[string]string
 	LastWorkHeight    uint32
 	LastPaymentHeight uint32
 	MinedWork         []minedWork
@@ -38,6 +39,7 @@ type AccountStats struct {
 	MinedWork []*pool.AcceptedWork
 	Payments  []*pool.Payment
 	Clients   []*pool.ClientInfo
+	Workers   []*pool.WorkerState
 	AccountID string
 }
 
@@ -69,21 +71,41 @@ func (ui *GUI) GetIndex(w http.ResponseWriter, r *http.Request) {
 	poolHash := ui.poolHash
 	ui.poolHashMtx.RUnlock()
 
+	meta, err := ui.cfg.FetchPoolMetadata()
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "FetchPoolMetadata error: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	minerPorts := make(map[string]uint32, len(meta.Miners))
+	minerPolicies := make(map[string]string, len(meta.Miners))
+	for _, miner := range meta.Miners {
+		// The base endpoint of each miner type precedes its additional
+		// endpoints.
+		if _, ok := minerPorts[miner.Miner]; ok {
+			continue
+		}
+		minerPorts[miner.Miner] = miner.Port
+		minerPolicies[miner.Miner] = miner.Policy
+	}
+
 	data := indexData{
 		WorkQuotas:        wQuotas,
-		PaymentMethod:     ui.cfg.PaymentMethod,
+		PaymentMethod:     meta.PaymentMethod,
 		LastWorkHeight:    ui.cfg.FetchLastWorkHeight(),
 		LastPaymentHeight: ui.cfg.FetchLastPaymentHeight(),
 		MinedWork:         mWork,
 		PoolHashRate:      poolHash,
 		PoolDomain:        ui.cfg.Domain,
-		SoloPool:          ui.cfg.SoloPool,
+		SoloPool:          meta.SoloPool,
 		Admin:             false,
 		BlockExplorerURL:  ui.cfg.BlockExplorerURL,
 		Designation:       ui.cfg.Designation,
-		PoolFee:           ui.cfg.PoolFee,
-		Network:           ui.cfg.ActiveNet.Name,
-		MinerPorts:        ui.cfg.MinerPorts,
+		PoolFee:           meta.PoolFee,
+		Network:           meta.Network,
+		MinerPorts:        minerPorts,
+		MinerPolicies:     minerPolicies,
 	}
 
 	address := r.FormValue("address")
@@ -136,6 +158,7 @@ func (ui *GUI) GetIndex(w http.ResponseWriter, r *http.Request) {
 		MinedWork: work,
 		Payments:  payments,
 		Clients:   ui.cfg.FetchAccountClientInfo(accountID),
+		Workers:   ui.cfg.FetchAccountWorkers(accountID),
 		AccountID: accountID,
 	}
 
@@ -0,0 +1,117 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package gui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Eacred/eacrpool/pool"
+)
+
+// apiShareWindowAccount represents the shares of an account within the
+// share payout window served by the api. Addresses are truncated unless
+// the caller proved ownership of the account.
+type apiShareWindowAccount struct {
+	Address    string  `json:"address"`
+	Owned      bool    `json:"owned,omitempty"`
+	Shares     uint32  `json:"shares"`
+	Weight     float64 `json:"weight"`
+	Percentage float64 `json:"percentage"`
+}
+
+// apiShareWindow represents the share payout window served by the api,
+// timestamps are in seconds.
+type apiShareWindow struct {
+	PaymentMethod        string                   `json:"paymentmethod"`
+	Start                int64                    `json:"start"`
+	End                  int64                    `json:"end"`
+	LastNPeriod          uint32                   `json:"lastnperiod,omitempty"`
+	LastPaymentHeight    uint32                   `json:"lastpaymentheight"`
+	LastPaymentCreatedOn int64                    `json:"lastpaymentcreatedon"`
+	Shares               uint32                   `json:"shares"`
+	Weight               float64                  `json:"weight"`
+	GeneratedOn          int64                    `json:"generatedon"`
+	Accounts             []*apiShareWindowAccount `json:"accounts"`
+}
+
+// truncateAddress shortens the provided address for display without
+// revealing it.
+func truncateAddress(address string) string {
+	return fmt.Sprintf("%.8s", address) + "..."
+}
+
+// GetAPIShareWindow serves the unpaid shares the next payout is calculated
+// from, grouped by account. The address of an account is only served in
+// full if its ownership is proven by a signed share window challenge.
+func (ui *GUI) GetAPIShareWindow(w http.ResponseWriter, r *http.Request) {
+	var ownerID string
+	address := r.FormValue("address")
+	if address != "" {
+		var err error
+		ownerID, err = ui.cfg.VerifyShareWindowOwner(address,
+			r.FormValue("challenge"), r.FormValue("signature"))
+		if err != nil {
+			writeAPILockError(w, address, err)
+			return
+		}
+	}
+	window, err := ui.cfg.FetchShareWindow()
+	if err != nil {
+		if pool.IsError(err, pool.ErrNotSupported) {
+			writeAPIError(w, http.StatusNotImplemented,
+				"share windows are not supported in solo pool mode")
+			return
+		}
+		log.Errorf("unable to fetch share window: %v", err)
+		writeAPIError(w, http.StatusInternalServerError,
+			"unable to fetch share window")
+		return
+	}
+
+	resp := &apiShareWindow{
+		PaymentMethod:        window.PaymentMethod,
+		Start:                nanoToSeconds(window.Start),
+		End:                  nanoToSeconds(window.End),
+		LastNPeriod:          window.LastNPeriod,
+		LastPaymentHeight:    window.LastPaymentHeight,
+		LastPaymentCreatedOn: nanoToSeconds(window.LastPaymentCreatedOn),
+		Shares:               window.Count,
+		Weight:               ratToFloat(window.Weight),
+		GeneratedOn:          nanoToSeconds(window.GeneratedOn),
+		Accounts: make([]*apiShareWindowAccount, 0,
+			len(window.Accounts)),
+	}
+	for _, account := range window.Accounts {
+		entry := &apiShareWindowAccount{
+			Address: truncateAddress(account.Address),
+			Shares:  account.Count,
+			Weight:  ratToFloat(account.Weight),
+		}
+		if account.Percentage != nil {
+			entry.Percentage = ratToFloat(account.Percentage)
+		}
+		if ownerID != "" && account.AccountID == ownerID {
+			entry.Address = account.Address
+			entry.Owned = true
+		}
+		resp.Accounts = append(resp.Accounts, entry)
+	}
+	if ownerID == "" {
+		writeAPIResponse(w, http.StatusOK, resp)
+		return
+	}
+
+	// Responses revealing an owned address must not be cached by
+	// intermediaries.
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.Errorf("unable to encode api response: %v", err)
+	}
+}
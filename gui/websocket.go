@@ -32,6 +32,7 @@ type minedWork struct {
 	BlockHeight uint32 `json:"blockheight"`
 	BlockURL    string `json:"blockurl"`
 	MinedBy     string `json:"minedby"`
+	FoundBy     string `json:"foundby"`
 	Miner       string `json:"miner"`
 }
 
@@ -47,11 +47,17 @@ var (
 	mpLog   = backendLog.Logger("MP")
 	poolLog = backendLog.Logger("POOL")
 	guiLog  = backendLog.Logger("GUI")
+
+	// poolTraceLog logs the output of traced pool clients and accounts
+	// at trace level regardless of the pool's log level.
+	poolTraceLog = backendLog.Logger("POOL")
 )
 
 // Initialize package-global logger variables.
 func init() {
 	pool.UseLogger(poolLog)
+	poolTraceLog.SetLevel(slog.LevelTrace)
+	pool.UseTraceLogger(poolTraceLog)
 	gui.UseLogger(guiLog)
 }
 
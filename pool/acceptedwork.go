@@ -13,6 +13,7 @@ import (
 	"time"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/dcrutil"
 )
 
 // AcceptedWork represents an accepted work submission to the network.
@@ -25,6 +26,22 @@ type AcceptedWork struct {
 	Miner     string `json:"miner"`
 	CreatedOn int64  `json:"createdon"`
 
+	// Worker represents the name of the worker whose submission solved
+	// the block.
+	Worker string `json:"worker"`
+
+	// Reward represents the proof-of-work reward of the block. It is the
+	// work subsidy of the block when accepted and the coinbase value,
+	// including fees, once confirmed. Work recorded before rewards were
+	// tracked has a zero reward until it is filled.
+	Reward dcrutil.Amount `json:"reward"`
+
+	// Distributable represents the amount of the reward paid to
+	// participating accounts, the coinbase value bounded by the work
+	// subsidy of the network at the height of the block and the fees of
+	// the block. It is set when the work is confirmed.
+	Distributable dcrutil.Amount `json:"distributable"`
+
 	// An accepted work becomes mined work once it is confirmed by incoming
 	// work as the parent block it was built on.
 	Confirmed bool `json:"confirmed"`
@@ -53,7 +70,7 @@ func AcceptedWorkID(blockHash string, blockHeight uint32) []byte {
 
 // NewAcceptedWork creates an accepted work.
 func NewAcceptedWork(blockHash string, prevHash string, height uint32,
-	minedBy string, miner string) *AcceptedWork {
+	minedBy string, miner string, reward dcrutil.Amount) *AcceptedWork {
 	return &AcceptedWork{
 		UUID:      string(AcceptedWorkID(blockHash, height)),
 		BlockHash: blockHash,
@@ -62,6 +79,7 @@ func NewAcceptedWork(blockHash string, prevHash string, height uint32,
 		MinedBy:   minedBy,
 		Miner:     miner,
 		CreatedOn: time.Now().Unix(),
+		Reward:    reward,
 	}
 }
 
@@ -172,7 +190,7 @@ func ListMinedWork(db *bolt.DB, n int) ([]*AcceptedWork, error) {
 		return minedWork, nil
 	}
 
-	err := db.Update(func(tx *bolt.Tx) error {
+	err := db.View(func(tx *bolt.Tx) error {
 		bkt, err := fetchWorkBucket(tx)
 		if err != nil {
 			return err
@@ -203,6 +221,69 @@ func ListMinedWork(db *bolt.DB, n int) ([]*AcceptedWork, error) {
 	return minedWork, nil
 }
 
+// countMinedWork returns the number of blocks mined by the pool, keyed by
+// the account or solo miner address that mined them.
+func countMinedWork(db *bolt.DB) (map[string]uint32, error) {
+	counts := make(map[string]uint32)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchWorkBucket(tx)
+		if err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			var work AcceptedWork
+			err := json.Unmarshal(v, &work)
+			if err != nil {
+				return err
+			}
+
+			if work.Confirmed {
+				counts[work.MinedBy]++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// listUnconfirmedWork returns the accepted work at or above the provided
+// height not yet confirmed as mined work.
+func listUnconfirmedWork(db *bolt.DB, minHeight uint32) ([]*AcceptedWork, error) {
+	unconfirmed := make([]*AcceptedWork, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchWorkBucket(tx)
+		if err != nil {
+			return err
+		}
+
+		minK := []byte(hex.EncodeToString(heightToBigEndianBytes(minHeight)))
+		cursor := bkt.Cursor()
+		for k, v := cursor.Seek(minK); k != nil; k, v = cursor.Next() {
+			var work AcceptedWork
+			err := json.Unmarshal(v, &work)
+			if err != nil {
+				return err
+			}
+
+			if !work.Confirmed {
+				unconfirmed = append(unconfirmed, &work)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return unconfirmed, nil
+}
+
 // listMinedWorkByAccount returns the N most recent mined work data on
 // blocks mined by the provided pool account id.
 //
@@ -213,7 +294,7 @@ func listMinedWorkByAccount(db *bolt.DB, accountID string, n int) ([]*AcceptedWo
 		return minedWork, nil
 	}
 
-	err := db.Update(func(tx *bolt.Tx) error {
+	err := db.View(func(tx *bolt.Tx) error {
 		bkt, err := fetchWorkBucket(tx)
 		if err != nil {
 			return err
@@ -9,7 +9,8 @@ import (
 
 func persistAcceptedWork(db *bolt.DB, blockHash string, prevHash string,
 	height uint32, minedBy string, miner string) (*AcceptedWork, error) {
-	acceptedWork := NewAcceptedWork(blockHash, prevHash, height, minedBy, miner)
+	acceptedWork := NewAcceptedWork(blockHash, prevHash, height, minedBy,
+		miner, 0)
 	err := acceptedWork.Create(db)
 	if err != nil {
 		return nil, fmt.Errorf("unable to persist accepted work: %v", err)
@@ -140,6 +141,17 @@ func testAcceptedWork(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected %v mined work, got %v", 4, len(minedWork))
 	}
 
+	// Ensure mined work is counted per miner.
+	counts, err := countMinedWork(db)
+	if err != nil {
+		t.Fatalf("countMinedWork error: %v", err)
+	}
+
+	if len(counts) != 2 || counts[xID] != 3 || counts[yID] != 1 {
+		t.Fatalf("expected 3 mined work for account %v and 1 for "+
+			"account %v, got %v", xID, yID, counts)
+	}
+
 	// Update work A and B as unconfirmed
 	workA.Confirmed = false
 	err = workA.Update(db)
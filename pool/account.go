@@ -5,17 +5,19 @@
 package pool
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/Eacred/eacrd/chaincfg"
-	"github.com/Eacred/eacrd/crypto/blake256"
 	"github.com/Eacred/eacrd/dcrutil"
 )
 
+// MaxMinPayout represents the largest minimum payout miners can set for
+// their accounts.
+const MaxMinPayout = dcrutil.Amount(1000 * dcrutil.AtomsPerCoin)
+
 // Account represents a mining pool account.
 type Account struct {
 	UUID      string `json:"uuid"`
@@ -23,21 +25,10 @@ type Account struct {
 	CreatedOn uint64 `json:"createdon"`
 }
 
-// AccountID generates a unique id using provided address of the account.
+// AccountID generates a unique id using provided address of the account,
+// under the current account id derivation. See DeriveAccountID.
 func AccountID(address string, activeNet *chaincfg.Params) (string, error) {
-	_, err := dcrutil.DecodeAddress(address, activeNet)
-	if err != nil {
-		return "", err
-	}
-
-	hasher := blake256.New()
-	_, err = hasher.Write([]byte(address))
-	if err != nil {
-		return "", err
-	}
-
-	id := hex.EncodeToString(hasher.Sum(nil))
-	return id, nil
+	return DeriveAccountID(AccountIDVersion, address, activeNet)
 }
 
 // NewAccount creates a new account.
@@ -99,7 +90,10 @@ func FetchAccount(db *bolt.DB, id []byte) (*Account, error) {
 	return &account, err
 }
 
-// Create persists the account to the database.
+// Create persists the account to the database. Creating an existing
+// account is not an error, the account is set to the existing record
+// instead of overwriting it. An account whose id is taken by the account
+// of another address is refused with ErrAccountIDCollision.
 func (acc *Account) Create(db *bolt.DB) error {
 	err := db.Update(func(tx *bolt.Tx) error {
 		bkt, err := fetchAccountBucket(tx)
@@ -107,6 +101,21 @@ func (acc *Account) Create(db *bolt.DB) error {
 			return err
 		}
 
+		v := bkt.Get([]byte(acc.UUID))
+		if v != nil {
+			var existing Account
+			err := json.Unmarshal(v, &existing)
+			if err != nil {
+				return err
+			}
+			if existing.Address != acc.Address {
+				return accountIDCollision(acc.UUID, acc.Address,
+					existing.Address)
+			}
+			*acc = existing
+			return nil
+		}
+
 		accBytes, err := json.Marshal(acc)
 		if err != nil {
 			return err
@@ -123,6 +132,229 @@ func (acc *Account) Update(db *bolt.DB) error {
 	return MakeError(ErrNotSupported, desc, nil)
 }
 
+// updateAccountAddress replaces the address of the account referenced by
+// the provided id. It is only intended for correcting corrupted account
+// records, the account id remains derived from the original address.
+func updateAccountAddress(db *bolt.DB, id string, address string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountBucket(tx)
+		if err != nil {
+			return err
+		}
+		v := bkt.Get([]byte(id))
+		if v == nil {
+			desc := fmt.Sprintf("no account found for id %s", id)
+			return MakeError(ErrValueNotFound, desc, nil)
+		}
+		var account Account
+		err = json.Unmarshal(v, &account)
+		if err != nil {
+			return err
+		}
+		account.Address = address
+		accBytes, err := json.Marshal(&account)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(id), accBytes)
+	})
+}
+
+// AccountSettings represents the configurable settings of an account.
+type AccountSettings struct {
+	// FeeOverride represents the pool fee charged to the account in place
+	// of the pool fee, nil if the pool fee applies.
+	FeeOverride *float64 `json:"feeoverride,omitempty"`
+	// Donation represents the fraction of the account's payouts donated
+	// to the pool's donation address.
+	Donation float64 `json:"donation,omitempty"`
+	// PaymentsHeld indicates payouts to the account are held, its
+	// dividends accrue until the hold is released.
+	PaymentsHeld bool `json:"paymentsheld,omitempty"`
+	// Locked indicates authorizations for the account require an
+	// authorization token derived from the lock secret.
+	Locked     bool   `json:"locked,omitempty"`
+	LockSecret []byte `json:"locksecret,omitempty"`
+	// Label, Contact and Note represent the support metadata attached to
+	// the account by admins. Settings persisted before they were added
+	// decode with empty metadata.
+	Label   string `json:"label,omitempty"`
+	Contact string `json:"contact,omitempty"`
+	Note    string `json:"note,omitempty"`
+	// DigestInterval represents the period covered by the activity
+	// digests of the account, zero if the account is not opted into
+	// digests.
+	DigestInterval time.Duration `json:"digestinterval,omitempty"`
+	// MinPayout represents the minimum payment of the account in place of
+	// the pool's minimum payment, zero if the pool's minimum applies.
+	MinPayout dcrutil.Amount `json:"minpayout,omitempty"`
+	// APIKeyHash represents the hash of the api key authorizing requests
+	// for the account's details on the public api, nil if the account has
+	// no api key. APIKeyCreated is the time the key was issued, in
+	// seconds.
+	APIKeyHash    []byte `json:"apikeyhash,omitempty"`
+	APIKeyCreated int64  `json:"apikeycreated,omitempty"`
+}
+
+// fetchAccountSettingsBucket is a helper function for getting the account
+// settings bucket.
+func fetchAccountSettingsBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(accountSettingsBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(accountSettingsBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// fetchAccountSettings fetches the settings of the provided account id,
+// accounts without persisted settings have default settings.
+func fetchAccountSettings(db *bolt.DB, id string) (*AccountSettings, error) {
+	var settings AccountSettings
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		v := bkt.Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(v, &settings)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// persistAccountSettings saves the settings of the provided account id.
+func persistAccountSettings(db *bolt.DB, id string, settings *AccountSettings) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		settingsBytes, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(id), settingsBytes)
+	})
+}
+
+// fetchFeeOverrides returns the fee overrides of all accounts that have
+// one, keyed by account id.
+func fetchFeeOverrides(db *bolt.DB) (map[string]float64, error) {
+	overrides := make(map[string]float64)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var settings AccountSettings
+			err := json.Unmarshal(v, &settings)
+			if err != nil {
+				return err
+			}
+			if settings.FeeOverride != nil {
+				overrides[string(k)] = *settings.FeeOverride
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// fetchDonations returns the donation fractions of all accounts donating,
+// keyed by account id.
+func fetchDonations(db *bolt.DB) (map[string]float64, error) {
+	donations := make(map[string]float64)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var settings AccountSettings
+			err := json.Unmarshal(v, &settings)
+			if err != nil {
+				return err
+			}
+			if settings.Donation > 0 {
+				donations[string(k)] = settings.Donation
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return donations, nil
+}
+
+// fetchMinPayouts returns the minimum payouts of all accounts with one set,
+// keyed by account id.
+func fetchMinPayouts(db *bolt.DB) (map[string]dcrutil.Amount, error) {
+	minPayouts := make(map[string]dcrutil.Amount)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var settings AccountSettings
+			err := json.Unmarshal(v, &settings)
+			if err != nil {
+				return err
+			}
+			if settings.MinPayout > 0 {
+				minPayouts[string(k)] = settings.MinPayout
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return minPayouts, nil
+}
+
+// fetchHeldAccounts returns the ids of all accounts with held payments.
+func fetchHeldAccounts(db *bolt.DB) (map[string]struct{}, error) {
+	held := make(map[string]struct{})
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var settings AccountSettings
+			err := json.Unmarshal(v, &settings)
+			if err != nil {
+				return err
+			}
+			if settings.PaymentsHeld {
+				held[string(k)] = struct{}{}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return held, nil
+}
+
 // Delete purges the referenced account from the database.
 func (acc *Account) Delete(db *bolt.DB) error {
 	return deleteEntry(db, accountBkt, []byte(acc.UUID))
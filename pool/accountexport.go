@@ -0,0 +1,295 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+)
+
+const (
+	// AccountExportVersion represents the version of the account export
+	// format.
+	AccountExportVersion = 1
+
+	// accountImportBatchSize represents the number of accounts written per
+	// database transaction by an import.
+	accountImportBatchSize = 100
+)
+
+// AccountExport represents the exported accounts of a pool. Balances are
+// not exported, they remain with the pool the accounts were mined at.
+type AccountExport struct {
+	Version  uint32           `json:"version"`
+	Accounts []*AccountRecord `json:"accounts"`
+}
+
+// AccountRecord represents an exported account and its settings. The
+// account id is derived from the address when the account is imported.
+type AccountRecord struct {
+	Address   string           `json:"address"`
+	CreatedOn uint64           `json:"createdon"`
+	Settings  *AccountSettings `json:"settings,omitempty"`
+}
+
+// AccountImportReport represents the outcome of an account import, the
+// addresses of the imported accounts created, of existing accounts whose
+// settings were replaced and of existing accounts left as they are.
+type AccountImportReport struct {
+	DryRun    bool
+	Created   []string
+	Updated   []string
+	Unchanged []string
+}
+
+// ExportAccounts writes all accounts of the pool along with their settings
+// to the provided writer. The export includes the lock secrets of locked
+// accounts and must be kept private.
+func ExportAccounts(db *bolt.DB, w io.Writer) error {
+	export := &AccountExport{
+		Version:  AccountExportVersion,
+		Accounts: make([]*AccountRecord, 0),
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountBucket(tx)
+		if err != nil {
+			return err
+		}
+		settingsBkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var account Account
+			err := json.Unmarshal(v, &account)
+			if err != nil {
+				return err
+			}
+			record := &AccountRecord{
+				Address:   account.Address,
+				CreatedOn: account.CreatedOn,
+			}
+			if v := settingsBkt.Get(k); v != nil {
+				var settings AccountSettings
+				err := json.Unmarshal(v, &settings)
+				if err != nil {
+					return err
+				}
+				record.Settings = &settings
+			}
+			export.Accounts = append(export.Accounts, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
+
+// validate asserts the settings are within the bounds settable by admins.
+// Fee overrides are only bounded by 1 since the pool fee of the importing
+// pool is not known.
+func (s *AccountSettings) validate() error {
+	if s.FeeOverride != nil && (*s.FeeOverride < 0 || *s.FeeOverride > 1) {
+		desc := fmt.Sprintf("fee override %v is not between 0 and 1",
+			*s.FeeOverride)
+		return MakeError(ErrParse, desc, nil)
+	}
+	if s.Donation < 0 || s.Donation > 1 {
+		desc := fmt.Sprintf("donation %v is not between 0 and 1", s.Donation)
+		return MakeError(ErrParse, desc, nil)
+	}
+	if s.Locked && len(s.LockSecret) == 0 {
+		desc := "locked account has no lock secret"
+		return MakeError(ErrParse, desc, nil)
+	}
+	if len(s.APIKeyHash) != 0 && len(s.APIKeyHash) != sha256.Size {
+		desc := fmt.Sprintf("api key hash of %d bytes is not a sha256 hash",
+			len(s.APIKeyHash))
+		return MakeError(ErrParse, desc, nil)
+	}
+	metadata := &AccountMetadata{
+		Label:   s.Label,
+		Contact: s.Contact,
+		Note:    s.Note,
+	}
+	err := metadata.validate()
+	if err != nil {
+		return MakeError(ErrParse, err.Error(), nil)
+	}
+	return nil
+}
+
+// importEntry represents a validated account of an import.
+type importEntry struct {
+	id       string
+	record   *AccountRecord
+	settings []byte
+}
+
+// ImportAccounts creates the accounts read from the provided reader in the
+// account export format, replacing the settings of existing accounts with
+// the imported settings. Every account is validated against the provided
+// network before any account is written, an import with a malformed or
+// duplicate account, or with an address whose account id is taken by the
+// account of another address, is refused as a whole. Accounts are written
+// in batches, each batch in a single transaction. A dry run only reports
+// the changes the import would make.
+func ImportAccounts(db *bolt.DB, r io.Reader, activeNet *chaincfg.Params, dryRun bool) (*AccountImportReport, error) {
+	var export AccountExport
+	err := json.NewDecoder(r).Decode(&export)
+	if err != nil {
+		desc := "unable to decode account export"
+		return nil, MakeError(ErrDecode, desc, err)
+	}
+	if export.Version != AccountExportVersion {
+		desc := fmt.Sprintf("account export version %d is not supported, "+
+			"expected version %d", export.Version, AccountExportVersion)
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+
+	entries := make([]*importEntry, 0, len(export.Accounts))
+	indices := make(map[string]int, len(export.Accounts))
+	for i, record := range export.Accounts {
+		if record == nil {
+			desc := fmt.Sprintf("account %d is empty", i)
+			return nil, MakeError(ErrParse, desc, nil)
+		}
+		id, err := AccountID(record.Address, activeNet)
+		if err != nil {
+			desc := fmt.Sprintf("account %d: invalid address %q for %s",
+				i, record.Address, activeNet.Name)
+			return nil, MakeError(ErrParse, desc, err)
+		}
+		if j, ok := indices[id]; ok {
+			desc := fmt.Sprintf("account %d: duplicate of account %d (%s)",
+				i, j, record.Address)
+			return nil, MakeError(ErrParse, desc, nil)
+		}
+		indices[id] = i
+		entry := &importEntry{id: id, record: record}
+		if record.Settings != nil {
+			err := record.Settings.validate()
+			if err != nil {
+				desc := fmt.Sprintf("account %d: invalid settings", i)
+				return nil, MakeError(ErrParse, desc, err)
+			}
+			entry.settings, err = json.Marshal(record.Settings)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	// Classify the accounts by the changes importing them makes.
+	report := &AccountImportReport{DryRun: dryRun}
+	created := make(map[string]bool)
+	changed := make(map[string]bool)
+	err = db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountBucket(tx)
+		if err != nil {
+			return err
+		}
+		settingsBkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			address := entry.record.Address
+			if v := bkt.Get([]byte(entry.id)); v != nil {
+				var existing Account
+				err := json.Unmarshal(v, &existing)
+				if err != nil {
+					return err
+				}
+				if existing.Address != address {
+					return accountIDCollision(entry.id, address,
+						existing.Address)
+				}
+			}
+			switch {
+			case bkt.Get([]byte(entry.id)) == nil:
+				created[entry.id] = true
+				report.Created = append(report.Created, address)
+			case entry.settings != nil && !bytes.Equal(entry.settings,
+				settingsBkt.Get([]byte(entry.id))):
+				changed[entry.id] = true
+				report.Updated = append(report.Updated, address)
+			default:
+				report.Unchanged = append(report.Unchanged, address)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	now := uint64(time.Now().Unix())
+	for start := 0; start < len(entries); start += accountImportBatchSize {
+		end := start + accountImportBatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		err := db.Update(func(tx *bolt.Tx) error {
+			bkt, err := fetchAccountBucket(tx)
+			if err != nil {
+				return err
+			}
+			settingsBkt, err := fetchAccountSettingsBucket(tx)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries[start:end] {
+				if created[entry.id] {
+					account := &Account{
+						UUID:      entry.id,
+						Address:   entry.record.Address,
+						CreatedOn: entry.record.CreatedOn,
+					}
+					if account.CreatedOn == 0 {
+						account.CreatedOn = now
+					}
+					accBytes, err := json.Marshal(account)
+					if err != nil {
+						return err
+					}
+					err = bkt.Put([]byte(entry.id), accBytes)
+					if err != nil {
+						return err
+					}
+				}
+				if entry.settings != nil &&
+					(created[entry.id] || changed[entry.id]) {
+					err := settingsBkt.Put([]byte(entry.id), entry.settings)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			desc := fmt.Sprintf("unable to import accounts %d to %d, "+
+				"accounts before them were imported", start, end-1)
+			return nil, MakeError(ErrOther, desc, err)
+		}
+	}
+	return report, nil
+}
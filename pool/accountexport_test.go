@@ -0,0 +1,165 @@
+package pool
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+)
+
+func testAccountExport(t *testing.T, db *bolt.DB) {
+	var buf bytes.Buffer
+	err := ExportAccounts(db, &buf)
+	if err != nil {
+		t.Fatalf("[ExportAccounts] unexpected error: %v", err)
+	}
+	var export AccountExport
+	err = json.Unmarshal(buf.Bytes(), &export)
+	if err != nil {
+		t.Fatalf("unable to decode export: %v", err)
+	}
+	var exported bool
+	for _, record := range export.Accounts {
+		if record.Address == xAddr {
+			exported = true
+		}
+	}
+	if export.Version != AccountExportVersion || !exported {
+		t.Fatalf("expected an export including account x, got %+v", export)
+	}
+
+	importDB := "importdb"
+	os.Remove(importDB)
+	idb, err := openDB(importDB)
+	if err != nil {
+		t.Fatalf("[openDB] unexpected error: %v", err)
+	}
+	defer teardownDB(idb, importDB)
+	err = createBuckets(idb)
+	if err != nil {
+		t.Fatalf("[createBuckets] unexpected error: %v", err)
+	}
+	net := chaincfg.SimNetParams()
+	importAccounts := func(export *AccountExport, dryRun bool) (*AccountImportReport, error) {
+		data, err := json.Marshal(export)
+		if err != nil {
+			t.Fatalf("unable to encode export: %v", err)
+		}
+		return ImportAccounts(idb, bytes.NewReader(data), net, dryRun)
+	}
+	count := func() int {
+		var n int
+		err := idb.View(func(tx *bolt.Tx) error {
+			bkt, err := fetchAccountBucket(tx)
+			if err != nil {
+				return err
+			}
+			n = bkt.Stats().KeyN
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to count accounts: %v", err)
+		}
+		return n
+	}
+
+	// Ensure exports of an unknown version, with an address of another
+	// network or with a duplicate account are refused as a whole.
+	unknown := export
+	unknown.Version = AccountExportVersion + 1
+	_, err = importAccounts(&unknown, false)
+	if !IsError(err, ErrNotSupported) {
+		t.Fatalf("expected a not supported error, got %v", err)
+	}
+	invalid := export
+	invalid.Accounts = append([]*AccountRecord{{
+		Address: "DsfD7KYsJ8tsJMMmFsiWT4ZHrZ9xTvBgNKv"}}, export.Accounts...)
+	_, err = importAccounts(&invalid, false)
+	if !IsError(err, ErrParse) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	duplicate := export
+	duplicate.Accounts = append([]*AccountRecord{{Address: xAddr}},
+		export.Accounts...)
+	_, err = importAccounts(&duplicate, false)
+	if !IsError(err, ErrParse) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	donation := export
+	donation.Accounts = []*AccountRecord{{Address: xAddr,
+		Settings: &AccountSettings{Donation: 2}}}
+	_, err = importAccounts(&donation, false)
+	if !IsError(err, ErrParse) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	if count() != 0 {
+		t.Fatal("expected refused imports not to create accounts")
+	}
+
+	// Ensure a dry run reports the accounts it would create without
+	// creating them.
+	export.Accounts = append(export.Accounts, &AccountRecord{
+		Address:   "Ssj6Sd54j11JM8qpenCwfwnKD73dsjm68ru",
+		CreatedOn: 1,
+		Settings: &AccountSettings{
+			Donation: 0.1,
+			Label:    "migrated",
+		},
+	})
+	report, err := importAccounts(&export, true)
+	if err != nil {
+		t.Fatalf("[ImportAccounts] unexpected error: %v", err)
+	}
+	if !report.DryRun || len(report.Created) != len(export.Accounts) ||
+		count() != 0 {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+
+	// Ensure imports create the accounts with their settings.
+	report, err = importAccounts(&export, false)
+	if err != nil {
+		t.Fatalf("[ImportAccounts] unexpected error: %v", err)
+	}
+	if len(report.Created) != len(export.Accounts) ||
+		count() != len(export.Accounts) {
+		t.Fatalf("unexpected import report %+v", report)
+	}
+	id, err := AccountID("Ssj6Sd54j11JM8qpenCwfwnKD73dsjm68ru", net)
+	if err != nil {
+		t.Fatalf("[AccountID] unexpected error: %v", err)
+	}
+	account, err := FetchAccount(idb, []byte(id))
+	if err != nil {
+		t.Fatalf("[FetchAccount] unexpected error: %v", err)
+	}
+	settings, err := fetchAccountSettings(idb, id)
+	if err != nil {
+		t.Fatalf("[fetchAccountSettings] unexpected error: %v", err)
+	}
+	if account.CreatedOn != 1 || settings.Donation != 0.1 ||
+		settings.Label != "migrated" {
+		t.Fatalf("unexpected imported account %+v with settings %+v",
+			account, settings)
+	}
+
+	// Ensure importing again only updates accounts with changed settings.
+	export.Accounts[len(export.Accounts)-1].Settings.Donation = 0.2
+	report, err = importAccounts(&export, false)
+	if err != nil {
+		t.Fatalf("[ImportAccounts] unexpected error: %v", err)
+	}
+	if len(report.Created) != 0 || len(report.Updated) != 1 ||
+		len(report.Unchanged) != len(export.Accounts)-1 {
+		t.Fatalf("unexpected import report %+v", report)
+	}
+	settings, err = fetchAccountSettings(idb, id)
+	if err != nil {
+		t.Fatalf("[fetchAccountSettings] unexpected error: %v", err)
+	}
+	if settings.Donation != 0.2 {
+		t.Fatalf("expected updated settings, got %+v", settings)
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/crypto/blake256"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+// AccountIDVersion is the version of the account id derivation accounts
+// are keyed by. The id of an account is derived from its address alone, so
+// it is the same on every network the address is valid for.
+//
+// Account records keyed under a previous derivation would silently become
+// orphaned, so a derivation is never changed in place. A changed derivation
+// is added under a new version along with a database migration re-keying
+// existing accounts through accountIDMigration.
+const AccountIDVersion = 1
+
+// accountIDSampleSize represents the maximum number of account records
+// checked against the current account id derivation at startup.
+const accountIDSampleSize = 256
+
+// accountIDDerivations represents the account id derivations of every
+// account id version.
+var accountIDDerivations = map[uint32]func(address string) string{
+	1: blake256AccountID,
+}
+
+// blake256AccountID derives the hex encoded blake256 hash of the provided
+// address, the first account id derivation.
+func blake256AccountID(address string) string {
+	hasher := blake256.New()
+	hasher.Write([]byte(address))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// DeriveAccountID derives the account id of the provided address, which
+// must be valid for the provided network, under the provided account id
+// derivation version.
+func DeriveAccountID(version uint32, address string, activeNet *chaincfg.Params) (string, error) {
+	derive, ok := accountIDDerivations[version]
+	if !ok {
+		desc := fmt.Sprintf("account id version %d is not supported", version)
+		return "", MakeError(ErrNotSupported, desc, nil)
+	}
+	_, err := dcrutil.DecodeAddress(address, activeNet)
+	if err != nil {
+		return "", err
+	}
+	return derive(address), nil
+}
+
+// AccountCollision represents an address refused for deriving the account
+// id of the account of another address.
+type AccountCollision struct {
+	Account         string `json:"account"`
+	Address         string `json:"address"`
+	ExistingAddress string `json:"existingaddress"`
+}
+
+// accountIDCollision returns the error refusing the provided address whose
+// account id is taken by the account of the provided existing address.
+func accountIDCollision(id string, address string, existing string) error {
+	desc := fmt.Sprintf("address %s derives account id %s of address %s",
+		address, id, existing)
+	return MakeError(ErrAccountIDCollision, desc, nil)
+}
+
+// verifyAccountIDs asserts a sample of at most the provided number of
+// account records, spread evenly over the account bucket, are keyed by the
+// account id of their address under the current account id derivation.
+func verifyAccountIDs(db *bolt.DB, sampleSize int) error {
+	derive := accountIDDerivations[AccountIDVersion]
+	return db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountBucket(tx)
+		if err != nil {
+			return err
+		}
+		stride := bkt.Stats().KeyN / sampleSize
+		if stride < 1 {
+			stride = 1
+		}
+		var idx int
+		return bkt.ForEach(func(k, v []byte) error {
+			idx++
+			if (idx-1)%stride != 0 {
+				return nil
+			}
+			var account Account
+			err := json.Unmarshal(v, &account)
+			if err != nil {
+				return err
+			}
+			if string(k) != derive(account.Address) {
+				desc := fmt.Sprintf("account %s of address %s is not "+
+					"keyed by account id version %d, the accounts must "+
+					"be re-keyed by a database migration", k,
+					account.Address, AccountIDVersion)
+				return MakeError(ErrDBUpgrade, desc, nil)
+			}
+			return nil
+		})
+	})
+}
+
+// rekeyAccountKeys moves the entries of the provided bucket keyed by the
+// provided account id, or prefixed by it, to keys of the provided new
+// account id. The account field of moved values is updated.
+func rekeyAccountKeys(bkt *bolt.Bucket, fromID string, toID string, prefix bool) error {
+	moved := make(map[string][]byte)
+	from := []byte(fromID)
+	c := bkt.Cursor()
+	for k, v := c.Seek(from); k != nil && bytes.HasPrefix(k, from); k, v = c.Next() {
+		if !prefix && len(k) != len(from) {
+			continue
+		}
+		var entry map[string]json.RawMessage
+		err := json.Unmarshal(v, &entry)
+		if err != nil {
+			return err
+		}
+		if _, ok := entry["account"]; ok {
+			entry["account"], err = json.Marshal(toID)
+			if err != nil {
+				return err
+			}
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		moved[string(k)] = b
+	}
+	for k, v := range moved {
+		err := bkt.Delete([]byte(k))
+		if err != nil {
+			return err
+		}
+		key := append([]byte(toID), k[len(fromID):]...)
+		if bkt.Get(key) != nil {
+			continue
+		}
+		err = bkt.Put(key, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rekeyAccount moves the provided account, along with its settings,
+// metadata log, activity digest, shares, payments, mined work and worker
+// history, to the provided new id. Records of the account already present
+// under the new id are kept, the activity of the account is merged into
+// them.
+func rekeyAccount(tx *bolt.Tx, account *Account, toID string) error {
+	fromID := account.UUID
+	bkt, err := fetchAccountBucket(tx)
+	if err != nil {
+		return err
+	}
+	err = bkt.Delete([]byte(fromID))
+	if err != nil {
+		return err
+	}
+	if bkt.Get([]byte(toID)) == nil {
+		account.UUID = toID
+		accBytes, err := json.Marshal(account)
+		if err != nil {
+			return err
+		}
+		err = bkt.Put([]byte(toID), accBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	settingsBkt, err := fetchAccountSettingsBucket(tx)
+	if err != nil {
+		return err
+	}
+	if v := settingsBkt.Get([]byte(fromID)); v != nil {
+		settings := append([]byte(nil), v...)
+		err := settingsBkt.Delete([]byte(fromID))
+		if err != nil {
+			return err
+		}
+		if settingsBkt.Get([]byte(toID)) == nil {
+			err = settingsBkt.Put([]byte(toID), settings)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	logBkt, err := fetchAccountMetadataLogBucket(tx)
+	if err != nil {
+		return err
+	}
+	err = rekeyAccountKeys(logBkt, fromID, toID, true)
+	if err != nil {
+		return err
+	}
+	digestBkt, err := fetchDigestBucket(tx)
+	if err != nil {
+		return err
+	}
+	err = rekeyAccountKeys(digestBkt, fromID, toID, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = mergeShares(tx, fromID, toID)
+	if err != nil {
+		return err
+	}
+	pbkt, err := fetchPaymentBucket(tx)
+	if err != nil {
+		return err
+	}
+	pibkt, err := fetchAccountPaymentBucket(tx, paymentBkt)
+	if err != nil {
+		return err
+	}
+	_, err = mergePayments(pbkt, pibkt, fromID, toID)
+	if err != nil {
+		return err
+	}
+	abkt, err := fetchPaymentArchiveBucket(tx)
+	if err != nil {
+		return err
+	}
+	aibkt, err := fetchAccountPaymentBucket(tx, paymentArchiveBkt)
+	if err != nil {
+		return err
+	}
+	_, err = mergePayments(abkt, aibkt, fromID, toID)
+	if err != nil {
+		return err
+	}
+	err = mergePaymentTotal(tx, fromID, toID)
+	if err != nil {
+		return err
+	}
+	_, err = mergeMinedWork(tx, fromID, toID)
+	if err != nil {
+		return err
+	}
+	_, err = mergeWorkerHistory(tx, fromID, toID)
+	return err
+}
+
+// rekeyAccounts re-keys every account not keyed by the account id of its
+// address under the provided derivation, returning the number of accounts
+// re-keyed. Accounts are not re-keyed while a payment cycle is in flight,
+// and an address deriving the id of another address is a collision failing
+// the re-keying as a whole.
+func rekeyAccounts(tx *bolt.Tx, derive func(address string) string) (uint32, error) {
+	bkt, err := fetchAccountBucket(tx)
+	if err != nil {
+		return 0, err
+	}
+	stale := make([]*Account, 0)
+	err = bkt.ForEach(func(k, v []byte) error {
+		var account Account
+		err := json.Unmarshal(v, &account)
+		if err != nil {
+			return err
+		}
+		account.UUID = string(k)
+		if account.UUID != derive(account.Address) {
+			stale = append(stale, &account)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+	cycle, err := fetchPaymentCycle(tx)
+	if err != nil {
+		return 0, err
+	}
+	if cycle != nil {
+		desc := fmt.Sprintf("the payment cycle at height #%d is in flight",
+			cycle.Height)
+		return 0, MakeError(ErrNotSupported, desc, nil)
+	}
+	for _, account := range stale {
+		toID := derive(account.Address)
+		if v := bkt.Get([]byte(toID)); v != nil {
+			var existing Account
+			err := json.Unmarshal(v, &existing)
+			if err != nil {
+				return 0, err
+			}
+			if existing.Address != account.Address {
+				return 0, accountIDCollision(toID, account.Address,
+					existing.Address)
+			}
+		}
+		err := rekeyAccount(tx, account, toID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return uint32(len(stale)), nil
+}
+
+// accountIDMigration returns a database migration re-keying all accounts
+// by the account id derivation of the provided version.
+func accountIDMigration(version uint32) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		derive, ok := accountIDDerivations[version]
+		if !ok {
+			desc := fmt.Sprintf("account id version %d is not supported",
+				version)
+			return MakeError(ErrDBUpgrade, desc, nil)
+		}
+		rekeyed, err := rekeyAccounts(tx, derive)
+		if err != nil {
+			return err
+		}
+		log.Infof("Re-keyed %d account(s) by account id version %d",
+			rekeyed, version)
+		return nil
+	}
+}
@@ -0,0 +1,277 @@
+package pool
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+func testAccountIDs(t *testing.T, db *bolt.DB) {
+	net := chaincfg.SimNetParams()
+
+	// Ensure the current derivation keys the existing accounts and unknown
+	// derivation versions and invalid addresses are refused.
+	id, err := DeriveAccountID(AccountIDVersion, xAddr, net)
+	if err != nil {
+		t.Fatalf("[DeriveAccountID] unexpected error: %v", err)
+	}
+	if id != xID {
+		t.Fatalf("expected account id %s, got %s", xID, id)
+	}
+	_, err = DeriveAccountID(AccountIDVersion+1, xAddr, net)
+	if !IsError(err, ErrNotSupported) {
+		t.Fatalf("expected a not supported error, got %v", err)
+	}
+	_, err = DeriveAccountID(AccountIDVersion, "invalid", net)
+	if err == nil {
+		t.Fatal("expected an invalid address error")
+	}
+	err = verifyAccountIDs(db, accountIDSampleSize)
+	if err != nil {
+		t.Fatalf("[verifyAccountIDs] unexpected error: %v", err)
+	}
+
+	accountDB := "accountiddb"
+	os.Remove(accountDB)
+	adb, err := openDB(accountDB)
+	if err != nil {
+		t.Fatalf("[openDB] unexpected error: %v", err)
+	}
+	defer teardownDB(adb, accountDB)
+	err = createBuckets(adb)
+	if err != nil {
+		t.Fatalf("[createBuckets] unexpected error: %v", err)
+	}
+	putAccount := func(id string, address string) {
+		err := adb.Update(func(tx *bolt.Tx) error {
+			bkt, err := fetchAccountBucket(tx)
+			if err != nil {
+				return err
+			}
+			accBytes, err := json.Marshal(&Account{UUID: id, Address: address})
+			if err != nil {
+				return err
+			}
+			return bkt.Put([]byte(id), accBytes)
+		})
+		if err != nil {
+			t.Fatalf("unable to persist account: %v", err)
+		}
+	}
+	deleteAccount := func(id string) {
+		err := adb.Update(func(tx *bolt.Tx) error {
+			bkt, err := fetchAccountBucket(tx)
+			if err != nil {
+				return err
+			}
+			return bkt.Delete([]byte(id))
+		})
+		if err != nil {
+			t.Fatalf("unable to delete account: %v", err)
+		}
+	}
+
+	// Ensure an address deriving the id of the account of another address
+	// is refused on creation and on import.
+	putAccount(yID, xAddr)
+	account, err := NewAccount(yAddr, net)
+	if err != nil {
+		t.Fatalf("[NewAccount] unexpected error: %v", err)
+	}
+	err = account.Create(adb)
+	if !IsError(err, ErrAccountIDCollision) {
+		t.Fatalf("expected an account id collision error, got %v", err)
+	}
+	data, err := json.Marshal(&AccountExport{
+		Version:  AccountExportVersion,
+		Accounts: []*AccountRecord{{Address: yAddr}},
+	})
+	if err != nil {
+		t.Fatalf("unable to encode export: %v", err)
+	}
+	_, err = ImportAccounts(adb, bytes.NewReader(data), net, false)
+	if !IsError(err, ErrAccountIDCollision) {
+		t.Fatalf("expected an account id collision error, got %v", err)
+	}
+	deleteAccount(yID)
+
+	// Simulate accounts keyed by a previous account id derivation.
+	const legacyVersion = 0
+	accountIDDerivations[legacyVersion] = func(address string) string {
+		h := sha256.Sum256([]byte(address))
+		return hex.EncodeToString(h[:])
+	}
+	defer delete(accountIDDerivations, legacyVersion)
+	legacy := accountIDDerivations[legacyVersion]
+	oldX, oldY := legacy(xAddr), legacy(yAddr)
+	putAccount(oldX, xAddr)
+	putAccount(oldY, yAddr)
+	err = persistAccountSettings(adb, oldX, &AccountSettings{Label: "x"})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	err = adb.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchDigestBucket(tx)
+		if err != nil {
+			return err
+		}
+		return putAccountActivity(bkt, &AccountActivity{Account: oldX,
+			Interval: 3600, Shares: 4, HashRateSum: new(big.Rat)})
+	})
+	if err != nil {
+		t.Fatalf("[putAccountActivity] unexpected error: %v", err)
+	}
+	for _, account := range []string{oldX, oldX, oldY} {
+		err := NewShare(account, new(big.Rat).SetInt64(2)).Create(adb)
+		if err != nil {
+			t.Fatalf("[Create] unexpected error: %v", err)
+		}
+	}
+	amt, _ := dcrutil.NewAmount(1)
+	err = NewPayment(oldY, amt, 10, 26).Create(adb)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	err = adb.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchPaymentTotalBucket(tx)
+		if err != nil {
+			return err
+		}
+		return addPaymentTotal(bkt, oldY, amt)
+	})
+	if err != nil {
+		t.Fatalf("[addPaymentTotal] unexpected error: %v", err)
+	}
+
+	// Ensure the startup check refuses accounts keyed by a previous
+	// derivation.
+	err = verifyAccountIDs(adb, accountIDSampleSize)
+	if !IsError(err, ErrDBUpgrade) {
+		t.Fatalf("expected a database upgrade error, got %v", err)
+	}
+
+	// Ensure a re-keying migration is refused while a payment cycle is in
+	// flight.
+	err = persistPaymentCycle(adb, &paymentCycle{Height: 10})
+	if err != nil {
+		t.Fatalf("[persistPaymentCycle] unexpected error: %v", err)
+	}
+	err = adb.Update(accountIDMigration(AccountIDVersion))
+	if !IsError(err, ErrNotSupported) {
+		t.Fatalf("expected a payment cycle in flight error, got %v", err)
+	}
+	err = persistPaymentCycle(adb, nil)
+	if err != nil {
+		t.Fatalf("[persistPaymentCycle] unexpected error: %v", err)
+	}
+
+	// Ensure the re-keying migration moves the accounts and their records
+	// to the ids of the current derivation.
+	err = adb.Update(accountIDMigration(AccountIDVersion))
+	if err != nil {
+		t.Fatalf("[accountIDMigration] unexpected error: %v", err)
+	}
+	err = verifyAccountIDs(adb, accountIDSampleSize)
+	if err != nil {
+		t.Fatalf("[verifyAccountIDs] unexpected error: %v", err)
+	}
+	for id, address := range map[string]string{xID: xAddr, yID: yAddr} {
+		account, err := FetchAccount(adb, []byte(id))
+		if err != nil {
+			t.Fatalf("[FetchAccount] unexpected error: %v", err)
+		}
+		if account.UUID != id || account.Address != address {
+			t.Fatalf("expected account %s of address %s, got %+v", id,
+				address, account)
+		}
+	}
+	for _, id := range []string{oldX, oldY} {
+		_, err := FetchAccount(adb, []byte(id))
+		if !IsError(err, ErrValueNotFound) {
+			t.Fatalf("expected legacy account %s to be removed, got %v",
+				id, err)
+		}
+	}
+	settings, err := fetchAccountSettings(adb, xID)
+	if err != nil {
+		t.Fatalf("[fetchAccountSettings] unexpected error: %v", err)
+	}
+	if settings.Label != "x" {
+		t.Fatalf("expected re-keyed settings, got %+v", settings)
+	}
+	err = adb.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchDigestBucket(tx)
+		if err != nil {
+			return err
+		}
+		activity, err := fetchAccountActivity(bkt, xID)
+		if err != nil {
+			return err
+		}
+		if activity == nil || activity.Account != xID || activity.Shares != 4 {
+			t.Fatalf("expected re-keyed account activity, got %+v", activity)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("[fetchAccountActivity] unexpected error: %v", err)
+	}
+	shares := make(map[string]int)
+	err = adb.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchShareBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var share Share
+			err := json.Unmarshal(v, &share)
+			if err != nil {
+				return err
+			}
+			shares[share.Account]++
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("unable to count shares: %v", err)
+	}
+	if len(shares) != 2 || shares[xID] != 2 || shares[yID] != 1 {
+		t.Fatalf("expected re-keyed shares, got %v", shares)
+	}
+	pending, err := fetchPendingBalance(adb, yID)
+	if err != nil {
+		t.Fatalf("[fetchPendingBalance] unexpected error: %v", err)
+	}
+	if pending != amt {
+		t.Fatalf("expected a re-keyed pending balance of %v, got %v", amt,
+			pending)
+	}
+	total, err := fetchPaymentTotal(adb, yID)
+	if err != nil {
+		t.Fatalf("[fetchPaymentTotal] unexpected error: %v", err)
+	}
+	if total != amt {
+		t.Fatalf("expected a re-keyed payment total of %v, got %v", amt, total)
+	}
+
+	// Ensure an address deriving the id of another address fails the
+	// re-keying as a whole.
+	putAccount(oldY, xAddr)
+	deleteAccount(xID)
+	accountIDDerivations[legacyVersion] = func(string) string { return yID }
+	err = adb.Update(func(tx *bolt.Tx) error {
+		_, err := rekeyAccounts(tx, accountIDDerivations[legacyVersion])
+		return err
+	})
+	if !IsError(err, ErrAccountIDCollision) {
+		t.Fatalf("expected an account id collision error, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+	"github.com/Eacred/eacrd/dcrec/secp256k1"
+	"github.com/Eacred/eacrd/dcrutil"
+	"github.com/Eacred/eacrd/wire"
+)
+
+// Account actions authenticated by signed challenges.
+const (
+	LockAction        = "lock"
+	UnlockAction      = "unlock"
+	TokenAction       = "token"
+	ShareWindowAction = "sharewindow"
+	AddressAction     = "address"
+	APIKeyAction      = "apikey"
+)
+
+const (
+	// signedMessageMagic is the prefix of messages signed by the wallet's
+	// signmessage command.
+	signedMessageMagic = "Decred Signed Message:\n"
+
+	// challengePrefix is the prefix of account lock challenges.
+	challengePrefix = "eacrpool"
+
+	// lockSecretSize is the size of the secret authorization tokens of a
+	// locked account are derived from.
+	lockSecretSize = 32
+)
+
+var (
+	// maxChallengeAge is the period a signed challenge remains valid for.
+	maxChallengeAge = time.Minute * 10
+
+	// maxChallengeSkew is the period a signed challenge may be dated ahead
+	// of the pool's clock, allowing for clock drift of the signer.
+	maxChallengeSkew = time.Minute
+
+	// authFailureWindow is the period failed authorizations of a host are
+	// counted over.
+	authFailureWindow = time.Hour
+)
+
+// AuthChallenge returns the challenge to be signed by the key of the
+// provided address to perform the provided account lock action.
+func AuthChallenge(action string, address string, now time.Time) string {
+	return fmt.Sprintf("%s %s %s %d", challengePrefix, action, address,
+		now.Unix())
+}
+
+// verifySignedMessage asserts the provided base64 encoded signature is a
+// signature of the message by the key of the provided pay-to-pubkey-hash
+// address.
+func verifySignedMessage(address string, message string, signature string, net *chaincfg.Params) error {
+	addr, err := dcrutil.DecodeAddress(address, net)
+	if err != nil {
+		desc := fmt.Sprintf("unable to decode address %s", address)
+		return MakeError(ErrDecode, desc, err)
+	}
+	if _, ok := addr.(*dcrutil.AddressPubKeyHash); !ok {
+		desc := fmt.Sprintf("address %s is not a pay-to-pubkey-hash "+
+			"address", address)
+		return MakeError(ErrUnauthorized, desc, nil)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		desc := "unable to decode signature"
+		return MakeError(ErrDecode, desc, err)
+	}
+	var buf bytes.Buffer
+	err = wire.WriteVarString(&buf, 0, signedMessageMagic)
+	if err != nil {
+		return err
+	}
+	err = wire.WriteVarString(&buf, 0, message)
+	if err != nil {
+		return err
+	}
+	pubKey, compressed, err := secp256k1.RecoverCompact(sig,
+		chainhash.HashB(buf.Bytes()))
+	if err != nil {
+		desc := "invalid signature"
+		return MakeError(ErrUnauthorized, desc, err)
+	}
+	serializedPubKey := pubKey.SerializeUncompressed()
+	if compressed {
+		serializedPubKey = pubKey.SerializeCompressed()
+	}
+	signer, err := dcrutil.NewAddressSecpPubKey(serializedPubKey, net)
+	if err != nil {
+		desc := "invalid signature"
+		return MakeError(ErrUnauthorized, desc, err)
+	}
+	if signer.Address() != address {
+		desc := fmt.Sprintf("message not signed by the key of %s", address)
+		return MakeError(ErrUnauthorized, desc, nil)
+	}
+	return nil
+}
+
+// verifyChallenge asserts the provided challenge is a recent challenge for
+// the provided action and address, signed by the key of the address.
+// Challenges dated ahead of the provided time by more than the challenge
+// skew allowance are refused.
+func verifyChallenge(action string, address string, challenge string, signature string, net *chaincfg.Params, now time.Time) error {
+	parts := strings.Split(challenge, " ")
+	if len(parts) != 4 || parts[0] != challengePrefix ||
+		parts[1] != action || parts[2] != address {
+		desc := fmt.Sprintf("invalid %s challenge for %s", action, address)
+		return MakeError(ErrUnauthorized, desc, nil)
+	}
+	issued, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		desc := "invalid challenge timestamp"
+		return MakeError(ErrUnauthorized, desc, err)
+	}
+	age := now.Sub(time.Unix(issued, 0))
+	if age > maxChallengeAge {
+		desc := fmt.Sprintf("challenge for %s expired", address)
+		return MakeError(ErrUnauthorized, desc, nil)
+	}
+	if age < -maxChallengeSkew {
+		desc := fmt.Sprintf("challenge for %s is dated in the future",
+			address)
+		return MakeError(ErrUnauthorized, desc, nil)
+	}
+	return verifySignedMessage(address, challenge, signature, net)
+}
+
+// usedChallenges records the signed challenges accepted by the pool until
+// they expire, so a captured signed challenge cannot be replayed.
+type usedChallenges struct {
+	expiries map[string]time.Time
+	mtx      sync.Mutex
+}
+
+// newUsedChallenges creates an empty record of used challenges.
+func newUsedChallenges() *usedChallenges {
+	return &usedChallenges{
+		expiries: make(map[string]time.Time),
+	}
+}
+
+// consume records the provided verified challenge as used at the provided
+// time, returning an unauthorized error if it was used before. A challenge
+// identifies its action, address and timestamp, it is recorded until it
+// can no longer pass verification. Expired challenges are removed.
+func (u *usedChallenges) consume(challenge string, now time.Time) error {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	for used, expiry := range u.expiries {
+		if now.After(expiry) {
+			delete(u.expiries, used)
+		}
+	}
+	if _, ok := u.expiries[challenge]; ok {
+		desc := "challenge already used"
+		return MakeError(ErrUnauthorized, desc, nil)
+	}
+	u.expiries[challenge] = now.Add(maxChallengeAge + maxChallengeSkew)
+	return nil
+}
+
+// newLockSecret generates a random secret for deriving the authorization
+// tokens of a locked account.
+func newLockSecret() ([]byte, error) {
+	secret := make([]byte, lockSecretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// authTokenDigest returns the digest of an authorization token for the
+// provided account id expiring at the provided time.
+func authTokenDigest(secret []byte, accountID string, expiry int64) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(fmt.Sprintf("%s:%d", accountID, expiry)))
+	return mac.Sum(nil)
+}
+
+// generateAuthToken creates an authorization token for the provided
+// account id, valid until the provided expiry. Tokens are of the form
+// expiry.digest.
+func generateAuthToken(secret []byte, accountID string, expiry time.Time) string {
+	return fmt.Sprintf("%d.%s", expiry.Unix(),
+		hex.EncodeToString(authTokenDigest(secret, accountID, expiry.Unix())))
+}
+
+// validAuthToken asserts the provided token is an unexpired authorization
+// token of the provided account id.
+func validAuthToken(secret []byte, accountID string, token string, now time.Time) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return false
+	}
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Unix() > expiry {
+		return false
+	}
+	digest, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(digest, authTokenDigest(secret, accountID, expiry))
+}
+
+// authFailures represents the failed authorizations of a host.
+type authFailures struct {
+	count uint32
+	since time.Time
+}
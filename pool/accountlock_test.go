@@ -0,0 +1,259 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+	"github.com/Eacred/eacrd/dcrec"
+	"github.com/Eacred/eacrd/dcrec/secp256k1"
+	"github.com/Eacred/eacrd/dcrutil"
+	"github.com/Eacred/eacrd/wire"
+)
+
+// newSigningKey generates a key and its pay-to-pubkey-hash address on the
+// provided network.
+func newSigningKey(t *testing.T, net *chaincfg.Params) (*secp256k1.PrivateKey, string) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("[GeneratePrivateKey] unexpected error: %v", err)
+	}
+	pkHash := dcrutil.Hash160(key.PubKey().SerializeCompressed())
+	addr, err := dcrutil.NewAddressPubKeyHash(pkHash, net,
+		dcrec.STEcdsaSecp256k1)
+	if err != nil {
+		t.Fatalf("[NewAddressPubKeyHash] unexpected error: %v", err)
+	}
+	return key, addr.Address()
+}
+
+// signMessage signs the provided message with the provided key the way
+// the wallet's signmessage command does.
+func signMessage(t *testing.T, key *secp256k1.PrivateKey, message string) string {
+	var buf bytes.Buffer
+	err := wire.WriteVarString(&buf, 0, signedMessageMagic)
+	if err != nil {
+		t.Fatalf("[WriteVarString] unexpected error: %v", err)
+	}
+	err = wire.WriteVarString(&buf, 0, message)
+	if err != nil {
+		t.Fatalf("[WriteVarString] unexpected error: %v", err)
+	}
+	sig, err := secp256k1.SignCompact(key, chainhash.HashB(buf.Bytes()), true)
+	if err != nil {
+		t.Fatalf("[SignCompact] unexpected error: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func testAccountLock(t *testing.T, db *bolt.DB) {
+	activeNet := chaincfg.SimNetParams()
+	now := time.Now()
+	key, address := newSigningKey(t, activeNet)
+	otherKey, _ := newSigningKey(t, activeNet)
+
+	// Ensure only recent challenges of the action and address signed by
+	// the key of the address are accepted.
+	challenge := AuthChallenge(LockAction, address, now)
+	err := verifyChallenge(LockAction, address, challenge,
+		signMessage(t, key, challenge), activeNet, now)
+	if err != nil {
+		t.Fatalf("[verifyChallenge] unexpected error: %v", err)
+	}
+	tests := map[string]struct {
+		action    string
+		challenge string
+		signature string
+	}{
+		"wrong action": {
+			action:    UnlockAction,
+			challenge: challenge,
+			signature: signMessage(t, key, challenge),
+		},
+		"wrong signer": {
+			action:    LockAction,
+			challenge: challenge,
+			signature: signMessage(t, otherKey, challenge),
+		},
+		"expired": {
+			action:    LockAction,
+			challenge: AuthChallenge(LockAction, address, now.Add(-time.Hour)),
+			signature: signMessage(t, key, AuthChallenge(LockAction, address,
+				now.Add(-time.Hour))),
+		},
+		"future": {
+			action:    LockAction,
+			challenge: AuthChallenge(LockAction, address, now.Add(time.Hour)),
+			signature: signMessage(t, key, AuthChallenge(LockAction, address,
+				now.Add(time.Hour))),
+		},
+		"malformed signature": {
+			action:    LockAction,
+			challenge: challenge,
+			signature: "signature",
+		},
+	}
+	for name, test := range tests {
+		err := verifyChallenge(test.action, address, test.challenge,
+			test.signature, activeNet, now)
+		if err == nil {
+			t.Fatalf("[verifyChallenge] expected a %s challenge error", name)
+		}
+	}
+
+	// Ensure challenges dated ahead within the skew allowance are accepted.
+	skewed := AuthChallenge(LockAction, address, now.Add(maxChallengeSkew/2))
+	err = verifyChallenge(LockAction, address, skewed,
+		signMessage(t, key, skewed), activeNet, now)
+	if err != nil {
+		t.Fatalf("[verifyChallenge] unexpected error: %v", err)
+	}
+
+	// Ensure used challenges are refused until they expire.
+	used := newUsedChallenges()
+	err = used.consume(challenge, now)
+	if err != nil {
+		t.Fatalf("[consume] unexpected error: %v", err)
+	}
+	err = used.consume(challenge, now.Add(maxChallengeAge))
+	if !IsError(err, ErrUnauthorized) {
+		t.Fatalf("[consume] expected an unauthorized error, got %v", err)
+	}
+	err = used.consume(skewed, now)
+	if err != nil {
+		t.Fatalf("[consume] unexpected error: %v", err)
+	}
+	later := now.Add(maxChallengeAge + maxChallengeSkew + time.Second)
+	err = used.consume(AuthChallenge(LockAction, address, later), later)
+	if err != nil {
+		t.Fatalf("[consume] unexpected error: %v", err)
+	}
+	if _, ok := used.expiries[challenge]; ok {
+		t.Fatal("expected the expired challenge to be removed")
+	}
+
+	// Ensure authorization tokens are only valid for their account until
+	// they expire.
+	secret, err := newLockSecret()
+	if err != nil {
+		t.Fatalf("[newLockSecret] unexpected error: %v", err)
+	}
+	id, err := AccountID(address, activeNet)
+	if err != nil {
+		t.Fatalf("[AccountID] unexpected error: %v", err)
+	}
+	token := generateAuthToken(secret, id, now.Add(time.Hour))
+	if !validAuthToken(secret, id, token, now) {
+		t.Fatal("expected a valid authorization token")
+	}
+	if validAuthToken(secret, id, token, now.Add(time.Hour*2)) {
+		t.Fatal("expected an expired authorization token to be invalid")
+	}
+	if validAuthToken(secret, xID, token, now) {
+		t.Fatal("expected a token of another account to be invalid")
+	}
+	otherSecret, err := newLockSecret()
+	if err != nil {
+		t.Fatalf("[newLockSecret] unexpected error: %v", err)
+	}
+	if validAuthToken(otherSecret, id, token, now) {
+		t.Fatal("expected a token of a previous lock secret to be invalid")
+	}
+
+	// Ensure clients of locked accounts are only authorized with a valid
+	// authorization token, failures are recorded against the host.
+	err = persistAccountSettings(db, id, &AccountSettings{
+		Locked:     true,
+		LockSecret: secret,
+	})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	failures := make([]string, 0)
+	cCfg := &ClientConfig{
+		ActiveNet: activeNet,
+		DB:        db,
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RecordAuthFailure: func(host string) {
+			failures = append(failures, host)
+		},
+		Events: NewEventBus(),
+	}
+	authorize := func(password string) (bool, *StratumError) {
+		clientID := fmt.Sprintf("%08x/%s", 1, CPU)
+		client := &Client{
+			id:     clientID,
+			addr:   &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			cfg:    cCfg,
+			ctx:    context.Background(),
+			ch:     make(chan Message, 1),
+			logger: newClientLogger(clientID, CPU, "127.0.0.1", nil),
+		}
+		id := uint64(1)
+		client.handleAuthorizeRequest(&Request{
+			ID:     &id,
+			Method: Authorize,
+			Params: []interface{}{address + ".mn", password},
+		}, true)
+		status, sErr, err := ParseAuthorizeResponse((<-client.ch).(*Response))
+		if err != nil {
+			t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+		}
+		return status, sErr
+	}
+	status, sErr := authorize("x")
+	if status || sErr == nil || sErr.Code != AuthTokenRequired {
+		t.Fatalf("expected an authorization token required error, got %v",
+			sErr)
+	}
+	if len(failures) != 1 || failures[0] != "127.0.0.1" {
+		t.Fatalf("expected a recorded authorization failure, got %v",
+			failures)
+	}
+	status, sErr = authorize(token)
+	if !status {
+		t.Fatalf("expected an authorized client, got %v", sErr)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("expected 1 authorization failure, got %d", len(failures))
+	}
+
+	// Ensure unlocked accounts authorize without a token.
+	err = persistAccountSettings(db, id, &AccountSettings{})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	status, sErr = authorize("")
+	if !status {
+		t.Fatalf("expected an authorized client, got %v", sErr)
+	}
+
+	account, err := FetchAccount(db, []byte(id))
+	if err != nil {
+		t.Fatalf("[FetchAccount] unexpected error: %v", err)
+	}
+	err = account.Delete(db)
+	if err != nil {
+		t.Fatalf("[Delete] unexpected error: %v", err)
+	}
+	err = emptyBucket(db, accountSettingsBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+const (
+	// maxAccountLabelLen is the maximum length of an account label in
+	// characters.
+	maxAccountLabelLen = 64
+
+	// maxAccountContactLen is the maximum length of an account contact in
+	// characters.
+	maxAccountContactLen = 256
+
+	// maxAccountNoteLen is the maximum length of an account note in
+	// characters.
+	maxAccountNoteLen = 2048
+)
+
+// AccountMetadata represents the support metadata attached to an account
+// by admins. It is only served to admins, never by the public api.
+type AccountMetadata struct {
+	Label   string `json:"label"`
+	Contact string `json:"contact"`
+	Note    string `json:"note"`
+}
+
+// AccountMetadataChange represents the audit record of a change to a
+// metadata field of an account.
+type AccountMetadataChange struct {
+	Account  string `json:"account"`
+	Field    string `json:"field"`
+	Previous string `json:"previous"`
+	Value    string `json:"value"`
+	By       string `json:"by"`
+	On       int64  `json:"on"`
+}
+
+// validate asserts the fields of the metadata do not exceed their maximum
+// lengths.
+func (m *AccountMetadata) validate() error {
+	fields := []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"label", m.Label, maxAccountLabelLen},
+		{"contact", m.Contact, maxAccountContactLen},
+		{"note", m.Note, maxAccountNoteLen},
+	}
+	for _, field := range fields {
+		if !utf8.ValidString(field.value) {
+			desc := fmt.Sprintf("account %s is not valid utf-8", field.name)
+			return MakeError(ErrDecode, desc, nil)
+		}
+		if n := utf8.RuneCountInString(field.value); n > field.max {
+			desc := fmt.Sprintf("account %s of %d characters exceeds the "+
+				"maximum of %d", field.name, n, field.max)
+			return MakeError(ErrOther, desc, nil)
+		}
+	}
+	return nil
+}
+
+// fetchAccountMetadataLogBucket is a helper function for getting the account
+// metadata log bucket.
+func fetchAccountMetadataLogBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(accountMetadataLogBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(accountMetadataLogBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// accountMetadataChangeKey returns the key of the provided metadata change.
+// Keys are prefixed by the account id followed by the big endian change
+// time so the changes of an account are contiguous and sorted by time. The
+// index orders changes made at the same time.
+func accountMetadataChangeKey(change *AccountMetadataChange, index int) []byte {
+	key := make([]byte, 0, len(change.Account)+9)
+	key = append(key, change.Account...)
+	var on [8]byte
+	binary.BigEndian.PutUint64(on[:], uint64(change.On))
+	key = append(key, on[:]...)
+	return append(key, byte(index))
+}
+
+// updateAccountMetadata replaces the metadata of the provided account id and
+// records an audit entry for every changed field, attributed to the
+// provided editor. The settings and audit entries are persisted in a single
+// transaction. It returns the changes made.
+func updateAccountMetadata(db *bolt.DB, id string, metadata *AccountMetadata, by string, now int64) ([]*AccountMetadataChange, error) {
+	var changes []*AccountMetadataChange
+	err := db.Update(func(tx *bolt.Tx) error {
+		sbkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		lbkt, err := fetchAccountMetadataLogBucket(tx)
+		if err != nil {
+			return err
+		}
+		var settings AccountSettings
+		if v := sbkt.Get([]byte(id)); v != nil {
+			err := json.Unmarshal(v, &settings)
+			if err != nil {
+				return err
+			}
+		}
+		fields := []struct {
+			name  string
+			value *string
+			new   string
+		}{
+			{"label", &settings.Label, metadata.Label},
+			{"contact", &settings.Contact, metadata.Contact},
+			{"note", &settings.Note, metadata.Note},
+		}
+		for _, field := range fields {
+			if *field.value == field.new {
+				continue
+			}
+			changes = append(changes, &AccountMetadataChange{
+				Account:  id,
+				Field:    field.name,
+				Previous: *field.value,
+				Value:    field.new,
+				By:       by,
+				On:       now,
+			})
+			*field.value = field.new
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		for idx, change := range changes {
+			b, err := json.Marshal(change)
+			if err != nil {
+				return err
+			}
+			err = lbkt.Put(accountMetadataChangeKey(change, idx), b)
+			if err != nil {
+				return err
+			}
+		}
+		settingsBytes, err := json.Marshal(&settings)
+		if err != nil {
+			return err
+		}
+		return sbkt.Put([]byte(id), settingsBytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// fetchAccountMetadataLog fetches the audit records of metadata changes of
+// the provided account id. List is ordered, most recent change comes first.
+func fetchAccountMetadataLog(db *bolt.DB, id string) ([]*AccountMetadataChange, error) {
+	changes := make([]*AccountMetadataChange, 0)
+	prefix := []byte(id)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountMetadataLogBucket(tx)
+		if err != nil {
+			return err
+		}
+		c := bkt.Cursor()
+		for k, v := c.Seek(prefix); k != nil; k, v = c.Next() {
+			// Keys of other accounts sharing the prefix are longer than
+			// the id and its timestamp and index suffix.
+			if !bytes.HasPrefix(k, prefix) {
+				break
+			}
+			if len(k) != len(prefix)+9 {
+				continue
+			}
+			var change AccountMetadataChange
+			err := json.Unmarshal(v, &change)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, &change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+	return changes, nil
+}
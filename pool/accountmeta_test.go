@@ -0,0 +1,116 @@
+package pool
+
+import (
+	"strings"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+)
+
+func testAccountMetadata(t *testing.T, db *bolt.DB) {
+	hub := &Hub{
+		db:  db,
+		cfg: &HubConfig{ActiveNet: chaincfg.SimNetParams()},
+	}
+
+	// Ensure settings persisted before metadata was added decode with
+	// empty metadata and keep their other settings.
+	err := db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountSettingsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(xID),
+			[]byte(`{"donation":0.5,"paymentsheld":true}`))
+	})
+	if err != nil {
+		t.Fatalf("unable to persist legacy settings: %v", err)
+	}
+	view, err := hub.FetchAccountAdminView(xID)
+	if err != nil {
+		t.Fatalf("[FetchAccountAdminView] unexpected error: %v", err)
+	}
+	if view.Donation != 0.5 || !view.PaymentsHeld ||
+		*view.Metadata != (AccountMetadata{}) || len(view.MetadataLog) != 0 {
+		t.Fatalf("unexpected view of legacy account settings %+v", view)
+	}
+
+	// Ensure metadata exceeding the maximum lengths and metadata of
+	// unknown accounts are refused.
+	err = hub.SetAccountMetadata(xID, &AccountMetadata{
+		Label: strings.Repeat("a", maxAccountLabelLen+1),
+	}, "admin")
+	if err == nil {
+		t.Fatal("expected an oversized label to be refused")
+	}
+	err = hub.SetAccountMetadata("unknown", &AccountMetadata{Label: "a"},
+		"admin")
+	if !IsError(err, ErrValueNotFound) {
+		t.Fatalf("expected a value not found error, got %v", err)
+	}
+
+	// Ensure metadata updates keep the other settings and audit-log the
+	// changed fields only, most recent first.
+	err = hub.SetAccountMetadata(xID, &AccountMetadata{
+		Label:   "large farm",
+		Contact: "ops@example.com",
+	}, "admin@10.0.0.1")
+	if err != nil {
+		t.Fatalf("[SetAccountMetadata] unexpected error: %v", err)
+	}
+	err = hub.SetAccountMetadata(xID, &AccountMetadata{
+		Label:   "large farm",
+		Contact: "ops@example.com",
+		Note:    "suspected duplicate of " + yID,
+	}, "admin@10.0.0.2")
+	if err != nil {
+		t.Fatalf("[SetAccountMetadata] unexpected error: %v", err)
+	}
+	err = hub.SetAccountMetadata(yID, &AccountMetadata{
+		Label: "other",
+	}, "admin@10.0.0.1")
+	if err != nil {
+		t.Fatalf("[SetAccountMetadata] unexpected error: %v", err)
+	}
+	view, err = hub.FetchAccountAdminView(xID)
+	if err != nil {
+		t.Fatalf("[FetchAccountAdminView] unexpected error: %v", err)
+	}
+	if view.Donation != 0.5 || !view.PaymentsHeld {
+		t.Fatalf("expected metadata updates to keep the account "+
+			"settings, got %+v", view)
+	}
+	want := AccountMetadata{
+		Label:   "large farm",
+		Contact: "ops@example.com",
+		Note:    "suspected duplicate of " + yID,
+	}
+	if *view.Metadata != want {
+		t.Fatalf("expected metadata %+v, got %+v", want, *view.Metadata)
+	}
+	if len(view.MetadataLog) != 3 {
+		t.Fatalf("expected 3 metadata changes, got %d",
+			len(view.MetadataLog))
+	}
+	latest := view.MetadataLog[0]
+	if latest.Field != "note" || latest.Previous != "" ||
+		latest.Value != want.Note || latest.By != "admin@10.0.0.2" ||
+		latest.On == 0 {
+		t.Fatalf("unexpected latest metadata change %+v", latest)
+	}
+	for _, change := range view.MetadataLog[1:] {
+		if change.By != "admin@10.0.0.1" || change.Account != xID {
+			t.Fatalf("unexpected metadata change %+v", change)
+		}
+	}
+
+	err = emptyBucket(db, accountSettingsBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, accountMetadataLogBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+)
+
+// apiKeySize is the size of the random api keys of accounts.
+const apiKeySize = 32
+
+// newAPIKey generates a random hex encoded api key along with the hash it
+// is stored as.
+func newAPIKey() (string, []byte, error) {
+	b := make([]byte, apiKeySize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", nil, err
+	}
+	key := hex.EncodeToString(b)
+	return key, hashAPIKey(key), nil
+}
+
+// hashAPIKey returns the hash of the provided api key. Keys are random, so
+// they are hashed without a salt.
+func hashAPIKey(key string) []byte {
+	h := sha256.Sum256([]byte(key))
+	return h[:]
+}
+
+// validAPIKey asserts the provided key is the api key of the provided hash,
+// comparing the hashes in constant time.
+func validAPIKey(hash []byte, key string) bool {
+	if len(hash) != sha256.Size {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, hashAPIKey(key)) == 1
+}
+
+// updateAPIKey replaces the api key of the provided account id with a new
+// key, returning the new key, or revokes it. A replaced key is invalid
+// immediately.
+func (h *Hub) updateAPIKey(accountID string, revoke bool) (string, error) {
+	if h.cfg.SoloPool {
+		desc := "api keys are not supported in solo pool mode"
+		return "", MakeError(ErrNotSupported, desc, nil)
+	}
+	_, err := FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return "", err
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return "", err
+	}
+	var key string
+	settings.APIKeyHash = nil
+	settings.APIKeyCreated = 0
+	if !revoke {
+		key, settings.APIKeyHash, err = newAPIKey()
+		if err != nil {
+			return "", err
+		}
+		settings.APIKeyCreated = time.Now().Unix()
+	}
+	err = persistAccountSettings(h.db, accountID, settings)
+	if err != nil {
+		return "", err
+	}
+	if revoke {
+		log.Infof("Revoked the api key of account %s", accountID)
+	} else {
+		log.Infof("Rotated the api key of account %s", accountID)
+	}
+	return key, nil
+}
+
+// SetAPIKey rotates the api key of the account of the provided address,
+// returning the new key, or revokes it. The challenge must be a recent,
+// unused api key challenge for the address, signed by its key, so a
+// replayed challenge neither rotates the key nor returns one. The key is
+// only ever returned here, the pool keeps its hash.
+func (h *Hub) SetAPIKey(address string, challenge string, signature string, revoke bool) (string, error) {
+	err := h.verifyChallenge(APIKeyAction, address, challenge, signature)
+	if err != nil {
+		return "", err
+	}
+	accountID, err := AccountID(address, h.cfg.ActiveNet)
+	if err != nil {
+		return "", err
+	}
+	return h.updateAPIKey(accountID, revoke)
+}
+
+// ResetAPIKey rotates the api key of the provided account id on behalf of
+// an admin, returning the new key, or revokes it.
+func (h *Hub) ResetAPIKey(accountID string, revoke bool) (string, error) {
+	return h.updateAPIKey(accountID, revoke)
+}
+
+// VerifyAPIKey asserts the provided key is the api key of the provided
+// account id. Failed verifications count towards the failed authorization
+// limit of the provided host, hosts banned for exceeding it are refused
+// without checking the key.
+func (h *Hub) VerifyAPIKey(accountID string, key string, host string) error {
+	if ip := net.ParseIP(host); ip != nil && h.isBanned(ip) {
+		desc := fmt.Sprintf("host %s is banned", host)
+		return MakeError(ErrUnauthorized, desc, nil)
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return err
+	}
+	if !validAPIKey(settings.APIKeyHash, key) {
+		h.recordAuthFailure(host)
+		desc := fmt.Sprintf("invalid api key for account %s", accountID)
+		return MakeError(ErrUnauthorized, desc, nil)
+	}
+	return nil
+}
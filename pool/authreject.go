@@ -0,0 +1,167 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// authRejectTTL represents the period a rejected username is refused
+	// without being parsed again.
+	authRejectTTL = time.Minute * 10
+
+	// maxAuthRejectHosts represents the maximum number of hosts rejected
+	// usernames are remembered for.
+	maxAuthRejectHosts = 1024
+
+	// maxAuthRejectsPerHost represents the maximum number of rejected
+	// usernames remembered per host.
+	maxAuthRejectsPerHost = 8
+)
+
+// AuthRejectStats represents the authorization rejection counts of the
+// pool since it started.
+type AuthRejectStats struct {
+	// Early represents the authorizations refused before any database
+	// access because of a malformed username or invalid address, including
+	// the cached rejections.
+	Early uint64
+	// Cached represents the early rejections answered from the rejected
+	// username cache.
+	Cached uint64
+	// Backend represents the authorizations that failed after accessing
+	// the database.
+	Backend uint64
+}
+
+// AuthRejectCache remembers the usernames recently refused authorization
+// for being malformed, per host, so repeated garbage authorizations are
+// refused without being parsed again. It counts early rejections
+// separately from authorization failures requiring database access. A nil
+// cache remembers and counts nothing.
+type AuthRejectCache struct {
+	early   uint64 // update atomically.
+	cached  uint64 // update atomically.
+	backend uint64 // update atomically.
+
+	hosts    map[string]map[string]time.Time
+	hostsMtx sync.Mutex
+}
+
+// NewAuthRejectCache creates a rejected username cache.
+func NewAuthRejectCache() *AuthRejectCache {
+	return &AuthRejectCache{
+		hosts: make(map[string]map[string]time.Time),
+	}
+}
+
+// rejected returns if the provided username was recently refused for the
+// provided host key, counting the rejection if so.
+func (rc *AuthRejectCache) rejected(host string, username string, now time.Time) bool {
+	if rc == nil {
+		return false
+	}
+	rc.hostsMtx.Lock()
+	expiry, ok := rc.hosts[host][username]
+	if ok && now.After(expiry) {
+		delete(rc.hosts[host], username)
+		if len(rc.hosts[host]) == 0 {
+			delete(rc.hosts, host)
+		}
+		ok = false
+	}
+	rc.hostsMtx.Unlock()
+	if ok {
+		atomic.AddUint64(&rc.early, 1)
+		atomic.AddUint64(&rc.cached, 1)
+	}
+	return ok
+}
+
+// reject remembers the provided username as refused for the provided host
+// key and counts the early rejection. Expired entries are evicted to make
+// room, the cache drops arbitrary entries once full.
+func (rc *AuthRejectCache) reject(host string, username string, now time.Time) {
+	if rc == nil {
+		return
+	}
+	atomic.AddUint64(&rc.early, 1)
+	rc.hostsMtx.Lock()
+	defer rc.hostsMtx.Unlock()
+	usernames, ok := rc.hosts[host]
+	if !ok {
+		if len(rc.hosts) >= maxAuthRejectHosts {
+			rc.evictHosts(now)
+		}
+		usernames = make(map[string]time.Time)
+		rc.hosts[host] = usernames
+	}
+	if _, ok := usernames[username]; !ok &&
+		len(usernames) >= maxAuthRejectsPerHost {
+		evictUsernames(usernames, now)
+	}
+	usernames[username] = now.Add(authRejectTTL)
+}
+
+// evictHosts removes hosts without unexpired rejected usernames, or an
+// arbitrary host if all of them have one. This must be called with the
+// hosts lock held.
+func (rc *AuthRejectCache) evictHosts(now time.Time) {
+	for host, usernames := range rc.hosts {
+		evictUsernames(usernames, now)
+		if len(usernames) == 0 {
+			delete(rc.hosts, host)
+		}
+	}
+	if len(rc.hosts) < maxAuthRejectHosts {
+		return
+	}
+	for host := range rc.hosts {
+		delete(rc.hosts, host)
+		return
+	}
+}
+
+// evictUsernames removes expired usernames from the provided rejected
+// usernames of a host, or an arbitrary username if none expired and the
+// host is at its limit.
+func evictUsernames(usernames map[string]time.Time, now time.Time) {
+	for username, expiry := range usernames {
+		if now.After(expiry) {
+			delete(usernames, username)
+		}
+	}
+	if len(usernames) < maxAuthRejectsPerHost {
+		return
+	}
+	for username := range usernames {
+		delete(usernames, username)
+		return
+	}
+}
+
+// recordBackendFailure counts an authorization that failed after accessing
+// the database.
+func (rc *AuthRejectCache) recordBackendFailure() {
+	if rc == nil {
+		return
+	}
+	atomic.AddUint64(&rc.backend, 1)
+}
+
+// Stats returns the authorization rejection counts recorded by the cache.
+func (rc *AuthRejectCache) Stats() *AuthRejectStats {
+	if rc == nil {
+		return &AuthRejectStats{}
+	}
+	return &AuthRejectStats{
+		Early:   atomic.LoadUint64(&rc.early),
+		Cached:  atomic.LoadUint64(&rc.cached),
+		Backend: atomic.LoadUint64(&rc.backend),
+	}
+}
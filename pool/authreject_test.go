@@ -0,0 +1,63 @@
+package pool
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testAuthRejectCache(t *testing.T) {
+	now := time.Now()
+	rc := NewAuthRejectCache()
+
+	// Ensure rejected usernames are remembered per host until they expire.
+	rc.reject("10.0.0.1", "garbage", now)
+	if !rc.rejected("10.0.0.1", "garbage", now) {
+		t.Fatal("expected the rejected username to be remembered")
+	}
+	if rc.rejected("10.0.0.2", "garbage", now) {
+		t.Fatal("expected the username to be remembered for its host only")
+	}
+	if rc.rejected("10.0.0.1", "other", now) {
+		t.Fatal("expected an unknown username not to be rejected")
+	}
+	if rc.rejected("10.0.0.1", "garbage", now.Add(authRejectTTL+1)) {
+		t.Fatal("expected the rejected username to expire")
+	}
+	stats := rc.Stats()
+	if stats.Early != 2 || stats.Cached != 1 || stats.Backend != 0 {
+		t.Fatalf("unexpected rejection counts %+v", stats)
+	}
+
+	// Ensure the usernames remembered per host and the hosts remembered are
+	// bounded.
+	for i := 0; i < maxAuthRejectsPerHost*2; i++ {
+		rc.reject("10.0.0.1", fmt.Sprintf("garbage%d", i), now)
+	}
+	if n := len(rc.hosts["10.0.0.1"]); n != maxAuthRejectsPerHost {
+		t.Fatalf("expected %d usernames for the host, got %d",
+			maxAuthRejectsPerHost, n)
+	}
+	if !rc.rejected("10.0.0.1", fmt.Sprintf("garbage%d",
+		maxAuthRejectsPerHost*2-1), now) {
+		t.Fatal("expected the latest rejected username to be remembered")
+	}
+	for i := 0; i < maxAuthRejectHosts*2; i++ {
+		rc.reject(fmt.Sprintf("host%d", i), "garbage", now)
+	}
+	if len(rc.hosts) != maxAuthRejectHosts {
+		t.Fatalf("expected %d hosts, got %d", maxAuthRejectHosts,
+			len(rc.hosts))
+	}
+
+	// Ensure a nil cache remembers and counts nothing.
+	var nilCache *AuthRejectCache
+	nilCache.reject("10.0.0.1", "garbage", now)
+	nilCache.recordBackendFailure()
+	if nilCache.rejected("10.0.0.1", "garbage", now) {
+		t.Fatal("expected a nil cache not to reject usernames")
+	}
+	if stats := nilCache.Stats(); *stats != (AuthRejectStats{}) {
+		t.Fatalf("expected no rejection counts, got %+v", stats)
+	}
+}
@@ -0,0 +1,512 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+const (
+	// BanAdded and BanRemoved represent the actions of ban list audit
+	// entries.
+	BanAdded   = "added"
+	BanRemoved = "removed"
+)
+
+var (
+	// banSweepInterval represents the period between removals of expired
+	// bans from the ban list.
+	banSweepInterval = time.Minute * 5
+
+	// maxBanAuditEntries represents the maximum number of ban list audit
+	// entries returned by a query.
+	maxBanAuditEntries = 100
+)
+
+// Ban represents a ban of an ip range from connecting to the pool. The
+// target is the banned range in CIDR notation, single IPv4 addresses are
+// banned as /32 ranges and single IPv6 addresses as their /64 prefix.
+// Timestamps are in nanoseconds, bans without an expiry are permanent.
+type Ban struct {
+	Target    string `json:"target"`
+	Reason    string `json:"reason"`
+	CreatedOn int64  `json:"createdon"`
+	ExpiresOn int64  `json:"expireson,omitempty"`
+	CreatedBy string `json:"createdby"`
+}
+
+// expired returns if the ban expired by the provided time in nanoseconds.
+func (b *Ban) expired(now int64) bool {
+	return b.ExpiresOn != 0 && b.ExpiresOn <= now
+}
+
+// BanAuditEntry represents the audit record of a ban added to or removed
+// from the ban list, the change time is in nanoseconds.
+type BanAuditEntry struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Reason string `json:"reason,omitempty"`
+	By     string `json:"by"`
+	On     int64  `json:"on"`
+}
+
+// parseBanTarget resolves the provided ip address or CIDR range into the
+// range it bans. IPv4-mapped addresses resolve to their IPv4 form.
+func parseBanTarget(target string) (*net.IPNet, error) {
+	target = strings.TrimSpace(target)
+	if strings.Contains(target, "/") {
+		_, ipNet, err := net.ParseCIDR(target)
+		if err != nil {
+			desc := fmt.Sprintf("invalid ip range provided: %s", target)
+			return nil, MakeError(ErrOther, desc, err)
+		}
+		ones, bits := ipNet.Mask.Size()
+		if ip4 := ipNet.IP.To4(); ip4 != nil && bits == 8*net.IPv6len {
+			if ones < 96 {
+				desc := fmt.Sprintf("invalid IPv4-mapped ip range "+
+					"provided: %s", target)
+				return nil, MakeError(ErrOther, desc, nil)
+			}
+			ipNet = &net.IPNet{IP: ip4,
+				Mask: net.CIDRMask(ones-96, 8*net.IPv4len)}
+		}
+		return ipNet, nil
+	}
+	ip := net.ParseIP(target)
+	if ip == nil {
+		desc := fmt.Sprintf("invalid ip address provided: %s", target)
+		return nil, MakeError(ErrOther, desc, nil)
+	}
+	ip = normalizeIP(ip)
+	if len(ip) == net.IPv4len {
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	mask := net.CIDRMask(64, 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+// prefixLengths tracks the distinct prefix lengths of the banned ranges
+// of an address family, longest first.
+type prefixLengths struct {
+	lengths []int
+	counts  map[int]int
+}
+
+// add tracks a banned range of the provided prefix length.
+func (p *prefixLengths) add(ones int) {
+	p.counts[ones]++
+	if p.counts[ones] > 1 {
+		return
+	}
+	p.lengths = append(p.lengths, ones)
+	sort.Sort(sort.Reverse(sort.IntSlice(p.lengths)))
+}
+
+// remove untracks a banned range of the provided prefix length.
+func (p *prefixLengths) remove(ones int) {
+	p.counts[ones]--
+	if p.counts[ones] > 0 {
+		return
+	}
+	delete(p.counts, ones)
+	for i, l := range p.lengths {
+		if l == ones {
+			p.lengths = append(p.lengths[:i], p.lengths[i+1:]...)
+			break
+		}
+	}
+}
+
+// banList represents the bans in effect, indexed by banned range. An ip is
+// matched against the ranges of every distinct prefix length banned within
+// its address family, a lookup per prefix length, so the cost of a check
+// does not grow with the number of bans.
+type banList struct {
+	bans map[string]*Ban
+	v4   prefixLengths
+	v6   prefixLengths
+	mtx  sync.RWMutex
+}
+
+// newBanList creates an empty ban list.
+func newBanList() *banList {
+	return &banList{
+		bans: make(map[string]*Ban),
+		v4:   prefixLengths{counts: make(map[int]int)},
+		v6:   prefixLengths{counts: make(map[int]int)},
+	}
+}
+
+// family returns the prefix lengths of the address family of the provided
+// range size in bits.
+func (l *banList) family(bits int) *prefixLengths {
+	if bits == 8*net.IPv4len {
+		return &l.v4
+	}
+	return &l.v6
+}
+
+// put adds or replaces the provided ban of the provided range. The ban
+// list must be locked for writes.
+func (l *banList) put(ipNet *net.IPNet, ban *Ban) {
+	if _, ok := l.bans[ban.Target]; !ok {
+		l.family(len(ipNet.IP) * 8).add(maskOnes(ipNet))
+	}
+	l.bans[ban.Target] = ban
+}
+
+// delete removes the ban of the provided range, it returns the ban
+// removed. The ban list must be locked for writes.
+func (l *banList) delete(ipNet *net.IPNet) *Ban {
+	target := ipNet.String()
+	ban, ok := l.bans[target]
+	if !ok {
+		return nil
+	}
+	delete(l.bans, target)
+	l.family(len(ipNet.IP) * 8).remove(maskOnes(ipNet))
+	return ban
+}
+
+// maskOnes returns the prefix length of the provided range.
+func maskOnes(ipNet *net.IPNet) int {
+	ones, _ := ipNet.Mask.Size()
+	return ones
+}
+
+// lookup returns the unexpired ban covering the provided ip, nil if the
+// ip is not banned. Expired bans found are removed from the list, they are
+// removed from the database by the sweeper.
+func (l *banList) lookup(ip net.IP, now int64) *Ban {
+	ip = normalizeIP(ip)
+	bits := len(ip) * 8
+	var expired []*net.IPNet
+	l.mtx.RLock()
+	var found *Ban
+	for _, ones := range l.family(bits).lengths {
+		mask := net.CIDRMask(ones, bits)
+		ipNet := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		ban, ok := l.bans[ipNet.String()]
+		if !ok {
+			continue
+		}
+		if ban.expired(now) {
+			expired = append(expired, ipNet)
+			continue
+		}
+		found = ban
+		break
+	}
+	l.mtx.RUnlock()
+	if len(expired) > 0 {
+		l.mtx.Lock()
+		for _, ipNet := range expired {
+			if ban, ok := l.bans[ipNet.String()]; ok && ban.expired(now) {
+				l.delete(ipNet)
+			}
+		}
+		l.mtx.Unlock()
+	}
+	return found
+}
+
+// list returns the unexpired bans, ordered by target.
+func (l *banList) list(now int64) []*Ban {
+	l.mtx.RLock()
+	bans := make([]*Ban, 0, len(l.bans))
+	for _, ban := range l.bans {
+		if !ban.expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	l.mtx.RUnlock()
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Target < bans[j].Target
+	})
+	return bans
+}
+
+// fetchBanBucket is a helper function for getting the ban bucket.
+func fetchBanBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(banBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(banBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// fetchBanAuditBucket is a helper function for getting the ban audit
+// bucket.
+func fetchBanAuditBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(banAuditBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(banAuditBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// banAuditKey returns the key of the provided ban audit entry. Keys are
+// prefixed by the big endian change time so entries sort by the time of
+// the change.
+func banAuditKey(entry *BanAuditEntry) []byte {
+	key := make([]byte, 8, 9+len(entry.Action)+len(entry.Target))
+	binary.BigEndian.PutUint64(key, uint64(entry.On))
+	key = append(key, entry.Action...)
+	key = append(key, '/')
+	return append(key, entry.Target...)
+}
+
+// putBanAuditEntry persists the provided ban audit entry.
+func putBanAuditEntry(tx *bolt.Tx, entry *BanAuditEntry) error {
+	bkt, err := fetchBanAuditBucket(tx)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return bkt.Put(banAuditKey(entry), b)
+}
+
+// load populates the ban list with the unexpired bans persisted to the
+// database, expired bans are removed from the database. It returns the
+// number of bans loaded.
+func (l *banList) load(db *bolt.DB, now int64) (int, error) {
+	var loaded int
+	err := db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchBanBucket(tx)
+		if err != nil {
+			return err
+		}
+		var expired [][]byte
+		err = bkt.ForEach(func(k, v []byte) error {
+			var ban Ban
+			err := json.Unmarshal(v, &ban)
+			if err != nil {
+				return err
+			}
+			if ban.expired(now) {
+				expired = append(expired, k)
+				return nil
+			}
+			ipNet, err := parseBanTarget(ban.Target)
+			if err != nil {
+				return err
+			}
+			l.mtx.Lock()
+			l.put(ipNet, &ban)
+			l.mtx.Unlock()
+			loaded++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			err := bkt.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return loaded, err
+}
+
+// add bans the provided range, replacing an existing ban of the range. The
+// ban and its audit entry are persisted in a single transaction before the
+// ban takes effect.
+func (l *banList) add(db *bolt.DB, ipNet *net.IPNet, ban *Ban) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchBanBucket(tx)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(ban)
+		if err != nil {
+			return err
+		}
+		err = bkt.Put([]byte(ban.Target), b)
+		if err != nil {
+			return err
+		}
+		return putBanAuditEntry(tx, &BanAuditEntry{
+			Action: BanAdded,
+			Target: ban.Target,
+			Reason: ban.Reason,
+			By:     ban.CreatedBy,
+			On:     ban.CreatedOn,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	l.mtx.Lock()
+	l.put(ipNet, ban)
+	l.mtx.Unlock()
+	return nil
+}
+
+// remove lifts the ban of the provided range, attributing it to the
+// provided remover. It returns the ban lifted, an error if the range is
+// not banned.
+func (l *banList) remove(db *bolt.DB, ipNet *net.IPNet, by string, now int64) (*Ban, error) {
+	target := ipNet.String()
+	l.mtx.RLock()
+	ban, ok := l.bans[target]
+	l.mtx.RUnlock()
+	if !ok || ban.expired(now) {
+		desc := fmt.Sprintf("%s is not banned", target)
+		return nil, MakeError(ErrValueNotFound, desc, nil)
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchBanBucket(tx)
+		if err != nil {
+			return err
+		}
+		err = bkt.Delete([]byte(target))
+		if err != nil {
+			return err
+		}
+		return putBanAuditEntry(tx, &BanAuditEntry{
+			Action: BanRemoved,
+			Target: target,
+			By:     by,
+			On:     now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.mtx.Lock()
+	l.delete(ipNet)
+	l.mtx.Unlock()
+	return ban, nil
+}
+
+// sweep removes the bans expired by the provided time from the list and
+// the database. It returns the number of bans removed.
+func (l *banList) sweep(db *bolt.DB, now int64) (int, error) {
+	var swept int
+	err := db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchBanBucket(tx)
+		if err != nil {
+			return err
+		}
+		var expired [][]byte
+		err = bkt.ForEach(func(k, v []byte) error {
+			var ban Ban
+			err := json.Unmarshal(v, &ban)
+			if err != nil {
+				return err
+			}
+			if ban.expired(now) {
+				expired = append(expired, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			err := bkt.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		swept = len(expired)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	l.mtx.Lock()
+	for target, ban := range l.bans {
+		if !ban.expired(now) {
+			continue
+		}
+		ipNet, err := parseBanTarget(target)
+		if err != nil {
+			continue
+		}
+		l.delete(ipNet)
+	}
+	l.mtx.Unlock()
+	return swept, nil
+}
+
+// FetchBanAuditLog fetches the most recent ban list audit entries, up to
+// the provided limit. List is ordered, most recent entry comes first.
+func FetchBanAuditLog(db *bolt.DB, limit int) ([]*BanAuditEntry, error) {
+	entries := make([]*BanAuditEntry, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchBanAuditBucket(tx)
+		if err != nil {
+			return err
+		}
+		c := bkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if limit > 0 && len(entries) >= limit {
+				break
+			}
+			var entry BanAuditEntry
+			err := json.Unmarshal(v, &entry)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, &entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// sweepBans periodically removes expired bans from the ban list.
+func (h *Hub) sweepBans(ctx context.Context) {
+	ticker := time.NewTicker(banSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			h.wg.Done()
+			return
+		case now := <-ticker.C:
+			swept, err := h.bans.sweep(h.db, now.UnixNano())
+			if err != nil {
+				log.Errorf("unable to sweep expired bans: %v", err)
+				continue
+			}
+			if swept > 0 {
+				log.Debugf("Swept %d expired ban(s)", swept)
+			}
+		}
+	}
+}
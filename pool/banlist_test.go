@@ -0,0 +1,184 @@
+package pool
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func testBanList(t *testing.T, db *bolt.DB) {
+	// Ensure ban targets resolve to their banned ranges.
+	targets := []struct {
+		target string
+		want   string
+	}{
+		{"10.0.0.1", "10.0.0.1/32"},
+		{"::ffff:10.0.0.1", "10.0.0.1/32"},
+		{"2001:db8::1", "2001:db8::/64"},
+		{"10.1.2.3/16", "10.1.0.0/16"},
+		{"::ffff:10.1.0.0/112", "10.1.0.0/16"},
+		{"2001:db8::/32", "2001:db8::/32"},
+	}
+	for _, test := range targets {
+		ipNet, err := parseBanTarget(test.target)
+		if err != nil {
+			t.Fatalf("[parseBanTarget] %s: unexpected error: %v",
+				test.target, err)
+		}
+		if ipNet.String() != test.want {
+			t.Fatalf("[parseBanTarget] %s: expected %s, got %s",
+				test.target, test.want, ipNet)
+		}
+	}
+	for _, target := range []string{"invalid", "10.0.0.0/33", "10.0.0.256"} {
+		_, err := parseBanTarget(target)
+		if err == nil {
+			t.Fatalf("[parseBanTarget] %s: expected an invalid target "+
+				"error", target)
+		}
+	}
+
+	now := time.Now().UnixNano()
+	bans := []*Ban{{
+		Target:    "10.1.0.0/16",
+		Reason:    "abuse",
+		CreatedOn: now,
+		CreatedBy: "admin",
+	}, {
+		Target:    "10.2.3.4/32",
+		CreatedOn: now,
+		ExpiresOn: now + int64(time.Hour),
+		CreatedBy: "authfailures",
+	}, {
+		Target:    "2001:db8::/32",
+		CreatedOn: now,
+		CreatedBy: "admin",
+	}, {
+		Target:    "10.3.0.0/24",
+		CreatedOn: now,
+		ExpiresOn: now + int64(time.Minute),
+		CreatedBy: "admin",
+	}}
+	list := newBanList()
+	for _, ban := range bans {
+		ipNet, err := parseBanTarget(ban.Target)
+		if err != nil {
+			t.Fatalf("[parseBanTarget] unexpected error: %v", err)
+		}
+		err = list.add(db, ipNet, ban)
+		if err != nil {
+			t.Fatalf("[add] unexpected error: %v", err)
+		}
+	}
+
+	// Ensure addresses are matched against the banned ranges of every
+	// prefix length within their address family.
+	lookups := []struct {
+		ip     string
+		banned bool
+	}{
+		{"10.1.200.7", true},
+		{"::ffff:10.1.0.1", true},
+		{"10.2.3.4", true},
+		{"10.2.3.5", false},
+		{"10.3.0.9", true},
+		{"10.4.0.1", false},
+		{"2001:db8:ffff::1", true},
+		{"2001:db9::1", false},
+	}
+	for _, test := range lookups {
+		banned := list.lookup(net.ParseIP(test.ip), now) != nil
+		if banned != test.banned {
+			t.Fatalf("[lookup] %s: expected banned %v, got %v", test.ip,
+				test.banned, banned)
+		}
+	}
+
+	// Ensure expired bans are not matched and are removed lazily.
+	later := now + int64(time.Minute*2)
+	if list.lookup(net.ParseIP("10.3.0.9"), later) != nil {
+		t.Fatal("[lookup] expected the expired ban not to match")
+	}
+	if _, ok := list.bans["10.3.0.0/24"]; ok {
+		t.Fatal("[lookup] expected the expired ban to be removed")
+	}
+	if len(list.v4.lengths) != 2 {
+		t.Fatalf("[lookup] expected 2 ipv4 prefix lengths, got %v",
+			list.v4.lengths)
+	}
+
+	// Ensure the persisted bans are loaded, skipping expired ones.
+	reloaded := newBanList()
+	n, err := reloaded.load(db, later)
+	if err != nil {
+		t.Fatalf("[load] unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("[load] expected 3 bans, got %d", n)
+	}
+	if reloaded.lookup(net.ParseIP("10.1.0.1"), later) == nil {
+		t.Fatal("[load] expected the reloaded ban to match")
+	}
+
+	// Ensure the sweeper removes expired bans from the list and database.
+	n, err = reloaded.sweep(db, now+int64(time.Hour))
+	if err != nil {
+		t.Fatalf("[sweep] unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("[sweep] expected 1 swept ban, got %d", n)
+	}
+	listed := reloaded.list(now + int64(time.Hour))
+	if len(listed) != 2 || listed[0].Target != "10.1.0.0/16" ||
+		listed[1].Target != "2001:db8::/32" {
+		t.Fatalf("[list] unexpected bans %+v", listed)
+	}
+
+	// Ensure lifting a ban removes it and lifting an unbanned range fails.
+	ipNet, err := parseBanTarget("10.1.0.0/16")
+	if err != nil {
+		t.Fatalf("[parseBanTarget] unexpected error: %v", err)
+	}
+	_, err = reloaded.remove(db, ipNet, "admin", later)
+	if err != nil {
+		t.Fatalf("[remove] unexpected error: %v", err)
+	}
+	_, err = reloaded.remove(db, ipNet, "admin", later)
+	if !IsError(err, ErrValueNotFound) {
+		t.Fatalf("[remove] expected a value not found error, got %v", err)
+	}
+	if reloaded.lookup(net.ParseIP("10.1.0.1"), later) != nil {
+		t.Fatal("[remove] expected the lifted ban not to match")
+	}
+
+	// Ensure ban list changes are audited, most recent first.
+	entries, err := FetchBanAuditLog(db, 0)
+	if err != nil {
+		t.Fatalf("[FetchBanAuditLog] unexpected error: %v", err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("[FetchBanAuditLog] expected 5 entries, got %d",
+			len(entries))
+	}
+	if entries[0].Action != BanRemoved || entries[0].Target != "10.1.0.0/16" ||
+		entries[0].By != "admin" {
+		t.Fatalf("[FetchBanAuditLog] unexpected entry %+v", entries[0])
+	}
+	entries, err = FetchBanAuditLog(db, 2)
+	if err != nil {
+		t.Fatalf("[FetchBanAuditLog] unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("[FetchBanAuditLog] expected 2 entries, got %d",
+			len(entries))
+	}
+
+	for _, bkt := range [][]byte{banBkt, banAuditBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// CaptureInbound is the direction of frames read from a client.
+	CaptureInbound = "in"
+
+	// CaptureOutbound is the direction of frames written to a client.
+	CaptureOutbound = "out"
+
+	// CaptureStoppedAdmin is the stop reason of captures stopped by an
+	// admin.
+	CaptureStoppedAdmin = "admin"
+
+	// CaptureStoppedDuration is the stop reason of captures which reached
+	// their maximum duration.
+	CaptureStoppedDuration = "duration"
+
+	// CaptureStoppedSize is the stop reason of captures which reached
+	// their maximum size.
+	CaptureStoppedSize = "size"
+
+	// CaptureStoppedShutdown is the stop reason of captures stopped by the
+	// pool shutting down.
+	CaptureStoppedShutdown = "shutdown"
+
+	// CaptureStoppedError is the stop reason of captures whose file could
+	// not be written.
+	CaptureStoppedError = "error"
+)
+
+var (
+	// captureQueueSize represents the number of frames queued for the
+	// capture writer, frames are dropped once the queue is full so
+	// capturing never blocks the client.
+	captureQueueSize = 1024
+
+	// captureRingSize represents the number of most recent frames of a
+	// capture kept in memory.
+	captureRingSize = 1000
+
+	// defaultCaptureDuration represents the default period a capture runs
+	// for before it is disabled.
+	defaultCaptureDuration = time.Minute * 30
+
+	// defaultCaptureMaxSize represents the default number of frame bytes
+	// captured before a capture is disabled.
+	defaultCaptureMaxSize = int64(10 * 1024 * 1024)
+)
+
+// CapturedFrame represents a JSON line exchanged with a client, along with
+// its direction and the time it was read or written, in nanoseconds.
+type CapturedFrame struct {
+	Direction string `json:"direction"`
+	Time      int64  `json:"time"`
+	Data      string `json:"data"`
+}
+
+// CaptureStatus represents the state of a client trace capture. Stopped
+// and Reason are unset while the capture runs.
+type CaptureStatus struct {
+	ClientID string
+	File     string
+	Started  int64
+	Stopped  int64
+	Reason   string
+	Frames   uint64
+	Bytes    int64
+	Dropped  uint64
+}
+
+// CaptureSnapshot represents the state of a client trace capture along
+// with its most recent frames, oldest frame first.
+type CaptureSnapshot struct {
+	CaptureStatus
+	Recent []*CapturedFrame
+}
+
+// FrameCapture records the frames exchanged with a client to a bounded
+// ring of recent frames and optionally a file. Frames are queued and
+// recorded asynchronously, the client is never blocked on the capture.
+type FrameCapture struct {
+	active  uint32 // update atomically.
+	dropped uint64 // update atomically.
+
+	clientID string
+	path     string
+	maxSize  int64
+	file     *os.File
+	queue    chan *CapturedFrame
+	quit     chan string
+	done     chan struct{}
+	stopOnce sync.Once
+	onStop   func()
+	ring     []*CapturedFrame
+	next     int
+	frames   uint64
+	size     int64
+	started  int64
+	stopped  int64
+	reason   string
+	mtx      sync.RWMutex
+}
+
+// record queues the provided frame of the provided direction without its
+// line delimiter, dropping it if the queue is full. The frame is copied,
+// the provided data can be reused once record returns.
+func (fc *FrameCapture) record(direction string, data []byte) {
+	if atomic.LoadUint32(&fc.active) == 0 {
+		return
+	}
+	frame := &CapturedFrame{
+		Direction: direction,
+		Time:      time.Now().UnixNano(),
+		Data:      strings.TrimSuffix(string(data), "\n"),
+	}
+	select {
+	case fc.queue <- frame:
+	default:
+		atomic.AddUint64(&fc.dropped, 1)
+	}
+}
+
+// isActive returns if the capture records frames.
+func (fc *FrameCapture) isActive() bool {
+	return atomic.LoadUint32(&fc.active) == 1
+}
+
+// write adds the provided frame to the ring of recent frames and appends
+// it to the capture file. It returns the reason the capture must stop, if
+// it must.
+func (fc *FrameCapture) write(frame *CapturedFrame) string {
+	fc.mtx.Lock()
+	if len(fc.ring) < captureRingSize {
+		fc.ring = append(fc.ring, frame)
+	} else {
+		fc.ring[fc.next] = frame
+		fc.next = (fc.next + 1) % captureRingSize
+	}
+	fc.frames++
+	fc.size += int64(len(frame.Data))
+	size := fc.size
+	fc.mtx.Unlock()
+
+	if fc.file != nil {
+		line, err := json.Marshal(frame)
+		if err != nil {
+			log.Errorf("unable to encode captured frame of %s: %v",
+				fc.clientID, err)
+			return CaptureStoppedError
+		}
+		_, err = fc.file.Write(append(line, '\n'))
+		if err != nil {
+			log.Errorf("unable to write to capture file %s: %v", fc.path, err)
+			return CaptureStoppedError
+		}
+	}
+	if fc.maxSize > 0 && size >= fc.maxSize {
+		return CaptureStoppedSize
+	}
+	return ""
+}
+
+// run records queued frames until the capture is stopped or reaches the
+// provided duration. It must be run as a goroutine.
+func (fc *FrameCapture) run(duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	var reason string
+	for reason == "" {
+		select {
+		case frame := <-fc.queue:
+			reason = fc.write(frame)
+		case <-timer.C:
+			reason = CaptureStoppedDuration
+		case reason = <-fc.quit:
+		}
+	}
+	fc.close(reason)
+}
+
+// close disables the capture, records the frames still queued and closes
+// the capture file.
+func (fc *FrameCapture) close(reason string) {
+	atomic.StoreUint32(&fc.active, 0)
+	for queued := true; queued && reason != CaptureStoppedError; {
+		select {
+		case frame := <-fc.queue:
+			if fc.write(frame) == CaptureStoppedError {
+				queued = false
+			}
+		default:
+			queued = false
+		}
+	}
+	if fc.file != nil {
+		err := fc.file.Close()
+		if err != nil {
+			log.Errorf("unable to close capture file %s: %v", fc.path, err)
+		}
+	}
+	fc.mtx.Lock()
+	fc.stopped = time.Now().UnixNano()
+	fc.reason = reason
+	frames, size := fc.frames, fc.size
+	fc.mtx.Unlock()
+	log.Infof("Stopped trace capture of %s (%s): %d frame(s), %d byte(s)",
+		fc.clientID, reason, frames, size)
+	if dropped := atomic.LoadUint64(&fc.dropped); dropped > 0 {
+		log.Warnf("%d frame(s) were dropped from the trace capture of %s",
+			dropped, fc.clientID)
+	}
+	fc.onStop()
+	close(fc.done)
+}
+
+// stop stops the capture with the provided reason and waits for the frames
+// still queued to be recorded. Stopping a stopped capture is a no-op.
+func (fc *FrameCapture) stop(reason string) {
+	fc.stopOnce.Do(func() {
+		select {
+		case fc.quit <- reason:
+		case <-fc.done:
+		}
+	})
+	<-fc.done
+}
+
+// status returns the state of the capture.
+func (fc *FrameCapture) status() *CaptureStatus {
+	fc.mtx.RLock()
+	defer fc.mtx.RUnlock()
+	return &CaptureStatus{
+		ClientID: fc.clientID,
+		File:     fc.path,
+		Started:  fc.started,
+		Stopped:  fc.stopped,
+		Reason:   fc.reason,
+		Frames:   fc.frames,
+		Bytes:    fc.size,
+		Dropped:  atomic.LoadUint64(&fc.dropped),
+	}
+}
+
+// snapshot returns the state of the capture along with the frames in its
+// ring, oldest frame first.
+func (fc *FrameCapture) snapshot() *CaptureSnapshot {
+	snapshot := &CaptureSnapshot{CaptureStatus: *fc.status()}
+	fc.mtx.RLock()
+	snapshot.Recent = make([]*CapturedFrame, 0, len(fc.ring))
+	snapshot.Recent = append(snapshot.Recent, fc.ring[fc.next:]...)
+	snapshot.Recent = append(snapshot.Recent, fc.ring[:fc.next]...)
+	fc.mtx.RUnlock()
+	return snapshot
+}
+
+// CaptureConfig represents configuration details for client trace
+// captures.
+type CaptureConfig struct {
+	// Dir represents the directory capture files are written to, empty
+	// disables capture files.
+	Dir string
+	// Duration represents the period a capture runs for before it is
+	// disabled. Zero uses the default.
+	Duration time.Duration
+	// MaxSize represents the number of frame bytes captured before a
+	// capture is disabled. Zero uses the default.
+	MaxSize int64
+}
+
+// CaptureSet tracks the trace captures of clients by client id. The most
+// recent capture of a client is kept after it stops so it can still be
+// retrieved.
+type CaptureSet struct {
+	active   int32 // update atomically.
+	cfg      *CaptureConfig
+	captures map[string]*FrameCapture
+	closed   bool
+	mtx      sync.RWMutex
+}
+
+// NewCaptureSet creates an empty capture set.
+func NewCaptureSet(cfg *CaptureConfig) *CaptureSet {
+	return &CaptureSet{
+		cfg:      cfg,
+		captures: make(map[string]*FrameCapture),
+	}
+}
+
+// captureFileName returns the name of the capture file of the provided
+// client id started at the provided time.
+func captureFileName(clientID string, started time.Time) string {
+	id := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9', r == '-':
+			return r
+		}
+		return '_'
+	}, clientID)
+	return fmt.Sprintf("capture-%s-%d.jsonl", id,
+		started.UTC().Unix())
+}
+
+// start starts a capture of the frames of the provided client id, written
+// to a capture file as well if requested. Starting a capture replaces the
+// stopped capture of the client, a running capture must be stopped first.
+func (cs *CaptureSet) start(clientID string, toFile bool) (*CaptureStatus, error) {
+	if toFile && cs.cfg.Dir == "" {
+		desc := "capture files are disabled, no capture directory is set"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	duration := cs.cfg.Duration
+	if duration <= 0 {
+		duration = defaultCaptureDuration
+	}
+	maxSize := cs.cfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultCaptureMaxSize
+	}
+
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	if cs.closed {
+		desc := "trace captures are closed"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	if current, ok := cs.captures[clientID]; ok && current.isActive() {
+		desc := fmt.Sprintf("client %s is already being captured", clientID)
+		return nil, MakeError(ErrOther, desc, nil)
+	}
+	now := time.Now()
+	fc := &FrameCapture{
+		active:   1,
+		clientID: clientID,
+		maxSize:  maxSize,
+		queue:    make(chan *CapturedFrame, captureQueueSize),
+		quit:     make(chan string),
+		done:     make(chan struct{}),
+		onStop: func() {
+			atomic.AddInt32(&cs.active, -1)
+		},
+		started: now.UnixNano(),
+	}
+	if toFile {
+		err := os.MkdirAll(cs.cfg.Dir, 0700)
+		if err != nil {
+			return nil, err
+		}
+		fc.path = filepath.Join(cs.cfg.Dir, captureFileName(clientID, now))
+		fc.file, err = os.OpenFile(fc.path,
+			os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cs.captures[clientID] = fc
+	atomic.AddInt32(&cs.active, 1)
+	go fc.run(duration)
+	log.Infof("Started trace capture of %s for at most %v or %d byte(s)",
+		clientID, duration, maxSize)
+	return fc.status(), nil
+}
+
+// stop stops the running capture of the provided client id.
+func (cs *CaptureSet) stop(clientID string) error {
+	cs.mtx.RLock()
+	fc, ok := cs.captures[clientID]
+	cs.mtx.RUnlock()
+	if !ok || !fc.isActive() {
+		desc := fmt.Sprintf("no trace capture of client %s is running",
+			clientID)
+		return MakeError(ErrValueNotFound, desc, nil)
+	}
+	fc.stop(CaptureStoppedAdmin)
+	return nil
+}
+
+// fetch returns the running capture of the provided client id, nil if it
+// is not being captured.
+func (cs *CaptureSet) fetch(clientID string) *FrameCapture {
+	if atomic.LoadInt32(&cs.active) == 0 {
+		return nil
+	}
+	cs.mtx.RLock()
+	fc := cs.captures[clientID]
+	cs.mtx.RUnlock()
+	if fc == nil || !fc.isActive() {
+		return nil
+	}
+	return fc
+}
+
+// snapshot returns the most recent capture of the provided client id along
+// with its recent frames.
+func (cs *CaptureSet) snapshot(clientID string) (*CaptureSnapshot, error) {
+	cs.mtx.RLock()
+	fc, ok := cs.captures[clientID]
+	cs.mtx.RUnlock()
+	if !ok {
+		desc := fmt.Sprintf("no trace capture of client %s found", clientID)
+		return nil, MakeError(ErrValueNotFound, desc, nil)
+	}
+	return fc.snapshot(), nil
+}
+
+// statuses returns the state of all captures, most recently started
+// capture first.
+func (cs *CaptureSet) statuses() []*CaptureStatus {
+	cs.mtx.RLock()
+	statuses := make([]*CaptureStatus, 0, len(cs.captures))
+	for _, fc := range cs.captures {
+		statuses = append(statuses, fc.status())
+	}
+	cs.mtx.RUnlock()
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Started > statuses[j].Started
+	})
+	return statuses
+}
+
+// close stops all running captures and refuses new ones.
+func (cs *CaptureSet) close() {
+	cs.mtx.Lock()
+	cs.closed = true
+	captures := make([]*FrameCapture, 0, len(cs.captures))
+	for _, fc := range cs.captures {
+		captures = append(captures, fc)
+	}
+	cs.mtx.Unlock()
+	for _, fc := range captures {
+		fc.stop(CaptureStoppedShutdown)
+	}
+}
+
+// StartCapture starts capturing every JSON line exchanged with the
+// connected client of the provided id, to a bounded ring of recent frames
+// and to a capture file if requested. The capture covers reconnections of
+// the client resuming its session and is disabled once it reaches the
+// configured duration or size.
+func (h *Hub) StartCapture(clientID string, toFile bool) (*CaptureStatus, error) {
+	if !h.registry.hasClient(clientID) {
+		desc := fmt.Sprintf("client %s is not connected", clientID)
+		return nil, MakeError(ErrValueNotFound, desc, nil)
+	}
+	return h.captures.start(clientID, toFile)
+}
+
+// StopCapture stops the running trace capture of the provided client id.
+func (h *Hub) StopCapture(clientID string) error {
+	return h.captures.stop(clientID)
+}
+
+// FetchCapture returns the most recent trace capture of the provided
+// client id along with its recent frames.
+func (h *Hub) FetchCapture(clientID string) (*CaptureSnapshot, error) {
+	return h.captures.snapshot(clientID)
+}
+
+// FetchCaptures returns the state of the trace captures of clients, most
+// recently started capture first.
+func (h *Hub) FetchCaptures() []*CaptureStatus {
+	return h.captures.statuses()
+}
@@ -0,0 +1,214 @@
+package pool
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// awaitCaptureStop waits for the provided capture to stop.
+func awaitCaptureStop(t *testing.T, fc *FrameCapture) {
+	select {
+	case <-fc.done:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("expected the trace capture of %s to stop", fc.clientID)
+	}
+}
+
+func testCaptures(t *testing.T) {
+	d, err := ioutil.TempDir("", "eacrpool_test_capture")
+	if err != nil {
+		t.Fatalf("[TempDir] unexpected error: %v", err)
+	}
+	defer os.RemoveAll(d)
+
+	// Ensure capture files are refused without a capture directory.
+	cs := NewCaptureSet(&CaptureConfig{})
+	_, err = cs.start("a/cpu", true)
+	if !IsError(err, ErrNotSupported) {
+		t.Fatalf("expected a not supported error, got %v", err)
+	}
+	if cs.fetch("a/cpu") != nil {
+		t.Fatal("expected no running capture")
+	}
+
+	// Ensure frames exchanged with a captured client are recorded in order
+	// with their direction, to the ring and the capture file.
+	cs = NewCaptureSet(&CaptureConfig{Dir: d})
+	status, err := cs.start("a/cpu", true)
+	if err != nil {
+		t.Fatalf("[start] unexpected error: %v", err)
+	}
+	if status.File == "" || filepath.Dir(status.File) != d {
+		t.Fatalf("expected a capture file in %s, got %q", d, status.File)
+	}
+	_, err = cs.start("a/cpu", false)
+	if err == nil {
+		t.Fatal("expected a running capture to not be replaced")
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c := &Client{
+		id:   "a/cpu",
+		conn: server,
+		cfg:  &ClientConfig{FetchCapture: cs.fetch},
+	}
+	other := &Client{
+		id:   "b/cpu",
+		conn: server,
+		cfg:  &ClientConfig{FetchCapture: cs.fetch},
+	}
+	inbound := `{"id":1,"method":"mining.subscribe","params":[]}` + "\r\n"
+	c.captureFrame(CaptureInbound, []byte(inbound))
+	other.captureFrame(CaptureInbound, []byte(inbound))
+	go func() {
+		_, _ = bufio.NewReader(client).ReadBytes('\n')
+	}()
+	id := uint64(1)
+	err = c.encode(NewResponse(id, true, nil))
+	if err != nil {
+		t.Fatalf("[encode] unexpected error: %v", err)
+	}
+	err = cs.stop("a/cpu")
+	if err != nil {
+		t.Fatalf("[stop] unexpected error: %v", err)
+	}
+	err = cs.stop("a/cpu")
+	if !IsError(err, ErrValueNotFound) {
+		t.Fatalf("expected a value not found error, got %v", err)
+	}
+	c.captureFrame(CaptureInbound, []byte(inbound))
+
+	snapshot, err := cs.snapshot("a/cpu")
+	if err != nil {
+		t.Fatalf("[snapshot] unexpected error: %v", err)
+	}
+	if snapshot.Reason != CaptureStoppedAdmin || snapshot.Stopped == 0 {
+		t.Fatalf("expected a capture stopped by an admin, got %+v",
+			snapshot.CaptureStatus)
+	}
+	if snapshot.Frames != 2 || len(snapshot.Recent) != 2 {
+		t.Fatalf("expected 2 captured frames, got %d", snapshot.Frames)
+	}
+	if snapshot.Recent[0].Direction != CaptureInbound ||
+		snapshot.Recent[0].Data != inbound[:len(inbound)-1] {
+		t.Fatalf("unexpected inbound frame %+v", snapshot.Recent[0])
+	}
+	if snapshot.Recent[1].Direction != CaptureOutbound ||
+		snapshot.Recent[1].Data != `{"id":1,"error":null,"result":true}` {
+		t.Fatalf("unexpected outbound frame %+v", snapshot.Recent[1])
+	}
+	if snapshot.Recent[0].Time > snapshot.Recent[1].Time {
+		t.Fatal("expected frames ordered by time")
+	}
+	_, err = cs.snapshot("b/cpu")
+	if !IsError(err, ErrValueNotFound) {
+		t.Fatalf("expected a value not found error, got %v", err)
+	}
+
+	f, err := os.Open(snapshot.File)
+	if err != nil {
+		t.Fatalf("[Open] unexpected error: %v", err)
+	}
+	var frames []*CapturedFrame
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var frame CapturedFrame
+		err := json.Unmarshal(scanner.Bytes(), &frame)
+		if err != nil {
+			t.Fatalf("[Unmarshal] unexpected error: %v", err)
+		}
+		frames = append(frames, &frame)
+	}
+	f.Close()
+	if len(frames) != 2 || *frames[0] != *snapshot.Recent[0] ||
+		*frames[1] != *snapshot.Recent[1] {
+		t.Fatalf("expected the capture file to hold the captured frames, "+
+			"got %d frame(s)", len(frames))
+	}
+
+	// Ensure the ring only keeps the most recent frames and captures are
+	// disabled once they reach their maximum size.
+	ringSize := captureRingSize
+	captureRingSize = 3
+	defer func() {
+		captureRingSize = ringSize
+	}()
+	cs = NewCaptureSet(&CaptureConfig{MaxSize: 5})
+	c.cfg.FetchCapture = cs.fetch
+	_, err = cs.start("a/cpu", false)
+	if err != nil {
+		t.Fatalf("[start] unexpected error: %v", err)
+	}
+	fc := cs.fetch("a/cpu")
+	for _, data := range []string{"1", "2", "3", "4", "5"} {
+		c.captureFrame(CaptureInbound, []byte(data))
+	}
+	awaitCaptureStop(t, fc)
+	if cs.fetch("a/cpu") != nil {
+		t.Fatal("expected the capture to be disabled")
+	}
+	snapshot, err = cs.snapshot("a/cpu")
+	if err != nil {
+		t.Fatalf("[snapshot] unexpected error: %v", err)
+	}
+	if snapshot.Reason != CaptureStoppedSize || snapshot.Bytes != 5 {
+		t.Fatalf("expected a capture stopped at 5 bytes, got %+v",
+			snapshot.CaptureStatus)
+	}
+	if len(snapshot.Recent) != 3 || snapshot.Recent[0].Data != "3" ||
+		snapshot.Recent[2].Data != "5" {
+		t.Fatalf("expected the 3 most recent frames, got %d",
+			len(snapshot.Recent))
+	}
+
+	// Ensure captures are disabled once they reach their maximum duration
+	// and stopped captures are replaced by new captures.
+	cs = NewCaptureSet(&CaptureConfig{Duration: time.Millisecond * 20})
+	_, err = cs.start("a/cpu", false)
+	if err != nil {
+		t.Fatalf("[start] unexpected error: %v", err)
+	}
+	cs.mtx.RLock()
+	fc = cs.captures["a/cpu"]
+	cs.mtx.RUnlock()
+	awaitCaptureStop(t, fc)
+	snapshot, err = cs.snapshot("a/cpu")
+	if err != nil {
+		t.Fatalf("[snapshot] unexpected error: %v", err)
+	}
+	if snapshot.Reason != CaptureStoppedDuration {
+		t.Fatalf("expected a capture stopped by its duration, got %s",
+			snapshot.Reason)
+	}
+	_, err = cs.start("a/cpu", false)
+	if err != nil {
+		t.Fatalf("[start] unexpected error: %v", err)
+	}
+
+	// Ensure closing the capture set stops running captures and refuses
+	// new ones.
+	cs.close()
+	snapshot, err = cs.snapshot("a/cpu")
+	if err != nil {
+		t.Fatalf("[snapshot] unexpected error: %v", err)
+	}
+	if snapshot.Reason != CaptureStoppedShutdown {
+		t.Fatalf("expected a capture stopped by shutdown, got %s",
+			snapshot.Reason)
+	}
+	_, err = cs.start("b/cpu", false)
+	if !IsError(err, ErrNotSupported) {
+		t.Fatalf("expected a not supported error, got %v", err)
+	}
+	if statuses := cs.statuses(); len(statuses) != 1 {
+		t.Fatalf("expected 1 capture, got %d", len(statuses))
+	}
+}
@@ -2,8 +2,12 @@ package pool
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/Eacred/eacrd/chaincfg/chainhash"
@@ -24,10 +28,37 @@ type ChainStateConfig struct {
 	// PayDividends pays mature mining rewards to participating accounts.
 	PayDividends func(uint32) error
 	// GeneratePayments creates payments for participating accounts in pool
-	// mining mode based on the configured payment scheme.
-	GeneratePayments func(uint32, dcrutil.Amount) error
+	// mining mode based on the configured payment scheme, funded by the
+	// mined block of the provided height and hash.
+	GeneratePayments func(uint32, string, dcrutil.Amount) error
 	// GetBlock fetches the block associated with the provided block hash.
 	GetBlock func(*chainhash.Hash) (*wire.MsgBlock, error)
+	// WorkSubsidy returns the proof-of-work subsidy of a block at the
+	// provided height with the provided number of voters.
+	WorkSubsidy func(uint32, uint16) dcrutil.Amount
+	// NotifyBlockFound publishes a block found event for the provided
+	// confirmed mined work and its reward.
+	NotifyBlockFound func(*AcceptedWork, dcrutil.Amount)
+	// GetBestBlock fetches the hash and height of the best block of the
+	// consensus daemon.
+	GetBestBlock func() (*chainhash.Hash, int64, error)
+	// GetBlockHash fetches the hash of the main chain block at the provided
+	// height.
+	GetBlockHash func(int64) (*chainhash.Hash, error)
+	// GetBlockHeader fetches the header of the block with the provided hash.
+	GetBlockHeader func(*chainhash.Hash) (*wire.BlockHeader, error)
+	// JobCache retains recently created jobs in memory, nil if jobs are
+	// not cached.
+	JobCache *JobCache
+	// JobRetainer caps the number of jobs retained in the database.
+	JobRetainer *JobRetainer
+	// RefreshWork fetches the current work of the consensus daemon and
+	// sends it to connected clients as a clean job.
+	RefreshWork func() error
+	// ResyncInterval represents the period between resynchronizations of
+	// the chain state with the consensus daemon, zero disables periodic
+	// resynchronization.
+	ResyncInterval time.Duration
 	// Cancel represents the pool's context cancellation function.
 	Cancel context.CancelFunc
 	// HubWg represents the hub's waitgroup.
@@ -40,23 +71,65 @@ type blockNotification struct {
 	Done   chan bool
 }
 
+// CurrentWork represents a version of the pool's current work. The sequence
+// number of each version is greater than that of all versions before it.
+type CurrentWork struct {
+	Header string
+	Height uint32
+	Seq    uint64
+}
+
 // ChainState represents the current state of the chain.
 type ChainState struct {
 	lastWorkHeight uint32 // update atomically.
+	lastWorkUpdate int64  // update atomically.
 
 	cfg            *ChainStateConfig
+	status         statusRecorder
 	connCh         chan *blockNotification
 	discCh         chan *blockNotification
-	currentWork    string
-	currentWorkMtx sync.RWMutex
+	resyncCh       chan struct{}
+	currentWork    atomic.Value // *CurrentWork, swapped atomically.
+	currentWorkMtx sync.Mutex
+	tipHash        chainhash.Hash
+	tipHeight      uint32
+	tipSet         bool
+	tipMtx         sync.RWMutex
 }
 
 // NewChainState creates a a chain state.
 func NewChainState(sCfg *ChainStateConfig) *ChainState {
 	return &ChainState{
-		cfg:    sCfg,
-		connCh: make(chan *blockNotification, bufferSize),
-		discCh: make(chan *blockNotification, bufferSize),
+		cfg:      sCfg,
+		connCh:   make(chan *blockNotification, bufferSize),
+		discCh:   make(chan *blockNotification, bufferSize),
+		resyncCh: make(chan struct{}, 1),
+	}
+}
+
+// fetchTip returns the hash and height of the last block processed by the
+// chain state, the returned bool is false if no block has been processed.
+func (cs *ChainState) fetchTip() (chainhash.Hash, uint32, bool) {
+	cs.tipMtx.RLock()
+	defer cs.tipMtx.RUnlock()
+	return cs.tipHash, cs.tipHeight, cs.tipSet
+}
+
+// setTip updates the last block processed by the chain state.
+func (cs *ChainState) setTip(hash chainhash.Hash, height uint32) {
+	cs.tipMtx.Lock()
+	cs.tipHash = hash
+	cs.tipHeight = height
+	cs.tipSet = true
+	cs.tipMtx.Unlock()
+}
+
+// requestResync signals the chain state to resynchronize with the
+// consensus daemon, requests made while one is pending are dropped.
+func (cs *ChainState) requestResync() {
+	select {
+	case cs.resyncCh <- struct{}{}:
+	default:
 	}
 }
 
@@ -70,24 +143,399 @@ func (cs *ChainState) setLastWorkHeight(height uint32) {
 	atomic.StoreUint32(&cs.lastWorkHeight, height)
 }
 
-// setCurrentWork updates the current work.
-func (cs *ChainState) setCurrentWork(headerE string) {
+// setCurrentWork updates the current work, returning the version of the
+// work created.
+func (cs *ChainState) setCurrentWork(headerE string) *CurrentWork {
+	work := &CurrentWork{Header: headerE}
+	if len(headerE) >= 264 {
+		heightD, err := hex.DecodeString(headerE[256:264])
+		if err == nil {
+			work.Height = binary.LittleEndian.Uint32(heightD)
+		}
+	}
 	cs.currentWorkMtx.Lock()
-	cs.currentWork = headerE
+	if prev := cs.fetchVersionedWork(); prev != nil {
+		work.Seq = prev.Seq + 1
+	}
+	cs.currentWork.Store(work)
 	cs.currentWorkMtx.Unlock()
+	atomic.StoreInt64(&cs.lastWorkUpdate, time.Now().UnixNano())
+	return work
+}
+
+// fetchLastWorkUpdate returns the time, in nanoseconds, the current work
+// was last updated.
+func (cs *ChainState) fetchLastWorkUpdate() int64 {
+	return atomic.LoadInt64(&cs.lastWorkUpdate)
 }
 
 // fetchCurrentWork fetches the current work.
 func (cs *ChainState) fetchCurrentWork() string {
-	cs.currentWorkMtx.RLock()
-	work := cs.currentWork
-	cs.currentWorkMtx.RUnlock()
+	work := cs.fetchVersionedWork()
+	if work == nil {
+		return ""
+	}
+	return work.Header
+}
+
+// fetchVersionedWork fetches the current work along with its height and
+// sequence number, nil if there is no current work.
+func (cs *ChainState) fetchVersionedWork() *CurrentWork {
+	work, _ := cs.currentWork.Load().(*CurrentWork)
 	return work
 }
 
+// blockFees returns the transaction fees of the provided block, which are
+// paid to the proof-of-work output of its coinbase.
+func blockFees(block *wire.MsgBlock) dcrutil.Amount {
+	var fees int64
+	txs := make([]*wire.MsgTx, 0, len(block.Transactions)+
+		len(block.STransactions))
+	if len(block.Transactions) > 0 {
+		txs = append(txs, block.Transactions[1:]...)
+	}
+	txs = append(txs, block.STransactions...)
+	for _, tx := range txs {
+		var in, out int64
+		for _, txIn := range tx.TxIn {
+			in += txIn.ValueIn
+		}
+		for _, txOut := range tx.TxOut {
+			out += txOut.Value
+		}
+		if in > out {
+			fees += in - out
+		}
+	}
+	return dcrutil.Amount(fees)
+}
+
+// distributableReward returns the amount of the reward of the provided
+// mined block paid to participating accounts. The proof-of-work output of
+// the coinbase is bounded by the provided work subsidy of the network at
+// the height of the block and the fees of the block, so a coinbase paying
+// more than the pool is entitled to never funds payments.
+func distributableReward(block *wire.MsgBlock, subsidy dcrutil.Amount) dcrutil.Amount {
+	reward := dcrutil.Amount(block.Transactions[0].TxOut[2].Value)
+	limit := subsidy + blockFees(block)
+	if reward > limit {
+		return limit
+	}
+	return reward
+}
+
+// connectBlock processes the provided connected block, paying mature
+// rewards and confirming the pool's accepted work for the block's parent.
+func (cs *ChainState) connectBlock(header *wire.BlockHeader) error {
+	err := cs.cfg.PayDividends(header.Height)
+	if err != nil {
+		log.Errorf("unable to process payments: %v", err)
+		return err
+	}
+	if header.Height > MaxReorgLimit {
+		pruneLimit := header.Height - MaxReorgLimit
+		err := PruneJobs(cs.cfg.DB, pruneLimit)
+		if err != nil {
+			log.Errorf("unable to prune jobs to height %d: %v",
+				pruneLimit, err)
+			cs.cfg.Cancel()
+			return err
+		}
+		cs.cfg.JobCache.prune(pruneLimit)
+		cs.cfg.JobRetainer.prune(pruneLimit)
+	}
+
+	// If the parent of the connected block is an accepted work of the
+	// pool, confirm it as mined. The parent of a connected block
+	// at this point is guaranteed to have its corresponding accepted
+	// work persisted if it was mined by the pool.
+	parentID := AcceptedWorkID(header.PrevBlock.String(), header.Height-1)
+	work, err := FetchAcceptedWork(cs.cfg.DB, parentID)
+	if err != nil && !IsError(err, ErrValueNotFound) {
+		log.Errorf("unable to fetch accepted work for block #%d's "+
+			"parent %s : %v", header.Height,
+			header.PrevBlock.String(), err)
+		return err
+	}
+	if work == nil {
+		cs.setTip(header.BlockHash(), header.Height)
+		return nil
+	}
+
+	// Update accepted work as confirmed mined. Pool mode replaces its
+	// estimated reward with the coinbase value of the block.
+	work.Confirmed = true
+	var block *wire.MsgBlock
+	if !cs.cfg.SoloPool {
+		block, err = cs.cfg.GetBlock(&header.PrevBlock)
+		if err != nil {
+			log.Errorf("unable to fetch block with hash %x: %v",
+				header.PrevBlock, err)
+			cs.cfg.Cancel()
+			return err
+		}
+		work.Reward = dcrutil.Amount(block.Transactions[0].TxOut[2].Value)
+		subsidy := cs.cfg.WorkSubsidy(block.Header.Height, block.Header.Voters)
+		work.Distributable = distributableReward(block, subsidy)
+		if work.Distributable < work.Reward {
+			log.Warnf("Coinbase value %v of mined block %s exceeds the work "+
+				"subsidy %v and fees, paying %v", work.Reward,
+				work.BlockHash, subsidy, work.Distributable)
+		}
+	}
+	err = work.Update(cs.cfg.DB)
+	if err != nil {
+		log.Errorf("unable to confirm accepted work for block "+
+			"%s: %v", header.PrevBlock.String(), err)
+		cs.cfg.Cancel()
+		return err
+	}
+	log.Tracef("Mined work %s confirmed by connected block #%d",
+		header.PrevBlock.String(), header.Height)
+	if header.Height > MaxReorgLimit {
+		pruneLimit := header.Height - MaxReorgLimit
+		err = PruneAcceptedWork(cs.cfg.DB, pruneLimit)
+		if err != nil {
+			log.Errorf("unable to prune accepted work below "+
+				"height #%d: %v", pruneLimit, err)
+			cs.cfg.Cancel()
+			return err
+		}
+	}
+	cs.notifyBlockFound(work, block, &header.PrevBlock)
+	if !cs.cfg.SoloPool {
+		err = cs.cfg.GeneratePayments(block.Header.Height, work.BlockHash,
+			work.Distributable)
+		if err != nil {
+			log.Errorf("unable to generate shares: %v", err)
+			cs.cfg.Cancel()
+			return err
+		}
+	}
+	cs.setTip(header.BlockHash(), header.Height)
+	return nil
+}
+
+// notifyBlockFound publishes a block found event for the provided confirmed
+// work with the coinbase value of its block, fetching the block if it is
+// not provided. The event is best-effort, it is skipped if the block is
+// unavailable.
+func (cs *ChainState) notifyBlockFound(work *AcceptedWork, block *wire.MsgBlock, hash *chainhash.Hash) {
+	if block == nil {
+		var err error
+		block, err = cs.cfg.GetBlock(hash)
+		if err != nil {
+			log.Errorf("unable to fetch block with hash %x, skipping its "+
+				"block found event: %v", hash, err)
+			return
+		}
+	}
+	reward := dcrutil.Amount(block.Transactions[0].TxOut[2].Value)
+	cs.cfg.NotifyBlockFound(work, reward)
+}
+
+// disconnectBlock processes the provided disconnected block, removing the
+// pool's mined work and pending payments associated with it.
+func (cs *ChainState) disconnectBlock(header *wire.BlockHeader) error {
+	// Delete mined work if it is disconnected from the chain. At this
+	// point a mined confirmed block will have its corresponding
+	// accepted block record persisted.
+	id := AcceptedWorkID(header.BlockHash().String(), header.Height)
+	work, err := FetchAcceptedWork(cs.cfg.DB, id)
+	if err != nil {
+		if IsError(err, ErrValueNotFound) {
+			cs.setTip(header.PrevBlock, header.Height-1)
+			return nil
+		}
+		log.Errorf("unable to fetch mined work: %v", err)
+		return err
+	}
+	err = work.Delete(cs.cfg.DB)
+	if err != nil {
+		log.Errorf("unable to delete mined work: %v", err)
+		cs.cfg.Cancel()
+		return err
+	}
+	log.Tracef("Confirmed mined work %s disconnected", header.BlockHash().String())
+	if !cs.cfg.SoloPool {
+		// If the disconnected block is an accepted work from the pool,
+		// delete all associated payments.
+		payments, err := fetchPendingPaymentsAtHeight(cs.cfg.DB,
+			header.Height)
+		if err != nil {
+			log.Errorf("failed to fetch pending payments "+
+				"at height #%d: %v", header.Height, err)
+			cs.cfg.Cancel()
+			return err
+		}
+		for _, pmt := range payments {
+			err = pmt.Delete(cs.cfg.DB)
+			if err != nil {
+				log.Errorf("unable to delete pending payment", err)
+				cs.cfg.Cancel()
+				return err
+			}
+		}
+	}
+	cs.setTip(header.PrevBlock, header.Height-1)
+	return nil
+}
+
+// isProcessed returns if the provided connected block is already reflected
+// in the chain state, which is the case for blocks replayed by a
+// resynchronization before their notification is handled.
+func (cs *ChainState) isProcessed(header *wire.BlockHeader) bool {
+	_, height, ok := cs.fetchTip()
+	return ok && header.Height <= height
+}
+
+// extendsTip returns if the provided connected block builds on the last
+// block processed by the chain state. Blocks build on the tip if no block
+// has been processed yet.
+func (cs *ChainState) extendsTip(header *wire.BlockHeader) bool {
+	hash, _, ok := cs.fetchTip()
+	return !ok || header.PrevBlock == hash
+}
+
+// isTip returns if the provided disconnected block is the last block
+// processed by the chain state. Any block is treated as the tip if no
+// block has been processed yet.
+func (cs *ChainState) isTip(header *wire.BlockHeader) bool {
+	hash, _, ok := cs.fetchTip()
+	return !ok || header.BlockHash() == hash
+}
+
+// isStaleWork returns if the current work does not build on the provided
+// best block.
+func (cs *ChainState) isStaleWork(best *chainhash.Hash) (bool, error) {
+	currWorkE := cs.fetchCurrentWork()
+	if currWorkE == "" {
+		return true, nil
+	}
+	currWorkD, err := hex.DecodeString(currWorkE[:360])
+	if err != nil {
+		desc := fmt.Sprintf("failed to decode current work %s", currWorkE)
+		return false, MakeError(ErrDecode, desc, err)
+	}
+	var header wire.BlockHeader
+	err = header.FromBytes(currWorkD)
+	if err != nil {
+		desc := fmt.Sprintf("failed to create header from bytes %s",
+			currWorkE)
+		return false, MakeError(ErrOther, desc, err)
+	}
+	return header.PrevBlock != *best, nil
+}
+
+// resync compares the best block of the consensus daemon against the last
+// block processed by the chain state and replays missed blocks in order.
+// Processed blocks no longer in the main chain are disconnected before the
+// missed main chain blocks are connected, and stale current work is
+// refreshed. The chain state starts tracking the daemon's best block if
+// no block has been processed yet.
+func (cs *ChainState) resync() error {
+	best, bestHeight, err := cs.cfg.GetBestBlock()
+	if err != nil {
+		desc := "unable to fetch best block"
+		return MakeError(ErrOther, desc, err)
+	}
+	tipHash, tipHeight, ok := cs.fetchTip()
+	if !ok {
+		cs.setTip(*best, uint32(bestHeight))
+		return nil
+	}
+	if tipHash == *best {
+		return nil
+	}
+
+	// Disconnect processed blocks that were reorganized out of the main
+	// chain while notifications were missed.
+	for disconnected := uint32(0); ; disconnected++ {
+		if int64(tipHeight) <= bestHeight {
+			hash, err := cs.cfg.GetBlockHash(int64(tipHeight))
+			if err != nil {
+				desc := fmt.Sprintf("unable to fetch block hash at "+
+					"height #%d", tipHeight)
+				return MakeError(ErrOther, desc, err)
+			}
+			if *hash == tipHash {
+				break
+			}
+		}
+		if disconnected >= MaxReorgLimit {
+			desc := fmt.Sprintf("no common ancestor with the main chain "+
+				"found within %d blocks of #%d", MaxReorgLimit, tipHeight)
+			return MakeError(ErrOther, desc, nil)
+		}
+		header, err := cs.cfg.GetBlockHeader(&tipHash)
+		if err != nil {
+			desc := fmt.Sprintf("unable to fetch block header %s", tipHash)
+			return MakeError(ErrOther, desc, err)
+		}
+		log.Infof("Resync disconnecting block #%d (%s)", header.Height,
+			tipHash)
+		err = cs.disconnectBlock(header)
+		if err != nil {
+			return err
+		}
+		tipHash, tipHeight = header.PrevBlock, header.Height-1
+	}
+
+	// Connect the missed main chain blocks in order.
+	for height := int64(tipHeight) + 1; height <= bestHeight; height++ {
+		hash, err := cs.cfg.GetBlockHash(height)
+		if err != nil {
+			desc := fmt.Sprintf("unable to fetch block hash at height "+
+				"#%d", height)
+			return MakeError(ErrOther, desc, err)
+		}
+		header, err := cs.cfg.GetBlockHeader(hash)
+		if err != nil {
+			desc := fmt.Sprintf("unable to fetch block header %s", hash)
+			return MakeError(ErrOther, desc, err)
+		}
+		log.Infof("Resync connecting missed block #%d (%s)", height, hash)
+		err = cs.connectBlock(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	stale, err := cs.isStaleWork(best)
+	if err != nil {
+		return err
+	}
+	if stale {
+		log.Infof("Current work is stale, refreshing work at best "+
+			"block #%d (%s)", bestHeight, best)
+		return cs.cfg.RefreshWork()
+	}
+	return nil
+}
+
+// handleResync resynchronizes the chain state with the consensus daemon,
+// recording the outcome.
+func (cs *ChainState) handleResync() {
+	err := cs.resync()
+	if err != nil {
+		log.Errorf("unable to resync chain state: %v", err)
+		cs.status.recordError(err)
+		return
+	}
+	cs.status.recordSuccess()
+}
+
 // handleChainUpdates processes connected and disconnected block
-// notifications from the consensus daemon.
+// notifications from the consensus daemon. Connected blocks not building
+// on the last processed block trigger a resynchronization so missed blocks
+// are processed first.
 func (cs *ChainState) handleChainUpdates(ctx context.Context) {
+	var resync <-chan time.Time
+	if cs.cfg.ResyncInterval > 0 {
+		ticker := time.NewTicker(cs.cfg.ResyncInterval)
+		defer ticker.Stop()
+		resync = ticker.C
+	}
 	for {
 		select {
 		case <-ctx.Done():
@@ -96,92 +544,42 @@ func (cs *ChainState) handleChainUpdates(ctx context.Context) {
 			cs.cfg.HubWg.Done()
 			return
 
+		case <-resync:
+			cs.handleResync()
+
+		case <-cs.resyncCh:
+			cs.handleResync()
+
 		case msg := <-cs.connCh:
 			var header wire.BlockHeader
 			err := header.FromBytes(msg.Header)
 			if err != nil {
 				log.Errorf("unable to create header from bytes: %v", err)
+				cs.status.recordError(err)
 				close(msg.Done)
 				cs.cfg.Cancel()
 				continue
 			}
-			err = cs.cfg.PayDividends(header.Height)
-			if err != nil {
-				log.Errorf("unable to process payments: %v", err)
-				close(msg.Done)
-				continue
-			}
-			if header.Height > MaxReorgLimit {
-				pruneLimit := header.Height - MaxReorgLimit
-				err := PruneJobs(cs.cfg.DB, pruneLimit)
+			if !cs.extendsTip(&header) && cs.cfg.GetBestBlock != nil {
+				log.Infof("Connected block #%d does not extend the last "+
+					"processed block, resyncing", header.Height)
+				err := cs.resync()
 				if err != nil {
-					log.Errorf("unable to prune jobs to height %d: %v",
-						pruneLimit, err)
+					log.Errorf("unable to resync chain state: %v", err)
+				}
+				if err == nil && cs.isProcessed(&header) {
+					cs.status.recordSuccess()
 					close(msg.Done)
-					cs.cfg.Cancel()
 					continue
 				}
 			}
-
-			// If the parent of the connected block is an accepted work of the
-			// pool, confirm it as mined. The parent of a connected block
-			// at this point is guaranteed to have its corresponding accepted
-			// work persisted if it was mined by the pool.
-			parentID := AcceptedWorkID(header.PrevBlock.String(), header.Height-1)
-			work, err := FetchAcceptedWork(cs.cfg.DB, parentID)
+			err = cs.connectBlock(&header)
 			if err != nil {
-				log.Errorf("unable to fetch accepted work for block #%d's "+
-					"parent %s : %v", header.Height,
-					header.PrevBlock.String(), err)
+				cs.status.recordError(err)
 				close(msg.Done)
 				continue
 			}
-			if work == nil {
-				close(msg.Done)
-				continue
-			}
-
-			// Update accepted work as confirmed mined.
-			work.Confirmed = true
-			err = work.Update(cs.cfg.DB)
-			if err != nil {
-				log.Errorf("unable to confirm accepted work for block "+
-					"%s: %v", header.PrevBlock.String(), err)
-				close(msg.Done)
-				cs.cfg.Cancel()
-				continue
-			}
-			log.Tracef("Mined work %s confirmed by connected block #%d",
-				header.PrevBlock.String(), header.Height)
-			if header.Height > MaxReorgLimit {
-				pruneLimit := header.Height - MaxReorgLimit
-				err = PruneAcceptedWork(cs.cfg.DB, pruneLimit)
-				if err != nil {
-					log.Errorf("unable to prune accepted work below "+
-						"height #%d: %v", pruneLimit, err)
-					close(msg.Done)
-					cs.cfg.Cancel()
-					continue
-				}
-			}
-			if !cs.cfg.SoloPool {
-				block, err := cs.cfg.GetBlock(&header.PrevBlock)
-				if err != nil {
-					log.Errorf("unable to fetch block with hash %x: %v",
-						header.PrevBlock, err)
-					close(msg.Done)
-					cs.cfg.Cancel()
-					continue
-				}
-				coinbase := dcrutil.Amount(block.Transactions[0].TxOut[2].Value)
-				err = cs.cfg.GeneratePayments(block.Header.Height, coinbase)
-				if err != nil {
-					log.Errorf("unable to generate shares: %v", err)
-					close(msg.Done)
-					cs.cfg.Cancel()
-					continue
-				}
-			}
+			cs.status.recordSuccess()
 			close(msg.Done)
 
 		case msg := <-cs.discCh:
@@ -189,51 +587,27 @@ func (cs *ChainState) handleChainUpdates(ctx context.Context) {
 			err := header.FromBytes(msg.Header)
 			if err != nil {
 				log.Errorf("unable to create header from bytes: %v", err)
+				cs.status.recordError(err)
 				close(msg.Done)
 				cs.cfg.Cancel()
 				continue
 			}
 
-			// Delete mined work if it is disconnected from the chain. At this
-			// point a mined confirmed block will have its corresponding
-			// accepted block record persisted.
-			id := AcceptedWorkID(header.BlockHash().String(), header.Height)
-			work, err := FetchAcceptedWork(cs.cfg.DB, id)
-			if err != nil {
-				log.Errorf("unable to fetch mined work: %v", err)
+			// Blocks already disconnected by a resynchronization are
+			// skipped.
+			if !cs.isTip(&header) {
+				log.Debugf("Skipping disconnected block #%d, it is not "+
+					"the last processed block", header.Height)
 				close(msg.Done)
 				continue
 			}
-			err = work.Delete(cs.cfg.DB)
+			err = cs.disconnectBlock(&header)
 			if err != nil {
-				log.Errorf("unable to delete mined work: %v", err)
+				cs.status.recordError(err)
 				close(msg.Done)
-				cs.cfg.Cancel()
 				continue
 			}
-			log.Tracef("Confirmed mined work %s disconnected", header.BlockHash().String())
-			if !cs.cfg.SoloPool {
-				// If the disconnected block is an accepted work from the pool,
-				// delete all associated payments.
-				payments, err := fetchPendingPaymentsAtHeight(cs.cfg.DB,
-					header.Height)
-				if err != nil {
-					log.Errorf("failed to fetch pending payments "+
-						"at height #%d: %v", header.Height, err)
-					close(msg.Done)
-					cs.cfg.Cancel()
-					continue
-				}
-				for _, pmt := range payments {
-					err = pmt.Delete(cs.cfg.DB)
-					if err != nil {
-						log.Errorf("unable to delete pending payment", err)
-						close(msg.Done)
-						cs.cfg.Cancel()
-						break
-					}
-				}
-			}
+			cs.status.recordSuccess()
 			close(msg.Done)
 		}
 	}
@@ -3,28 +3,44 @@ package pool
 import (
 	"context"
 	"encoding/hex"
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/blockchain/standalone"
+	"github.com/Eacred/eacrd/chaincfg"
 	"github.com/Eacred/eacrd/chaincfg/chainhash"
 	"github.com/Eacred/eacrd/dcrutil"
 	"github.com/Eacred/eacrd/wire"
 )
 
+// simnetWorkSubsidy returns the proof-of-work subsidy of a simnet block at
+// the provided height with the provided number of voters.
+func simnetWorkSubsidy(height uint32, voters uint16) dcrutil.Amount {
+	cache := standalone.NewSubsidyCache(chaincfg.SimNetParams())
+	return dcrutil.Amount(cache.CalcWorkSubsidy(int64(height), voters))
+}
+
 func testChainState(t *testing.T, db *bolt.DB) {
 	ctx, cancel := context.WithCancel(context.Background())
 	var minedHeader wire.BlockHeader
 	var confHeader wire.BlockHeader
+	var foundWork *AcceptedWork
+	var foundReward, generatedReward dcrutil.Amount
 	cCfg := &ChainStateConfig{
 		DB:       db,
 		SoloPool: false,
 		PayDividends: func(uint32) error {
 			return nil
 		},
-		GeneratePayments: func(uint32, dcrutil.Amount) error {
+		GeneratePayments: func(_ uint32, _ string, reward dcrutil.Amount) error {
+			generatedReward = reward
 			return nil
 		},
+		WorkSubsidy: simnetWorkSubsidy,
 		GetBlock: func(*chainhash.Hash) (*wire.MsgBlock, error) {
 			// Return a fake block.
 			coinbase := wire.NewMsgTx()
@@ -39,6 +55,10 @@ func testChainState(t *testing.T, db *bolt.DB) {
 			}
 			return block, nil
 		},
+		NotifyBlockFound: func(work *AcceptedWork, reward dcrutil.Amount) {
+			foundWork = work
+			foundReward = reward
+		},
 		Cancel: cancel,
 		HubWg:  new(sync.WaitGroup),
 	}
@@ -51,7 +71,7 @@ func testChainState(t *testing.T, db *bolt.DB) {
 	work := NewAcceptedWork(
 		"00007979602e13db87f6c760bbf27c137f4112b9e1988724bd245fb0bb7d1283",
 		"00006fb4ee4609e90196cfa41df2f1129a64553f935f21e6940b38e7e26e7dff",
-		42, xID, CPU)
+		42, xID, CPU, 50)
 	err := work.Create(cs.cfg.DB)
 	if err != nil {
 		t.Fatalf("unable to persist accepted work %v", err)
@@ -139,6 +159,25 @@ func testChainState(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected accepted work to be confirmed " +
 			"after chain notifications")
 	}
+	if confirmedWork.Reward != dcrutil.Amount(100) {
+		t.Fatalf("expected the confirmed work reward to be the coinbase "+
+			"value of %v, got %v", dcrutil.Amount(100), confirmedWork.Reward)
+	}
+	if confirmedWork.Distributable != dcrutil.Amount(100) ||
+		generatedReward != dcrutil.Amount(100) {
+		t.Fatalf("expected payments funded by the coinbase value of %v, "+
+			"got %v", dcrutil.Amount(100), generatedReward)
+	}
+
+	// Ensure a block found event was published for the confirmed work.
+	if foundWork == nil || foundWork.UUID != work.UUID {
+		t.Fatalf("expected a block found event for accepted work %s",
+			work.UUID)
+	}
+	if foundReward != dcrutil.Amount(100) {
+		t.Fatalf("expected a block found reward of %v, got %v",
+			dcrutil.Amount(100), foundReward)
+	}
 
 	discConfMsg := &blockNotification{
 		Header: confHeaderB,
@@ -159,6 +198,60 @@ func testChainState(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected a value not found error")
 	}
 
+	// Ensure solo pool work is confirmed without its block and its block
+	// found event is skipped when the block is unavailable.
+	cs.cfg.SoloPool = true
+	cs.cfg.GetBlock = func(*chainhash.Hash) (*wire.MsgBlock, error) {
+		return nil, fmt.Errorf("block unavailable")
+	}
+	foundWork = nil
+	err = work.Create(cs.cfg.DB)
+	if err != nil {
+		t.Fatalf("unable to persist accepted work %v", err)
+	}
+	minedMsg = &blockNotification{
+		Header: minedHeaderB,
+		Done:   make(chan bool),
+	}
+	cs.connCh <- minedMsg
+	<-minedMsg.Done
+	confMsg = &blockNotification{
+		Header: confHeaderB,
+		Done:   make(chan bool),
+	}
+	cs.connCh <- confMsg
+	<-confMsg.Done
+	confirmedWork, err = FetchAcceptedWork(cs.cfg.DB, []byte(work.UUID))
+	if err != nil {
+		t.Fatalf("unable to confirm accepted work: %v", err)
+	}
+	if !confirmedWork.Confirmed {
+		t.Fatalf("expected solo pool accepted work to be confirmed " +
+			"after chain notifications")
+	}
+	if foundWork != nil {
+		t.Fatal("expected no block found event without the block")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected the unavailable block to not cancel the pool")
+	}
+	discConfMsg = &blockNotification{
+		Header: confHeaderB,
+		Done:   make(chan bool),
+	}
+	cs.discCh <- discConfMsg
+	<-discConfMsg.Done
+	discMinedMsg = &blockNotification{
+		Header: minedHeaderB,
+		Done:   make(chan bool),
+	}
+	cs.discCh <- discMinedMsg
+	<-discMinedMsg.Done
+	_, err = FetchAcceptedWork(cs.cfg.DB, []byte(work.UUID))
+	if err == nil {
+		t.Fatalf("expected a value not found error")
+	}
+
 	// Ensure the last work height can be updated.
 	initialLastWorkHeight := cs.fetchLastWorkHeight()
 	updatedLastWorkHeight := uint32(100)
@@ -184,3 +277,331 @@ func testChainState(t *testing.T, db *bolt.DB) {
 	cancel()
 	cs.cfg.HubWg.Wait()
 }
+
+func testChainStateResync(t *testing.T, db *bolt.DB) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The simulated daemon chain, keyed by height, along with all blocks it
+	// has seen keyed by hash.
+	var chainMtx sync.Mutex
+	mainChain := make(map[uint32]*wire.BlockHeader)
+	headers := make(map[chainhash.Hash]*wire.BlockHeader)
+	var bestHeight uint32
+	extend := func(from uint32, to uint32, nonce uint32) {
+		chainMtx.Lock()
+		defer chainMtx.Unlock()
+		for height := from; height <= to; height++ {
+			header := &wire.BlockHeader{
+				Height: height,
+				Nonce:  nonce,
+			}
+			if parent, ok := mainChain[height-1]; ok {
+				header.PrevBlock = parent.BlockHash()
+			}
+			mainChain[height] = header
+			headers[header.BlockHash()] = header
+		}
+		for height := range mainChain {
+			if height > to {
+				delete(mainChain, height)
+			}
+		}
+		bestHeight = to
+	}
+	blockAt := func(height uint32) *wire.BlockHeader {
+		chainMtx.Lock()
+		defer chainMtx.Unlock()
+		return mainChain[height]
+	}
+
+	var paid []uint32
+	var generated []uint32
+	var refreshes int
+	cCfg := &ChainStateConfig{
+		DB:       db,
+		SoloPool: false,
+		PayDividends: func(height uint32) error {
+			paid = append(paid, height)
+			return nil
+		},
+		GeneratePayments: func(height uint32, _ string, _ dcrutil.Amount) error {
+			generated = append(generated, height)
+			return nil
+		},
+		WorkSubsidy: simnetWorkSubsidy,
+		GetBlock: func(hash *chainhash.Hash) (*wire.MsgBlock, error) {
+			coinbase := wire.NewMsgTx()
+			coinbase.AddTxOut(wire.NewTxOut(0, []byte{}))
+			coinbase.AddTxOut(wire.NewTxOut(1, []byte{}))
+			coinbase.AddTxOut(wire.NewTxOut(100, []byte{}))
+			chainMtx.Lock()
+			header := headers[*hash]
+			chainMtx.Unlock()
+			return &wire.MsgBlock{
+				Header:       *header,
+				Transactions: []*wire.MsgTx{coinbase},
+			}, nil
+		},
+		NotifyBlockFound: func(*AcceptedWork, dcrutil.Amount) {},
+		GetBestBlock: func() (*chainhash.Hash, int64, error) {
+			chainMtx.Lock()
+			defer chainMtx.Unlock()
+			hash := mainChain[bestHeight].BlockHash()
+			return &hash, int64(bestHeight), nil
+		},
+		GetBlockHash: func(height int64) (*chainhash.Hash, error) {
+			chainMtx.Lock()
+			defer chainMtx.Unlock()
+			header, ok := mainChain[uint32(height)]
+			if !ok {
+				return nil, fmt.Errorf("no block at height %d", height)
+			}
+			hash := header.BlockHash()
+			return &hash, nil
+		},
+		GetBlockHeader: func(hash *chainhash.Hash) (*wire.BlockHeader, error) {
+			chainMtx.Lock()
+			defer chainMtx.Unlock()
+			header, ok := headers[*hash]
+			if !ok {
+				return nil, fmt.Errorf("unknown block %s", hash)
+			}
+			return header, nil
+		},
+		RefreshWork: func() error {
+			refreshes++
+			return nil
+		},
+		Cancel: cancel,
+		HubWg:  new(sync.WaitGroup),
+	}
+	cs := NewChainState(cCfg)
+	cCfg.HubWg.Add(1)
+	go cs.handleChainUpdates(ctx)
+
+	// resync requests a resynchronization and waits for it to complete
+	// by queueing a notification for a block already processed once the
+	// request is picked up.
+	resync := func() {
+		cs.requestResync()
+		for len(cs.resyncCh) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		header := blockAt(1)
+		headerB, err := header.Bytes()
+		if err != nil {
+			t.Fatalf("unexpected serialization error: %v", err)
+		}
+		msg := &blockNotification{Header: headerB, Done: make(chan bool)}
+		cs.discCh <- msg
+		<-msg.Done
+	}
+	notify := func(ch chan *blockNotification, header *wire.BlockHeader) {
+		headerB, err := header.Bytes()
+		if err != nil {
+			t.Fatalf("unexpected serialization error: %v", err)
+		}
+		msg := &blockNotification{Header: headerB, Done: make(chan bool)}
+		ch <- msg
+		<-msg.Done
+	}
+	assertTip := func(height uint32) {
+		hash, tipHeight, ok := cs.fetchTip()
+		if !ok || tipHeight != height || hash != blockAt(height).BlockHash() {
+			t.Fatalf("expected the chain state tip to be block #%d, got "+
+				"#%d (%s)", height, tipHeight, hash)
+		}
+	}
+	assertHeights := func(desc string, got []uint32, expected ...uint32) {
+		if len(got) != len(expected) {
+			t.Fatalf("expected %s at heights %v, got %v", desc, expected, got)
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Fatalf("expected %s at heights %v, got %v", desc,
+					expected, got)
+			}
+		}
+	}
+
+	// Ensure the first resync starts tracking the daemon's best block
+	// without replaying any blocks.
+	extend(1, 10, 0)
+	cs.requestResync()
+	deadline := time.Now().Add(time.Second * 2)
+	for {
+		_, _, ok := cs.fetchTip()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the chain state to track the best block")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	assertTip(10)
+	if len(paid) != 0 || refreshes != 0 {
+		t.Fatalf("expected no replayed blocks, got payments at %v", paid)
+	}
+
+	// Ensure missed blocks are replayed in order, confirming mined work
+	// and refreshing stale work.
+	extend(11, 13, 0)
+	mined := blockAt(11)
+	work := NewAcceptedWork(mined.BlockHash().String(),
+		mined.PrevBlock.String(), 11, xID, CPU, 50)
+	err := work.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	resync()
+	assertTip(13)
+	assertHeights("dividend payments", paid, 11, 12, 13)
+	assertHeights("generated payments", generated, 11)
+	confirmed, err := FetchAcceptedWork(db, []byte(work.UUID))
+	if err != nil {
+		t.Fatalf("[FetchAcceptedWork] unexpected error: %v", err)
+	}
+	if !confirmed.Confirmed {
+		t.Fatal("expected replayed blocks to confirm the mined work")
+	}
+	if refreshes != 1 {
+		t.Fatalf("expected stale work to be refreshed once, got %d",
+			refreshes)
+	}
+
+	// Ensure current work building on the best block is not refreshed.
+	current := &wire.BlockHeader{PrevBlock: blockAt(13).BlockHash()}
+	currentB, err := current.Bytes()
+	if err != nil {
+		t.Fatalf("unexpected serialization error: %v", err)
+	}
+	cs.setCurrentWork(hex.EncodeToString(currentB) +
+		strings.Repeat("0", 360-len(currentB)*2))
+	extend(14, 14, 0)
+	notify(cs.connCh, blockAt(14))
+	current.PrevBlock = blockAt(14).BlockHash()
+	currentB, _ = current.Bytes()
+	cs.setCurrentWork(hex.EncodeToString(currentB) +
+		strings.Repeat("0", 360-len(currentB)*2))
+	resync()
+	if refreshes != 1 {
+		t.Fatalf("expected current work not to be refreshed, got %d "+
+			"refreshes", refreshes)
+	}
+
+	// Ensure a resync crossing a reorg disconnects the orphaned blocks,
+	// removing their mined work, before connecting the new main chain.
+	orphaned := blockAt(13)
+	orphanedWork := NewAcceptedWork(orphaned.BlockHash().String(),
+		orphaned.PrevBlock.String(), 13, xID, CPU, 50)
+	err = orphanedWork.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	paid = nil
+	extend(13, 15, 1)
+	resync()
+	assertTip(15)
+	assertHeights("dividend payments", paid, 13, 14, 15)
+	_, err = FetchAcceptedWork(db, []byte(orphanedWork.UUID))
+	if !IsError(err, ErrValueNotFound) {
+		t.Fatalf("expected orphaned mined work to be removed, got %v", err)
+	}
+	if refreshes != 2 {
+		t.Fatalf("expected stale work to be refreshed, got %d refreshes",
+			refreshes)
+	}
+
+	// Ensure notifications of blocks already handled by a resync are
+	// skipped.
+	paid = nil
+	notify(cs.discCh, orphaned)
+	notify(cs.connCh, blockAt(15))
+	assertTip(15)
+	if len(paid) != 0 {
+		t.Fatalf("expected no payments for handled blocks, got %v", paid)
+	}
+
+	// Ensure a connected block not extending the tip triggers a resync
+	// replaying the missed blocks first.
+	extend(16, 18, 1)
+	notify(cs.connCh, blockAt(18))
+	assertTip(18)
+	assertHeights("dividend payments", paid, 16, 17, 18)
+
+	cancel()
+	cs.cfg.HubWg.Wait()
+
+	err = emptyBucket(db, workBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+}
+
+func testDistributableReward(t *testing.T) {
+	params := chaincfg.SimNetParams()
+	interval := uint32(params.SubsidyReductionInterval)
+	before := simnetWorkSubsidy(interval-1, 0)
+	after := simnetWorkSubsidy(interval, 0)
+	if after >= before {
+		t.Fatalf("expected the work subsidy to be reduced at height %d, "+
+			"got %v before and %v after", interval, before, after)
+	}
+
+	// mined returns a block at the provided height paying the provided
+	// proof-of-work output with a transaction paying the provided fee.
+	mined := func(height uint32, pow int64, fee int64) *wire.MsgBlock {
+		coinbase := wire.NewMsgTx()
+		coinbase.AddTxOut(wire.NewTxOut(0, []byte{}))
+		coinbase.AddTxOut(wire.NewTxOut(0, []byte{}))
+		coinbase.AddTxOut(wire.NewTxOut(pow, []byte{}))
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, 1000+fee, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, []byte{}))
+		return &wire.MsgBlock{
+			Header:       wire.BlockHeader{Height: height},
+			Transactions: []*wire.MsgTx{coinbase, tx},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		height uint32
+		pow    int64
+		fee    int64
+		want   dcrutil.Amount
+	}{{
+		name:   "full reward before the reduction",
+		height: interval - 1,
+		pow:    int64(before) + 50,
+		fee:    50,
+		want:   before + 50,
+	}, {
+		name:   "full reward after the reduction",
+		height: interval,
+		pow:    int64(after) + 50,
+		fee:    50,
+		want:   after + 50,
+	}, {
+		name:   "pre-reduction reward after the reduction",
+		height: interval,
+		pow:    int64(before) + 50,
+		fee:    50,
+		want:   after + 50,
+	}, {
+		name:   "reward below the subsidy",
+		height: interval,
+		pow:    int64(after) - 50,
+		want:   after - 50,
+	}}
+	for _, test := range tests {
+		block := mined(test.height, test.pow, test.fee)
+		subsidy := simnetWorkSubsidy(block.Header.Height, block.Header.Voters)
+		got := distributableReward(block, subsidy)
+		if got != test.want {
+			t.Fatalf("%s: expected a distributable reward of %v, got %v",
+				test.name, test.want, got)
+		}
+	}
+}
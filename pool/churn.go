@@ -0,0 +1,173 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxConnFailureSamples represents the number of recent connection failures
+// retained per endpoint.
+const maxConnFailureSamples = 32
+
+// ConnFailure identifies why a connection to an endpoint failed before its
+// client was authorized.
+type ConnFailure uint32
+
+// The causes of connection failures.
+const (
+	// ConnClosedBeforeSubscribe indicates a connection closed before its
+	// client subscribed.
+	ConnClosedBeforeSubscribe ConnFailure = iota
+
+	// ConnClosedBeforeAuthorize indicates a connection closed after its
+	// client subscribed but before it was authorized.
+	ConnClosedBeforeAuthorize
+
+	// ConnTLSHandshake indicates a failed TLS handshake. It is only
+	// recorded by endpoints terminating TLS.
+	ConnTLSHandshake
+
+	// ConnProxyHeader indicates a missing or malformed PROXY protocol
+	// header. It is only recorded by endpoints behind a proxy.
+	ConnProxyHeader
+
+	// ConnAtCapacity indicates a connection rejected because the endpoint
+	// was at capacity.
+	ConnAtCapacity
+
+	// ConnHostLimit indicates a connection rejected because its host
+	// reached the maximum connections allowed per host.
+	ConnHostLimit
+
+	// numConnFailures is the number of connection failure causes.
+	numConnFailures
+)
+
+// String returns the name of the connection failure.
+func (f ConnFailure) String() string {
+	switch f {
+	case ConnClosedBeforeSubscribe:
+		return "beforesubscribe"
+	case ConnClosedBeforeAuthorize:
+		return "beforeauthorize"
+	case ConnTLSHandshake:
+		return "tlshandshake"
+	case ConnProxyHeader:
+		return "proxyheader"
+	case ConnAtCapacity:
+		return "atcapacity"
+	case ConnHostLimit:
+		return "hostlimit"
+	default:
+		return fmt.Sprintf("ConnFailure(%d)", uint32(f))
+	}
+}
+
+// ConnFailureSample represents a recent connection failure of an endpoint.
+type ConnFailureSample struct {
+	IP     string
+	Reason string
+	Time   int64
+}
+
+// EndpointChurn represents the accepted connections and connection
+// failures of a miner endpoint since the pool started, failures are keyed
+// by cause. Recent lists the latest failures, most recent first.
+type EndpointChurn struct {
+	Miner    string
+	Port     uint32
+	Accepted uint64
+	Failures map[string]uint64
+	Recent   []*ConnFailureSample
+}
+
+// connChurn tracks the accepted connections and connection failures of an
+// endpoint. Counters are updated atomically, only failures take the lock
+// guarding the recent samples so the client read loop is never involved.
+type connChurn struct {
+	accepted uint64                  // update atomically.
+	failures [numConnFailures]uint64 // update atomically.
+
+	samples [maxConnFailureSamples]*ConnFailureSample
+	next    int
+	mtx     sync.Mutex
+}
+
+// recordAccepted counts an accepted connection.
+func (c *connChurn) recordAccepted() {
+	atomic.AddUint64(&c.accepted, 1)
+}
+
+// recordFailure counts a connection failure of the provided cause for the
+// provided ip and retains it as a recent sample.
+func (c *connChurn) recordFailure(ip string, f ConnFailure) {
+	atomic.AddUint64(&c.failures[f], 1)
+	sample := &ConnFailureSample{
+		IP:     ip,
+		Reason: f.String(),
+		Time:   time.Now().Unix(),
+	}
+	c.mtx.Lock()
+	c.samples[c.next] = sample
+	c.next = (c.next + 1) % maxConnFailureSamples
+	c.mtx.Unlock()
+}
+
+// counts returns the accepted connections and the connection failures
+// keyed by cause.
+func (c *connChurn) counts() (uint64, map[string]uint64) {
+	failures := make(map[string]uint64, numConnFailures)
+	for f := ConnFailure(0); f < numConnFailures; f++ {
+		failures[f.String()] = atomic.LoadUint64(&c.failures[f])
+	}
+	return atomic.LoadUint64(&c.accepted), failures
+}
+
+// recent returns the retained connection failures, most recent first.
+func (c *connChurn) recent() []*ConnFailureSample {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	samples := make([]*ConnFailureSample, 0, maxConnFailureSamples)
+	for i := 1; i <= maxConnFailureSamples; i++ {
+		idx := (c.next - i + maxConnFailureSamples) % maxConnFailureSamples
+		if c.samples[idx] == nil {
+			break
+		}
+		samples = append(samples, c.samples[idx])
+	}
+	return samples
+}
+
+// recordClosed counts the provided disconnected client as a connection
+// failure if it closed before it was authorized. Clients disconnected by
+// a shutdown are not counted.
+func (e *Endpoint) recordClosed(c *Client, reason DisconnectReason) {
+	if reason == DisconnectShutdown {
+		return
+	}
+	switch {
+	case !c.isSubscribed():
+		e.churn.recordFailure(c.addr.IP.String(), ConnClosedBeforeSubscribe)
+	case !c.isAuthorized():
+		e.churn.recordFailure(c.addr.IP.String(), ConnClosedBeforeAuthorize)
+	}
+}
+
+// fetchChurn returns the accepted connections, connection failures and
+// recent connection failures of the endpoint.
+func (e *Endpoint) fetchChurn() *EndpointChurn {
+	accepted, failures := e.churn.counts()
+	return &EndpointChurn{
+		Miner:    e.miner,
+		Port:     e.port,
+		Accepted: accepted,
+		Failures: failures,
+		Recent:   e.churn.recent(),
+	}
+}
@@ -0,0 +1,44 @@
+package pool
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testConnChurn(t *testing.T) {
+	var churn connChurn
+	for i := 0; i < 5; i++ {
+		churn.recordAccepted()
+	}
+	for i := 0; i < maxConnFailureSamples+2; i++ {
+		churn.recordFailure(fmt.Sprintf("10.0.0.%d", i), ConnAtCapacity)
+	}
+	churn.recordFailure("10.0.1.1", ConnClosedBeforeAuthorize)
+
+	// Ensure all connections and failures are counted by cause.
+	accepted, failures := churn.counts()
+	if accepted != 5 || failures[ConnAtCapacity.String()] !=
+		maxConnFailureSamples+2 ||
+		failures[ConnClosedBeforeAuthorize.String()] != 1 ||
+		failures[ConnTLSHandshake.String()] != 0 ||
+		len(failures) != int(numConnFailures) {
+		t.Fatalf("unexpected churn counts %d %v", accepted, failures)
+	}
+
+	// Ensure only the most recent failures are retained, most recent
+	// first.
+	recent := churn.recent()
+	if len(recent) != maxConnFailureSamples {
+		t.Fatalf("expected %d recent failures, got %d",
+			maxConnFailureSamples, len(recent))
+	}
+	if recent[0].IP != "10.0.1.1" ||
+		recent[0].Reason != ConnClosedBeforeAuthorize.String() {
+		t.Fatalf("unexpected most recent failure %+v", recent[0])
+	}
+	last := recent[len(recent)-1]
+	if last.IP != "10.0.0.3" {
+		t.Fatalf("expected the oldest retained failure to be of "+
+			"10.0.0.3, got %s", last.IP)
+	}
+}
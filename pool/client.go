@@ -13,7 +13,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
+	"math"
 	"math/big"
 	"net"
 	"strings"
@@ -25,17 +25,29 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/Eacred/eacrd/blockchain/standalone"
 	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
 	"github.com/Eacred/eacrd/wire"
+	"github.com/Eacred/slog"
 )
 
 const (
-	// MaxMessageSize represents the maximum size of a transmitted message
-	// allowed, in bytes.
-	MaxMessageSize = 250
+	// MaxReadMessageSize represents the default maximum size of a message
+	// read from a client, in bytes. It accommodates subscribe requests of
+	// miners reporting long user agents and session ids.
+	MaxReadMessageSize = 1024
+
+	// MaxWriteMessageSize represents the default maximum size of a message
+	// written to a client, in bytes. It accommodates work notifications
+	// with long generation transaction segments.
+	MaxWriteMessageSize = 2048
 
 	// hashCalcThreshold represents the minimum operating time in seconds
 	// before a client's hash rate is calculated.
 	hashCalcThreshold = 20
+
+	// MaxInstanceBits represents the maximum number of leading extraNonce1
+	// bits reserved for the instance id of pools sharing a nonce space.
+	MaxInstanceBits = 8
 )
 
 var (
@@ -44,13 +56,74 @@ var (
 
 	// ZeroRat is the default value for a big.Rat.
 	ZeroRat = new(big.Rat).SetInt64(0)
+
+	// disconnectTimeout represents the period a disconnected client is
+	// given to receive its disconnect message before its connection is
+	// forcibly closed.
+	disconnectTimeout = time.Second * 5
+
+	// maxBudgetViolations represents the number of consecutive messages
+	// exceeding the in-flight budget after which a client is disconnected.
+	maxBudgetViolations = 10
+
+	// maxProtocolErrors represents the number of malformed responses after
+	// which a client is disconnected.
+	maxProtocolErrors uint32 = 3
+
+	// pendingRequestTimeout represents the period the response to a
+	// request sent to a client is awaited for. Responses arriving later are
+	// dropped.
+	pendingRequestTimeout = time.Second * 30
+
+	// readTimeout represents the period a client may send nothing for
+	// before it is disconnected.
+	readTimeout = time.Minute * 4
+
+	// sendBufferSize represents the number of messages queued for delivery
+	// to a client before queueing further messages waits on the send loop
+	// of the client. It lets request handlers queue their responses and
+	// notifications without waiting on writes to the client.
+	sendBufferSize = 128
+
+	// dropRateThreshold represents the ratio of dropped messages to work
+	// notifications offered to a client above which a drop rate warning
+	// is published for the client.
+	dropRateThreshold = 0.1
+
+	// minDropRateSamples represents the number of work notifications a
+	// client must be offered before its drop rate is evaluated.
+	minDropRateSamples int64 = 20
+
+	// maxPooledReadBuffer represents the maximum capacity of read buffers
+	// returned to the read buffer pool, larger buffers are discarded.
+	maxPooledReadBuffer = MaxReadMessageSize * 4
+
+	// readBufferPool pools the buffers messages read from clients are
+	// assembled in.
+	readBufferPool = sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, MaxReadMessageSize))
+		},
+	}
 )
 
+// putReadBuffer returns the provided read buffer to the read buffer pool.
+func putReadBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledReadBuffer {
+		return
+	}
+	buf.Reset()
+	readBufferPool.Put(buf)
+}
+
 // readPayload is a convenience type that wraps a message and its
-// associated type.
+// associated type. Submissions carry a snapshot of the client's difficulty
+// when they were received. A payload without a message is a difficulty
+// change, carrying the updated difficulty.
 type readPayload struct {
-	msg     Message
-	msgType int
+	msg      Message
+	msgType  int
+	diffInfo *DifficultyInfo
 }
 
 type ClientConfig struct {
@@ -67,368 +140,1530 @@ type ClientConfig struct {
 	NonceIterations float64
 	// Miner returns the endpoint miner type.
 	FetchMiner func() string
-	// DifficultyInfo represents the difficulty info for the client.
+	// DifficultyInfo represents the initial difficulty info for the client.
 	DifficultyInfo *DifficultyInfo
-	// EndpointWg is the waitgroup of the client's endpoint.
-	EndpointWg *sync.WaitGroup
+	// RegisterClient records the client as running with the hub's client
+	// registry, it returns false if the client must not run because the
+	// pool is shutting down.
+	RegisterClient func(*Client) bool
+	// DeregisterClient removes the client from the hub's client registry.
+	DeregisterClient func(*Client)
 	// RemoveClient removes the client from the pool.
 	RemoveClient func(*Client)
-	// SubmitWork sends solved block data to the consensus daemon.
-	SubmitWork func(*string) (bool, error)
-	// FetchCurrentWork returns the current work of the pool.
-	FetchCurrentWork func() string
-	// WithinLimit returns if the client is still within its request limits.
-	WithinLimit func(string, int) bool
+	// SubmitWork sends solved block data to the consensus daemon, returning
+	// the daemon's reason for rejected submissions when provided.
+	SubmitWork func(*string) (bool, string, error)
+	// FetchCurrentWork returns the current work of the pool, nil if there
+	// is none.
+	FetchCurrentWork func() *CurrentWork
+	// WithinLimit returns if the client is still within its request limits
+	// of the provided request class, the submission limit is scaled to the
+	// provided expected share rate.
+	WithinLimit func(string, int, float64) bool
 	// HashCalcThreshold represents the minimum operating time in seconds
 	// before a client's hash rate is calculated.
 	HashCalcThreshold uint32
+	// MinNotifyInterval represents the minimum interval between non-clean
+	// work notifications sent to the client.
+	MinNotifyInterval time.Duration
+	// WriteTimeout represents the duration a message write to the client
+	// can block for before the client is disconnected, zero for no timeout.
+	WriteTimeout time.Duration
+	// MaxReadSize represents the maximum size of a message read from the
+	// client in bytes, zero for the default. The client is disconnected
+	// once a message exceeds it.
+	MaxReadSize uint32
+	// MaxWriteSize represents the maximum size of a message written to the
+	// client in bytes, zero for the default. Messages exceeding it are
+	// dropped.
+	MaxWriteSize uint32
+	// MaxInFlight represents the maximum number of unprocessed messages
+	// allowed for the client, zero for no limit.
+	MaxInFlight uint32
+	// StaleJobWindow represents the number of blocks below the current
+	// height, inclusive, work for superseded chain tips is still accepted
+	// for, zero to reject all of it.
+	StaleJobWindow uint32
+	// StaleGracePeriod represents the period after a clean job
+	// notification work for the job notified before it is credited as late
+	// instead of rejected as stale, zero disables the grace period.
+	StaleGracePeriod time.Duration
+	// Events represents the hub's event bus client lifecycle and share
+	// events are published on.
+	Events *EventBus
+	// FetchMinerPolicy returns the policy applied to the client's miner
+	// type.
+	FetchMinerPolicy func() string
+	// WorkSubsidy returns the proof-of-work subsidy of a block at the
+	// provided height with the provided number of voters.
+	WorkSubsidy func(uint32, uint16) dcrutil.Amount
+	// NotifyBlockAccepted publishes a block accepted event for the
+	// provided work submitted by the client with the provided id.
+	NotifyBlockAccepted func(string, *AcceptedWork)
+	// NotifyBlockLost publishes a block lost event for the provided block
+	// candidate submitted by the client with the provided id.
+	NotifyBlockLost func(string, *LostBlock)
+	// IsTraced returns if logging of the provided client id or account is
+	// elevated to trace level.
+	IsTraced func(string, string) bool
+	// FetchCapture returns the running trace capture of the provided
+	// client id, nil if it is not being captured.
+	FetchCapture func(string) *FrameCapture
+	// RecordAuthFailure records a failed authorization of a locked
+	// account by the provided host key.
+	RecordAuthFailure func(string)
+	// Sessions reserves client extraNonce1s and keeps the sessions of
+	// disconnected clients for resumption.
+	Sessions *SessionStore
+	// AuthRejects refuses usernames recently rejected for being malformed
+	// and counts authorization rejections, nil if disabled.
+	AuthRejects *AuthRejectCache
+	// SubmitLatency records the stage latencies of work submissions, nil
+	// if latency metrics are disabled.
+	SubmitLatency *LatencyRecorder
+	// InitialWorkDelay represents the delay between a client completing
+	// its handshake and it being sent its initial work, zero for no delay.
+	InitialWorkDelay time.Duration
+	// InstanceID represents the id of the pool instance, it occupies the
+	// leading InstanceBits bits of every extraNonce1 assigned.
+	InstanceID uint32
+	// InstanceBits represents the number of leading extraNonce1 bits
+	// reserved for the instance id, zero if the nonce space is not shared.
+	InstanceBits uint32
+	// IsPaused returns if the client's endpoint is paused. Paused clients
+	// are not notified of work and their submissions are refused.
+	IsPaused func() bool
+	// MaxWorkerNameLength represents the maximum length of worker names,
+	// zero for the default.
+	MaxWorkerNameLength uint32
+	// StrictWorkerNames represents if authorizations with worker names
+	// containing disallowed characters or exceeding the maximum length are
+	// refused instead of having their worker names sanitized.
+	StrictWorkerNames bool
+	// DefaultWorkerNames assigns names to workers authorizing without one.
+	DefaultWorkerNames *DefaultWorkerNames
+	// FastPath represents if shares of trusted clients are validated on the
+	// fast path, using cached jobs and without computing difficulties.
+	FastPath bool
+	// SpotCheckRate represents the fraction of the shares of trusted
+	// clients that are fully validated.
+	SpotCheckRate float64
+	// MaxClockSkew represents the median difference between the timestamps
+	// of the client's shares and the pool's clock beyond which its miner
+	// is advised to synchronize its clock, zero disables the advice.
+	MaxClockSkew time.Duration
+	// JobCache retains recently created jobs in memory, nil if jobs are
+	// not cached.
+	JobCache *JobCache
+	// JobRetainer caps the number of jobs retained in the database, jobs
+	// evicted while submissions for them may be in flight remain
+	// resolvable through it. Jobs are not capped if it is nil.
+	JobRetainer *JobRetainer
+	// FetchWorkerShares returns the number of accepted and rejected shares
+	// recorded for the provided account's worker with the provided name.
+	FetchWorkerShares func(string, string) (uint64, uint64)
+	// SetAccountOptions applies the provided options to the provided
+	// account and returns the options in effect, nil if the set option
+	// extension is disabled.
+	SetAccountOptions func(string, *AccountOptions) (*AccountOptions, error)
+	// NotifyAccountCollision alerts the pool operator of the provided
+	// address refused for deriving the account id of another address.
+	NotifyAccountCollision func(*AccountCollision)
 }
 
 // Client represents a client connection.
 type Client struct {
-	submissions int64 // update atomically.
+	submissions     int64        // update atomically.
+	coalesced       int64        // update atomically.
+	overBudget      int64        // update atomically.
+	dropped         int64        // update atomically.
+	offered         int64        // update atomically.
+	writeFailures   int64        // update atomically.
+	dropWarned      uint32       // update atomically.
+	rejected        int64        // update atomically.
+	accepted        int64        // update atomically.
+	late            int64        // update atomically.
+	fastShares      int64        // update atomically.
+	stableShares    uint64       // update atomically.
+	historyAccepted uint64       // update atomically.
+	historyRejected uint64       // update atomically.
+	fastPathFlagged uint32       // update atomically.
+	protocolErrors  uint32       // update atomically.
+	keepAliveRTT    int64        // update atomically.
+	skewNotified    uint32       // update atomically.
+	version         atomic.Value // string, swapped atomically.
+	inFlight        int32        // update atomically.
+	initialWork     uint32       // update atomically.
+	teardown        uint32       // update atomically.
+	diffInfo        atomic.Value // *DifficultyInfo, swapped atomically.
 
 	id            string
+	connectedOn   int64
+	identity      string
+	identityMtx   sync.RWMutex
 	addr          *net.TCPAddr
 	cfg           *ClientConfig
 	conn          net.Conn
-	encoder       *json.Encoder
 	reader        *bufio.Reader
 	ctx           context.Context
 	cancel        context.CancelFunc
 	name          string
+	username      string
+	notifyID      string
 	extraNonce1   string
+	idNonce       string
+	resumed       *session
+	defaultName   bool
+	verified      bool
 	ch            chan Message
 	readCh        chan readPayload
-	req           map[uint64]string
-	reqMtx        sync.RWMutex
+	readMtx       sync.Mutex
+	disconnectCh  chan string
+	work          *Request
+	workSeq       uint64
+	workQueued    bool
+	workMtx       sync.Mutex
+	workCh        chan struct{}
+	req           map[uint64]*pendingRequest
+	reqID         uint64
+	reqMtx        sync.Mutex
+	respIDs       map[uint64]json.RawMessage
+	respIDsMtx    sync.Mutex
 	account       string
+	address       string
 	authorized    bool
 	authorizedMtx sync.Mutex
 	subscribed    bool
 	subscribedMtx sync.Mutex
 	hashRate      *big.Rat
 	hashRateMtx   sync.RWMutex
+	skew          clockSkew
+	logger        *clientLogger
 	wg            sync.WaitGroup
+	shutdownOnce  sync.Once
+
+	// extraNonce2Size represents the extraNonce2 size granted to the
+	// client when it subscribed.
+	extraNonce2Size int
+
+	// lastJob represents the job last notified to the client, graceJob
+	// the job notified before the last clean job notification and
+	// graceUntil the end of its stale grace period.
+	lastJob    string
+	graceJob   string
+	graceUntil time.Time
+	graceMtx   sync.Mutex
+}
+
+// ValidateInstanceID asserts the provided instance id fits the provided
+// number of reserved extraNonce1 bits.
+func ValidateInstanceID(instanceID uint32, bits uint32) error {
+	if bits > MaxInstanceBits {
+		desc := fmt.Sprintf("instance bits of %d exceed the maximum of %d",
+			bits, MaxInstanceBits)
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	if uint64(instanceID) >= uint64(1)<<bits {
+		desc := fmt.Sprintf("instance id %d does not fit in %d bits",
+			instanceID, bits)
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	return nil
+}
+
+// partitionExtraNonce1 replaces the leading bits of the provided 4-byte
+// extraNonce1 with the provided instance id, confining it to the
+// subspace of the instance.
+func partitionExtraNonce1(id []byte, instanceID uint32, bits uint32) {
+	if bits == 0 {
+		return
+	}
+	shift := 32 - bits
+	value := binary.BigEndian.Uint32(id)
+	value = value&(1<<shift-1) | instanceID<<shift
+	binary.BigEndian.PutUint32(id, value)
 }
 
 // generateExtraNonce1 generates a random 4-byte extraNonce1
-// for the client.
+// for the client within the nonce subspace of the pool instance, reserving
+// it so no other client is assigned the same extraNonce1.
 func (c *Client) generateExtraNonce1() error {
 	id := make([]byte, 4)
-	_, err := rand.Read(id)
-	if err != nil {
-		return err
+	for {
+		_, err := rand.Read(id)
+		if err != nil {
+			return err
+		}
+		partitionExtraNonce1(id, c.cfg.InstanceID, c.cfg.InstanceBits)
+		extraNonce1 := hex.EncodeToString(id)
+		if c.cfg.Sessions.reserve(extraNonce1) {
+			c.extraNonce1 = extraNonce1
+			return nil
+		}
 	}
-	c.extraNonce1 = hex.EncodeToString(id)
-	return nil
 }
 
 // NewClient creates client connection instance.
 func NewClient(conn net.Conn, addr *net.TCPAddr, cCfg *ClientConfig) (*Client, error) {
 	ctx, cancel := context.WithCancel(context.TODO())
 	c := &Client{
-		addr:     addr,
-		cfg:      cCfg,
-		conn:     conn,
-		ctx:      ctx,
-		cancel:   cancel,
-		ch:       make(chan Message),
-		readCh:   make(chan readPayload),
-		encoder:  json.NewEncoder(conn),
-		reader:   bufio.NewReaderSize(conn, MaxMessageSize),
-		hashRate: ZeroRat,
+		addr:         addr,
+		connectedOn:  time.Now().UnixNano(),
+		cfg:          cCfg,
+		conn:         conn,
+		ctx:          ctx,
+		cancel:       cancel,
+		ch:           make(chan Message, sendBufferSize),
+		readCh:       make(chan readPayload, cCfg.MaxInFlight),
+		disconnectCh: make(chan string, 1),
+		workCh:       make(chan struct{}, 1),
+		req:          make(map[uint64]*pendingRequest),
+		respIDs:      make(map[uint64]json.RawMessage),
+		reader:       bufio.NewReaderSize(conn, MaxReadMessageSize),
+		hashRate:     ZeroRat,
+
+		extraNonce2Size: ExtraNonce2Size,
 	}
 	err := c.generateExtraNonce1()
 	if err != nil {
 		return nil, err
 	}
+	c.idNonce = c.extraNonce1
 	c.id = fmt.Sprintf("%v/%v", c.extraNonce1, c.cfg.FetchMiner())
+	c.identity = c.id
+	c.logger = newClientLogger(c.id, c.cfg.FetchMiner(), addr.IP.String(),
+		c.cfg.IsTraced)
+	c.setDifficultyInfo(cCfg.DifficultyInfo)
 	return c, nil
 }
 
-// fetchStratumMethod fetches the method of the associated request.
-func (c *Client) fetchStratumMethod(id uint64) string {
-	c.reqMtx.RLock()
-	method := c.req[id]
-	c.reqMtx.RUnlock()
-	return method
+// shortAddress abbreviates the provided address for display.
+func shortAddress(address string) string {
+	if len(address) <= 12 {
+		return address
+	}
+	return address[:6] + "..." + address[len(address)-4:]
+}
+
+// setIdentity updates the identity of an authorized client to include its
+// shortened address and worker name. The identity is presentation-only,
+// the client id remains the key of the client in the endpoint's registry.
+func (c *Client) setIdentity() {
+	parts := []string{c.extraNonce1, c.cfg.FetchMiner()}
+	if c.address != "" {
+		parts = append(parts, shortAddress(c.address))
+	}
+	parts = append(parts, c.name)
+	identity := strings.Join(parts, "/")
+	c.identityMtx.Lock()
+	c.identity = identity
+	c.identityMtx.Unlock()
+	c.logger.setAccount(identity, c.account, c.name)
+}
+
+// fetchIdentity returns the presentation identity of the client.
+func (c *Client) fetchIdentity() string {
+	c.identityMtx.RLock()
+	defer c.identityMtx.RUnlock()
+	return c.identity
+}
+
+// pendingRequest represents a request sent to the client awaiting its
+// response.
+type pendingRequest struct {
+	method string
+	sent   time.Time
+}
+
+// responseHandlers process the responses to requests sent to clients by
+// request method, returning an error for malformed responses. The provided
+// duration is the round trip time of the request.
+var responseHandlers = map[string]func(*Client, *Response, time.Duration) error{
+	GetVersion: (*Client).handleGetVersionResponse,
+	Ping:       (*Client).handlePingResponse,
+}
+
+// sendRequest queues the request created by the provided constructor with
+// the next request id to the client, and records it as pending until its
+// response arrives or the pending request timeout elapses. Expired pending
+// requests are discarded. It returns the id of the request.
+func (c *Client) sendRequest(newRequest func(*uint64) *Request) uint64 {
+	now := time.Now()
+	c.reqMtx.Lock()
+	for id, pending := range c.req {
+		if now.Sub(pending.sent) >= pendingRequestTimeout {
+			delete(c.req, id)
+		}
+	}
+	c.reqID++
+	id := c.reqID
+	req := newRequest(&id)
+	c.req[id] = &pendingRequest{method: req.Method, sent: now}
+	c.reqMtx.Unlock()
+	c.queueMessage(req)
+	return id
+}
+
+// fetchStratumMethod fetches and clears the method of the pending request
+// with the provided id, along with the time it was sent. An empty method
+// is returned if there is no such request or its response is late.
+func (c *Client) fetchStratumMethod(id uint64) (string, time.Time) {
+	c.reqMtx.Lock()
+	pending, ok := c.req[id]
+	delete(c.req, id)
+	c.reqMtx.Unlock()
+	if !ok || time.Since(pending.sent) >= pendingRequestTimeout {
+		return "", time.Time{}
+	}
+	return pending.method, pending.sent
+}
+
+// handleResponse dispatches the provided response to the handler of the
+// method of the request it answers. Unmatched, late and unexpected
+// responses are dropped, malformed responses count towards the protocol
+// error limit of the client.
+func (c *Client) handleResponse(resp *Response) {
+	method, sent := c.fetchStratumMethod(resp.ID)
+	if method == "" {
+		c.logger.Errorf("no pending request found for response with "+
+			"id: %d", resp.ID)
+		if c.logger.enabled(slog.LevelTrace) {
+			c.logger.Tracef("unmatched response: %s", spew.Sdump(resp))
+		}
+		return
+	}
+	handler, ok := responseHandlers[method]
+	if !ok {
+		c.logger.Errorf("unknown request method for response: %s", method)
+		return
+	}
+	err := handler(c, resp, time.Since(sent))
+	if err != nil {
+		c.logger.Errorf("malformed %s response from %s: %v", method,
+			c.fetchIdentity(), err)
+		c.recordProtocolError()
+	}
+}
+
+// recordProtocolError counts a malformed message of the client, the client
+// is disconnected once the protocol error limit is reached.
+func (c *Client) recordProtocolError() {
+	if atomic.AddUint32(&c.protocolErrors, 1) >= maxProtocolErrors {
+		c.logger.Errorf("%s reached the limit of %d protocol errors",
+			c.fetchIdentity(), maxProtocolErrors)
+		c.cancelWithReason(DisconnectProtocolError)
+	}
+}
+
+// handleGetVersionResponse records the mining software version reported by
+// the client. Clients not supporting version requests answer with an
+// error, which is not a protocol error.
+func (c *Client) handleGetVersionResponse(resp *Response, rtt time.Duration) error {
+	version, sErr, err := ParseGetVersionResponse(resp)
+	if err != nil {
+		return err
+	}
+	if sErr != nil {
+		c.logger.Debugf("%s did not report its version: %v",
+			c.fetchIdentity(), sErr)
+		return nil
+	}
+	c.version.Store(version)
+	return nil
+}
+
+// handlePingResponse records the round trip time of the keepalive request
+// answered by the client.
+func (c *Client) handlePingResponse(resp *Response, rtt time.Duration) error {
+	sErr, err := ParsePingResponse(resp)
+	if err != nil {
+		return err
+	}
+	if sErr != nil {
+		c.logger.Debugf("%s refused a keepalive request: %v",
+			c.fetchIdentity(), sErr)
+		return nil
+	}
+	atomic.StoreInt64(&c.keepAliveRTT, int64(rtt))
+	return nil
+}
+
+// fetchVersion returns the mining software version reported by the client,
+// empty if it has not reported one.
+func (c *Client) fetchVersion() string {
+	version, _ := c.version.Load().(string)
+	return version
+}
+
+// setResponseID records the provided raw id as the id the response to the
+// request with the provided canonical id is sent with. A nil raw id
+// suppresses the response.
+func (c *Client) setResponseID(id uint64, rawID json.RawMessage) {
+	c.respIDsMtx.Lock()
+	c.respIDs[id] = rawID
+	c.respIDsMtx.Unlock()
+}
+
+// takeResponseID removes and returns the raw id recorded for the response
+// with the provided canonical id, along with whether one was recorded.
+func (c *Client) takeResponseID(id uint64) (json.RawMessage, bool) {
+	c.respIDsMtx.Lock()
+	rawID, ok := c.respIDs[id]
+	delete(c.respIDs, id)
+	c.respIDsMtx.Unlock()
+	return rawID, ok
 }
 
 // shutdown terminates all client processes and established connections.
+// It is safe to call more than once, the client is only cleaned up once
+// and deregistered on every call since a forcibly cleaned up client can
+// still register afterwards.
 func (c *Client) shutdown() {
+	c.shutdownOnce.Do(c.cleanup)
+	c.cfg.DeregisterClient(c)
+}
+
+// cleanup closes the client's connection, removes it from its endpoint and
+// suspends or releases its session.
+func (c *Client) cleanup() {
+	c.cancel()
+	c.conn.Close()
 	c.cfg.RemoveClient(c)
-	log.Tracef("%s connection terminated.", c.id)
+
+	// Keep the session of subscribed clients for resumption when they
+	// reconnect, the extraNonce1 the client id is derived from is released
+	// if the client resumed another.
+	switch c.isSubscribed() {
+	case true:
+		c.cfg.Sessions.suspend(c.notifyID, &session{
+			extraNonce1: c.extraNonce1,
+			miner:       c.cfg.FetchMiner(),
+			username:    c.username,
+			account:     c.account,
+			address:     c.address,
+			name:        c.name,
+			defaultName: c.defaultName,
+			counters: sessionCounters{
+				coalesced:     atomic.LoadInt64(&c.coalesced),
+				dropped:       atomic.LoadInt64(&c.dropped),
+				offered:       atomic.LoadInt64(&c.offered),
+				writeFailures: atomic.LoadInt64(&c.writeFailures),
+			},
+		})
+	case false:
+		c.cfg.Sessions.release(c.extraNonce1)
+	}
+	if c.idNonce != c.extraNonce1 {
+		c.cfg.Sessions.release(c.idNonce)
+	}
+	c.cfg.DefaultWorkerNames.release(c.id)
+	c.logger.Tracef("%s connection terminated (%s).", c.fetchIdentity(),
+		c.disconnectReason())
 }
 
-// claimWeightedShare records a weighted share for the pool client. This
-// serves as proof of verifiable work contributed to the mining pool.
-func (c *Client) claimWeightedShare() error {
-	if c.cfg.ActiveNet.Name == chaincfg.MainNetParams().Name && c.cfg.FetchMiner() == CPU {
-		log.Error("cpu miners are reserved for only simnet testing purposes")
+// cancelWithReason cancels the client, recording the provided reason as the
+// cause of its teardown unless a cause was recorded before.
+func (c *Client) cancelWithReason(reason DisconnectReason) {
+	atomic.CompareAndSwapUint32(&c.teardown, uint32(DisconnectUnknown),
+		uint32(reason))
+	c.cancel()
+}
+
+// disconnectReason returns the recorded cause of the client's teardown.
+func (c *Client) disconnectReason() DisconnectReason {
+	return DisconnectReason(atomic.LoadUint32(&c.teardown))
+}
+
+// publishEvent publishes an event of the provided kind concerning the
+// client on the hub's event bus.
+func (c *Client) publishEvent(kind EventKind, reason string) {
+	c.cfg.Events.publish(c.newEvent(kind, reason))
+}
+
+// publishShareEvent publishes a share event of the provided kind for work
+// submitted for the provided job on the hub's event bus, along with the
+// current share difficulty of the client. Accepted shares credited under
+// the stale grace period are flagged late.
+func (c *Client) publishShareEvent(kind EventKind, reason string, jobID string, late bool) {
+	switch kind {
+	case EventShareAccepted:
+		atomic.AddInt64(&c.accepted, 1)
+		if late {
+			atomic.AddInt64(&c.late, 1)
+		}
+	case EventShareRejected:
+		atomic.AddInt64(&c.rejected, 1)
+	}
+	event := c.newEvent(kind, reason)
+	event.JobID = jobID
+	event.Late = late
+	event.Difficulty, _ = c.fetchDifficultyInfo().difficulty.Float64()
+	c.cfg.Events.publish(event)
+}
+
+// newEvent creates an event of the provided kind concerning the client.
+func (c *Client) newEvent(kind EventKind, reason string) *HubEvent {
+	return &HubEvent{
+		Kind:     kind,
+		ClientID: c.id,
+		Miner:    c.cfg.FetchMiner(),
+		IP:       c.addr.IP.String(),
+		Account:  c.account,
+		Worker:   c.name,
+		Reason:   reason,
+	}
+}
+
+// connectionRecord returns the audit record of the client's connection,
+// ending now for the provided teardown reason.
+func (c *Client) connectionRecord(reason string) *ConnectionRecord {
+	return &ConnectionRecord{
+		ClientID:       c.id,
+		IP:             c.addr.IP.String(),
+		Miner:          c.cfg.FetchMiner(),
+		Account:        c.account,
+		Worker:         c.name,
+		ConnectedOn:    c.connectedOn,
+		DisconnectedOn: time.Now().UnixNano(),
+		Accepted:       atomic.LoadInt64(&c.accepted),
+		Rejected:       atomic.LoadInt64(&c.rejected),
+		Coalesced:      atomic.LoadInt64(&c.coalesced),
+		Dropped:        atomic.LoadInt64(&c.dropped),
+		WriteFailures:  atomic.LoadInt64(&c.writeFailures),
+		Reason:         reason,
+	}
+}
+
+// recordDropped counts a message or work notification dropped instead of
+// being delivered to the client. A drop rate warning is logged and
+// published once the client's drop rate crosses the drop rate threshold.
+func (c *Client) recordDropped() {
+	dropped := atomic.AddInt64(&c.dropped, 1)
+	offered := atomic.LoadInt64(&c.offered)
+	if offered < minDropRateSamples {
+		return
+	}
+	rate := float64(dropped) / float64(offered)
+	if rate < dropRateThreshold {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&c.dropWarned, 0, 1) {
+		return
+	}
+	reason := fmt.Sprintf("dropped %d messages for %d work notifications",
+		dropped, offered)
+	c.logger.Warnf("%s: %s", c.fetchIdentity(), reason)
+	c.publishEvent(EventClientDropRate, reason)
+}
+
+// recordOffered counts a work notification offered to the client. The drop
+// rate warning of the client is rearmed once its drop rate falls below the
+// drop rate threshold.
+func (c *Client) recordOffered() {
+	offered := atomic.AddInt64(&c.offered, 1)
+	if atomic.LoadUint32(&c.dropWarned) == 0 {
+		return
+	}
+	rate := float64(atomic.LoadInt64(&c.dropped)) / float64(offered)
+	if rate < dropRateThreshold {
+		atomic.StoreUint32(&c.dropWarned, 0)
+	}
+}
+
+// recordWriteFailure counts a failed write to the client and cancels the
+// client.
+func (c *Client) recordWriteFailure(err error) {
+	atomic.AddInt64(&c.writeFailures, 1)
+	c.logger.Errorf("message encoding error: %v", err)
+	c.cancelWithReason(DisconnectWriteFailure)
+}
+
+// isPaused returns if the client's endpoint is paused.
+func (c *Client) isPaused() bool {
+	return c.cfg.IsPaused != nil && c.cfg.IsPaused()
+}
+
+// queueMessage queues the provided message for delivery to the client.
+// Messages are buffered so request handlers do not wait on writes to the
+// client and messages queued before new work is signaled are flushed ahead
+// of it. Messages queued after the client is disconnected are dropped.
+func (c *Client) queueMessage(msg Message) {
+	select {
+	case c.ch <- msg:
+	case <-c.ctx.Done():
+	}
+}
+
+// disconnect terminates the client connection, the client is sent the
+// provided reason before being disconnected if it is not empty. The
+// connection is forcibly closed if the client does not disconnect within
+// the disconnect timeout.
+func (c *Client) disconnect(reason string) {
+	select {
+	case c.disconnectCh <- reason:
+	default:
+	}
+	time.AfterFunc(disconnectTimeout, func() {
+		c.cancelWithReason(DisconnectByPool)
+		c.conn.Close()
+	})
+}
+
+// claimWeightedShare records a weighted share for the pool client, scaled by
+// the provided difficulty multiplier. This serves as proof of verifiable work
+// contributed to the mining pool. No share is recorded for miner types
+// accepted without reward. Shares credited under the stale grace period are
+// flagged late.
+func (c *Client) claimWeightedShare(multiplier *big.Rat, late bool) error {
+	if c.cfg.FetchMinerPolicy() == PolicyNoReward {
+		c.logger.Tracef("%s miners are not rewarded, no share claimed for %s",
+			c.cfg.FetchMiner(), c.fetchIdentity())
 		return nil
 	}
-	weight := ShareWeights[c.cfg.FetchMiner()]
+	weight := new(big.Rat).Mul(ShareWeights[c.cfg.FetchMiner()], multiplier)
 	share := NewShare(c.account, weight)
+	share.Late = late
 	return share.Create(c.cfg.DB)
 }
 
 // handleAuthorizeRequest processes authorize request messages received.
 func (c *Client) handleAuthorizeRequest(req *Request, allowed bool) {
 	if !allowed {
-		log.Errorf("unable to process authorize request, limit reached")
-		err := NewStratumError(Unknown, nil)
+		c.logger.Errorf("unable to process authorize request, limit reached")
+		err := NewStratumError(RateLimited, nil)
 		resp := AuthorizeResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.queueMessage(resp)
+		return
+	}
+
+	// Answer repeated authorizations without re-running account creation,
+	// a connection stays bound to the worker it was first authorized for.
+	if c.isAuthorized() {
+		username, _, err := ParseAuthorizeRequest(req)
+		if err != nil {
+			c.logger.Errorf("unable to parse authorize request: %v", err)
+			err := NewStratumError(InvalidRequest, nil)
+			resp := AuthorizeResponse(*req.ID, false, err)
+			c.queueMessage(resp)
+			return
+		}
+		if username != c.username {
+			c.logger.Errorf("unable to authorize %s as %s, already "+
+				"authorized as %s", c.fetchIdentity(), username, c.username)
+			err := NewStratumError(UnauthorizedWorker, nil)
+			resp := AuthorizeResponse(*req.ID, false, err)
+			c.queueMessage(resp)
+			return
+		}
+		resp := AuthorizeResponse(*req.ID, true, nil)
+		c.queueMessage(resp)
+		return
+	}
+
+	// Refuse miner types rejected by the pool up front.
+	if c.cfg.FetchMinerPolicy() == PolicyReject {
+		c.logger.Errorf("unable to authorize %s, %s miners are not accepted",
+			c.fetchIdentity(), c.cfg.FetchMiner())
+		err := NewStratumError(MinerRejected, nil)
+		resp := AuthorizeResponse(*req.ID, false, err)
+		c.queueMessage(resp)
 		return
 	}
 
 	// The client's username is expected to be of the format address.clientid
 	// when in pool mining mode. For solo pool mode the username expected is
-	// just the client's id.
-	username, err := ParseAuthorizeRequest(req)
+	// just the client's id, or address.clientid to have mined blocks
+	// attributed to the address.
+	username, password, err := ParseAuthorizeRequest(req)
 	if err != nil {
-		log.Errorf("unable to parse authorize request: %v", err)
-		err := NewStratumError(Unknown, nil)
+		c.logger.Errorf("unable to parse authorize request: %v", err)
+		err := NewStratumError(InvalidRequest, nil)
 		resp := AuthorizeResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
 
-	switch c.cfg.SoloPool {
-	case false:
-		parts := strings.Split(username, ".")
-		if len(parts) != 2 {
-			log.Errorf("invalid username format, expected "+
-				"`address.clientid`, got %v", username)
-			err := NewStratumError(Unknown, nil)
+	// Clients resuming a session skip account lookups when re-authorizing
+	// as the worker of the session.
+	resumed := c.resumed != nil && c.resumed.username != "" &&
+		c.resumed.username == username
+
+	switch {
+	case resumed:
+		// Resumed sessions do not carry the verification of the account,
+		// workers of locked accounts are required to provide a valid
+		// authorization token again.
+		var verified bool
+		if !c.cfg.SoloPool {
+			var ok bool
+			verified, ok = c.verifyAccountLock(*req.ID, c.resumed.account,
+				username, password)
+			if !ok {
+				return
+			}
+		}
+		c.account = c.resumed.account
+		c.address = c.resumed.address
+		c.name = c.resumed.name
+		c.verified = verified
+
+		// Resumed default worker names are reassigned if another worker
+		// of the account was assigned the name in the meantime.
+		if c.resumed.defaultName {
+			c.defaultName = c.cfg.DefaultWorkerNames.reserve(c.account,
+				c.name, c.id)
+			if !c.defaultName {
+				c.name = ""
+			}
+		}
+
+	case !c.cfg.SoloPool:
+		// Refuse malformed usernames and invalid addresses before any
+		// database access, usernames recently refused for the host are
+		// refused without being parsed again.
+		host := hostKey(c.addr.IP)
+		now := time.Now()
+		if c.cfg.AuthRejects.rejected(host, username, now) {
+			c.logger.Tracef("refused recently rejected username %v",
+				username)
+			err := NewStratumError(InvalidAddress, nil)
 			resp := AuthorizeResponse(*req.ID, false, err)
-			c.ch <- resp
+			c.queueMessage(resp)
+			return
+		}
+		address, name, err := ParseAuthorizeUsername(username,
+			c.cfg.ActiveNet)
+		if err != nil {
+			c.logger.Errorf("unable to parse username: %v", err)
+			c.cfg.AuthRejects.reject(host, username, now)
+			err := NewStratumError(InvalidAddress, nil)
+			resp := AuthorizeResponse(*req.ID, false, err)
+			c.queueMessage(resp)
+			return
+		}
+		name, err = NormalizeWorkerName(name, c.cfg.MaxWorkerNameLength,
+			c.cfg.StrictWorkerNames)
+		if err != nil {
+			c.refuseWorkerName(*req.ID, err)
 			return
 		}
-
-		name := strings.TrimSpace(parts[1])
-		address := strings.TrimSpace(parts[0])
 
 		// Fetch the account of the address provided.
 		id, err := AccountID(address, c.cfg.ActiveNet)
 		if err != nil {
-			log.Errorf("unable to generate account id: %v", err)
-			err := NewStratumError(Unknown, nil)
+			c.logger.Errorf("unable to generate account id: %v", err)
+			err := NewStratumError(InvalidAddress, nil)
 			resp := AuthorizeResponse(*req.ID, false, err)
-			c.ch <- resp
+			c.queueMessage(resp)
+			return
+		}
+		existing, err := FetchAccount(c.cfg.DB, []byte(id))
+		if err == nil && existing.Address != address {
+			err = accountIDCollision(id, address, existing.Address)
+			c.refuseAccountCollision(*req.ID, id, address,
+				existing.Address, err)
 			return
 		}
-		_, err = FetchAccount(c.cfg.DB, []byte(id))
 		if err != nil {
 			if !IsError(err, ErrValueNotFound) {
-				log.Errorf("unable to fetch account: %v", err)
-				err := NewStratumError(Unknown, nil)
+				c.logger.Errorf("unable to fetch account: %v", err)
+				c.cfg.AuthRejects.recordBackendFailure()
+				err := NewStratumError(PoolUnavailable, nil)
+				resp := AuthorizeResponse(*req.ID, false, err)
+				c.queueMessage(resp)
+				return
+			}
+
+			// Create the account since it does not exist.
+			account, err := NewAccount(address, c.cfg.ActiveNet)
+			if err != nil {
+				c.logger.Errorf("unable to create account: %v", err)
+				err := NewStratumError(InvalidAddress, nil)
 				resp := AuthorizeResponse(*req.ID, false, err)
-				c.ch <- resp
+				c.queueMessage(resp)
+				return
+			}
+			err = account.Create(c.cfg.DB)
+			if IsError(err, ErrAccountIDCollision) {
+				// The account was created for another address since
+				// it was fetched.
+				var existingAddress string
+				existing, fErr := FetchAccount(c.cfg.DB, []byte(id))
+				if fErr == nil {
+					existingAddress = existing.Address
+				}
+				c.refuseAccountCollision(*req.ID, id, address,
+					existingAddress, err)
+				return
+			}
+			if err != nil {
+				c.logger.Errorf("unable to persist account: %v", err)
+				c.cfg.AuthRejects.recordBackendFailure()
+				err := NewStratumError(PoolUnavailable, nil)
+				resp := AuthorizeResponse(*req.ID, false, err)
+				c.queueMessage(resp)
 				return
 			}
 		}
 
-		// Create the account if it does not already exist.
-		account, err := NewAccount(address, c.cfg.ActiveNet)
-		if err != nil {
-			log.Errorf("unable to create account: %v", err)
-			err := NewStratumError(Unknown, nil)
-			resp := AuthorizeResponse(*req.ID, false, err)
-			c.ch <- resp
+		// Locked accounts require a valid authorization token as the
+		// password.
+		verified, ok := c.verifyAccountLock(*req.ID, id, username, password)
+		if !ok {
 			return
 		}
-		err = account.Create(c.cfg.DB)
+		c.account = id
+		c.address = address
+		c.name = name
+		c.verified = verified
+
+	default:
+		// Solo miners authorizing as address.clientid have the work they
+		// mine attributed to their address, any other username is used as
+		// the worker name.
+		var address string
+		name := username
+		parts := strings.Split(username, ".")
+		if len(parts) == 2 {
+			_, err := dcrutil.DecodeAddress(strings.TrimSpace(parts[0]),
+				c.cfg.ActiveNet)
+			if err == nil {
+				address = strings.TrimSpace(parts[0])
+				name = parts[1]
+			}
+		}
+		name, err = NormalizeWorkerName(name, c.cfg.MaxWorkerNameLength,
+			c.cfg.StrictWorkerNames)
 		if err != nil {
-			log.Errorf("unable to persist account: %v", err)
-			err := NewStratumError(Unknown, nil)
-			resp := AuthorizeResponse(*req.ID, false, err)
-			c.ch <- resp
+			c.refuseWorkerName(*req.ID, err)
 			return
 		}
-		c.account = id
+		c.account = address
+		c.address = address
 		c.name = name
+	}
 
-	case true:
-		c.name = username
+	// Workers authorizing without a name are assigned a default name
+	// distinct from the default names of other connected workers of the
+	// account.
+	if c.name == "" {
+		c.name = c.cfg.DefaultWorkerNames.assign(c.account, c.id)
+		c.defaultName = true
 	}
 
+	c.username = username
 	c.authorizedMtx.Lock()
 	c.authorized = true
 	c.authorizedMtx.Unlock()
+	c.setIdentity()
+	c.loadShareHistory()
+	c.publishEvent(EventClientAuthorized, "")
 	resp := AuthorizeResponse(*req.ID, true, nil)
-	c.ch <- resp
+	c.queueMessage(resp)
+}
+
+// verifyAccountLock checks the provided password against the lock of the
+// account with the provided id. It returns whether the account is locked and
+// verified by the password and whether the authorization request with the
+// provided id can proceed, the request is refused if the account is locked
+// and the password is not a valid authorization token.
+func (c *Client) verifyAccountLock(reqID uint64, id string, username string, password string) (bool, bool) {
+	settings, err := fetchAccountSettings(c.cfg.DB, id)
+	if err != nil {
+		c.logger.Errorf("unable to fetch account settings: %v", err)
+		c.cfg.AuthRejects.recordBackendFailure()
+		err := NewStratumError(PoolUnavailable, nil)
+		resp := AuthorizeResponse(reqID, false, err)
+		c.queueMessage(resp)
+		return false, false
+	}
+	if settings.Locked && !validAuthToken(settings.LockSecret, id,
+		password, time.Now()) {
+		c.logger.Errorf("unable to authorize %s as %s, invalid "+
+			"authorization token for locked account", c.fetchIdentity(),
+			username)
+		c.cfg.RecordAuthFailure(hostKey(c.addr.IP))
+		c.cfg.AuthRejects.recordBackendFailure()
+		err := NewStratumError(AuthTokenRequired, nil)
+		resp := AuthorizeResponse(reqID, false, err)
+		c.queueMessage(resp)
+		return false, false
+	}
+	return settings.Locked, true
+}
+
+// refuseAccountCollision refuses the authorization request with the provided
+// id for the provided address deriving the account id of the account of the
+// provided existing address, and alerts the pool operator.
+func (c *Client) refuseAccountCollision(reqID uint64, id string, address string, existing string, err error) {
+	c.logger.Errorf("unable to authorize %s: %v", c.fetchIdentity(), err)
+	c.cfg.NotifyAccountCollision(&AccountCollision{
+		Account:         id,
+		Address:         address,
+		ExistingAddress: existing,
+	})
+	sErr := NewStratumError(AccountIDTaken, nil)
+	resp := AuthorizeResponse(reqID, false, sErr)
+	c.queueMessage(resp)
+}
+
+// refuseWorkerName refuses the authorization request with the provided id
+// for the provided worker name normalization error.
+func (c *Client) refuseWorkerName(id uint64, err error) {
+	c.logger.Errorf("unable to authorize %s: %v", c.fetchIdentity(), err)
+	desc := err.Error()
+	if e, ok := err.(Error); ok {
+		desc = e.Description
+	}
+	sErr := NewStratumError(InvalidWorkerName, &desc)
+	resp := AuthorizeResponse(id, false, sErr)
+	c.queueMessage(resp)
 }
 
 // handleSubscribeRequest processes subscription request messages received.
 func (c *Client) handleSubscribeRequest(req *Request, allowed bool) {
 	if !allowed {
-		log.Errorf("unable to process subscribe request, limit reached")
-		err := NewStratumError(Unknown, nil)
+		c.logger.Errorf("unable to process subscribe request, limit reached")
+		err := NewStratumError(RateLimited, nil)
 		resp := SubscribeResponse(*req.ID, "", "", 0, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
 
-	_, nid, err := ParseSubscribeRequest(req)
+	_, nid, requestedSize, err := ParseSubscribeRequest(req)
 	if err != nil {
-		log.Errorf("unable to parse subscribe request: %v", err)
-		err := NewStratumError(Unknown, nil)
+		c.logger.Errorf("unable to parse subscribe request: %v", err)
+		err := NewStratumError(InvalidRequest, nil)
 		resp := SubscribeResponse(*req.ID, "", "", 0, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
 
-	// Generate a subscription id if none exists.
+	// Resume the unexpired session of a reconnecting client, restoring
+	// its extraNonce1 so work queued by the client before disconnecting
+	// remains valid.
+	if nid != "" && !c.isSubscribed() {
+		sess, ok := c.cfg.Sessions.resume(nid, c.cfg.FetchMiner())
+		if ok {
+			c.extraNonce1 = sess.extraNonce1
+			c.resumed = sess
+			atomic.AddInt64(&c.coalesced, sess.counters.coalesced)
+			atomic.AddInt64(&c.dropped, sess.counters.dropped)
+			atomic.AddInt64(&c.offered, sess.counters.offered)
+			atomic.AddInt64(&c.writeFailures, sess.counters.writeFailures)
+			c.logger.Tracef("%s resumed session %s", c.fetchIdentity(), nid)
+		}
+	}
+
+	// Generate a subscription id if none exists. Repeated subscriptions
+	// are answered with the established subscription.
 	if nid == "" {
 		nid = fmt.Sprintf("mn%v", c.extraNonce1)
 	}
+	if c.isSubscribed() {
+		nid = c.notifyID
+	}
 
-	var resp *Response
-	switch c.cfg.FetchMiner() {
-	case AntminerDR3, AntminerDR5:
-		// The DR5 and DR3 are not fully complaint with the stratum spec.
-		// They use an 8-byte extraNonce2 regardless of the
-		// extraNonce2Size provided.
-		//
-		// The extraNonce1 is appended to the extraNonce2 in the
-		// extraNonce2 value returned in mining.submit. As a result,
-		// the extraNonce1 sent in mining.subscribe response is formatted as:
-		// 	extraNonce2 space (8-byte) + miner's extraNonce1 (4-byte)
-		paddedExtraNonce1 := strings.Repeat("0", 16) + c.extraNonce1
-		resp = SubscribeResponse(*req.ID, nid, paddedExtraNonce1, 8, nil)
-
-	case WhatsminerD1:
-		// The D1 is not fully complaint with the stratum spec.
-		// It uses a 4-byte extraNonce2 regardless of the
-		// extraNonce2Size provided.
-		//
-		// The extraNonce1 is appended to the extraNonce2 in the
-		// extraNonce2 value returned in mining.submit. As a result,
-		// the extraNonce1 sent in mining.subscribe response is formatted as:
-		// 	extraNonce2 space (4-byte) + miner's extraNonce1 (4-byte)
-		paddedExtraNonce1 := strings.Repeat("0", 8) + c.extraNonce1
-		resp = SubscribeResponse(*req.ID, nid, paddedExtraNonce1,
-			ExtraNonce2Size, nil)
-
-	default:
-		// The default case handles mining clients that support the
-		// stratum spec and respect the extraNonce2Size provided.
-		resp = SubscribeResponse(*req.ID, nid, c.extraNonce1, ExtraNonce2Size, nil)
+	// Grant the requested extraNonce2 size within the supported range,
+	// the size of an established subscription does not change.
+	miner := c.cfg.FetchMiner()
+	if !c.isSubscribed() {
+		c.extraNonce2Size = grantExtraNonce2Size(miner, requestedSize)
+		if requestedSize != 0 && requestedSize != uint64(c.extraNonce2Size) {
+			c.logger.Tracef("%s requested an extraNonce2 size of %d, "+
+				"granted %d", c.fetchIdentity(), requestedSize,
+				c.extraNonce2Size)
+		}
 	}
 
-	c.ch <- resp
+	resp := minerSubscribeResponse(miner, *req.ID, nid, c.extraNonce1,
+		c.extraNonce2Size)
+	c.queueMessage(resp)
+	c.notifyID = nid
 	c.subscribedMtx.Lock()
 	c.subscribed = true
 	c.subscribedMtx.Unlock()
 }
 
+// minerSubscribeResponse creates the mining.subscribe response for the
+// provided miner granting the provided extraNonce2 size, padding the
+// extraNonce1 for miners that ignore the extraNonce2Size provided.
+func minerSubscribeResponse(miner string, id uint64, notifyID string, extraNonce1 string, extraNonce2Size int) *Response {
+	profile, ok := fetchMinerProfile(miner)
+	if !ok {
+		// Unknown miners are assumed to support the stratum spec and
+		// respect the extraNonce2Size provided.
+		return SubscribeResponse(id, notifyID, extraNonce1,
+			extraNonce2Size, nil)
+	}
+	return profile.SubscribeResponse(id, notifyID, extraNonce1,
+		extraNonce2Size)
+}
+
+// isAuthorized returns if the client is authorized.
+func (c *Client) isAuthorized() bool {
+	c.authorizedMtx.Lock()
+	defer c.authorizedMtx.Unlock()
+	return c.authorized
+}
+
+// isSubscribed returns if the client is subscribed.
+func (c *Client) isSubscribed() bool {
+	c.subscribedMtx.Lock()
+	defer c.subscribedMtx.Unlock()
+	return c.subscribed
+}
+
+// fetchDifficultyInfo returns a copy of the client's difficulty info.
+func (c *Client) fetchDifficultyInfo() *DifficultyInfo {
+	return c.diffInfo.Load().(*DifficultyInfo).copy()
+}
+
+// setDifficultyInfo atomically replaces the client's difficulty info with a
+// snapshot of the provided difficulty info, the difficulty info of other
+// clients is not affected. Difficulties below the floor of the client's
+// miner type are raised to the floor, the client is informed of the
+// resulting difficulty by its next difficulty notification.
+func (c *Client) setDifficultyInfo(diffInfo *DifficultyInfo) {
+	info := diffInfo.copy()
+	if info.clamp() {
+		c.logger.Debugf("difficulty %s raised to the floor of %s",
+			diffInfo.difficulty.FloatString(4), info.floor.FloatString(4))
+	}
+	c.diffInfo.Store(info)
+}
+
+// expectedShareRate returns the expected share rate of the client, per
+// second, at its current difficulty given the nominal hash rate of its
+// miner type.
+func (c *Client) expectedShareRate() float64 {
+	hashRate, ok := minerHashes[c.cfg.FetchMiner()]
+	if !ok {
+		return 0
+	}
+	diffInfo := c.fetchDifficultyInfo()
+	hashesPerShare := new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 256))
+	hashesPerShare.Quo(hashesPerShare, diffInfo.target)
+	shareRate := new(big.Rat).SetInt(hashRate)
+	shareRate.Mul(shareRate, diffInfo.multiplier)
+	shareRate.Quo(shareRate, hashesPerShare)
+	rate, _ := shareRate.Float64()
+	return rate
+}
+
+// requestClass returns the rate limited request class of the provided
+// request method.
+func requestClass(method string) int {
+	switch method {
+	case Authorize:
+		return AuthorizeClass
+	case Subscribe, SetOption:
+		return SubscribeClass
+	default:
+		return SubmitClass
+	}
+}
+
+// updateDifficulty replaces the client's difficulty info with the provided
+// difficulty info and, if the client is subscribed, queues the change
+// behind the client's pending submissions. Submissions received before the
+// change are validated against the difficulty they were received at and
+// answered before the client is notified of the change and sent work at
+// the updated difficulty. It returns if the client is subscribed.
+func (c *Client) updateDifficulty(diffInfo *DifficultyInfo) bool {
+	c.readMtx.Lock()
+	defer c.readMtx.Unlock()
+	c.setDifficultyInfo(diffInfo)
+	if !c.isSubscribed() {
+		return false
+	}
+	select {
+	case c.readCh <- readPayload{diffInfo: c.fetchDifficultyInfo()}:
+	case <-c.ctx.Done():
+	}
+	return true
+}
+
+// queueRead queues the provided read payload for processing, submissions
+// are queued with a snapshot of the client's difficulty. Payloads are
+// queued in the order read, with difficulty changes acting as barriers
+// between them. It returns false if the client is disconnected.
+func (c *Client) queueRead(payload readPayload) bool {
+	c.readMtx.Lock()
+	defer c.readMtx.Unlock()
+	if req, ok := payload.msg.(*Request); ok && req.Method == Submit {
+		payload.diffInfo = c.fetchDifficultyInfo()
+	}
+	select {
+	case c.readCh <- payload:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
 // setDifficulty sends the pool client's difficulty ratio.
 func (c *Client) setDifficulty() {
-	diff := new(big.Rat).Set(c.cfg.DifficultyInfo.difficulty)
+	diff := c.fetchDifficultyInfo().difficulty
 	diffNotif := SetDifficultyNotification(diff)
-	c.ch <- diffNotif
+	c.queueMessage(diffNotif)
+}
+
+// isStaleHeader returns if the provided solved block header builds on a
+// superseded chain tip. Headers of tips up to and including the stale job
+// window below the current work height are not considered stale, a zero
+// window considers all of them stale.
+func (c *Client) isStaleHeader(header *wire.BlockHeader) (bool, error) {
+	currWork := c.cfg.FetchCurrentWork()
+	if currWork == nil || currWork.Header == "" {
+		return false, nil
+	}
+	currWorkE := currWork.Header
+	currWorkD, err := hex.DecodeString(currWorkE[:360])
+	if err != nil {
+		desc := fmt.Sprintf("failed to decode current work %s", currWorkE)
+		return false, MakeError(ErrDecode, desc, err)
+	}
+	var currHeader wire.BlockHeader
+	err = currHeader.FromBytes(currWorkD)
+	if err != nil {
+		desc := fmt.Sprintf("failed to create header from bytes %s",
+			currWorkE)
+		return false, MakeError(ErrOther, desc, err)
+	}
+	if header.PrevBlock == currHeader.PrevBlock &&
+		header.Height == currHeader.Height {
+		return false, nil
+	}
+	if header.Height > currHeader.Height {
+		return true, nil
+	}
+	if c.cfg.StaleJobWindow == 0 {
+		return true, nil
+	}
+	return currHeader.Height-header.Height > c.cfg.StaleJobWindow, nil
+}
+
+// refuseUnknownMethod answers the provided request of a method unknown to
+// the pool with an unknown method error.
+func (c *Client) refuseUnknownMethod(req *Request) {
+	c.logger.Errorf("unknown request method for request: %s", req.Method)
+	err := NewStratumError(UnknownMethod, nil)
+	c.queueMessage(NewResponse(*req.ID, nil, err))
+}
+
+// handleSetOptionRequest processes set option request messages received.
+// Only miners authorized as a locked account with a valid authorization
+// token can change the account's options.
+func (c *Client) handleSetOptionRequest(req *Request, allowed bool) {
+	if !allowed {
+		c.logger.Errorf("unable to process set option request, limit " +
+			"reached")
+		err := NewStratumError(RateLimited, nil)
+		c.queueMessage(SetOptionResponse(*req.ID, nil, err))
+		return
+	}
+	if !c.isAuthorized() {
+		c.logger.Errorf("unable to process set option request, %s is "+
+			"not authorized", c.fetchIdentity())
+		err := NewStratumError(UnauthorizedWorker, nil)
+		c.queueMessage(SetOptionResponse(*req.ID, nil, err))
+		return
+	}
+	if !c.verified {
+		c.logger.Errorf("unable to process set option request, the "+
+			"account of %s is not verified", c.fetchIdentity())
+		err := NewStratumError(AccountNotVerified, nil)
+		c.queueMessage(SetOptionResponse(*req.ID, nil, err))
+		return
+	}
+	options, err := ParseSetOptionRequest(req)
+	if err != nil {
+		c.logger.Errorf("unable to parse set option request: %v", err)
+		desc := err.Error()
+		if e, ok := err.(Error); ok {
+			desc = e.Description
+		}
+		sErr := NewStratumError(InvalidRequest, &desc)
+		c.queueMessage(SetOptionResponse(*req.ID, nil, sErr))
+		return
+	}
+	applied, err := c.cfg.SetAccountOptions(c.account, options)
+	if err != nil {
+		c.logger.Errorf("unable to set options of %s: %v",
+			c.fetchIdentity(), err)
+		var sErr *StratumError
+		switch {
+		case IsError(err, ErrUnauthorized):
+			c.verified = false
+			sErr = NewStratumError(AccountNotVerified, nil)
+		case IsError(err, ErrOther):
+			desc := err.(Error).Description
+			sErr = NewStratumError(InvalidRequest, &desc)
+		default:
+			sErr = NewStratumError(PoolUnavailable, nil)
+		}
+		c.queueMessage(SetOptionResponse(*req.ID, nil, sErr))
+		return
+	}
+	c.queueMessage(SetOptionResponse(*req.ID, applied, nil))
 }
 
 // handleSubmitWorkRequest processes work submission request messages received.
-func (c *Client) handleSubmitWorkRequest(req *Request, allowed bool) {
+// The submission is validated against and credited at the provided
+// difficulty, the client's difficulty when the submission was received.
+func (c *Client) handleSubmitWorkRequest(req *Request, allowed bool, diffInfo *DifficultyInfo) {
+	// Refuse submissions of clients yet to authorize and subscribe before
+	// any work is done on them.
+	if !c.isAuthorized() {
+		c.logger.Errorf("unable to process submit work request, %s is "+
+			"not authorized", c.fetchIdentity())
+		err := NewStratumError(UnauthorizedWorker, nil)
+		resp := SubmitWorkResponse(*req.ID, false, err)
+		c.queueMessage(resp)
+		return
+	}
+	if !c.isSubscribed() {
+		c.logger.Errorf("unable to process submit work request, %s is "+
+			"not subscribed", c.fetchIdentity())
+		err := NewStratumError(NotSubscribed, nil)
+		resp := SubmitWorkResponse(*req.ID, false, err)
+		c.queueMessage(resp)
+		return
+	}
 	if !allowed {
-		log.Errorf("unable to process submit work request, limit reached")
-		err := NewStratumError(Unknown, nil)
+		c.logger.Errorf("unable to process submit work request, limit reached")
+		err := NewStratumError(RateLimited, nil)
+		resp := SubmitWorkResponse(*req.ID, false, err)
+		c.queueMessage(resp)
+		return
+	}
+
+	// Submissions to a paused endpoint are neither credited nor counted as
+	// rejected shares of the miner.
+	if c.isPaused() {
+		c.logger.Tracef("refused submit work request of %s, the endpoint "+
+			"is paused", c.fetchIdentity())
+		err := NewStratumError(PoolUnavailable, nil)
 		resp := SubmitWorkResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
+	timer := newSubmitTimer(c.cfg.SubmitLatency != nil)
+	defer c.recordSubmitLatency(timer)
 
 	_, jobID, extraNonce2E, nTimeE, nonceE, err :=
-		ParseSubmitWorkRequest(req, c.cfg.FetchMiner())
+		ParseSubmitWorkRequest(req, c.cfg.FetchMiner(), c.extraNonce2Size)
 	if err != nil {
-		log.Errorf("unable to parse submit work request: %v", err)
-		err := NewStratumError(Unknown, nil)
+		c.logger.Errorf("unable to parse submit work request: %v", err)
+		err := NewStratumError(InvalidRequest, nil)
 		resp := SubmitWorkResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
-	job, err := FetchJob(c.cfg.DB, []byte(jobID))
+
+	// Shares of trusted clients not picked for a spot check are validated
+	// on the fast path, their jobs are looked up in the job cache and the
+	// share and network difficulties are neither computed nor logged. The
+	// fast path still hashes every share since only the hash tells if a
+	// share is a block.
+	trusted := c.isTrusted()
+	fast := trusted && !c.spotCheck()
+	var job *Job
+	if fast {
+		job = c.cfg.JobCache.fetch(jobID)
+	}
+	if job == nil {
+		job, err = FetchJob(c.cfg.DB, []byte(jobID))
+		if IsError(err, ErrValueNotFound) {
+			// Jobs evicted while submissions for them may be in flight
+			// are held by the job retainer.
+			if held := c.cfg.JobRetainer.fetch(jobID); held != nil {
+				job, err = held, nil
+			}
+		}
+		if err != nil {
+			// Jobs pruned or never issued by the pool are stale to the
+			// miner.
+			c.logger.Errorf("unable to fetch job: %v", err)
+			code := uint32(PoolUnavailable)
+			if IsError(err, ErrValueNotFound) {
+				code = StaleJob
+			}
+			err := NewStratumError(code, nil)
+			resp := SubmitWorkResponse(*req.ID, false, err)
+			c.queueMessage(resp)
+			return
+		}
+	}
+	timer.mark(stageJobFetch)
+	header, err := GenerateSolvedBlockHeader(job.Header, c.extraNonce1,
+		extraNonce2E, c.extraNonce2Size, nTimeE, nonceE, c.cfg.FetchMiner())
 	if err != nil {
-		log.Errorf("unable to fetch job: %v", err)
-		err := NewStratumError(Unknown, nil)
+		c.logger.Errorf("unable to generate solved block header: %v", err)
+		if trusted {
+			c.flagFastPath("invalid solved block header")
+		}
+		err := NewStratumError(InvalidRequest, nil)
 		resp := SubmitWorkResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
-	header, err := GenerateSolvedBlockHeader(job.Header, c.extraNonce1,
-		extraNonce2E, nTimeE, nonceE, c.cfg.FetchMiner())
+	c.checkClockSkew(header.Timestamp)
+
+	// Work for a superseded chain tip can neither be credited nor submitted
+	// to the network, unless it is for the job notified before the last
+	// clean job notification and arrives within the stale grace period.
+	// Such late work is credited but never submitted to the network.
+	stale, err := c.isStaleHeader(header)
 	if err != nil {
-		log.Errorf("unable to generate solved block header: %v", err)
-		err := NewStratumError(Unknown, nil)
+		c.logger.Errorf("unable to validate solved block header: %v", err)
+		err := NewStratumError(PoolUnavailable, nil)
+		resp := SubmitWorkResponse(*req.ID, false, err)
+		c.queueMessage(resp)
+		return
+	}
+	late := stale && c.isLateJob(jobID)
+	if stale && !late {
+		c.logger.Errorf("submitted work from %s at height #%d references a "+
+			"superseded chain tip", c.fetchIdentity(), header.Height)
+		err := NewStratumError(StaleJob, nil)
+		c.publishShareEvent(EventShareRejected, err.Message, jobID, false)
 		resp := SubmitWorkResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
-	diffInfo := c.cfg.DifficultyInfo
-	target := new(big.Rat).SetInt(standalone.CompactToBig(header.Bits))
+	timer.mark(stageHeader)
+	netTarget := standalone.CompactToBig(header.Bits)
 
 	// The target difficulty must be larger than zero.
-	if target.Sign() <= 0 {
-		log.Errorf("block target difficulty of %064x is too "+
-			"low", target)
+	if netTarget.Sign() <= 0 {
+		c.logger.Errorf("block target difficulty of %064x is too "+
+			"low", netTarget)
 		err := NewStratumError(Unknown, nil)
 		resp := SubmitWorkResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
 	hash := header.BlockHash()
-	hashTarget := new(big.Rat).SetInt(standalone.HashToBig(&hash))
-	netDiff := new(big.Rat).Quo(diffInfo.powLimit, diffInfo.target)
-	hashDiff := new(big.Rat).Quo(diffInfo.powLimit, hashTarget)
-	log.Tracef("network difficulty is: %s", netDiff.FloatString(4))
-	log.Tracef("pool difficulty is: %s", diffInfo.difficulty.FloatString(4))
-	log.Tracef("hash difficulty is: %s", hashDiff.FloatString(4))
+	var belowPool, belowNet bool
+	if fast {
+		// A hash is at most a rational target if it is at most the
+		// integer part of it.
+		hashNum := standalone.HashToBig(&hash)
+		poolTarget := new(big.Int).Quo(diffInfo.target.Num(),
+			diffInfo.target.Denom())
+		belowPool = hashNum.Cmp(poolTarget) <= 0
+		belowNet = hashNum.Cmp(netTarget) <= 0
+	} else {
+		target := new(big.Rat).SetInt(netTarget)
+		hashTarget := new(big.Rat).SetInt(standalone.HashToBig(&hash))
+		netDiff := new(big.Rat).Quo(diffInfo.powLimit, diffInfo.target)
+		hashDiff := new(big.Rat).Quo(diffInfo.powLimit, hashTarget)
+		c.logger.Tracef("network difficulty is: %s", netDiff.FloatString(4))
+		c.logger.Tracef("pool difficulty is: %s", diffInfo.difficulty.FloatString(4))
+		c.logger.Tracef("hash difficulty is: %s", hashDiff.FloatString(4))
+		belowPool = hashTarget.Cmp(diffInfo.target) <= 0
+		belowNet = hashTarget.Cmp(target) <= 0
+	}
+	timer.mark(stageTarget)
 
 	// Only submit work to the network if the submitted blockhash is
 	// less than the pool target for the client.
-	if hashTarget.Cmp(diffInfo.target) > 0 {
-		log.Errorf("submitted work from %s is not less than its "+
-			"corresponding pool target", c.id)
+	if !belowPool {
+		c.logger.Errorf("submitted work from %s is not less than its "+
+			"corresponding pool target", c.fetchIdentity())
+		if trusted {
+			c.flagFastPath("low difficulty share")
+		}
 		err := NewStratumError(LowDifficultyShare, nil)
+		c.publishShareEvent(EventShareRejected, err.Message, jobID, false)
+		resp := SubmitWorkResponse(*req.ID, false, err)
+		c.queueMessage(resp)
+		return
+	}
+
+	// Refuse submissions accepted before, including those accepted prior
+	// to a pool restart. Resubmitted blocks are accepted like blocks the
+	// network already knows of, without crediting the share again.
+	recorded, err := recordSubmission(c.cfg.DB, jobID, &hash)
+	if err != nil {
+		if IsError(err, ErrDuplicateSubmission) {
+			if belowNet {
+				c.logger.Tracef("block %s resubmitted by %s, ignoring.",
+					hash.String(), c.fetchIdentity())
+				resp := SubmitWorkResponse(*req.ID, true, nil)
+				c.queueMessage(resp)
+				return
+			}
+			c.logger.Errorf("submitted work from %s is a duplicate",
+				c.fetchIdentity())
+			err := NewStratumError(DuplicateShare, nil)
+			c.publishShareEvent(EventShareRejected, err.Message, jobID, false)
+			resp := SubmitWorkResponse(*req.ID, false, err)
+			c.queueMessage(resp)
+			return
+		}
+		c.logger.Errorf("unable to record submission: %v", err)
+		err := NewStratumError(PoolUnavailable, nil)
 		resp := SubmitWorkResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
+	if !recorded {
+		c.logger.Warnf("unable to record submission from %s, job %s "+
+			"reached the maximum of %d recorded submissions",
+			c.fetchIdentity(), jobID, maxJobSubmissions)
+	}
 	atomic.AddInt64(&c.submissions, 1)
+	atomic.AddUint64(&c.stableShares, 1)
+	if fast {
+		atomic.AddInt64(&c.fastShares, 1)
+	}
+	c.publishShareEvent(EventShareAccepted, "", jobID, late)
 
 	// Claim a weighted share for work contributed to the pool if not mining
 	// in solo mining mode.
 	if !c.cfg.SoloPool {
-		err := c.claimWeightedShare()
+		err := c.claimWeightedShare(diffInfo.multiplier, late)
 		if err != nil {
-			log.Errorf("failed to persist weighted share for %v: %v", c.id, err)
-			err := NewStratumError(Unknown, nil)
+			c.logger.Errorf("failed to persist weighted share for %v: %v", c.fetchIdentity(), err)
+			err := NewStratumError(PoolUnavailable, nil)
 			resp := SubmitWorkResponse(*req.ID, false, err)
-			c.ch <- resp
+			c.queueMessage(resp)
 			return
 		}
+		timer.mark(stageShareClaim)
+	}
+
+	if late {
+		if belowNet {
+			c.logger.Infof("late work %s from %s solves a block of a "+
+				"superseded chain tip, not submitted", hash.String(),
+				c.fetchIdentity())
+		}
+		resp := SubmitWorkResponse(*req.ID, true, nil)
+		c.queueMessage(resp)
+		return
 	}
 
 	// Only submit work to the network if the submitted blockhash is
 	// less than the network target difficulty.
-	if hashTarget.Cmp(target) > 0 {
-		log.Tracef("submitted work from %s is not less than the "+
-			"network target difficulty", c.id)
+	if !belowNet {
+		c.logger.Tracef("submitted work from %s is not less than the "+
+			"network target difficulty", c.fetchIdentity())
 		resp := SubmitWorkResponse(*req.ID, true, nil)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
 
 	// Generate and send the work submission.
 	headerB, err := header.Bytes()
 	if err != nil {
-		log.Errorf("unable to fetch block header bytes: %v", err)
+		c.logger.Errorf("unable to fetch block header bytes: %v", err)
 		err := NewStratumError(Unknown, nil)
 		resp := SubmitWorkResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.queueMessage(resp)
 		return
 	}
 	submissionB := make([]byte, getworkDataLen)
@@ -436,12 +1671,12 @@ func (c *Client) handleSubmitWorkRequest(req *Request, allowed bool) {
 	copy(submissionB[wire.MaxBlockHeaderPayload:],
 		c.cfg.Blake256Pad)
 	submission := hex.EncodeToString(submissionB)
-	accepted, err := c.cfg.SubmitWork(&submission)
+	accepted, reason, err := c.cfg.SubmitWork(&submission)
+	timer.mark(stageSubmit)
 	if err != nil {
-		log.Errorf("unable to submit work request: %v", err)
-		err := NewStratumError(Unknown, nil)
-		resp := SubmitWorkResponse(*req.ID, false, err)
-		c.ch <- resp
+		c.logger.Errorf("unable to submit work %s from %s: %v",
+			hash.String(), c.fetchIdentity(), err)
+		c.handleLostBlock(*req.ID, header, headerB, err.Error())
 		return
 	}
 
@@ -449,116 +1684,256 @@ func (c *Client) handleSubmitWorkRequest(req *Request, allowed bool) {
 	case true:
 		// Create accepted work if the work submission is accepted
 		// by the mining node.
+		reward := c.cfg.WorkSubsidy(header.Height, header.Voters)
 		work := NewAcceptedWork(hash.String(), header.PrevBlock.String(),
-			header.Height, c.account, c.cfg.FetchMiner())
+			header.Height, c.account, c.cfg.FetchMiner(), reward)
+		work.Worker = c.name
 		err := work.Create(c.cfg.DB)
 		if err != nil {
-			// If the submitted accepted work already exists, ignore the
-			// submission.
+			// If the submitted accepted work already exists the block was
+			// recorded by an earlier submission of it. The share is valid
+			// and was accepted by the network so the submission is
+			// accepted, the block is not recorded or announced again.
 			if IsError(err, ErrWorkExists) {
-				log.Tracef("Work %s already exists, ignoring.", hash.String())
-				err := NewStratumError(DuplicateShare, nil)
-				resp := SubmitWorkResponse(*req.ID, false, err)
-				c.ch <- resp
+				c.logger.Tracef("Work %s already exists, ignoring.", hash.String())
+				resp := SubmitWorkResponse(*req.ID, true, nil)
+				c.queueMessage(resp)
 				return
 			}
-			log.Errorf("unable to persist accepted work: %v", err)
-			err := NewStratumError(Unknown, nil)
+			c.logger.Errorf("unable to persist accepted work: %v", err)
+			err := NewStratumError(PoolUnavailable, nil)
 			resp := SubmitWorkResponse(*req.ID, false, err)
-			c.ch <- resp
+			c.queueMessage(resp)
 			return
 		}
-		log.Tracef("Work %s accepted by the network", hash.String())
+		c.logger.Infof("Work %s from %s accepted by the network",
+			hash.String(), c.fetchIdentity())
+
+		// The block accepted event is published before notifying the
+		// client so the finder is recorded even if it disconnected.
+		if c.cfg.NotifyBlockAccepted != nil {
+			c.cfg.NotifyBlockAccepted(c.id, work)
+		}
+		resp := SubmitWorkResponse(*req.ID, true, nil)
+		c.queueMessage(resp)
+		c.queueMessage(ShowMessageNotification(fmt.Sprintf("Block #%d "+
+			"(%s) found by %s", work.Height, work.BlockHash, c.name)))
 		return
 
 	case false:
-		log.Tracef("Work %s rejected by the network", hash.String())
-		c.ch <- SubmitWorkResponse(*req.ID, false, nil)
+		if reason == "" {
+			reason = "rejected by the network"
+		}
+		c.logger.Errorf("Work %s from %s rejected by the network: %s",
+			hash.String(), c.fetchIdentity(), reason)
+		c.handleLostBlock(*req.ID, header, headerB, reason)
+		return
+	}
+}
+
+// recordSubmitLatency records the stage latencies of a work submission if
+// latency metrics are enabled, slow submissions are logged with their stage
+// breakdown.
+func (c *Client) recordSubmitLatency(timer *submitTimer) {
+	if c.cfg.SubmitLatency == nil {
 		return
 	}
+	if c.cfg.SubmitLatency.record(timer) {
+		c.logger.Warnf("slow work submission from %s took %v: %s", c.fetchIdentity(),
+			timer.total(), timer)
+	}
 }
 
 // read receives incoming data and passes the message received for
 // processing. This must be run as goroutine.
 func (c *Client) read() {
+	var violations int
+	var nullIDs uint64
 	for {
-		err := c.conn.SetDeadline(time.Now().Add(time.Minute * 4))
+		err := c.conn.SetReadDeadline(time.Now().Add(readTimeout))
 		if err != nil {
-			log.Errorf("%s: unable to set deadline: %v", c.id, err)
-			c.cancel()
+			c.logger.Errorf("%s: unable to set deadline: %v", c.fetchIdentity(), err)
+			c.cancelWithReason(DisconnectReadError)
 			return
 		}
-		data, err := c.reader.ReadBytes('\n')
+		buf := readBufferPool.Get().(*bytes.Buffer)
+		err = c.readMessage(buf)
 		if err != nil {
-			if err == io.EOF {
-				c.cancel()
-				return
+			putReadBuffer(buf)
+			reason := readDisconnectReason(err)
+			switch reason {
+			case DisconnectEOF:
+			case DisconnectReadTimeout:
+				c.logger.Errorf("%s: read timeout: %v", c.fetchIdentity(), err)
+			case DisconnectReadError:
+				c.logger.Errorf("%s: read error: %v", c.fetchIdentity(), err)
+			default:
+				c.logger.Errorf("%s: failed to read bytes: %v", c.fetchIdentity(), err)
 			}
-			nErr, ok := err.(*net.OpError)
-			if !ok {
-				log.Errorf("%s: failed to read bytes: %v", c.id, err)
-				c.cancel()
+			c.cancelWithReason(reason)
+			return
+		}
+		c.captureFrame(CaptureInbound, buf.Bytes())
+		msg, reqType, err := IdentifyMessage(buf.Bytes())
+		putReadBuffer(buf)
+		if err != nil {
+			c.logger.Errorf("unable to identify message: %v", err)
+			c.cancelWithReason(DisconnectProtocolError)
+			return
+		}
+
+		// Requests with a null id are processed without being answered,
+		// they are assigned ids counting down from the maximum id which
+		// conforming miners counting up never reach. Requests with ids not
+		// in the canonical form are answered with their ids as sent.
+		if reqType == NotificationMessage {
+			id := uint64(math.MaxUint64) - nullIDs
+			nullIDs++
+			msg.(*Request).ID = &id
+			c.setResponseID(id, nil)
+			reqType = RequestMessage
+		} else if reqType == RequestMessage && msg.(*Request).RawID != nil {
+			req := msg.(*Request)
+			c.setResponseID(*req.ID, req.RawID)
+		}
+		if !c.acquireInFlight() {
+			atomic.AddInt64(&c.overBudget, 1)
+			violations++
+			if violations >= maxBudgetViolations {
+				c.logger.Errorf("%s repeatedly exceeded its in-flight "+
+					"message budget of %d, disconnecting", c.fetchIdentity(),
+					c.cfg.MaxInFlight)
+				c.cancelWithReason(DisconnectRateLimited)
 				return
 			}
-			if nErr != nil {
-				if nErr.Op == "read" && nErr.Net == "tcp" {
-					switch {
-					case nErr.Timeout():
-						log.Errorf("%s: read timeout: %v", c.id, err)
-					case !nErr.Timeout():
-						log.Errorf("%s: read error: %v", c.id, err)
-					}
-					c.cancel()
-					return
-				}
+			c.logger.Warnf("%s exceeded its in-flight message budget of %d",
+				c.fetchIdentity(), c.cfg.MaxInFlight)
+			if reqType == RequestMessage {
+				req := msg.(*Request)
+				err := NewStratumError(RateLimited, nil)
+				c.queueMessage(NewResponse(*req.ID, nil, err))
 			}
-			log.Errorf("failed to read bytes: %v %T", err, err)
-			c.cancel()
-			return
+			continue
 		}
-		msg, reqType, err := IdentifyMessage(data)
-		if err != nil {
-			log.Errorf("unable to identify message: %v", err)
-			c.cancel()
+		violations = 0
+		if !c.queueRead(readPayload{msg: msg, msgType: reqType}) {
 			return
 		}
-		c.readCh <- readPayload{msg, reqType}
 	}
 }
 
+// acquireInFlight reserves an in-flight message slot for the client, it
+// returns false if the client's in-flight message budget is exhausted.
+func (c *Client) acquireInFlight() bool {
+	if c.cfg.MaxInFlight == 0 {
+		return true
+	}
+	if atomic.AddInt32(&c.inFlight, 1) > int32(c.cfg.MaxInFlight) {
+		atomic.AddInt32(&c.inFlight, -1)
+		return false
+	}
+	return true
+}
+
+// releaseInFlight frees the in-flight message slot of a processed message.
+func (c *Client) releaseInFlight() {
+	if c.cfg.MaxInFlight == 0 {
+		return
+	}
+	atomic.AddInt32(&c.inFlight, -1)
+}
+
+// maxReadSize returns the maximum size of a message read from the client.
+func (c *Client) maxReadSize() int {
+	if c.cfg.MaxReadSize == 0 {
+		return MaxReadMessageSize
+	}
+	return int(c.cfg.MaxReadSize)
+}
+
+// maxWriteSize returns the maximum size of a message written to the client.
+func (c *Client) maxWriteSize() int {
+	if c.cfg.MaxWriteSize == 0 {
+		return MaxWriteMessageSize
+	}
+	return int(c.cfg.MaxWriteSize)
+}
+
+// readMessage reads the next newline delimited message of the client into
+// the provided buffer. An error is returned once the message exceeds the
+// read limit, without buffering the rest of it.
+func (c *Client) readMessage(buf *bytes.Buffer) error {
+	for {
+		line, err := c.reader.ReadSlice('\n')
+		buf.Write(line)
+		if buf.Len() > c.maxReadSize() {
+			return readLimitError(c.maxReadSize())
+		}
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// handshakeComplete returns true exactly once, on the first call after the
+// client is both authorized and subscribed, regardless of the order the
+// client sent its authorize and subscribe requests in.
+func (c *Client) handshakeComplete() bool {
+	if !c.isAuthorized() || !c.isSubscribed() {
+		return false
+	}
+	return atomic.CompareAndSwapUint32(&c.initialWork, 0, 1)
+}
+
+// sendInitialWork sends the client its initial work once it completes its
+// handshake. A configured initial work delay is waited out on a timer so
+// the client's message processing is not blocked.
+func (c *Client) sendInitialWork() {
+	if !c.handshakeComplete() {
+		return
+	}
+	if c.cfg.InitialWorkDelay <= 0 {
+		c.updateWork(true)
+		return
+	}
+	time.AfterFunc(c.cfg.InitialWorkDelay, func() {
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.updateWork(true)
+	})
+}
+
 // updateWork updates a client with a timestamp-rolled current work.
 // This should be called after a client completes a work submission or
-// after client authentication.
+// after client authentication. Current work older than the last work
+// queued for the client is not rolled. The rolled work is only sent as a
+// clean job if it is the client's first work of the current template,
+// jobs of a template already sent remain valid after a timestamp roll.
 func (c *Client) updateWork(allowed bool) {
 	// Only timestamp-roll current work for authorized and subscribed clients.
-	c.authorizedMtx.Lock()
-	authorized := c.authorized
-	c.authorizedMtx.Unlock()
-	c.subscribedMtx.Lock()
-	subscribed := c.subscribed
-	c.subscribedMtx.Unlock()
-
-	if !subscribed || !authorized {
+	if !c.isSubscribed() || !c.isAuthorized() {
 		return
 	}
-	if !allowed {
+	if !allowed || c.isPaused() {
+		return
+	}
+	currWork := c.cfg.FetchCurrentWork()
+	if currWork == nil || currWork.Header == "" {
 		return
 	}
-	currWorkE := c.cfg.FetchCurrentWork()
-	if currWorkE == "" {
+	if currWork.Seq < c.fetchWorkSeq() {
+		c.logger.Tracef("Not rolling outdated current work at height "+
+			"#%d for %v", currWork.Height, c.fetchIdentity())
 		return
 	}
+	currWorkE := currWork.Header
 
 	now := uint32(time.Now().Unix())
 	b := make([]byte, 4)
 	binary.LittleEndian.PutUint32(b, now)
 	timestampE := hex.EncodeToString(b)
-	buf := bytes.NewBufferString("")
-	buf.WriteString(currWorkE[:272])
-	buf.WriteString(timestampE)
-	buf.WriteString(currWorkE[280:])
-
-	updatedWorkE := buf.String()
+	updatedWorkE := currWorkE[:272] + timestampE + currWorkE[280:]
 	blockVersion := updatedWorkE[:8]
 	prevBlock := updatedWorkE[8:72]
 	genTx1 := updatedWorkE[72:288]
@@ -568,89 +1943,136 @@ func (c *Client) updateWork(allowed bool) {
 
 	heightD, err := hex.DecodeString(updatedWorkE[256:264])
 	if err != nil {
-		log.Errorf("failed to decode block height %s: %v", string(heightD), err)
+		c.logger.Errorf("failed to decode block height %s: %v", string(heightD), err)
 	}
 	height := binary.LittleEndian.Uint32(heightD)
 
 	// Create a job for the timestamp-rolled current work.
 	job, err := NewJob(updatedWorkE, height)
 	if err != nil {
-		log.Errorf("failed to create job: %v", err)
+		c.logger.Errorf("failed to create job: %v", err)
 		return
 	}
 	err = job.Create(c.cfg.DB)
 	if err != nil {
-		log.Errorf("failed to persist job: %v", err)
+		c.logger.Errorf("failed to persist job: %v", err)
 		return
 	}
+	c.cfg.JobCache.add(job)
+	err = c.cfg.JobRetainer.retain(job)
+	if err != nil {
+		c.logger.Errorf("unable to evict jobs: %v", err)
+	}
+	clean := !c.hasQueuedWork(currWork.Seq)
 	workNotif := WorkNotification(job.UUID, prevBlock, genTx1, genTx2,
-		blockVersion, nBits, nTime, true)
-	select {
-	case c.ch <- workNotif:
-		log.Tracef("Sent a timestamp-rolled current work at "+
-			"height #%v to %v", height, c.id)
-	default:
+		blockVersion, nBits, nTime, clean)
+	notif, err := formatWorkNotification(c.cfg.FetchMiner(), workNotif)
+	if err == nil {
+		err = validateWorkNotification(c.cfg.FetchMiner(), updatedWorkE, notif)
+	}
+	if err != nil {
+		c.logger.Errorf("timestamp-rolled work at height #%d does not carry "+
+			"its block template, not notifying %v: %v", height,
+			c.fetchIdentity(), err)
+		return
+	}
+	if !c.queueWork(workNotif, currWork.Seq) {
+		c.logger.Tracef("Dropped a timestamp-rolled current work at "+
+			"height #%v for %v, newer work was queued", height,
+			c.fetchIdentity())
+		return
 	}
+	c.logger.Tracef("Queued a timestamp-rolled current work at "+
+		"height #%v for %v", height, c.fetchIdentity())
+}
+
+// limiterHost returns the key the request limiters of the client are
+// tracked under. Limiters are shared by all connections of a host, IPv4
+// clients and their IPv4-mapped IPv6 form included, so reconnecting does
+// not refill them.
+func (c *Client) limiterHost() string {
+	return normalizeIP(c.addr.IP).String()
 }
 
 // process  handles incoming messages from the connected pool client.
-// It must be run as a goroutine.
+// Messages are processed in the order they were read, so responses to the
+// client's requests are delivered in request order. Requests refused for
+// exceeding the in-flight message budget are the exception, they are
+// answered as soon as they are read. It must be run as a goroutine.
 func (c *Client) process(ctx context.Context) {
-	ip := c.addr.String()
+	ip := c.limiterHost()
 	for {
 		select {
 		case <-ctx.Done():
 			_, err := c.conn.Write([]byte{})
 			if err != nil {
-				log.Errorf("unable to close connection: %v", err)
+				c.logger.Errorf("unable to close connection: %v", err)
 			}
 			c.wg.Done()
 			return
 
 		case payLoad := <-c.readCh:
+			// Difficulty changes are queued without an in-flight slot.
+			if payLoad.msg == nil {
+				atomic.StoreUint64(&c.stableShares, 0)
+				diff := payLoad.diffInfo.difficulty
+				c.queueMessage(SetDifficultyNotification(diff))
+				c.updateWork(true)
+				continue
+			}
+			c.releaseInFlight()
 			msg := payLoad.msg
 			msgType := payLoad.msgType
-			allowed := c.cfg.WithinLimit(ip, PoolClient)
 			switch msgType {
 			case RequestMessage:
 				req := msg.(*Request)
+				class := requestClass(req.Method)
+				var shareRate float64
+				if class == SubmitClass {
+					shareRate = c.expectedShareRate()
+				}
+				allowed := c.cfg.WithinLimit(ip, class, shareRate)
 				switch req.Method {
 				case Authorize:
 					c.handleAuthorizeRequest(req, allowed)
 					c.setDifficulty()
-					time.Sleep(time.Second)
-					c.updateWork(allowed)
+					c.sendInitialWork()
 
 				case Subscribe:
 					c.handleSubscribeRequest(req, allowed)
+					c.sendInitialWork()
 
 				case Submit:
-					c.handleSubmitWorkRequest(req, allowed)
+					c.handleSubmitWorkRequest(req, allowed,
+						payLoad.diffInfo)
 					c.updateWork(allowed)
 
+				case SetOption:
+					if c.cfg.SetAccountOptions == nil {
+						c.refuseUnknownMethod(req)
+						continue
+					}
+					c.handleSetOptionRequest(req, allowed)
+
 				default:
-					log.Errorf("unknown request method for "+
+					// Unknown methods of the pool's extensions are
+					// refused without disconnecting the client.
+					if strings.HasPrefix(req.Method, PoolMethodPrefix) {
+						c.refuseUnknownMethod(req)
+						continue
+					}
+					c.logger.Errorf("unknown request method for "+
 						"request: %s", req.Method)
-					c.cancel()
+					c.cancelWithReason(DisconnectUnknownMethod)
 					continue
 				}
 
 			case ResponseMessage:
-				resp := msg.(*Response)
-				method := c.fetchStratumMethod(resp.ID)
-				if method == "" {
-					log.Errorf("no request found for response with id: %d",
-						resp.ID, spew.Sdump(resp))
-					c.cancel()
-					continue
-				}
-				log.Errorf("unknown request method for response: %s", method)
-				c.cancel()
-				continue
+				c.handleResponse(msg.(*Response))
 
 			default:
-				log.Errorf("unknown message type received: %d", msgType)
-				c.cancel()
+				c.logger.Errorf("unknown message type received: %d", msgType)
+				c.cancelWithReason(DisconnectProtocolError)
 				continue
 			}
 		}
@@ -660,14 +2082,14 @@ func (c *Client) process(ctx context.Context) {
 // reversePrevBlockWords reverses each 4-byte word in the provided hex encoded
 // previous block hash.
 func reversePrevBlockWords(hashE string) string {
-	buf := bytes.NewBufferString("")
+	buf := make([]byte, 0, len(hashE))
 	for i := 0; i < len(hashE); i += 8 {
-		buf.WriteString(hashE[i+6 : i+8])
-		buf.WriteString(hashE[i+4 : i+6])
-		buf.WriteString(hashE[i+2 : i+4])
-		buf.WriteString(hashE[i : i+2])
+		buf = append(buf, hashE[i+6:i+8]...)
+		buf = append(buf, hashE[i+4:i+6]...)
+		buf = append(buf, hashE[i+2:i+4]...)
+		buf = append(buf, hashE[i:i+2]...)
 	}
-	return buf.String()
+	return string(buf)
 }
 
 // hexReversed reverses a hex string.
@@ -676,110 +2098,62 @@ func hexReversed(in string) (string, error) {
 		desc := fmt.Sprintf("expected even hex input length, got %d", len(in))
 		return "", MakeError(ErrWrongInputLength, desc, nil)
 	}
-	buf := bytes.NewBufferString("")
+	buf := make([]byte, 0, len(in))
 	for i := len(in) - 1; i > -1; i -= 2 {
-		buf.WriteByte(in[i-1])
-		buf.WriteByte(in[i])
+		buf = append(buf, in[i-1], in[i])
 	}
-	return buf.String(), nil
+	return string(buf), nil
 }
 
-// handleAntminerDR3 prepares work notifications for the Antminer DR3.
-func (c *Client) handleAntminerDR3Work(req *Request) {
-	jobID, prevBlock, genTx1, genTx2, blockVersion, nBits, nTime,
-		cleanJob, err := ParseWorkNotification(req)
+// encode writes the provided message to the client. The write fails once
+// the write timeout elapses so a client that stopped reading cannot block
+// its sender indefinitely. Messages encoding to frames larger than the
+// write limit are logged and dropped instead of being written.
+func (c *Client) encode(msg interface{}) error {
+	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Errorf("unable to parse work message: %v", err)
+		return err
 	}
-
-	// The DR3 requires the nBits and nTime fields of a mining.notify message
-	// as big endian.
-	nBits, err = hexReversed(nBits)
-	if err != nil {
-		log.Errorf("unable to hex reverse nBits: %v", err)
-		c.cancel()
-		return
+	data = append(data, '\n')
+	if len(data) > c.maxWriteSize() {
+		c.recordDropped()
+		c.logger.Errorf("%s: dropped %d byte message exceeding the write "+
+			"limit of %d bytes", c.fetchIdentity(), len(data), c.maxWriteSize())
+		return nil
 	}
-	nTime, err = hexReversed(nTime)
-	if err != nil {
-		log.Errorf("unable to hex reverse nTime: %v", err)
-		c.cancel()
-		return
+	if c.cfg.WriteTimeout > 0 {
+		err := c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout))
+		if err != nil {
+			return err
+		}
 	}
-	prevBlockRev := reversePrevBlockWords(prevBlock)
-	workNotif := WorkNotification(jobID, prevBlockRev,
-		genTx1, genTx2, blockVersion, nBits, nTime, cleanJob)
-	err = c.encoder.Encode(workNotif)
-	if err != nil {
-		log.Errorf("message encoding error: %v", err)
-		c.cancel()
-		return
+	_, err = c.conn.Write(data)
+	if err == nil {
+		c.captureFrame(CaptureOutbound, data)
 	}
+	return err
 }
 
-// handleInnosiliconD9Work prepares work notifications for the Innosilicon D9.
-func (c *Client) handleInnosiliconD9Work(req *Request) {
-	jobID, prevBlock, genTx1, genTx2, blockVersion, nBits, nTime,
-		cleanJob, err := ParseWorkNotification(req)
-	if err != nil {
-		log.Errorf("unable to parse work message: %v", err)
-	}
-
-	// The D9 requires the nBits and nTime fields of a mining.notify message
-	// as big endian.
-	nBits, err = hexReversed(nBits)
-	if err != nil {
-		log.Errorf("unable to hex reverse nBits: %v", err)
-		c.cancel()
-		return
-	}
-	nTime, err = hexReversed(nTime)
-	if err != nil {
-		log.Errorf("unable to hex reverse nTime: %v", err)
-		c.cancel()
-		return
-	}
-	prevBlockRev := reversePrevBlockWords(prevBlock)
-	workNotif := WorkNotification(jobID, prevBlockRev,
-		genTx1, genTx2, blockVersion, nBits, nTime, cleanJob)
-	err = c.encoder.Encode(workNotif)
-	if err != nil {
-		log.Errorf("message encoding error: %v", err)
-		c.cancel()
+// captureFrame records the provided frame of the provided direction with
+// the client's trace capture, if it is being captured.
+func (c *Client) captureFrame(direction string, data []byte) {
+	if c.cfg.FetchCapture == nil {
 		return
 	}
-}
-
-// handleWhatsminerD1Work prepares work notifications for the Whatsminer D1.
-func (c *Client) handleWhatsminerD1Work(req *Request) {
-	jobID, prevBlock, genTx1, genTx2, blockVersion, nBits, nTime,
-		cleanJob, err := ParseWorkNotification(req)
-	if err != nil {
-		log.Errorf("unable to parse work message: %v", err)
-	}
-
-	// The D1 requires the nBits and nTime fields of a mining.notify message
-	// as little endian. Since they're already in the preferred format there
-	// is no need to reverse bytes for nBits and nTime.
-	prevBlockRev := reversePrevBlockWords(prevBlock)
-	workNotif := WorkNotification(jobID, prevBlockRev,
-		genTx1, genTx2, blockVersion, nBits, nTime, cleanJob)
-	err = c.encoder.Encode(workNotif)
-	if err != nil {
-		log.Errorf("message encoding error: %v", err)
-		c.cancel()
-		return
+	if capture := c.cfg.FetchCapture(c.id); capture != nil {
+		capture.record(direction, data)
 	}
 }
 
-// handleCPUWork prepares work for the cpu miner.
-func (c *Client) handleCPUWork(req *Request) {
-	err := c.encoder.Encode(req)
-	if err != nil {
-		log.Errorf("message encoding error: %v", err)
-		c.cancel()
-		return
+// formatWorkNotification formats the provided work notification as
+// expected by the provided miner.
+func formatWorkNotification(miner string, req *Request) (*Request, error) {
+	profile, ok := fetchMinerProfile(miner)
+	if !ok {
+		desc := fmt.Sprintf("unknown miner provided: %s", miner)
+		return nil, MakeError(ErrNotSupported, desc, nil)
 	}
+	return profile.FormatWorkNotification(req)
 }
 
 // setHashRate updates the client's hash rate.
@@ -812,7 +2186,7 @@ func (c *Client) hashMonitor(ctx context.Context) {
 				continue
 			}
 			average := float64(hashCalcThreshold) / float64(submissions)
-			diffInfo := c.cfg.DifficultyInfo
+			diffInfo := c.fetchDifficultyInfo()
 			num := new(big.Rat).Mul(diffInfo.difficulty,
 				new(big.Rat).SetFloat64(c.cfg.NonceIterations))
 			denom := new(big.Rat).SetFloat64(average)
@@ -823,81 +2197,251 @@ func (c *Client) hashMonitor(ctx context.Context) {
 	}
 }
 
+// sendWork dispatches the provided work notification to the client in the
+// format expected by its miner.
+func (c *Client) sendWork(req *Request) {
+	// Only send work to authorized and subscribed clients.
+	if !c.isAuthorized() || !c.isSubscribed() {
+		return
+	}
+
+	notif, err := formatWorkNotification(c.cfg.FetchMiner(), req)
+	if err != nil {
+		c.logger.Errorf("unable to format work notification: %v", err)
+		c.cancelWithReason(DisconnectProtocolError)
+		return
+	}
+	err = c.encode(notif)
+	if err != nil {
+		c.recordWriteFailure(err)
+		return
+	}
+	if params, ok := paramArray(req.Params, 9); ok {
+		if jobID, ok := params[0].(string); ok {
+			c.cfg.JobRetainer.touch(jobID)
+			clean, _ := params[8].(bool)
+			c.recordNotifiedJob(jobID, clean)
+		}
+	}
+	c.logger.Tracef("%s notified of new work", c.fetchIdentity())
+}
+
+// queueWork queues the provided work notification of the current work with
+// the provided sequence number for delivery to the client, returning false
+// if it was dropped. Notifications of work older than the last work queued
+// and notifications to clients of paused endpoints are dropped, only the
+// former count towards the client's drop rate. Pending work notifications
+// are replaced by newer ones, clean job notifications take priority over and
+// replace pending non-clean ones.
+func (c *Client) queueWork(notif *Request, seq uint64) bool {
+	if c.isPaused() {
+		return false
+	}
+	c.recordOffered()
+	clean := isCleanJob(notif)
+	c.workMtx.Lock()
+	if seq < c.workSeq {
+		c.workMtx.Unlock()
+		c.recordDropped()
+		return false
+	}
+	c.workSeq = seq
+	c.workQueued = true
+	if c.work != nil {
+		atomic.AddInt64(&c.coalesced, 1)
+		if isCleanJob(c.work) && !clean {
+			c.workMtx.Unlock()
+			return true
+		}
+	}
+	c.work = notif
+	c.workMtx.Unlock()
+	select {
+	case c.workCh <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// fetchWorkSeq returns the sequence number of the last work queued for the
+// client.
+func (c *Client) fetchWorkSeq() uint64 {
+	c.workMtx.Lock()
+	defer c.workMtx.Unlock()
+	return c.workSeq
+}
+
+// hasQueuedWork returns if work of the current work with the provided
+// sequence number was already queued for the client.
+func (c *Client) hasQueuedWork(seq uint64) bool {
+	c.workMtx.Lock()
+	defer c.workMtx.Unlock()
+	return c.workQueued && c.workSeq == seq
+}
+
+// forgetQueuedWork discards the work queued for the client so the next
+// work notification is sent as a clean job.
+func (c *Client) forgetQueuedWork() {
+	c.workMtx.Lock()
+	c.work = nil
+	c.workQueued = false
+	c.workMtx.Unlock()
+}
+
+// recordNotifiedJob tracks the provided job as last notified to the client.
+// A clean job notification opens the stale grace period of the job notified
+// before it.
+func (c *Client) recordNotifiedJob(jobID string, clean bool) {
+	c.graceMtx.Lock()
+	if clean && c.cfg.StaleGracePeriod > 0 && c.lastJob != jobID {
+		c.graceJob = c.lastJob
+		c.graceUntil = time.Now().Add(c.cfg.StaleGracePeriod)
+	}
+	c.lastJob = jobID
+	c.graceMtx.Unlock()
+}
+
+// isLateJob returns if work for the provided job is within its stale grace
+// period, the provided job being the one notified to the client before the
+// last clean job notification.
+func (c *Client) isLateJob(jobID string) bool {
+	if c.cfg.StaleGracePeriod <= 0 {
+		return false
+	}
+	c.graceMtx.Lock()
+	defer c.graceMtx.Unlock()
+	return c.graceJob != "" && c.graceJob == jobID &&
+		time.Now().Before(c.graceUntil)
+}
+
+// isCleanJob returns if the provided work notification requires clients to
+// discard their current jobs.
+func isCleanJob(notif *Request) bool {
+	_, _, _, _, _, _, _, clean, err := ParseWorkNotification(notif)
+	return err == nil && clean
+}
+
 // Send dispatches messages to a pool client. It must be run as a goroutine.
 func (c *Client) send(ctx context.Context) {
+	var lastNotify time.Time
+	var throttle <-chan time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			c.wg.Done()
 			return
 
-		case msg := <-c.ch:
-			if msg == nil {
+		case <-throttle:
+			throttle = nil
+			select {
+			case c.workCh <- struct{}{}:
+			default:
+			}
+
+		case <-c.workCh:
+			c.workMtx.Lock()
+			work := c.work
+			if work == nil {
+				c.workMtx.Unlock()
+				continue
+			}
+
+			// Work pending when the endpoint was paused is discarded.
+			if c.isPaused() {
+				c.work = nil
+				c.workMtx.Unlock()
+				continue
+			}
+
+			// Delay non-clean work notifications sent within the minimum
+			// notification interval.
+			wait := c.cfg.MinNotifyInterval - time.Since(lastNotify)
+			if !isCleanJob(work) && wait > 0 {
+				c.workMtx.Unlock()
+				if throttle == nil {
+					throttle = time.After(wait)
+				}
 				continue
 			}
-			if msg.MessageType() == ResponseMessage {
-				err := c.encoder.Encode(msg)
+			c.work = nil
+			c.workMtx.Unlock()
+			lastNotify = time.Now()
+			c.flushMessages()
+			c.sendWork(work)
+
+		case reason := <-c.disconnectCh:
+			if reason != "" {
+				err := c.encode(ShowMessageNotification(reason))
 				if err != nil {
-					log.Errorf("message encoding error: %v", err)
-					c.cancel()
-					continue
+					atomic.AddInt64(&c.writeFailures, 1)
+					c.logger.Errorf("message encoding error: %v", err)
 				}
 			}
+			c.logger.Infof("%s disconnected by the pool", c.fetchIdentity())
+			c.cancelWithReason(DisconnectByPool)
 
-			if msg.MessageType() == RequestMessage {
-				req := msg.(*Request)
-				if req.Method == Notify {
-					// Only send work to authorized and subscribed clients.
-					c.authorizedMtx.Lock()
-					authorized := c.authorized
-					c.authorizedMtx.Unlock()
-					c.subscribedMtx.Lock()
-					subscribed := c.subscribed
-					c.subscribedMtx.Unlock()
-					if !authorized || !subscribed {
-						continue
-					}
-
-					switch c.cfg.FetchMiner() {
-					case CPU:
-						c.handleCPUWork(req)
-						log.Tracef("%s notified of new work", c.id)
-
-					case AntminerDR3, AntminerDR5:
-						c.handleAntminerDR3Work(req)
-						log.Tracef("%s notified of new work", c.id)
-
-					case InnosiliconD9:
-						c.handleInnosiliconD9Work(req)
-						log.Tracef("%s notified of new work", c.id)
+		case msg := <-c.ch:
+			c.sendMessage(msg)
+		}
+	}
+}
 
-					case WhatsminerD1:
-						c.handleWhatsminerD1Work(req)
-						log.Tracef("%s notified of new work", c.id)
+// sendMessage sends the provided queued message to the client.
+func (c *Client) sendMessage(msg Message) {
+	if msg == nil {
+		return
+	}
+	if msg.MessageType() == ResponseMessage {
+		resp := msg.(*Response)
+		rawID, ok := c.takeResponseID(resp.ID)
+		if ok && rawID == nil {
+			return
+		}
+		resp.RawID = rawID
+		err := c.encode(resp)
+		if err != nil {
+			c.recordWriteFailure(err)
+			return
+		}
+	}
 
-					default:
-						log.Errorf("unknown miner provided: %s", c.cfg.FetchMiner())
-						c.cancel()
-						continue
-					}
-				}
-				if req.Method != Notify {
-					err := c.encoder.Encode(msg)
-					if err != nil {
-						log.Errorf("message encoding error: %v", err)
-						c.cancel()
-						continue
-					}
-				}
+	if msg.MessageType() == RequestMessage {
+		req := msg.(*Request)
+		if req.Method == Notify {
+			c.sendWork(req)
+		}
+		if req.Method != Notify {
+			err := c.encode(msg)
+			if err != nil {
+				c.recordWriteFailure(err)
+				return
 			}
 		}
 	}
 }
 
+// flushMessages sends all messages queued for the client. Work is only sent
+// after flushing so responses and difficulty notifications queued before it,
+// such as those of the authorize flow, reach the client first.
+func (c *Client) flushMessages() {
+	for {
+		select {
+		case msg := <-c.ch:
+			c.sendMessage(msg)
+		default:
+			return
+		}
+	}
+}
+
 // run handles the process lifecycles of the pool client.
 func (c *Client) run(ctx context.Context) {
-	endpointWg := c.cfg.EndpointWg
-	endpointWg.Add(1)
+	if !c.cfg.RegisterClient(c) {
+		c.logger.Tracef("%s not started, the pool is shutting down",
+			c.fetchIdentity())
+		c.shutdown()
+		return
+	}
 	go c.read()
 
 	c.wg.Add(3)
@@ -907,5 +2451,4 @@ func (c *Client) run(ctx context.Context) {
 	c.wg.Wait()
 
 	c.shutdown()
-	endpointWg.Done()
 }
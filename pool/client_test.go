@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,7 +19,10 @@ import (
 	"time"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/blockchain/standalone"
 	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
+	"github.com/Eacred/eacrd/wire"
 )
 
 func testClient(t *testing.T, db *bolt.DB) {
@@ -73,13 +78,20 @@ func testClient(t *testing.T, db *bolt.DB) {
 		miner = m
 		minerMtx.Unlock()
 	}
+	policy := PolicyAllow
+	var policyMtx sync.RWMutex
+	setPolicy := func(p string) {
+		policyMtx.Lock()
+		policy = p
+		policyMtx.Unlock()
+	}
 	powLimit := chaincfg.SimNetParams().PowLimit
 	powLimitF, _ := new(big.Float).SetInt(powLimit).Float64()
 	iterations := math.Pow(2, 256-math.Floor(math.Log2(powLimitF)))
 	blake256Pad := generateBlake256Pad()
 	maxGenTime := new(big.Int).SetUint64(20)
 	poolDiffs, err := NewDifficultySet(chaincfg.SimNetParams(),
-		new(big.Rat).SetInt(powLimit), maxGenTime)
+		new(big.Rat).SetInt(powLimit), maxGenTime, 0)
 	if err != nil {
 		t.Fatalf("[NewPoolDifficulty] unexpected error: %v", err)
 	}
@@ -95,6 +107,7 @@ func testClient(t *testing.T, db *bolt.DB) {
 		currentWork = work
 		currentWorkMtx.Unlock()
 	}
+	registry := newClientRegistry()
 	cCfg := &ClientConfig{
 		ActiveNet:       chaincfg.SimNetParams(),
 		DB:              db,
@@ -105,22 +118,36 @@ func testClient(t *testing.T, db *bolt.DB) {
 			defer minerMtx.RUnlock()
 			return miner
 		},
-		SoloPool:       false,
-		DifficultyInfo: diffInfo,
-		EndpointWg:     new(sync.WaitGroup),
-		RemoveClient:   func(c *Client) {},
-		SubmitWork: func(submission *string) (bool, error) {
-			return false, nil
+		SoloPool:         false,
+		DifficultyInfo:   diffInfo,
+		RegisterClient:   registry.register,
+		DeregisterClient: registry.deregister,
+		RemoveClient:     func(c *Client) {},
+		SubmitWork: func(submission *string) (bool, string, error) {
+			return false, "", nil
 		},
-		FetchCurrentWork: func() string {
+		FetchCurrentWork: func() *CurrentWork {
 			currentWorkMtx.RLock()
 			defer currentWorkMtx.RUnlock()
-			return currentWork
+			return &CurrentWork{Header: currentWork}
 		},
-		WithinLimit: func(ip string, clientType int) bool {
+		WithinLimit: func(ip string, class int, shareRate float64) bool {
 			return true
 		},
 		HashCalcThreshold: 1,
+		Events:            NewEventBus(),
+		FetchMinerPolicy: func() string {
+			policyMtx.RLock()
+			defer policyMtx.RUnlock()
+			return policy
+		},
+		WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+			return 0
+		},
+		IsTraced: func(string, string) bool {
+			return false
+		},
+		Sessions: NewSessionStore(),
 	}
 	client, err := NewClient(c, tcpAddr, cCfg)
 	if err != nil {
@@ -132,7 +159,7 @@ func testClient(t *testing.T, db *bolt.DB) {
 	time.Sleep(time.Millisecond * 50)
 
 	sE := json.NewEncoder(s)
-	sR := bufio.NewReaderSize(s, MaxMessageSize)
+	sR := bufio.NewReaderSize(s, MaxReadMessageSize)
 
 	recvCh := make(chan []byte)
 	go func() {
@@ -179,20 +206,78 @@ func testClient(t *testing.T, db *bolt.DB) {
 		}
 	}()
 
-	// Send an authorize request.
+	// expectSubmitError sends a work submission and ensures it is refused
+	// with the provided stratum error code.
+	expectSubmitError := func(id uint64, code uint32) {
+		sub := SubmitWorkRequest(&id, "tcl", "job", "00000000",
+			"954cee5d", "6ddf0200")
+		err := sE.Encode(sub)
+		if err != nil {
+			t.Fatalf("[Encode] unexpected error: %v", err)
+		}
+		msg, mType, err := IdentifyMessage(<-recvCh)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		if mType != ResponseMessage {
+			t.Fatalf("expected a submit response message, got %v", mType)
+		}
+		status, sErr, err := ParseSubmitWorkResponse(msg.(*Response))
+		if err != nil {
+			t.Fatalf("[ParseSubmitWorkResponse] unexpected error: %v", err)
+		}
+		if status || sErr == nil || sErr.Code != code {
+			t.Fatalf("expected a submit error with code %d, got %v",
+				code, sErr)
+		}
+	}
+
+	// Ensure work submissions of unauthorized clients are refused.
 	id := uint64(1)
+	expectSubmitError(id, UnauthorizedWorker)
+
+	// Ensure authorize requests of rejected miner types are refused.
+	setPolicy(PolicyReject)
+	id++
 	r := AuthorizeRequest(&id, "mn", "SsiuwSRYvH7pqWmRxFJWR8Vmqc3AWsjmK2Y")
 	err = sE.Encode(r)
 	if err != nil {
 		t.Fatalf("[Encode] unexpected error: %v", err)
 	}
-
-	// Ensure an authorize response was sent back.
 	data := <-recvCh
 	msg, mType, err := IdentifyMessage(data)
 	if err != nil {
 		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
 	}
+	if mType != ResponseMessage {
+		t.Fatalf("expected an auth response message, got %v", mType)
+	}
+	status, sErr, err := ParseAuthorizeResponse(msg.(*Response))
+	if err != nil {
+		t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+	}
+	if status || sErr == nil || sErr.Code != MinerRejected {
+		t.Fatalf("expected a miner rejected error, got %v", sErr)
+	}
+	setPolicy(PolicyAllow)
+
+	// Discard the difficulty notification sent after the request.
+	<-recvCh
+
+	// Send an authorize request.
+	id++
+	r = AuthorizeRequest(&id, "mn", "SsiuwSRYvH7pqWmRxFJWR8Vmqc3AWsjmK2Y")
+	err = sE.Encode(r)
+	if err != nil {
+		t.Fatalf("[Encode] unexpected error: %v", err)
+	}
+
+	// Ensure an authorize response was sent back.
+	data = <-recvCh
+	msg, mType, err = IdentifyMessage(data)
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
 
 	if mType != ResponseMessage {
 		t.Fatalf("expected an auth response message, got %v", mType)
@@ -227,6 +312,42 @@ func testClient(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected %s message method, got %s", SetDifficulty, req.Method)
 	}
 
+	// Ensure work submissions of unsubscribed clients are refused.
+	id++
+	expectSubmitError(id, NotSubscribed)
+
+	// Ensure repeated authorizations of the authorized worker succeed and
+	// authorizations of other workers are refused.
+	for _, tc := range []struct {
+		name   string
+		status bool
+	}{
+		{"mn", true},
+		{"other", false},
+	} {
+		id++
+		r = AuthorizeRequest(&id, tc.name, "SsiuwSRYvH7pqWmRxFJWR8Vmqc3AWsjmK2Y")
+		err = sE.Encode(r)
+		if err != nil {
+			t.Fatalf("[Encode] unexpected error: %v", err)
+		}
+		msg, _, err = IdentifyMessage(<-recvCh)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		status, sErr, err := ParseAuthorizeResponse(msg.(*Response))
+		if err != nil {
+			t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+		}
+		if status != tc.status {
+			t.Fatalf("expected authorize status %v for %s, got %v (%v)",
+				tc.status, tc.name, status, sErr)
+		}
+
+		// Discard the difficulty notification sent after the request.
+		<-recvCh
+	}
+
 	// Send a subscribe request.
 	setMiner(WhatsminerD1)
 	id++
@@ -294,6 +415,26 @@ func testClient(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected suscribe response with id %d, got %d", *r.ID, resp.ID)
 	}
 
+	// Ensure repeated subscriptions are answered with the established
+	// subscription.
+	id++
+	r = SubscribeRequest(&id, "mcpu", "1.0.1", "mn002")
+	err = sE.Encode(r)
+	if err != nil {
+		t.Fatalf("[Encode] unexpected error: %v", err)
+	}
+	msg, _, err = IdentifyMessage(<-recvCh)
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	_, nid, _, _, err := ParseSubscribeResponse(msg.(*Response))
+	if err != nil {
+		t.Fatalf("[ParseSubscribeResponse] unexpected error: %v", err)
+	}
+	if nid != "mn001" {
+		t.Fatalf("expected the established subscription mn001, got %s", nid)
+	}
+
 	// Ensure the client is authorized and subscribed for work updates.
 	client.authorizedMtx.Lock()
 	authorized := client.authorized
@@ -311,6 +452,21 @@ func testClient(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected a subscribed mining client")
 	}
 
+	// Ensure no shares are claimed for miner types accepted without reward.
+	setPolicy(PolicyNoReward)
+	err = client.claimWeightedShare(client.fetchDifficultyInfo().multiplier, false)
+	if err != nil {
+		t.Fatalf("[claimWeightedShare] unexpected error: %v", err)
+	}
+	shares, err := PPLNSEligibleShares(db, nanoToBigEndianBytes(0))
+	if err != nil {
+		t.Fatalf("[PPLNSEligibleShares] unexpected error: %v", err)
+	}
+	if len(shares) != 0 {
+		t.Fatalf("expected no shares claimed, got %d", len(shares))
+	}
+	setPolicy(PolicyAllow)
+
 	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
 		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
 		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
@@ -599,6 +755,95 @@ func testClient(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected %s message method, got %s", Notify, req.Method)
 	}
 
+	// Ensure queued work notifications are delivered.
+	client.queueWork(r, 0)
+	msg, _, err = IdentifyMessage(<-recvCh)
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	req, ok = msg.(*Request)
+	if !ok || req.Method != Notify {
+		t.Fatalf("expected a %s message", Notify)
+	}
+
+	// Ensure headers of superseded chain tips are flagged stale unless
+	// within the stale job window.
+	workD, err := hex.DecodeString(workE[:360])
+	if err != nil {
+		t.Fatalf("[DecodeString] unexpected error: %v", err)
+	}
+	var header wire.BlockHeader
+	err = header.FromBytes(workD)
+	if err != nil {
+		t.Fatalf("[FromBytes] unexpected error: %v", err)
+	}
+	stale, err := client.isStaleHeader(&header)
+	if err != nil {
+		t.Fatalf("[isStaleHeader] unexpected error: %v", err)
+	}
+	if stale {
+		t.Fatal("expected a header of the current tip to not be stale")
+	}
+	header.Height--
+	header.PrevBlock[0] ^= 0xff
+	stale, err = client.isStaleHeader(&header)
+	if err != nil {
+		t.Fatalf("[isStaleHeader] unexpected error: %v", err)
+	}
+	if !stale {
+		t.Fatal("expected a header of a superseded tip to be stale")
+	}
+	client.cfg.StaleJobWindow = 2
+	stale, err = client.isStaleHeader(&header)
+	if err != nil {
+		t.Fatalf("[isStaleHeader] unexpected error: %v", err)
+	}
+	if stale {
+		t.Fatal("expected a header within the stale job window to " +
+			"not be stale")
+	}
+	header.Height += 2
+	stale, err = client.isStaleHeader(&header)
+	if err != nil {
+		t.Fatalf("[isStaleHeader] unexpected error: %v", err)
+	}
+	if !stale {
+		t.Fatal("expected a header above the current height to be stale")
+	}
+
+	// Ensure tips up to and including the stale job window below the
+	// current height are accepted, and a zero window rejects all of them.
+	var tip wire.BlockHeader
+	err = tip.FromBytes(workD)
+	if err != nil {
+		t.Fatalf("[FromBytes] unexpected error: %v", err)
+	}
+	windowTests := []struct {
+		window uint32
+		below  uint32
+		stale  bool
+	}{
+		{window: 0, below: 0, stale: true},
+		{window: 0, below: 1, stale: true},
+		{window: 1, below: 0, stale: false},
+		{window: 1, below: 1, stale: false},
+		{window: 1, below: 2, stale: true},
+	}
+	for _, test := range windowTests {
+		client.cfg.StaleJobWindow = test.window
+		header.Height = tip.Height - test.below
+		stale, err = client.isStaleHeader(&header)
+		if err != nil {
+			t.Fatalf("[isStaleHeader] unexpected error: %v", err)
+		}
+		if stale != test.stale {
+			t.Fatalf("expected a tip %d block(s) below with a stale job "+
+				"window of %d to have stale %v, got %v", test.below,
+				test.window, test.stale, stale)
+		}
+	}
+	client.cfg.StaleJobWindow = 0
+
 	// Fake a bunch of submissions and calculate the hash rate.
 	setMiner(CPU)
 	atomic.StoreInt64(&client.submissions, 50)
@@ -613,7 +858,2932 @@ func testClient(t *testing.T, db *bolt.DB) {
 	if err != nil {
 		t.Fatalf("emptyBucket error: %v", err)
 	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
 
 	cancel()
-	client.cfg.EndpointWg.Wait()
+	if !registry.wait(time.Second * 5) {
+		t.Fatal("expected the client to deregister")
+	}
+}
+
+func testWorkCoalescing(t *testing.T) {
+	client := &Client{
+		cfg:    &ClientConfig{},
+		workCh: make(chan struct{}, 1),
+	}
+	notif := func(jobID string, clean bool) *Request {
+		return WorkNotification(jobID, "prevblock", "gentx1", "gentx2",
+			"version", "nbits", "ntime", clean)
+	}
+	pendingJob := func() string {
+		jobID, _, _, _, _, _, _, _, err := ParseWorkNotification(client.work)
+		if err != nil {
+			t.Fatalf("[ParseWorkNotification] unexpected error: %v", err)
+		}
+		return jobID
+	}
+
+	// Ensure newer non-clean notifications replace pending ones.
+	client.queueWork(notif("a", false), 0)
+	client.queueWork(notif("b", false), 0)
+	if pendingJob() != "b" {
+		t.Fatalf("expected pending job b, got %s", pendingJob())
+	}
+
+	// Ensure clean notifications replace pending non-clean ones.
+	client.queueWork(notif("c", true), 0)
+	if pendingJob() != "c" {
+		t.Fatalf("expected pending job c, got %s", pendingJob())
+	}
+
+	// Ensure non-clean notifications do not replace pending clean ones.
+	client.queueWork(notif("d", false), 0)
+	if pendingJob() != "c" {
+		t.Fatalf("expected pending job c, got %s", pendingJob())
+	}
+
+	coalesced := atomic.LoadInt64(&client.coalesced)
+	if coalesced != 3 {
+		t.Fatalf("expected 3 coalesced notifications, got %d", coalesced)
+	}
+	if len(client.workCh) != 1 {
+		t.Fatal("expected a pending work signal")
+	}
+}
+
+func testDropRate(t *testing.T) {
+	events := NewEventBus()
+	sub := events.Subscribe(10, EventClientDropRate)
+	defer events.Unsubscribe(sub)
+	conn, _ := net.Pipe()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, &ClientConfig{
+		FetchMiner: func() string {
+			return CPU
+		},
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt64(1),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   new(big.Rat).SetInt64(1),
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		Sessions: NewSessionStore(),
+		Events:   events,
+	})
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+	notif := WorkNotification("job", "prevblock", "gentx1", "gentx2",
+		"version", "nbits", "ntime", true)
+	expectWarnings := func(n int) {
+		if len(sub.Events()) != n {
+			t.Fatalf("expected %d drop rate warnings, got %d", n,
+				len(sub.Events()))
+		}
+	}
+
+	// Ensure outdated work notifications are counted as dropped without a
+	// warning until enough notifications were offered.
+	client.queueWork(notif, 5)
+	for i := 0; i < int(minDropRateSamples)-2; i++ {
+		if client.queueWork(notif, 4) {
+			t.Fatal("expected an outdated notification to be dropped")
+		}
+	}
+	if atomic.LoadInt64(&client.dropped) != minDropRateSamples-2 {
+		t.Fatalf("expected %d dropped notifications, got %d",
+			minDropRateSamples-2, atomic.LoadInt64(&client.dropped))
+	}
+	expectWarnings(0)
+
+	// Ensure a single warning is published once the drop rate crosses the
+	// threshold.
+	client.queueWork(notif, 4)
+	client.queueWork(notif, 4)
+	expectWarnings(1)
+	event := <-sub.Events()
+	if event.ClientID != client.id || event.Reason == "" {
+		t.Fatalf("unexpected drop rate warning %+v", event)
+	}
+
+	// Ensure the warning is rearmed once the drop rate falls below the
+	// threshold.
+	for i := 0; i < int(minDropRateSamples)*10; i++ {
+		client.queueWork(notif, 5)
+	}
+	if atomic.LoadUint32(&client.dropWarned) != 0 {
+		t.Fatal("expected the drop rate warning to be rearmed")
+	}
+	for i := 0; i < int(minDropRateSamples)*2; i++ {
+		client.queueWork(notif, 4)
+	}
+	expectWarnings(1)
+
+	// Ensure the audit record of the connection includes its counters.
+	record := client.connectionRecord(DisconnectByPool.String())
+	if record.Dropped != atomic.LoadInt64(&client.dropped) ||
+		record.Coalesced != atomic.LoadInt64(&client.coalesced) ||
+		record.WriteFailures != 0 {
+		t.Fatalf("unexpected connection record counters %+v", record)
+	}
+}
+
+func testResponseDispatch(t *testing.T) {
+	conn, _ := net.Pipe()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, &ClientConfig{
+		FetchMiner: func() string {
+			return CPU
+		},
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt64(1),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   new(big.Rat).SetInt64(1),
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		Sessions: NewSessionStore(),
+		Events:   NewEventBus(),
+	})
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+	send := func(newRequest func(*uint64) *Request) uint64 {
+		id := client.sendRequest(newRequest)
+		req := (<-client.ch).(*Request)
+		if req.ID == nil || *req.ID != id {
+			t.Fatalf("expected a request with id %d, got %v", id, req.ID)
+		}
+		return id
+	}
+	// respond dispatches the response to the request with the provided id
+	// as read from the client.
+	respond := func(id uint64, result interface{}, sErr *StratumError) {
+		data, err := json.Marshal(NewResponse(id, result, sErr))
+		if err != nil {
+			t.Fatalf("[Marshal] unexpected error: %v", err)
+		}
+		msg, _, err := IdentifyMessage(data)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		client.handleResponse(msg.(*Response))
+	}
+	pending := func() int {
+		client.reqMtx.Lock()
+		defer client.reqMtx.Unlock()
+		return len(client.req)
+	}
+
+	// Ensure version responses record the version of the client and clear
+	// the pending request.
+	id := send(GetVersionRequest)
+	respond(id, "cpuminer/2.5.0", nil)
+	if client.fetchVersion() != "cpuminer/2.5.0" || pending() != 0 {
+		t.Fatalf("expected the reported version, got %q",
+			client.fetchVersion())
+	}
+
+	// Ensure refused version requests are not protocol errors.
+	id = send(GetVersionRequest)
+	respond(id, nil, NewStratumError(Unknown, nil))
+	if atomic.LoadUint32(&client.protocolErrors) != 0 {
+		t.Fatal("expected a refused version request not to be a " +
+			"protocol error")
+	}
+
+	// Ensure keepalive responses record the round trip time.
+	id = send(PingRequest)
+	time.Sleep(time.Millisecond)
+	respond(id, "pong", nil)
+	if time.Duration(atomic.LoadInt64(&client.keepAliveRTT)) < time.Millisecond {
+		t.Fatal("expected the keepalive round trip time to be recorded")
+	}
+
+	// Ensure unmatched, duplicate and unexpected responses are dropped
+	// without disconnecting the client.
+	respond(1000, "pong", nil)
+	respond(id, "pong", nil)
+	id = send(func(id *uint64) *Request {
+		return NewRequest(id, "mining.unknown", []string{})
+	})
+	respond(id, true, nil)
+	if client.ctx.Err() != nil || pending() != 0 {
+		t.Fatal("expected the responses to be dropped")
+	}
+
+	// Ensure late responses are dropped and expired pending requests are
+	// discarded once the next request is sent.
+	expire := func(id uint64) {
+		client.reqMtx.Lock()
+		client.req[id].sent = time.Now().Add(-pendingRequestTimeout)
+		client.reqMtx.Unlock()
+	}
+	id = send(GetVersionRequest)
+	expire(id)
+	respond(id, "cpuminer/3.0.0", nil)
+	if client.fetchVersion() != "cpuminer/2.5.0" {
+		t.Fatal("expected the late response to be dropped")
+	}
+	for i := 0; i < 3; i++ {
+		expire(send(PingRequest))
+	}
+	send(PingRequest)
+	if pending() != 1 {
+		t.Fatalf("expected expired requests to be discarded, got %d "+
+			"pending", pending())
+	}
+
+	// Ensure malformed responses disconnect the client once the protocol
+	// error limit is reached.
+	for i := uint32(0); i < maxProtocolErrors; i++ {
+		if client.ctx.Err() != nil {
+			t.Fatalf("expected the client to be disconnected after %d "+
+				"protocol errors, got %d", maxProtocolErrors, i)
+		}
+		respond(send(GetVersionRequest), 5, nil)
+	}
+	if client.ctx.Err() == nil ||
+		client.disconnectReason() != DisconnectProtocolError {
+		t.Fatal("expected the client to be disconnected for protocol errors")
+	}
+}
+
+func testConcurrentAuthorization(t *testing.T, db *bolt.DB) {
+	address := "Ssj6Sd54j11JM8qpenCwfwnKD73dsjm68ru"
+	countAccounts := func() int {
+		var count int
+		err := db.View(func(tx *bolt.Tx) error {
+			bkt, err := fetchAccountBucket(tx)
+			if err != nil {
+				return err
+			}
+			count = bkt.Stats().KeyN
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to count accounts: %v", err)
+		}
+		return count
+	}
+	initial := countAccounts()
+
+	// Ensure concurrent authorizations of clients of the same address
+	// succeed and create a single account.
+	cCfg := &ClientConfig{
+		ActiveNet: chaincfg.SimNetParams(),
+		DB:        db,
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		Events: NewEventBus(),
+	}
+	clients := make([]*Client, 100)
+	reqs := make([]*Request, len(clients))
+	for i := range reqs {
+		id := uint64(i)
+		r := AuthorizeRequest(&id, fmt.Sprintf("mn%d", i), address)
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("[Marshal] unexpected error: %v", err)
+		}
+		msg, _, err := IdentifyMessage(data)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		reqs[i] = msg.(*Request)
+	}
+	var wg sync.WaitGroup
+	for i := range clients {
+		clientID := fmt.Sprintf("%08x/%s", i, CPU)
+		client := &Client{
+			id:     clientID,
+			addr:   &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			cfg:    cCfg,
+			ctx:    context.Background(),
+			ch:     make(chan Message, 1),
+			logger: newClientLogger(clientID, CPU, "127.0.0.1", nil),
+		}
+		clients[i] = client
+		wg.Add(1)
+		go func(r *Request) {
+			defer wg.Done()
+			client.handleAuthorizeRequest(r, true)
+		}(reqs[i])
+	}
+	wg.Wait()
+
+	for _, client := range clients {
+		msg := <-client.ch
+		status, sErr, err := ParseAuthorizeResponse(msg.(*Response))
+		if err != nil {
+			t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+		}
+		if !status {
+			t.Fatalf("expected an authorized client, got %v", sErr)
+		}
+	}
+	if count := countAccounts(); count != initial+1 {
+		t.Fatalf("expected a single account created, got %d",
+			count-initial)
+	}
+
+	// Ensure creating an existing account returns the existing record.
+	id, err := AccountID(address, chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatalf("[AccountID] unexpected error: %v", err)
+	}
+	existing, err := FetchAccount(db, []byte(id))
+	if err != nil {
+		t.Fatalf("[FetchAccount] unexpected error: %v", err)
+	}
+	account := &Account{UUID: id, Address: address}
+	err = account.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	if account.CreatedOn != existing.CreatedOn {
+		t.Fatalf("expected the existing account created on %d, got %d",
+			existing.CreatedOn, account.CreatedOn)
+	}
+
+	err = account.Delete(db)
+	if err != nil {
+		t.Fatalf("[Delete] unexpected error: %v", err)
+	}
+}
+
+func testSessionResumption(t *testing.T, db *bolt.DB) {
+	var optionsSet int
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	sessions := NewSessionStore()
+	cCfg := &ClientConfig{
+		ActiveNet:   chaincfg.SimNetParams(),
+		DB:          db,
+		Blake256Pad: generateBlake256Pad(),
+		FetchMiner: func() string {
+			return CPU
+		},
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 256)),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   powLimit,
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		RemoveClient:     func(*Client) {},
+		DeregisterClient: func(*Client) {},
+		SubmitWork: func(*string) (bool, string, error) {
+			return false, "", nil
+		},
+		FetchCurrentWork: func() *CurrentWork {
+			return nil
+		},
+		Events: NewEventBus(),
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+			return 0
+		},
+		Sessions:          sessions,
+		RecordAuthFailure: func(string) {},
+		SetAccountOptions: func(string, *AccountOptions) (*AccountOptions, error) {
+			optionsSet++
+			return &AccountOptions{}, nil
+		},
+	}
+	newClient := func() *Client {
+		conn, _ := net.Pipe()
+		addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+		client, err := NewClient(conn, addr, cCfg)
+		if err != nil {
+			t.Fatalf("[NewClient] unexpected error: %v", err)
+		}
+		return client
+	}
+	request := func(r *Request) *Request {
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("[Marshal] unexpected error: %v", err)
+		}
+		msg, _, err := IdentifyMessage(data)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		return msg.(*Request)
+	}
+	id := uint64(1)
+	setup := func(client *Client, nid string) {
+		client.handleSubscribeRequest(request(SubscribeRequest(&id,
+			"mcpu", "1.0.1", nid)), true)
+		<-client.ch
+		client.handleAuthorizeRequest(request(AuthorizeRequest(&id,
+			"mn", xAddr)), true)
+		msg := <-client.ch
+		status, sErr, err := ParseAuthorizeResponse(msg.(*Response))
+		if err != nil {
+			t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+		}
+		if !status {
+			t.Fatalf("expected an authorized client, got %v", sErr)
+		}
+	}
+
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+	job, err := NewJob(workE, 41)
+	if err != nil {
+		t.Fatalf("[NewJob] unexpected error: %v", err)
+	}
+	err = job.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+
+	// Ensure extraNonce1s of connected clients are reserved.
+	client := newClient()
+	if sessions.reserve(client.extraNonce1) {
+		t.Fatal("expected the client's extraNonce1 to be reserved")
+	}
+	setup(client, "")
+	extraNonce1 := client.extraNonce1
+	nid := client.notifyID
+	header, err := GenerateSolvedBlockHeader(job.Header, extraNonce1,
+		"00000000", ExtraNonce2Size, "954cee5d", "6ddf0200", CPU)
+	if err != nil {
+		t.Fatalf("[GenerateSolvedBlockHeader] unexpected error: %v", err)
+	}
+
+	// Ensure a reconnecting client resumes the extraNonce1, authorization
+	// and delivery counters of its session.
+	atomic.StoreInt64(&client.coalesced, 3)
+	atomic.StoreInt64(&client.dropped, 2)
+	atomic.StoreInt64(&client.writeFailures, 1)
+	client.shutdown()
+	resumed := newClient()
+	setup(resumed, nid)
+	if resumed.extraNonce1 != extraNonce1 {
+		t.Fatalf("expected resumed extraNonce1 %s, got %s", extraNonce1,
+			resumed.extraNonce1)
+	}
+	if resumed.account != xID || resumed.notifyID != nid {
+		t.Fatalf("expected a resumed session of account %s, got %s",
+			xID, resumed.account)
+	}
+	if atomic.LoadInt64(&resumed.coalesced) != 3 ||
+		atomic.LoadInt64(&resumed.dropped) != 2 ||
+		atomic.LoadInt64(&resumed.writeFailures) != 1 {
+		t.Fatalf("expected the resumed session's counters, got %+v",
+			resumed.connectionRecord(""))
+	}
+
+	// Ensure work submitted against a job issued before the disconnect
+	// still validates and is credited.
+	resumedHeader, err := GenerateSolvedBlockHeader(job.Header,
+		resumed.extraNonce1, "00000000", ExtraNonce2Size, "954cee5d",
+		"6ddf0200", CPU)
+	if err != nil {
+		t.Fatalf("[GenerateSolvedBlockHeader] unexpected error: %v", err)
+	}
+	if resumedHeader.BlockHash() != header.BlockHash() {
+		t.Fatal("expected the resumed client to solve the same header")
+	}
+	resumed.handleSubmitWorkRequest(request(SubmitWorkRequest(&id, "tcl",
+		job.UUID, "00000000", "954cee5d", "6ddf0200")), true,
+		resumed.fetchDifficultyInfo())
+	<-resumed.ch
+	shares, err := PPLNSEligibleShares(db, nanoToBigEndianBytes(0))
+	if err != nil {
+		t.Fatalf("[PPLNSEligibleShares] unexpected error: %v", err)
+	}
+	if len(shares) != 1 || shares[0].Account != xID {
+		t.Fatalf("expected a share credited to account %s, got %d "+
+			"shares", xID, len(shares))
+	}
+
+	// Ensure unknown and expired sessions are not resumed.
+	fresh := newClient()
+	setup(fresh, "unknown")
+	if fresh.extraNonce1 != fresh.idNonce {
+		t.Fatal("expected an unknown session to not be resumed")
+	}
+	if atomic.LoadInt64(&fresh.coalesced) != 0 ||
+		atomic.LoadInt64(&fresh.dropped) != 0 {
+		t.Fatal("expected a fresh client's counters to start at zero")
+	}
+	sessionTTL = 0
+	resumed.shutdown()
+	time.Sleep(time.Millisecond)
+	if _, ok := sessions.resume(nid, CPU); ok {
+		t.Fatal("expected an expired session to not be resumed")
+	}
+	if !sessions.reserve(extraNonce1) {
+		t.Fatal("expected the extraNonce1 of an expired session to be " +
+			"released")
+	}
+	sessionTTL = time.Minute * 2
+
+	// Ensure clients resuming the session of a locked account are refused
+	// without a valid authorization token, and verified with one.
+	secret, err := newLockSecret()
+	if err != nil {
+		t.Fatalf("[newLockSecret] unexpected error: %v", err)
+	}
+	err = persistAccountSettings(db, xID, &AccountSettings{
+		Locked:     true,
+		LockSecret: secret,
+	})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	authorize := func(client *Client, password string) (bool, *StratumError) {
+		client.handleAuthorizeRequest(request(&Request{
+			ID:     &id,
+			Method: Authorize,
+			Params: []string{xAddr + ".mn", password},
+		}), true)
+		status, sErr, err := ParseAuthorizeResponse((<-client.ch).(*Response))
+		if err != nil {
+			t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+		}
+		return status, sErr
+	}
+	setOption := func(client *Client) *StratumError {
+		payout := 1.0
+		client.handleSetOptionRequest(request(SetOptionRequest(&id,
+			&AccountOptions{MinPayout: &payout})), true)
+		_, sErr, err := ParseSetOptionResponse((<-client.ch).(*Response))
+		if err != nil {
+			t.Fatalf("[ParseSetOptionResponse] unexpected error: %v", err)
+		}
+		return sErr
+	}
+	subscribe := func(client *Client, nid string) {
+		client.handleSubscribeRequest(request(SubscribeRequest(&id,
+			"mcpu", "1.0.1", nid)), true)
+		<-client.ch
+	}
+	verified := newClient()
+	subscribe(verified, "locked")
+	token := generateAuthToken(secret, xID, time.Now().Add(time.Hour))
+	status, sErr := authorize(verified, token)
+	if !status || !verified.verified {
+		t.Fatalf("expected a verified client, got %v", sErr)
+	}
+	verified.shutdown()
+	resumed = newClient()
+	subscribe(resumed, "locked")
+	if resumed.extraNonce1 != verified.extraNonce1 {
+		t.Fatal("expected the session of the verified client to be resumed")
+	}
+	status, sErr = authorize(resumed, "")
+	if status || sErr == nil || sErr.Code != AuthTokenRequired {
+		t.Fatalf("expected an authorization token required error, got %v",
+			sErr)
+	}
+	if resumed.isAuthorized() {
+		t.Fatal("expected the resuming client to not be authorized")
+	}
+	status, sErr = authorize(resumed, token)
+	if !status || !resumed.verified {
+		t.Fatalf("expected a verified client, got %v", sErr)
+	}
+	sErr = setOption(resumed)
+	if sErr != nil || optionsSet != 1 {
+		t.Fatalf("unexpected set option error: %v", sErr)
+	}
+	resumed.shutdown()
+
+	// Ensure clients resuming the session of a verified client without an
+	// authorization token are not verified.
+	err = persistAccountSettings(db, xID, &AccountSettings{})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	resumed = newClient()
+	subscribe(resumed, "locked")
+	status, sErr = authorize(resumed, "")
+	if !status {
+		t.Fatalf("unexpected authorize error: %v", sErr)
+	}
+	sErr = setOption(resumed)
+	if sErr == nil || sErr.Code != AccountNotVerified {
+		t.Fatalf("expected an account not verified error, got %v", sErr)
+	}
+	if optionsSet != 1 {
+		t.Fatal("expected the options of the account to be unchanged")
+	}
+	resumed.shutdown()
+
+	err = emptyBucket(db, accountSettingsBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, shareBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
+
+func testDifficultyUpdates(t *testing.T) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	poolDiffs, err := NewDifficultySet(chaincfg.SimNetParams(), powLimit,
+		new(big.Int).SetUint64(20), 0)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error: %v", err)
+	}
+	diffInfo, err := poolDiffs.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	scaled, err := poolDiffs.fetchScaledMinerDifficulty(CPU, 2)
+	if err != nil {
+		t.Fatalf("[fetchScaledMinerDifficulty] unexpected error: %v", err)
+	}
+	difficulty := new(big.Rat).Set(diffInfo.difficulty)
+	cCfg := &ClientConfig{
+		FetchMiner: func() string {
+			return CPU
+		},
+		DifficultyInfo: diffInfo,
+		Sessions:       NewSessionStore(),
+	}
+	newClient := func() *Client {
+		conn, _ := net.Pipe()
+		addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+		client, err := NewClient(conn, addr, cCfg)
+		if err != nil {
+			t.Fatalf("[NewClient] unexpected error: %v", err)
+		}
+		return client
+	}
+	client := newClient()
+	other := newClient()
+
+	// Ensure difficulty updates of a client are safe while the client
+	// reads its difficulty concurrently.
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if i%2 == 0 {
+				client.setDifficultyInfo(scaled)
+				continue
+			}
+			client.setDifficultyInfo(diffInfo)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			client.setDifficulty()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			info := client.fetchDifficultyInfo()
+			info.difficulty.Mul(info.difficulty, info.multiplier)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		<-client.ch
+	}
+	wg.Wait()
+
+	// Ensure updating the difficulty of a client does not affect other
+	// clients or the shared difficulty info.
+	client.setDifficultyInfo(scaled)
+	if client.fetchDifficultyInfo().difficulty.Cmp(scaled.difficulty) != 0 {
+		t.Fatalf("expected client difficulty %v, got %v", scaled.difficulty,
+			client.fetchDifficultyInfo().difficulty)
+	}
+	if other.fetchDifficultyInfo().difficulty.Cmp(difficulty) != 0 {
+		t.Fatalf("expected other client difficulty %v, got %v", difficulty,
+			other.fetchDifficultyInfo().difficulty)
+	}
+	if diffInfo.difficulty.Cmp(difficulty) != 0 {
+		t.Fatalf("expected shared difficulty %v, got %v", difficulty,
+			diffInfo.difficulty)
+	}
+
+	// Ensure difficulties set below the floor are raised to the floor and
+	// the client is notified of the raised difficulty.
+	floor := new(big.Rat).Mul(difficulty, new(big.Rat).SetInt64(2))
+	low := diffInfo.copy()
+	low.floor = floor
+	client.setDifficultyInfo(low)
+	info := client.fetchDifficultyInfo()
+	if info.difficulty.Cmp(floor) != 0 {
+		t.Fatalf("expected the client difficulty raised to %v, got %v",
+			floor, info.difficulty)
+	}
+	if info.target.Cmp(new(big.Rat).Quo(powLimit, floor)) != 0 {
+		t.Fatalf("expected the target of the difficulty floor, got %v",
+			info.target)
+	}
+	if info.multiplier.Cmp(new(big.Rat).SetInt64(2)) != 0 {
+		t.Fatalf("expected a multiplier of 2, got %v", info.multiplier)
+	}
+	client.setDifficulty()
+	notif := (<-client.ch).(*Request)
+	if notif.Method != SetDifficulty {
+		t.Fatalf("expected a set difficulty notification, got %s",
+			notif.Method)
+	}
+	notified, _ := floor.Float64()
+	if params := notif.Params.([]uint64); params[0] != uint64(notified) {
+		t.Fatalf("expected a notified difficulty of %v, got %v", notified,
+			params[0])
+	}
+
+	// Ensure the initial difficulty of a new client respects the floor.
+	cCfg.DifficultyInfo = low
+	fresh := newClient()
+	if fresh.fetchDifficultyInfo().difficulty.Cmp(floor) != 0 {
+		t.Fatalf("expected an initial difficulty of %v, got %v", floor,
+			fresh.fetchDifficultyInfo().difficulty)
+	}
+	if low.difficulty.Cmp(difficulty) != 0 {
+		t.Fatalf("expected the provided difficulty info to be unchanged")
+	}
+}
+
+func testClientWriteTimeout(t *testing.T) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	poolDiffs, err := NewDifficultySet(chaincfg.SimNetParams(), powLimit,
+		new(big.Int).SetUint64(20), 0)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error: %v", err)
+	}
+	diffInfo, err := poolDiffs.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	removed := make(chan struct{})
+	registry := newClientRegistry()
+	cCfg := &ClientConfig{
+		FetchMiner: func() string {
+			return CPU
+		},
+		DifficultyInfo:    diffInfo,
+		RegisterClient:    registry.register,
+		DeregisterClient:  registry.deregister,
+		HashCalcThreshold: 1,
+		WriteTimeout:      time.Millisecond * 100,
+		Sessions:          NewSessionStore(),
+		RemoveClient: func(*Client) {
+			close(removed)
+		},
+	}
+
+	// The peer of the pipe never reads, writes to it block until the
+	// write deadline elapses.
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, cCfg)
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+	go client.run(client.ctx)
+
+	// Ensure a client that stops reading is torn down once its write
+	// deadline elapses instead of blocking its sender.
+	client.queueMessage(SubscribeResponse(1, "mn1", client.extraNonce1,
+		ExtraNonce2Size, nil))
+	select {
+	case <-removed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the blocked client to be torn down")
+	}
+}
+
+func testMessageQueueing(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, &ClientConfig{
+		FetchMiner: func() string {
+			return CPU
+		},
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt64(1),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   new(big.Rat).SetInt64(1),
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		Sessions: NewSessionStore(),
+	})
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+
+	// Ensure messages are queued without waiting on the send loop of the
+	// client.
+	queued := make(chan struct{})
+	go func() {
+		client.queueMessage(AuthorizeResponse(1, true, nil))
+		client.setDifficulty()
+		close(queued)
+	}()
+	select {
+	case <-queued:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected messages to be queued without a send loop")
+	}
+
+	// Ensure queued messages are flushed to the client in order.
+	go client.flushMessages()
+	reader := bufio.NewReader(peer)
+	for _, method := range []string{"", SetDifficulty} {
+		data, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("[ReadBytes] unexpected error: %v", err)
+		}
+		msg, _, err := IdentifyMessage(data)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		switch m := msg.(type) {
+		case *Response:
+			if method != "" {
+				t.Fatalf("expected a %s notification, got a response",
+					method)
+			}
+		case *Request:
+			if m.Method != method {
+				t.Fatalf("expected a %s notification, got %s", method,
+					m.Method)
+			}
+		}
+	}
+}
+
+func testMessageSizeLimits(t *testing.T) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	poolDiffs, err := NewDifficultySet(chaincfg.SimNetParams(), powLimit,
+		new(big.Int).SetUint64(20), 0)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error: %v", err)
+	}
+	diffInfo, err := poolDiffs.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	cCfg := &ClientConfig{
+		FetchMiner: func() string {
+			return CPU
+		},
+		DifficultyInfo: diffInfo,
+		MaxInFlight:    4,
+		MaxReadSize:    400,
+		MaxWriteSize:   300,
+		Sessions:       NewSessionStore(),
+	}
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, cCfg)
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+
+	// Ensure a work notification exceeding the write limit is dropped
+	// without writing a partial frame, the next message is the first one
+	// the peer reads.
+	genTx1 := strings.Repeat("00", 180)
+	notif := WorkNotification("1", strings.Repeat("00", 32), genTx1, "00",
+		"01000000", "ffff001e", "00000000", true)
+	encodeErr := make(chan error, 2)
+	go func() {
+		encodeErr <- client.encode(notif)
+		encodeErr <- client.encode(ShowMessageNotification("next"))
+	}()
+	pR := bufio.NewReaderSize(peer, MaxReadMessageSize)
+	line, err := pR.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("[ReadBytes] unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-encodeErr; err != nil {
+			t.Fatalf("[encode] unexpected error: %v", err)
+		}
+	}
+	msg, _, err := IdentifyMessage(line)
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	req, ok := msg.(*Request)
+	if !ok || req.Method != ShowMessage {
+		t.Fatalf("expected a show message notification, got %s", line)
+	}
+	if dropped := atomic.LoadInt64(&client.dropped); dropped != 1 {
+		t.Fatalf("expected 1 dropped message, got %d", dropped)
+	}
+
+	// Ensure a subscribe request with a long user agent fits the read
+	// limit.
+	go client.read()
+	pE := json.NewEncoder(peer)
+	id := uint64(1)
+	err = pE.Encode(SubscribeRequest(&id, strings.Repeat("a", 250),
+		"1.0.0", ""))
+	if err != nil {
+		t.Fatalf("[Encode] unexpected error: %v", err)
+	}
+	select {
+	case payload := <-client.readCh:
+		req, ok := payload.msg.(*Request)
+		if !ok || req.Method != Subscribe {
+			t.Fatalf("expected a subscribe request, got %v", payload.msg)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the subscribe request to be read")
+	}
+
+	// Ensure a client sending a message exceeding the read limit is
+	// disconnected.
+	go peer.Write([]byte(strings.Repeat("a", 500) + "\n"))
+	select {
+	case <-client.ctx.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the client to be disconnected")
+	}
+}
+
+func testHexReversal(t *testing.T) {
+	// Ensure words of the previous block hash are reversed in place.
+	prevBlock := benchWorkE[8:72]
+	want := "0c582b02e94661a9eea15fc80e2ec02e4eaf792561fc8138642dc59e00003ed8"
+	got := reversePrevBlockWords(prevBlock)
+	if got != want {
+		t.Fatalf("[reversePrevBlockWords] expected %s, got %s", want, got)
+	}
+
+	// Ensure hex strings are reversed byte-wise.
+	reversed, err := hexReversed("a6030000")
+	if err != nil {
+		t.Fatalf("[hexReversed] unexpected error: %v", err)
+	}
+	if reversed != "000003a6" {
+		t.Fatalf("[hexReversed] expected 000003a6, got %s", reversed)
+	}
+	_, err = hexReversed("a60")
+	if !IsError(err, ErrWrongInputLength) {
+		t.Fatalf("[hexReversed] expected a wrong input length error, got %v",
+			err)
+	}
+}
+
+func testInFlightBudget(t *testing.T) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	poolDiffs, err := NewDifficultySet(chaincfg.SimNetParams(), powLimit,
+		new(big.Int).SetUint64(20), 0)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error: %v", err)
+	}
+	diffInfo, err := poolDiffs.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	cCfg := &ClientConfig{
+		FetchMiner: func() string {
+			return CPU
+		},
+		DifficultyInfo: diffInfo,
+		MaxInFlight:    2,
+		Sessions:       NewSessionStore(),
+	}
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, cCfg)
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+
+	// Only read messages, none of them are processed.
+	go client.read()
+	sE := json.NewEncoder(peer)
+	sendRequest := func(id uint64) {
+		err := sE.Encode(SubscribeRequest(&id, "cpuminer", "1.0.0", ""))
+		if err != nil {
+			t.Fatalf("[Encode] unexpected error: %v", err)
+		}
+	}
+
+	// Ensure requests beyond the in-flight budget are refused with a rate
+	// limit error.
+	for id := uint64(1); id <= 3; id++ {
+		sendRequest(id)
+	}
+	var resp *Response
+	select {
+	case msg := <-client.ch:
+		resp = msg.(*Response)
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected a rate limit response")
+	}
+	if resp.ID != 3 || resp.Error == nil || resp.Error.Code != RateLimited {
+		t.Fatalf("expected a rate limit error for request 3, got %v", resp)
+	}
+	if len(client.readCh) != 2 {
+		t.Fatalf("expected 2 queued messages, got %d", len(client.readCh))
+	}
+	if atomic.LoadInt64(&client.overBudget) != 1 {
+		t.Fatalf("expected 1 over budget message, got %d",
+			atomic.LoadInt64(&client.overBudget))
+	}
+
+	// Ensure processed messages free their in-flight slots.
+	<-client.readCh
+	client.releaseInFlight()
+	sendRequest(4)
+	deadline := time.Now().Add(time.Second * 5)
+	for len(client.readCh) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the request to be queued")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	// Ensure a client repeatedly exceeding its budget is disconnected.
+	go func() {
+		for {
+			select {
+			case <-client.ch:
+			case <-client.ctx.Done():
+				return
+			}
+		}
+	}()
+	for id := uint64(5); id < 5+uint64(maxBudgetViolations); id++ {
+		sendRequest(id)
+	}
+	select {
+	case <-client.ctx.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the client to be disconnected")
+	}
+}
+
+func testSoloAttribution(t *testing.T) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	cCfg := &ClientConfig{
+		ActiveNet:   chaincfg.SimNetParams(),
+		SoloPool:    true,
+		Blake256Pad: generateBlake256Pad(),
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 256)),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   powLimit,
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RemoveClient: func(*Client) {},
+		Events:       NewEventBus(),
+		Sessions:     NewSessionStore(),
+	}
+	request := func(r *Request) *Request {
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("[Marshal] unexpected error: %v", err)
+		}
+		msg, _, err := IdentifyMessage(data)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		return msg.(*Request)
+	}
+
+	tests := []struct {
+		username string
+		account  string
+		name     string
+	}{
+		{xAddr + ".rig1", xAddr, "rig1"},
+		{"rig2", "", "rig2"},
+		{"notanaddress.rig3", "", "notanaddress_rig3"},
+	}
+	id := uint64(1)
+	for _, test := range tests {
+		conn, _ := net.Pipe()
+		addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+		client, err := NewClient(conn, addr, cCfg)
+		if err != nil {
+			t.Fatalf("[NewClient] unexpected error: %v", err)
+		}
+		client.handleAuthorizeRequest(request(&Request{
+			ID:     &id,
+			Method: Authorize,
+			Params: []string{test.username, ""},
+		}), true)
+		msg := <-client.ch
+		status, sErr, err := ParseAuthorizeResponse(msg.(*Response))
+		if err != nil {
+			t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+		}
+		if !status {
+			t.Fatalf("expected %s to be authorized, got %v",
+				test.username, sErr)
+		}
+		if client.account != test.account || client.name != test.name {
+			t.Fatalf("expected %s to be authorized as account %q, "+
+				"name %q, got account %q, name %q", test.username,
+				test.account, test.name, client.account, client.name)
+		}
+
+		// Ensure the identity of the authorized client includes its
+		// shortened address and worker name.
+		identity := client.extraNonce1 + "/" + CPU + "/"
+		if test.account != "" {
+			identity += shortAddress(test.account) + "/"
+		}
+		identity += test.name
+		if client.fetchIdentity() != identity {
+			t.Fatalf("expected client identity %s, got %s", identity,
+				client.fetchIdentity())
+		}
+		client.cancel()
+	}
+}
+
+func testRequestLimits(t *testing.T) {
+	activeNet := chaincfg.SimNetParams()
+	powLimit := new(big.Rat).SetInt(activeNet.PowLimit)
+	maxGenTime := big.NewInt(15)
+	diffs, err := NewDifficultySet(activeNet, powLimit, maxGenTime, 0)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error: %v", err)
+	}
+	diffInfo, err := diffs.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	cCfg := &ClientConfig{
+		ActiveNet:      activeNet,
+		Blake256Pad:    generateBlake256Pad(),
+		DifficultyInfo: diffInfo,
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RemoveClient: func(*Client) {},
+		Events:       NewEventBus(),
+		Sessions:     NewSessionStore(),
+	}
+	conn, _ := net.Pipe()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, cCfg)
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+
+	// Ensure the expected share rate of a client at its miner's
+	// difficulty is a share per max generation time.
+	shareRate := client.expectedShareRate()
+	if math.Abs(shareRate-1.0/15) > 1e-6 {
+		t.Fatalf("expected a share rate of %v, got %v", 1.0/15, shareRate)
+	}
+
+	// Ensure requests of each class are refused with a rate limited error
+	// once the client exceeds its limits.
+	id := uint64(1)
+	client.handleAuthorizeRequest(&Request{
+		ID:     &id,
+		Method: Authorize,
+		Params: []string{"rig", ""},
+	}, false)
+	_, sErr, err := ParseAuthorizeResponse((<-client.ch).(*Response))
+	if err != nil {
+		t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+	}
+	if sErr == nil || sErr.Code != RateLimited {
+		t.Fatalf("expected a rate limited authorize error, got %v", sErr)
+	}
+	client.handleSubscribeRequest(&Request{
+		ID:     &id,
+		Method: Subscribe,
+		Params: []string{"miner", ""},
+	}, false)
+	resp := (<-client.ch).(*Response)
+	if resp.Error == nil || resp.Error.Code != RateLimited {
+		t.Fatalf("expected a rate limited subscribe error, got %v",
+			resp.Error)
+	}
+	client.authorizedMtx.Lock()
+	client.authorized = true
+	client.authorizedMtx.Unlock()
+	client.subscribedMtx.Lock()
+	client.subscribed = true
+	client.subscribedMtx.Unlock()
+	client.handleSubmitWorkRequest(&Request{
+		ID:     &id,
+		Method: Submit,
+	}, false, client.fetchDifficultyInfo())
+	resp = (<-client.ch).(*Response)
+	if resp.Error == nil || resp.Error.Code != RateLimited {
+		t.Fatalf("expected a rate limited submit error, got %v", resp.Error)
+	}
+
+	// Ensure an IPv4 client and a client of its IPv4-mapped IPv6 form
+	// share the request limiters of their host.
+	limiter := NewRateLimiter(nil)
+	hosts := make([]string, 0, 2)
+	for idx, ip := range []string{"10.0.0.1", "::ffff:10.0.0.1"} {
+		conn, _ := net.Pipe()
+		addr := &net.TCPAddr{IP: net.ParseIP(ip), Port: 5000 + idx}
+		c, err := NewClient(conn, addr, cCfg)
+		if err != nil {
+			t.Fatalf("[NewClient] unexpected error: %v", err)
+		}
+		hosts = append(hosts, c.limiterHost())
+	}
+	for i := 0; i < handshakeBurst; i++ {
+		if !limiter.withinLimit(hosts[0], AuthorizeClass, 0) {
+			t.Fatal("expected authorize limiter to be within limit")
+		}
+	}
+	if limiter.withinLimit(hosts[1], AuthorizeClass, 0) {
+		t.Fatal("expected the authorize limiter of the host to be " +
+			"exhausted for its IPv4-mapped client")
+	}
+	if limiter.fetchLimiter(hosts[0], AuthorizeClass) !=
+		limiter.fetchLimiter(hosts[1], AuthorizeClass) {
+		t.Fatal("expected both clients to share one authorize limiter")
+	}
+}
+
+func testBlockAccepted(t *testing.T, db *bolt.DB) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+	accepted := make([]*AcceptedWork, 0)
+	var acceptedMtx sync.Mutex
+	registry := newClientRegistry()
+	cCfg := &ClientConfig{
+		ActiveNet:   chaincfg.SimNetParams(),
+		DB:          db,
+		SoloPool:    true,
+		Blake256Pad: generateBlake256Pad(),
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 256)),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   powLimit,
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RegisterClient:   registry.register,
+		DeregisterClient: registry.deregister,
+		RemoveClient:     func(*Client) {},
+		SubmitWork: func(*string) (bool, string, error) {
+			return true, "", nil
+		},
+		FetchCurrentWork: func() *CurrentWork {
+			return &CurrentWork{Header: workE, Height: 41}
+		},
+		WithinLimit: func(string, int, float64) bool {
+			return true
+		},
+		HashCalcThreshold: 1,
+		WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+			return 0
+		},
+		NotifyBlockAccepted: func(clientID string, work *AcceptedWork) {
+			acceptedMtx.Lock()
+			accepted = append(accepted, work)
+			acceptedMtx.Unlock()
+		},
+		IsTraced: func(string, string) bool {
+			return false
+		},
+		Events:   NewEventBus(),
+		Sessions: NewSessionStore(),
+	}
+
+	// Ensure the miner solving a block is notified of the block found and
+	// recorded as its finder.
+	client, m := pipeMiner(t, cCfg, CPU)
+	m.subscribe()
+	status, sErr := m.authorize("rig1", xAddr)
+	if !status {
+		t.Fatalf("unexpected authorize error: %v", sErr)
+	}
+	job := m.awaitWork()
+	extraNonce2, nTime, nonce := m.solveBlock(job)
+	status, sErr = m.submit(job, extraNonce2, nTime, nonce)
+	if !status {
+		t.Fatalf("expected an accepted submission, got %v", sErr)
+	}
+	for len(m.messages) == 0 {
+		m.next()
+	}
+	acceptedMtx.Lock()
+	if len(accepted) != 1 || !strings.Contains(m.messages[0],
+		accepted[0].BlockHash) || !strings.Contains(m.messages[0], "#41") {
+		t.Fatalf("expected a block found message for the accepted "+
+			"work, got %q", m.messages[0])
+	}
+	acceptedMtx.Unlock()
+	work, err := FetchAcceptedWork(db, []byte(accepted[0].UUID))
+	if err != nil {
+		t.Fatalf("[FetchAcceptedWork] unexpected error: %v", err)
+	}
+	if work.Worker != "rig1" {
+		t.Fatalf("expected work found by rig1, got %q", work.Worker)
+	}
+
+	// Ensure the finder is recorded when the client disconnects before
+	// being notified.
+	extraNonce2, nTime, nonce = m.solveBlock(job)
+	client.cancel()
+	m.awaitDisconnect()
+	id := m.nextID()
+	data, err := json.Marshal(SubmitWorkRequest(&id, "tm", job.id,
+		extraNonce2, nTime, nonce))
+	if err != nil {
+		t.Fatalf("[Marshal] unexpected error: %v", err)
+	}
+	msg, _, err := IdentifyMessage(data)
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	client.handleSubmitWorkRequest(msg.(*Request), true,
+		client.fetchDifficultyInfo())
+	acceptedMtx.Lock()
+	if len(accepted) != 2 || accepted[1].Worker != "rig1" {
+		t.Fatal("expected a block accepted notification for the " +
+			"disconnected client")
+	}
+	acceptedMtx.Unlock()
+	_, err = FetchAcceptedWork(db, []byte(accepted[1].UUID))
+	if err != nil {
+		t.Fatalf("[FetchAcceptedWork] unexpected error: %v", err)
+	}
+
+	err = emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, workBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
+
+func testSubmitResponses(t *testing.T, db *bolt.DB) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	var submitAccepted bool
+	var submitErr error
+	var currentWork string
+	diffInfo := &DifficultyInfo{
+		target:     new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 256)),
+		difficulty: new(big.Rat).SetInt64(1),
+		powLimit:   powLimit,
+		multiplier: new(big.Rat).SetInt64(1),
+	}
+	cCfg := &ClientConfig{
+		ActiveNet:      chaincfg.SimNetParams(),
+		DB:             db,
+		SoloPool:       true,
+		Blake256Pad:    generateBlake256Pad(),
+		DifficultyInfo: diffInfo,
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RemoveClient: func(*Client) {},
+		SubmitWork: func(*string) (bool, string, error) {
+			return submitAccepted, "", submitErr
+		},
+		FetchCurrentWork: func() *CurrentWork {
+			return &CurrentWork{Header: currentWork}
+		},
+		WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+			return 0
+		},
+		Events:   NewEventBus(),
+		Sessions: NewSessionStore(),
+	}
+	request := func(r *Request) *Request {
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("[Marshal] unexpected error: %v", err)
+		}
+		msg, _, err := IdentifyMessage(data)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		return msg.(*Request)
+	}
+	id := uint64(1)
+	newClient := func(subscribe bool, authorize bool) *Client {
+		conn, _ := net.Pipe()
+		addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+		client, err := NewClient(conn, addr, cCfg)
+		if err != nil {
+			t.Fatalf("[NewClient] unexpected error: %v", err)
+		}
+		if subscribe {
+			client.handleSubscribeRequest(request(SubscribeRequest(&id,
+				"mcpu", "1.0.1", "")), true)
+			<-client.ch
+		}
+		if authorize {
+			client.handleAuthorizeRequest(request(AuthorizeRequest(&id,
+				"rig1", xAddr)), true)
+			<-client.ch
+		}
+		return client
+	}
+
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+	job, err := NewJob(workE, 41)
+	if err != nil {
+		t.Fatalf("[NewJob] unexpected error: %v", err)
+	}
+	err = job.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+
+	// Current work of the next block supersedes the job.
+	headerD, err := hex.DecodeString(workE[:360])
+	if err != nil {
+		t.Fatalf("[DecodeString] unexpected error: %v", err)
+	}
+	var next wire.BlockHeader
+	err = next.FromBytes(headerD)
+	if err != nil {
+		t.Fatalf("[FromBytes] unexpected error: %v", err)
+	}
+	next.PrevBlock = next.BlockHash()
+	next.Height++
+	nextB, err := next.Bytes()
+	if err != nil {
+		t.Fatalf("[Bytes] unexpected error: %v", err)
+	}
+	nextWork := hex.EncodeToString(nextB) + workE[360:]
+
+	// nonces returns the provided number of distinct nonces solving the
+	// job for the provided client at the network target and one that does
+	// not.
+	nonces := func(client *Client, n int) ([]string, string) {
+		var solving []string
+		var unsolving string
+		for i := uint32(0); len(solving) < n || unsolving == ""; i++ {
+			nonce := fmt.Sprintf("%08x", i)
+			header, err := GenerateSolvedBlockHeader(job.Header,
+				client.extraNonce1, "00000000", ExtraNonce2Size,
+				"954cee5d", nonce, CPU)
+			if err != nil {
+				t.Fatalf("[GenerateSolvedBlockHeader] unexpected "+
+					"error: %v", err)
+			}
+			hash := header.BlockHash()
+			if standalone.HashToBig(&hash).Cmp(
+				standalone.CompactToBig(header.Bits)) <= 0 {
+				if len(solving) < n {
+					solving = append(solving, nonce)
+				}
+				continue
+			}
+			if unsolving == "" {
+				unsolving = nonce
+			}
+		}
+		return solving, unsolving
+	}
+	client := newClient(true, true)
+	solving, unsolving := nonces(client, 3)
+
+	tests := []struct {
+		name     string
+		client   *Client
+		job      string
+		nonce    string
+		allowed  bool
+		setup    func()
+		accepted bool
+		code     uint32
+	}{{
+		name:    "unauthorized",
+		client:  newClient(true, false),
+		job:     job.UUID,
+		nonce:   solving[0],
+		allowed: true,
+		code:    UnauthorizedWorker,
+	}, {
+		name:    "not subscribed",
+		client:  newClient(false, true),
+		job:     job.UUID,
+		nonce:   solving[0],
+		allowed: true,
+		code:    NotSubscribed,
+	}, {
+		name:    "rate limited",
+		client:  client,
+		job:     job.UUID,
+		nonce:   solving[0],
+		allowed: false,
+		code:    RateLimited,
+	}, {
+		name:    "malformed",
+		client:  client,
+		job:     job.UUID,
+		nonce:   "zz",
+		allowed: true,
+		code:    InvalidRequest,
+	}, {
+		name:    "unknown job",
+		client:  client,
+		job:     "unknown",
+		nonce:   solving[0],
+		allowed: true,
+		code:    StaleJob,
+	}, {
+		name:    "stale job",
+		client:  client,
+		job:     job.UUID,
+		nonce:   solving[0],
+		allowed: true,
+		setup: func() {
+			currentWork = nextWork
+		},
+		code: StaleJob,
+	}, {
+		name:    "low difficulty",
+		client:  client,
+		job:     job.UUID,
+		nonce:   unsolving,
+		allowed: true,
+		setup: func() {
+			currentWork = ""
+			low := diffInfo.copy()
+			low.target = new(big.Rat).SetInt64(1)
+			client.setDifficultyInfo(low)
+		},
+		code: LowDifficultyShare,
+	}, {
+		name:    "share",
+		client:  client,
+		job:     job.UUID,
+		nonce:   unsolving,
+		allowed: true,
+		setup: func() {
+			client.setDifficultyInfo(diffInfo)
+		},
+		accepted: true,
+	}, {
+		name:    "duplicate share",
+		client:  client,
+		job:     job.UUID,
+		nonce:   unsolving,
+		allowed: true,
+		code:    DuplicateShare,
+	}, {
+		name:    "submission error",
+		client:  client,
+		job:     job.UUID,
+		nonce:   solving[0],
+		allowed: true,
+		setup: func() {
+			submitErr = fmt.Errorf("connection refused")
+		},
+		accepted: true,
+	}, {
+		name:    "rejected block",
+		client:  client,
+		job:     job.UUID,
+		nonce:   solving[1],
+		allowed: true,
+		setup: func() {
+			submitErr = nil
+		},
+		accepted: true,
+	}, {
+		name:    "block found",
+		client:  client,
+		job:     job.UUID,
+		nonce:   solving[2],
+		allowed: true,
+		setup: func() {
+			submitAccepted = true
+		},
+		accepted: true,
+	}, {
+		name:     "duplicate block",
+		client:   client,
+		job:      job.UUID,
+		nonce:    solving[2],
+		allowed:  true,
+		accepted: true,
+	}}
+
+	// Ensure a response is written to the client for every submission.
+	for _, test := range tests {
+		if test.setup != nil {
+			test.setup()
+		}
+		test.client.handleSubmitWorkRequest(request(SubmitWorkRequest(&id,
+			"tcl", test.job, "00000000", "954cee5d", test.nonce)),
+			test.allowed, test.client.fetchDifficultyInfo())
+		var resp *Response
+		select {
+		case msg := <-test.client.ch:
+			resp = msg.(*Response)
+		default:
+			t.Fatalf("%s: expected a submit work response", test.name)
+		}
+		status, sErr, err := ParseSubmitWorkResponse(resp)
+		if err != nil {
+			t.Fatalf("%s: [ParseSubmitWorkResponse] unexpected error: %v",
+				test.name, err)
+		}
+		if status != test.accepted {
+			t.Fatalf("%s: expected accepted %v, got %v (%v)", test.name,
+				test.accepted, status, sErr)
+		}
+		if !test.accepted && (sErr == nil || sErr.Code != test.code) {
+			t.Fatalf("%s: expected error code %d, got %v", test.name,
+				test.code, sErr)
+		}
+
+		// Only the submission finding a block is followed by a block found
+		// message.
+		select {
+		case msg := <-test.client.ch:
+			req, ok := msg.(*Request)
+			if test.name != "block found" || !ok || req.Method != ShowMessage {
+				t.Fatalf("%s: unexpected message %v", test.name, msg)
+			}
+		default:
+			if test.name == "block found" {
+				t.Fatal("expected a block found message")
+			}
+		}
+	}
+
+	err = emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, workBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, lostBlockBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
+
+func testInitialWork(t *testing.T, db *bolt.DB) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+	newConfig := func(delay time.Duration) *ClientConfig {
+		return &ClientConfig{
+			ActiveNet:   chaincfg.SimNetParams(),
+			DB:          db,
+			SoloPool:    true,
+			Blake256Pad: generateBlake256Pad(),
+			DifficultyInfo: &DifficultyInfo{
+				target:     new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 256)),
+				difficulty: new(big.Rat).SetInt64(1),
+				powLimit:   powLimit,
+				multiplier: new(big.Rat).SetInt64(1),
+			},
+			FetchMiner: func() string {
+				return CPU
+			},
+			FetchMinerPolicy: func() string {
+				return PolicyAllow
+			},
+			RemoveClient: func(*Client) {},
+			FetchCurrentWork: func() *CurrentWork {
+				return &CurrentWork{Header: workE, Height: 41}
+			},
+			Events:           NewEventBus(),
+			Sessions:         NewSessionStore(),
+			InitialWorkDelay: delay,
+		}
+	}
+	request := func(r *Request) *Request {
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("[Marshal] unexpected error: %v", err)
+		}
+		msg, _, err := IdentifyMessage(data)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		return msg.(*Request)
+	}
+	id := uint64(1)
+	newClient := func(cfg *ClientConfig) *Client {
+		conn, _ := net.Pipe()
+		addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+		client, err := NewClient(conn, addr, cfg)
+		if err != nil {
+			t.Fatalf("[NewClient] unexpected error: %v", err)
+		}
+		return client
+	}
+	subscribe := func(client *Client) {
+		client.handleSubscribeRequest(request(SubscribeRequest(&id,
+			"mcpu", "1.0.1", "")), true)
+		<-client.ch
+		client.sendInitialWork()
+	}
+	authorize := func(client *Client) {
+		client.handleAuthorizeRequest(request(AuthorizeRequest(&id,
+			"rig1", xAddr)), true)
+		<-client.ch
+		client.sendInitialWork()
+	}
+	pendingWork := func(client *Client) *Request {
+		client.workMtx.Lock()
+		defer client.workMtx.Unlock()
+		return client.work
+	}
+
+	// Ensure the initial work is sent once the handshake completes,
+	// regardless of the order of the authorize and subscribe requests.
+	registry := newClientRegistry()
+	for name, subscribeFirst := range map[string]bool{
+		"subscribe first": true,
+		"authorize first": false,
+	} {
+		cfg := newConfig(0)
+		cfg.RegisterClient = registry.register
+		cfg.DeregisterClient = registry.deregister
+		cfg.WithinLimit = func(string, int, float64) bool {
+			return true
+		}
+		cfg.HashCalcThreshold = 1
+		cfg.IsTraced = func(string, string) bool {
+			return false
+		}
+		client, m := pipeMiner(t, cfg, CPU)
+		handshake := []func(){m.subscribe, func() {
+			status, sErr := m.authorize("rig1", xAddr)
+			if !status {
+				t.Fatalf("%s: unexpected authorize error: %v", name, sErr)
+			}
+		}}
+		if !subscribeFirst {
+			handshake[0], handshake[1] = handshake[1], handshake[0]
+		}
+		handshake[0]()
+		if m.job != nil {
+			t.Fatalf("%s: expected no work before the handshake "+
+				"completes", name)
+		}
+		handshake[1]()
+		job := m.awaitWork()
+		if !job.clean {
+			t.Fatalf("%s: expected clean initial work", name)
+		}
+		client.cancel()
+		m.awaitDisconnect()
+	}
+	if !registry.wait(time.Second * 5) {
+		t.Fatal("expected all clients to shut down")
+	}
+
+	// Ensure repeated handshake requests do not send additional initial
+	// work.
+	orders := map[string][]func(*Client){
+		"subscribe first": {subscribe, authorize},
+		"authorize first": {authorize, subscribe},
+	}
+	for name, steps := range orders {
+		client := newClient(newConfig(0))
+		steps[0](client)
+		steps[1](client)
+		if pendingWork(client) == nil {
+			t.Fatalf("%s: expected initial work after the handshake "+
+				"completes", name)
+		}
+		client.workMtx.Lock()
+		client.work = nil
+		client.workMtx.Unlock()
+		steps[0](client)
+		steps[1](client)
+		if pendingWork(client) != nil {
+			t.Fatalf("%s: expected exactly one initial work", name)
+		}
+		if atomic.LoadInt64(&client.coalesced) != 0 {
+			t.Fatalf("%s: expected no coalesced notifications", name)
+		}
+		client.cancel()
+	}
+
+	// Ensure a configured initial work delay is waited out without
+	// blocking the caller.
+	client := newClient(newConfig(time.Millisecond * 50))
+	subscribe(client)
+	authorize(client)
+	if pendingWork(client) != nil {
+		t.Fatal("expected no work before the initial work delay elapses")
+	}
+	deadline := time.Now().Add(time.Second * 2)
+	for pendingWork(client) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected initial work after the initial work " +
+				"delay elapses")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// Ensure delayed initial work is not sent to disconnected clients.
+	client = newClient(newConfig(time.Millisecond * 50))
+	subscribe(client)
+	authorize(client)
+	client.cancel()
+	time.Sleep(time.Millisecond * 150)
+	if pendingWork(client) != nil {
+		t.Fatal("expected no initial work for a disconnected client")
+	}
+
+	err := emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+}
+
+func testWorkSequencing(t *testing.T, db *bolt.DB) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+	workAt := func(height uint32) string {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, height)
+		return workE[:256] + hex.EncodeToString(b) + workE[264:]
+	}
+	cs := NewChainState(&ChainStateConfig{})
+	cCfg := &ClientConfig{
+		ActiveNet:   chaincfg.SimNetParams(),
+		DB:          db,
+		SoloPool:    true,
+		Blake256Pad: generateBlake256Pad(),
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 256)),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   powLimit,
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RemoveClient:     func(*Client) {},
+		FetchCurrentWork: cs.fetchVersionedWork,
+		Events:           NewEventBus(),
+		Sessions:         NewSessionStore(),
+	}
+	conn, _ := net.Pipe()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, cCfg)
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+	client.authorized = true
+	client.subscribed = true
+
+	// pendingHeight returns the height of the client's pending work, zero
+	// if there is none.
+	pendingHeight := func() uint32 {
+		client.workMtx.Lock()
+		work := client.work
+		client.workMtx.Unlock()
+		if work == nil {
+			return 0
+		}
+		_, _, genTx1, _, _, _, _, _, err := ParseWorkNotification(work)
+		if err != nil {
+			t.Fatalf("[ParseWorkNotification] unexpected error: %v", err)
+		}
+		heightD, err := hex.DecodeString(genTx1[184:192])
+		if err != nil {
+			t.Fatalf("[DecodeString] unexpected error: %v", err)
+		}
+		return binary.LittleEndian.Uint32(heightD)
+	}
+	broadcast := func(work *CurrentWork) bool {
+		notif := WorkNotification(fmt.Sprintf("job%d", work.Seq),
+			"prevblock", work.Header[72:288], "gentx2", "version", "nbits",
+			"ntime", true)
+		return client.queueWork(notif, work.Seq)
+	}
+
+	// Ensure current work versions are sequenced and carry their height.
+	first := cs.setCurrentWork(workAt(41))
+	second := cs.setCurrentWork(workAt(42))
+	if second.Seq != first.Seq+1 || second.Height != 42 ||
+		cs.fetchVersionedWork() != second {
+		t.Fatalf("expected current work #42 with sequence %d, got %+v",
+			first.Seq+1, cs.fetchVersionedWork())
+	}
+
+	// Ensure notifications of work older than the last queued are dropped.
+	if !broadcast(second) {
+		t.Fatal("expected the latest work to be queued")
+	}
+	if broadcast(first) {
+		t.Fatal("expected outdated work to be dropped")
+	}
+	if pendingHeight() != 42 {
+		t.Fatalf("expected pending work at height 42, got %d",
+			pendingHeight())
+	}
+
+	// Ensure outdated current work is not rolled.
+	client.workMtx.Lock()
+	client.work = nil
+	client.workMtx.Unlock()
+	cs.currentWork.Store(first)
+	client.updateWork(true)
+	if pendingHeight() != 0 {
+		t.Fatal("expected outdated current work not to be rolled")
+	}
+	cs.currentWork.Store(second)
+	client.updateWork(true)
+	if pendingHeight() != 42 {
+		t.Fatalf("expected rolled work at height 42, got %d",
+			pendingHeight())
+	}
+
+	// Ensure rolls of work already queued are non-clean jobs while rolls of
+	// work not yet queued for the client are clean.
+	client.workMtx.Lock()
+	rolled := client.work
+	client.workMtx.Unlock()
+	if isCleanJob(rolled) {
+		t.Fatal("expected a roll of queued work to be a non-clean job")
+	}
+	client.forgetQueuedWork()
+	client.updateWork(true)
+	client.workMtx.Lock()
+	rolled = client.work
+	client.workMtx.Unlock()
+	if !isCleanJob(rolled) {
+		t.Fatal("expected a roll of forgotten work to be a clean job")
+	}
+
+	// Ensure interleaved template updates and rolls never leave work below
+	// the latest broadcast height pending.
+	var broadcastHeight uint32
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for height := uint32(43); height < 83; height++ {
+			broadcast(cs.setCurrentWork(workAt(height)))
+			atomic.StoreUint32(&broadcastHeight, height)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			client.updateWork(true)
+		}
+	}()
+	var violation string
+	for {
+		select {
+		case <-done:
+		default:
+			latest := atomic.LoadUint32(&broadcastHeight)
+			pending := pendingHeight()
+			if pending < latest && violation == "" {
+				violation = fmt.Sprintf("pending work at height %d below "+
+					"the latest broadcast height %d", pending, latest)
+			}
+			continue
+		}
+		break
+	}
+	wg.Wait()
+	if violation != "" {
+		t.Fatal(violation)
+	}
+	if pendingHeight() != 82 {
+		t.Fatalf("expected pending work at height 82, got %d",
+			pendingHeight())
+	}
+	client.cancel()
+
+	err = emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+}
+
+func testSubmissionOrdering(t *testing.T, db *bolt.DB) {
+	powLimit := chaincfg.SimNetParams().PowLimit
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+
+	// Lower the network target of the work so shares are not blocks.
+	workE = workE[:232] + "ffff001e" + workE[240:]
+	newDiffInfo := func(diff int64) *DifficultyInfo {
+		return &DifficultyInfo{
+			target:     new(big.Rat).SetFrac(powLimit, big.NewInt(diff)),
+			difficulty: new(big.Rat).SetInt64(diff),
+			powLimit:   new(big.Rat).SetInt(powLimit),
+			multiplier: new(big.Rat).SetInt64(1),
+		}
+	}
+	easy := newDiffInfo(1 << 8)
+	hard := newDiffInfo(1 << 24)
+
+	// Gated submissions block the processing of the client's messages
+	// until the gate is opened, so later messages queue up behind them.
+	var gated uint32
+	entered := make(chan struct{}, 1)
+	gate := make(chan struct{})
+	registry := newClientRegistry()
+	cCfg := &ClientConfig{
+		ActiveNet:      chaincfg.SimNetParams(),
+		DB:             db,
+		SoloPool:       true,
+		Blake256Pad:    generateBlake256Pad(),
+		DifficultyInfo: easy,
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RemoveClient: func(*Client) {},
+		FetchCurrentWork: func() *CurrentWork {
+			return &CurrentWork{Header: workE, Height: 41}
+		},
+		WithinLimit: func(_ string, class int, _ float64) bool {
+			if class == SubmitClass &&
+				atomic.CompareAndSwapUint32(&gated, 1, 0) {
+				entered <- struct{}{}
+				<-gate
+			}
+			return true
+		},
+		IsTraced: func(string, string) bool {
+			return false
+		},
+		WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+			return 0
+		},
+		RegisterClient:    registry.register,
+		DeregisterClient:  registry.deregister,
+		HashCalcThreshold: 1,
+		MaxInFlight:       8,
+		Events:            NewEventBus(),
+		Sessions:          NewSessionStore(),
+	}
+	client, m := pipeMiner(t, cCfg, CPU)
+	m.subscribe()
+	status, sErr := m.authorize("rig1", xAddr)
+	if !status {
+		t.Fatalf("unexpected authorize error: %v", sErr)
+	}
+	job := m.awaitWork()
+	awaitQueued := func(n int) {
+		deadline := time.Now().Add(time.Second * 5)
+		for len(client.readCh) != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d queued messages, got %d", n,
+					len(client.readCh))
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+	}
+	submit := func() uint64 {
+		extraNonce2, nTime, nonce := m.solve(job)
+		id := m.nextID()
+		m.send(SubmitWorkRequest(&id, "tm", job.id, extraNonce2, nTime,
+			nonce))
+		return id
+	}
+
+	// Interleave submissions of shares meeting only the initial difficulty
+	// with a difficulty update while the first submission is processed.
+	atomic.StoreUint32(&gated, 1)
+	first := submit()
+	select {
+	case <-entered:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the first submission to be processed")
+	}
+	second := submit()
+	awaitQueued(1)
+	if !client.updateDifficulty(hard) {
+		t.Fatal("expected the subscribed client to be notified")
+	}
+	if client.fetchDifficultyInfo().difficulty.Cmp(hard.difficulty) != 0 {
+		t.Fatal("expected the difficulty to be updated immediately")
+	}
+	awaitQueued(2)
+	third := submit()
+	awaitQueued(3)
+	close(gate)
+
+	// Ensure the submissions are answered in submission order, those
+	// received before the update validated against the initial difficulty
+	// and answered before the client is notified of the update. Work is
+	// sent after the difficulty notification.
+	var order []string
+	var notifiedWork bool
+	for len(order) < 4 {
+		msg, mType := m.next()
+		if mType == NotificationMessage {
+			switch msg.(*Request).Method {
+			case SetDifficulty:
+				order = append(order, "difficulty")
+			case Notify:
+				notifiedWork = len(order) >= 3
+			}
+			continue
+		}
+		resp := msg.(*Response)
+		status, sErr, err := ParseSubmitWorkResponse(resp)
+		if err != nil {
+			t.Fatalf("[ParseSubmitWorkResponse] unexpected error: %v", err)
+		}
+		switch resp.ID {
+		case first, second:
+			if !status {
+				t.Fatalf("expected submission %d to be accepted at the "+
+					"initial difficulty, got %v", resp.ID, sErr)
+			}
+		case third:
+			if status || sErr == nil || sErr.Code != LowDifficultyShare {
+				t.Fatalf("expected submission %d to be validated at the "+
+					"updated difficulty, got %v", resp.ID, sErr)
+			}
+		}
+		order = append(order, fmt.Sprint(resp.ID))
+	}
+	expected := []string{fmt.Sprint(first), fmt.Sprint(second),
+		"difficulty", fmt.Sprint(third)}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected messages in order %v, got %v", expected,
+				order)
+		}
+	}
+	if !notifiedWork {
+		m.awaitWork()
+	}
+	if m.difficulty != 1<<24 {
+		t.Fatalf("expected a notified difficulty of %d, got %d", 1<<24,
+			m.difficulty)
+	}
+
+	// Ensure a difficulty update without pending submissions applies to
+	// the next submission.
+	if !client.updateDifficulty(easy) {
+		t.Fatal("expected the subscribed client to be notified")
+	}
+	job = m.awaitWork()
+	if m.difficulty != 1<<8 {
+		t.Fatalf("expected a notified difficulty of %d, got %d", 1<<8,
+			m.difficulty)
+	}
+	extraNonce2, nTime, nonce := m.solve(job)
+	status, sErr = m.submit(job, extraNonce2, nTime, nonce)
+	if !status {
+		t.Fatalf("expected an accepted share, got %v", sErr)
+	}
+
+	client.cancel()
+	m.awaitDisconnect()
+	if !registry.wait(time.Second * 5) {
+		t.Fatal("expected all clients to shut down")
+	}
+	err := emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+}
+
+func testAuthorizeResponses(t *testing.T, db *bolt.DB) {
+	policy := PolicyAllow
+	cCfg := &ClientConfig{
+		ActiveNet:   chaincfg.SimNetParams(),
+		DB:          db,
+		Blake256Pad: generateBlake256Pad(),
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt64(1),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit),
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return policy
+		},
+		RemoveClient:      func(*Client) {},
+		RecordAuthFailure: func(string) {},
+		Events:            NewEventBus(),
+		Sessions:          NewSessionStore(),
+		AuthRejects:       NewAuthRejectCache(),
+	}
+	request := func(r *Request) *Request {
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("[Marshal] unexpected error: %v", err)
+		}
+		msg, _, err := IdentifyMessage(data)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		return msg.(*Request)
+	}
+	conn, _ := net.Pipe()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, cCfg)
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+
+	// Lock the account of address Y.
+	secret, err := newLockSecret()
+	if err != nil {
+		t.Fatalf("[newLockSecret] unexpected error: %v", err)
+	}
+	err = persistAccountSettings(db, yID, &AccountSettings{
+		Locked:     true,
+		LockSecret: secret,
+	})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+
+	id := uint64(1)
+	authTests := []struct {
+		name    string
+		req     *Request
+		allowed bool
+		setup   func()
+		code    uint32
+	}{{
+		name:    "rate limited",
+		req:     AuthorizeRequest(&id, "rig1", xAddr),
+		allowed: false,
+		code:    RateLimited,
+	}, {
+		name:    "malformed",
+		req:     NewRequest(&id, Authorize, []interface{}{1, ""}),
+		allowed: true,
+		code:    InvalidRequest,
+	}, {
+		name:    "missing worker name",
+		req:     NewRequest(&id, Authorize, []string{xAddr, ""}),
+		allowed: true,
+		code:    InvalidAddress,
+	}, {
+		name:    "invalid address",
+		req:     AuthorizeRequest(&id, "rig1", "Dsaddress"),
+		allowed: true,
+		code:    InvalidAddress,
+	}, {
+		name:    "repeated invalid address",
+		req:     AuthorizeRequest(&id, "rig1", "Dsaddress"),
+		allowed: true,
+		code:    InvalidAddress,
+	}, {
+		name:    "rejected miner",
+		req:     AuthorizeRequest(&id, "rig1", xAddr),
+		allowed: true,
+		setup: func() {
+			policy = PolicyReject
+		},
+		code: MinerRejected,
+	}, {
+		name:    "locked account",
+		req:     AuthorizeRequest(&id, "rig1", yAddr),
+		allowed: true,
+		setup: func() {
+			policy = PolicyAllow
+		},
+		code: AuthTokenRequired,
+	}, {
+		name:    "authorized",
+		req:     AuthorizeRequest(&id, "rig1", xAddr),
+		allowed: true,
+	}, {
+		name:    "other worker",
+		req:     AuthorizeRequest(&id, "rig2", xAddr),
+		allowed: true,
+		code:    UnauthorizedWorker,
+	}, {
+		name:    "malformed repeat",
+		req:     NewRequest(&id, Authorize, []interface{}{1, ""}),
+		allowed: true,
+		code:    InvalidRequest,
+	}}
+
+	// Ensure every authorize branch responds with its intended error code
+	// and a message.
+	for _, test := range authTests {
+		if test.setup != nil {
+			test.setup()
+		}
+		client.handleAuthorizeRequest(request(test.req), test.allowed)
+		var resp *Response
+		select {
+		case msg := <-client.ch:
+			resp = msg.(*Response)
+		default:
+			t.Fatalf("%s: expected an authorize response", test.name)
+		}
+		status, sErr, err := ParseAuthorizeResponse(resp)
+		if err != nil {
+			t.Fatalf("%s: [ParseAuthorizeResponse] unexpected error: %v",
+				test.name, err)
+		}
+		if test.code == 0 {
+			if !status || sErr != nil {
+				t.Fatalf("%s: expected an authorized response, got %v",
+					test.name, sErr)
+			}
+			continue
+		}
+		if status || sErr == nil || sErr.Code != test.code {
+			t.Fatalf("%s: expected error code %d, got %v", test.name,
+				test.code, sErr)
+		}
+		if sErr.Message == "" {
+			t.Fatalf("%s: expected an error message", test.name)
+		}
+	}
+
+	// Ensure malformed usernames are counted as early rejections, repeated
+	// ones answered from the cache, separately from authorizations failing
+	// after database access.
+	stats := cCfg.AuthRejects.Stats()
+	if stats.Early != 3 || stats.Cached != 1 || stats.Backend != 1 {
+		t.Fatalf("expected 3 early, 1 cached and 1 backend rejections, "+
+			"got %+v", stats)
+	}
+
+	subTests := []struct {
+		name    string
+		req     *Request
+		allowed bool
+		code    uint32
+	}{{
+		name:    "rate limited",
+		req:     SubscribeRequest(&id, "mcpu", "1.0.1", ""),
+		allowed: false,
+		code:    RateLimited,
+	}, {
+		name:    "malformed",
+		req:     NewRequest(&id, Subscribe, []interface{}{1}),
+		allowed: true,
+		code:    InvalidRequest,
+	}}
+
+	// Ensure every failing subscribe branch responds with its intended
+	// error code and a message.
+	for _, test := range subTests {
+		client.handleSubscribeRequest(request(test.req), test.allowed)
+		var resp *Response
+		select {
+		case msg := <-client.ch:
+			resp = msg.(*Response)
+		default:
+			t.Fatalf("%s: expected a subscribe response", test.name)
+		}
+		if resp.Error == nil || resp.Error.Code != test.code ||
+			resp.Error.Message == "" {
+			t.Fatalf("%s: expected error code %d, got %v", test.name,
+				test.code, resp.Error)
+		}
+	}
+
+	err = emptyBucket(db, accountSettingsBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
+
+func testSetOptionRequests(t *testing.T, db *bolt.DB) {
+	// Ensure set option requests round trip and unknown options and
+	// invalid values are refused.
+	payout, hours := 2.5, uint32(24)
+	data, err := json.Marshal(SetOptionRequest(new(uint64),
+		&AccountOptions{MinPayout: &payout, DigestHours: &hours}))
+	if err != nil {
+		t.Fatalf("[Marshal] unexpected error: %v", err)
+	}
+	msg, _, err := IdentifyMessage(data)
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	options, err := ParseSetOptionRequest(msg.(*Request))
+	if err != nil {
+		t.Fatalf("[ParseSetOptionRequest] unexpected error: %v", err)
+	}
+	if *options.MinPayout != payout || *options.DigestHours != hours {
+		t.Fatalf("unexpected options %+v", options)
+	}
+	invalid := []interface{}{
+		[]interface{}{},
+		[]interface{}{map[string]interface{}{}},
+		[]interface{}{map[string]interface{}{"fee": 0.0}},
+		[]interface{}{map[string]interface{}{MinPayoutOption: -1.0}},
+		[]interface{}{map[string]interface{}{MinPayoutOption: "2"}},
+		[]interface{}{map[string]interface{}{DigestHoursOption: 1.5}},
+	}
+	for _, params := range invalid {
+		_, err := ParseSetOptionRequest(NewRequest(new(uint64), SetOption,
+			params))
+		if !IsError(err, ErrParse) {
+			t.Fatalf("%v: expected a parse error, got %v", params, err)
+		}
+	}
+
+	dg, err := NewDigestGenerator(&DigestGeneratorConfig{
+		DB:           db,
+		NotifyDigest: func(*ActivityDigest) {},
+		Events:       NewEventBus(),
+		HubWg:        new(sync.WaitGroup),
+	})
+	if err != nil {
+		t.Fatalf("[NewDigestGenerator] unexpected error: %v", err)
+	}
+	minPayment := dcrutil.Amount(20000000)
+	hub := &Hub{
+		db:  db,
+		cfg: &HubConfig{ActiveNet: chaincfg.SimNetParams()},
+		paymentMgr: &PaymentMgr{
+			cfg: &PaymentMgrConfig{MinPayment: minPayment},
+		},
+		digests: dg,
+	}
+	powLimit := chaincfg.SimNetParams().PowLimit
+	registry := newClientRegistry()
+	cCfg := &ClientConfig{
+		ActiveNet:   chaincfg.SimNetParams(),
+		DB:          db,
+		Blake256Pad: generateBlake256Pad(),
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt(powLimit),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   new(big.Rat).SetInt(powLimit),
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RegisterClient:   registry.register,
+		DeregisterClient: registry.deregister,
+		RemoveClient:     func(*Client) {},
+		FetchCurrentWork: func() *CurrentWork {
+			return nil
+		},
+		WithinLimit: func(string, int, float64) bool {
+			return true
+		},
+		HashCalcThreshold: 1,
+		IsTraced: func(string, string) bool {
+			return false
+		},
+		RecordAuthFailure: func(string) {},
+		Events:            NewEventBus(),
+		Sessions:          NewSessionStore(),
+	}
+	setOption := func(m *testMiner, options map[string]interface{}) (*AccountOptions, *StratumError) {
+		id := m.nextID()
+		m.send(NewRequest(&id, SetOption, []interface{}{options}))
+		applied, sErr, err := ParseSetOptionResponse(m.awaitResponse(id))
+		if err != nil {
+			t.Fatalf("[ParseSetOptionResponse] unexpected error: %v", err)
+		}
+		return applied, sErr
+	}
+
+	// Ensure the set option method and unknown pool methods are refused
+	// without disconnecting clients when the extension is disabled.
+	client, m := pipeMiner(t, cCfg, CPU)
+	_, sErr := setOption(m, map[string]interface{}{MinPayoutOption: 1.0})
+	if sErr == nil || sErr.Code != UnknownMethod {
+		t.Fatalf("expected an unknown method error, got %v", sErr)
+	}
+	id := m.nextID()
+	m.send(&Request{ID: &id, Method: "pool.unknown", Params: []string{}})
+	resp := m.awaitResponse(id)
+	if resp.Error == nil || resp.Error.Code != UnknownMethod {
+		t.Fatalf("expected an unknown method error, got %v", resp.Error)
+	}
+	if client.disconnectReason() != DisconnectUnknown {
+		t.Fatalf("expected the client to stay connected, got %s",
+			client.disconnectReason())
+	}
+	client.cancel()
+	m.awaitDisconnect()
+
+	// Ensure unauthorized clients and clients of unlocked accounts are
+	// refused.
+	enabled := *cCfg
+	enabled.SetAccountOptions = hub.SetAccountOptions
+	client, m = pipeMiner(t, &enabled, CPU)
+	_, sErr = setOption(m, map[string]interface{}{MinPayoutOption: 1.0})
+	if sErr == nil || sErr.Code != UnauthorizedWorker {
+		t.Fatalf("expected an unauthorized worker error, got %v", sErr)
+	}
+	status, sErr := m.authorize("rig1", xAddr)
+	if !status {
+		t.Fatalf("unexpected authorize error: %v", sErr)
+	}
+	_, sErr = setOption(m, map[string]interface{}{MinPayoutOption: 1.0})
+	if sErr == nil || sErr.Code != AccountNotVerified {
+		t.Fatalf("expected an account not verified error, got %v", sErr)
+	}
+	client.cancel()
+	m.awaitDisconnect()
+
+	// Ensure clients authorized with a valid token of a locked account
+	// can set their options, invalid values are refused without applying
+	// any option.
+	secret, err := newLockSecret()
+	if err != nil {
+		t.Fatalf("[newLockSecret] unexpected error: %v", err)
+	}
+	err = persistAccountSettings(db, yID, &AccountSettings{
+		Locked:     true,
+		LockSecret: secret,
+	})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	client, m = pipeMiner(t, &enabled, CPU)
+	id = m.nextID()
+	token := generateAuthToken(secret, yID, time.Now().Add(time.Hour))
+	m.send(NewRequest(&id, Authorize, []string{yAddr + ".rig1", token}))
+	status, sErr, err = ParseAuthorizeResponse(m.awaitResponse(id))
+	if err != nil || !status {
+		t.Fatalf("unexpected authorize error: %v, %v", err, sErr)
+	}
+	_, sErr = setOption(m, map[string]interface{}{
+		MinPayoutOption:   0.1,
+		DigestHoursOption: 24.0,
+	})
+	if sErr == nil || sErr.Code != InvalidRequest || sErr.Traceback == nil {
+		t.Fatalf("expected an invalid request error, got %v", sErr)
+	}
+	_, sErr = setOption(m, map[string]interface{}{DigestHoursOption: 2000.0})
+	if sErr == nil || sErr.Code != InvalidRequest {
+		t.Fatalf("expected an invalid request error, got %v", sErr)
+	}
+	applied, sErr := setOption(m, map[string]interface{}{
+		MinPayoutOption:   2.5,
+		DigestHoursOption: 24.0,
+	})
+	if sErr != nil {
+		t.Fatalf("unexpected set option error: %v", sErr)
+	}
+	if *applied.MinPayout != 2.5 || *applied.DigestHours != 24 {
+		t.Fatalf("unexpected applied options %+v", applied)
+	}
+	settings, err := fetchAccountSettings(db, yID)
+	if err != nil {
+		t.Fatalf("[fetchAccountSettings] unexpected error: %v", err)
+	}
+	if settings.MinPayout != dcrutil.Amount(250000000) ||
+		settings.DigestInterval != time.Hour*24 || !settings.Locked {
+		t.Fatalf("unexpected account settings %+v", settings)
+	}
+	if _, ok := dg.accruals[yID]; !ok {
+		t.Fatal("expected the account to be opted into digests")
+	}
+
+	// Ensure clearing the minimum payout echoes the pool's minimum
+	// payment and leaves other options unchanged.
+	applied, sErr = setOption(m, map[string]interface{}{MinPayoutOption: 0.0})
+	if sErr != nil {
+		t.Fatalf("unexpected set option error: %v", sErr)
+	}
+	if *applied.MinPayout != minPayment.ToCoin() || *applied.DigestHours != 24 {
+		t.Fatalf("unexpected applied options %+v", applied)
+	}
+
+	// Ensure clients of accounts unlocked since they authorized are
+	// refused.
+	settings.Locked = false
+	err = persistAccountSettings(db, yID, settings)
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	_, sErr = setOption(m, map[string]interface{}{MinPayoutOption: 1.0})
+	if sErr == nil || sErr.Code != AccountNotVerified {
+		t.Fatalf("expected an account not verified error, got %v", sErr)
+	}
+	client.cancel()
+	m.awaitDisconnect()
+
+	for _, bkt := range [][]byte{accountSettingsBkt, digestBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+}
+
+func testNoncePartitioning(t *testing.T) {
+	// Ensure instance ids are validated against the reserved bits.
+	tests := []struct {
+		instanceID uint32
+		bits       uint32
+		valid      bool
+	}{
+		{0, 0, true},
+		{1, 0, false},
+		{1, 1, true},
+		{2, 1, false},
+		{0xff, MaxInstanceBits, true},
+		{0x100, MaxInstanceBits, false},
+		{0, MaxInstanceBits + 1, false},
+	}
+	for _, test := range tests {
+		err := ValidateInstanceID(test.instanceID, test.bits)
+		if (err == nil) != test.valid {
+			t.Fatalf("expected validity %v for instance id %d in %d bits, "+
+				"got %v", test.valid, test.instanceID, test.bits, err)
+		}
+	}
+
+	// Ensure only the reserved leading bits of extraNonce1s are replaced
+	// by the instance id.
+	id := []byte{0xff, 0xff, 0xff, 0xff}
+	partitionExtraNonce1(id, 0, 0)
+	if !bytes.Equal(id, []byte{0xff, 0xff, 0xff, 0xff}) {
+		t.Fatalf("expected an unpartitioned extraNonce1, got %x", id)
+	}
+	partitionExtraNonce1(id, 0x5, 4)
+	if !bytes.Equal(id, []byte{0x5f, 0xff, 0xff, 0xff}) {
+		t.Fatalf("expected extraNonce1 5fffffff, got %x", id)
+	}
+	id = []byte{0x00, 0x12, 0x34, 0x56}
+	partitionExtraNonce1(id, 0xa5, MaxInstanceBits)
+	if !bytes.Equal(id, []byte{0xa5, 0x12, 0x34, 0x56}) {
+		t.Fatalf("expected extraNonce1 a5123456, got %x", id)
+	}
+}
+
+func testStaleGrace(t *testing.T, db *bolt.DB) {
+	var blocks int
+	cCfg := &ClientConfig{
+		StaleGracePeriod: time.Minute,
+		SubmitWork: func(*string) (bool, string, error) {
+			blocks++
+			return false, "", nil
+		},
+	}
+	client, err := fastPathClient(db, cCfg)
+	if err != nil {
+		t.Fatalf("[fastPathClient] unexpected error: %v", err)
+	}
+	client.cfg.SoloPool = false
+	events := client.cfg.Events.Subscribe(8, EventShareAccepted,
+		EventShareRejected)
+	defer client.cfg.Events.Unsubscribe(events)
+
+	// Superseded jobs are those of a chain tip other than the current work.
+	client.cfg.FetchCurrentWork = func() *CurrentWork {
+		return &CurrentWork{
+			Header: fastPathWorkE[:8] + "ff" + fastPathWorkE[10:],
+		}
+	}
+	prev, err := fastPathJob("954cee5d", false)
+	if err != nil {
+		t.Fatalf("[fastPathJob] unexpected error: %v", err)
+	}
+	last, err := fastPathJob("964cee5d", false)
+	if err != nil {
+		t.Fatalf("[fastPathJob] unexpected error: %v", err)
+	}
+	for _, job := range []*Job{prev, last} {
+		err = job.Create(db)
+		if err != nil {
+			t.Fatalf("[Create] unexpected error: %v", err)
+		}
+	}
+
+	id := uint64(1)
+	submit := func(jobID string, nonce string) *StratumError {
+		req, err := fastPathRequest(SubmitWorkRequest(&id, "tcl", jobID,
+			"00000000", "954cee5d", nonce))
+		if err != nil {
+			t.Fatalf("[fastPathRequest] unexpected error: %v", err)
+		}
+		client.handleSubmitWorkRequest(req, true, client.fetchDifficultyInfo())
+		status, sErr, err := ParseSubmitWorkResponse((<-client.ch).(*Response))
+		if err != nil {
+			t.Fatalf("[ParseSubmitWorkResponse] unexpected error: %v", err)
+		}
+		if status {
+			return nil
+		}
+		return sErr
+	}
+	lateShares := func() int {
+		var count int
+		err := db.View(func(tx *bolt.Tx) error {
+			bkt, err := fetchShareBucket(tx)
+			if err != nil {
+				return err
+			}
+			return bkt.ForEach(func(k, v []byte) error {
+				var share Share
+				err := json.Unmarshal(v, &share)
+				if err != nil {
+					return err
+				}
+				if share.Late && share.Account == client.account {
+					count++
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("unable to count late shares: %v", err)
+		}
+		return count
+	}
+
+	// Ensure work of superseded jobs is stale without a clean job
+	// notification.
+	sErr := submit(prev.UUID, "00000001")
+	if sErr == nil || sErr.Code != StaleJob {
+		t.Fatalf("expected a stale job error, got %v", sErr)
+	}
+	if event := <-events.Events(); event.Kind != EventShareRejected {
+		t.Fatalf("expected a share rejected event, got %v", event.Kind)
+	}
+
+	// Ensure work of the job notified before a clean job notification is
+	// credited as late within the grace period, without being submitted
+	// to the network.
+	client.recordNotifiedJob(prev.UUID, true)
+	client.recordNotifiedJob(last.UUID, true)
+	sErr = submit(prev.UUID, "00000002")
+	if sErr != nil {
+		t.Fatalf("expected the late share to be accepted, got %v", sErr)
+	}
+	event := <-events.Events()
+	if event.Kind != EventShareAccepted || !event.Late {
+		t.Fatalf("expected a late share accepted event, got %+v", event)
+	}
+	if atomic.LoadInt64(&client.late) != 1 {
+		t.Fatalf("expected 1 late share, got %d",
+			atomic.LoadInt64(&client.late))
+	}
+	if lateShares() != 1 {
+		t.Fatalf("expected 1 late share record, got %d", lateShares())
+	}
+	if blocks != 0 {
+		t.Fatalf("expected late work to not be submitted, got %d "+
+			"submissions", blocks)
+	}
+
+	// Ensure work of superseded jobs other than the job notified before the
+	// clean job notification is still stale.
+	sErr = submit(last.UUID, "00000003")
+	if sErr == nil || sErr.Code != StaleJob {
+		t.Fatalf("expected a stale job error, got %v", sErr)
+	}
+	<-events.Events()
+
+	// Ensure late work past the grace period is stale.
+	client.graceMtx.Lock()
+	client.graceUntil = time.Now()
+	client.graceMtx.Unlock()
+	sErr = submit(prev.UUID, "00000004")
+	if sErr == nil || sErr.Code != StaleJob {
+		t.Fatalf("expected a stale job error, got %v", sErr)
+	}
+	<-events.Events()
+
+	// Ensure no grace period is opened when disabled.
+	client.cfg.StaleGracePeriod = 0
+	client.recordNotifiedJob(prev.UUID, true)
+	client.recordNotifiedJob(last.UUID, true)
+	sErr = submit(prev.UUID, "00000005")
+	if sErr == nil || sErr.Code != StaleJob {
+		t.Fatalf("expected a stale job error, got %v", sErr)
+	}
+	if lateShares() != 1 {
+		t.Fatalf("expected 1 late share record, got %d", lateShares())
+	}
+
+	for _, bkt := range [][]byte{jobBkt, submissionBkt, shareBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
 }
@@ -0,0 +1,114 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// clockSkewSamples represents the number of recent share timestamps
+	// the clock skew of a client is the median of.
+	clockSkewSamples = 15
+
+	// minClockSkewSamples represents the number of share timestamps
+	// required before the clock skew of a client is reported.
+	minClockSkewSamples = 5
+)
+
+// clockSkew tracks the differences between the timestamps of the shares
+// submitted by a client and the pool's clock.
+type clockSkew struct {
+	samples [clockSkewSamples]time.Duration
+	count   int
+	next    int
+	mtx     sync.Mutex
+}
+
+// record adds the provided share timestamp, as seen at the provided pool
+// time, and returns the median skew of the recent samples. The median is
+// only valid once enough samples were recorded.
+func (s *clockSkew) record(timestamp time.Time, now time.Time) (time.Duration, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.samples[s.next] = timestamp.Sub(now)
+	s.next = (s.next + 1) % clockSkewSamples
+	if s.count < clockSkewSamples {
+		s.count++
+	}
+	return s.medianLocked()
+}
+
+// median returns the median skew of the recent samples and if enough
+// samples were recorded for it to be valid.
+func (s *clockSkew) median() (time.Duration, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.medianLocked()
+}
+
+// medianLocked returns the median skew of the recent samples.
+//
+// This must be called with the mutex held.
+func (s *clockSkew) medianLocked() (time.Duration, bool) {
+	if s.count < minClockSkewSamples {
+		return 0, false
+	}
+	sorted := make([]time.Duration, s.count)
+	copy(sorted, s.samples[:s.count])
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted[s.count/2], true
+}
+
+// fetchClockSkew returns the median clock skew of the client and if the
+// skew exceeds the maximum allowed, zero if too few shares were submitted
+// to tell.
+func (c *Client) fetchClockSkew() (time.Duration, bool) {
+	skew, ok := c.skew.median()
+	if !ok {
+		return 0, false
+	}
+	return skew, c.cfg.MaxClockSkew > 0 && absDuration(skew) > c.cfg.MaxClockSkew
+}
+
+// checkClockSkew records the timestamp of a share submitted by the client.
+// The first time the median skew of a connection exceeds the maximum
+// allowed the miner is advised to synchronize its clock, since blocks with
+// timestamps too far off the network's time are rejected even though they
+// meet the pool target.
+func (c *Client) checkClockSkew(timestamp time.Time) {
+	skew, ok := c.skew.record(timestamp, time.Now())
+	if !ok || c.cfg.MaxClockSkew == 0 ||
+		absDuration(skew) <= c.cfg.MaxClockSkew {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&c.skewNotified, 0, 1) {
+		return
+	}
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+	skew = absDuration(skew).Round(time.Second)
+	c.logger.Warnf("clock of %s is %v %s the pool", c.fetchIdentity(), skew,
+		direction)
+	c.queueMessage(ShowMessageNotification(fmt.Sprintf("Your clock is %v "+
+		"%s the pool, blocks you find may be rejected by the network. "+
+		"Please synchronize it using NTP.", skew, direction)))
+}
+
+// absDuration returns the absolute value of the provided duration.
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
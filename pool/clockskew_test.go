@@ -0,0 +1,75 @@
+package pool
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func testClockSkew(t *testing.T, db *bolt.DB) {
+	// Ensure the skew is the median of the recent samples and is only
+	// reported once enough samples were recorded.
+	var skew clockSkew
+	now := time.Now()
+	offsets := []time.Duration{time.Hour, -time.Minute, 2 * time.Minute,
+		3 * time.Minute, -time.Hour}
+	for i, offset := range offsets {
+		median, ok := skew.record(now.Add(offset), now)
+		if ok != (i == len(offsets)-1) {
+			t.Fatalf("unexpected median validity after %d samples", i+1)
+		}
+		if ok && median != 2*time.Minute {
+			t.Fatalf("expected a median skew of %v, got %v",
+				2*time.Minute, median)
+		}
+	}
+	for i := 0; i < clockSkewSamples; i++ {
+		skew.record(now.Add(-10*time.Second), now)
+	}
+	median, ok := skew.median()
+	if !ok || median != -10*time.Second {
+		t.Fatalf("expected old samples to be replaced, got %v", median)
+	}
+
+	// Ensure clients with skewed clocks are advised to synchronize them
+	// once per connection.
+	cCfg := &ClientConfig{MaxClockSkew: 5 * time.Minute}
+	client, err := fastPathClient(db, cCfg)
+	if err != nil {
+		t.Fatalf("[fastPathClient] unexpected error: %v", err)
+	}
+	for i := 0; i < clockSkewSamples; i++ {
+		client.checkClockSkew(time.Now().Add(-10 * time.Minute))
+	}
+	var messages []string
+	for len(client.ch) > 0 {
+		msg := (<-client.ch).(*Request)
+		if msg.Method == ShowMessage {
+			messages = append(messages, msg.Params.([]string)[0])
+		}
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], "behind") {
+		t.Fatalf("expected a single clock skew message, got %v", messages)
+	}
+	median, skewed := client.fetchClockSkew()
+	if !skewed || median > -10*time.Minute+time.Second {
+		t.Fatalf("expected a skewed client, got a skew of %v", median)
+	}
+
+	// Ensure clients within the maximum skew are not reported.
+	client, err = fastPathClient(db, cCfg)
+	if err != nil {
+		t.Fatalf("[fastPathClient] unexpected error: %v", err)
+	}
+	for i := 0; i < clockSkewSamples; i++ {
+		client.checkClockSkew(time.Now().Add(time.Minute))
+	}
+	if len(client.ch) != 0 {
+		t.Fatal("expected no clock skew message")
+	}
+	if _, skewed := client.fetchClockSkew(); skewed {
+		t.Fatal("expected the client not to be skewed")
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+var (
+	// connAuditQueueSize represents the default number of disconnected
+	// clients queued for auditing, clients are dropped once the queue is
+	// full.
+	connAuditQueueSize = 4096
+
+	// connAuditBatchSize represents the maximum number of connection
+	// records persisted in a single database transaction.
+	connAuditBatchSize = 256
+
+	// connAuditPruneInterval represents the period between prunes of
+	// connection records older than the retention period.
+	connAuditPruneInterval = time.Hour
+)
+
+// ConnectionRecord represents the audit record of a client connection,
+// persisted when the client is removed from its endpoint. Timestamps are
+// in nanoseconds.
+type ConnectionRecord struct {
+	ClientID       string `json:"clientid"`
+	IP             string `json:"ip"`
+	Miner          string `json:"miner"`
+	Account        string `json:"account,omitempty"`
+	Worker         string `json:"worker,omitempty"`
+	ConnectedOn    int64  `json:"connectedon"`
+	DisconnectedOn int64  `json:"disconnectedon"`
+	Accepted       int64  `json:"accepted"`
+	Rejected       int64  `json:"rejected"`
+	Coalesced      int64  `json:"coalesced,omitempty"`
+	Dropped        int64  `json:"dropped,omitempty"`
+	WriteFailures  int64  `json:"writefailures,omitempty"`
+	Reason         string `json:"reason"`
+}
+
+// connectionRecordKey returns the key of the provided connection record.
+// Keys are prefixed by the big endian disconnect time so records sort by
+// the time their connection ended.
+func connectionRecordKey(record *ConnectionRecord) []byte {
+	key := make([]byte, 8, 8+len(record.ClientID))
+	binary.BigEndian.PutUint64(key, uint64(record.DisconnectedOn))
+	return append(key, record.ClientID...)
+}
+
+// fetchConnectionAuditBucket is a helper function for getting the
+// connection audit bucket.
+func fetchConnectionAuditBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(connectionAuditBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(connectionAuditBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// persistConnectionRecords saves the provided connection records to the
+// database in a single transaction.
+func persistConnectionRecords(db *bolt.DB, records []*ConnectionRecord) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchConnectionAuditBucket(tx)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			b, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			err = bkt.Put(connectionRecordKey(record), b)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// pruneConnectionRecords removes the records of connections which ended
+// before the provided time in nanoseconds. It returns the number of
+// records removed.
+func pruneConnectionRecords(db *bolt.DB, before int64) (int, error) {
+	var pruned int
+	err := db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchConnectionAuditBucket(tx)
+		if err != nil {
+			return err
+		}
+		toDelete := [][]byte{}
+		c := bkt.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if int64(binary.BigEndian.Uint64(k[:8])) >= before {
+				break
+			}
+			toDelete = append(toDelete, k)
+		}
+		for _, k := range toDelete {
+			err := bkt.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		pruned = len(toDelete)
+		return nil
+	})
+	return pruned, err
+}
+
+// ConnectionQuery represents the filters of a connection audit query,
+// empty filters match all connections.
+type ConnectionQuery struct {
+	// IP represents the ip the connections originated from.
+	IP string
+	// Account represents the account id the connections were authorized
+	// as.
+	Account string
+	// Since and Until represent the time range, in nanoseconds, the
+	// connections were open during. A zero bound leaves the range open.
+	Since int64
+	Until int64
+	// Limit represents the maximum number of records returned, zero for
+	// no limit.
+	Limit int
+}
+
+// matches returns if the provided connection record satisfies the query.
+func (q *ConnectionQuery) matches(record *ConnectionRecord) bool {
+	if q.IP != "" && record.IP != q.IP {
+		return false
+	}
+	if q.Account != "" && record.Account != q.Account {
+		return false
+	}
+	if q.Until != 0 && record.ConnectedOn > q.Until {
+		return false
+	}
+	return true
+}
+
+// FetchConnectionRecords fetches the audit records of connections matching
+// the provided query. List is ordered, most recently ended connection
+// comes first.
+func FetchConnectionRecords(db *bolt.DB, q *ConnectionQuery) ([]*ConnectionRecord, error) {
+	records := make([]*ConnectionRecord, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchConnectionAuditBucket(tx)
+		if err != nil {
+			return err
+		}
+		c := bkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			// Connections which ended before the queried range were not
+			// open during it, neither were any preceding them.
+			if int64(binary.BigEndian.Uint64(k[:8])) < q.Since {
+				break
+			}
+			var record ConnectionRecord
+			err := json.Unmarshal(v, &record)
+			if err != nil {
+				return err
+			}
+			if !q.matches(&record) {
+				continue
+			}
+			records = append(records, &record)
+			if q.Limit > 0 && len(records) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ConnectionAuditConfig represents configuration details for the
+// connection audit log.
+type ConnectionAuditConfig struct {
+	// DB represents the pool database.
+	DB *bolt.DB
+	// Retention represents the period connection records are kept for.
+	Retention time.Duration
+	// QueueSize represents the number of disconnected clients queued for
+	// auditing, clients are dropped once the queue is full. Zero uses the
+	// default.
+	QueueSize int
+	// Events represents the hub's event bus disconnected clients are
+	// audited from.
+	Events *EventBus
+	// HubWg represents the hub's waitgroup.
+	HubWg *sync.WaitGroup
+}
+
+// ConnectionAudit persists the connections of clients disconnected from
+// the pool's endpoints, published on the hub's event bus, for abuse
+// investigations. Records are queued and written in batches
+// asynchronously, clients are never blocked on the audit log.
+type ConnectionAudit struct {
+	cfg    *ConnectionAuditConfig
+	events *Subscription
+}
+
+// NewConnectionAudit creates a connection audit log.
+func NewConnectionAudit(cCfg *ConnectionAuditConfig) *ConnectionAudit {
+	queueSize := cCfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = connAuditQueueSize
+	}
+	return &ConnectionAudit{
+		cfg:    cCfg,
+		events: cCfg.Events.Subscribe(queueSize, EventClientDisconnected),
+	}
+}
+
+// writeBatch persists the connection record of the provided event along
+// with those of the events queued behind it, up to the batch size.
+func (ca *ConnectionAudit) writeBatch(event *HubEvent) {
+	records := make([]*ConnectionRecord, 0, 1)
+	for event != nil {
+		if event.Connection != nil {
+			records = append(records, event.Connection)
+		}
+		if len(records) >= connAuditBatchSize {
+			break
+		}
+		event = ca.nextQueued()
+	}
+	if len(records) == 0 {
+		return
+	}
+	err := persistConnectionRecords(ca.cfg.DB, records)
+	if err != nil {
+		log.Errorf("unable to persist %d connection record(s): %v",
+			len(records), err)
+	}
+}
+
+// nextQueued returns the next queued event without blocking, nil if no
+// event is queued.
+func (ca *ConnectionAudit) nextQueued() *HubEvent {
+	select {
+	case event := <-ca.events.Events():
+		return event
+	default:
+		return nil
+	}
+}
+
+// Dropped returns the number of disconnected clients dropped because the
+// audit queue was full.
+func (ca *ConnectionAudit) Dropped() uint64 {
+	return ca.events.Dropped()
+}
+
+// prune removes connection records older than the retention period.
+func (ca *ConnectionAudit) prune(now time.Time) error {
+	before := now.Add(-ca.cfg.Retention).UnixNano()
+	pruned, err := pruneConnectionRecords(ca.cfg.DB, before)
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		log.Debugf("Pruned %d connection record(s) older than %v", pruned,
+			ca.cfg.Retention)
+	}
+	return nil
+}
+
+// close persists the connection records still queued.
+func (ca *ConnectionAudit) close() {
+	ca.cfg.Events.Unsubscribe(ca.events)
+	records := make([]*ConnectionRecord, 0)
+	for event := range ca.events.Events() {
+		if event.Connection != nil {
+			records = append(records, event.Connection)
+		}
+	}
+	if len(records) > 0 {
+		err := persistConnectionRecords(ca.cfg.DB, records)
+		if err != nil {
+			log.Errorf("unable to persist %d connection record(s): %v",
+				len(records), err)
+		}
+	}
+	if dropped := ca.Dropped(); dropped > 0 {
+		log.Warnf("%d connection(s) were dropped from the audit log",
+			dropped)
+	}
+}
+
+// run persists the connections of disconnected clients and prunes expired
+// connection records until the provided context is cancelled. It must be
+// run as a goroutine.
+func (ca *ConnectionAudit) run(ctx context.Context) {
+	pruneTicker := time.NewTicker(connAuditPruneInterval)
+	defer pruneTicker.Stop()
+	err := ca.prune(time.Now())
+	if err != nil {
+		log.Errorf("unable to prune connection records: %v", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			ca.close()
+			ca.cfg.HubWg.Done()
+			return
+
+		case event := <-ca.events.Events():
+			ca.writeBatch(event)
+
+		case <-pruneTicker.C:
+			err := ca.prune(time.Now())
+			if err != nil {
+				log.Errorf("unable to prune connection records: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package pool
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func testConnectionAudit(t *testing.T, db *bolt.DB) {
+	// Ensure a client's connection record carries its share counts and
+	// teardown reason.
+	events := NewEventBus()
+	c := &Client{
+		id:          "00000001/cpu",
+		addr:        &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5550},
+		connectedOn: time.Now().Add(-time.Minute).UnixNano(),
+		account:     xID,
+		name:        "rig",
+		cfg: &ClientConfig{
+			FetchMiner: func() string {
+				return CPU
+			},
+			Events: events,
+		},
+	}
+	c.setDifficultyInfo(&DifficultyInfo{
+		target:     new(big.Rat).SetInt64(1),
+		difficulty: new(big.Rat).SetInt64(1),
+		powLimit:   new(big.Rat).SetInt64(1),
+		multiplier: new(big.Rat).SetInt64(1),
+	})
+	c.publishShareEvent(EventShareAccepted, "", "job", false)
+	c.publishShareEvent(EventShareAccepted, "", "job", false)
+	c.publishShareEvent(EventShareRejected, "stale", "job", false)
+	record := c.connectionRecord(DisconnectEOF.String())
+	if record.Accepted != 2 || record.Rejected != 1 {
+		t.Fatalf("expected 2 accepted and 1 rejected shares, got %d and %d",
+			record.Accepted, record.Rejected)
+	}
+	if record.IP != "127.0.0.1" || record.Account != xID ||
+		record.Worker != "rig" || record.Miner != CPU ||
+		record.Reason != "eof" {
+		t.Fatalf("unexpected connection record %+v", record)
+	}
+	if record.DisconnectedOn < record.ConnectedOn {
+		t.Fatalf("expected the connection to end after it started, got "+
+			"%d before %d", record.DisconnectedOn, record.ConnectedOn)
+	}
+
+	// Ensure the connections of disconnected clients are persisted by the
+	// audit log.
+	now := time.Now()
+	newRecord := func(id string, ip string, account string, age time.Duration) *ConnectionRecord {
+		return &ConnectionRecord{
+			ClientID:       id,
+			IP:             ip,
+			Miner:          CPU,
+			Account:        account,
+			ConnectedOn:    now.Add(-age - time.Hour).UnixNano(),
+			DisconnectedOn: now.Add(-age).UnixNano(),
+			Reason:         DisconnectEOF.String(),
+		}
+	}
+	var wg sync.WaitGroup
+	audit := NewConnectionAudit(&ConnectionAuditConfig{
+		DB:        db,
+		Retention: time.Hour * 24,
+		Events:    events,
+		HubWg:     &wg,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	wg.Add(1)
+	go audit.run(ctx)
+	records := []*ConnectionRecord{
+		newRecord("a", "10.0.0.1", xID, time.Hour*48),
+		newRecord("b", "10.0.0.1", "", time.Hour*3),
+		newRecord("c", "10.0.0.2", yID, time.Hour*2),
+		newRecord("d", "10.0.0.1", yID, time.Hour),
+	}
+	for _, record := range records {
+		events.publish(&HubEvent{
+			Kind:       EventClientDisconnected,
+			Connection: record,
+		})
+	}
+	events.publish(&HubEvent{Kind: EventClientDisconnected})
+	cancel()
+	wg.Wait()
+
+	fetched, err := FetchConnectionRecords(db, &ConnectionQuery{})
+	if err != nil {
+		t.Fatalf("[FetchConnectionRecords] unexpected error: %v", err)
+	}
+	if len(fetched) != len(records) {
+		t.Fatalf("expected %d connection records, got %d", len(records),
+			len(fetched))
+	}
+	if fetched[0].ClientID != "d" || fetched[len(fetched)-1].ClientID != "a" {
+		t.Fatal("expected the most recently ended connection first")
+	}
+
+	// Ensure connection records are queried by ip, account and time range.
+	tests := []struct {
+		name  string
+		query *ConnectionQuery
+		ids   []string
+	}{{
+		name:  "ip",
+		query: &ConnectionQuery{IP: "10.0.0.1"},
+		ids:   []string{"d", "b", "a"},
+	}, {
+		name:  "account",
+		query: &ConnectionQuery{Account: yID},
+		ids:   []string{"d", "c"},
+	}, {
+		name:  "unknown ip",
+		query: &ConnectionQuery{IP: "10.0.0.3"},
+		ids:   []string{},
+	}, {
+		name: "time range",
+		query: &ConnectionQuery{
+			Since: now.Add(-time.Minute * 210).UnixNano(),
+			Until: now.Add(-time.Minute * 150).UnixNano(),
+		},
+		ids: []string{"c", "b"},
+	}, {
+		name: "ip and time range",
+		query: &ConnectionQuery{
+			IP:    "10.0.0.1",
+			Since: now.Add(-time.Hour * 24).UnixNano(),
+		},
+		ids: []string{"d", "b"},
+	}, {
+		name:  "limit",
+		query: &ConnectionQuery{Limit: 2},
+		ids:   []string{"d", "c"},
+	}}
+	for _, test := range tests {
+		fetched, err := FetchConnectionRecords(db, test.query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		ids := make([]string, 0, len(fetched))
+		for _, record := range fetched {
+			ids = append(ids, record.ClientID)
+		}
+		if len(ids) != len(test.ids) {
+			t.Fatalf("%s: expected records %v, got %v", test.name,
+				test.ids, ids)
+		}
+		for i := range ids {
+			if ids[i] != test.ids[i] {
+				t.Fatalf("%s: expected records %v, got %v", test.name,
+					test.ids, ids)
+			}
+		}
+	}
+
+	// Ensure connection records older than the retention period are
+	// pruned.
+	err = audit.prune(now)
+	if err != nil {
+		t.Fatalf("[prune] unexpected error: %v", err)
+	}
+	fetched, err = FetchConnectionRecords(db, &ConnectionQuery{})
+	if err != nil {
+		t.Fatalf("[FetchConnectionRecords] unexpected error: %v", err)
+	}
+	if len(fetched) != 3 || fetched[len(fetched)-1].ClientID != "b" {
+		t.Fatalf("expected 3 connection records after pruning, got %d",
+			len(fetched))
+	}
+
+	err = emptyBucket(db, connectionAuditBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
@@ -18,6 +18,8 @@ var (
 	poolBkt = []byte("poolbkt")
 	// accountBkt stores all registered accounts for the mining pool.
 	accountBkt = []byte("accountbkt")
+	// accountSettingsBkt stores the settings of pool accounts.
+	accountSettingsBkt = []byte("accountsettingsbkt")
 	// shareBkt stores all client shares for the mining pool.
 	shareBkt = []byte("sharebkt")
 	// jobBkt stores jobs delivered to clients, it is periodically pruned by the
@@ -34,6 +36,62 @@ var (
 	// Confirmed processed payements are sourced from the payment bucket and
 	// archived.
 	paymentArchiveBkt = []byte("paymentarchivebkt")
+	// paymentTotalBkt stores the total amount of archived payments paid to
+	// each account.
+	paymentTotalBkt = []byte("paymenttotalbkt")
+	// workerBkt stores the activity states of pool workers, it is
+	// periodically updated by the worker monitor.
+	workerBkt = []byte("workerbkt")
+	// statsBkt stores periodic snapshots of the pool's mining activity, it
+	// is periodically rolled up into the stats rollup bucket.
+	statsBkt = []byte("statsbkt")
+	// statsRollupBkt stores hourly rollups of pool activity snapshots, it
+	// is periodically pruned.
+	statsRollupBkt = []byte("statsrollupbkt")
+	// diagnosticsBkt stores inconsistent records quarantined by the
+	// database integrity check and the progress of unfinished checks.
+	diagnosticsBkt = []byte("diagnosticsbkt")
+	// minerStatsBkt stores the cumulative share and block counters of each
+	// miner type, it is periodically updated by the miner stats tracker.
+	minerStatsBkt = []byte("minerstatsbkt")
+	// accountMergeBkt stores the audit records of merged accounts.
+	accountMergeBkt = []byte("accountmergebkt")
+	// submissionBkt stores the digests of accepted submissions of unpruned
+	// jobs, used to refuse duplicate submissions across restarts.
+	submissionBkt = []byte("submissionbkt")
+	// paymentPlanBkt stores the most recent payment plans recorded by
+	// payment dry runs, keyed by payment height.
+	paymentPlanBkt = []byte("paymentplanbkt")
+	// connectionAuditBkt stores the audit records of client connections,
+	// keyed by disconnect time. It is periodically pruned by the
+	// connection audit log.
+	connectionAuditBkt = []byte("connectionauditbkt")
+	// accountMetadataLogBkt stores the audit records of changes to the
+	// metadata of accounts, keyed by account id and change time.
+	accountMetadataLogBkt = []byte("accountmetadatalogbkt")
+	// lostBlockBkt stores the block candidates which failed submission to
+	// the consensus daemon, keyed by the time they were lost.
+	lostBlockBkt = []byte("lostblockbkt")
+	// banBkt stores the bans in effect, keyed by banned ip range.
+	banBkt = []byte("banbkt")
+	// banAuditBkt stores the audit records of bans added to and removed
+	// from the ban list, keyed by change time.
+	banAuditBkt = []byte("banauditbkt")
+	// digestBkt stores the activity accrued toward the next digest of
+	// accounts opted into activity digests, keyed by account id.
+	digestBkt = []byte("digestbkt")
+	// accountPaymentBkt indexes the pending payments of accounts, keyed by
+	// account id followed by payment id.
+	accountPaymentBkt = []byte("accountpaymentbkt")
+	// accountPaymentArchiveBkt indexes the archived payments of accounts,
+	// keyed by account id followed by payment id.
+	accountPaymentArchiveBkt = []byte("accountpaymentarchivebkt")
+	// accountShareBkt indexes the shares of accounts, keyed by account id
+	// followed by share key.
+	accountShareBkt = []byte("accountsharebkt")
+	// paymentFailureBkt stores the failed payment dispatch awaiting a retry
+	// or requiring attention, keyed by payment height.
+	paymentFailureBkt = []byte("paymentfailurebkt")
 	// versionK is the key of the current version of the database.
 	versionK = []byte("version")
 	// lastPaymentCreatedOn is the key of the last time a payment was
@@ -50,8 +108,15 @@ var (
 	soloPool = []byte("solopool")
 	// csrfSecret is the CSRF secret key.
 	csrfSecret = []byte("csrfsecret")
+	// paymentCycleK is the key of the payment cycle being dispatched.
+	paymentCycleK = []byte("paymentcycle")
+	// shareBoundaryK is the key of the end of the last share window marked
+	// for a payment batch.
+	shareBoundaryK = []byte("shareboundary")
 	// poolFeesK is the key used to track pool fee payouts.
 	poolFeesK = "fees"
+	// donationsK is the key used to bundle donation payouts.
+	donationsK = "donations"
 )
 
 // openDB creates a connection to the provided bolt storage, the returned
@@ -65,6 +130,49 @@ func openDB(storage string) (*bolt.DB, error) {
 	return db, nil
 }
 
+// OpenDBReadOnly opens the provided bolt storage for reading only, for
+// external tools querying the pool database. Buckets are not created and
+// upgrades are not run, databases not at the latest version are refused.
+//
+// Read-only opens share the file lock with other readers but are blocked
+// by the exclusive lock of a running pool, the database of a live pool
+// should be queried from a backup copy.
+func OpenDBReadOnly(storage string) (*bolt.DB, error) {
+	db, err := bolt.Open(storage, 0600,
+		&bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, MakeError(ErrDBOpen, "", err)
+	}
+	var version uint32
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = fetchDBVersion(tx)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if version != DBVersion {
+		db.Close()
+		desc := fmt.Sprintf("database version %d does not match the "+
+			"supported version %d, read-only databases are not upgraded",
+			version, DBVersion)
+		return nil, MakeError(ErrDBUpgrade, desc, nil)
+	}
+	return db, nil
+}
+
+// updateIfWritable runs the provided function in a read-write transaction,
+// or in a read-only transaction if the database was opened read-only. The
+// function should only persist changes if the transaction is writable.
+func updateIfWritable(db *bolt.DB, fn func(tx *bolt.Tx) error) error {
+	if db.IsReadOnly() {
+		return db.View(fn)
+	}
+	return db.Update(fn)
+}
+
 // createNestedBucket creates a nested child bucket of the provided parent.
 func createNestedBucket(parent *bolt.Bucket, child []byte) error {
 	_, err := parent.CreateBucketIfNotExists(child)
@@ -98,6 +206,10 @@ func createBuckets(db *bolt.DB) error {
 		if err != nil {
 			return err
 		}
+		err = createNestedBucket(pbkt, accountSettingsBkt)
+		if err != nil {
+			return err
+		}
 		err = createNestedBucket(pbkt, shareBkt)
 		if err != nil {
 			return err
@@ -114,7 +226,83 @@ func createBuckets(db *bolt.DB) error {
 		if err != nil {
 			return err
 		}
-		return createNestedBucket(pbkt, paymentArchiveBkt)
+		err = createNestedBucket(pbkt, paymentArchiveBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, paymentTotalBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, workerBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, statsBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, statsRollupBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, diagnosticsBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, minerStatsBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, accountMergeBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, submissionBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, paymentPlanBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, connectionAuditBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, accountMetadataLogBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, lostBlockBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, banBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, banAuditBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, digestBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, accountPaymentBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, accountPaymentArchiveBkt)
+		if err != nil {
+			return err
+		}
+		err = createNestedBucket(pbkt, accountShareBkt)
+		if err != nil {
+			return err
+		}
+		return createNestedBucket(pbkt, paymentFailureBkt)
 	})
 	return err
 }
@@ -128,6 +316,51 @@ func backup(db *bolt.DB, file string) error {
 	return err
 }
 
+// compact saves a compacted copy of the db to file, the db itself is left
+// untouched. The copy can replace the db file while the pool is stopped.
+func compact(db *bolt.DB, file string) error {
+	dst, err := openDB(file)
+	if err != nil {
+		return err
+	}
+	err = db.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, src *bolt.Bucket) error {
+				bkt, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(src, bkt)
+			})
+		})
+	})
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// copyBucket copies the records and nested buckets of the provided bucket
+// into the destination bucket, filling its pages.
+func copyBucket(src *bolt.Bucket, dst *bolt.Bucket) error {
+	dst.FillPercent = 1.0
+	err := dst.SetSequence(src.Sequence())
+	if err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		bkt, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(src.Bucket(k), bkt)
+	})
+}
+
 // purge removes all existing data and recreates the db.
 func purge(db *bolt.DB) error {
 	err := db.Update(func(tx *bolt.Tx) error {
@@ -140,6 +373,10 @@ func purge(db *bolt.DB) error {
 		if err != nil {
 			return err
 		}
+		err = pbkt.DeleteBucket(accountSettingsBkt)
+		if err != nil {
+			return err
+		}
 		err = pbkt.DeleteBucket(shareBkt)
 		if err != nil {
 			return err
@@ -160,6 +397,82 @@ func purge(db *bolt.DB) error {
 		if err != nil {
 			return err
 		}
+		err = pbkt.DeleteBucket(paymentTotalBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(workerBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(statsBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(statsRollupBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(diagnosticsBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(minerStatsBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(accountMergeBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(submissionBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(paymentPlanBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(connectionAuditBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(accountMetadataLogBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(lostBlockBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(banBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(banAuditBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(digestBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(accountPaymentBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(accountPaymentArchiveBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(accountShareBkt)
+		if err != nil {
+			return err
+		}
+		err = pbkt.DeleteBucket(paymentFailureBkt)
+		if err != nil {
+			return err
+		}
 		err = pbkt.Delete(txFeeReserve)
 		if err != nil {
 			return err
@@ -180,6 +493,14 @@ func purge(db *bolt.DB) error {
 		if err != nil {
 			return err
 		}
+		err = pbkt.Delete(paymentCycleK)
+		if err != nil {
+			return err
+		}
+		err = pbkt.Delete(shareBoundaryK)
+		if err != nil {
+			return err
+		}
 		return pbkt.Delete(csrfSecret)
 	})
 	if err != nil {
@@ -1,9 +1,11 @@
 package pool
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/Eacred/eacrd/chaincfg"
@@ -35,6 +37,10 @@ func testInitDB(t *testing.T) {
 		if err == nil {
 			return fmt.Errorf("expected accountBkt to exist already")
 		}
+		_, err = pbkt.CreateBucket(accountSettingsBkt)
+		if err == nil {
+			return fmt.Errorf("expected accountSettingsBkt to exist already")
+		}
 		_, err = pbkt.CreateBucket(shareBkt)
 		if err == nil {
 			return fmt.Errorf("expected shareBkt to exist already")
@@ -55,6 +61,82 @@ func testInitDB(t *testing.T) {
 		if err == nil {
 			return fmt.Errorf("expected paymentArchiveBkt to exist already")
 		}
+		_, err = pbkt.CreateBucket(paymentTotalBkt)
+		if err == nil {
+			return fmt.Errorf("expected paymentTotalBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(workerBkt)
+		if err == nil {
+			return fmt.Errorf("expected workerBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(statsBkt)
+		if err == nil {
+			return fmt.Errorf("expected statsBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(statsRollupBkt)
+		if err == nil {
+			return fmt.Errorf("expected statsRollupBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(diagnosticsBkt)
+		if err == nil {
+			return fmt.Errorf("expected diagnosticsBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(minerStatsBkt)
+		if err == nil {
+			return fmt.Errorf("expected minerStatsBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(accountMergeBkt)
+		if err == nil {
+			return fmt.Errorf("expected accountMergeBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(submissionBkt)
+		if err == nil {
+			return fmt.Errorf("expected submissionBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(paymentPlanBkt)
+		if err == nil {
+			return fmt.Errorf("expected paymentPlanBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(connectionAuditBkt)
+		if err == nil {
+			return fmt.Errorf("expected connectionAuditBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(accountMetadataLogBkt)
+		if err == nil {
+			return fmt.Errorf("expected accountMetadataLogBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(lostBlockBkt)
+		if err == nil {
+			return fmt.Errorf("expected lostBlockBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(banBkt)
+		if err == nil {
+			return fmt.Errorf("expected banBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(banAuditBkt)
+		if err == nil {
+			return fmt.Errorf("expected banAuditBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(digestBkt)
+		if err == nil {
+			return fmt.Errorf("expected digestBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(accountPaymentBkt)
+		if err == nil {
+			return fmt.Errorf("expected accountPaymentBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(accountPaymentArchiveBkt)
+		if err == nil {
+			return fmt.Errorf("expected accountPaymentArchiveBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(accountShareBkt)
+		if err == nil {
+			return fmt.Errorf("expected accountShareBkt to exist already")
+		}
+		_, err = pbkt.CreateBucket(paymentFailureBkt)
+		if err == nil {
+			return fmt.Errorf("expected paymentFailureBkt to exist already")
+		}
 		return nil
 	})
 	if err != nil {
@@ -88,12 +170,38 @@ func testDatabase(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected no value found error")
 	}
 
+	// Mark a share boundary to ensure purging removes it.
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := markShareBoundary(tx, &ShareBoundary{
+			End: time.Now().UnixNano(),
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("[markShareBoundary] unexpected error: %v", err)
+	}
+
 	// purge the db.
 	err = purge(db)
 	if err != nil {
 		t.Fatalf("backup error: %v", err)
 	}
 
+	// Ensure the share boundary has been removed.
+	var boundary int64
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		boundary, err = fetchShareBoundary(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("[fetchShareBoundary] unexpected error: %v", err)
+	}
+	if boundary != 0 {
+		t.Fatalf("expected no share boundary after purging, got %d",
+			boundary)
+	}
+
 	// Ensure the account X and Y have been removed.
 	_, err = FetchAccount(db, []byte(xID))
 	if err == nil {
@@ -125,3 +233,146 @@ func testDatabase(t *testing.T, db *bolt.DB) {
 		t.Fatal(err)
 	}
 }
+
+func testReadOnlyDB(t *testing.T, db *bolt.DB) {
+	// Persist work and a payment of account X.
+	work := NewAcceptedWork("00000000000000001e2065a7248a9b4d3886fe3ca3128eebedddaf35fb26e58c",
+		"000000000000000022d95f9fc9ab9fed0b8fb2f2ab5dd0e4a24f5d6e0fda7c5d",
+		20, xID, CPU, 0)
+	work.Confirmed = true
+	err := work.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	err = NewPayment(xID, 100, 20, 36).Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+
+	// Snapshot the live database, read-only opens are blocked by the
+	// exclusive lock of the live database.
+	snapshot := "snapshot.db"
+	defer os.Remove(snapshot)
+	err = backup(db, snapshot)
+	if err != nil {
+		t.Fatalf("backup error: %v", err)
+	}
+	rdb, err := OpenDBReadOnly(snapshot)
+	if err != nil {
+		t.Fatalf("[OpenDBReadOnly] unexpected error: %v", err)
+	}
+
+	// Ensure account, payment and work queries are served.
+	account, err := FetchAccount(rdb, []byte(xID))
+	if err != nil {
+		t.Fatalf("[FetchAccount] unexpected error: %v", err)
+	}
+	if account.Address != xAddr {
+		t.Fatalf("expected account address %s, got %s", xAddr,
+			account.Address)
+	}
+	payments, err := fetchPaymentsForAccount(rdb, xID, 10)
+	if err != nil {
+		t.Fatalf("[fetchPaymentsForAccount] unexpected error: %v", err)
+	}
+	if len(payments) != 1 || payments[0].Amount != 100 {
+		t.Fatalf("expected a payment of 100 atoms, got %v", payments)
+	}
+	minedWork, err := ListMinedWork(rdb, 10)
+	if err != nil {
+		t.Fatalf("[ListMinedWork] unexpected error: %v", err)
+	}
+	if len(minedWork) != 1 || minedWork[0].Height != 20 {
+		t.Fatalf("expected mined work at height 20, got %v", minedWork)
+	}
+
+	// Ensure buckets cannot be created on a read-only database.
+	err = createBuckets(rdb)
+	if err == nil {
+		t.Fatal("expected a read-only database error")
+	}
+
+	// Ensure a reporting hub serves queries from the read-only database.
+	_, err = NewHub(func() {}, &HubConfig{
+		ActiveNet:     chaincfg.SimNetParams(),
+		DB:            db,
+		MaxGenTime:    20,
+		PaymentMethod: PPS,
+		Reporting:     true,
+	})
+	if !IsError(err, ErrNotSupported) {
+		t.Fatalf("expected a not supported error for a writable "+
+			"database, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	hub, err := NewHub(cancel, &HubConfig{
+		ActiveNet:     chaincfg.SimNetParams(),
+		DB:            rdb,
+		MaxGenTime:    20,
+		PaymentMethod: PPS,
+		Reporting:     true,
+	})
+	if err != nil {
+		t.Fatalf("[NewHub] unexpected error: %v", err)
+	}
+	if !hub.AccountExists(xID) {
+		t.Fatalf("expected account with id %s to exist", xID)
+	}
+	payments, err = hub.FetchPaymentsForAccount(xID)
+	if err != nil || len(payments) != 1 {
+		t.Fatalf("expected a payment for account %s, got %v (%v)", xID,
+			payments, err)
+	}
+	minedWork, err = hub.FetchMinedWork()
+	if err != nil || len(minedWork) != 1 {
+		t.Fatalf("expected mined work, got %v (%v)", minedWork, err)
+	}
+	_, err = hub.CSRFSecret()
+	if err != nil {
+		t.Fatalf("[CSRFSecret] unexpected error: %v", err)
+	}
+	err = hub.Listen()
+	if !IsError(err, ErrNotSupported) {
+		t.Fatalf("expected a not supported error, got %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	// Ensure databases not at the latest version are refused.
+	outdated := "outdated.db"
+	defer os.Remove(outdated)
+	err = backup(db, outdated)
+	if err != nil {
+		t.Fatalf("backup error: %v", err)
+	}
+	odb, err := openDB(outdated)
+	if err != nil {
+		t.Fatalf("[openDB] unexpected error: %v", err)
+	}
+	err = odb.Update(func(tx *bolt.Tx) error {
+		return setDBVersion(tx, DBVersion-1)
+	})
+	if err != nil {
+		t.Fatalf("[setDBVersion] unexpected error: %v", err)
+	}
+	odb.Close()
+	_, err = OpenDBReadOnly(outdated)
+	if !IsError(err, ErrDBUpgrade) {
+		t.Fatalf("expected a database upgrade error, got %v", err)
+	}
+
+	// Empty the work and payment buckets.
+	err = emptyBucket(db, workBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, paymentBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package pool
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 	"sync"
 
@@ -19,33 +20,150 @@ const (
 
 var (
 	// minerHashes is a map of all known DCR miners and their corresponding
-	// hashrates.
-	minerHashes = map[string]*big.Int{
-		CPU:           new(big.Int).SetInt64(5e3),
-		InnosiliconD9: new(big.Int).SetInt64(2.4e12),
-		AntminerDR3:   new(big.Int).SetInt64(7.8e12),
-		AntminerDR5:   new(big.Int).SetInt64(35e12),
-		WhatsminerD1:  new(big.Int).SetInt64(48e12),
-	}
+	// hashrates, populated from the registered miner profiles.
+	minerHashes = make(map[string]*big.Int)
+
+	// defaultMaxShareRate represents the default maximum number of shares
+	// per second a client is expected to submit, pool difficulties are not
+	// set below the difficulty floor it implies.
+	defaultMaxShareRate = 1.0
 )
 
+// ValidateMiner asserts the provided miner type is supported.
+func ValidateMiner(miner string) error {
+	if _, ok := minerHashes[miner]; !ok {
+		desc := fmt.Sprintf("unknown miner type %s", miner)
+		return MakeError(ErrOther, desc, nil)
+	}
+	return nil
+}
+
 // DifficultyInfo represents the difficulty related info for a mining client.
+// The floor is the minimum difficulty of the client's miner type, nil if
+// there is none.
 type DifficultyInfo struct {
 	target     *big.Rat
 	difficulty *big.Rat
 	powLimit   *big.Rat
+	multiplier *big.Rat
+	floor      *big.Rat
+}
+
+// copy returns a deep copy of the difficulty info.
+func (d *DifficultyInfo) copy() *DifficultyInfo {
+	info := &DifficultyInfo{
+		target:     new(big.Rat).Set(d.target),
+		difficulty: new(big.Rat).Set(d.difficulty),
+		powLimit:   new(big.Rat).Set(d.powLimit),
+		multiplier: new(big.Rat).Set(d.multiplier),
+	}
+	if d.floor != nil {
+		info.floor = new(big.Rat).Set(d.floor)
+	}
+	return info
+}
+
+// clamp raises the difficulty to the floor if it is below it, the target
+// and share weight multiplier are adjusted to the raised difficulty. It
+// returns true if the difficulty was raised.
+func (d *DifficultyInfo) clamp() bool {
+	if d.floor == nil || d.difficulty.Cmp(d.floor) >= 0 {
+		return false
+	}
+	d.multiplier.Mul(d.multiplier, new(big.Rat).Quo(d.floor, d.difficulty))
+	d.difficulty.Set(d.floor)
+	d.target.Quo(d.powLimit, d.floor)
+	return true
+}
+
+// validateNonceIterations asserts the provided number of header nonce
+// iterations is positive and finite, shares are weighted and difficulty
+// floors derived from it.
+func validateNonceIterations(iterations float64) error {
+	if iterations <= 0 || math.IsInf(iterations, 0) || math.IsNaN(iterations) {
+		desc := fmt.Sprintf("nonce iterations of %v are not positive",
+			iterations)
+		return MakeError(ErrCalcPoolTarget, desc, nil)
+	}
+	return nil
+}
+
+// validateDifficultyInfo asserts the provided difficulty info of the
+// provided miner is derived from the pow limit of the provided network and
+// its difficulty and target are within it. A pool target above the pow
+// limit can never be met by the network target, a pool target computed
+// from another pow limit has no relation to the network target at all.
+func validateDifficultyInfo(net *chaincfg.Params, miner string, d *DifficultyInfo) error {
+	powLimit := new(big.Rat).SetInt(net.PowLimit)
+	if d.powLimit.Cmp(powLimit) != 0 {
+		desc := fmt.Sprintf("%s pool pow limit %064x does not match the "+
+			"%s network pow limit %064x", miner, ratToInt(d.powLimit),
+			net.Name, net.PowLimit)
+		return MakeError(ErrCalcPoolTarget, desc, nil)
+	}
+	if d.difficulty.Sign() <= 0 {
+		desc := fmt.Sprintf("%s pool difficulty %s is not positive", miner,
+			d.difficulty.FloatString(4))
+		return MakeError(ErrCalcPoolTarget, desc, nil)
+	}
+	if d.target.Sign() <= 0 || d.target.Cmp(powLimit) > 0 {
+		desc := fmt.Sprintf("%s pool target %064x is not within the %s "+
+			"network pow limit %064x", miner, ratToInt(d.target), net.Name,
+			net.PowLimit)
+		return MakeError(ErrCalcPoolTarget, desc, nil)
+	}
+	return nil
+}
+
+// ratToInt returns the integer part of the provided rational.
+func ratToInt(r *big.Rat) *big.Int {
+	return new(big.Int).Quo(r.Num(), r.Denom())
+}
+
+// difficultyFloor returns the minimum difficulty of the provided hash rate
+// at which shares are expected no more often than the provided maximum
+// share rate, per second, on the provided network.
+func difficultyFloor(net *chaincfg.Params, hashRate *big.Int, maxShareRate float64) *big.Rat {
+	// The difficulty floor is calculated as:
+	//
+	//    floor = hashes_per_sec / (max_shares_per_sec * iterations)
+	floor := new(big.Rat).SetInt(hashRate)
+	return floor.Quo(floor, new(big.Rat).SetFloat64(maxShareRate*
+		powIterations(net)))
 }
 
 // DifficultySet represents generated pool difficulties for supported miners.
+// Difficulties are not set below the floor of their miner type, derived from
+// the miner's hash rate and the maximum share rate of a client.
 type DifficultySet struct {
-	diffs map[string]*DifficultyInfo
-	mtx   sync.Mutex
+	net          *chaincfg.Params
+	powLimit     *big.Rat
+	maxGenTime   *big.Int
+	maxShareRate float64
+	diffs        map[string]*DifficultyInfo
+	floors       map[string]*big.Rat
+	mtx          sync.Mutex
 }
 
-// NewDifficultySet generates difficulty data for all supported mining clients.
-func NewDifficultySet(net *chaincfg.Params, powLimit *big.Rat, maxGenTime *big.Int) (*DifficultySet, error) {
+// NewDifficultySet generates difficulty data for all supported mining
+// clients. The maximum share rate of a client, per second, defaults to
+// defaultMaxShareRate if it is not positive.
+func NewDifficultySet(net *chaincfg.Params, powLimit *big.Rat, maxGenTime *big.Int, maxShareRate float64) (*DifficultySet, error) {
+	if maxShareRate <= 0 || math.IsInf(maxShareRate, 0) ||
+		math.IsNaN(maxShareRate) {
+		maxShareRate = defaultMaxShareRate
+	}
+	err := validateNonceIterations(powIterations(net))
+	if err != nil {
+		return nil, err
+	}
 	set := &DifficultySet{
-		diffs: make(map[string]*DifficultyInfo),
+		net:          net,
+		powLimit:     powLimit,
+		maxGenTime:   maxGenTime,
+		maxShareRate: maxShareRate,
+		diffs:        make(map[string]*DifficultyInfo),
+		floors:       make(map[string]*big.Rat),
 	}
 	for miner, hashrate := range minerHashes {
 		target, difficulty, err := calculatePoolTarget(net, hashrate, maxGenTime)
@@ -53,16 +171,47 @@ func NewDifficultySet(net *chaincfg.Params, powLimit *big.Rat, maxGenTime *big.I
 			desc := fmt.Sprintf("failed to calculate pool target for %s", miner)
 			return nil, MakeError(ErrCalcPoolTarget, desc, err)
 		}
-		set.diffs[miner] = &DifficultyInfo{
+		floor := difficultyFloor(net, hashrate, maxShareRate)
+		diffInfo := &DifficultyInfo{
 			target:     target,
 			difficulty: difficulty,
 			powLimit:   powLimit,
+			multiplier: new(big.Rat).SetInt64(1),
+			floor:      floor,
+		}
+		if diffInfo.clamp() {
+			log.Warnf("%s pool difficulty raised to its floor of %s",
+				miner, floor.FloatString(4))
 		}
+
+		err = validateDifficultyInfo(net, miner, diffInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		// The multiplier of the base difficulty of a miner weights shares
+		// relative to itself.
+		diffInfo.multiplier.SetInt64(1)
+		set.diffs[miner] = diffInfo
+		set.floors[miner] = floor
 	}
 
 	return set, nil
 }
 
+// fetchDifficultyFloor returns the minimum difficulty of the provided
+// miner, if it exists.
+func (d *DifficultySet) fetchDifficultyFloor(miner string) (*big.Rat, error) {
+	d.mtx.Lock()
+	floor, ok := d.floors[miner]
+	d.mtx.Unlock()
+	if !ok {
+		desc := fmt.Sprintf("no difficulty data found for miner %s", miner)
+		return nil, MakeError(ErrValueNotFound, desc, nil)
+	}
+	return new(big.Rat).Set(floor), nil
+}
+
 // fetchMinerDifficulty returns the difficulty data of the provided miner,
 // if it exists.
 func (d *DifficultySet) fetchMinerDifficulty(miner string) (*DifficultyInfo, error) {
@@ -75,3 +224,53 @@ func (d *DifficultySet) fetchMinerDifficulty(miner string) (*DifficultyInfo, err
 	}
 	return diffData, nil
 }
+
+// fetchScaledMinerDifficulty returns the difficulty data of the provided
+// miner scaled by the provided multiplier. The pool target is calculated
+// for the miner's hashrate scaled by the multiplier.
+func (d *DifficultySet) fetchScaledMinerDifficulty(miner string, multiplier float64) (*DifficultyInfo, error) {
+	if multiplier == 1 {
+		return d.fetchMinerDifficulty(miner)
+	}
+	if multiplier <= 0 || math.IsInf(multiplier, 0) || math.IsNaN(multiplier) {
+		desc := fmt.Sprintf("invalid difficulty multiplier %v for miner %s",
+			multiplier, miner)
+		return nil, MakeError(ErrOther, desc, nil)
+	}
+	hashRate, ok := minerHashes[miner]
+	if !ok {
+		desc := fmt.Sprintf("no difficulty data found for miner %s", miner)
+		return nil, MakeError(ErrValueNotFound, desc, nil)
+	}
+	scaledHashRate, _ := new(big.Float).Mul(new(big.Float).SetInt(hashRate),
+		big.NewFloat(multiplier)).Int(nil)
+	target, difficulty, err := calculatePoolTarget(d.net, scaledHashRate,
+		d.maxGenTime)
+	if err != nil {
+		desc := fmt.Sprintf("failed to calculate pool target for %s", miner)
+		return nil, MakeError(ErrCalcPoolTarget, desc, err)
+	}
+
+	// The multiplier weighting shares is derived from the resulting
+	// difficulty since difficulties are clamped to a minimum.
+	base, err := d.fetchMinerDifficulty(miner)
+	if err != nil {
+		return nil, err
+	}
+	diffInfo := &DifficultyInfo{
+		target:     target,
+		difficulty: difficulty,
+		powLimit:   d.powLimit,
+		multiplier: new(big.Rat).Quo(difficulty, base.difficulty),
+		floor:      new(big.Rat).Set(base.floor),
+	}
+	if diffInfo.clamp() {
+		log.Warnf("%s pool difficulty scaled by %v raised to its floor "+
+			"of %s", miner, multiplier, base.floor.FloatString(4))
+	}
+	err = validateDifficultyInfo(d.net, miner, diffInfo)
+	if err != nil {
+		return nil, err
+	}
+	return diffInfo, nil
+}
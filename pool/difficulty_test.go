@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"math"
 	"math/big"
 	"testing"
 
@@ -29,7 +30,7 @@ func testDifficulty(t *testing.T) {
 	for idx, tc := range set {
 		net := chaincfg.SimNetParams()
 		powLimit := new(big.Rat).SetInt(net.PowLimit)
-		set, err := NewDifficultySet(net, powLimit, soloMaxGenTime)
+		set, err := NewDifficultySet(net, powLimit, soloMaxGenTime, 0)
 		if err != nil {
 			t.Fatalf("[NewDifficultySet] #%d, unexpected error %v", idx+1, err)
 		}
@@ -47,4 +48,142 @@ func testDifficulty(t *testing.T) {
 			}
 		}
 	}
+
+	// Ensure scaled difficulties scale the pool target and the share
+	// weight multiplier.
+	net := chaincfg.SimNetParams()
+	powLimit := new(big.Rat).SetInt(net.PowLimit)
+	diffSet, err := NewDifficultySet(net, powLimit, soloMaxGenTime, 0)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error %v", err)
+	}
+	base, err := diffSet.fetchMinerDifficulty(WhatsminerD1)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	scaled, err := diffSet.fetchScaledMinerDifficulty(WhatsminerD1, 4)
+	if err != nil {
+		t.Fatalf("[fetchScaledMinerDifficulty] unexpected error: %v", err)
+	}
+	four := new(big.Rat).SetInt64(4)
+	if scaled.multiplier.Cmp(four) != 0 {
+		t.Fatalf("expected a multiplier of 4, got %v", scaled.multiplier)
+	}
+	if new(big.Rat).Mul(base.difficulty, four).Cmp(scaled.difficulty) != 0 {
+		t.Fatalf("expected a difficulty of 4 x %v, got %v", base.difficulty,
+			scaled.difficulty)
+	}
+	if scaled.target.Cmp(base.target) >= 0 {
+		t.Fatalf("expected a scaled target below %v, got %v", base.target,
+			scaled.target)
+	}
+	for _, invalid := range []float64{0, -1} {
+		_, err = diffSet.fetchScaledMinerDifficulty(WhatsminerD1, invalid)
+		if err == nil {
+			t.Fatalf("[fetchScaledMinerDifficulty] expected an invalid "+
+				"multiplier error for %v", invalid)
+		}
+	}
+
+	// Ensure the difficulty floor of a miner type limits its share rate to
+	// the maximum share rate. With 2 iterations per difficulty on simnet a
+	// 5000H/s CPU miner limited to 2 shares per second has a floor of 1250.
+	maxGenTime := new(big.Int).SetInt64(1)
+	diffSet, err = NewDifficultySet(net, powLimit, maxGenTime, 2)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error %v", err)
+	}
+	floor, err := diffSet.fetchDifficultyFloor(CPU)
+	if err != nil {
+		t.Fatalf("[fetchDifficultyFloor] unexpected error: %v", err)
+	}
+	if floor.Cmp(new(big.Rat).SetInt64(1250)) != 0 {
+		t.Fatalf("expected a difficulty floor of 1250, got %v", floor)
+	}
+	base, err = diffSet.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	if base.difficulty.Cmp(new(big.Rat).SetInt64(2500)) != 0 {
+		t.Fatalf("expected a base difficulty of 2500, got %v",
+			base.difficulty)
+	}
+
+	// Ensure scaled difficulties below the floor are raised to it, with
+	// the target and multiplier of the floor.
+	scaled, err = diffSet.fetchScaledMinerDifficulty(CPU, 0.25)
+	if err != nil {
+		t.Fatalf("[fetchScaledMinerDifficulty] unexpected error: %v", err)
+	}
+	if scaled.difficulty.Cmp(floor) != 0 {
+		t.Fatalf("expected a scaled difficulty of %v, got %v", floor,
+			scaled.difficulty)
+	}
+	if scaled.multiplier.Cmp(big.NewRat(1, 2)) != 0 {
+		t.Fatalf("expected a multiplier of 1/2, got %v", scaled.multiplier)
+	}
+	if scaled.target.Cmp(new(big.Rat).Quo(powLimit, floor)) != 0 {
+		t.Fatalf("expected the target of the difficulty floor, got %v",
+			scaled.target)
+	}
+
+	// Ensure base difficulties below the floor are raised to it.
+	diffSet, err = NewDifficultySet(net, powLimit, maxGenTime, 0.125)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error %v", err)
+	}
+	base, err = diffSet.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	if base.difficulty.Cmp(new(big.Rat).SetInt64(20000)) != 0 ||
+		base.multiplier.Cmp(new(big.Rat).SetInt64(1)) != 0 {
+		t.Fatalf("expected a base difficulty of 20000 with a multiplier "+
+			"of 1, got %v with %v", base.difficulty, base.multiplier)
+	}
+
+	// Ensure difficulties derived from a pow limit other than the
+	// network's are refused.
+	misconfigured := new(big.Rat).Mul(powLimit, new(big.Rat).SetInt64(2))
+	_, err = NewDifficultySet(net, misconfigured, maxGenTime, 0)
+	if !IsError(err, ErrCalcPoolTarget) {
+		t.Fatalf("expected a pow limit mismatch error, got %v", err)
+	}
+
+	// Ensure difficulty info with a non-positive difficulty or a target
+	// outside the pow limit is refused.
+	valid, err := diffSet.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	err = validateDifficultyInfo(net, CPU, valid)
+	if err != nil {
+		t.Fatalf("[validateDifficultyInfo] unexpected error: %v", err)
+	}
+	zeroDiff := valid.copy()
+	zeroDiff.difficulty.SetInt64(0)
+	aboveLimit := valid.copy()
+	aboveLimit.target.Add(powLimit, new(big.Rat).SetInt64(1))
+	zeroTarget := valid.copy()
+	zeroTarget.target.SetInt64(0)
+	for _, info := range []*DifficultyInfo{zeroDiff, aboveLimit, zeroTarget} {
+		err = validateDifficultyInfo(net, CPU, info)
+		if !IsError(err, ErrCalcPoolTarget) {
+			t.Fatalf("expected an invalid difficulty info error, got %v",
+				err)
+		}
+	}
+
+	// Ensure only positive nonce iterations are valid.
+	err = validateNonceIterations(powIterations(net))
+	if err != nil {
+		t.Fatalf("[validateNonceIterations] unexpected error: %v", err)
+	}
+	for _, iterations := range []float64{0, -2, math.Inf(1), math.NaN()} {
+		err = validateNonceIterations(iterations)
+		if !IsError(err, ErrCalcPoolTarget) {
+			t.Fatalf("expected a nonce iterations error for %v, got %v",
+				iterations, err)
+		}
+	}
 }
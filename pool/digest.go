@@ -0,0 +1,432 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+const (
+	// MinDigestInterval represents the shortest period covered by the
+	// activity digests of an account.
+	MinDigestInterval = time.Hour
+
+	// MaxDigestInterval represents the longest period covered by the
+	// activity digests of an account.
+	MaxDigestInterval = time.Hour * 24 * 30
+)
+
+var (
+	// digestCheckInterval represents the interval the activity of accounts
+	// opted into digests is sampled at and due digests are generated.
+	digestCheckInterval = time.Minute * 5
+
+	// digestEventQueueSize represents the number of share events queued
+	// for the digest generator, events are dropped once the queue is full.
+	digestEventQueueSize = 1024
+)
+
+// AccountActivity represents the activity of an account opted into
+// activity digests, accrued since its last digest. The interval and start
+// of the period are in nanoseconds. The average hash rate of the period is
+// taken over the hash rate samples of the account.
+type AccountActivity struct {
+	Account         string         `json:"account"`
+	Interval        int64          `json:"interval"`
+	Since           int64          `json:"since"`
+	Shares          uint64         `json:"shares"`
+	HashRateSum     *big.Rat       `json:"hashratesum"`
+	HashRateSamples int64          `json:"hashratesamples"`
+	Earned          dcrutil.Amount `json:"earned"`
+	Paid            dcrutil.Amount `json:"paid"`
+	Payments        []string       `json:"payments"`
+	OfflineWorkers  []string       `json:"offlineworkers"`
+}
+
+// newAccountActivity creates the activity of the provided account for a
+// digest period of the provided interval starting at the provided time.
+func newAccountActivity(account string, interval time.Duration, since int64) *AccountActivity {
+	return &AccountActivity{
+		Account:        account,
+		Interval:       int64(interval),
+		Since:          since,
+		HashRateSum:    new(big.Rat),
+		Payments:       make([]string, 0),
+		OfflineWorkers: make([]string, 0),
+	}
+}
+
+// active returns if the account had any activity within the period.
+func (a *AccountActivity) active() bool {
+	return a.Shares > 0 || a.Earned > 0 || a.Paid > 0 ||
+		len(a.OfflineWorkers) > 0
+}
+
+// due returns if the digest of the period is due by the provided time.
+func (a *AccountActivity) due(now int64) bool {
+	return now >= a.Since+a.Interval
+}
+
+// ActivityDigest represents the summary of an account's activity over a
+// digest period delivered to webhooks. The period bounds are unix
+// timestamps, the average hash rate is in hashes per second, amounts are
+// in atoms and payments are the transaction ids of payouts to the account.
+type ActivityDigest struct {
+	Account         string         `json:"account"`
+	PeriodStart     int64          `json:"periodstart"`
+	PeriodEnd       int64          `json:"periodend"`
+	AverageHashRate float64        `json:"averagehashrate"`
+	Shares          uint64         `json:"shares"`
+	Earned          dcrutil.Amount `json:"earned"`
+	Paid            dcrutil.Amount `json:"paid"`
+	Payments        []string       `json:"payments"`
+	OfflineWorkers  []string       `json:"offlineworkers"`
+}
+
+// digest returns the digest of the period ending at the provided time.
+func (a *AccountActivity) digest(now int64) *ActivityDigest {
+	var hashRate float64
+	if a.HashRateSamples > 0 {
+		avg := new(big.Rat).Quo(a.HashRateSum,
+			new(big.Rat).SetInt64(a.HashRateSamples))
+		hashRate, _ = avg.Float64()
+	}
+	return &ActivityDigest{
+		Account:         a.Account,
+		PeriodStart:     time.Unix(0, a.Since).Unix(),
+		PeriodEnd:       time.Unix(0, now).Unix(),
+		AverageHashRate: hashRate,
+		Shares:          a.Shares,
+		Earned:          a.Earned,
+		Paid:            a.Paid,
+		Payments:        a.Payments,
+		OfflineWorkers:  a.OfflineWorkers,
+	}
+}
+
+// appendUnique appends the provided value to the list if it is not already
+// listed.
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// fetchDigestBucket is a helper function for getting the digest bucket.
+func fetchDigestBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(digestBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(digestBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// fetchAccountActivity returns the accrued activity of the provided
+// account, nil if the account is not opted into digests.
+func fetchAccountActivity(bkt *bolt.Bucket, account string) (*AccountActivity, error) {
+	v := bkt.Get([]byte(account))
+	if v == nil {
+		return nil, nil
+	}
+	var activity AccountActivity
+	err := json.Unmarshal(v, &activity)
+	if err != nil {
+		return nil, err
+	}
+	if activity.HashRateSum == nil {
+		activity.HashRateSum = new(big.Rat)
+	}
+	return &activity, nil
+}
+
+// putAccountActivity persists the provided account activity.
+func putAccountActivity(bkt *bolt.Bucket, activity *AccountActivity) error {
+	b, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	return bkt.Put([]byte(activity.Account), b)
+}
+
+// setDigestInterval opts the provided account into digests of the provided
+// interval, a zero interval opts the account out. The activity accrued in
+// the current period is kept when the interval of an opted in account is
+// changed.
+func setDigestInterval(db *bolt.DB, account string, interval time.Duration, now int64) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchDigestBucket(tx)
+		if err != nil {
+			return err
+		}
+		if interval == 0 {
+			return bkt.Delete([]byte(account))
+		}
+		activity, err := fetchAccountActivity(bkt, account)
+		if err != nil {
+			return err
+		}
+		if activity == nil {
+			activity = newAccountActivity(account, interval, now)
+		}
+		activity.Interval = int64(interval)
+		return putAccountActivity(bkt, activity)
+	})
+}
+
+// accrueDigestPayments adds the provided payments to the accrued activity
+// of their accounts opted into digests, as paid payouts if paid is set or
+// as earnings otherwise. Donations are not accrued.
+func accrueDigestPayments(tx *bolt.Tx, payments []*Payment, paid bool) error {
+	bkt, err := fetchDigestBucket(tx)
+	if err != nil {
+		return err
+	}
+	activities := make(map[string]*AccountActivity)
+	for _, pmt := range payments {
+		if pmt.Donation {
+			continue
+		}
+		activity, ok := activities[pmt.Account]
+		if !ok {
+			activity, err = fetchAccountActivity(bkt, pmt.Account)
+			if err != nil {
+				return err
+			}
+			activities[pmt.Account] = activity
+		}
+		if activity == nil {
+			continue
+		}
+		if !paid {
+			activity.Earned += pmt.Amount
+			continue
+		}
+		activity.Paid += pmt.Amount
+		activity.Payments = appendUnique(activity.Payments, pmt.TransactionID)
+	}
+	for _, activity := range activities {
+		if activity == nil {
+			continue
+		}
+		err := putAccountActivity(bkt, activity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DigestGeneratorConfig represents configuration details for the activity
+// digest generator.
+type DigestGeneratorConfig struct {
+	// DB represents the pool database.
+	DB *bolt.DB
+	// FetchAccountHashRates returns the hash rates of accounts with
+	// connected clients, keyed by account id.
+	FetchAccountHashRates func() map[string]*big.Rat
+	// NotifyDigest publishes the provided activity digest.
+	NotifyDigest func(*ActivityDigest)
+	// Events represents the hub's event bus shares are tracked through.
+	Events *EventBus
+	// HubWg represents the hub's waitgroup.
+	HubWg *sync.WaitGroup
+}
+
+// digestAccrual represents the activity of an account opted into digests
+// not yet added to its persisted activity.
+type digestAccrual struct {
+	shares         uint64
+	offlineWorkers []string
+}
+
+// DigestGenerator accrues the activity of accounts opted into activity
+// digests and publishes their digests on schedule. Only the activity of
+// opted in accounts is tracked, share and worker activity accrues in
+// memory and is periodically added to the persisted activity while
+// payments accrue as they are created and paid.
+type DigestGenerator struct {
+	cfg        *DigestGeneratorConfig
+	events     *Subscription
+	accruals   map[string]*digestAccrual
+	accrualMtx sync.Mutex
+}
+
+// NewDigestGenerator creates an activity digest generator, loading the
+// accounts opted into digests.
+func NewDigestGenerator(dCfg *DigestGeneratorConfig) (*DigestGenerator, error) {
+	dg := &DigestGenerator{
+		cfg:      dCfg,
+		accruals: make(map[string]*digestAccrual),
+	}
+	err := dCfg.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchDigestBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			dg.accruals[string(k)] = &digestAccrual{}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	dg.events = dCfg.Events.Subscribe(digestEventQueueSize,
+		EventShareAccepted)
+	return dg, nil
+}
+
+// setInterval opts the provided account into digests of the provided
+// interval, a zero interval opts the account out.
+func (dg *DigestGenerator) setInterval(account string, interval time.Duration) error {
+	dg.accrualMtx.Lock()
+	defer dg.accrualMtx.Unlock()
+	err := setDigestInterval(dg.cfg.DB, account, interval,
+		time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	if interval == 0 {
+		delete(dg.accruals, account)
+		return nil
+	}
+	if _, ok := dg.accruals[account]; !ok {
+		dg.accruals[account] = &digestAccrual{}
+	}
+	return nil
+}
+
+// handleEvent accrues the share of the provided share event.
+func (dg *DigestGenerator) handleEvent(event *HubEvent) {
+	dg.accrualMtx.Lock()
+	if accrual, ok := dg.accruals[event.Account]; ok {
+		accrual.shares++
+	}
+	dg.accrualMtx.Unlock()
+}
+
+// recordWorkerStatus accrues the provided worker if it went offline.
+func (dg *DigestGenerator) recordWorkerStatus(worker *WorkerState) {
+	if !worker.Offline {
+		return
+	}
+	dg.accrualMtx.Lock()
+	if accrual, ok := dg.accruals[worker.Account]; ok {
+		accrual.offlineWorkers = appendUnique(accrual.offlineWorkers,
+			worker.Name)
+	}
+	dg.accrualMtx.Unlock()
+}
+
+// settle adds the accrued activity of accounts opted into digests to their
+// persisted activity. When generate is set the hash rates of the accounts
+// are sampled and the digests of periods due by the provided time are
+// returned, periods without activity are skipped. The activity of
+// accounts with a returned digest is reset for the next period.
+func (dg *DigestGenerator) settle(now time.Time, generate bool) ([]*ActivityDigest, error) {
+	var hashRates map[string]*big.Rat
+	if generate && dg.cfg.FetchAccountHashRates != nil {
+		hashRates = dg.cfg.FetchAccountHashRates()
+	}
+	nowNano := now.UnixNano()
+	digests := make([]*ActivityDigest, 0)
+	dg.accrualMtx.Lock()
+	defer dg.accrualMtx.Unlock()
+	err := dg.cfg.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchDigestBucket(tx)
+		if err != nil {
+			return err
+		}
+		for account, accrual := range dg.accruals {
+			activity, err := fetchAccountActivity(bkt, account)
+			if err != nil {
+				return err
+			}
+			if activity == nil {
+				continue
+			}
+			activity.Shares += accrual.shares
+			for _, worker := range accrual.offlineWorkers {
+				activity.OfflineWorkers = appendUnique(
+					activity.OfflineWorkers, worker)
+			}
+			if generate {
+				if hashRate, ok := hashRates[account]; ok {
+					activity.HashRateSum.Add(activity.HashRateSum, hashRate)
+				}
+				activity.HashRateSamples++
+				if activity.due(nowNano) {
+					if activity.active() {
+						digests = append(digests, activity.digest(nowNano))
+					}
+					activity = newAccountActivity(account,
+						time.Duration(activity.Interval), nowNano)
+				}
+			}
+			err = putAccountActivity(bkt, activity)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for account := range dg.accruals {
+		dg.accruals[account] = &digestAccrual{}
+	}
+	return digests, nil
+}
+
+// run accrues the shares published on the hub's event bus and periodically
+// publishes the due digests of accounts opted into digests. It must be run
+// as a goroutine.
+func (dg *DigestGenerator) run(ctx context.Context) {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			dg.cfg.Events.Unsubscribe(dg.events)
+			_, err := dg.settle(time.Now(), false)
+			if err != nil {
+				log.Errorf("unable to persist digest activity: %v", err)
+			}
+			dg.cfg.HubWg.Done()
+			return
+
+		case event := <-dg.events.Events():
+			dg.handleEvent(event)
+
+		case now := <-ticker.C:
+			digests, err := dg.settle(now, true)
+			if err != nil {
+				log.Errorf("unable to generate activity digests: %v", err)
+				continue
+			}
+			for _, digest := range digests {
+				dg.cfg.NotifyDigest(digest)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package pool
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+func testDigestGenerator(t *testing.T, db *bolt.DB) {
+	hashRates := map[string]*big.Rat{
+		xID: new(big.Rat).SetInt64(100),
+		yID: new(big.Rat).SetInt64(300),
+	}
+	dg, err := NewDigestGenerator(&DigestGeneratorConfig{
+		DB: db,
+		FetchAccountHashRates: func() map[string]*big.Rat {
+			return hashRates
+		},
+		NotifyDigest: func(*ActivityDigest) {},
+		Events:       NewEventBus(),
+		HubWg:        new(sync.WaitGroup),
+	})
+	if err != nil {
+		t.Fatalf("[NewDigestGenerator] unexpected error: %v", err)
+	}
+
+	// Ensure only the activity of accounts opted into digests accrues.
+	err = dg.setInterval(xID, time.Hour)
+	if err != nil {
+		t.Fatalf("[setInterval] unexpected error: %v", err)
+	}
+	for _, account := range []string{xID, xID, yID, xID} {
+		dg.handleEvent(&HubEvent{Kind: EventShareAccepted, Account: account})
+	}
+	dg.recordWorkerStatus(&WorkerState{Account: xID, Name: "rig1",
+		Offline: true})
+	dg.recordWorkerStatus(&WorkerState{Account: xID, Name: "rig2"})
+	dg.recordWorkerStatus(&WorkerState{Account: yID, Name: "rig1",
+		Offline: true})
+	earned := []*Payment{
+		{Account: xID, Amount: dcrutil.Amount(150000000)},
+		{Account: xID, Amount: dcrutil.Amount(5000000), Donation: true},
+		{Account: yID, Amount: dcrutil.Amount(80000000)},
+	}
+	paid := []*Payment{
+		{Account: xID, Amount: dcrutil.Amount(60000000),
+			TransactionID: "0aa1"},
+		{Account: xID, Amount: dcrutil.Amount(40000000),
+			TransactionID: "0aa1"},
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		err := accrueDigestPayments(tx, earned, false)
+		if err != nil {
+			return err
+		}
+		return accrueDigestPayments(tx, paid, true)
+	})
+	if err != nil {
+		t.Fatalf("[accrueDigestPayments] unexpected error: %v", err)
+	}
+
+	// Ensure digests are not generated before their period ends.
+	var since int64
+	err = db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchDigestBucket(tx)
+		if err != nil {
+			return err
+		}
+		activity, err := fetchAccountActivity(bkt, xID)
+		if err != nil {
+			return err
+		}
+		since = activity.Since
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	digests, err := dg.settle(time.Unix(0, since).Add(time.Minute*30), true)
+	if err != nil {
+		t.Fatalf("[settle] unexpected error: %v", err)
+	}
+	if len(digests) != 0 {
+		t.Fatalf("[settle] expected no digests, got %d", len(digests))
+	}
+
+	// Ensure the digest summarizes the activity of the period.
+	end := time.Unix(0, since).Add(time.Hour)
+	hashRates[xID] = new(big.Rat).SetInt64(200)
+	digests, err = dg.settle(end, true)
+	if err != nil {
+		t.Fatalf("[settle] unexpected error: %v", err)
+	}
+	if len(digests) != 1 {
+		t.Fatalf("[settle] expected 1 digest, got %d", len(digests))
+	}
+	digest := digests[0]
+	if digest.Account != xID || digest.Shares != 3 ||
+		digest.AverageHashRate != 150 ||
+		digest.Earned != dcrutil.Amount(150000000) ||
+		digest.Paid != dcrutil.Amount(100000000) ||
+		len(digest.Payments) != 1 || digest.Payments[0] != "0aa1" ||
+		len(digest.OfflineWorkers) != 1 ||
+		digest.OfflineWorkers[0] != "rig1" ||
+		digest.PeriodStart != time.Unix(0, since).Unix() ||
+		digest.PeriodEnd != end.Unix() {
+		t.Fatalf("[settle] unexpected digest %+v", digest)
+	}
+
+	// Ensure the digest schema receivers rely on is stable.
+	digest.PeriodStart, digest.PeriodEnd = 1570000000, 1570086400
+	b, err := json.Marshal(&Event{Type: AccountDigest, Timestamp: 1570086400,
+		Data: digest})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	schema := `{"type":"accountdigest","timestamp":1570086400,"data":{` +
+		`"account":"` + xID + `","periodstart":1570000000,` +
+		`"periodend":1570086400,"averagehashrate":150,"shares":3,` +
+		`"earned":150000000,"paid":100000000,"payments":["0aa1"],` +
+		`"offlineworkers":["rig1"]}}`
+	if string(b) != schema {
+		t.Fatalf("expected digest event %s, got %s", schema, b)
+	}
+
+	// Ensure periods without activity are skipped.
+	delete(hashRates, xID)
+	digests, err = dg.settle(end.Add(time.Hour), true)
+	if err != nil {
+		t.Fatalf("[settle] unexpected error: %v", err)
+	}
+	if len(digests) != 0 {
+		t.Fatalf("[settle] expected idle period to be skipped, got %d "+
+			"digests", len(digests))
+	}
+
+	// Ensure accrued activity persists across restarts and opted out
+	// accounts are no longer tracked.
+	dg.handleEvent(&HubEvent{Kind: EventShareAccepted, Account: xID})
+	_, err = dg.settle(end.Add(time.Hour), false)
+	if err != nil {
+		t.Fatalf("[settle] unexpected error: %v", err)
+	}
+	restarted, err := NewDigestGenerator(&DigestGeneratorConfig{
+		DB:           db,
+		NotifyDigest: func(*ActivityDigest) {},
+		Events:       NewEventBus(),
+		HubWg:        new(sync.WaitGroup),
+	})
+	if err != nil {
+		t.Fatalf("[NewDigestGenerator] unexpected error: %v", err)
+	}
+	digests, err = restarted.settle(end.Add(time.Hour*2), true)
+	if err != nil {
+		t.Fatalf("[settle] unexpected error: %v", err)
+	}
+	if len(digests) != 1 || digests[0].Shares != 1 {
+		t.Fatalf("[settle] expected a digest of 1 share, got %+v", digests)
+	}
+	err = restarted.setInterval(xID, 0)
+	if err != nil {
+		t.Fatalf("[setInterval] unexpected error: %v", err)
+	}
+	if len(restarted.accruals) != 0 {
+		t.Fatal("[setInterval] expected the opted out account to be " +
+			"untracked")
+	}
+
+	err = emptyBucket(db, digestBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
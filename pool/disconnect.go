@@ -0,0 +1,110 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// DisconnectReason identifies the cause of a client's teardown.
+type DisconnectReason uint32
+
+// The causes of client teardowns.
+const (
+	// DisconnectUnknown indicates a teardown of an unclassified cause.
+	DisconnectUnknown DisconnectReason = iota
+
+	// DisconnectReadTimeout indicates the client sent nothing within the
+	// read deadline.
+	DisconnectReadTimeout
+
+	// DisconnectReadError indicates reading from the client's connection
+	// failed, for example because the connection was reset.
+	DisconnectReadError
+
+	// DisconnectEOF indicates the client closed its connection.
+	DisconnectEOF
+
+	// DisconnectProtocolError indicates the client sent a malformed,
+	// oversized or unexpected message.
+	DisconnectProtocolError
+
+	// DisconnectRateLimited indicates the client repeatedly exceeded its
+	// in-flight message budget.
+	DisconnectRateLimited
+
+	// DisconnectShutdown indicates the pool or the client's endpoint shut
+	// down.
+	DisconnectShutdown
+
+	// DisconnectWriteFailure indicates writing a message to the client
+	// failed.
+	DisconnectWriteFailure
+
+	// DisconnectUnknownMethod indicates the client sent a request of an
+	// unknown method.
+	DisconnectUnknownMethod
+
+	// DisconnectByPool indicates the client was disconnected by the pool,
+	// for example because its account was locked or its host banned.
+	DisconnectByPool
+
+	// numDisconnectReasons is the number of client teardown causes.
+	numDisconnectReasons
+)
+
+// String returns the name of the disconnect reason.
+func (r DisconnectReason) String() string {
+	switch r {
+	case DisconnectUnknown:
+		return "unknown"
+	case DisconnectReadTimeout:
+		return "readtimeout"
+	case DisconnectReadError:
+		return "readerror"
+	case DisconnectEOF:
+		return "eof"
+	case DisconnectProtocolError:
+		return "protocolerror"
+	case DisconnectRateLimited:
+		return "ratelimited"
+	case DisconnectShutdown:
+		return "shutdown"
+	case DisconnectWriteFailure:
+		return "writefailure"
+	case DisconnectUnknownMethod:
+		return "unknownmethod"
+	case DisconnectByPool:
+		return "bypool"
+	default:
+		return fmt.Sprintf("DisconnectReason(%d)", uint32(r))
+	}
+}
+
+// readLimitError indicates a message read from a client exceeded the
+// provided read limit in bytes.
+type readLimitError int
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e readLimitError) Error() string {
+	return fmt.Sprintf("message exceeds the read limit of %d bytes", int(e))
+}
+
+// readDisconnectReason returns the teardown cause of a client whose
+// message read failed with the provided error.
+func readDisconnectReason(err error) DisconnectReason {
+	if err == io.EOF {
+		return DisconnectEOF
+	}
+	if _, ok := err.(readLimitError); ok {
+		return DisconnectProtocolError
+	}
+	if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+		return DisconnectReadTimeout
+	}
+	return DisconnectReadError
+}
@@ -0,0 +1,130 @@
+package pool
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/Eacred/eacrd/chaincfg"
+)
+
+// timeoutError is a network error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func testDisconnectReasons(t *testing.T) {
+	// Ensure failed message reads are classified.
+	reads := []struct {
+		err    error
+		reason DisconnectReason
+	}{
+		{io.EOF, DisconnectEOF},
+		{readLimitError(1024), DisconnectProtocolError},
+		{timeoutError{}, DisconnectReadTimeout},
+		{&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}},
+			DisconnectReadTimeout},
+		{io.ErrClosedPipe, DisconnectReadError},
+		{fmt.Errorf("connection reset by peer"), DisconnectReadError},
+	}
+	for _, read := range reads {
+		reason := readDisconnectReason(read.err)
+		if reason != read.reason {
+			t.Fatalf("%v: expected disconnect reason %s, got %s", read.err,
+				read.reason, reason)
+		}
+	}
+
+	powLimit := chaincfg.SimNetParams().PowLimit
+	registry := newClientRegistry()
+	newConfig := func() *ClientConfig {
+		return &ClientConfig{
+			ActiveNet:   chaincfg.SimNetParams(),
+			Blake256Pad: generateBlake256Pad(),
+			DifficultyInfo: &DifficultyInfo{
+				target:     new(big.Rat).SetInt(powLimit),
+				difficulty: new(big.Rat).SetInt64(1),
+				powLimit:   new(big.Rat).SetInt(powLimit),
+				multiplier: new(big.Rat).SetInt64(1),
+			},
+			FetchMiner: func() string {
+				return CPU
+			},
+			FetchMinerPolicy: func() string {
+				return PolicyAllow
+			},
+			RegisterClient:   registry.register,
+			DeregisterClient: registry.deregister,
+			RemoveClient:     func(*Client) {},
+			FetchCurrentWork: func() *CurrentWork {
+				return nil
+			},
+			WithinLimit: func(string, int, float64) bool {
+				return true
+			},
+			HashCalcThreshold: 1,
+			IsTraced: func(string, string) bool {
+				return false
+			},
+			Events:   NewEventBus(),
+			Sessions: NewSessionStore(),
+		}
+	}
+
+	// Ensure the cause of a client's teardown is recorded, the first cause
+	// recorded is kept.
+	tests := []struct {
+		name     string
+		teardown func(*Client, *testMiner)
+		reason   DisconnectReason
+	}{{
+		name: "closed connection",
+		teardown: func(c *Client, m *testMiner) {
+			m.conn.Close()
+		},
+		reason: DisconnectEOF,
+	}, {
+		name: "malformed message",
+		teardown: func(c *Client, m *testMiner) {
+			m.sendRaw([]byte("{\"id\": 1, \"method\": [}\n"))
+		},
+		reason: DisconnectProtocolError,
+	}, {
+		name: "unknown method",
+		teardown: func(c *Client, m *testMiner) {
+			id := m.nextID()
+			m.send(&Request{ID: &id, Method: "mining.unknown"})
+		},
+		reason: DisconnectUnknownMethod,
+	}, {
+		name: "disconnected by the pool",
+		teardown: func(c *Client, m *testMiner) {
+			c.disconnect("")
+		},
+		reason: DisconnectByPool,
+	}, {
+		name: "shutdown",
+		teardown: func(c *Client, m *testMiner) {
+			registry.close()
+			c.cancelWithReason(DisconnectWriteFailure)
+		},
+		reason: DisconnectShutdown,
+	}}
+	for _, test := range tests {
+		client, m := pipeMiner(t, newConfig(), CPU)
+		m.subscribe()
+		test.teardown(client, m)
+		m.awaitDisconnect()
+		if !registry.wait(testMinerTimeout) {
+			t.Fatalf("%s: expected the client to shut down", test.name)
+		}
+		if client.disconnectReason() != test.reason {
+			t.Fatalf("%s: expected disconnect reason %s, got %s", test.name,
+				test.reason, client.disconnectReason())
+		}
+	}
+}
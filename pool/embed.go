@@ -0,0 +1,183 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// Config represents the configuration of a pool.
+type Config struct {
+	// Hub represents the hub configuration of the pool. The consensus
+	// daemon and the wallet are dialed unless Hub.ChainClient and
+	// Hub.Wallet are provided.
+	Hub *HubConfig
+	// DBFile represents the path of the pool database, it is opened when
+	// Hub.DB is not provided.
+	DBFile string
+	// RepairDB represents if inconsistent records found by the database
+	// integrity check on startup are quarantined.
+	RepairDB bool
+}
+
+// Pool represents a mining pool embeddable in other processes. The pool
+// owns its database, it is closed when the pool shuts down.
+type Pool struct {
+	hub     *Hub
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	started bool
+	mtx     sync.Mutex
+}
+
+// openPoolDB opens the pool database at the provided path and ensures it is
+// consistent. Databases of reporting pools are opened read-only and not
+// checked.
+func openPoolDB(cfg *Config) (*bolt.DB, error) {
+	if cfg.Hub.Reporting {
+		return OpenDBReadOnly(cfg.DBFile)
+	}
+	db, err := InitDB(cfg.DBFile, cfg.Hub.SoloPool)
+	if err != nil {
+		return nil, err
+	}
+	report, err := VerifyDB(db, cfg.RepairDB)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	log.Infof("Database integrity check: %d records checked, %d "+
+		"inconsistent, %d quarantined", report.Checked,
+		report.Inconsistencies, report.Quarantined)
+	if report.Inconsistencies > report.Quarantined {
+		db.Close()
+		desc := fmt.Sprintf("database integrity check found %d "+
+			"inconsistent records, restart with --repairdb to "+
+			"quarantine them", report.Inconsistencies)
+		return nil, MakeError(ErrOther, desc, nil)
+	}
+	err = verifyAccountIDs(db, accountIDSampleSize)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// New creates a pool with the provided configuration. Pools not in
+// reporting mode establish their chain and wallet connections and start
+// listening for miner connections before New returns. The database is
+// closed if the pool cannot be created.
+func New(cfg *Config) (*Pool, error) {
+	hcfg := cfg.Hub
+	if hcfg.DB == nil {
+		db, err := openPoolDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+		hcfg.DB = db
+	}
+	p := &Pool{
+		done: make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	hub, err := NewHub(p.cancel, hcfg)
+	if err != nil {
+		p.cancel()
+		hcfg.DB.Close()
+		return nil, err
+	}
+	p.hub = hub
+	if !hcfg.Reporting {
+		err = hub.Connect()
+		if err == nil {
+			err = hub.Listen()
+		}
+		if err != nil {
+			p.cancel()
+			hub.CloseListeners()
+			hub.shutdown()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Hub returns the hub of the pool.
+func (p *Pool) Hub() *Hub {
+	return p.hub
+}
+
+// Run serves miners until the provided context is cancelled or the pool
+// shuts down, it returns once the pool has released its resources. Running
+// a pool more than once or after it shut down returns immediately.
+func (p *Pool) Run(ctx context.Context) {
+	p.mtx.Lock()
+	if p.started {
+		p.mtx.Unlock()
+		return
+	}
+	p.started = true
+	p.mtx.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.cancel()
+		case <-p.ctx.Done():
+		}
+	}()
+	p.hub.Run(p.ctx)
+	close(p.done)
+}
+
+// Shutdown stops the pool and waits for it to release its resources. A
+// pool which was never run releases its resources directly.
+func (p *Pool) Shutdown() {
+	p.mtx.Lock()
+	started := p.started
+	p.started = true
+	p.mtx.Unlock()
+
+	p.cancel()
+	if !started {
+		p.hub.CloseListeners()
+		p.hub.phases.enter(ShutdownDB)
+		p.hub.shutdown()
+		p.hub.phases.enter(ShutdownComplete)
+		close(p.done)
+		return
+	}
+	<-p.done
+}
+
+// Done returns a channel closed once the pool has shut down.
+func (p *Pool) Done() <-chan struct{} {
+	return p.done
+}
+
+// Stats returns the current statistics of the pool.
+func (p *Pool) Stats() (*PoolStats, error) {
+	return p.hub.FetchPoolStats()
+}
+
+// Clients returns connection details about all pool clients, ordered by
+// client id.
+func (p *Pool) Clients() []*ClientInfo {
+	var clients []*ClientInfo
+	for _, info := range p.hub.FetchClientInfo() {
+		clients = append(clients, info...)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ID < clients[j].ID
+	})
+	return clients
+}
@@ -6,13 +6,16 @@ package pool
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
 )
 
 type EndpointConfig struct {
@@ -27,89 +30,570 @@ type EndpointConfig struct {
 	Blake256Pad []byte
 	// NonceIterations returns the possible header nonce iterations.
 	NonceIterations float64
+	// DiffMultiplier represents the multiplier the difficulty of the
+	// endpoint's miner type is scaled by, zero is treated as one.
+	DiffMultiplier float64
+	// ListenAddrs represents the addresses the endpoint listens on, as
+	// host:port. The endpoint listens on all IPv4 interfaces on its port
+	// if none are provided.
+	ListenAddrs []string
 	// MaxConnectionsPerHost represents the maximum number of connections
 	// allowed per host.
 	MaxConnectionsPerHost uint32
+	// MaxClients represents the maximum number of clients allowed on the
+	// endpoint, zero for no limit.
+	MaxClients uint32
+	// MinNotifyInterval represents the minimum interval between non-clean
+	// work notifications sent to a client.
+	MinNotifyInterval time.Duration
+	// KeepAlivePeriod represents the period between TCP keepalive probes
+	// of client connections, zero disables keepalives.
+	KeepAlivePeriod time.Duration
+	// WriteTimeout represents the duration a message write to a client can
+	// block for before the client is disconnected, zero for no timeout.
+	WriteTimeout time.Duration
+	// MaxReadSize and MaxWriteSize represent the maximum sizes, in bytes,
+	// of messages read from and written to a client, zero for the defaults.
+	MaxReadSize  uint32
+	MaxWriteSize uint32
+	// MaxInFlight represents the maximum number of unprocessed messages
+	// allowed per client, zero for no limit.
+	MaxInFlight uint32
+	// StaleJobWindow represents the number of blocks below the current
+	// height, inclusive, work for superseded chain tips is still accepted
+	// for, zero to reject all of it.
+	StaleJobWindow uint32
+	// StaleGracePeriod represents the period after a clean job
+	// notification work for the job notified before it is credited as late
+	// instead of rejected as stale, zero disables the grace period.
+	StaleGracePeriod time.Duration
 	// HubWg represents the hub's waitgroup.
 	HubWg *sync.WaitGroup
-	// SubmitWork sends solved block data to the consensus daemon.
-	SubmitWork func(*string) (bool, error)
-	// FetchCurrentWork returns the current work of the pool.
-	FetchCurrentWork func() string
-	// WithinLimit returns if a client is within its request limits.
-	WithinLimit func(string, int) bool
+	// RegisterClient records a client as running with the hub's client
+	// registry, it returns false if the client must not run.
+	RegisterClient func(*Client) bool
+	// DeregisterClient removes a client from the hub's client registry.
+	DeregisterClient func(*Client)
+	// SubmitWork sends solved block data to the consensus daemon, returning
+	// the daemon's reason for rejected submissions when provided.
+	SubmitWork func(*string) (bool, string, error)
+	// FetchCurrentWork returns the current work of the pool, nil if there
+	// is none.
+	FetchCurrentWork func() *CurrentWork
+	// WithinLimit returns if a client is within its request limits of the
+	// provided request class, the submission limit is scaled to the
+	// provided expected share rate.
+	WithinLimit func(string, int, float64) bool
 	// AddConnection records a new client connection.
 	AddConnection func(string)
 	// RemoveConnection removes a client connection.
 	RemoveConnection func(string)
 	// FetchHostConnections returns the host connection for the provided host.
 	FetchHostConnections func(string) uint32
+	// IsBanned returns if the provided ip is banned from connecting.
+	IsBanned func(net.IP) bool
+	// Events represents the hub's event bus client lifecycle and share
+	// events are published on.
+	Events *EventBus
+	// FetchMinerPolicy returns the policy applied to the provided miner
+	// type.
+	FetchMinerPolicy func(string) string
+	// WorkSubsidy returns the proof-of-work subsidy of a block at the
+	// provided height with the provided number of voters.
+	WorkSubsidy func(uint32, uint16) dcrutil.Amount
+	// NotifyBlockAccepted publishes a block accepted event for the
+	// provided work submitted by the client with the provided id.
+	NotifyBlockAccepted func(string, *AcceptedWork)
+	// NotifyBlockLost publishes a block lost event for the provided block
+	// candidate submitted by the client with the provided id.
+	NotifyBlockLost func(string, *LostBlock)
+	// IsTraced returns if logging of the provided client id or account is
+	// elevated to trace level.
+	IsTraced func(string, string) bool
+	// FetchCapture returns the running trace capture of the provided
+	// client id, nil if it is not being captured.
+	FetchCapture func(string) *FrameCapture
+	// RecordAuthFailure records a failed authorization of a locked
+	// account by the provided host key.
+	RecordAuthFailure func(string)
+	// Sessions reserves client extraNonce1s and keeps the sessions of
+	// disconnected clients for resumption.
+	Sessions *SessionStore
+	// AuthRejects refuses usernames recently rejected for being malformed
+	// and counts authorization rejections, nil if disabled.
+	AuthRejects *AuthRejectCache
+	// SubmitLatency records the stage latencies of work submissions, nil
+	// if latency metrics are disabled.
+	SubmitLatency *LatencyRecorder
+	// InitialWorkDelay represents the delay between a client completing
+	// its handshake and it being sent its initial work, zero for no delay.
+	InitialWorkDelay time.Duration
+	// InstanceID represents the id of the pool instance, it occupies the
+	// leading InstanceBits bits of client extraNonce1s.
+	InstanceID uint32
+	// InstanceBits represents the number of leading extraNonce1 bits
+	// reserved for the instance id.
+	InstanceBits uint32
+	// MaxWorkerNameLength represents the maximum length of worker names,
+	// zero for the default.
+	MaxWorkerNameLength uint32
+	// StrictWorkerNames represents if authorizations with invalid worker
+	// names are refused instead of having their worker names sanitized.
+	StrictWorkerNames bool
+	// DefaultWorkerNames assigns names to workers authorizing without one.
+	DefaultWorkerNames *DefaultWorkerNames
+	// FastPath represents if shares of trusted clients are validated on the
+	// fast path.
+	FastPath bool
+	// SpotCheckRate represents the fraction of the shares of trusted
+	// clients that are fully validated.
+	SpotCheckRate float64
+	// MaxClockSkew represents the median clock skew of a client beyond
+	// which its miner is advised to synchronize its clock.
+	MaxClockSkew time.Duration
+	// JobCache retains recently created jobs in memory, nil if jobs are
+	// not cached.
+	JobCache *JobCache
+	// JobRetainer caps the number of jobs retained in the database.
+	JobRetainer *JobRetainer
+	// FetchWorkerShares returns the number of accepted and rejected shares
+	// recorded for the provided account's worker with the provided name.
+	FetchWorkerShares func(string, string) (uint64, uint64)
+	// SetAccountOptions applies the provided options to the provided
+	// account and returns the options in effect, nil if the set option
+	// extension is disabled.
+	SetAccountOptions func(string, *AccountOptions) (*AccountOptions, error)
+	// NotifyAccountCollision alerts the pool operator of the provided
+	// address refused for deriving the account id of another address.
+	NotifyAccountCollision func(*AccountCollision)
 }
 
+var (
+	// rejectWriteTimeout represents the period a rejected connection is given
+	// to receive its rejection message.
+	rejectWriteTimeout = time.Second
+
+	// acceptRetryDelay represents the initial delay before accepting
+	// connections again after a temporary accept error, it doubles with
+	// every consecutive error.
+	acceptRetryDelay = time.Millisecond * 5
+
+	// maxAcceptRetryDelay represents the maximum delay before accepting
+	// connections again after a temporary accept error.
+	maxAcceptRetryDelay = time.Second
+
+	// rebindRetryDelay represents the initial delay before re-binding a
+	// failed listener, it doubles with every failed attempt.
+	rebindRetryDelay = time.Second
+
+	// maxRebindRetryDelay represents the maximum delay between attempts
+	// to re-bind a failed listener.
+	maxRebindRetryDelay = time.Minute
+)
+
 // connection wraps a client connection and a done channel.
 type connection struct {
 	Conn net.Conn
 	Done chan bool
 }
 
+// normalizeIP returns the canonical form of the provided ip, IPv4-mapped
+// IPv6 addresses are reduced to their IPv4 form.
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// hostKey returns the key the provided ip is tracked under for bans and
+// connection limits. IPv4 addresses, including IPv4-mapped IPv6 addresses,
+// are tracked individually while IPv6 addresses are tracked by their /64
+// prefix since a single host is typically assigned a whole prefix.
+func hostKey(ip net.IP) string {
+	ip = normalizeIP(ip)
+	if len(ip) == net.IPv4len {
+		return ip.String()
+	}
+	prefix := &net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)),
+		Mask: net.CIDRMask(64, 128)}
+	return prefix.String()
+}
+
+// endpointListener represents a listener of an endpoint bound to one of
+// its listen addresses.
+type endpointListener struct {
+	degraded int32 // update atomically.
+
+	addr     string
+	bind     func() (net.Listener, error)
+	listener net.Listener
+	mtx      sync.Mutex
+}
+
+// fetchListener returns the current listener bound to the listen address.
+func (l *endpointListener) fetchListener() net.Listener {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.listener
+}
+
+// isDegraded returns if the listener failed and is yet to be re-bound.
+func (l *endpointListener) isDegraded() bool {
+	return atomic.LoadInt32(&l.degraded) == 1
+}
+
 // Endpoint represents a stratum endpoint.
 type Endpoint struct {
-	miner      string
-	port       uint32
-	diffInfo   *DifficultyInfo
-	connCh     chan *connection
-	listener   net.Listener
-	cfg        *EndpointConfig
-	clients    map[string]*Client
-	clientsMtx sync.Mutex
-	wg         sync.WaitGroup
-}
-
-// NewEndpoint creates an new miner endpoint.
+	numClients int32  // update atomically.
+	paused     uint32 // update atomically.
+
+	miner          string
+	port           uint32
+	diffInfo       *DifficultyInfo
+	diffMultiplier float64
+	diffInfoMtx    sync.RWMutex
+	connCh         chan *connection
+	listeners      []*endpointListener
+	quit           chan struct{}
+	quitOnce       sync.Once
+	cfg            *EndpointConfig
+	clients        map[string]*Client
+	clientsMtx     sync.Mutex
+	churn          connChurn
+	wg             sync.WaitGroup
+}
+
+// NewEndpoint creates an new miner endpoint, binding its listen addresses.
 func NewEndpoint(eCfg *EndpointConfig, diffInfo *DifficultyInfo, port uint32, miner string) (*Endpoint, error) {
+	multiplier := eCfg.DiffMultiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
 	endpoint := &Endpoint{
-		port:     port,
-		miner:    miner,
-		diffInfo: diffInfo,
-		cfg:      eCfg,
-		clients:  make(map[string]*Client),
-		connCh:   make(chan *connection, bufferSize),
-	}
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", "0.0.0.0", endpoint.port))
-	if err != nil {
-		return nil, err
+		port:           port,
+		miner:          miner,
+		diffInfo:       diffInfo,
+		diffMultiplier: multiplier,
+		cfg:            eCfg,
+		clients:        make(map[string]*Client),
+		connCh:         make(chan *connection, bufferSize),
+		quit:           make(chan struct{}),
+	}
+	addrs := eCfg.ListenAddrs
+	if len(addrs) == 0 {
+		addrs = []string{fmt.Sprintf("%s:%d", "0.0.0.0", port)}
+	}
+	for _, addr := range addrs {
+		addr := addr
+		l := &endpointListener{
+			addr: addr,
+			bind: func() (net.Listener, error) {
+				return net.Listen("tcp", addr)
+			},
+		}
+		listener, err := l.bind()
+		if err != nil {
+			endpoint.closeListener()
+			return nil, err
+		}
+		l.listener = listener
+		endpoint.listeners = append(endpoint.listeners, l)
 	}
-	endpoint.listener = listener
 	return endpoint, nil
 }
 
+// closeListener permanently closes the endpoint's listeners, closed
+// listeners are not re-bound.
+func (e *Endpoint) closeListener() {
+	e.quitOnce.Do(func() {
+		close(e.quit)
+	})
+	for _, l := range e.listeners {
+		l.mtx.Lock()
+		l.listener.Close()
+		l.mtx.Unlock()
+	}
+}
+
+// isClosed returns if the endpoint's listener has been closed.
+func (e *Endpoint) isClosed() bool {
+	select {
+	case <-e.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// isDegraded returns if any of the endpoint's listeners failed and is yet
+// to be re-bound.
+func (e *Endpoint) isDegraded() bool {
+	for _, l := range e.listeners {
+		if l.isDegraded() {
+			return true
+		}
+	}
+	return false
+}
+
+// rebind replaces the provided failed listener of the endpoint, retrying
+// with exponential backoff until it succeeds or the endpoint is closed. The
+// listener is flagged degraded until it is listening again, clients
+// already connected are unaffected. It returns false if the endpoint was
+// closed before the listener was re-bound.
+func (e *Endpoint) rebind(l *endpointListener) bool {
+	atomic.StoreInt32(&l.degraded, 1)
+	delay := rebindRetryDelay
+	for {
+		select {
+		case <-e.quit:
+			return false
+		case <-time.After(delay):
+		}
+		listener, err := l.bind()
+		if err != nil {
+			log.Errorf("unable to re-bind %s listener on %s: %v", e.miner,
+				l.addr, err)
+			delay *= 2
+			if delay > maxRebindRetryDelay {
+				delay = maxRebindRetryDelay
+			}
+			continue
+		}
+		l.mtx.Lock()
+		if e.isClosed() {
+			l.mtx.Unlock()
+			listener.Close()
+			return false
+		}
+		l.listener.Close()
+		l.listener = listener
+		l.mtx.Unlock()
+		atomic.StoreInt32(&l.degraded, 0)
+		log.Infof("%s listening on %s again", e.miner, l.addr)
+		return true
+	}
+}
+
 // removeClient removes a disconnected pool client from its associated endpoint.
 func (e *Endpoint) removeClient(c *Client) {
 	e.clientsMtx.Lock()
+	_, ok := e.clients[c.id]
 	delete(e.clients, c.id)
 	e.clientsMtx.Unlock()
-	e.cfg.RemoveConnection(c.addr.IP.String())
+	if ok {
+		e.cfg.RemoveConnection(hostKey(c.addr.IP))
+		e.releaseSlot()
+		reason := c.disconnectReason()
+		e.recordClosed(c, reason)
+		event := c.newEvent(EventClientDisconnected, reason.String())
+		event.Connection = c.connectionRecord(reason.String())
+		c.cfg.Events.publish(event)
+	}
 }
 
-// listen accepts incoming client connections on the endpoint.
-// It must be run as a goroutine.
-func (e *Endpoint) listen() {
-	log.Infof("%s listening on :%d", e.miner, e.port)
+// acquireSlot reserves a client slot on the endpoint, it returns false if
+// the endpoint is at capacity.
+func (e *Endpoint) acquireSlot() bool {
 	for {
-		conn, err := e.listener.Accept()
+		clients := atomic.LoadInt32(&e.numClients)
+		if e.cfg.MaxClients > 0 && uint32(clients) >= e.cfg.MaxClients {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&e.numClients, clients, clients+1) {
+			return true
+		}
+	}
+}
+
+// releaseSlot frees a reserved client slot on the endpoint.
+func (e *Endpoint) releaseSlot() {
+	atomic.AddInt32(&e.numClients, -1)
+}
+
+// rejectConnection notifies the provided connection the endpoint is at
+// capacity and closes it.
+func (e *Endpoint) rejectConnection(conn net.Conn) {
+	err := conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout))
+	if err == nil {
+		resp := NewResponse(0, nil, NewStratumError(PoolAtCapacity, nil))
+		err = json.NewEncoder(conn).Encode(resp)
+	}
+	if err != nil {
+		log.Errorf("unable to notify rejected connection: %v", err)
+	}
+	conn.Close()
+}
+
+// setKeepAlive enables TCP keepalives with the configured period on the
+// provided client connection so silently dropped network paths are
+// detected.
+func (e *Endpoint) setKeepAlive(conn *net.TCPConn) {
+	if e.cfg.KeepAlivePeriod == 0 {
+		return
+	}
+	err := conn.SetKeepAlive(true)
+	if err == nil {
+		err = conn.SetKeepAlivePeriod(e.cfg.KeepAlivePeriod)
+	}
+	if err != nil {
+		log.Errorf("unable to enable keepalive on %s: %v", conn.RemoteAddr(),
+			err)
+	}
+}
+
+// disconnectClients disconnects all clients matching the provided filter,
+// sending them the provided reason. It returns the number of clients
+// disconnected.
+func (e *Endpoint) disconnectClients(filter func(*Client) bool, reason string) int {
+	var count int
+	e.clientsMtx.Lock()
+	for _, client := range e.clients {
+		if filter(client) {
+			client.disconnect(reason)
+			count++
+		}
+	}
+	e.clientsMtx.Unlock()
+	return count
+}
+
+// fetchDifficultyInfo returns the difficulty info assigned to clients of the
+// endpoint and the multiplier it is scaled by.
+func (e *Endpoint) fetchDifficultyInfo() (*DifficultyInfo, float64) {
+	e.diffInfoMtx.RLock()
+	defer e.diffInfoMtx.RUnlock()
+	return e.diffInfo, e.diffMultiplier
+}
+
+// ApplyConfig assigns the provided difficulty info, scaled by the provided
+// multiplier, to the endpoint at runtime. Subscribed clients are sent a
+// difficulty notification followed by work at the updated difficulty once
+// their pending submissions are answered. It returns the number of clients
+// notified.
+func (e *Endpoint) ApplyConfig(multiplier float64, diffInfo *DifficultyInfo) int {
+	// The difficulty info is swapped with the clients mutex held so clients
+	// added concurrently either pick up the update or are notified of it.
+	e.clientsMtx.Lock()
+	e.diffInfoMtx.Lock()
+	e.diffInfo = diffInfo
+	e.diffMultiplier = multiplier
+	e.diffInfoMtx.Unlock()
+	clients := make([]*Client, 0, len(e.clients))
+	for _, client := range e.clients {
+		clients = append(clients, client)
+	}
+	e.clientsMtx.Unlock()
+
+	var count int
+	for _, client := range clients {
+		if client.updateDifficulty(diffInfo) {
+			count++
+		}
+	}
+	return count
+}
+
+// subscribedClients returns the clients of the endpoint that are subscribed
+// and authorized.
+func (e *Endpoint) subscribedClients() []*Client {
+	e.clientsMtx.Lock()
+	clients := make([]*Client, 0, len(e.clients))
+	for _, client := range e.clients {
+		if client.isSubscribed() && client.isAuthorized() {
+			clients = append(clients, client)
+		}
+	}
+	e.clientsMtx.Unlock()
+	return clients
+}
+
+// IsPaused returns if the endpoint is paused.
+func (e *Endpoint) IsPaused() bool {
+	return atomic.LoadUint32(&e.paused) == 1
+}
+
+// Pause stops notifying the endpoint's clients of work while keeping them
+// connected, submissions are refused with the pool unavailable error until
+// the endpoint is resumed. Clients connecting while the endpoint is paused
+// are paused as well. Subscribed clients are sent the provided message if
+// it is not empty. It returns the number of clients sent the message.
+func (e *Endpoint) Pause(message string) int {
+	atomic.StoreUint32(&e.paused, 1)
+	return e.ShowMessage(message)
+}
+
+// ShowMessage sends the provided message to the endpoint's subscribed
+// clients if it is not empty. It returns the number of clients sent the
+// message.
+func (e *Endpoint) ShowMessage(message string) int {
+	if message == "" {
+		return 0
+	}
+	clients := e.subscribedClients()
+	for _, client := range clients {
+		client.queueMessage(ShowMessageNotification(message))
+	}
+	return len(clients)
+}
+
+// Resume resumes a paused endpoint, subscribed clients are immediately sent
+// clean work. It returns the number of clients sent work.
+func (e *Endpoint) Resume() int {
+	if !atomic.CompareAndSwapUint32(&e.paused, 1, 0) {
+		return 0
+	}
+	// Miners may have dropped their jobs while the endpoint was paused, the
+	// resumed work is sent as a clean job.
+	clients := e.subscribedClients()
+	for _, client := range clients {
+		client.forgetQueuedWork()
+		client.updateWork(true)
+	}
+	return len(clients)
+}
+
+// listen accepts incoming client connections on the provided listener of
+// the endpoint. Temporary accept errors are retried with backoff and a
+// failed listener is re-bound. It must be run as a goroutine.
+func (e *Endpoint) listen(l *endpointListener) {
+	log.Infof("%s listening on %s", e.miner, l.addr)
+	var delay time.Duration
+	for {
+		conn, err := l.fetchListener().Accept()
 		if err != nil {
-			if opErr, ok := err.(*net.OpError); ok {
-				if opErr.Op == "accept" {
-					if strings.Contains(opErr.Err.Error(),
-						"use of closed network connection") {
-						return
-					}
+			if e.isClosed() {
+				return
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				if delay == 0 {
+					delay = acceptRetryDelay
+				} else {
+					delay *= 2
 				}
+				if delay > maxAcceptRetryDelay {
+					delay = maxAcceptRetryDelay
+				}
+				log.Warnf("temporary error accepting client connection "+
+					"for %s endpoint, retrying in %v: %v", e.miner, delay, err)
+				select {
+				case <-e.quit:
+					return
+				case <-time.After(delay):
+				}
+				continue
 			}
-			log.Errorf("unable to accept client connection for "+
-				"%s endpoint: %v", e.miner, err)
-			return
+			log.Errorf("%s listener on %s failed, re-binding: %v", e.miner,
+				l.addr, err)
+			if !e.rebind(l) {
+				return
+			}
+			delay = 0
+			continue
 		}
+		delay = 0
+		e.churn.recordAccepted()
 		e.connCh <- &connection{
 			Conn: conn,
 			Done: make(chan bool),
@@ -123,32 +607,58 @@ func (e *Endpoint) connect(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			e.listener.Close()
+			e.closeListener()
 			e.wg.Done()
 			e.clientsMtx.Lock()
 			for _, client := range e.clients {
-				client.cancel()
+				client.cancelWithReason(DisconnectShutdown)
 			}
 			e.clientsMtx.Unlock()
 			e.cfg.HubWg.Done()
 			return
 
 		case msg := <-e.connCh:
+			if !e.acquireSlot() {
+				log.Errorf("exceeded maximum clients allowed for %s "+
+					"endpoint", e.miner)
+				ip, _, _ := net.SplitHostPort(msg.Conn.RemoteAddr().String())
+				e.churn.recordFailure(ip, ConnAtCapacity)
+				e.rejectConnection(msg.Conn)
+				close(msg.Done)
+				continue
+			}
 			addr := msg.Conn.RemoteAddr()
 			tcpAddr, err := net.ResolveTCPAddr(addr.Network(), addr.String())
 			if err != nil {
 				log.Errorf("unable to parse tcp addresss: %v", err)
+				e.releaseSlot()
+				msg.Conn.Close()
+				close(msg.Done)
+				continue
+			}
+			host := hostKey(tcpAddr.IP)
+			if tcpConn, ok := msg.Conn.(*net.TCPConn); ok {
+				e.setKeepAlive(tcpConn)
+			}
+			if e.cfg.IsBanned(tcpAddr.IP) {
+				log.Infof("rejected connection from banned host %s",
+					tcpAddr.IP)
+				e.releaseSlot()
+				msg.Conn.Close()
+				close(msg.Done)
 				continue
 			}
-			host := tcpAddr.IP.String()
 			connCount := e.cfg.FetchHostConnections(host)
 			if connCount >= e.cfg.MaxConnectionsPerHost {
 				log.Errorf("exceeded maximum connections allowed per"+
 					" host %d for %s", e.cfg.MaxConnectionsPerHost, host)
+				e.churn.recordFailure(tcpAddr.IP.String(), ConnHostLimit)
+				e.releaseSlot()
 				msg.Conn.Close()
 				close(msg.Done)
 				continue
 			}
+			diffInfo, _ := e.fetchDifficultyInfo()
 			cCfg := &ClientConfig{
 				ActiveNet:       e.cfg.ActiveNet,
 				DB:              e.cfg.DB,
@@ -157,25 +667,66 @@ func (e *Endpoint) connect(ctx context.Context) {
 				FetchMiner: func() string {
 					return e.miner
 				},
-				DifficultyInfo:    e.diffInfo,
-				EndpointWg:        &e.wg,
+				DifficultyInfo:    diffInfo,
+				RegisterClient:    e.cfg.RegisterClient,
+				DeregisterClient:  e.cfg.DeregisterClient,
 				RemoveClient:      e.removeClient,
 				SubmitWork:        e.cfg.SubmitWork,
 				FetchCurrentWork:  e.cfg.FetchCurrentWork,
 				WithinLimit:       e.cfg.WithinLimit,
 				HashCalcThreshold: hashCalcThreshold,
+				MinNotifyInterval: e.cfg.MinNotifyInterval,
+				WriteTimeout:      e.cfg.WriteTimeout,
+				MaxReadSize:       e.cfg.MaxReadSize,
+				MaxWriteSize:      e.cfg.MaxWriteSize,
+				MaxInFlight:       e.cfg.MaxInFlight,
+				StaleJobWindow:    e.cfg.StaleJobWindow,
+				StaleGracePeriod:  e.cfg.StaleGracePeriod,
+				Events:            e.cfg.Events,
+				FetchMinerPolicy: func() string {
+					return e.cfg.FetchMinerPolicy(e.miner)
+				},
+				WorkSubsidy:            e.cfg.WorkSubsidy,
+				NotifyBlockAccepted:    e.cfg.NotifyBlockAccepted,
+				NotifyBlockLost:        e.cfg.NotifyBlockLost,
+				IsTraced:               e.cfg.IsTraced,
+				FetchCapture:           e.cfg.FetchCapture,
+				RecordAuthFailure:      e.cfg.RecordAuthFailure,
+				Sessions:               e.cfg.Sessions,
+				AuthRejects:            e.cfg.AuthRejects,
+				SubmitLatency:          e.cfg.SubmitLatency,
+				InitialWorkDelay:       e.cfg.InitialWorkDelay,
+				InstanceID:             e.cfg.InstanceID,
+				InstanceBits:           e.cfg.InstanceBits,
+				IsPaused:               e.IsPaused,
+				MaxWorkerNameLength:    e.cfg.MaxWorkerNameLength,
+				StrictWorkerNames:      e.cfg.StrictWorkerNames,
+				DefaultWorkerNames:     e.cfg.DefaultWorkerNames,
+				FastPath:               e.cfg.FastPath,
+				SpotCheckRate:          e.cfg.SpotCheckRate,
+				MaxClockSkew:           e.cfg.MaxClockSkew,
+				JobCache:               e.cfg.JobCache,
+				JobRetainer:            e.cfg.JobRetainer,
+				FetchWorkerShares:      e.cfg.FetchWorkerShares,
+				SetAccountOptions:      e.cfg.SetAccountOptions,
+				NotifyAccountCollision: e.cfg.NotifyAccountCollision,
 			}
 			client, err := NewClient(msg.Conn, tcpAddr, cCfg)
 			if err != nil {
 				log.Errorf("unable to create client: %v", err)
+				e.releaseSlot()
 				msg.Conn.Close()
 				close(msg.Done)
 				continue
 			}
 			e.clientsMtx.Lock()
 			e.clients[client.id] = client
+			if current, _ := e.fetchDifficultyInfo(); current != diffInfo {
+				client.setDifficultyInfo(current)
+			}
 			e.clientsMtx.Unlock()
 			e.cfg.AddConnection(host)
+			client.publishEvent(EventClientConnected, "")
 			go client.run(client.ctx)
 			close(msg.Done)
 		}
@@ -186,7 +737,9 @@ func (e *Endpoint) connect(ctx context.Context) {
 // This should be run as a goroutine.
 func (e *Endpoint) run(ctx context.Context) {
 	e.wg.Add(1)
-	go e.listen()
+	for _, l := range e.listeners {
+		go e.listen(l)
+	}
 	go e.connect(ctx)
 	e.wg.Wait()
 }
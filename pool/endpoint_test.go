@@ -1,18 +1,22 @@
 package pool
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/big"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
 )
 
 func makeConn(listener *net.TCPListener, serverCh chan net.Conn) (net.Conn, net.Conn, error) {
@@ -32,7 +36,7 @@ func testEndpoint(t *testing.T, db *bolt.DB) {
 	maxGenTime := new(big.Int).SetUint64(20)
 	blake256Pad := generateBlake256Pad()
 	poolDiffs, err := NewDifficultySet(chaincfg.SimNetParams(),
-		new(big.Rat).SetInt(powLimit), maxGenTime)
+		new(big.Rat).SetInt(powLimit), maxGenTime, 0)
 	if err != nil {
 		t.Fatalf("[NewPoolDifficulty] unexpected error: %v", err)
 	}
@@ -43,6 +47,7 @@ func testEndpoint(t *testing.T, db *bolt.DB) {
 
 	connections := make(map[string]uint32)
 	var connectionsMtx sync.RWMutex
+	registry := newClientRegistry()
 	eCfg := &EndpointConfig{
 		ActiveNet:             chaincfg.SimNetParams(),
 		DB:                    db,
@@ -50,16 +55,29 @@ func testEndpoint(t *testing.T, db *bolt.DB) {
 		Blake256Pad:           blake256Pad,
 		NonceIterations:       iterations,
 		MaxConnectionsPerHost: 3,
+		MaxClients:            5,
 		HubWg:                 new(sync.WaitGroup),
-		SubmitWork: func(submission *string) (bool, error) {
-			return false, nil
+		RegisterClient:        registry.register,
+		DeregisterClient:      registry.deregister,
+		SubmitWork: func(submission *string) (bool, string, error) {
+			return false, "", nil
 		},
-		FetchCurrentWork: func() string {
-			return ""
+		FetchCurrentWork: func() *CurrentWork {
+			return nil
 		},
-		WithinLimit: func(ip string, clientType int) bool {
+		WithinLimit: func(ip string, class int, shareRate float64) bool {
 			return true
 		},
+		FetchMinerPolicy: func(string) string {
+			return PolicyAllow
+		},
+		WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+			return 0
+		},
+		IsTraced: func(string, string) bool {
+			return false
+		},
+		Sessions: NewSessionStore(),
 		AddConnection: func(host string) {
 			connectionsMtx.Lock()
 			connections[host]++
@@ -75,6 +93,10 @@ func testEndpoint(t *testing.T, db *bolt.DB) {
 			defer connectionsMtx.RUnlock()
 			return connections[host]
 		},
+		IsBanned: func(ip net.IP) bool {
+			return false
+		},
+		Events: NewEventBus(),
 	}
 	port := uint32(3030)
 	endpoint, err := NewEndpoint(eCfg, diffInfo, port, miner)
@@ -197,16 +219,62 @@ func testEndpoint(t *testing.T, db *bolt.DB) {
 			"for host %s, got %d", 3, host, hostConnections)
 	}
 
+	// Ensure the client slot of the rejected connection was released.
+	clients := atomic.LoadInt32(&endpoint.numClients)
+	if clients != 3 {
+		t.Fatalf("expected %d endpoint client(s), got %d", 3, clients)
+	}
+
+	// Ensure connections are rejected with a stratum error when the
+	// endpoint is at capacity.
+	atomic.StoreInt32(&endpoint.numClients, int32(eCfg.MaxClients))
+	connE, srvE, err := makeConn(ln, serverCh)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer connE.Close()
+	defer srvE.Close()
+	msgE := &connection{
+		Conn: connE,
+		Done: make(chan bool),
+	}
+	endpoint.connCh <- msgE
+	<-msgE.Done
+	data, err := bufio.NewReader(srvE).ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("unable to read rejection message: %v", err)
+	}
+	var resp Response
+	err = json.Unmarshal(data, &resp)
+	if err != nil {
+		t.Fatalf("unable to parse rejection message: %v", err)
+	}
+	if resp.Error == nil || resp.Error.Code != PoolAtCapacity {
+		t.Fatalf("expected a pool at capacity error, got %v", string(data))
+	}
+	atomic.StoreInt32(&endpoint.numClients, 3)
+
+	// Ensure the rejected connections were recorded as connection
+	// failures, most recent first.
+	churn := endpoint.fetchChurn()
+	if churn.Failures[ConnHostLimit.String()] != 1 ||
+		churn.Failures[ConnAtCapacity.String()] != 1 ||
+		len(churn.Recent) != 2 ||
+		churn.Recent[0].Reason != ConnAtCapacity.String() ||
+		churn.Recent[1].IP != host {
+		t.Fatalf("unexpected endpoint churn %+v", churn)
+	}
+
 	// Remove all clients.
 	endpoint.clientsMtx.Lock()
-	clients := make([]*Client, len(endpoint.clients))
+	clientList := make([]*Client, len(endpoint.clients))
 	i := 0
 	for _, cl := range endpoint.clients {
-		clients[i] = cl
+		clientList[i] = cl
 		i++
 	}
 	endpoint.clientsMtx.Unlock()
-	for _, cl := range clients {
+	for _, cl := range clientList {
 		cl.shutdown()
 	}
 
@@ -216,6 +284,493 @@ func testEndpoint(t *testing.T, db *bolt.DB) {
 		t.Fatalf("[FetchHostConnections] expected %d connection(s) for host %s"+
 			" connections, got %d", 0, host, hostConnections)
 	}
+
+	// Ensure all client slots were released.
+	clients = atomic.LoadInt32(&endpoint.numClients)
+	if clients != 0 {
+		t.Fatalf("expected no endpoint clients, got %d", clients)
+	}
+
+	// Ensure the clients closed before subscribing were recorded.
+	churn = endpoint.fetchChurn()
+	if churn.Failures[ConnClosedBeforeSubscribe.String()] != 3 {
+		t.Fatalf("expected 3 connections closed before subscribing, "+
+			"got %d", churn.Failures[ConnClosedBeforeSubscribe.String()])
+	}
 	cancel()
 	endpoint.cfg.HubWg.Wait()
 }
+
+// tempError represents a temporary network error.
+type tempError struct{}
+
+func (tempError) Error() string   { return "temporary error" }
+func (tempError) Timeout() bool   { return false }
+func (tempError) Temporary() bool { return true }
+
+// fakeListener represents a listener returning a predefined sequence of
+// connections and errors, it blocks once the sequence is exhausted until
+// it is closed.
+type fakeListener struct {
+	results []interface{}
+	closed  chan struct{}
+	once    sync.Once
+	mtx     sync.Mutex
+}
+
+func newFakeListener(results ...interface{}) *fakeListener {
+	return &fakeListener{
+		results: results,
+		closed:  make(chan struct{}),
+	}
+}
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	l.mtx.Lock()
+	if len(l.results) > 0 {
+		result := l.results[0]
+		l.results = l.results[1:]
+		l.mtx.Unlock()
+		if conn, ok := result.(net.Conn); ok {
+			return conn, nil
+		}
+		return nil, result.(error)
+	}
+	l.mtx.Unlock()
+	<-l.closed
+	return nil, fmt.Errorf("use of closed network connection")
+}
+
+func (l *fakeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *fakeListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func testEndpointListenerRecovery(t *testing.T) {
+	retryDelay := rebindRetryDelay
+	rebindRetryDelay = time.Millisecond * 10
+	defer func() {
+		rebindRetryDelay = retryDelay
+	}()
+
+	connA, _ := net.Pipe()
+	connB, _ := net.Pipe()
+	first := newFakeListener(tempError{}, tempError{}, tempError{}, connA,
+		fmt.Errorf("listener failed"))
+	second := newFakeListener(connB)
+	var binds int32
+	l := &endpointListener{
+		addr:     "127.0.0.1:3040",
+		listener: first,
+		bind: func() (net.Listener, error) {
+			if atomic.AddInt32(&binds, 1) == 1 {
+				return nil, fmt.Errorf("address in use")
+			}
+			return second, nil
+		},
+	}
+	endpoint := &Endpoint{
+		miner:     CPU,
+		port:      3040,
+		listeners: []*endpointListener{l},
+		connCh:    make(chan *connection, bufferSize),
+		quit:      make(chan struct{}),
+		cfg:       &EndpointConfig{},
+	}
+	done := make(chan struct{})
+	go func() {
+		endpoint.listen(l)
+		close(done)
+	}()
+
+	// Ensure connections are accepted after temporary accept errors.
+	select {
+	case msg := <-endpoint.connCh:
+		if msg.Conn != connA {
+			t.Fatal("expected the connection of the first listener")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected a connection after temporary accept errors")
+	}
+
+	// Ensure a failed listener is re-bound, retrying failed binds.
+	select {
+	case msg := <-endpoint.connCh:
+		if msg.Conn != connB {
+			t.Fatal("expected the connection of the re-bound listener")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected a connection after re-binding the listener")
+	}
+	if atomic.LoadInt32(&binds) != 2 {
+		t.Fatalf("expected 2 bind attempts, got %d", binds)
+	}
+	if endpoint.isDegraded() {
+		t.Fatal("expected the re-bound endpoint to not be degraded")
+	}
+	if l.fetchListener() != second {
+		t.Fatal("expected the endpoint to use the re-bound listener")
+	}
+
+	// Ensure a degraded endpoint stops re-binding once closed.
+	l.bind = func() (net.Listener, error) {
+		return nil, fmt.Errorf("address in use")
+	}
+	second.Close()
+	deadline := time.Now().Add(time.Second * 5)
+	for !endpoint.isDegraded() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the endpoint to be degraded")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	endpoint.closeListener()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the closed endpoint to stop listening")
+	}
+}
+
+func testEndpointListenAddrs(t *testing.T) {
+	// Ensure IPv4-mapped addresses are keyed by their IPv4 form and IPv6
+	// addresses by their /64 prefix.
+	keys := map[string]string{
+		"10.0.0.1":             "10.0.0.1",
+		"::ffff:10.0.0.1":      "10.0.0.1",
+		"2001:db8::1":          "2001:db8::/64",
+		"2001:db8::ffff:1":     "2001:db8::/64",
+		"2001:db8:0:1:ffff::1": "2001:db8:0:1::/64",
+	}
+	for ip, key := range keys {
+		if got := hostKey(net.ParseIP(ip)); got != key {
+			t.Fatalf("[hostKey] expected %s for %s, got %s", key, ip, got)
+		}
+	}
+
+	// Ensure an endpoint accepts connections on all of its listen
+	// addresses.
+	addrs := []string{"127.0.0.1:3050"}
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err == nil {
+		ln.Close()
+		addrs = append(addrs, "[::1]:3050")
+	}
+	endpoint, err := NewEndpoint(&EndpointConfig{ListenAddrs: addrs},
+		nil, 3050, CPU)
+	if err != nil {
+		t.Fatalf("[NewEndpoint] unexpected error: %v", err)
+	}
+	if len(endpoint.listeners) != len(addrs) {
+		t.Fatalf("expected %d listeners, got %d", len(addrs),
+			len(endpoint.listeners))
+	}
+	var wg sync.WaitGroup
+	for _, l := range endpoint.listeners {
+		wg.Add(1)
+		go func(l *endpointListener) {
+			endpoint.listen(l)
+			wg.Done()
+		}(l)
+	}
+	for _, addr := range addrs {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("unable to dial %s: %v", addr, err)
+		}
+		select {
+		case msg := <-endpoint.connCh:
+			msg.Conn.Close()
+		case <-time.After(time.Second * 5):
+			t.Fatalf("expected a connection on %s", addr)
+		}
+		conn.Close()
+	}
+
+	// Ensure an endpoint is not created if any of its addresses fail to
+	// bind, releasing the addresses already bound.
+	_, err = NewEndpoint(&EndpointConfig{
+		ListenAddrs: []string{"127.0.0.1:3051", addrs[0]},
+	}, nil, 3051, CPU)
+	if err == nil {
+		t.Fatal("[NewEndpoint] expected an address in use error")
+	}
+	endpoint.closeListener()
+	wg.Wait()
+	ln, err = net.Listen("tcp", "127.0.0.1:3051")
+	if err != nil {
+		t.Fatalf("expected the bound address to be released: %v", err)
+	}
+	ln.Close()
+}
+
+func testEndpointApplyConfig(t *testing.T, db *bolt.DB) {
+	powLimit := new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit)
+	poolDiffs, err := NewDifficultySet(chaincfg.SimNetParams(), powLimit,
+		new(big.Int).SetUint64(20), 0)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error: %v", err)
+	}
+	diffInfo, err := poolDiffs.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	scaled, err := poolDiffs.fetchScaledMinerDifficulty(CPU, 2)
+	if err != nil {
+		t.Fatalf("[fetchScaledMinerDifficulty] unexpected error: %v", err)
+	}
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+	registry := newClientRegistry()
+	cCfg := &ClientConfig{
+		ActiveNet:      chaincfg.SimNetParams(),
+		DB:             db,
+		SoloPool:       true,
+		Blake256Pad:    generateBlake256Pad(),
+		DifficultyInfo: diffInfo,
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RemoveClient: func(*Client) {},
+		FetchCurrentWork: func() *CurrentWork {
+			return &CurrentWork{Header: workE, Height: 41}
+		},
+		WithinLimit: func(string, int, float64) bool {
+			return true
+		},
+		IsTraced: func(string, string) bool {
+			return false
+		},
+		RegisterClient:    registry.register,
+		DeregisterClient:  registry.deregister,
+		HashCalcThreshold: 1,
+		Events:            NewEventBus(),
+		Sessions:          NewSessionStore(),
+	}
+	endpoint := &Endpoint{
+		miner:          CPU,
+		diffInfo:       diffInfo,
+		diffMultiplier: 1,
+		clients:        make(map[string]*Client),
+	}
+	subscribed, m := pipeMiner(t, cCfg, CPU)
+	m.subscribe()
+	status, sErr := m.authorize("rig1", xAddr)
+	if !status {
+		t.Fatalf("unexpected authorize error: %v", sErr)
+	}
+	m.awaitWork()
+	idle, _ := pipeMiner(t, cCfg, CPU)
+	endpoint.clients[subscribed.id] = subscribed
+	endpoint.clients[idle.id] = idle
+
+	// Ensure applying a difficulty multiplier updates the endpoint and all
+	// its clients, notifying only subscribed clients of the difficulty
+	// followed by work.
+	notified := endpoint.ApplyConfig(2, scaled)
+	if notified != 1 {
+		t.Fatalf("expected 1 client notified, got %d", notified)
+	}
+	current, multiplier := endpoint.fetchDifficultyInfo()
+	if current != scaled || multiplier != 2 {
+		t.Fatalf("expected the applied difficulty info with a multiplier "+
+			"of 2, got %v", multiplier)
+	}
+	for _, client := range []*Client{subscribed, idle} {
+		info := client.fetchDifficultyInfo()
+		if info.difficulty.Cmp(scaled.difficulty) != 0 {
+			t.Fatalf("expected client difficulty %v, got %v",
+				scaled.difficulty, info.difficulty)
+		}
+	}
+	m.awaitWork()
+	expected, _ := scaled.difficulty.Float64()
+	if m.difficulty != uint64(expected) {
+		t.Fatalf("expected a notified difficulty of %v, got %v", expected,
+			m.difficulty)
+	}
+
+	subscribed.cancel()
+	idle.cancel()
+	m.awaitDisconnect()
+	if !registry.wait(time.Second * 5) {
+		t.Fatal("expected all clients to shut down")
+	}
+	err = emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+}
+
+func testEndpointPause(t *testing.T, db *bolt.DB) {
+	powLimit := chaincfg.SimNetParams().PowLimit
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+
+	// Lower the network target of the work so shares are not blocks.
+	workE = workE[:232] + "ffff001e" + workE[240:]
+	diff := int64(1 << 8)
+	diffInfo := &DifficultyInfo{
+		target:     new(big.Rat).SetFrac(powLimit, big.NewInt(diff)),
+		difficulty: new(big.Rat).SetInt64(diff),
+		powLimit:   new(big.Rat).SetInt(powLimit),
+		multiplier: new(big.Rat).SetInt64(1),
+	}
+	endpoint := &Endpoint{
+		miner:          CPU,
+		diffInfo:       diffInfo,
+		diffMultiplier: 1,
+		clients:        make(map[string]*Client),
+	}
+	events := NewEventBus()
+	shares := events.Subscribe(16, EventShareAccepted, EventShareRejected)
+	registry := newClientRegistry()
+	cCfg := &ClientConfig{
+		ActiveNet:      chaincfg.SimNetParams(),
+		DB:             db,
+		SoloPool:       true,
+		Blake256Pad:    generateBlake256Pad(),
+		DifficultyInfo: diffInfo,
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RemoveClient: func(*Client) {},
+		FetchCurrentWork: func() *CurrentWork {
+			return &CurrentWork{Header: workE, Height: 41}
+		},
+		WithinLimit: func(string, int, float64) bool {
+			return true
+		},
+		IsTraced: func(string, string) bool {
+			return false
+		},
+		WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+			return 0
+		},
+		RegisterClient:    registry.register,
+		DeregisterClient:  registry.deregister,
+		HashCalcThreshold: 1,
+		Events:            events,
+		Sessions:          NewSessionStore(),
+		IsPaused:          endpoint.IsPaused,
+	}
+
+	// Ensure an endpoint paused before clients connect neither sends work
+	// to them nor credits their submissions, refusals are not counted as
+	// rejected shares.
+	if endpoint.Pause("") != 0 || !endpoint.IsPaused() {
+		t.Fatal("expected a paused endpoint with no clients notified")
+	}
+	client, m := pipeMiner(t, cCfg, CPU)
+	endpoint.clients[client.id] = client
+	m.subscribe()
+	status, sErr := m.authorize("rig0", xAddr)
+	if !status {
+		t.Fatalf("unexpected authorize error: %v", sErr)
+	}
+	job, err := NewJob(workE, 41)
+	if err != nil {
+		t.Fatalf("[NewJob] unexpected error: %v", err)
+	}
+	err = job.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	pausedJob := &testMinerJob{id: job.UUID, header: workE}
+	extraNonce2, nTime, nonce := m.solve(pausedJob)
+	status, sErr = m.submit(pausedJob, extraNonce2, nTime, nonce)
+	if status || sErr == nil || sErr.Code != PoolUnavailable {
+		t.Fatalf("expected a pool unavailable error, got %v", sErr)
+	}
+	if m.job != nil {
+		t.Fatalf("expected no work notified while paused, got job %s",
+			m.job.id)
+	}
+	if atomic.LoadInt64(&client.submissions) != 0 ||
+		atomic.LoadInt64(&client.rejected) != 0 || len(shares.Events()) != 0 {
+		t.Fatal("expected the paused submission to be neither credited " +
+			"nor rejected")
+	}
+
+	// Ensure resuming the endpoint immediately sends clean work and shares
+	// are credited again.
+	if endpoint.Resume() != 1 || endpoint.IsPaused() {
+		t.Fatal("expected a resumed endpoint with 1 client sent work")
+	}
+	if endpoint.Resume() != 0 {
+		t.Fatal("expected resuming an active endpoint to be a no-op")
+	}
+	resumed := m.awaitWork()
+	if !resumed.clean {
+		t.Fatal("expected the first job after resuming to be clean")
+	}
+	extraNonce2, nTime, nonce = m.solve(resumed)
+	status, sErr = m.submit(resumed, extraNonce2, nTime, nonce)
+	if !status {
+		t.Fatalf("expected an accepted share, got %v", sErr)
+	}
+	if atomic.LoadInt64(&client.submissions) != 1 {
+		t.Fatalf("expected 1 credited submission, got %d",
+			atomic.LoadInt64(&client.submissions))
+	}
+	event := <-shares.Events()
+	if event.Kind != EventShareAccepted {
+		t.Fatalf("expected an accepted share event, got %v", event.Kind)
+	}
+
+	// Ensure pausing the endpoint with a message notifies subscribed
+	// clients.
+	msg := "Pool upgrade in progress"
+	if endpoint.Pause(msg) != 1 {
+		t.Fatal("expected 1 client notified of the pause")
+	}
+	extraNonce2, nTime, nonce = m.solve(resumed)
+	status, sErr = m.submit(resumed, extraNonce2, nTime, nonce)
+	if status || sErr == nil || sErr.Code != PoolUnavailable {
+		t.Fatalf("expected a pool unavailable error, got %v", sErr)
+	}
+	if len(m.messages) != 1 || m.messages[0] != msg {
+		t.Fatalf("expected the pause message, got %v", m.messages)
+	}
+
+	client.cancel()
+	m.awaitDisconnect()
+	if !registry.wait(time.Second * 5) {
+		t.Fatal("expected all clients to shut down")
+	}
+	events.Unsubscribe(shares)
+	err = emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("[emptyBucket] unexpected error: %v", err)
+	}
+}
@@ -53,27 +53,46 @@ const (
 	// ErrDBUpgrade indicates a database upgrade error.
 	ErrDBUpgrade
 
+	// ErrUnauthorized indicates a failed signature or token check.
+	ErrUnauthorized
+
+	// ErrInsufficientBalance indicates the wallet's spendable balance does
+	// not cover the payments being dispatched.
+	ErrInsufficientBalance
+
+	// ErrDuplicateSubmission indicates an accepted submission was submitted
+	// again.
+	ErrDuplicateSubmission
+
+	// ErrAccountIDCollision indicates an address derives the account id
+	// of the account of another address.
+	ErrAccountIDCollision
+
 	// ErrOther indicates a miscellenious error.
 	ErrOther
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
 var errorCodeStrings = map[ErrorCode]string{
-	ErrValueNotFound:      "ErrValueNotFound",
-	ErrBucketNotFound:     "ErrBucketNotFound",
-	ErrBucketCreate:       "ErrBucketCreate",
-	ErrDBOpen:             "ErrDBOpen",
-	ErrWorkExists:         "ErrWorkExists",
-	ErrWorkNotFound:       "ErrWorkNotfound",
-	ErrWrongInputLength:   "ErrWrongInputLength",
-	ErrDifficultyNotFound: "ErrDifficultyNotFound",
-	ErrCalcPoolTarget:     "ErrCalcPoolTarget",
-	ErrParse:              "ErrParse",
-	ErrDecode:             "ErrDecode",
-	ErrNotSupported:       "ErrNotSupported",
-	ErrDivideByZero:       "ErrDivideByZero",
-	ErrDBUpgrade:          "ErrDBUpgrade",
-	ErrOther:              "ErrOther",
+	ErrValueNotFound:       "ErrValueNotFound",
+	ErrBucketNotFound:      "ErrBucketNotFound",
+	ErrBucketCreate:        "ErrBucketCreate",
+	ErrDBOpen:              "ErrDBOpen",
+	ErrWorkExists:          "ErrWorkExists",
+	ErrWorkNotFound:        "ErrWorkNotfound",
+	ErrWrongInputLength:    "ErrWrongInputLength",
+	ErrDifficultyNotFound:  "ErrDifficultyNotFound",
+	ErrCalcPoolTarget:      "ErrCalcPoolTarget",
+	ErrParse:               "ErrParse",
+	ErrDecode:              "ErrDecode",
+	ErrNotSupported:        "ErrNotSupported",
+	ErrDivideByZero:        "ErrDivideByZero",
+	ErrDBUpgrade:           "ErrDBUpgrade",
+	ErrUnauthorized:        "ErrUnauthorized",
+	ErrInsufficientBalance: "ErrInsufficientBalance",
+	ErrDuplicateSubmission: "ErrDuplicateSubmission",
+	ErrAccountIDCollision:  "ErrAccountIDCollision",
+	ErrOther:               "ErrOther",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -0,0 +1,238 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventKind identifies the kind of a hub event.
+type EventKind uint8
+
+// The kinds of events published on the hub's event bus.
+const (
+	// EventClientConnected is published when a client connects to an
+	// endpoint.
+	EventClientConnected EventKind = iota
+
+	// EventClientAuthorized is published when a client is authorized as a
+	// worker.
+	EventClientAuthorized
+
+	// EventClientDisconnected is published when a client is removed from
+	// its endpoint.
+	EventClientDisconnected
+
+	// EventShareAccepted is published when a client submits work meeting
+	// its pool target.
+	EventShareAccepted
+
+	// EventShareRejected is published when submitted work is refused, the
+	// event's reason describes the rejection.
+	EventShareRejected
+
+	// EventBlockFound is published when a block mined by the pool is
+	// confirmed by the network.
+	EventBlockFound
+
+	// EventPaymentDispatched is published when a payment transaction is
+	// dispatched.
+	EventPaymentDispatched
+
+	// EventBlockAccepted is published when work submitted by a client is
+	// accepted by the network, before the block is confirmed.
+	EventBlockAccepted
+
+	// EventPaymentsDeferred is published when a payment cycle is deferred
+	// because the wallet's spendable balance does not cover it.
+	EventPaymentsDeferred
+
+	// EventPaymentPlanned is published when a payment dry run records a
+	// payment plan.
+	EventPaymentPlanned
+
+	// EventClientDropRate is published when the ratio of messages dropped
+	// to work notifications offered to a client crosses the drop rate
+	// threshold, the event's reason describes the drops.
+	EventClientDropRate
+
+	// EventMaintenanceStarted is published when a scheduled maintenance
+	// window starts.
+	EventMaintenanceStarted
+
+	// EventMaintenanceEnded is published when a maintenance window ends or
+	// is cancelled.
+	EventMaintenanceEnded
+
+	// EventBlockLost is published when work submitted by a client solves
+	// a block but fails submission to the consensus daemon, the event's
+	// reason describes the failure.
+	EventBlockLost
+)
+
+// String returns the name of the event kind.
+func (k EventKind) String() string {
+	switch k {
+	case EventClientConnected:
+		return "clientconnected"
+	case EventClientAuthorized:
+		return "clientauthorized"
+	case EventClientDisconnected:
+		return "clientdisconnected"
+	case EventShareAccepted:
+		return "shareaccepted"
+	case EventShareRejected:
+		return "sharerejected"
+	case EventBlockFound:
+		return "blockfound"
+	case EventPaymentDispatched:
+		return "paymentdispatched"
+	case EventBlockAccepted:
+		return "blockaccepted"
+	case EventPaymentsDeferred:
+		return "paymentsdeferred"
+	case EventPaymentPlanned:
+		return "paymentplanned"
+	case EventClientDropRate:
+		return "clientdroprate"
+	case EventMaintenanceStarted:
+		return "maintenancestarted"
+	case EventMaintenanceEnded:
+		return "maintenanceended"
+	case EventBlockLost:
+		return "blocklost"
+	default:
+		return "unknown"
+	}
+}
+
+// HubEvent represents an event published on the hub's event bus. Client and
+// share events identify the client they concern, block found and payment
+// dispatched events carry their details instead.
+type HubEvent struct {
+	Kind      EventKind
+	Timestamp int64
+	ClientID  string
+	Miner     string
+	IP        string
+	Account   string
+	Worker    string
+	// Reason represents the reason a share was rejected, the name of the
+	// reason a client was disconnected, the drops of a drop rate event or
+	// the submission failure of a block lost event.
+	Reason string
+	// JobID represents the job work of a share event was submitted for.
+	JobID string
+	// Late represents if the share of an accepted share event was credited
+	// under the stale grace period.
+	Late bool
+	// Difficulty represents the share difficulty of the client at the
+	// time of a share event.
+	Difficulty float64
+	// Block represents the details of a block found or block accepted
+	// event.
+	Block *BlockFoundData
+	// Payment represents the details of a payment dispatched event.
+	Payment *PaymentSentData
+	// Deferral represents the details of a payments deferred event.
+	Deferral *PaymentDeferral
+	// Plan represents the details of a payment planned event.
+	Plan *PaymentPlan
+	// Connection represents the audit record of the connection of a
+	// client disconnected event.
+	Connection *ConnectionRecord
+	// Maintenance represents the window of a maintenance event.
+	Maintenance *MaintenanceWindow
+	// Lost represents the block candidate of a block lost event.
+	Lost *LostBlock
+}
+
+// Subscription represents a subscriber of the hub's event bus. Events are
+// queued for the subscriber and dropped once its queue is full, a slow
+// subscriber never blocks the publisher.
+type Subscription struct {
+	dropped uint64 // update atomically.
+
+	kinds map[EventKind]struct{}
+	ch    chan *HubEvent
+}
+
+// Events returns the event queue of the subscription. The queue is closed
+// when the subscription is cancelled.
+func (s *Subscription) Events() <-chan *HubEvent {
+	return s.ch
+}
+
+// Dropped returns the number of events dropped because the subscription's
+// queue was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// EventBus delivers hub events to its subscribers.
+type EventBus struct {
+	subs    map[*Subscription]struct{}
+	subsMtx sync.RWMutex
+}
+
+// NewEventBus creates an event bus.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber with a queue of the provided size for
+// the provided event kinds, all events are delivered if no kinds are
+// provided.
+func (b *EventBus) Subscribe(queueSize int, kinds ...EventKind) *Subscription {
+	sub := &Subscription{
+		kinds: make(map[EventKind]struct{}, len(kinds)),
+		ch:    make(chan *HubEvent, queueSize),
+	}
+	for _, kind := range kinds {
+		sub.kinds[kind] = struct{}{}
+	}
+	b.subsMtx.Lock()
+	b.subs[sub] = struct{}{}
+	b.subsMtx.Unlock()
+	return sub
+}
+
+// Unsubscribe cancels the provided subscription and closes its queue.
+func (b *EventBus) Unsubscribe(sub *Subscription) {
+	b.subsMtx.Lock()
+	defer b.subsMtx.Unlock()
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.ch)
+}
+
+// publish queues the provided event for delivery to all subscribers of its
+// kind. Events are dropped for subscribers with full queues.
+func (b *EventBus) publish(event *HubEvent) {
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().UnixNano()
+	}
+	b.subsMtx.RLock()
+	defer b.subsMtx.RUnlock()
+	for sub := range b.subs {
+		if len(sub.kinds) > 0 {
+			if _, ok := sub.kinds[event.Kind]; !ok {
+				continue
+			}
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+			log.Tracef("Event queue full, dropping %s event", event.Kind)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package pool
+
+import (
+	"testing"
+)
+
+func testEventBus(t *testing.T) {
+	bus := NewEventBus()
+	all := bus.Subscribe(2)
+	shares := bus.Subscribe(1, EventShareAccepted, EventShareRejected)
+
+	// Ensure events are only delivered to subscribers of their kind.
+	bus.publish(&HubEvent{Kind: EventClientConnected, ClientID: "a"})
+	bus.publish(&HubEvent{Kind: EventShareAccepted, ClientID: "a"})
+	event := <-all.Events()
+	if event.Kind != EventClientConnected || event.Timestamp == 0 {
+		t.Fatalf("expected a timestamped client connected event, got %v",
+			event.Kind)
+	}
+	event = <-shares.Events()
+	if event.Kind != EventShareAccepted {
+		t.Fatalf("expected a share accepted event, got %v", event.Kind)
+	}
+	if shares.Dropped() != 0 {
+		t.Fatalf("expected no dropped share events, got %d",
+			shares.Dropped())
+	}
+
+	// Ensure events are dropped for subscribers with full queues without
+	// affecting other subscribers.
+	bus.publish(&HubEvent{Kind: EventShareRejected, Reason: "Stale Job"})
+	bus.publish(&HubEvent{Kind: EventShareRejected, Reason: "Duplicate share"})
+	if shares.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped share event, got %d", shares.Dropped())
+	}
+	event = <-shares.Events()
+	if event.Reason != "Stale Job" {
+		t.Fatalf("expected the first rejected share event, got %q",
+			event.Reason)
+	}
+	if all.Dropped() != 1 || len(all.Events()) != 2 {
+		t.Fatalf("expected 1 dropped and 2 queued events, got %d and %d",
+			all.Dropped(), len(all.Events()))
+	}
+
+	// Ensure cancelled subscriptions are closed and receive no events.
+	bus.Unsubscribe(shares)
+	bus.Unsubscribe(shares)
+	bus.publish(&HubEvent{Kind: EventShareAccepted})
+	if _, ok := <-shares.Events(); ok {
+		t.Fatal("expected a closed subscription queue")
+	}
+}
@@ -0,0 +1,142 @@
+package pool_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+	"github.com/Eacred/eacrd/dcrutil"
+	chainjson "github.com/Eacred/eacrd/rpc/jsonrpc/types"
+	"github.com/Eacred/eacrd/wire"
+	"github.com/Eacred/eacrpool/pool"
+)
+
+// workE is the work served by the fake consensus daemon.
+const workE = "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+	"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+	"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+	"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+	"00000000000000000000000003e133920204e00000000000029000" +
+	"000a6030000954cee5d00000000000000000000000000000000000" +
+	"000000000000000000000000000000000000000000000800000010" +
+	"0000000000005a0"
+
+var errNotSupported = errors.New("not supported")
+
+// fakeChain is a consensus daemon client serving fixed work.
+type fakeChain struct{}
+
+func (fakeChain) GetWork() (*chainjson.GetWorkResult, error) {
+	return &chainjson.GetWorkResult{Data: workE}, nil
+}
+
+func (fakeChain) GetWorkSubmit(data string) (bool, error) {
+	return false, nil
+}
+
+func (fakeChain) GetBlock(*chainhash.Hash) (*wire.MsgBlock, error) {
+	return nil, errNotSupported
+}
+
+func (fakeChain) GetBestBlock() (*chainhash.Hash, int64, error) {
+	return nil, 0, errNotSupported
+}
+
+func (fakeChain) GetBlockHash(int64) (*chainhash.Hash, error) {
+	return nil, errNotSupported
+}
+
+func (fakeChain) GetBlockHeader(*chainhash.Hash) (*wire.BlockHeader, error) {
+	return nil, errNotSupported
+}
+
+func (fakeChain) GetBlockChainInfo() (*chainjson.GetBlockChainInfoResult, error) {
+	return nil, errNotSupported
+}
+
+// fakeWallet is a wallet with a fixed balance which publishes nothing.
+type fakeWallet struct{}
+
+func (fakeWallet) Ping(context.Context) error {
+	return nil
+}
+
+func (fakeWallet) SpendableBalance(context.Context) (dcrutil.Amount, error) {
+	return dcrutil.Amount(1e8), nil
+}
+
+func (fakeWallet) PublishTransaction(context.Context, map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
+	return "", errNotSupported
+}
+
+// This example demonstrates running a pool in-process with a stubbed
+// consensus daemon and wallet.
+func ExampleNew() {
+	dir, err := ioutil.TempDir("", "pool")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	net := chaincfg.SimNetParams()
+	feeAddr, err := dcrutil.DecodeAddress(
+		"SsnbEmxCVXskgTHXvf3rEa17NA39qQuGHwQ", net)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	p, err := pool.New(&pool.Config{
+		DBFile: filepath.Join(dir, "pool.kv"),
+		Hub: &pool.HubConfig{
+			ActiveNet:       net,
+			ChainClient:     fakeChain{},
+			Wallet:          fakeWallet{},
+			PoolFee:         0.01,
+			PoolFeeAddrs:    []dcrutil.Address{feeAddr},
+			PaymentMethod:   pool.PPS,
+			MinPayment:      dcrutil.Amount(2e6),
+			MaxTxFeeReserve: dcrutil.Amount(1e7),
+			MaxGenTime:      15,
+			NonceIterations: 1,
+			MinerPorts:      map[string]uint32{pool.CPU: 0},
+			ListenAddrs: map[uint32][]string{
+				0: {"127.0.0.1:0"},
+			},
+		},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	go p.Run(context.Background())
+
+	// Chain notifications of the stubbed daemon are delivered to the hub.
+	header, _ := hex.DecodeString(workE[:wire.MaxBlockHeaderPayload*2])
+	p.Hub().HandleWork(header, pool.NewParent)
+
+	stats, err := p.Stats()
+	if err != nil {
+		fmt.Println(err)
+		p.Shutdown()
+		return
+	}
+	fmt.Println("payment method:", stats.Metadata.PaymentMethod)
+	fmt.Println("clients:", len(p.Clients()))
+
+	p.Shutdown()
+	<-p.Done()
+	fmt.Println("shut down")
+
+	// Output:
+	// payment method: pps
+	// clients: 0
+	// shut down
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+const (
+	// DefaultSpotCheckRate represents the default fraction of the shares
+	// of trusted clients that are fully validated.
+	DefaultSpotCheckRate = 0.1
+
+	// fastPathMinShares represents the minimum number of accepted shares
+	// of a worker before its shares are validated on the fast path.
+	fastPathMinShares = 1000
+
+	// fastPathMaxRejectRate represents the maximum fraction of rejected
+	// shares of a worker whose shares are validated on the fast path.
+	fastPathMaxRejectRate = 0.01
+
+	// fastPathStableShares represents the number of shares a client must
+	// have had accepted since its last difficulty change before its shares
+	// are validated on the fast path.
+	fastPathStableShares = 100
+)
+
+// loadShareHistory records the accepted and rejected shares of the client's
+// worker prior to the client's connection, they count towards the trust
+// score of the client.
+func (c *Client) loadShareHistory() {
+	if !c.cfg.FastPath || c.cfg.FetchWorkerShares == nil {
+		return
+	}
+	accepted, rejected := c.cfg.FetchWorkerShares(c.account, c.name)
+	atomic.StoreUint64(&c.historyAccepted, accepted)
+	atomic.StoreUint64(&c.historyRejected, rejected)
+}
+
+// isTrusted returns if the client's shares are eligible for the fast path.
+// Clients are trusted once their worker has a record of enough accepted
+// shares with a low reject rate and their difficulty has been stable for a
+// number of shares. Clients flagged for failing validation on the fast
+// path are never trusted again.
+func (c *Client) isTrusted() bool {
+	if !c.cfg.FastPath || atomic.LoadUint32(&c.fastPathFlagged) == 1 {
+		return false
+	}
+	if atomic.LoadUint64(&c.stableShares) < fastPathStableShares {
+		return false
+	}
+	accepted := atomic.LoadUint64(&c.historyAccepted) +
+		uint64(atomic.LoadInt64(&c.accepted))
+	rejected := atomic.LoadUint64(&c.historyRejected) +
+		uint64(atomic.LoadInt64(&c.rejected))
+	if accepted < fastPathMinShares {
+		return false
+	}
+	return float64(rejected) <= float64(accepted+rejected)*fastPathMaxRejectRate
+}
+
+// spotCheck returns if a share of a trusted client is picked for full
+// validation.
+func (c *Client) spotCheck() bool {
+	return rand.Float64() < c.cfg.SpotCheckRate
+}
+
+// flagFastPath drops the client back to full validation for the rest of
+// its connection after a share of it failed validation while trusted.
+func (c *Client) flagFastPath(reason string) {
+	if atomic.CompareAndSwapUint32(&c.fastPathFlagged, 0, 1) {
+		c.logger.Warnf("%s failed share validation while trusted (%s), "+
+			"falling back to full validation", c.fetchIdentity(), reason)
+	}
+}
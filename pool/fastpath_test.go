@@ -0,0 +1,347 @@
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+// fastPathWorkE represents simnet work of a block at height 41.
+var fastPathWorkE = "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+	"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+	"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+	"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+	"00000000000000000000000003e133920204e00000000000029000" +
+	"000a6030000954cee5d00000000000000000000000000000000000" +
+	"000000000000000000000000000000000000000000000800000010" +
+	"0000000000005a0"
+
+// fastPathJob returns a job of the fast path test work with the provided
+// header timestamp and, if hard, a network target shares are not expected
+// to solve.
+func fastPathJob(nTime string, hard bool) (*Job, error) {
+	workE := fastPathWorkE[:272] + nTime + fastPathWorkE[280:]
+	if hard {
+		workE = workE[:232] + "ffff001d" + workE[240:]
+	}
+	return NewJob(workE, 41)
+}
+
+// fastPathClient creates a subscribed and authorized solo pool client with
+// a pool target accepting every share.
+func fastPathClient(db *bolt.DB, cCfg *ClientConfig) (*Client, error) {
+	cCfg.ActiveNet = chaincfg.SimNetParams()
+	cCfg.DB = db
+	cCfg.SoloPool = true
+	cCfg.Blake256Pad = generateBlake256Pad()
+	cCfg.DifficultyInfo = &DifficultyInfo{
+		target:     new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 256)),
+		difficulty: new(big.Rat).SetInt64(1),
+		powLimit:   new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit),
+		multiplier: new(big.Rat).SetInt64(1),
+	}
+	cCfg.FetchMiner = func() string {
+		return CPU
+	}
+	cCfg.FetchMinerPolicy = func() string {
+		return PolicyAllow
+	}
+	cCfg.RemoveClient = func(*Client) {}
+	cCfg.FetchCurrentWork = func() *CurrentWork {
+		return nil
+	}
+	cCfg.WorkSubsidy = func(uint32, uint16) dcrutil.Amount {
+		return 0
+	}
+	cCfg.Events = NewEventBus()
+	cCfg.Sessions = NewSessionStore()
+	conn, _ := net.Pipe()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	client, err := NewClient(conn, addr, cCfg)
+	if err != nil {
+		return nil, err
+	}
+	id := uint64(1)
+	for _, r := range []*Request{SubscribeRequest(&id, "mcpu", "1.0.1", ""),
+		AuthorizeRequest(&id, "rig1", xAddr)} {
+		req, err := fastPathRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		if r.Method == Subscribe {
+			client.handleSubscribeRequest(req, true)
+		} else {
+			client.handleAuthorizeRequest(req, true)
+		}
+		<-client.ch
+	}
+	return client, nil
+}
+
+// fastPathRequest returns the provided request as read from a client.
+func fastPathRequest(r *Request) (*Request, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	msg, _, err := IdentifyMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*Request), nil
+}
+
+func testFastPath(t *testing.T, db *bolt.DB) {
+	var historyAccepted, historyRejected uint64
+	var blocks int
+	cCfg := &ClientConfig{
+		FastPath:      true,
+		SpotCheckRate: 0,
+		JobCache:      NewJobCache(0),
+		FetchWorkerShares: func(string, string) (uint64, uint64) {
+			return historyAccepted, historyRejected
+		},
+		SubmitWork: func(*string) (bool, string, error) {
+			blocks++
+			return false, "", nil
+		},
+	}
+	hard, err := fastPathJob("954cee5d", true)
+	if err != nil {
+		t.Fatalf("[fastPathJob] unexpected error: %v", err)
+	}
+	err = hard.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	cached, err := fastPathJob("964cee5d", true)
+	if err != nil {
+		t.Fatalf("[fastPathJob] unexpected error: %v", err)
+	}
+	cCfg.JobCache.add(cached)
+
+	id := uint64(1)
+	var nonce uint32
+	submit := func(client *Client, jobID string) (bool, *StratumError) {
+		nonce++
+		req, err := fastPathRequest(SubmitWorkRequest(&id, "tcl", jobID,
+			"00000000", "954cee5d", fmt.Sprintf("%08x", nonce)))
+		if err != nil {
+			t.Fatalf("[fastPathRequest] unexpected error: %v", err)
+		}
+		client.handleSubmitWorkRequest(req, true,
+			client.fetchDifficultyInfo())
+		status, sErr, err := ParseSubmitWorkResponse(
+			(<-client.ch).(*Response))
+		if err != nil {
+			t.Fatalf("[ParseSubmitWorkResponse] unexpected error: %v", err)
+		}
+		return status, sErr
+	}
+
+	// Ensure clients of workers without a record are not trusted.
+	client, err := fastPathClient(db, cCfg)
+	if err != nil {
+		t.Fatalf("[fastPathClient] unexpected error: %v", err)
+	}
+	atomic.StoreUint64(&client.stableShares, fastPathStableShares)
+	if client.isTrusted() {
+		t.Fatal("expected a client without a record not to be trusted")
+	}
+
+	// Ensure clients of workers with a high reject rate are not trusted.
+	historyAccepted, historyRejected = 2000, 100
+	client, err = fastPathClient(db, cCfg)
+	if err != nil {
+		t.Fatalf("[fastPathClient] unexpected error: %v", err)
+	}
+	atomic.StoreUint64(&client.stableShares, fastPathStableShares)
+	if client.isTrusted() {
+		t.Fatal("expected a client with a high reject rate not to be " +
+			"trusted")
+	}
+
+	// Ensure clients of workers with a good record are trusted once their
+	// difficulty is stable, and their shares are fully validated before.
+	historyAccepted, historyRejected = 2000, 10
+	client, err = fastPathClient(db, cCfg)
+	if err != nil {
+		t.Fatalf("[fastPathClient] unexpected error: %v", err)
+	}
+	for i := 0; i < fastPathStableShares; i++ {
+		if client.isTrusted() {
+			t.Fatalf("expected the client not to be trusted after %d "+
+				"shares", i)
+		}
+		status, sErr := submit(client, hard.UUID)
+		if !status {
+			t.Fatalf("expected an accepted share, got %v", sErr)
+		}
+	}
+	if !client.isTrusted() || atomic.LoadInt64(&client.fastShares) != 0 {
+		t.Fatal("expected a trusted client without fast path shares")
+	}
+
+	// Ensure shares of trusted clients are accepted on the fast path for
+	// jobs only held by the job cache.
+	status, sErr := submit(client, cached.UUID)
+	if !status {
+		t.Fatalf("expected a share accepted on the fast path, got %v", sErr)
+	}
+	if atomic.LoadInt64(&client.fastShares) != 1 {
+		t.Fatal("expected a fast path share")
+	}
+
+	// Ensure spot-checked shares are fully validated.
+	cCfg.SpotCheckRate = 1
+	status, sErr = submit(client, cached.UUID)
+	if status || sErr.Code != StaleJob {
+		t.Fatalf("expected a spot-checked share of an unknown job to be "+
+			"stale, got %v", sErr)
+	}
+	cCfg.SpotCheckRate = 0
+
+	// Ensure block candidates on the fast path are submitted to the
+	// network.
+	easy, err := fastPathJob("974cee5d", false)
+	if err != nil {
+		t.Fatalf("[fastPathJob] unexpected error: %v", err)
+	}
+	cCfg.JobCache.add(easy)
+	for blocks == 0 {
+		submit(client, easy.UUID)
+	}
+	if !client.isTrusted() {
+		t.Fatal("expected a rejected block not to flag the client")
+	}
+
+	// Ensure a low difficulty share of a trusted client flags it and drops
+	// it back to full validation.
+	low := client.fetchDifficultyInfo()
+	low.target = new(big.Rat).SetInt64(1)
+	client.setDifficultyInfo(low)
+	status, sErr = submit(client, cached.UUID)
+	if status || sErr.Code != LowDifficultyShare {
+		t.Fatalf("expected a low difficulty share, got %v", sErr)
+	}
+	if client.isTrusted() ||
+		atomic.LoadUint32(&client.fastPathFlagged) != 1 {
+		t.Fatal("expected the client to be flagged")
+	}
+	client.setDifficultyInfo(cCfg.DifficultyInfo)
+	status, sErr = submit(client, cached.UUID)
+	if status || sErr.Code != StaleJob {
+		t.Fatalf("expected a fully validated share, got %v", sErr)
+	}
+
+	// Ensure the job cache evicts its oldest jobs once full and prunes jobs
+	// below a height.
+	jobCache := NewJobCache(2)
+	jobCache.add(hard)
+	jobCache.add(cached)
+	jobCache.add(easy)
+	if jobCache.fetch(hard.UUID) != nil || jobCache.fetch(easy.UUID) == nil {
+		t.Fatal("expected the oldest job to be evicted")
+	}
+	jobCache.prune(42)
+	if jobCache.fetch(cached.UUID) != nil || len(jobCache.order) != 0 {
+		t.Fatal("expected the cached jobs to be pruned")
+	}
+
+	err = emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, lostBlockBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
+
+// BenchmarkSubmitWork benchmarks validating shares of a trusted client on
+// the full and fast validation paths.
+func BenchmarkSubmitWork(b *testing.B) {
+	dbPath := "benchdb"
+	os.Remove(dbPath)
+	db, err := openDB(dbPath)
+	if err != nil {
+		b.Fatalf("[openDB] unexpected error: %v", err)
+	}
+	defer teardownDB(db, dbPath)
+	err = createBuckets(db)
+	if err != nil {
+		b.Fatalf("[createBuckets] unexpected error: %v", err)
+	}
+	err = upgradeDB(db)
+	if err != nil {
+		b.Fatalf("[upgradeDB] unexpected error: %v", err)
+	}
+
+	// Submissions are recorded on both paths, batching and syncing them
+	// would dominate the difference between the paths.
+	db.NoSync = true
+	db.MaxBatchSize = 1
+
+	for i, fast := range []bool{false, true} {
+		name := "full"
+		if fast {
+			name = "fast"
+		}
+		path := uint32(i)
+		b.Run(name, func(b *testing.B) {
+			cCfg := &ClientConfig{
+				FastPath: fast,
+				JobCache: NewJobCache(0),
+			}
+			client, err := fastPathClient(db, cCfg)
+			if err != nil {
+				b.Fatalf("[fastPathClient] unexpected error: %v", err)
+			}
+			atomic.StoreUint64(&client.historyAccepted, fastPathMinShares)
+			atomic.StoreUint64(&client.stableShares, fastPathStableShares)
+			// Every run submits shares for a distinct job.
+			job, err := fastPathJob(fmt.Sprintf("%08x",
+				uint32(b.N)<<1|path), true)
+			if err != nil {
+				b.Fatalf("[fastPathJob] unexpected error: %v", err)
+			}
+			err = job.Create(db)
+			if err != nil {
+				b.Fatalf("[Create] unexpected error: %v", err)
+			}
+			cCfg.JobCache.add(job)
+			diffInfo := client.fetchDifficultyInfo()
+			id := uint64(1)
+			reqs := make([]*Request, b.N)
+			for i := range reqs {
+				reqs[i], err = fastPathRequest(SubmitWorkRequest(&id, "tcl",
+					job.UUID, fmt.Sprintf("%08x", i), "954cee5d",
+					"00000000"))
+				if err != nil {
+					b.Fatalf("[fastPathRequest] unexpected error: %v", err)
+				}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for _, req := range reqs {
+				client.handleSubmitWorkRequest(req, true, diffInfo)
+				resp := (<-client.ch).(*Response)
+				if resp.Error != nil {
+					b.Fatalf("unexpected submit work error: %v", resp.Error)
+				}
+			}
+		})
+	}
+}
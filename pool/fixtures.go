@@ -0,0 +1,667 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// StratumFixture represents a golden stratum frame exchanged between the
+// pool and a supported miner. The fixtures pin the wire format of the pool,
+// changes to the frames produced or accepted by the pool must be reflected
+// in them.
+type StratumFixture struct {
+	// Miner represents the miner type the frame is exchanged with.
+	Miner string
+	// Method represents the stratum method of the frame, responses carry
+	// the method of the request they answer.
+	Method string
+	// Type represents the message type of the frame.
+	Type int
+	// Frame represents the JSON encoded frame without its trailing newline.
+	Frame string
+}
+
+// Stratum fixture inputs shared by all miners.
+const (
+	// fixtureWorkE represents the getwork data of the fixture job.
+	fixtureWorkE = "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+
+	fixtureJobID       = "000003a615f3d1b9c6e0a400"
+	fixtureExtraNonce1 = "6f3c9a01"
+	fixtureNotifyID    = "mn6f3c9a01"
+	fixtureAddress     = "SsiuwSRYvH7pqWmRxFJWR8Vmqc3AWsjmK2Y"
+	fixtureWorker      = "rig0"
+	fixtureDifficulty  = 256
+
+	// fixtureNonce and fixtureTime represent the nonce and timestamp of
+	// the header solved by the fixture submissions.
+	fixtureNonce = 0x0002df6d
+	fixtureTime  = 0x5dee4c95
+
+	fixtureSubscribeID = 1
+	fixtureAuthorizeID = 2
+	fixtureSubmitID    = 3
+)
+
+// stratumFixtureInputs represents the miner specific inputs of the stratum
+// fixtures.
+type stratumFixtureInputs struct {
+	userAgent       string
+	version         string
+	extraNonce1     string
+	extraNonce2Size uint64
+	extraNonce2     string
+	nTime           string
+	nonce           string
+}
+
+// fixtureInputs represents the inputs of the stratum fixtures of each
+// supported miner. Miners other than the cpu miner submit the nTime and
+// nonce as big endian, miners ignoring the extraNonce2Size provided are
+// subscribed with a padded extraNonce1 and submit it with their
+// extraNonce2.
+var fixtureInputs = map[string]*stratumFixtureInputs{
+	CPU: {
+		userAgent:       "cpuminer",
+		version:         "1.0.0",
+		extraNonce1:     fixtureExtraNonce1,
+		extraNonce2Size: ExtraNonce2Size,
+		extraNonce2:     "0000002a",
+		nTime:           "954cee5d",
+		nonce:           "6ddf0200",
+	},
+	InnosiliconD9: {
+		userAgent:       "sgminer",
+		version:         "4.4.2",
+		extraNonce1:     fixtureExtraNonce1,
+		extraNonce2Size: ExtraNonce2Size,
+		extraNonce2:     "0000002a",
+		nTime:           "5dee4c95",
+		nonce:           "0002df6d",
+	},
+	AntminerDR3: {
+		userAgent:       "cgminer",
+		version:         "4.9.0",
+		extraNonce1:     "0000000000000000" + fixtureExtraNonce1,
+		extraNonce2Size: 8,
+		extraNonce2:     "000000000000002a" + fixtureExtraNonce1,
+		nTime:           "5dee4c95",
+		nonce:           "0002df6d",
+	},
+	AntminerDR5: {
+		userAgent:       "cgminer",
+		version:         "4.10.0",
+		extraNonce1:     "0000000000000000" + fixtureExtraNonce1,
+		extraNonce2Size: 8,
+		extraNonce2:     "000000000000002a" + fixtureExtraNonce1,
+		nTime:           "5dee4c95",
+		nonce:           "0002df6d",
+	},
+	WhatsminerD1: {
+		userAgent:       "bmminer",
+		version:         "2.0.0",
+		extraNonce1:     "00000000" + fixtureExtraNonce1,
+		extraNonce2Size: ExtraNonce2Size,
+		extraNonce2:     "0000002a" + fixtureExtraNonce1,
+		nTime:           "5dee4c95",
+		nonce:           "0002df6d",
+	},
+}
+
+// StratumFixtures represents the golden frames of a mining session of each
+// supported miner: subscription, authorization, difficulty and work
+// notification and share submission.
+var StratumFixtures = []*StratumFixture{
+	{
+		Miner:  CPU,
+		Method: Subscribe,
+		Type:   RequestMessage,
+		Frame: `{"id":1,"method":"mining.subscribe","params":["cpuminer/1.0.` +
+			`0"]}`,
+	},
+	{
+		Miner:  CPU,
+		Method: Subscribe,
+		Type:   ResponseMessage,
+		Frame: `{"id":1,"error":null,"result":[[["mining.set_difficulty","mn` +
+			`6f3c9a01"],["mining.notify","mn6f3c9a01"]],"6f3c9a01",4]}`,
+	},
+	{
+		Miner:  CPU,
+		Method: Authorize,
+		Type:   RequestMessage,
+		Frame: `{"id":2,"method":"mining.authorize","params":["SsiuwSRYvH7pq` +
+			`WmRxFJWR8Vmqc3AWsjmK2Y.rig0",""]}`,
+	},
+	{
+		Miner:  CPU,
+		Method: Authorize,
+		Type:   ResponseMessage,
+		Frame:  `{"id":2,"error":null,"result":true}`,
+	},
+	{
+		Miner:  CPU,
+		Method: SetDifficulty,
+		Type:   NotificationMessage,
+		Frame:  `{"id":null,"method":"mining.set_difficulty","params":[256]}`,
+	},
+	{
+		Miner:  CPU,
+		Method: Notify,
+		Type:   NotificationMessage,
+		Frame: `{"id":null,"method":"mining.notify","params":["000003a615f3d` +
+			`1b9c6e0a400","022b580ca96146e9c85fa1ee2ec02e0e2579af4e3881fc` +
+			`619ec52d64d83e0000","bd646e312ff574bc90e08ed91f1d99a85b318cb` +
+			`4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b14b627acce606e6d652` +
+			`915bdb71dcf5351e8ad6128faab9e0100000000000000000000000000000` +
+			`03e133920204e00000000000029000000a6030000954cee5d00000000","` +
+			`00000000",[],"07000000","3e133920","954cee5d",true]}`,
+	},
+	{
+		Miner:  CPU,
+		Method: Submit,
+		Type:   RequestMessage,
+		Frame: `{"id":3,"method":"mining.submit","params":["rig0","000003a61` +
+			`5f3d1b9c6e0a400","0000002a","954cee5d","6ddf0200"]}`,
+	},
+	{
+		Miner:  CPU,
+		Method: Submit,
+		Type:   ResponseMessage,
+		Frame:  `{"id":3,"error":null,"result":true}`,
+	},
+	{
+		Miner:  InnosiliconD9,
+		Method: Subscribe,
+		Type:   RequestMessage,
+		Frame: `{"id":1,"method":"mining.subscribe","params":["sgminer/4.4.2` +
+			`"]}`,
+	},
+	{
+		Miner:  InnosiliconD9,
+		Method: Subscribe,
+		Type:   ResponseMessage,
+		Frame: `{"id":1,"error":null,"result":[[["mining.set_difficulty","mn` +
+			`6f3c9a01"],["mining.notify","mn6f3c9a01"]],"6f3c9a01",4]}`,
+	},
+	{
+		Miner:  InnosiliconD9,
+		Method: Authorize,
+		Type:   RequestMessage,
+		Frame: `{"id":2,"method":"mining.authorize","params":["SsiuwSRYvH7pq` +
+			`WmRxFJWR8Vmqc3AWsjmK2Y.rig0",""]}`,
+	},
+	{
+		Miner:  InnosiliconD9,
+		Method: Authorize,
+		Type:   ResponseMessage,
+		Frame:  `{"id":2,"error":null,"result":true}`,
+	},
+	{
+		Miner:  InnosiliconD9,
+		Method: SetDifficulty,
+		Type:   NotificationMessage,
+		Frame:  `{"id":null,"method":"mining.set_difficulty","params":[256]}`,
+	},
+	{
+		Miner:  InnosiliconD9,
+		Method: Notify,
+		Type:   NotificationMessage,
+		Frame: `{"id":null,"method":"mining.notify","params":["000003a615f3d` +
+			`1b9c6e0a400","0c582b02e94661a9eea15fc80e2ec02e4eaf792561fc81` +
+			`38642dc59e00003ed8","bd646e312ff574bc90e08ed91f1d99a85b318cb` +
+			`4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b14b627acce606e6d652` +
+			`915bdb71dcf5351e8ad6128faab9e0100000000000000000000000000000` +
+			`03e133920204e00000000000029000000a6030000954cee5d00000000","` +
+			`00000000",[],"07000000","2039133e","5dee4c95",true]}`,
+	},
+	{
+		Miner:  InnosiliconD9,
+		Method: Submit,
+		Type:   RequestMessage,
+		Frame: `{"id":3,"method":"mining.submit","params":["rig0","000003a61` +
+			`5f3d1b9c6e0a400","0000002a","5dee4c95","0002df6d"]}`,
+	},
+	{
+		Miner:  InnosiliconD9,
+		Method: Submit,
+		Type:   ResponseMessage,
+		Frame:  `{"id":3,"error":null,"result":true}`,
+	},
+	{
+		Miner:  AntminerDR3,
+		Method: Subscribe,
+		Type:   RequestMessage,
+		Frame: `{"id":1,"method":"mining.subscribe","params":["cgminer/4.9.0` +
+			`"]}`,
+	},
+	{
+		Miner:  AntminerDR3,
+		Method: Subscribe,
+		Type:   ResponseMessage,
+		Frame: `{"id":1,"error":null,"result":[[["mining.set_difficulty","mn` +
+			`6f3c9a01"],["mining.notify","mn6f3c9a01"]],"0000000000000000` +
+			`6f3c9a01",8]}`,
+	},
+	{
+		Miner:  AntminerDR3,
+		Method: Authorize,
+		Type:   RequestMessage,
+		Frame: `{"id":2,"method":"mining.authorize","params":["SsiuwSRYvH7pq` +
+			`WmRxFJWR8Vmqc3AWsjmK2Y.rig0",""]}`,
+	},
+	{
+		Miner:  AntminerDR3,
+		Method: Authorize,
+		Type:   ResponseMessage,
+		Frame:  `{"id":2,"error":null,"result":true}`,
+	},
+	{
+		Miner:  AntminerDR3,
+		Method: SetDifficulty,
+		Type:   NotificationMessage,
+		Frame:  `{"id":null,"method":"mining.set_difficulty","params":[256]}`,
+	},
+	{
+		Miner:  AntminerDR3,
+		Method: Notify,
+		Type:   NotificationMessage,
+		Frame: `{"id":null,"method":"mining.notify","params":["000003a615f3d` +
+			`1b9c6e0a400","0c582b02e94661a9eea15fc80e2ec02e4eaf792561fc81` +
+			`38642dc59e00003ed8","bd646e312ff574bc90e08ed91f1d99a85b318cb` +
+			`4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b14b627acce606e6d652` +
+			`915bdb71dcf5351e8ad6128faab9e0100000000000000000000000000000` +
+			`03e133920204e00000000000029000000a6030000954cee5d00000000","` +
+			`00000000",[],"07000000","2039133e","5dee4c95",true]}`,
+	},
+	{
+		Miner:  AntminerDR3,
+		Method: Submit,
+		Type:   RequestMessage,
+		Frame: `{"id":3,"method":"mining.submit","params":["rig0","000003a61` +
+			`5f3d1b9c6e0a400","000000000000002a6f3c9a01","5dee4c95","0002` +
+			`df6d"]}`,
+	},
+	{
+		Miner:  AntminerDR3,
+		Method: Submit,
+		Type:   ResponseMessage,
+		Frame:  `{"id":3,"error":null,"result":true}`,
+	},
+	{
+		Miner:  AntminerDR5,
+		Method: Subscribe,
+		Type:   RequestMessage,
+		Frame: `{"id":1,"method":"mining.subscribe","params":["cgminer/4.10.` +
+			`0"]}`,
+	},
+	{
+		Miner:  AntminerDR5,
+		Method: Subscribe,
+		Type:   ResponseMessage,
+		Frame: `{"id":1,"error":null,"result":[[["mining.set_difficulty","mn` +
+			`6f3c9a01"],["mining.notify","mn6f3c9a01"]],"0000000000000000` +
+			`6f3c9a01",8]}`,
+	},
+	{
+		Miner:  AntminerDR5,
+		Method: Authorize,
+		Type:   RequestMessage,
+		Frame: `{"id":2,"method":"mining.authorize","params":["SsiuwSRYvH7pq` +
+			`WmRxFJWR8Vmqc3AWsjmK2Y.rig0",""]}`,
+	},
+	{
+		Miner:  AntminerDR5,
+		Method: Authorize,
+		Type:   ResponseMessage,
+		Frame:  `{"id":2,"error":null,"result":true}`,
+	},
+	{
+		Miner:  AntminerDR5,
+		Method: SetDifficulty,
+		Type:   NotificationMessage,
+		Frame:  `{"id":null,"method":"mining.set_difficulty","params":[256]}`,
+	},
+	{
+		Miner:  AntminerDR5,
+		Method: Notify,
+		Type:   NotificationMessage,
+		Frame: `{"id":null,"method":"mining.notify","params":["000003a615f3d` +
+			`1b9c6e0a400","0c582b02e94661a9eea15fc80e2ec02e4eaf792561fc81` +
+			`38642dc59e00003ed8","bd646e312ff574bc90e08ed91f1d99a85b318cb` +
+			`4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b14b627acce606e6d652` +
+			`915bdb71dcf5351e8ad6128faab9e0100000000000000000000000000000` +
+			`03e133920204e00000000000029000000a6030000954cee5d00000000","` +
+			`00000000",[],"07000000","2039133e","5dee4c95",true]}`,
+	},
+	{
+		Miner:  AntminerDR5,
+		Method: Submit,
+		Type:   RequestMessage,
+		Frame: `{"id":3,"method":"mining.submit","params":["rig0","000003a61` +
+			`5f3d1b9c6e0a400","000000000000002a6f3c9a01","5dee4c95","0002` +
+			`df6d"]}`,
+	},
+	{
+		Miner:  AntminerDR5,
+		Method: Submit,
+		Type:   ResponseMessage,
+		Frame:  `{"id":3,"error":null,"result":true}`,
+	},
+	{
+		Miner:  WhatsminerD1,
+		Method: Subscribe,
+		Type:   RequestMessage,
+		Frame: `{"id":1,"method":"mining.subscribe","params":["bmminer/2.0.0` +
+			`"]}`,
+	},
+	{
+		Miner:  WhatsminerD1,
+		Method: Subscribe,
+		Type:   ResponseMessage,
+		Frame: `{"id":1,"error":null,"result":[[["mining.set_difficulty","mn` +
+			`6f3c9a01"],["mining.notify","mn6f3c9a01"]],"000000006f3c9a01` +
+			`",4]}`,
+	},
+	{
+		Miner:  WhatsminerD1,
+		Method: Authorize,
+		Type:   RequestMessage,
+		Frame: `{"id":2,"method":"mining.authorize","params":["SsiuwSRYvH7pq` +
+			`WmRxFJWR8Vmqc3AWsjmK2Y.rig0",""]}`,
+	},
+	{
+		Miner:  WhatsminerD1,
+		Method: Authorize,
+		Type:   ResponseMessage,
+		Frame:  `{"id":2,"error":null,"result":true}`,
+	},
+	{
+		Miner:  WhatsminerD1,
+		Method: SetDifficulty,
+		Type:   NotificationMessage,
+		Frame:  `{"id":null,"method":"mining.set_difficulty","params":[256]}`,
+	},
+	{
+		Miner:  WhatsminerD1,
+		Method: Notify,
+		Type:   NotificationMessage,
+		Frame: `{"id":null,"method":"mining.notify","params":["000003a615f3d` +
+			`1b9c6e0a400","0c582b02e94661a9eea15fc80e2ec02e4eaf792561fc81` +
+			`38642dc59e00003ed8","bd646e312ff574bc90e08ed91f1d99a85b318cb` +
+			`4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b14b627acce606e6d652` +
+			`915bdb71dcf5351e8ad6128faab9e0100000000000000000000000000000` +
+			`03e133920204e00000000000029000000a6030000954cee5d00000000","` +
+			`00000000",[],"07000000","3e133920","954cee5d",true]}`,
+	},
+	{
+		Miner:  WhatsminerD1,
+		Method: Submit,
+		Type:   RequestMessage,
+		Frame: `{"id":3,"method":"mining.submit","params":["rig0","000003a61` +
+			`5f3d1b9c6e0a400","0000002a6f3c9a01","5dee4c95","0002df6d"]}`,
+	},
+	{
+		Miner:  WhatsminerD1,
+		Method: Submit,
+		Type:   ResponseMessage,
+		Frame:  `{"id":3,"error":null,"result":true}`,
+	},
+}
+
+// fixtureMiners represents the miners covered by the stratum fixtures.
+var fixtureMiners = []string{CPU, InnosiliconD9, AntminerDR3, AntminerDR5,
+	WhatsminerD1}
+
+// fixtureFrames represents the frames of a mining session, each supported
+// miner has a fixture for every frame.
+var fixtureFrames = []struct {
+	method string
+	mType  int
+}{
+	{Subscribe, RequestMessage},
+	{Subscribe, ResponseMessage},
+	{Authorize, RequestMessage},
+	{Authorize, ResponseMessage},
+	{SetDifficulty, NotificationMessage},
+	{Notify, NotificationMessage},
+	{Submit, RequestMessage},
+	{Submit, ResponseMessage},
+}
+
+// fixtureMessage creates the message of the provided fixture using the
+// constructors of the pool.
+func fixtureMessage(f *StratumFixture, in *stratumFixtureInputs) (Message, error) {
+	switch {
+	case f.Method == Subscribe && f.Type == RequestMessage:
+		id := uint64(fixtureSubscribeID)
+		return SubscribeRequest(&id, in.userAgent, in.version, ""), nil
+
+	case f.Method == Subscribe && f.Type == ResponseMessage:
+		return minerSubscribeResponse(f.Miner, fixtureSubscribeID,
+			fixtureNotifyID, fixtureExtraNonce1,
+			int(in.extraNonce2Size)), nil
+
+	case f.Method == Authorize && f.Type == RequestMessage:
+		id := uint64(fixtureAuthorizeID)
+		return AuthorizeRequest(&id, fixtureWorker, fixtureAddress), nil
+
+	case f.Method == Authorize && f.Type == ResponseMessage:
+		return AuthorizeResponse(fixtureAuthorizeID, true, nil), nil
+
+	case f.Method == SetDifficulty && f.Type == NotificationMessage:
+		return SetDifficultyNotification(big.NewRat(fixtureDifficulty, 1)),
+			nil
+
+	case f.Method == Notify && f.Type == NotificationMessage:
+		workE := fixtureWorkE
+		notif := WorkNotification(fixtureJobID, workE[8:72], workE[72:288],
+			workE[352:360], workE[:8], workE[232:240], workE[272:280], true)
+		return formatWorkNotification(f.Miner, notif)
+
+	case f.Method == Submit && f.Type == RequestMessage:
+		id := uint64(fixtureSubmitID)
+		return SubmitWorkRequest(&id, fixtureWorker, fixtureJobID,
+			in.extraNonce2, in.nTime, in.nonce), nil
+
+	case f.Method == Submit && f.Type == ResponseMessage:
+		return SubmitWorkResponse(fixtureSubmitID, true, nil), nil
+
+	default:
+		return nil, fmt.Errorf("no %s frame of message type %d", f.Method,
+			f.Type)
+	}
+}
+
+// parseFixture resolves the provided fixture message using the parsers of
+// the pool and ensures its components match the fixture inputs.
+func parseFixture(f *StratumFixture, in *stratumFixtureInputs, msg Message) error {
+	switch f.Type {
+	case ResponseMessage:
+		resp := msg.(*Response)
+		var status bool
+		var sErr *StratumError
+		var err error
+		switch f.Method {
+		case Subscribe:
+			diffID, notifyID, extraNonce1, extraNonce2Size, err :=
+				ParseSubscribeResponse(resp)
+			if err != nil {
+				return err
+			}
+			if diffID != fixtureNotifyID || notifyID != fixtureNotifyID ||
+				extraNonce1 != in.extraNonce1 ||
+				extraNonce2Size != in.extraNonce2Size {
+				return fmt.Errorf("unexpected subscription %s, %s, %s, %d",
+					diffID, notifyID, extraNonce1, extraNonce2Size)
+			}
+			return nil
+
+		case Authorize:
+			status, sErr, err = ParseAuthorizeResponse(resp)
+
+		case Submit:
+			status, sErr, err = ParseSubmitWorkResponse(resp)
+		}
+		if err != nil {
+			return err
+		}
+		if !status || sErr != nil {
+			return fmt.Errorf("unexpected status %v, %v", status, sErr)
+		}
+		return nil
+	}
+
+	req := msg.(*Request)
+	switch f.Method {
+	case Subscribe:
+		userAgent, notifyID, extraNonce2Size, err := ParseSubscribeRequest(req)
+		if err != nil {
+			return err
+		}
+		if userAgent != in.userAgent+"/"+in.version || notifyID != "" ||
+			extraNonce2Size != 0 {
+			return fmt.Errorf("unexpected user agent %s, notify id %s and "+
+				"extraNonce2 size %d", userAgent, notifyID, extraNonce2Size)
+		}
+
+	case Authorize:
+		username, password, err := ParseAuthorizeRequest(req)
+		if err != nil {
+			return err
+		}
+		if username != fixtureAddress+"."+fixtureWorker || password != "" {
+			return fmt.Errorf("unexpected username %s and password %s",
+				username, password)
+		}
+
+	case SetDifficulty:
+		difficulty, err := ParseSetDifficultyNotification(req)
+		if err != nil {
+			return err
+		}
+		if difficulty != fixtureDifficulty {
+			return fmt.Errorf("unexpected difficulty %d", difficulty)
+		}
+
+	case Notify:
+		jobID, prevBlock, _, _, _, _, _, cleanJob, err :=
+			ParseWorkNotification(req)
+		if err != nil {
+			return err
+		}
+		if jobID != fixtureJobID || len(prevBlock) != 64 || !cleanJob {
+			return fmt.Errorf("unexpected job %s, previous block %s and "+
+				"clean job %v", jobID, prevBlock, cleanJob)
+		}
+
+		// Ensure the header reassembled from the notification is the
+		// fixture work header.
+		err = validateWorkNotification(f.Miner, fixtureWorkE, req)
+		if err != nil {
+			return err
+		}
+
+	case Submit:
+		worker, jobID, extraNonce2, nTime, nonce, err :=
+			ParseSubmitWorkRequest(req, f.Miner, int(in.extraNonce2Size))
+		if err != nil {
+			return err
+		}
+		if worker != fixtureWorker || jobID != fixtureJobID {
+			return fmt.Errorf("unexpected worker %s and job %s", worker,
+				jobID)
+		}
+
+		// Ensure the submission solves the fixture header with the
+		// expected nonce and timestamp.
+		header, err := GenerateSolvedBlockHeader(fixtureWorkE,
+			fixtureExtraNonce1, extraNonce2, int(in.extraNonce2Size), nTime,
+			nonce, f.Miner)
+		if err != nil {
+			return err
+		}
+		if header.Nonce != fixtureNonce ||
+			header.Timestamp.Unix() != fixtureTime {
+			return fmt.Errorf("unexpected solved header nonce %x and "+
+				"timestamp %x", header.Nonce, header.Timestamp.Unix())
+		}
+	}
+	return nil
+}
+
+// verifyStratumFixture replays the provided fixture through the
+// constructors and parsers of the pool.
+func verifyStratumFixture(f *StratumFixture) error {
+	in, ok := fixtureInputs[f.Miner]
+	if !ok {
+		return fmt.Errorf("unknown miner %s", f.Miner)
+	}
+
+	// Ensure the pool constructs the exact frame.
+	want, err := fixtureMessage(f, in)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(want)
+	if err != nil {
+		return err
+	}
+	if string(data) != f.Frame {
+		return fmt.Errorf("constructed frame %s does not match the fixture",
+			data)
+	}
+
+	// Ensure the pool identifies and parses the frame.
+	msg, mType, err := IdentifyMessage([]byte(f.Frame))
+	if err != nil {
+		return err
+	}
+	if mType != f.Type {
+		return fmt.Errorf("identified as message type %d, expected %d",
+			mType, f.Type)
+	}
+	return parseFixture(f, in, msg)
+}
+
+// VerifyStratumFixtures replays the provided fixtures through the
+// constructors and parsers of the pool, returning an error describing the
+// first fixture not matching the wire format of the pool. Every frame of a
+// mining session must be covered for each supported miner.
+func VerifyStratumFixtures(fixtures []*StratumFixture) error {
+	type frame struct {
+		miner  string
+		method string
+		mType  int
+	}
+	covered := make(map[frame]bool, len(fixtures))
+	for _, f := range fixtures {
+		err := verifyStratumFixture(f)
+		if err != nil {
+			return fmt.Errorf("%s %s fixture of message type %d: %v",
+				f.Miner, f.Method, f.Type, err)
+		}
+		covered[frame{f.Miner, f.Method, f.Type}] = true
+	}
+	for _, miner := range fixtureMiners {
+		for _, ff := range fixtureFrames {
+			if !covered[frame{miner, ff.method, ff.mType}] {
+				return fmt.Errorf("no %s %s fixture of message type %d",
+					miner, ff.method, ff.mType)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package pool
+
+import (
+	"strings"
+	"testing"
+)
+
+func testStratumFixtures(t *testing.T) {
+	// Ensure the golden frames match the wire format of the pool.
+	err := VerifyStratumFixtures(StratumFixtures)
+	if err != nil {
+		t.Fatalf("[VerifyStratumFixtures] unexpected error: %v", err)
+	}
+
+	// Ensure altered frames, missing frames and unknown miners are
+	// reported.
+	altered := make([]*StratumFixture, 0, len(StratumFixtures))
+	for _, f := range StratumFixtures {
+		fixture := *f
+		if fixture.Miner == AntminerDR3 && fixture.Method == Subscribe &&
+			fixture.Type == ResponseMessage {
+			fixture.Frame = strings.Replace(fixture.Frame, ",8]", ",4]", 1)
+		}
+		altered = append(altered, &fixture)
+	}
+	err = VerifyStratumFixtures(altered)
+	if err == nil || !strings.Contains(err.Error(), AntminerDR3) {
+		t.Fatalf("expected an altered %s frame error, got %v", AntminerDR3,
+			err)
+	}
+	err = VerifyStratumFixtures(StratumFixtures[1:])
+	if err == nil || !strings.Contains(err.Error(), "no cpu mining.subscribe") {
+		t.Fatalf("expected a missing frame error, got %v", err)
+	}
+	unknown := *StratumFixtures[0]
+	unknown.Miner = "unknown"
+	err = VerifyStratumFixtures([]*StratumFixture{&unknown})
+	if err == nil || !strings.Contains(err.Error(), "unknown miner") {
+		t.Fatalf("expected an unknown miner error, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+)
+
+// Health components.
+const (
+	HealthDaemon     = "daemon"
+	HealthWallet     = "wallet"
+	HealthDB         = "db"
+	HealthEndpoints  = "endpoints"
+	HealthWork       = "work"
+	HealthChainState = "chainstate"
+	HealthPayments   = "payments"
+	HealthTargets    = "targets"
+)
+
+var (
+	// maxWorkAge is the period after which the pool's current work is
+	// considered outdated if no work update was received.
+	maxWorkAge = time.Minute * 20
+
+	// walletPingTimeout is the timeout for wallet health checks.
+	walletPingTimeout = time.Second * 5
+
+	// healthK is the key of the record written and deleted by database
+	// health checks.
+	healthK = []byte("healthcheck")
+)
+
+// ComponentStatus represents the last success and last error of a pool
+// component, timestamps are in nanoseconds.
+type ComponentStatus struct {
+	LastSuccess int64
+	LastError   string
+	LastErrorOn int64
+}
+
+// failing asserts the last recorded outcome of the component is an error.
+func (s *ComponentStatus) failing() bool {
+	return s.LastErrorOn > s.LastSuccess
+}
+
+// statusRecorder records the outcomes of a pool component.
+type statusRecorder struct {
+	status ComponentStatus
+	mtx    sync.RWMutex
+}
+
+// recordSuccess records a successful operation of the component.
+func (r *statusRecorder) recordSuccess() {
+	r.mtx.Lock()
+	r.status.LastSuccess = time.Now().UnixNano()
+	r.mtx.Unlock()
+}
+
+// recordError records a failed operation of the component.
+func (r *statusRecorder) recordError(err error) {
+	r.mtx.Lock()
+	r.status.LastError = err.Error()
+	r.status.LastErrorOn = time.Now().UnixNano()
+	r.mtx.Unlock()
+}
+
+// fetchStatus returns a copy of the recorded component status.
+func (r *statusRecorder) fetchStatus() *ComponentStatus {
+	r.mtx.RLock()
+	status := r.status
+	r.mtx.RUnlock()
+	return &status
+}
+
+// validateHealthComponents ensures the provided health components are known.
+func validateHealthComponents(components []string) error {
+	for _, component := range components {
+		switch component {
+		case HealthDaemon, HealthWallet, HealthDB, HealthEndpoints,
+			HealthWork, HealthChainState, HealthPayments, HealthTargets:
+		default:
+			return fmt.Errorf("unknown health component: %s", component)
+		}
+	}
+	return nil
+}
+
+// DaemonHealth represents the state of the consensus daemon connection.
+type DaemonHealth struct {
+	Reachable bool
+	Synced    bool
+	TipHeight int64
+	TipAge    time.Duration
+	Error     string
+}
+
+// WalletHealth represents the state of the wallet connection.
+type WalletHealth struct {
+	Reachable bool
+	Error     string
+}
+
+// ListenerHealth represents the state of a listener of a miner endpoint.
+type ListenerHealth struct {
+	Addr      string
+	Listening bool
+}
+
+// EndpointHealth represents the state of a miner endpoint, it is listening
+// when all of its listeners are. Paused endpoints keep their clients
+// connected without notifying them of work.
+type EndpointHealth struct {
+	Miner     string
+	Port      uint32
+	Listening bool
+	Paused    bool
+	Clients   uint32
+	Listeners []*ListenerHealth
+	// Accepted represents the connections accepted by the endpoint since
+	// the pool started, Failures its connection failures keyed by cause.
+	Accepted uint64
+	Failures map[string]uint64
+}
+
+// HealthStatus represents the readiness of the pool. The pool is healthy
+// when none of its critical components are failing and it is not shutting
+// down. The wallet and payment components are not reported in solo pool
+// mode.
+type HealthStatus struct {
+	Healthy        bool
+	Failing        []string
+	Daemon         *DaemonHealth
+	Wallet         *WalletHealth
+	DBWritable     bool
+	DBError        string
+	Endpoints      []*EndpointHealth
+	LastWorkUpdate int64
+	ChainState     *ComponentStatus
+	Payments       *ComponentStatus
+	// WorkIntegrity represents the outcome of validating work
+	// notifications against their block templates, a failing check means
+	// miners were not notified of the current work.
+	WorkIntegrity *ComponentStatus
+	// PoolTargets represents the outcome of validating the pool targets
+	// of every miner type and endpoint against the network target of the
+	// current block template, a failing check means blocks solved by
+	// miners can be rejected as low difficulty shares.
+	PoolTargets *ComponentStatus
+	// PaymentDeferral represents the payment cycle deferred for an
+	// insufficient wallet balance, nil if there is none.
+	PaymentDeferral *PaymentDeferral
+	// QuarantinedPayments represents the number of pending payments
+	// requiring attention before they can be paid out.
+	QuarantinedPayments uint32
+	// EndpointsPaused represents if the miner endpoints are paused
+	// pool-wide, paused endpoints are not failing.
+	EndpointsPaused bool
+	// Shutdown represents the shutdown phase of the pool.
+	Shutdown *ShutdownStatus
+}
+
+// checkDaemon reports the reachability and sync state of the consensus
+// daemon.
+func (h *Hub) checkDaemon() *DaemonHealth {
+	health := new(DaemonHealth)
+	if h.chain == nil {
+		health.Error = "not connected"
+		return health
+	}
+	info, err := h.chain.GetBlockChainInfo()
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Reachable = true
+	health.Synced = !info.InitialBlockDownload
+	health.TipHeight = info.Blocks
+	hash, err := chainhash.NewHashFromStr(info.BestBlockHash)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	header, err := h.chain.GetBlockHeader(hash)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.TipAge = time.Since(header.Timestamp)
+	return health
+}
+
+// checkWallet reports the reachability of the wallet.
+func (h *Hub) checkWallet() *WalletHealth {
+	health := new(WalletHealth)
+	if h.wallet == nil {
+		health.Error = "not connected"
+		return health
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), walletPingTimeout)
+	defer cancel()
+	err := h.wallet.Ping(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Reachable = true
+	return health
+}
+
+// checkDB asserts the database is writable by writing and deleting a
+// record in a test transaction.
+func (h *Hub) checkDB() error {
+	if h.db.IsReadOnly() {
+		return fmt.Errorf("database is read-only")
+	}
+	return h.db.Update(func(tx *bolt.Tx) error {
+		pbkt := tx.Bucket(poolBkt)
+		if pbkt == nil {
+			desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+			return MakeError(ErrBucketNotFound, desc, nil)
+		}
+		err := pbkt.Put(healthK, []byte{1})
+		if err != nil {
+			return err
+		}
+		return pbkt.Delete(healthK)
+	})
+}
+
+// HealthStatus returns the readiness of the pool and the state of its
+// components.
+func (h *Hub) HealthStatus() *HealthStatus {
+	status := &HealthStatus{
+		Daemon:          h.checkDaemon(),
+		Endpoints:       make([]*EndpointHealth, 0, len(h.endpoints)),
+		EndpointsPaused: h.EndpointsPaused(),
+		LastWorkUpdate:  h.chainState.fetchLastWorkUpdate(),
+		ChainState:      h.chainState.status.fetchStatus(),
+		WorkIntegrity:   h.workStatus.fetchStatus(),
+		PoolTargets:     h.targetStatus.fetchStatus(),
+		Shutdown:        h.FetchShutdownStatus(),
+	}
+	err := h.checkDB()
+	if err != nil {
+		status.DBError = err.Error()
+	}
+	status.DBWritable = err == nil
+	// Endpoint capacity and churn are both listed in endpoint order.
+	churn := h.FetchEndpointChurn()
+	for i, capacity := range h.FetchEndpointCapacity() {
+		endpoint := &EndpointHealth{
+			Miner:     capacity.Miner,
+			Port:      capacity.Port,
+			Listening: !capacity.Degraded,
+			Paused:    capacity.Paused,
+			Clients:   capacity.Clients,
+			Listeners: make([]*ListenerHealth, 0, len(capacity.Listeners)),
+			Accepted:  churn[i].Accepted,
+			Failures:  churn[i].Failures,
+		}
+		for _, l := range capacity.Listeners {
+			endpoint.Listeners = append(endpoint.Listeners, &ListenerHealth{
+				Addr:      l.Addr,
+				Listening: !l.Degraded,
+			})
+		}
+		status.Endpoints = append(status.Endpoints, endpoint)
+	}
+
+	failing := map[string]bool{
+		HealthDaemon:     !status.Daemon.Reachable || !status.Daemon.Synced,
+		HealthDB:         !status.DBWritable,
+		HealthChainState: status.ChainState.failing(),
+		HealthWork: status.LastWorkUpdate == 0 ||
+			time.Since(time.Unix(0, status.LastWorkUpdate)) > maxWorkAge ||
+			status.WorkIntegrity.failing(),
+		HealthTargets: status.PoolTargets.failing(),
+	}
+	for _, endpoint := range status.Endpoints {
+		if !endpoint.Listening {
+			failing[HealthEndpoints] = true
+		}
+	}
+	if !h.cfg.SoloPool {
+		status.Wallet = h.checkWallet()
+		status.Payments = h.paymentMgr.status.fetchStatus()
+		status.PaymentDeferral = h.paymentMgr.fetchPaymentDeferral()
+		quarantined, err := fetchQuarantinedPayments(h.db, "")
+		if err != nil {
+			log.Errorf("unable to fetch quarantined payments: %v", err)
+		}
+		status.QuarantinedPayments = uint32(len(quarantined))
+		failure := h.paymentMgr.fetchDispatchFailure()
+		failing[HealthWallet] = !status.Wallet.Reachable
+		failing[HealthPayments] = status.Payments.failing() ||
+			(failure != nil && failure.RequiresAttention) ||
+			status.PaymentDeferral != nil || len(quarantined) > 0
+	}
+
+	status.Healthy = status.Shutdown.Phase == ShutdownRunning
+	for _, component := range h.cfg.HealthCritical {
+		if failing[component] {
+			status.Healthy = false
+			status.Failing = append(status.Failing, component)
+		}
+	}
+	return status
+}
@@ -11,21 +11,24 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/big"
+	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/blockchain/standalone"
 	"github.com/Eacred/eacrd/chaincfg/chainhash"
 	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrjson"
 	"github.com/Eacred/eacrd/dcrutil"
+	chainjson "github.com/Eacred/eacrd/rpc/jsonrpc/types"
 	"github.com/Eacred/eacrd/rpcclient"
 	"github.com/Eacred/eacrd/wire"
-	"github.com/Eacred/eacrwallet/rpc/walletrpc"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -51,6 +54,13 @@ const (
 	NewParent = "newparent"
 	NewVotes  = "newvotes"
 	NewTxns   = "newtxns"
+
+	// Block submission reject categories.
+	RejectStale     = "stale"
+	RejectTimestamp = "timestamp"
+	RejectDuplicate = "duplicate"
+	RejectInvalid   = "invalid"
+	RejectUnknown   = "unknown"
 )
 
 var (
@@ -59,52 +69,243 @@ var (
 	// high value to reduce the number of round trips to the pool by connected
 	// pool clients since pool shares are a non factor in solo pool mode.
 	soloMaxGenTime = new(big.Int).SetInt64(28)
+
+	// recentSharePeriod is the period over which recent account shares are
+	// summarized for account dashboards and the leaderboard.
+	recentSharePeriod = time.Hour
 )
 
+// EndpointSpec describes an additional miner endpoint whose clients are
+// assigned the miner's difficulty scaled by a multiplier.
+type EndpointSpec struct {
+	Miner          string
+	Port           uint32
+	DiffMultiplier float64
+}
+
+// ChainClient represents the consensus daemon client of the hub. It is
+// satisfied by the daemon's RPC client.
+type ChainClient interface {
+	GetWork() (*chainjson.GetWorkResult, error)
+	GetWorkSubmit(data string) (bool, error)
+	GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock, error)
+	GetBestBlock() (*chainhash.Hash, int64, error)
+	GetBlockHash(height int64) (*chainhash.Hash, error)
+	GetBlockHeader(hash *chainhash.Hash) (*wire.BlockHeader, error)
+	GetBlockChainInfo() (*chainjson.GetBlockChainInfoResult, error)
+}
+
 // HubConfig represents configuration details for the hub.
 type HubConfig struct {
-	ActiveNet             *chaincfg.Params
-	DB                    *bolt.DB
-	DcrdRPCCfg            *rpcclient.ConnConfig
-	PoolFee               float64
-	MaxTxFeeReserve       dcrutil.Amount
-	MaxGenTime            uint64
-	WalletRPCCertFile     string
-	WalletGRPCHost        string
-	PaymentMethod         string
-	LastNPeriod           uint32
-	WalletPass            string
-	MinPayment            dcrutil.Amount
-	SoloPool              bool
-	PoolFeeAddrs          []dcrutil.Address
-	BackupPass            string
-	Secret                string
-	NonceIterations       float64
-	MinerPorts            map[string]uint32
+	ActiveNet  *chaincfg.Params
+	DB         *bolt.DB
+	DcrdRPCCfg *rpcclient.ConnConfig
+	// ChainClient represents the consensus daemon client used instead of
+	// dialing DcrdRPCCfg. Chain notifications of a provided client are
+	// delivered through the hub's Handle* methods.
+	ChainClient ChainClient
+	// Wallet represents the wallet used instead of dialing the wallet's
+	// gRPC server. It is unused by solo pools.
+	Wallet              Wallet
+	PoolFee             float64
+	MaxTxFeeReserve     dcrutil.Amount
+	MaxPaymentOutputs   uint32
+	MaxPaymentTxSize    uint32
+	MaxPaymentRetries   uint32
+	PaymentRetryBackoff time.Duration
+	// BalanceRetryInterval represents the delay before the wallet balance
+	// of a payment cycle deferred for insufficient funds is checked again.
+	BalanceRetryInterval time.Duration
+	MaxGenTime           uint64
+	// MaxShareRate represents the maximum number of shares per second a
+	// client is expected to submit, pool difficulties are not set below
+	// the floor it implies for each miner type. Zero uses the default.
+	MaxShareRate      float64
+	WalletRPCCertFile string
+	WalletGRPCHost    string
+	PaymentMethod     string
+	LastNPeriod       uint32
+	WalletPass        string
+	MinPayment        dcrutil.Amount
+	SoloPool          bool
+	PoolFeeAddrs      []dcrutil.Address
+	DonationAddr      dcrutil.Address
+	BackupPass        string
+	Secret            string
+	NonceIterations   float64
+	MinerPorts        map[string]uint32
+	// ListenAddrs represents the listen addresses of miner endpoints,
+	// keyed by endpoint port. Endpoints without listen addresses listen on
+	// all IPv4 interfaces on their port.
+	ListenAddrs           map[uint32][]string
+	MinerPolicies         map[string]string
+	ExtraEndpoints        []*EndpointSpec
 	MaxConnectionsPerHost uint32
+	MaxEndpointClients    uint32
+	MinNotifyInterval     time.Duration
+	InitialWorkDelay      time.Duration
+	KeepAlivePeriod       time.Duration
+	WriteTimeout          time.Duration
+	MaxReadSize           uint32
+	MaxWriteSize          uint32
+	MaxInFlight           uint32
+	// InstanceID and InstanceBits partition the extraNonce1 space between
+	// pool instances sharing an address, the instance id occupies the
+	// leading InstanceBits bits of every extraNonce1 assigned.
+	InstanceID   uint32
+	InstanceBits uint32
+	// MaxWorkerNameLength represents the maximum length of worker names,
+	// zero for the default. StrictWorkerNames refuses authorizations with
+	// worker names containing disallowed characters or exceeding the
+	// length instead of sanitizing them.
+	MaxWorkerNameLength uint32
+	StrictWorkerNames   bool
+	// FastPath enables the share validation fast path for trusted clients,
+	// SpotCheckRate represents the fraction of their shares still fully
+	// validated.
+	FastPath      bool
+	SpotCheckRate float64
+	// MaxClockSkew represents the median difference between the timestamps
+	// of a client's shares and the pool's clock beyond which its miner is
+	// advised to synchronize its clock, zero disables the advice.
+	MaxClockSkew time.Duration
+	// AuthorizeLimit, SubscribeLimit and SubmitLimit represent the request
+	// rates, per second, of the request classes of pool clients, zero for
+	// the default rate. The submission limit of a client scales with its
+	// expected share rate.
+	AuthorizeLimit      float64
+	SubscribeLimit      float64
+	SubmitLimit         float64
+	StaleJobWindow      uint32
+	StaleGracePeriod    time.Duration
+	LatencyMetrics      bool
+	SlowSubmitThreshold time.Duration
+	WebhookURLs         []string
+	WebhookEvents       []string
+	WebhookSecret       string
+	WorkerOfflinePeriod time.Duration
+	// WorkerRetention represents the period after which workers no longer
+	// seen are pruned, zero to keep all workers.
+	WorkerRetention time.Duration
+	StatsInterval   time.Duration
+	// ResyncInterval represents the period between resynchronizations of
+	// the chain state with the consensus daemon, zero disables periodic
+	// resynchronization.
+	ResyncInterval time.Duration
+	// AuthTokenLifetime represents the period authorization tokens of
+	// locked accounts remain valid for.
+	AuthTokenLifetime time.Duration
+	// MaxAuthFailures represents the number of failed authorizations of
+	// locked accounts within an hour after which a host is banned, zero
+	// for no limit.
+	MaxAuthFailures uint32
+	// AuthFailureBan represents the duration hosts exceeding the failed
+	// authorization limit are banned for.
+	AuthFailureBan time.Duration
+	// MaxJobs represents the maximum number of jobs retained in the
+	// database, zero to retain jobs until they are pruned by height.
+	MaxJobs uint32
+	// SelfServeSettings enables the set option stratum extension, letting
+	// miners of locked accounts change their account options.
+	SelfServeSettings bool
+	// HealthCritical represents the components whose failure renders the
+	// pool unhealthy.
+	HealthCritical []string
+	// Reporting indicates the hub only serves queries from a read-only
+	// database. Reporting hubs do not connect to the consensus daemon or
+	// the wallet and do not accept miner connections.
+	Reporting bool
+	// ShareLogFile represents the file accepted and rejected shares are
+	// appended to, empty disables share logging.
+	ShareLogFile         string
+	ShareLogMaxSize      int64
+	ShareLogMaxRolls     int
+	ShareLogSync         string
+	ShareLogSyncInterval time.Duration
+	// PaymentDryRun indicates payment cycles are planned and recorded
+	// without being dispatched.
+	PaymentDryRun bool
+	// ConnAuditRetention represents the period audit records of
+	// client connections are kept for, zero disables the connection
+	// audit log.
+	ConnAuditRetention time.Duration
+	// MaintenanceSchedule represents the scheduled maintenance windows
+	// the miner endpoints are paused for.
+	MaintenanceSchedule []*MaintenanceEntry
+	// MaintenanceMessage represents the message miners are sent when
+	// maintenance starts, a message describing the window is sent if it
+	// is empty.
+	MaintenanceMessage string
+	// MaintenanceWarning represents the period before a maintenance
+	// window miners are warned of it, zero disables warnings.
+	MaintenanceWarning time.Duration
+	// MaintenanceBackup indicates a compacted database backup is taken at
+	// the start of every maintenance window.
+	MaintenanceBackup bool
+	// CaptureDir represents the directory client trace captures are
+	// written to, empty keeps captures in memory only.
+	CaptureDir string
+	// CaptureDuration represents the period a client trace capture runs
+	// for before it is disabled.
+	CaptureDuration time.Duration
+	// CaptureMaxSize represents the number of frame bytes a client trace
+	// capture records before it is disabled.
+	CaptureMaxSize int64
 }
 
 // Hub maintains the set of active clients and facilitates message broadcasting
 // to all active clients.
 type Hub struct {
-	clients int32 // update atomically.
+	clients int32  // update atomically.
+	paused  uint32 // update atomically.
 
 	db             *bolt.DB
 	cfg            *HubConfig
 	limiter        *RateLimiter
+	chain          ChainClient
 	rpcc           *rpcclient.Client
-	gConn          *grpc.ClientConn
-	grpc           walletrpc.WalletServiceClient
-	grpcMtx        sync.Mutex
+	wallet         Wallet
 	poolDiffs      *DifficultySet
+	poolDiffsMtx   sync.RWMutex
+	subsidyCache   *standalone.SubsidyCache
 	paymentMgr     *PaymentMgr
 	chainState     *ChainState
+	notifier       *Notifier
+	shareLog       *ShareLog
+	connAudit      *ConnectionAudit
+	maintenance    *MaintenanceScheduler
+	workerMonitor  *WorkerMonitor
+	minerStats     *MinerStatsTracker
+	digests        *DigestGenerator
+	statsRecorder  *StatsRecorder
 	connections    map[string]uint32
 	connectionsMtx sync.RWMutex
+	bans           *banList
+	authFailures   map[string]*authFailures
+	authFailMtx    sync.Mutex
+	rejects        map[string]uint32
+	rejectsMtx     sync.RWMutex
+	traced         map[string]struct{}
+	captures       *CaptureSet
+	sessions       *SessionStore
+	challenges     *usedChallenges
+	workerNames    *DefaultWorkerNames
+	jobCache       *JobCache
+	jobs           *JobRetainer
+	workStatus     statusRecorder
+	targetStatus   statusRecorder
+	authRejects    *AuthRejectCache
+	submitLatency  *LatencyRecorder
+	events         *EventBus
+	targets        *MinerTargets
+	targetsMtx     sync.RWMutex
+	tracedMtx      sync.RWMutex
 	cancel         context.CancelFunc
 	endpoints      []*Endpoint
+	registry       *clientRegistry
 	blake256Pad    []byte
 	wg             *sync.WaitGroup
+	phases         shutdownTracker
 }
 
 // persistPoolMode saves the pool mode to the db.
@@ -126,63 +327,244 @@ func generateBlake256Pad() []byte {
 	return blake256Pad
 }
 
+// validateBlake256Pad asserts the provided padding extends a serialized
+// block header to the data length getwork expects, with the blake256
+// padding bits and the header length in bits in place. Submissions with
+// any other padding are rejected by the consensus daemon.
+func validateBlake256Pad(pad []byte) error {
+	wantLen := getworkDataLen - wire.MaxBlockHeaderPayload
+	if len(pad) != wantLen {
+		desc := fmt.Sprintf("blake256 padding of %d bytes does not extend "+
+			"a %d byte block header to the %d byte getwork data length",
+			len(pad), wire.MaxBlockHeaderPayload, getworkDataLen)
+		return MakeError(ErrWrongInputLength, desc, nil)
+	}
+	bits := binary.BigEndian.Uint64(pad[len(pad)-8:])
+	if pad[0] != 0x80 || pad[len(pad)-9]&0x01 == 0 ||
+		bits != wire.MaxBlockHeaderPayload*8 {
+		desc := fmt.Sprintf("blake256 padding %x does not pad a %d byte "+
+			"block header", pad, wire.MaxBlockHeaderPayload)
+		return MakeError(ErrWrongInputLength, desc, nil)
+	}
+	return nil
+}
+
+// newDifficultySet creates the pool difficulty set for the provided share
+// creation target time and maximum share rate. Solo pools use a fixed
+// target time.
+func (h *Hub) newDifficultySet(maxGenTime uint64, maxShareRate float64) (*DifficultySet, error) {
+	powLimit := new(big.Rat).SetInt(h.cfg.ActiveNet.PowLimit)
+	genTime := new(big.Int).SetUint64(maxGenTime)
+	if h.cfg.SoloPool {
+		genTime = soloMaxGenTime
+	}
+	return NewDifficultySet(h.cfg.ActiveNet, powLimit, genTime, maxShareRate)
+}
+
+// fetchPoolDiffs returns the current pool difficulty set.
+func (h *Hub) fetchPoolDiffs() *DifficultySet {
+	h.poolDiffsMtx.RLock()
+	defer h.poolDiffsMtx.RUnlock()
+	return h.poolDiffs
+}
+
 // NewHub initializes the mining pool hub.
 func NewHub(cancel context.CancelFunc, hcfg *HubConfig) (*Hub, error) {
 	h := &Hub{
-		cfg:         hcfg,
-		db:          hcfg.DB,
-		limiter:     NewRateLimiter(),
-		wg:          new(sync.WaitGroup),
-		connections: make(map[string]uint32),
-		cancel:      cancel,
+		cfg: hcfg,
+		db:  hcfg.DB,
+		limiter: NewRateLimiter(&RequestLimits{
+			Authorize: hcfg.AuthorizeLimit,
+			Subscribe: hcfg.SubscribeLimit,
+			Submit:    hcfg.SubmitLimit,
+		}),
+		wg:           new(sync.WaitGroup),
+		connections:  make(map[string]uint32),
+		bans:         newBanList(),
+		authFailures: make(map[string]*authFailures),
+		rejects:      make(map[string]uint32),
+		traced:       make(map[string]struct{}),
+		sessions:     NewSessionStore(),
+		challenges:   newUsedChallenges(),
+		workerNames:  NewDefaultWorkerNames(),
+		authRejects:  NewAuthRejectCache(),
+		events:       NewEventBus(),
+		registry:     newClientRegistry(),
+		cancel:       cancel,
+	}
+	h.captures = NewCaptureSet(&CaptureConfig{
+		Dir:      hcfg.CaptureDir,
+		Duration: hcfg.CaptureDuration,
+		MaxSize:  hcfg.CaptureMaxSize,
+	})
+	if hcfg.FastPath {
+		h.jobCache = NewJobCache(0)
 	}
 	h.blake256Pad = generateBlake256Pad()
-	powLimit := new(big.Rat).SetInt(h.cfg.ActiveNet.PowLimit)
-	maxGenTime := new(big.Int).SetUint64(h.cfg.MaxGenTime)
-	if h.cfg.SoloPool {
-		maxGenTime = soloMaxGenTime
+	err := validateHealthComponents(h.cfg.HealthCritical)
+	if err != nil {
+		return nil, err
 	}
-
-	var err error
-	h.poolDiffs, err = NewDifficultySet(h.cfg.ActiveNet, powLimit, maxGenTime)
+	err = validateBlake256Pad(h.blake256Pad)
+	if err != nil {
+		return nil, err
+	}
+	if !h.cfg.Reporting {
+		err = validateNonceIterations(h.cfg.NonceIterations)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = ValidateInstanceID(h.cfg.InstanceID, h.cfg.InstanceBits)
+	if err != nil {
+		return nil, err
+	}
+	h.subsidyCache = standalone.NewSubsidyCache(h.cfg.ActiveNet)
+	if h.cfg.LatencyMetrics {
+		h.submitLatency = NewLatencyRecorder(h.cfg.SlowSubmitThreshold)
+	}
+	h.poolDiffs, err = h.newDifficultySet(h.cfg.MaxGenTime,
+		h.cfg.MaxShareRate)
 	if err != nil {
 		return nil, err
 	}
 
 	pCfg := &PaymentMgrConfig{
-		DB:                 h.db,
-		ActiveNet:          h.cfg.ActiveNet,
-		PoolFee:            h.cfg.PoolFee,
-		LastNPeriod:        h.cfg.LastNPeriod,
-		SoloPool:           h.cfg.SoloPool,
-		PaymentMethod:      h.cfg.PaymentMethod,
-		MinPayment:         h.cfg.MinPayment,
-		PoolFeeAddrs:       h.cfg.PoolFeeAddrs,
-		MaxTxFeeReserve:    h.cfg.MaxTxFeeReserve,
-		PublishTransaction: h.PublishTransaction,
+		DB:                     h.db,
+		ActiveNet:              h.cfg.ActiveNet,
+		PoolFee:                h.cfg.PoolFee,
+		LastNPeriod:            h.cfg.LastNPeriod,
+		SoloPool:               h.cfg.SoloPool,
+		PaymentMethod:          h.cfg.PaymentMethod,
+		MinPayment:             h.cfg.MinPayment,
+		PoolFeeAddrs:           h.cfg.PoolFeeAddrs,
+		DonationAddr:           h.cfg.DonationAddr,
+		MaxTxFeeReserve:        h.cfg.MaxTxFeeReserve,
+		MaxPaymentOutputs:      h.cfg.MaxPaymentOutputs,
+		MaxPaymentTxSize:       h.cfg.MaxPaymentTxSize,
+		MaxPaymentRetries:      h.cfg.MaxPaymentRetries,
+		PaymentRetryBackoff:    h.cfg.PaymentRetryBackoff,
+		PublishTransaction:     h.PublishTransaction,
+		NotifyPaymentSent:      h.notifyPaymentSent,
+		BalanceRetryInterval:   h.cfg.BalanceRetryInterval,
+		NotifyPaymentsDeferred: h.notifyPaymentsDeferred,
+		DryRun:                 h.cfg.PaymentDryRun,
+		NotifyPaymentPlanned:   h.notifyPaymentPlanned,
+	}
+	if !h.cfg.SoloPool {
+		pCfg.FetchSpendableBalance = h.fetchSpendableBalance
 	}
 	h.paymentMgr, err = NewPaymentMgr(pCfg)
 	if err != nil {
 		return nil, err
 	}
 
+	h.jobs, err = NewJobRetainer(&JobRetainerConfig{
+		DB:         h.db,
+		MaxJobs:    h.cfg.MaxJobs,
+		HoldPeriod: readTimeout,
+		JobCache:   h.jobCache,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	sCfg := &ChainStateConfig{
 		DB:               h.db,
 		SoloPool:         h.cfg.SoloPool,
 		PayDividends:     h.paymentMgr.payDividends,
 		GeneratePayments: h.paymentMgr.generatePayments,
 		GetBlock:         h.getBlock,
+		WorkSubsidy:      h.workSubsidy,
+		NotifyBlockFound: h.notifyBlockFound,
+		GetBestBlock:     h.getBestBlock,
+		GetBlockHash:     h.getBlockHash,
+		GetBlockHeader:   h.getBlockHeader,
+		JobCache:         h.jobCache,
+		JobRetainer:      h.jobs,
+		RefreshWork:      h.refreshWork,
+		ResyncInterval:   h.cfg.ResyncInterval,
 		Cancel:           h.cancel,
 		HubWg:            h.wg,
 	}
 	h.chainState = NewChainState(sCfg)
 
+	wCfg := &WorkerMonitorConfig{
+		DB:                   h.db,
+		OfflinePeriod:        h.cfg.WorkerOfflinePeriod,
+		Retention:            h.cfg.WorkerRetention,
+		NotifyWorkerStatus:   h.notifyWorkerStatus,
+		ClientConnected:      h.clientConnected,
+		FetchWorkerHashRates: h.fetchWorkerHashRates,
+		Events:               h.events,
+		HubWg:                h.wg,
+	}
+	h.workerMonitor, err = NewWorkerMonitor(wCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mCfg := &MinerStatsTrackerConfig{
+		DB:     h.db,
+		Events: h.events,
+		HubWg:  h.wg,
+	}
+	h.minerStats, err = NewMinerStatsTracker(mCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	h.digests, err = NewDigestGenerator(&DigestGeneratorConfig{
+		DB:                    h.db,
+		FetchAccountHashRates: h.fetchAccountHashRates,
+		NotifyDigest:          h.notifyDigest,
+		Events:                h.events,
+		HubWg:                 h.wg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if h.cfg.StatsInterval > 0 {
+		rCfg := &StatsRecorderConfig{
+			DB:                     h.db,
+			Interval:               h.cfg.StatsInterval,
+			FetchPoolHashRate:      h.FetchPoolHashRate,
+			FetchNetworkDifficulty: h.fetchNetworkDifficulty,
+			FetchOnlineWorkers:     h.workerMonitor.fetchOnlineWorkers,
+			HubWg:                  h.wg,
+		}
+		h.statsRecorder = NewStatsRecorder(rCfg)
+	}
+
+	if len(h.cfg.WebhookURLs) > 0 {
+		nCfg := &NotifierConfig{
+			URLs:   h.cfg.WebhookURLs,
+			Events: h.cfg.WebhookEvents,
+			Secret: h.cfg.WebhookSecret,
+			HubWg:  h.wg,
+		}
+		h.notifier, err = NewNotifier(nCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if !h.cfg.SoloPool {
 		log.Infof("Payment method is %s.", strings.ToUpper(hcfg.PaymentMethod))
 	} else {
 		log.Infof("Solo pool mode active.")
 	}
 
+	if h.cfg.Reporting {
+		if !h.db.IsReadOnly() {
+			desc := "reporting mode requires a read-only database"
+			return nil, MakeError(ErrNotSupported, desc, nil)
+		}
+		log.Infof("Reporting mode active.")
+		return h, nil
+	}
+
 	err = h.db.Update(func(tx *bolt.Tx) error {
 		mode := uint32(0)
 		if h.cfg.SoloPool {
@@ -193,30 +575,155 @@ func NewHub(cancel context.CancelFunc, hcfg *HubConfig) (*Hub, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	loaded, err := h.bans.load(h.db, time.Now().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	if loaded > 0 {
+		log.Infof("Loaded %d ban(s).", loaded)
+	}
+
+	if h.cfg.ShareLogFile != "" {
+		sCfg := &ShareLogConfig{
+			Path:         h.cfg.ShareLogFile,
+			MaxSize:      h.cfg.ShareLogMaxSize,
+			MaxRolls:     h.cfg.ShareLogMaxRolls,
+			SyncPolicy:   h.cfg.ShareLogSync,
+			SyncInterval: h.cfg.ShareLogSyncInterval,
+			Events:       h.events,
+			HubWg:        h.wg,
+		}
+		h.shareLog, err = NewShareLog(sCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if h.cfg.ConnAuditRetention > 0 {
+		h.connAudit = NewConnectionAudit(&ConnectionAuditConfig{
+			DB:        h.db,
+			Retention: h.cfg.ConnAuditRetention,
+			Events:    h.events,
+			HubWg:     h.wg,
+		})
+	}
+
+	h.maintenance, err = NewMaintenanceScheduler(&MaintenanceSchedulerConfig{
+		DB:                h.db,
+		Entries:           h.cfg.MaintenanceSchedule,
+		Message:           h.cfg.MaintenanceMessage,
+		WarningLead:       h.cfg.MaintenanceWarning,
+		Backup:            h.cfg.MaintenanceBackup,
+		PauseEndpoints:    h.PauseEndpoints,
+		ResumeEndpoints:   h.ResumeEndpoints,
+		EndpointsPaused:   h.EndpointsPaused,
+		BroadcastMessage:  h.BroadcastMessage,
+		NotifyMaintenance: h.notifyMaintenance,
+		HubWg:             h.wg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the endpoints paused if the pool was restarted during a
+	// maintenance window.
+	h.maintenance.restore(time.Now())
 	return h, nil
 }
 
+// rejectCategory classifies the provided block submission reject reason.
+func rejectCategory(reason string) string {
+	reason = strings.ToLower(reason)
+	switch {
+	case strings.Contains(reason, "orphan"),
+		strings.Contains(reason, "stale"),
+		strings.Contains(reason, "previous block"):
+		return RejectStale
+	case strings.Contains(reason, "timestamp"):
+		return RejectTimestamp
+	case strings.Contains(reason, "duplicate"),
+		strings.Contains(reason, "already have"):
+		return RejectDuplicate
+	case strings.Contains(reason, "invalid"),
+		strings.Contains(reason, "malformed"):
+		return RejectInvalid
+	default:
+		return RejectUnknown
+	}
+}
+
+// recordReject counts a block submission rejected by the consensus daemon
+// for the provided reason.
+func (h *Hub) recordReject(reason string) {
+	category := rejectCategory(reason)
+	h.rejectsMtx.Lock()
+	h.rejects[category]++
+	h.rejectsMtx.Unlock()
+}
+
+// FetchRejectCounts returns the number of block submissions rejected by the
+// consensus daemon, keyed by reject category.
+func (h *Hub) FetchRejectCounts() map[string]uint32 {
+	h.rejectsMtx.RLock()
+	defer h.rejectsMtx.RUnlock()
+	rejects := make(map[string]uint32, len(h.rejects))
+	for category, count := range h.rejects {
+		rejects[category] = count
+	}
+	return rejects
+}
+
+// minerPolicy returns the policy applied to the provided miner type.
+func (h *Hub) minerPolicy(miner string) string {
+	if policy, ok := h.cfg.MinerPolicies[miner]; ok {
+		return policy
+	}
+	return defaultMinerPolicy(h.cfg.ActiveNet, miner)
+}
+
+// FetchMinerPolicies returns the policy applied to each supported miner
+// type, keyed by miner type.
+func (h *Hub) FetchMinerPolicies() map[string]string {
+	policies := make(map[string]string, len(minerHashes))
+	for miner := range minerHashes {
+		policies[miner] = h.minerPolicy(miner)
+	}
+	return policies
+}
+
 // submitWork sends solved block data to the consensus daemon for evaluation.
-func (h *Hub) submitWork(data *string) (bool, error) {
-	status, err := h.rpcc.GetWorkSubmit(*data)
+// The daemon's reason for rejecting the submission is returned when
+// provided, rejections are counted by reason category.
+func (h *Hub) submitWork(data *string) (bool, string, error) {
+	status, err := h.chain.GetWorkSubmit(*data)
 	if err != nil {
-		return false, err
+		rpcErr, ok := err.(*dcrjson.RPCError)
+		if !ok {
+			return false, "", err
+		}
+		h.recordReject(rpcErr.Message)
+		return false, rpcErr.Message, nil
+	}
+	if !status {
+		h.recordReject("")
 	}
-	return status, err
+	return status, "", nil
 }
 
 // getWork fetches available work from the consensus daemon.
 func (h *Hub) getWork() (string, string, error) {
-	work, err := h.rpcc.GetWork()
+	work, err := h.chain.GetWork()
 	if err != nil {
 		return "", "", err
 	}
 	return work.Data, work.Target, err
 }
 
-// WithinLimit returns if a client is within its request limits.
-func (h *Hub) WithinLimit(ip string, clientType int) bool {
-	return h.limiter.withinLimit(ip, clientType)
+// WithinLimit returns if a client is within its request limits of the
+// provided request class.
+func (h *Hub) WithinLimit(ip string, class int) bool {
+	return h.limiter.withinLimit(ip, class, 0)
 }
 
 // FetchLastWorkHeight returns the last work height of the pool.
@@ -234,15 +741,293 @@ func (h *Hub) AddPaymentRequest(addr string) error {
 	return h.paymentMgr.addPaymentRequest(addr)
 }
 
+// FetchPaymentFailure returns the failed payment dispatch awaiting a
+// retry or requiring attention, nil if there is none.
+func (h *Hub) FetchPaymentFailure() *DispatchFailure {
+	return h.paymentMgr.fetchDispatchFailure()
+}
+
+// FetchConnectionRecords returns the audit records of client connections
+// matching the provided query, most recently ended connection first.
+func (h *Hub) FetchConnectionRecords(q *ConnectionQuery) ([]*ConnectionRecord, error) {
+	return FetchConnectionRecords(h.db, q)
+}
+
+// FetchLostBlocks returns the block candidates which failed submission to
+// the consensus daemon, most recently lost candidate first.
+func (h *Hub) FetchLostBlocks() ([]*LostBlock, error) {
+	return FetchLostBlocks(h.db)
+}
+
+// FetchLatestPaymentPlan returns the most recent payment plan recorded by a
+// payment dry run.
+func (h *Hub) FetchLatestPaymentPlan() (*PaymentPlan, error) {
+	return FetchLatestPaymentPlan(h.db)
+}
+
+// FetchPaymentDeferral returns the payment cycle deferred for an
+// insufficient wallet balance, nil if there is none.
+func (h *Hub) FetchPaymentDeferral() *PaymentDeferral {
+	return h.paymentMgr.fetchPaymentDeferral()
+}
+
+// ResetPaymentFailure clears the failed payment dispatch and deferred
+// payment cycle states, pending payments are dispatched again on the next
+// connected block. An error is returned instead if the wallet's spendable
+// balance does not cover the pending payments.
+func (h *Hub) ResetPaymentFailure() error {
+	_, height, _ := h.chainState.fetchTip()
+	return h.paymentMgr.retryPayments(height)
+}
+
+// SubscribeEvents registers a subscriber of the hub's event bus with a
+// queue of the provided size for the provided event kinds, all events are
+// delivered if no kinds are provided. Events are dropped once the queue
+// is full.
+func (h *Hub) SubscribeEvents(queueSize int, kinds ...EventKind) *Subscription {
+	return h.events.Subscribe(queueSize, kinds...)
+}
+
+// UnsubscribeEvents cancels the provided event bus subscription.
+func (h *Hub) UnsubscribeEvents(sub *Subscription) {
+	h.events.Unsubscribe(sub)
+}
+
+// notifyBlockFound publishes a block found event for the provided confirmed
+// mined work.
+func (h *Hub) notifyBlockFound(work *AcceptedWork, reward dcrutil.Amount) {
+	data := &BlockFoundData{
+		Height:  work.Height,
+		Hash:    work.BlockHash,
+		Account: work.MinedBy,
+		Worker:  work.Worker,
+		Reward:  reward,
+	}
+	h.events.publish(&HubEvent{
+		Kind:    EventBlockFound,
+		Miner:   work.Miner,
+		Account: work.MinedBy,
+		Worker:  work.Worker,
+		Block:   data,
+	})
+	if h.notifier == nil {
+		return
+	}
+	h.notifier.publish(BlockFound, data)
+}
+
+// notifyBlockAccepted publishes a block accepted event for the provided
+// work submitted by the provided client and accepted by the network.
+func (h *Hub) notifyBlockAccepted(clientID string, work *AcceptedWork) {
+	data := &BlockFoundData{
+		Height:  work.Height,
+		Hash:    work.BlockHash,
+		Account: work.MinedBy,
+		Worker:  work.Worker,
+		Reward:  work.Reward,
+	}
+	h.events.publish(&HubEvent{
+		Kind:     EventBlockAccepted,
+		ClientID: clientID,
+		Miner:    work.Miner,
+		Account:  work.MinedBy,
+		Worker:   work.Worker,
+		Block:    data,
+	})
+	if h.notifier == nil {
+		return
+	}
+	h.notifier.publish(BlockAccepted, data)
+}
+
+// notifyBlockLost publishes a block lost event for the provided block
+// candidate which failed submission to the consensus daemon.
+func (h *Hub) notifyBlockLost(clientID string, lost *LostBlock) {
+	log.Errorf("Block candidate %s at height %d from %s lost: %s",
+		lost.BlockHash, lost.Height, lost.Account, lost.Reason)
+	h.events.publish(&HubEvent{
+		Kind:     EventBlockLost,
+		ClientID: clientID,
+		Miner:    lost.Miner,
+		Account:  lost.Account,
+		Worker:   lost.Worker,
+		Reason:   lost.Reason,
+		Lost:     lost,
+	})
+	if h.notifier == nil {
+		return
+	}
+	h.notifier.publish(BlockLost, lost)
+}
+
+// notifyPaymentSent publishes a payment sent event for the provided payment
+// transaction.
+func (h *Hub) notifyPaymentSent(txid string, total dcrutil.Amount, recipients uint32) {
+	data := &PaymentSentData{
+		TransactionID: txid,
+		Total:         total,
+		Recipients:    recipients,
+	}
+	h.events.publish(&HubEvent{
+		Kind:    EventPaymentDispatched,
+		Payment: data,
+	})
+	if h.notifier == nil {
+		return
+	}
+	h.notifier.publish(PaymentSent, data)
+}
+
+// notifyPaymentsDeferred publishes a payments deferred event for the
+// provided payment cycle deferral.
+func (h *Hub) notifyPaymentsDeferred(deferral *PaymentDeferral) {
+	h.events.publish(&HubEvent{
+		Kind:     EventPaymentsDeferred,
+		Deferral: deferral,
+	})
+	if h.notifier == nil {
+		return
+	}
+	h.notifier.publish(PaymentsDeferred, deferral)
+}
+
+// notifyPaymentPlanned publishes a payment planned event for the provided
+// payment plan.
+func (h *Hub) notifyPaymentPlanned(plan *PaymentPlan) {
+	h.events.publish(&HubEvent{
+		Kind: EventPaymentPlanned,
+		Plan: plan,
+	})
+}
+
+// notifyAccountCollision alerts the pool operator of the provided address
+// refused for deriving the account id of another address.
+func (h *Hub) notifyAccountCollision(collision *AccountCollision) {
+	log.Errorf("Address %s refused, it derives account id %s of "+
+		"address %s", collision.Address, collision.Account,
+		collision.ExistingAddress)
+	if h.notifier == nil {
+		return
+	}
+	h.notifier.publish(AccountIDCollision, collision)
+}
+
+// notifyDigest publishes an account digest event for the provided
+// activity digest.
+func (h *Hub) notifyDigest(digest *ActivityDigest) {
+	if h.notifier == nil {
+		return
+	}
+	h.notifier.publish(AccountDigest, digest)
+}
+
+// notifyWorkerStatus publishes a worker offline or recovery event for the
+// provided worker.
+func (h *Hub) notifyWorkerStatus(worker *WorkerState) {
+	h.digests.recordWorkerStatus(worker)
+	if h.notifier == nil {
+		return
+	}
+	event := WorkerOnline
+	if worker.Offline {
+		event = WorkerOffline
+	}
+	h.notifier.publish(event, worker)
+}
+
+// notifyMaintenance publishes a maintenance started or ended event for the
+// provided maintenance window.
+func (h *Hub) notifyMaintenance(window *MaintenanceWindow, started bool) {
+	kind, event := EventMaintenanceEnded, MaintenanceEnded
+	if started {
+		kind, event = EventMaintenanceStarted, MaintenanceStarted
+	}
+	h.events.publish(&HubEvent{
+		Kind:        kind,
+		Maintenance: window,
+	})
+	if h.notifier == nil {
+		return
+	}
+	h.notifier.publish(event, window)
+}
+
 // getBlock fetches the blocks associated with the provided block hash.
 func (h *Hub) getBlock(blockHash *chainhash.Hash) (*wire.MsgBlock, error) {
-	block, err := h.rpcc.GetBlock(blockHash)
+	block, err := h.chain.GetBlock(blockHash)
 	if err != nil {
 		return nil, err
 	}
 	return block, err
 }
 
+// getBestBlock fetches the hash and height of the best block of the
+// consensus daemon.
+func (h *Hub) getBestBlock() (*chainhash.Hash, int64, error) {
+	return h.chain.GetBestBlock()
+}
+
+// getBlockHash fetches the hash of the main chain block at the provided
+// height.
+func (h *Hub) getBlockHash(height int64) (*chainhash.Hash, error) {
+	return h.chain.GetBlockHash(height)
+}
+
+// getBlockHeader fetches the header of the block with the provided hash.
+func (h *Hub) getBlockHeader(hash *chainhash.Hash) (*wire.BlockHeader, error) {
+	return h.chain.GetBlockHeader(hash)
+}
+
+// refreshWork fetches the current work of the consensus daemon and sends it
+// to connected clients as a clean job.
+func (h *Hub) refreshWork() error {
+	work, _, err := h.getWork()
+	if err != nil {
+		desc := "unable to fetch current work"
+		return MakeError(ErrOther, desc, err)
+	}
+	h.processWork(h.chainState.setCurrentWork(work), true)
+	return nil
+}
+
+// workSubsidy returns the proof-of-work subsidy of a block at the provided
+// height with the provided number of voters.
+func (h *Hub) workSubsidy(height uint32, voters uint16) dcrutil.Amount {
+	return dcrutil.Amount(h.subsidyCache.CalcWorkSubsidy(int64(height), voters))
+}
+
+// fillWorkRewards sets the rewards of the provided mined work recorded
+// before rewards were tracked from their blocks. Work with blocks that
+// cannot be fetched is left unchanged to be filled later.
+func (h *Hub) fillWorkRewards(work []*AcceptedWork) {
+	if h.chain == nil {
+		return
+	}
+	for _, w := range work {
+		if w.Reward != 0 {
+			continue
+		}
+		hash, err := chainhash.NewHashFromStr(w.BlockHash)
+		if err != nil {
+			log.Errorf("invalid mined work block hash %s: %v",
+				w.BlockHash, err)
+			continue
+		}
+		block, err := h.getBlock(hash)
+		if err != nil {
+			log.Tracef("unable to fetch block %s for its reward: %v",
+				w.BlockHash, err)
+			continue
+		}
+		w.Reward = dcrutil.Amount(block.Transactions[0].TxOut[2].Value)
+		err = w.Update(h.db)
+		if err != nil {
+			log.Errorf("unable to persist reward of mined work %s: %v",
+				w.BlockHash, err)
+		}
+	}
+}
+
 // fetchHostConnections returns the client connection count for the
 // provided host.
 func (h *Hub) fetchHostConnections(host string) uint32 {
@@ -267,240 +1052,1004 @@ func (h *Hub) removeConnection(host string) {
 	atomic.AddInt32(&h.clients, -1)
 }
 
-// processWork parses work received and dispatches a work notification to all
-// connected pool clients.
-func (h *Hub) processWork(headerE string) {
-	heightD, err := hex.DecodeString(headerE[256:264])
+// isBanned returns if the provided ip is banned from connecting to the
+// pool.
+func (h *Hub) isBanned(ip net.IP) bool {
+	return h.bans.lookup(ip, time.Now().UnixNano()) != nil
+}
+
+// fetchNetworkDifficulty returns the network difficulty of the current
+// work, zero if there is no current work.
+func (h *Hub) fetchNetworkDifficulty() float64 {
+	currWorkE := h.chainState.fetchCurrentWork()
+	if currWorkE == "" {
+		return 0
+	}
+	bitsD, err := hex.DecodeString(currWorkE[232:240])
 	if err != nil {
-		log.Errorf("failed to decode block height %s: %v", string(heightD), err)
-		return
+		log.Errorf("failed to decode block bits %s: %v",
+			currWorkE[232:240], err)
+		return 0
 	}
-	height := binary.LittleEndian.Uint32(heightD)
-	log.Tracef("New work at height #%d received: %s", height, headerE)
-	h.chainState.setLastWorkHeight(height)
-	if !h.HasClients() {
-		return
+	target := standalone.CompactToBig(binary.LittleEndian.Uint32(bitsD))
+	if target.Sign() <= 0 {
+		return 0
 	}
+	diff := new(big.Rat).SetFrac(h.cfg.ActiveNet.PowLimit, target)
+	diffF, _ := diff.Float64()
+	return diffF
+}
 
-	blockVersion := headerE[:8]
-	prevBlock := headerE[8:72]
-	genTx1 := headerE[72:288]
-	nBits := headerE[232:240]
-	nTime := headerE[272:280]
-	genTx2 := headerE[352:360]
-	job, err := NewJob(headerE, height)
+// FetchStatsHistory returns the pool stats samples taken within the
+// provided range, ordered by time. Samples older than two days are hourly
+// rollups.
+func (h *Hub) FetchStatsHistory(start time.Time, end time.Time) ([]*StatsSample, error) {
+	return fetchStatsSamples(h.db, start.UnixNano(), end.UnixNano())
+}
+
+// disconnectClients disconnects all connected clients matching the provided
+// filter. It returns the number of clients disconnected.
+func (h *Hub) disconnectClients(filter func(*Client) bool, reason string) int {
+	var count int
+	for _, endpoint := range h.endpoints {
+		count += endpoint.disconnectClients(filter, reason)
+	}
+	return count
+}
+
+// DisconnectClient disconnects the client with the provided id, the client
+// is sent the provided reason if it is not empty. It returns the number of
+// connections affected.
+func (h *Hub) DisconnectClient(id string, reason string) int {
+	return h.disconnectClients(func(c *Client) bool {
+		return c.id == id
+	}, reason)
+}
+
+// DisconnectAccount disconnects all clients of the provided account id, the
+// clients are sent the provided reason if it is not empty. It returns the
+// number of connections affected.
+func (h *Hub) DisconnectAccount(accountID string, reason string) int {
+	return h.disconnectClients(func(c *Client) bool {
+		return c.account == accountID
+	}, reason)
+}
+
+// ban persists a ban of the provided ip or ip range for the provided
+// duration, a zero duration bans permanently, and disconnects the clients
+// connected from the range. The clients are sent the provided message if it
+// is not empty. It returns the number of connections affected.
+func (h *Hub) ban(target string, duration time.Duration, reason string, by string, message string) (int, error) {
+	ipNet, err := parseBanTarget(target)
 	if err != nil {
-		log.Errorf("failed to create job: %v", err)
-		return
+		return 0, err
 	}
-	err = job.Create(h.db)
+	now := time.Now()
+	ban := &Ban{
+		Target:    ipNet.String(),
+		Reason:    reason,
+		CreatedOn: now.UnixNano(),
+		CreatedBy: by,
+	}
+	if duration > 0 {
+		ban.ExpiresOn = now.Add(duration).UnixNano()
+	}
+	err = h.bans.add(h.db, ipNet, ban)
 	if err != nil {
-		log.Errorf("failed to persist job: %v", err)
-		return
+		return 0, err
 	}
-	workNotif := WorkNotification(job.UUID, prevBlock, genTx1, genTx2,
-		blockVersion, nBits, nTime, true)
-	for _, endpoint := range h.endpoints {
-		endpoint.clientsMtx.Lock()
-		for _, client := range endpoint.clients {
-			select {
-			case client.ch <- workNotif:
-			default:
-			}
-		}
-		endpoint.clientsMtx.Unlock()
+	if duration > 0 {
+		log.Infof("Banned %s for %v (%s)", ban.Target, duration, by)
+	} else {
+		log.Infof("Banned %s permanently (%s)", ban.Target, by)
 	}
+	return h.disconnectClients(func(c *Client) bool {
+		return ipNet.Contains(normalizeIP(c.addr.IP))
+	}, message), nil
 }
 
-// Listen creates listeners for all supported pool clients.
-func (h *Hub) Listen() error {
-	for miner, port := range h.cfg.MinerPorts {
-		diffInfo, err := h.poolDiffs.fetchMinerDifficulty(miner)
-		if err != nil {
-			return err
-		}
-		eCfg := &EndpointConfig{
-			ActiveNet:             h.cfg.ActiveNet,
-			DB:                    h.db,
-			SoloPool:              h.cfg.SoloPool,
-			Blake256Pad:           h.blake256Pad,
-			NonceIterations:       h.cfg.NonceIterations,
-			MaxConnectionsPerHost: h.cfg.MaxConnectionsPerHost,
-			HubWg:                 h.wg,
-			SubmitWork:            h.submitWork,
-			FetchCurrentWork:      h.chainState.fetchCurrentWork,
-			WithinLimit:           h.limiter.withinLimit,
-			AddConnection:         h.addConnection,
-			RemoveConnection:      h.removeConnection,
-			FetchHostConnections:  h.fetchHostConnections,
-		}
-		endpoint, err := NewEndpoint(eCfg, diffInfo, port, miner)
-		if err != nil {
-			desc := fmt.Sprintf("unable to create %s listener", miner)
-			return MakeError(ErrOther, desc, err)
-		}
-		h.endpoints = append(h.endpoints, endpoint)
-	}
-	return nil
+// BanIP bans the provided ip or CIDR ip range from connecting to the pool
+// for the provided duration on behalf of the provided banner, a zero
+// duration bans permanently. Connected clients of the range are
+// disconnected and sent the provided reason if it is not empty. Single IPv6
+// addresses are banned along with their /64 prefix. It returns the number
+// of connections affected.
+func (h *Hub) BanIP(target string, duration time.Duration, reason string, by string) (int, error) {
+	return h.ban(target, duration, reason, by, reason)
 }
 
-// CloseListeners terminates listeners created by endpoints of the hub. This
-// should only be used in the pool's shutdown process the hub is not running.
-func (h *Hub) CloseListeners() {
-	for _, e := range h.endpoints {
-		e.listener.Close()
+// UnbanIP lifts the ban of the provided ip or CIDR ip range on behalf of
+// the provided remover.
+func (h *Hub) UnbanIP(target string, by string) error {
+	ipNet, err := parseBanTarget(target)
+	if err != nil {
+		return err
+	}
+	_, err = h.bans.remove(h.db, ipNet, by, time.Now().UnixNano())
+	if err != nil {
+		return err
 	}
+	log.Infof("Lifted ban of %s (%s)", ipNet, by)
+	return nil
 }
 
-// Connect establishes connections with the consensus daemon and the wallet.
-func (h *Hub) Connect() error {
-	// Create handlers for chain notifications being subscribed for.
-	ntfnHandlers := &rpcclient.NotificationHandlers{
-		OnBlockConnected: func(headerB []byte, transactions [][]byte) {
-			h.chainState.connCh <- &blockNotification{
-				Header: headerB,
-				Done:   make(chan bool),
-			}
-		},
-		OnBlockDisconnected: func(headerB []byte) {
-			h.chainState.discCh <- &blockNotification{
-				Header: headerB,
-				Done:   make(chan bool),
-			}
-		},
-		OnWork: func(headerB []byte, target []byte, reason string) {
-			currWork := hex.EncodeToString(headerB)
-			switch reason {
-			case NewTxns:
-				h.chainState.setCurrentWork(currWork)
-
-			case NewParent, NewVotes:
-				h.chainState.setCurrentWork(currWork)
-				h.processWork(currWork)
-			}
-		},
+// FetchBans returns the bans in effect, ordered by banned range.
+func (h *Hub) FetchBans() []*Ban {
+	return h.bans.list(time.Now().UnixNano())
+}
+
+// FetchBanAuditLog returns the most recent ban list audit entries, most
+// recent entry first.
+func (h *Hub) FetchBanAuditLog() ([]*BanAuditEntry, error) {
+	return FetchBanAuditLog(h.db, maxBanAuditEntries)
+}
+
+// recordAuthFailure records a failed authorization of a locked account by
+// the provided host key, banning the host once it exceeds the failed
+// authorization limit.
+func (h *Hub) recordAuthFailure(host string) {
+	if h.cfg.MaxAuthFailures == 0 {
+		return
+	}
+	now := time.Now()
+	h.authFailMtx.Lock()
+	failures, ok := h.authFailures[host]
+	if !ok || now.Sub(failures.since) > authFailureWindow {
+		failures = &authFailures{since: now}
+		h.authFailures[host] = failures
+	}
+	failures.count++
+	exceeded := failures.count >= h.cfg.MaxAuthFailures
+	if exceeded {
+		delete(h.authFailures, host)
+	}
+	h.authFailMtx.Unlock()
+	if !exceeded {
+		return
+	}
+	if h.cfg.AuthFailureBan == 0 {
+		return
 	}
+	_, err := h.ban(host, h.cfg.AuthFailureBan,
+		"exceeded the failed authorization limit", "authfailures", "")
+	if err != nil {
+		log.Errorf("unable to ban %s: %v", host, err)
+	}
+}
 
-	// Establish RPC connection with dcrd.
-	rpcc, err := rpcclient.New(h.cfg.DcrdRPCCfg, ntfnHandlers)
+// verifyChallenge asserts the provided challenge is a recent challenge for
+// the provided action and address, signed by the key of the address, and
+// consumes it. Each signed challenge is accepted once.
+func (h *Hub) verifyChallenge(action string, address string, challenge string, signature string) error {
+	now := time.Now()
+	err := verifyChallenge(action, address, challenge, signature,
+		h.cfg.ActiveNet, now)
 	if err != nil {
-		desc := "dcrd rpc error"
-		return MakeError(ErrOther, desc, err)
+		return err
 	}
+	return h.challenges.consume(challenge, now)
+}
 
-	h.rpcc = rpcc
-	if err := h.rpcc.NotifyWork(); err != nil {
-		h.rpcc.Shutdown()
-		desc := "notify work rpc error (dcrd)"
-		return MakeError(ErrOther, desc, err)
+// SetAccountLock locks or unlocks the account of the provided address. The
+// challenge must be a recent, unused lock or unlock challenge for the
+// address, signed by its key. Locking an account generates a new lock secret,
+// invalidating previously issued authorization tokens.
+func (h *Hub) SetAccountLock(address string, challenge string, signature string, locked bool) error {
+	if h.cfg.SoloPool {
+		desc := "account locks are not supported in solo pool mode"
+		return MakeError(ErrNotSupported, desc, nil)
 	}
-	if err := h.rpcc.NotifyBlocks(); err != nil {
-		h.rpcc.Shutdown()
-		desc := "notify blocks error (dcrd)"
-		return MakeError(ErrOther, desc, err)
+	action := UnlockAction
+	if locked {
+		action = LockAction
+	}
+	err := h.verifyChallenge(action, address, challenge, signature)
+	if err != nil {
+		return err
+	}
+	accountID, err := AccountID(address, h.cfg.ActiveNet)
+	if err != nil {
+		return err
+	}
+	_, err = FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return err
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return err
+	}
+	settings.Locked = locked
+	settings.LockSecret = nil
+	if locked {
+		settings.LockSecret, err = newLockSecret()
+		if err != nil {
+			return err
+		}
+	}
+	err = persistAccountSettings(h.db, accountID, settings)
+	if err != nil {
+		return err
 	}
+	log.Infof("Lock of account %s set to %v", accountID, locked)
+	return nil
+}
 
-	// Establish GRPC connection with the wallet if not in solo pool mode.
-	if !h.cfg.SoloPool {
-		creds, err := credentials.NewClientTLSFromFile(h.cfg.WalletRPCCertFile,
-			"localhost")
+// GenerateAuthToken returns an authorization token for the locked account
+// of the provided address along with its expiry. The challenge must be a
+// recent, unused token challenge for the address, signed by its key. Clients of
+// locked accounts provide the token as their password when authorizing.
+func (h *Hub) GenerateAuthToken(address string, challenge string, signature string) (string, time.Time, error) {
+	now := time.Now()
+	err := h.verifyChallenge(TokenAction, address, challenge, signature)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	accountID, err := AccountID(address, h.cfg.ActiveNet)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if !settings.Locked {
+		desc := fmt.Sprintf("account %s is not locked", accountID)
+		return "", time.Time{}, MakeError(ErrNotSupported, desc, nil)
+	}
+	expiry := now.Add(h.cfg.AuthTokenLifetime)
+	return generateAuthToken(settings.LockSecret, accountID, expiry),
+		expiry, nil
+}
+
+// FetchQuarantinedPayments returns the pending payments requiring
+// attention before they can be paid out.
+func (h *Hub) FetchQuarantinedPayments() ([]*Payment, error) {
+	return fetchQuarantinedPayments(h.db, "")
+}
+
+// CorrectAccountAddress corrects the payout address of the provided account
+// id and requeues its quarantined payments, returning the number requeued.
+// The address must be the one the account id was derived from. The address
+// of a locked account is only corrected if the challenge is a recent, unused
+// address challenge for it, signed by its key.
+func (h *Hub) CorrectAccountAddress(accountID string, address string, challenge string, signature string) (int, error) {
+	if h.cfg.SoloPool {
+		desc := "address corrections are not supported in solo pool mode"
+		return 0, MakeError(ErrNotSupported, desc, nil)
+	}
+	err := validatePayoutAddress(address, h.cfg.ActiveNet)
+	if err != nil {
+		desc := fmt.Sprintf("invalid payout address: %v", err)
+		return 0, MakeError(ErrDecode, desc, nil)
+	}
+	id, err := AccountID(address, h.cfg.ActiveNet)
+	if err != nil {
+		return 0, err
+	}
+	if id != accountID {
+		desc := fmt.Sprintf("address %s does not belong to account %s",
+			address, accountID)
+		return 0, MakeError(ErrUnauthorized, desc, nil)
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return 0, err
+	}
+	if settings.Locked {
+		err := h.verifyChallenge(AddressAction, address, challenge,
+			signature)
 		if err != nil {
-			desc := "grpc tls error (eacrwallet)"
-			return MakeError(ErrOther, desc, err)
+			return 0, err
 		}
-		h.gConn, err = grpc.Dial(h.cfg.WalletGRPCHost,
-			grpc.WithTransportCredentials(creds))
+	}
+	err = updateAccountAddress(h.db, accountID, address)
+	if err != nil {
+		return 0, err
+	}
+	requeued, err := h.paymentMgr.requeueQuarantinedPayments(accountID)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Corrected the address of account %s, requeued %d "+
+		"quarantined payment(s)", accountID, requeued)
+	return requeued, nil
+}
+
+// MergeAccounts merges the shares, payments, mined work and worker history
+// of the account referenced by fromID into the account referenced by toID.
+// Connected clients of the merged account are disconnected with a message
+// to reauthorize. Accounts with payments in a payment cycle in flight are
+// not merged.
+func (h *Hub) MergeAccounts(fromID string, toID string) (*AccountMerge, error) {
+	if h.cfg.SoloPool {
+		desc := "account merges are not supported in solo pool mode"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	var merge *AccountMerge
+	err := h.workerMonitor.mergeAccount(fromID, toID, func() error {
+		var err error
+		merge, err = MergeAccounts(h.db, fromID, toID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.paymentMgr.discardShareWindow()
+	reason := fmt.Sprintf("Account merged into %s, please reauthorize",
+		merge.ToAddress)
+	n := h.DisconnectAccount(fromID, reason)
+	log.Infof("Merged account %s into %s: %d share(s), %d pending and %d "+
+		"archived payment(s), %d mined block(s) and %d worker(s) "+
+		"reassigned, %d connection(s) closed", fromID, toID, merge.Shares,
+		merge.Payments, merge.ArchivedPayments, merge.MinedWork,
+		merge.Workers, n)
+	return merge, nil
+}
+
+// FetchAccountMerges returns the audit records of merged accounts, most
+// recent first.
+func (h *Hub) FetchAccountMerges() ([]*AccountMerge, error) {
+	return fetchAccountMerges(h.db)
+}
+
+// FetchShareWindow returns the unpaid shares the next payout is calculated
+// from, grouped by account. The returned window is shared and must not be
+// modified.
+func (h *Hub) FetchShareWindow() (*ShareWindow, error) {
+	if h.cfg.SoloPool {
+		desc := "share windows are not supported in solo pool mode"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	return h.paymentMgr.fetchShareWindow()
+}
+
+// VerifyShareWindowOwner asserts the provided challenge is a recent share
+// window challenge for the provided address, signed by its key. The id of
+// the account of the address is returned. Share window challenges only
+// prove ownership for reading, so they are not consumed and can be reused
+// until they expire.
+func (h *Hub) VerifyShareWindowOwner(address string, challenge string, signature string) (string, error) {
+	err := verifyChallenge(ShareWindowAction, address, challenge, signature,
+		h.cfg.ActiveNet, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return AccountID(address, h.cfg.ActiveNet)
+}
+
+// SetTrace elevates logging of the provided client id or account id to
+// trace level when enabled, without affecting the logging of other clients.
+func (h *Hub) SetTrace(id string, enabled bool) {
+	h.tracedMtx.Lock()
+	if enabled {
+		h.traced[id] = struct{}{}
+	} else {
+		delete(h.traced, id)
+	}
+	h.tracedMtx.Unlock()
+	log.Infof("Trace logging for %s set to %v", id, enabled)
+}
+
+// FetchTraced returns the client and account ids with logging elevated to
+// trace level.
+func (h *Hub) FetchTraced() []string {
+	h.tracedMtx.RLock()
+	defer h.tracedMtx.RUnlock()
+	ids := make([]string, 0, len(h.traced))
+	for id := range h.traced {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// isTraced returns if logging of the provided client id or account id is
+// elevated to trace level.
+func (h *Hub) isTraced(id string, account string) bool {
+	h.tracedMtx.RLock()
+	defer h.tracedMtx.RUnlock()
+	if _, ok := h.traced[id]; ok {
+		return true
+	}
+	_, ok := h.traced[account]
+	return ok && account != ""
+}
+
+// processWork parses work received and dispatches a work notification to all
+// connected pool clients. The notification carries the sequence number of
+// the work so clients ignore rolled jobs of older work arriving after it.
+// Clean notifications require clients to discard their current jobs, they
+// should only be sent when the block template or height changed.
+func (h *Hub) processWork(work *CurrentWork, clean bool) {
+	headerE := work.Header
+	heightD, err := hex.DecodeString(headerE[256:264])
+	if err != nil {
+		log.Errorf("failed to decode block height %s: %v", string(heightD), err)
+		return
+	}
+	height := binary.LittleEndian.Uint32(heightD)
+	log.Tracef("New work at height #%d received: %s", height, headerE)
+	h.chainState.setLastWorkHeight(height)
+	if h.minerTargetsStale() {
+		err := h.refreshMinerTargets()
 		if err != nil {
-			desc := "grpc dial error (eacrwallet)"
-			return MakeError(ErrOther, desc, err)
+			log.Errorf("unable to refresh miner targets: %v", err)
 		}
-		if h.gConn == nil {
-			desc := "unable to establish grpc with eacrwallet"
-			return MakeError(ErrOther, desc, nil)
+	}
+	h.checkTemplateTargets(headerE)
+	if !h.HasClients() {
+		return
+	}
+
+	blockVersion := headerE[:8]
+	prevBlock := headerE[8:72]
+	genTx1 := headerE[72:288]
+	nBits := headerE[232:240]
+	nTime := headerE[272:280]
+	genTx2 := headerE[352:360]
+	job, err := NewJob(headerE, height)
+	if err != nil {
+		log.Errorf("failed to create job: %v", err)
+		return
+	}
+	err = job.Create(h.db)
+	if err != nil {
+		log.Errorf("failed to persist job: %v", err)
+		return
+	}
+	h.jobCache.add(job)
+	err = h.jobs.retain(job)
+	if err != nil {
+		log.Errorf("unable to evict jobs: %v", err)
+	}
+	workNotif := WorkNotification(job.UUID, prevBlock, genTx1, genTx2,
+		blockVersion, nBits, nTime, clean)
+	err = h.validateWorkNotification(headerE, workNotif)
+	if err != nil {
+		log.Errorf("work notification at height #%d does not carry its "+
+			"block template, not notifying clients: %v", height, err)
+		h.workStatus.recordError(err)
+		return
+	}
+	h.workStatus.recordSuccess()
+	for _, endpoint := range h.endpoints {
+		endpoint.clientsMtx.Lock()
+		for _, client := range endpoint.clients {
+			client.queueWork(workNotif, work.Seq)
 		}
-		h.grpc = walletrpc.NewWalletServiceClient(h.gConn)
-		req := &walletrpc.BalanceRequest{
-			RequiredConfirmations: 1,
+		endpoint.clientsMtx.Unlock()
+	}
+}
+
+// templateTarget returns the network target of the provided block template
+// header.
+func templateTarget(headerE string) (*big.Int, error) {
+	if len(headerE) < 240 {
+		desc := fmt.Sprintf("block template header %s is too short",
+			headerE)
+		return nil, MakeError(ErrWrongInputLength, desc, nil)
+	}
+	bitsD, err := hex.DecodeString(headerE[232:240])
+	if err != nil {
+		desc := fmt.Sprintf("failed to decode block bits %s",
+			headerE[232:240])
+		return nil, MakeError(ErrDecode, desc, err)
+	}
+	return standalone.CompactToBig(binary.LittleEndian.Uint32(bitsD)), nil
+}
+
+// validateTemplateTargets asserts the pool target of every miner type and
+// of every scaled miner endpoint is not below the network target of the
+// provided block template header. A block solved by a miner whose pool
+// target is below the network target is rejected as a low difficulty share
+// unless it also meets the pool target.
+func (h *Hub) validateTemplateTargets(headerE string) error {
+	netTarget, err := templateTarget(headerE)
+	if err != nil {
+		return err
+	}
+	if netTarget.Sign() <= 0 {
+		desc := fmt.Sprintf("block template network target %064x is not "+
+			"positive", netTarget)
+		return MakeError(ErrCalcPoolTarget, desc, nil)
+	}
+	netTargetR := new(big.Rat).SetInt(netTarget)
+	violations := make([]string, 0)
+	check := func(desc string, diffInfo *DifficultyInfo) {
+		if diffInfo.target.Cmp(netTargetR) >= 0 {
+			return
 		}
-		h.grpcMtx.Lock()
-		_, err = h.grpc.Balance(context.TODO(), req)
-		h.grpcMtx.Unlock()
+		violations = append(violations, fmt.Sprintf("%s pool target %064x "+
+			"(difficulty %s)", desc, ratToInt(diffInfo.target),
+			diffInfo.difficulty.FloatString(4)))
+	}
+	miners := make([]string, 0, len(minerHashes))
+	for miner := range minerHashes {
+		miners = append(miners, miner)
+	}
+	sort.Strings(miners)
+	poolDiffs := h.fetchPoolDiffs()
+	for _, miner := range miners {
+		diffInfo, err := poolDiffs.fetchMinerDifficulty(miner)
 		if err != nil {
-			desc := "grpc request error (eacrwallet)"
-			return MakeError(ErrOther, desc, err)
+			return err
 		}
+		check(miner, diffInfo)
 	}
-	work, _, err := h.getWork()
+	for _, endpoint := range h.endpoints {
+		diffInfo, multiplier := endpoint.fetchDifficultyInfo()
+		if multiplier == 1 {
+			continue
+		}
+		check(fmt.Sprintf("%s endpoint on port %d", endpoint.miner,
+			endpoint.port), diffInfo)
+	}
+	if len(violations) > 0 {
+		netDiff := new(big.Rat).SetFrac(h.cfg.ActiveNet.PowLimit, netTarget)
+		desc := fmt.Sprintf("%s below the network target %064x (difficulty "+
+			"%s) of the block template, solved blocks not meeting the pool "+
+			"target are rejected as low difficulty shares",
+			strings.Join(violations, ", "), netTarget, netDiff.FloatString(4))
+		return MakeError(ErrCalcPoolTarget, desc, nil)
+	}
+	return nil
+}
+
+// checkTemplateTargets records the outcome of validating the pool targets
+// against the provided block template header, a violation is logged when
+// it first occurs or changes.
+func (h *Hub) checkTemplateTargets(headerE string) {
+	err := h.validateTemplateTargets(headerE)
 	if err != nil {
-		desc := "unable to fetch current work"
-		return MakeError(ErrOther, desc, err)
+		prev := h.targetStatus.fetchStatus()
+		if !prev.failing() || prev.LastError != err.Error() {
+			log.Errorf("Pool targets are unsafe for the current block "+
+				"template: %v", err)
+		}
+		h.targetStatus.recordError(err)
+		return
+	}
+	h.targetStatus.recordSuccess()
+}
+
+// validateWorkNotification asserts the provided work notification carries
+// the header of the provided work as formatted for every miner type served
+// by the pool's endpoints.
+func (h *Hub) validateWorkNotification(workE string, req *Request) error {
+	checked := make(map[string]struct{}, len(h.endpoints))
+	for _, endpoint := range h.endpoints {
+		if _, ok := checked[endpoint.miner]; ok {
+			continue
+		}
+		checked[endpoint.miner] = struct{}{}
+		notif, err := formatWorkNotification(endpoint.miner, req)
+		if err != nil {
+			return err
+		}
+		err = validateWorkNotification(endpoint.miner, workE, notif)
+		if err != nil {
+			return err
+		}
 	}
-	h.chainState.setCurrentWork(work)
 	return nil
 }
 
-// HasClients asserts the mining pool has clients.
-func (h *Hub) HasClients() bool {
-	return atomic.LoadInt32(&h.clients) > 0
+// FetchPoolFee returns the fee charged to participating accounts of the
+// pool.
+func (h *Hub) FetchPoolFee() float64 {
+	return h.paymentMgr.config().PoolFee
 }
 
-// PublishTransaction creates a transaction paying pool accounts for work done.
-func (h *Hub) PublishTransaction(payouts map[dcrutil.Address]dcrutil.Amount, targetAmt dcrutil.Amount) (string, error) {
-	outs := make([]*walletrpc.ConstructTransactionRequest_Output, 0, len(payouts))
-	for addr, amt := range payouts {
-		out := &walletrpc.ConstructTransactionRequest_Output{
-			Destination: &walletrpc.ConstructTransactionRequest_OutputDestination{
-				Address: addr.String(),
-			},
-			Amount: int64(amt),
+// endpointUpdate represents a difficulty update of a miner endpoint.
+type endpointUpdate struct {
+	endpoint   *Endpoint
+	multiplier float64
+	diffInfo   *DifficultyInfo
+}
+
+// ApplyConfig applies the runtime adjustable settings of the provided
+// configuration to the hub without disconnecting clients: the fee and
+// payment parameters, the request limits, the difficulties of miner
+// endpoints and the worker offline period and retention. Other fields of
+// the provided configuration are ignored, changing them requires a
+// restart. Endpoint difficulties are computed before any setting is
+// applied, nothing is applied if that fails.
+func (h *Hub) ApplyConfig(hcfg *HubConfig) error {
+	poolDiffs, err := h.newDifficultySet(hcfg.MaxGenTime, hcfg.MaxShareRate)
+	if err != nil {
+		return err
+	}
+	multipliers := make(map[uint32]float64, len(hcfg.ExtraEndpoints))
+	for _, spec := range hcfg.ExtraEndpoints {
+		multipliers[spec.Port] = spec.DiffMultiplier
+	}
+	updates := make([]*endpointUpdate, 0, len(h.endpoints))
+	for _, endpoint := range h.endpoints {
+		current, multiplier := endpoint.fetchDifficultyInfo()
+		if m, ok := multipliers[endpoint.port]; ok {
+			multiplier = m
 		}
-		outs = append(outs, out)
+		diffInfo, err := poolDiffs.fetchScaledMinerDifficulty(endpoint.miner,
+			multiplier)
+		if err != nil {
+			return err
+		}
+		if diffInfo.difficulty.Cmp(current.difficulty) == 0 {
+			continue
+		}
+		updates = append(updates, &endpointUpdate{
+			endpoint:   endpoint,
+			multiplier: multiplier,
+			diffInfo:   diffInfo,
+		})
 	}
 
-	constructTxReq := &walletrpc.ConstructTransactionRequest{
-		SourceAccount:            0,
-		RequiredConfirmations:    1,
-		OutputSelectionAlgorithm: walletrpc.ConstructTransactionRequest_ALL,
-		NonChangeOutputs:         outs,
+	h.paymentMgr.ApplyConfig(&PaymentMgrConfig{
+		PoolFee:              hcfg.PoolFee,
+		LastNPeriod:          hcfg.LastNPeriod,
+		MinPayment:           hcfg.MinPayment,
+		MaxTxFeeReserve:      hcfg.MaxTxFeeReserve,
+		MaxPaymentOutputs:    hcfg.MaxPaymentOutputs,
+		MaxPaymentTxSize:     hcfg.MaxPaymentTxSize,
+		MaxPaymentRetries:    hcfg.MaxPaymentRetries,
+		PaymentRetryBackoff:  hcfg.PaymentRetryBackoff,
+		BalanceRetryInterval: hcfg.BalanceRetryInterval,
+		DryRun:               hcfg.PaymentDryRun,
+	})
+	h.limiter.ApplyConfig(&RequestLimits{
+		Authorize: hcfg.AuthorizeLimit,
+		Subscribe: hcfg.SubscribeLimit,
+		Submit:    hcfg.SubmitLimit,
+	})
+	h.workerMonitor.ApplyConfig(&WorkerMonitorConfig{
+		OfflinePeriod: hcfg.WorkerOfflinePeriod,
+		Retention:     hcfg.WorkerRetention,
+	})
+	h.poolDiffsMtx.Lock()
+	h.poolDiffs = poolDiffs
+	h.poolDiffsMtx.Unlock()
+	for _, update := range updates {
+		notified := update.endpoint.ApplyConfig(update.multiplier,
+			update.diffInfo)
+		log.Infof("%s endpoint on port %d updated to difficulty %s, %d "+
+			"clients notified", update.endpoint.miner, update.endpoint.port,
+			update.diffInfo.difficulty.FloatString(4), notified)
 	}
-	h.grpcMtx.Lock()
-	constructTxResp, err := h.grpc.ConstructTransaction(context.TODO(), constructTxReq)
-	h.grpcMtx.Unlock()
-	if err != nil {
-		return "", err
+	if work := h.chainState.fetchCurrentWork(); work != "" {
+		h.checkTemplateTargets(work)
 	}
-	signTxReq := &walletrpc.SignTransactionRequest{
-		SerializedTransaction: constructTxResp.UnsignedTransaction,
-		Passphrase:            []byte(h.cfg.WalletPass),
+	return h.refreshMinerTargets()
+}
+
+// Listen creates listeners for all supported pool clients.
+func (h *Hub) Listen() error {
+	if h.cfg.Reporting {
+		desc := "miner connections are not accepted in reporting mode"
+		return MakeError(ErrNotSupported, desc, nil)
 	}
-	h.grpcMtx.Lock()
-	signedTxResp, err := h.grpc.SignTransaction(context.TODO(), signTxReq)
-	h.grpcMtx.Unlock()
-	if err != nil {
-		return "", err
+	for miner, port := range h.cfg.MinerPorts {
+		err := h.listen(miner, port, 1)
+		if err != nil {
+			return err
+		}
 	}
-	pubTxReq := &walletrpc.PublishTransactionRequest{
-		SignedTransaction: signedTxResp.Transaction,
+	for _, spec := range h.cfg.ExtraEndpoints {
+		err := h.listen(spec.Miner, spec.Port, spec.DiffMultiplier)
+		if err != nil {
+			return err
+		}
 	}
-	h.grpcMtx.Lock()
-	pubTxResp, err := h.grpc.PublishTransaction(context.TODO(), pubTxReq)
-	h.grpcMtx.Unlock()
+	return h.refreshMinerTargets()
+}
+
+// listen creates a listener for the provided miner type on the provided
+// port, its clients are assigned the miner's difficulty scaled by the
+// provided multiplier.
+func (h *Hub) listen(miner string, port uint32, multiplier float64) error {
+	diffInfo, err := h.fetchPoolDiffs().fetchScaledMinerDifficulty(miner,
+		multiplier)
 	if err != nil {
-		return "", err
+		return err
+	}
+	eCfg := &EndpointConfig{
+		ActiveNet:              h.cfg.ActiveNet,
+		DB:                     h.db,
+		SoloPool:               h.cfg.SoloPool,
+		Blake256Pad:            h.blake256Pad,
+		NonceIterations:        h.cfg.NonceIterations,
+		DiffMultiplier:         multiplier,
+		ListenAddrs:            h.cfg.ListenAddrs[port],
+		MaxConnectionsPerHost:  h.cfg.MaxConnectionsPerHost,
+		MaxClients:             h.cfg.MaxEndpointClients,
+		MinNotifyInterval:      h.cfg.MinNotifyInterval,
+		InitialWorkDelay:       h.cfg.InitialWorkDelay,
+		KeepAlivePeriod:        h.cfg.KeepAlivePeriod,
+		WriteTimeout:           h.cfg.WriteTimeout,
+		MaxReadSize:            h.cfg.MaxReadSize,
+		MaxWriteSize:           h.cfg.MaxWriteSize,
+		MaxInFlight:            h.cfg.MaxInFlight,
+		StaleJobWindow:         h.cfg.StaleJobWindow,
+		StaleGracePeriod:       h.cfg.StaleGracePeriod,
+		HubWg:                  h.wg,
+		RegisterClient:         h.registry.register,
+		DeregisterClient:       h.registry.deregister,
+		SubmitWork:             h.submitWork,
+		FetchCurrentWork:       h.chainState.fetchVersionedWork,
+		WithinLimit:            h.limiter.withinLimit,
+		AddConnection:          h.addConnection,
+		RemoveConnection:       h.removeConnection,
+		FetchHostConnections:   h.fetchHostConnections,
+		IsBanned:               h.isBanned,
+		Events:                 h.events,
+		FetchMinerPolicy:       h.minerPolicy,
+		WorkSubsidy:            h.workSubsidy,
+		NotifyBlockAccepted:    h.notifyBlockAccepted,
+		NotifyBlockLost:        h.notifyBlockLost,
+		IsTraced:               h.isTraced,
+		FetchCapture:           h.captures.fetch,
+		RecordAuthFailure:      h.recordAuthFailure,
+		Sessions:               h.sessions,
+		AuthRejects:            h.authRejects,
+		SubmitLatency:          h.submitLatency,
+		InstanceID:             h.cfg.InstanceID,
+		InstanceBits:           h.cfg.InstanceBits,
+		MaxWorkerNameLength:    h.cfg.MaxWorkerNameLength,
+		StrictWorkerNames:      h.cfg.StrictWorkerNames,
+		DefaultWorkerNames:     h.workerNames,
+		FastPath:               h.cfg.FastPath,
+		SpotCheckRate:          h.cfg.SpotCheckRate,
+		MaxClockSkew:           h.cfg.MaxClockSkew,
+		JobCache:               h.jobCache,
+		JobRetainer:            h.jobs,
+		FetchWorkerShares:      h.workerMonitor.fetchShares,
+		NotifyAccountCollision: h.notifyAccountCollision,
+	}
+	if h.cfg.SelfServeSettings && !h.cfg.SoloPool {
+		eCfg.SetAccountOptions = h.SetAccountOptions
 	}
-	txid, err := chainhash.NewHash(pubTxResp.TransactionHash)
+	endpoint, err := NewEndpoint(eCfg, diffInfo, port, miner)
 	if err != nil {
-		return "", err
+		desc := fmt.Sprintf("unable to create %s listener", miner)
+		return MakeError(ErrOther, desc, err)
+	}
+	if atomic.LoadUint32(&h.paused) == 1 {
+		endpoint.Pause("")
 	}
-	return txid.String(), nil
+	h.endpoints = append(h.endpoints, endpoint)
+	return nil
 }
 
-// shutdown tears down the hub and releases resources used.
-func (h *Hub) shutdown() {
+// PauseEndpoints pauses all miner endpoints, including endpoints created
+// afterwards, keeping their clients connected until the endpoints are
+// resumed. Subscribed clients are sent the provided message if it is not
+// empty.
+func (h *Hub) PauseEndpoints(message string) {
+	atomic.StoreUint32(&h.paused, 1)
+	for _, endpoint := range h.endpoints {
+		notified := endpoint.Pause(message)
+		log.Infof("%s endpoint on port %d paused, %d clients notified",
+			endpoint.miner, endpoint.port, notified)
+	}
+}
+
+// ResumeEndpoints resumes all paused miner endpoints, their subscribed
+// clients are sent clean work.
+func (h *Hub) ResumeEndpoints() {
+	atomic.StoreUint32(&h.paused, 0)
+	for _, endpoint := range h.endpoints {
+		if !endpoint.IsPaused() {
+			continue
+		}
+		notified := endpoint.Resume()
+		log.Infof("%s endpoint on port %d resumed, %d clients sent work",
+			endpoint.miner, endpoint.port, notified)
+	}
+}
+
+// BroadcastMessage sends the provided message to the subscribed clients of
+// all miner endpoints. It returns the number of clients sent the message.
+func (h *Hub) BroadcastMessage(message string) int {
+	var notified int
+	for _, endpoint := range h.endpoints {
+		notified += endpoint.ShowMessage(message)
+	}
+	return notified
+}
+
+// FetchMaintenance returns the state of the maintenance schedule, nil for
+// reporting hubs.
+func (h *Hub) FetchMaintenance() *MaintenanceStatus {
+	if h.maintenance == nil {
+		return nil
+	}
+	return h.maintenance.status(time.Now())
+}
+
+// CancelMaintenance cancels the maintenance window in progress, the miner
+// endpoints are resumed.
+func (h *Hub) CancelMaintenance() error {
+	if h.maintenance == nil {
+		desc := "maintenance is not supported by reporting pools"
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	return h.maintenance.cancel()
+}
+
+// ScheduleMaintenance adds a one-shot maintenance window of the provided
+// duration starting at the provided time to the maintenance schedule.
+func (h *Hub) ScheduleMaintenance(start time.Time, duration time.Duration) error {
+	if h.maintenance == nil {
+		desc := "maintenance is not supported by reporting pools"
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	return h.maintenance.schedule(start, duration, time.Now())
+}
+
+// EndpointsPaused returns if the miner endpoints of the hub are paused.
+func (h *Hub) EndpointsPaused() bool {
+	return atomic.LoadUint32(&h.paused) == 1
+}
+
+// CloseListeners terminates listeners created by endpoints of the hub. This
+// should only be used in the pool's shutdown process the hub is not running.
+func (h *Hub) CloseListeners() {
+	for _, e := range h.endpoints {
+		e.closeListener()
+	}
+}
+
+// HandleReconnect resynchronizes the chain state after the consensus daemon
+// client reconnects since block notifications may have been missed while
+// disconnected.
+func (h *Hub) HandleReconnect() {
+	h.chainState.requestResync()
+}
+
+// HandleBlockConnected processes the serialized header of a block connected
+// to the main chain. Notifications are dropped once chain state processing
+// stops on shutdown.
+func (h *Hub) HandleBlockConnected(headerB []byte) {
+	h.phases.mtx.RLock()
+	defer h.phases.mtx.RUnlock()
+	if h.phases.reached(ShutdownChainState) {
+		log.Debugf("Dropped block connected notification, shutting down")
+		return
+	}
+	h.chainState.connCh <- &blockNotification{
+		Header: headerB,
+		Done:   make(chan bool),
+	}
+}
+
+// HandleBlockDisconnected processes the serialized header of a block
+// disconnected from the main chain. Notifications are dropped once chain
+// state processing stops on shutdown.
+func (h *Hub) HandleBlockDisconnected(headerB []byte) {
+	h.phases.mtx.RLock()
+	defer h.phases.mtx.RUnlock()
+	if h.phases.reached(ShutdownChainState) {
+		log.Debugf("Dropped block disconnected notification, shutting down")
+		return
+	}
+	h.chainState.discCh <- &blockNotification{
+		Header: headerB,
+		Done:   make(chan bool),
+	}
+}
+
+// HandleWork processes work notified by the consensus daemon for the
+// provided reason. Work with new transactions replaces the current work
+// without notifying clients, work on a new parent or with new votes is
+// sent to clients as a clean job. Work is dropped once the hub is shutting
+// down.
+func (h *Hub) HandleWork(headerB []byte, reason string) {
+	if h.shuttingDown(ShutdownListeners) {
+		log.Debugf("Dropped work notification, shutting down")
+		return
+	}
+	currWork := hex.EncodeToString(headerB)
+	switch reason {
+	case NewTxns:
+		h.chainState.setCurrentWork(currWork)
+
+	case NewParent, NewVotes:
+		h.processWork(h.chainState.setCurrentWork(currWork), true)
+	}
+}
+
+// Connect establishes connections with the consensus daemon and the wallet.
+// The configured chain client and wallet are used instead when provided.
+func (h *Hub) Connect() error {
+	if h.cfg.Reporting {
+		desc := "connections are not established in reporting mode"
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	if h.cfg.ChainClient != nil {
+		h.chain = h.cfg.ChainClient
+	} else {
+		// Create handlers for chain notifications being subscribed for.
+		ntfnHandlers := &rpcclient.NotificationHandlers{
+			OnClientConnected: h.HandleReconnect,
+			OnBlockConnected: func(headerB []byte, transactions [][]byte) {
+				h.HandleBlockConnected(headerB)
+			},
+			OnBlockDisconnected: h.HandleBlockDisconnected,
+			OnWork: func(headerB []byte, target []byte, reason string) {
+				h.HandleWork(headerB, reason)
+			},
+		}
+
+		// Establish RPC connection with dcrd.
+		rpcc, err := rpcclient.New(h.cfg.DcrdRPCCfg, ntfnHandlers)
+		if err != nil {
+			desc := "dcrd rpc error"
+			return MakeError(ErrOther, desc, err)
+		}
+		if err := rpcc.NotifyWork(); err != nil {
+			rpcc.Shutdown()
+			desc := "notify work rpc error (dcrd)"
+			return MakeError(ErrOther, desc, err)
+		}
+		if err := rpcc.NotifyBlocks(); err != nil {
+			rpcc.Shutdown()
+			desc := "notify blocks error (dcrd)"
+			return MakeError(ErrOther, desc, err)
+		}
+		h.rpcc = rpcc
+		h.chain = rpcc
+	}
+
+	// Establish GRPC connection with the wallet if not in solo pool mode.
 	if !h.cfg.SoloPool {
-		if h.gConn != nil {
-			h.gConn.Close()
+		if h.cfg.Wallet != nil {
+			h.wallet = h.cfg.Wallet
+		} else {
+			w, err := dialWallet(h.cfg.WalletGRPCHost,
+				h.cfg.WalletRPCCertFile, h.cfg.WalletPass)
+			if err != nil {
+				return err
+			}
+			h.wallet = w
 		}
+		_, err := h.wallet.SpendableBalance(context.TODO())
+		if err != nil {
+			desc := "wallet request error"
+			return MakeError(ErrOther, desc, err)
+		}
+	}
+	work, _, err := h.getWork()
+	if err != nil {
+		desc := "unable to fetch current work"
+		return MakeError(ErrOther, desc, err)
+	}
+	h.chainState.setCurrentWork(work)
+	h.checkTemplateTargets(work)
+	return nil
+}
+
+// HasClients asserts the mining pool has clients.
+func (h *Hub) HasClients() bool {
+	return atomic.LoadInt32(&h.clients) > 0
+}
+
+// PublishTransaction creates a transaction paying pool accounts for work done.
+func (h *Hub) PublishTransaction(payouts map[dcrutil.Address]dcrutil.Amount, targetAmt dcrutil.Amount) (string, error) {
+	return h.wallet.PublishTransaction(context.TODO(), payouts, targetAmt)
+}
+
+// fetchSpendableBalance fetches the spendable balance of the wallet account
+// payments are dispatched from.
+func (h *Hub) fetchSpendableBalance() (dcrutil.Amount, error) {
+	return h.wallet.SpendableBalance(context.TODO())
+}
+
+// shutdown tears down the hub and releases resources used. Connections
+// established by the hub are closed, a provided chain client and wallet
+// are left for their owner to close.
+func (h *Hub) shutdown() {
+	if w, ok := h.wallet.(*grpcWallet); ok {
+		w.close()
 	}
 	if h.rpcc != nil {
 		h.rpcc.Shutdown()
@@ -510,22 +2059,151 @@ func (h *Hub) shutdown() {
 
 // run handles the process lifecycles of the pool hub.
 func (h *Hub) Run(ctx context.Context) {
+	if h.cfg.Reporting {
+		// Reporting hubs only serve queries until shutdown.
+		<-ctx.Done()
+		h.phases.enter(ShutdownDB)
+		h.shutdown()
+		h.phases.enter(ShutdownComplete)
+		return
+	}
+
+	// Components run until the shutdown stage they belong to is stopped,
+	// stages are stopped in order once the hub's context is cancelled.
+	stages := newHubStages()
 	for _, e := range h.endpoints {
-		go e.run(ctx)
-		h.wg.Add(1)
+		h.start(stages.endpointsCtx, &stages.endpointsWg, e.run)
 	}
-	go h.chainState.handleChainUpdates(ctx)
-	h.wg.Add(1)
+	h.start(stages.endpointsCtx, &stages.endpointsWg, h.maintenance.run)
+	h.start(stages.endpointsCtx, &stages.endpointsWg, h.monitorClients)
+	h.start(stages.chainCtx, &stages.chainWg, h.chainState.handleChainUpdates)
+	h.start(stages.writersCtx, &stages.writersWg, h.workerMonitor.run)
+	h.start(stages.writersCtx, &stages.writersWg, h.minerStats.run)
+	h.start(stages.writersCtx, &stages.writersWg, h.digests.run)
+	if h.statsRecorder != nil {
+		h.start(stages.writersCtx, &stages.writersWg, h.statsRecorder.run)
+	}
+	if h.notifier != nil {
+		h.start(stages.writersCtx, &stages.writersWg, h.notifier.run)
+	}
+	if h.shareLog != nil {
+		h.start(stages.writersCtx, &stages.writersWg, h.shareLog.run)
+	}
+	if h.connAudit != nil {
+		h.start(stages.writersCtx, &stages.writersWg, h.connAudit.run)
+	}
+	h.start(stages.writersCtx, &stages.writersWg, h.sweepBans)
+
+	<-ctx.Done()
+	h.stopStages(stages)
+}
+
+// reconcileClients forcibly cleans up registered clients cancelled longer
+// than the provided grace period ago which have not shut down, along with
+// cancelled endpoint clients which never registered. It returns the number
+// of clients cleaned up.
+func (h *Hub) reconcileClients(now time.Time, grace time.Duration) int {
+	stuck := h.registry.reconcile(now, grace)
+	for _, c := range stuck {
+		log.Warnf("Forcing cleanup of client %s, it did not shut down "+
+			"after being cancelled", c.fetchIdentity())
+		c.shutdown()
+	}
+	cleaned := len(stuck)
+	for _, e := range h.endpoints {
+		var orphans []*Client
+		e.clientsMtx.Lock()
+		for _, c := range e.clients {
+			if c.ctx.Err() != nil && !h.registry.isRegistered(c) {
+				orphans = append(orphans, c)
+			}
+		}
+		e.clientsMtx.Unlock()
+		for _, c := range orphans {
+			log.Warnf("Forcing cleanup of unregistered client %s",
+				c.fetchIdentity())
+			c.shutdown()
+		}
+		cleaned += len(orphans)
+	}
+	return cleaned
+}
 
-	h.wg.Wait()
-	h.shutdown()
+// monitorClients periodically reconciles the client registry and evicts
+// idle request limiters. It must be run as a goroutine.
+func (h *Hub) monitorClients(ctx context.Context) {
+	ticker := time.NewTicker(clientReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			h.wg.Done()
+			return
+		case now := <-ticker.C:
+			cleaned := h.reconcileClients(now, clientShutdownGrace)
+			if cleaned > 0 {
+				log.Infof("Reconciled %d client(s), %d registered",
+					cleaned, h.registry.count())
+			}
+			evicted := h.limiter.evictIdle(now)
+			if evicted > 0 {
+				log.Tracef("Evicted %d idle request limiter(s)", evicted)
+			}
+		}
+	}
 }
 
-// ClientInfo represents client miner information.
+// shutdownClients cancels all registered clients and waits for them to
+// shut down, clients still running after the shutdown grace period are
+// forcibly cleaned up so shutdown does not block on them.
+func (h *Hub) shutdownClients() {
+	h.registry.close()
+	if h.registry.wait(clientShutdownGrace) {
+		return
+	}
+	cleaned := h.reconcileClients(time.Now(), 0)
+	log.Warnf("Forced cleanup of %d client(s) on shutdown", cleaned)
+}
+
+// ClientInfo represents client miner information. The ID is the stable
+// key of the client, the Identity extends it with the shortened address
+// and worker name of an authorized client. OverBudget counts the messages
+// of the client refused for exceeding its in-flight budget, Coalesced the
+// work notifications replaced by newer ones before being sent, Dropped the
+// messages to the client dropped for exceeding the write limit and the
+// outdated work notifications dropped, and WriteFailures the failed writes
+// to the client. Counters of resumed sessions include those of the
+// connection resumed.
 type ClientInfo struct {
-	Miner    string
-	IP       string
-	HashRate *big.Rat
+	ID            string
+	Identity      string
+	Address       string
+	Miner         string
+	Name          string
+	IP            string
+	HashRate      *big.Rat
+	Coalesced     int64
+	OverBudget    int64
+	Dropped       int64
+	WriteFailures int64
+	Rejected      int64
+	// Late represents the number of shares of the client credited under
+	// the stale grace period.
+	Late int64
+	// FastPathShares represents the number of shares of the client
+	// accepted on the validation fast path, FastPathFlagged if the client
+	// was dropped back to full validation.
+	FastPathShares  int64
+	FastPathFlagged bool
+	// Version represents the mining software version reported by the
+	// client, KeepAliveRTT the round trip time of its latest keepalive.
+	Version      string
+	KeepAliveRTT time.Duration
+	// ClockSkew represents the median difference between the timestamps
+	// of the client's recent shares and the pool's clock, ClockSkewed if
+	// it exceeds the maximum allowed.
+	ClockSkew   time.Duration
+	ClockSkewed bool
 }
 
 // FetchClientInfo returns connection details about all pool clients.
@@ -535,11 +2213,30 @@ func (h *Hub) FetchClientInfo() map[string][]*ClientInfo {
 		endpoint.clientsMtx.Lock()
 		for _, client := range endpoint.clients {
 			hash := client.fetchHashRate()
+			skew, skewed := client.fetchClockSkew()
 			clientInfo[client.account] = append(clientInfo[client.account],
 				&ClientInfo{
-					Miner:    endpoint.miner,
-					IP:       client.addr.String(),
-					HashRate: hash,
+					ID:             client.id,
+					Identity:       client.fetchIdentity(),
+					Address:        client.address,
+					Miner:          endpoint.miner,
+					Name:           client.name,
+					IP:             client.addr.String(),
+					HashRate:       hash,
+					Coalesced:      atomic.LoadInt64(&client.coalesced),
+					OverBudget:     atomic.LoadInt64(&client.overBudget),
+					Dropped:        atomic.LoadInt64(&client.dropped),
+					WriteFailures:  atomic.LoadInt64(&client.writeFailures),
+					Rejected:       atomic.LoadInt64(&client.rejected),
+					Late:           atomic.LoadInt64(&client.late),
+					FastPathShares: atomic.LoadInt64(&client.fastShares),
+					FastPathFlagged: atomic.LoadUint32(
+						&client.fastPathFlagged) == 1,
+					Version: client.fetchVersion(),
+					KeepAliveRTT: time.Duration(atomic.LoadInt64(
+						&client.keepAliveRTT)),
+					ClockSkew:   skew,
+					ClockSkewed: skewed,
 				})
 		}
 		endpoint.clientsMtx.Unlock()
@@ -558,10 +2255,29 @@ func (h *Hub) FetchAccountClientInfo(accountID string) []*ClientInfo {
 				client.hashRateMtx.RLock()
 				hash := client.hashRate
 				client.hashRateMtx.RUnlock()
+				skew, skewed := client.fetchClockSkew()
 				info = append(info, &ClientInfo{
-					Miner:    endpoint.miner,
-					IP:       client.addr.String(),
-					HashRate: hash,
+					ID:             client.id,
+					Identity:       client.fetchIdentity(),
+					Address:        client.address,
+					Miner:          endpoint.miner,
+					Name:           client.name,
+					IP:             client.addr.String(),
+					HashRate:       hash,
+					Coalesced:      atomic.LoadInt64(&client.coalesced),
+					OverBudget:     atomic.LoadInt64(&client.overBudget),
+					Dropped:        atomic.LoadInt64(&client.dropped),
+					WriteFailures:  atomic.LoadInt64(&client.writeFailures),
+					Rejected:       atomic.LoadInt64(&client.rejected),
+					Late:           atomic.LoadInt64(&client.late),
+					FastPathShares: atomic.LoadInt64(&client.fastShares),
+					FastPathFlagged: atomic.LoadUint32(
+						&client.fastPathFlagged) == 1,
+					Version: client.fetchVersion(),
+					KeepAliveRTT: time.Duration(atomic.LoadInt64(
+						&client.keepAliveRTT)),
+					ClockSkew:   skew,
+					ClockSkewed: skewed,
 				})
 			}
 		}
@@ -570,9 +2286,232 @@ func (h *Hub) FetchAccountClientInfo(accountID string) []*ClientInfo {
 	return info
 }
 
+// FindClients returns connection details about all pool clients whose id,
+// identity, address, account id or worker name contains the provided
+// query, ignoring case.
+func (h *Hub) FindClients(query string) map[string][]*ClientInfo {
+	query = strings.ToLower(strings.TrimSpace(query))
+	found := make(map[string][]*ClientInfo)
+	for accountID, clients := range h.FetchClientInfo() {
+		for _, info := range clients {
+			fields := []string{info.ID, info.Identity, info.Address,
+				accountID, info.Name}
+			for _, field := range fields {
+				if strings.Contains(strings.ToLower(field), query) {
+					found[accountID] = append(found[accountID], info)
+					break
+				}
+			}
+		}
+	}
+	return found
+}
+
+// ListenerStatus represents the state of a listener of a miner endpoint.
+// Degraded listeners are not accepting connections while being re-bound.
+type ListenerStatus struct {
+	Addr     string
+	Degraded bool
+}
+
+// EndpointCapacity represents the client capacity of a miner endpoint.
+// Degraded endpoints have a failed listener being re-bound.
+type EndpointCapacity struct {
+	Miner          string
+	Port           uint32
+	DiffMultiplier float64
+	Clients        uint32
+	MaxClients     uint32
+	Degraded       bool
+	Paused         bool
+	Listeners      []*ListenerStatus
+}
+
+// FetchEndpointCapacity returns the connected and maximum clients and the
+// listener state of all miner endpoints.
+func (h *Hub) FetchEndpointCapacity() []*EndpointCapacity {
+	capacity := make([]*EndpointCapacity, 0, len(h.endpoints))
+	for _, endpoint := range h.endpoints {
+		diffInfo, _ := endpoint.fetchDifficultyInfo()
+		multiplier, _ := diffInfo.multiplier.Float64()
+		listeners := make([]*ListenerStatus, 0, len(endpoint.listeners))
+		for _, l := range endpoint.listeners {
+			listeners = append(listeners, &ListenerStatus{
+				Addr:     l.addr,
+				Degraded: l.isDegraded(),
+			})
+		}
+		capacity = append(capacity, &EndpointCapacity{
+			Miner:          endpoint.miner,
+			Port:           endpoint.port,
+			DiffMultiplier: multiplier,
+			Clients:        uint32(atomic.LoadInt32(&endpoint.numClients)),
+			MaxClients:     endpoint.cfg.MaxClients,
+			Degraded:       endpoint.isDegraded(),
+			Paused:         endpoint.IsPaused(),
+			Listeners:      listeners,
+		})
+	}
+	return capacity
+}
+
+// FetchEndpointChurn returns the accepted connections, connection failures
+// and recent connection failures of all miner endpoints.
+func (h *Hub) FetchEndpointChurn() []*EndpointChurn {
+	churn := make([]*EndpointChurn, 0, len(h.endpoints))
+	for _, endpoint := range h.endpoints {
+		churn = append(churn, endpoint.fetchChurn())
+	}
+	return churn
+}
+
+// MinerTarget represents the pool target and share difficulty assigned to
+// the clients of a miner endpoint. The difficulty ratio is the pool
+// difficulty relative to the network difficulty, zero if the network
+// difficulty is not known yet.
+type MinerTarget struct {
+	Miner           string
+	Port            uint32
+	DiffMultiplier  float64
+	Target          *big.Int
+	Difficulty      *big.Rat
+	DifficultyRatio float64
+	NonceIterations float64
+	ShareWeight     *big.Rat
+}
+
+// MinerTargets represents the targets of all miner endpoints along with the
+// network difficulty they were generated at.
+type MinerTargets struct {
+	NetworkDifficulty float64
+	GeneratedOn       int64
+	Targets           []*MinerTarget
+}
+
+// refreshMinerTargets regenerates the pool targets of all miner endpoints
+// at the current network difficulty.
+func (h *Hub) refreshMinerTargets() error {
+	netDiff := h.fetchNetworkDifficulty()
+	targets := &MinerTargets{
+		NetworkDifficulty: netDiff,
+		GeneratedOn:       time.Now().Unix(),
+		Targets:           make([]*MinerTarget, 0, len(h.endpoints)),
+	}
+	for _, endpoint := range h.endpoints {
+		_, multiplier := endpoint.fetchDifficultyInfo()
+		diffInfo, err := h.fetchPoolDiffs().fetchScaledMinerDifficulty(
+			endpoint.miner, multiplier)
+		if err != nil {
+			return err
+		}
+		target := new(big.Int).Quo(diffInfo.target.Num(),
+			diffInfo.target.Denom())
+		mt := &MinerTarget{
+			Miner:           endpoint.miner,
+			Port:            endpoint.port,
+			DiffMultiplier:  multiplier,
+			Target:          target,
+			Difficulty:      new(big.Rat).Set(diffInfo.difficulty),
+			NonceIterations: h.cfg.NonceIterations,
+			ShareWeight: new(big.Rat).Mul(ShareWeights[endpoint.miner],
+				diffInfo.multiplier),
+		}
+		if netDiff > 0 {
+			diff, _ := diffInfo.difficulty.Float64()
+			mt.DifficultyRatio = diff / netDiff
+		}
+		targets.Targets = append(targets.Targets, mt)
+	}
+	h.targetsMtx.Lock()
+	h.targets = targets
+	h.targetsMtx.Unlock()
+	return nil
+}
+
+// minerTargetsStale returns if the miner targets were generated at a
+// network difficulty other than the current one.
+func (h *Hub) minerTargetsStale() bool {
+	h.targetsMtx.RLock()
+	defer h.targetsMtx.RUnlock()
+	return h.targets != nil &&
+		h.targets.NetworkDifficulty != h.fetchNetworkDifficulty()
+}
+
+// FetchMinerTargets returns the pool target, difficulty, nonce iterations
+// and share weight of all miner endpoints, nil if the pool is not
+// listening for miner connections.
+func (h *Hub) FetchMinerTargets() *MinerTargets {
+	h.targetsMtx.RLock()
+	defer h.targetsMtx.RUnlock()
+	return h.targets
+}
+
+// clientConnected returns if the client with the provided id is connected
+// to any of the pool's endpoints.
+func (h *Hub) clientConnected(clientID string) bool {
+	for _, endpoint := range h.endpoints {
+		endpoint.clientsMtx.Lock()
+		_, ok := endpoint.clients[clientID]
+		endpoint.clientsMtx.Unlock()
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchWorkerHashRates returns the hash rates of workers with connected
+// clients, keyed by worker id.
+func (h *Hub) fetchWorkerHashRates() map[string]*big.Rat {
+	hashRates := make(map[string]*big.Rat)
+	for account, clients := range h.FetchClientInfo() {
+		if account == "" {
+			continue
+		}
+		for _, client := range clients {
+			id := workerID(account, client.Name)
+			hashRate, ok := hashRates[id]
+			if !ok {
+				hashRate = new(big.Rat)
+				hashRates[id] = hashRate
+			}
+			hashRate.Add(hashRate, client.HashRate)
+		}
+	}
+	return hashRates
+}
+
+// fetchAccountHashRates returns the hash rates of accounts with connected
+// clients, keyed by account id.
+func (h *Hub) fetchAccountHashRates() map[string]*big.Rat {
+	hashRates := make(map[string]*big.Rat)
+	for account, clients := range h.FetchClientInfo() {
+		if account == "" {
+			continue
+		}
+		hashRate := new(big.Rat)
+		for _, client := range clients {
+			hashRate.Add(hashRate, client.HashRate)
+		}
+		hashRates[account] = hashRate
+	}
+	return hashRates
+}
+
+// FetchAccountWorkers returns the activity states of all workers belonging
+// to the provided account id.
+func (h *Hub) FetchAccountWorkers(accountID string) []*WorkerState {
+	return h.workerMonitor.fetchAccountWorkers(accountID)
+}
+
 // FetchMinedWork returns the last ten mined blocks by the pool.
 func (h *Hub) FetchMinedWork() ([]*AcceptedWork, error) {
-	return ListMinedWork(h.db, 10)
+	work, err := ListMinedWork(h.db, 10)
+	if err != nil {
+		return nil, err
+	}
+	h.fillWorkRewards(work)
+	return work, nil
 }
 
 // FetchPoolHashRate returns the hash rate of the pool.
@@ -626,7 +2565,11 @@ func (h *Hub) FetchWorkQuotas() ([]*Quota, error) {
 // List is ordered, most recent comes first.
 func (h *Hub) FetchMinedWorkByAccount(id string) ([]*AcceptedWork, error) {
 	work, err := listMinedWorkByAccount(h.db, id, 10)
-	return work, err
+	if err != nil {
+		return nil, err
+	}
+	h.fillWorkRewards(work)
+	return work, nil
 }
 
 // FetchPaymentsForAccount returns a list or payments made to the provided address.
@@ -636,6 +2579,673 @@ func (h *Hub) FetchPaymentsForAccount(id string) ([]*Payment, error) {
 	return payments, err
 }
 
+// FetchRecentMinedWork returns the n most recent blocks mined by the pool.
+func (h *Hub) FetchRecentMinedWork(n int) ([]*AcceptedWork, error) {
+	work, err := ListMinedWork(h.db, n)
+	if err != nil {
+		return nil, err
+	}
+	h.fillWorkRewards(work)
+	return work, nil
+}
+
+// FetchAccountPayments returns the n most recent payments of the provided
+// account id, pending payments first.
+func (h *Hub) FetchAccountPayments(accountID string, n uint) ([]*Payment, error) {
+	return fetchPaymentsForAccount(h.db, accountID, n)
+}
+
+// FetchPaymentSources returns the payments of the provided account paid out
+// by the transaction with the provided id, each recording the mined block
+// it derives from and the share percentage of the account used.
+func (h *Hub) FetchPaymentSources(accountID string, txid string) ([]*Payment, error) {
+	return fetchPaymentSources(h.db, accountID, txid)
+}
+
+// FetchBlockPayments returns the pending and paid payments funded by the
+// block mined by the pool at the provided height.
+func (h *Hub) FetchBlockPayments(height uint32) ([]*Payment, error) {
+	return fetchBlockPayments(h.db, height)
+}
+
+// PoolStats represents a summary of the pool's mining activity.
+type PoolStats struct {
+	HashRate        *big.Rat
+	Workers         uint32
+	LastBlockHeight uint32
+	LastBlockHash   string
+	LastBlockTime   int64
+	// Metadata represents the configuration of the pool.
+	Metadata *PoolMetadata
+	// SubmitLatencies represents the latencies of the stages of work
+	// submissions, nil if latency metrics are disabled.
+	SubmitLatencies []*StageLatency
+	// Solo represents the solo mining summary, nil if not in solo pool
+	// mode.
+	Solo *SoloStats
+	// Miners represents the composition and share acceptance of the pool
+	// by miner type.
+	Miners []*MinerStats
+	// Targets represents the pool targets of the miner endpoints, nil if
+	// the pool is not listening for miner connections.
+	Targets *MinerTargets
+	// Disconnects represents the number of client teardowns by disconnect
+	// reason since the pool started.
+	Disconnects map[string]uint64
+	// AuthRejects represents the number of authorizations refused early,
+	// before any database access, and of authorizations failing after it
+	// since the pool started.
+	AuthRejects *AuthRejectStats
+}
+
+// SoloStats represents a summary of the blocks found and the workers of a
+// solo pool.
+type SoloStats struct {
+	// BlocksFound represents the number of blocks mined by each solo miner
+	// address, blocks of miners authorized without an address are counted
+	// under an empty address.
+	BlocksFound map[string]uint32
+	// SinceLastBlock represents the time elapsed since the last block
+	// was mined, zero if none has been.
+	SinceLastBlock time.Duration
+	// Workers represents the connected solo workers, keyed by address.
+	Workers map[string][]*ClientInfo
+}
+
+// FetchSoloStats returns the blocks found per address, the time since the
+// last block and the connected workers of a solo pool.
+func (h *Hub) FetchSoloStats() (*SoloStats, error) {
+	if !h.cfg.SoloPool {
+		desc := "solo stats are only supported in solo pool mode"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	blocks, err := countMinedWork(h.db)
+	if err != nil {
+		return nil, err
+	}
+	stats := &SoloStats{
+		BlocksFound: blocks,
+		Workers:     h.FetchClientInfo(),
+	}
+	work, err := ListMinedWork(h.db, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(work) > 0 {
+		stats.SinceLastBlock = time.Since(time.Unix(work[0].CreatedOn, 0))
+	}
+	return stats, nil
+}
+
+// FetchPoolStats returns a summary of the pool's mining activity.
+func (h *Hub) FetchPoolStats() (*PoolStats, error) {
+	meta, err := h.FetchPoolMetadata()
+	if err != nil {
+		return nil, err
+	}
+	hashRate, clientInfo := h.FetchPoolHashRate()
+	stats := &PoolStats{
+		HashRate: hashRate,
+		Metadata: meta,
+		Targets:  h.FetchMinerTargets(),
+	}
+	if h.submitLatency != nil {
+		stats.SubmitLatencies = h.submitLatency.fetchLatencies()
+	}
+	for _, clients := range clientInfo {
+		stats.Workers += uint32(len(clients))
+	}
+	stats.Miners = h.minerStatsFromClients(clientInfo)
+	stats.Disconnects = h.minerStats.fetchDisconnects()
+	stats.AuthRejects = h.authRejects.Stats()
+	work, err := ListMinedWork(h.db, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(work) > 0 {
+		stats.LastBlockHeight = work[0].Height
+		stats.LastBlockHash = work[0].BlockHash
+		stats.LastBlockTime = work[0].CreatedOn
+	}
+	if h.cfg.SoloPool {
+		stats.Solo, err = h.FetchSoloStats()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// minerStatsFromClients returns the counters of all known miner types
+// along with the number and average hash rate of their connected clients.
+func (h *Hub) minerStatsFromClients(clientInfo map[string][]*ClientInfo) []*MinerStats {
+	stats := h.minerStats.fetchMinerStats()
+	byMiner := make(map[string]*MinerStats, len(stats))
+	for _, s := range stats {
+		s.HashRate = new(big.Rat)
+		byMiner[s.Miner] = s
+	}
+	for _, clients := range clientInfo {
+		for _, client := range clients {
+			s, ok := byMiner[client.Miner]
+			if !ok {
+				continue
+			}
+			s.Connected++
+			if client.ClockSkewed {
+				s.Skewed++
+			}
+			s.HashRate.Add(s.HashRate, client.HashRate)
+		}
+	}
+	for _, s := range stats {
+		if s.Connected > 0 {
+			s.HashRate.Quo(s.HashRate, new(big.Rat).SetInt64(int64(s.Connected)))
+		}
+	}
+	return stats
+}
+
+// FetchMinerStats returns the composition and share acceptance of the pool
+// by miner type.
+func (h *Hub) FetchMinerStats() []*MinerStats {
+	return h.minerStatsFromClients(h.FetchClientInfo())
+}
+
+// WorkerInfo represents the activity and hash rate of a named worker. The
+// uptime, share counts and average hash rate of a worker are continuous
+// across reconnects and pool restarts.
+type WorkerInfo struct {
+	Name            string
+	Clients         uint32
+	HashRate        *big.Rat
+	AverageHashRate *big.Rat
+	Uptime          int64
+	Accepted        uint64
+	Rejected        uint64
+	LastSeen        int64
+	LastShare       int64
+	Offline         bool
+}
+
+// AccountDashboard represents the mining activity and payment details of
+// an account.
+type AccountDashboard struct {
+	AccountID      string
+	HashRate       *big.Rat
+	Workers        []*WorkerInfo
+	PendingBalance dcrutil.Amount
+	Balance        *AccountBalance
+	TotalPaid      dcrutil.Amount
+	RecentPayments []*Payment
+	RecentShares   *ShareSummary
+	PaymentsHeld   bool
+	Locked         bool
+}
+
+// FetchAccountDashboard returns the mining activity and payment details of
+// the provided account id. Accounts without connected clients report their
+// historical activity only.
+func (h *Hub) FetchAccountDashboard(accountID string) (*AccountDashboard, error) {
+	if h.cfg.SoloPool {
+		desc := "account dashboards are not supported in solo pool mode"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	_, err := FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return nil, err
+	}
+
+	dash := &AccountDashboard{
+		AccountID: accountID,
+		HashRate:  new(big.Rat),
+		Workers:   make([]*WorkerInfo, 0),
+	}
+	now := time.Now()
+	workers := make(map[string]*WorkerInfo)
+	sums := make(map[string]*big.Rat)
+	samples := make(map[string]int64)
+	for _, state := range h.workerMonitor.fetchAccountWorkers(accountID) {
+		sums[state.Name], samples[state.Name] = state.sumHashRates(now)
+		worker := &WorkerInfo{
+			Name:            state.Name,
+			HashRate:        new(big.Rat),
+			AverageHashRate: state.AverageHashRate(now),
+			Uptime:          state.Uptime,
+			Accepted:        state.Accepted,
+			Rejected:        state.Rejected,
+			LastSeen:        state.LastSeen,
+			LastShare:       state.LastShare,
+			Offline:         state.Offline,
+		}
+		workers[state.Name] = worker
+		dash.Workers = append(dash.Workers, worker)
+	}
+	for _, client := range h.FetchAccountClientInfo(accountID) {
+		dash.HashRate.Add(dash.HashRate, client.HashRate)
+		worker, ok := workers[client.Name]
+		if !ok {
+			worker = &WorkerInfo{
+				Name:            client.Name,
+				HashRate:        new(big.Rat),
+				AverageHashRate: new(big.Rat),
+			}
+			workers[client.Name] = worker
+			dash.Workers = append(dash.Workers, worker)
+		}
+		worker.Clients++
+		worker.HashRate.Add(worker.HashRate, client.HashRate)
+	}
+
+	// Include the live hash rate of connected workers as their latest
+	// hash rate sample.
+	for name, worker := range workers {
+		if worker.Clients == 0 {
+			continue
+		}
+		avg := new(big.Rat).Set(worker.HashRate)
+		if sum, ok := sums[name]; ok {
+			avg.Add(avg, sum)
+		}
+		worker.AverageHashRate = avg.Quo(avg,
+			new(big.Rat).SetInt64(samples[name]+1))
+	}
+
+	dash.PendingBalance, err = fetchPendingBalance(h.db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	dash.Balance, err = h.FetchAccountBalance(accountID)
+	if err != nil {
+		return nil, err
+	}
+	dash.TotalPaid, err = fetchPaymentTotal(h.db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	dash.PaymentsHeld = settings.PaymentsHeld
+	dash.Locked = settings.Locked
+	dash.RecentPayments, err = fetchPaymentsForAccount(h.db, accountID, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	min := time.Now().Add(-recentSharePeriod).UnixNano()
+	dash.RecentShares, err = fetchAccountShareSummary(h.db, accountID, min)
+	if err != nil {
+		return nil, err
+	}
+	return dash, nil
+}
+
+// TopAccount represents an account's contribution to the pool over the
+// recent share period.
+type TopAccount struct {
+	AccountID string
+	Shares    uint32
+	Weight    *big.Rat
+	HashRate  *big.Rat
+}
+
+// FetchTopAccounts returns the top n accounts by hash rate over the last
+// hour. The hash rate of an account is estimated as its portion of the
+// recent share weight of the pool applied to the pool hash rate.
+func (h *Hub) FetchTopAccounts(n int) ([]*TopAccount, error) {
+	if h.cfg.SoloPool {
+		return nil, nil
+	}
+	min := time.Now().Add(-recentSharePeriod).UnixNano()
+	summaries, err := fetchShareSummaries(h.db, min)
+	if err != nil {
+		return nil, err
+	}
+
+	poolHashRate, _ := h.FetchPoolHashRate()
+	totalWeight := new(big.Rat)
+	for _, summary := range summaries {
+		totalWeight.Add(totalWeight, summary.Weight)
+	}
+	accounts := make([]*TopAccount, 0, len(summaries))
+	for accountID, summary := range summaries {
+		hashRate := new(big.Rat)
+		if totalWeight.Sign() > 0 {
+			hashRate.Quo(summary.Weight, totalWeight)
+			hashRate.Mul(hashRate, poolHashRate)
+		}
+		accounts = append(accounts, &TopAccount{
+			AccountID: accountID,
+			Shares:    summary.Count,
+			Weight:    summary.Weight,
+			HashRate:  hashRate,
+		})
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		cmp := accounts[i].Weight.Cmp(accounts[j].Weight)
+		if cmp == 0 {
+			return accounts[i].AccountID < accounts[j].AccountID
+		}
+		return cmp > 0
+	})
+	if n >= 0 && len(accounts) > n {
+		accounts = accounts[:n]
+	}
+	return accounts, nil
+}
+
+// SetAccountFee sets the pool fee charged to the provided account id in
+// place of the pool fee, a nil fee restores the pool fee. The fee must not
+// be negative or exceed the pool fee.
+func (h *Hub) SetAccountFee(accountID string, fee *float64) error {
+	if h.cfg.SoloPool {
+		desc := "account fees are not supported in solo pool mode"
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	poolFee := h.FetchPoolFee()
+	if fee != nil && (*fee < 0 || *fee > poolFee) {
+		desc := fmt.Sprintf("account fee %v is not between 0 and the "+
+			"pool fee of %v", *fee, poolFee)
+		return MakeError(ErrOther, desc, nil)
+	}
+	_, err := FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return err
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return err
+	}
+	settings.FeeOverride = fee
+	return persistAccountSettings(h.db, accountID, settings)
+}
+
+// FetchAccountFees returns the fee overrides of all accounts that have one,
+// keyed by account id.
+func (h *Hub) FetchAccountFees() (map[string]float64, error) {
+	return fetchFeeOverrides(h.db)
+}
+
+// SetAccountDonation sets the fraction of the provided account id's payouts
+// donated to the pool's donation address, a zero donation disables it.
+func (h *Hub) SetAccountDonation(accountID string, donation float64) error {
+	if h.cfg.SoloPool {
+		desc := "donations are not supported in solo pool mode"
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	if h.cfg.DonationAddr == nil {
+		desc := "donations require a pool donation address"
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	if donation < 0 || donation > 1 {
+		desc := fmt.Sprintf("donation %v is not between 0 and 1", donation)
+		return MakeError(ErrOther, desc, nil)
+	}
+	_, err := FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return err
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return err
+	}
+	settings.Donation = donation
+	return persistAccountSettings(h.db, accountID, settings)
+}
+
+// FetchAccountDonations returns the donation fractions of all donating
+// accounts, keyed by account id.
+func (h *Hub) FetchAccountDonations() (map[string]float64, error) {
+	return fetchDonations(h.db)
+}
+
+// SetAccountPaymentsHeld holds or releases payouts to the provided account
+// id. The dividends of held accounts accrue and become eligible for payment
+// once the hold is released.
+func (h *Hub) SetAccountPaymentsHeld(accountID string, held bool) error {
+	if h.cfg.SoloPool {
+		desc := "payment holds are not supported in solo pool mode"
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	_, err := FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return err
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return err
+	}
+	settings.PaymentsHeld = held
+	return persistAccountSettings(h.db, accountID, settings)
+}
+
+// SetAccountDigest opts the provided account id into activity digests
+// covering periods of the provided interval, delivered to webhooks as
+// account digest events. A zero interval opts the account out.
+func (h *Hub) SetAccountDigest(accountID string, interval time.Duration) error {
+	if h.cfg.SoloPool {
+		desc := "activity digests are not supported in solo pool mode"
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	if interval != 0 && (interval < MinDigestInterval ||
+		interval > MaxDigestInterval) {
+		desc := fmt.Sprintf("digest interval %v is not between %v and %v",
+			interval, MinDigestInterval, MaxDigestInterval)
+		return MakeError(ErrOther, desc, nil)
+	}
+	_, err := FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return err
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return err
+	}
+	settings.DigestInterval = interval
+	err = persistAccountSettings(h.db, accountID, settings)
+	if err != nil {
+		return err
+	}
+	return h.digests.setInterval(accountID, interval)
+}
+
+// SetAccountOptions applies the provided account options set by a miner of
+// the provided locked account id through the set option extension and
+// returns the options in effect. Options are validated before any is
+// applied, minimum payouts must be zero or between the pool's minimum
+// payment and MaxMinPayout.
+func (h *Hub) SetAccountOptions(accountID string, options *AccountOptions) (*AccountOptions, error) {
+	if h.cfg.SoloPool {
+		desc := "account options are not supported in solo pool mode"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Locked {
+		desc := fmt.Sprintf("account %s is not locked", accountID)
+		return nil, MakeError(ErrUnauthorized, desc, nil)
+	}
+	minPayment := h.paymentMgr.config().MinPayment
+	if options.MinPayout != nil {
+		minPayout, err := dcrutil.NewAmount(*options.MinPayout)
+		if err != nil {
+			desc := fmt.Sprintf("invalid minimum payout %v",
+				*options.MinPayout)
+			return nil, MakeError(ErrOther, desc, err)
+		}
+		if minPayout != 0 && (minPayout < minPayment ||
+			minPayout > MaxMinPayout) {
+			desc := fmt.Sprintf("minimum payout %v is not between %v "+
+				"and %v", minPayout, minPayment, MaxMinPayout)
+			return nil, MakeError(ErrOther, desc, nil)
+		}
+		settings.MinPayout = minPayout
+	}
+	digestInterval := settings.DigestInterval
+	if options.DigestHours != nil {
+		interval := time.Hour * time.Duration(*options.DigestHours)
+		if interval != 0 && (interval < MinDigestInterval ||
+			interval > MaxDigestInterval) {
+			desc := fmt.Sprintf("digest interval %v is not between %v "+
+				"and %v", interval, MinDigestInterval, MaxDigestInterval)
+			return nil, MakeError(ErrOther, desc, nil)
+		}
+		settings.DigestInterval = interval
+	}
+	err = persistAccountSettings(h.db, accountID, settings)
+	if err != nil {
+		return nil, err
+	}
+	if settings.DigestInterval != digestInterval {
+		err = h.digests.setInterval(accountID, settings.DigestInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	minPayout := settings.MinPayout
+	if minPayout == 0 {
+		minPayout = minPayment
+	}
+	payout := minPayout.ToCoin()
+	hours := uint32(settings.DigestInterval / time.Hour)
+	log.Infof("Account %s set its minimum payout to %v and digest "+
+		"period to %d hours", accountID, minPayout, hours)
+	return &AccountOptions{MinPayout: &payout, DigestHours: &hours}, nil
+}
+
+// FetchHeldAccounts returns the unpaid balances of all accounts with held
+// payments, keyed by account id.
+func (h *Hub) FetchHeldAccounts() (map[string]dcrutil.Amount, error) {
+	held, err := fetchHeldAccounts(h.db)
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[string]dcrutil.Amount, len(held))
+	for accountID := range held {
+		balances[accountID], err = fetchPendingBalance(h.db, accountID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return balances, nil
+}
+
+// SetAccountMetadata replaces the label, contact and note of the provided
+// account id. Every changed field is audit-logged along with the provided
+// editor and the time of the change.
+func (h *Hub) SetAccountMetadata(accountID string, metadata *AccountMetadata, by string) error {
+	if h.cfg.SoloPool {
+		desc := "account metadata is not supported in solo pool mode"
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	err := metadata.validate()
+	if err != nil {
+		return err
+	}
+	_, err = FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return err
+	}
+	changes, err := updateAccountMetadata(h.db, accountID, metadata, by,
+		time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		log.Infof("Account %s %s updated by %s", accountID, change.Field, by)
+	}
+	return nil
+}
+
+// AccountAdminView represents the settings, support metadata and metadata
+// audit log of an account as viewed by admins.
+type AccountAdminView struct {
+	AccountID    string
+	Address      string
+	CreatedOn    uint64
+	FeeOverride  *float64
+	Donation     float64
+	PaymentsHeld bool
+	Locked       bool
+	APIKey       bool
+	Digest       time.Duration
+	MinPayout    dcrutil.Amount
+	Metadata     *AccountMetadata
+	MetadataLog  []*AccountMetadataChange
+}
+
+// FetchAccountAdminView returns the admin view of the provided account id.
+// It is the accessor admin surfaces read account metadata through, the
+// metadata must never be served to the public.
+func (h *Hub) FetchAccountAdminView(accountID string) (*AccountAdminView, error) {
+	if h.cfg.SoloPool {
+		desc := "account views are not supported in solo pool mode"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	account, err := FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return nil, err
+	}
+	settings, err := fetchAccountSettings(h.db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	metadataLog, err := fetchAccountMetadataLog(h.db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountAdminView{
+		AccountID:    accountID,
+		Address:      account.Address,
+		CreatedOn:    account.CreatedOn,
+		FeeOverride:  settings.FeeOverride,
+		Donation:     settings.Donation,
+		PaymentsHeld: settings.PaymentsHeld,
+		Locked:       settings.Locked,
+		APIKey:       len(settings.APIKeyHash) > 0,
+		Digest:       settings.DigestInterval,
+		MinPayout:    settings.MinPayout,
+		Metadata: &AccountMetadata{
+			Label:   settings.Label,
+			Contact: settings.Contact,
+			Note:    settings.Note,
+		},
+		MetadataLog: metadataLog,
+	}, nil
+}
+
+// FetchAccountBalance returns the unpaid earnings of the provided account
+// id. Accepted work at the chain tip awaiting confirmation is included in
+// the account's immature earnings as an estimate.
+func (h *Hub) FetchAccountBalance(accountID string) (*AccountBalance, error) {
+	if h.cfg.SoloPool {
+		desc := "account balances are not supported in solo pool mode"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	_, err := FetchAccount(h.db, []byte(accountID))
+	if err != nil {
+		return nil, err
+	}
+
+	// The current work builds on the chain tip, accepted work below the
+	// tip not confirmed by now has been orphaned.
+	height := h.chainState.fetchLastWorkHeight()
+	var tipHeight uint32
+	if height > 0 {
+		tipHeight = height - 1
+	}
+	unconfirmed, err := listUnconfirmedWork(h.db, tipHeight)
+	if err != nil {
+		return nil, err
+	}
+	return h.paymentMgr.fetchAccountBalance(accountID, tipHeight, unconfirmed)
+}
+
 // AccountExists checks if the provided account id references a pool account.
 func (h *Hub) AccountExists(accountID string) bool {
 	_, err := FetchAccount(h.db, []byte(accountID))
@@ -646,10 +3256,11 @@ func (h *Hub) AccountExists(accountID string) bool {
 	return true
 }
 
-// CSRFSecret fetches a persisted secret or generates a new one.
+// CSRFSecret fetches a persisted secret or generates a new one. Generated
+// secrets are not persisted for read-only databases.
 func (h *Hub) CSRFSecret() ([]byte, error) {
 	var secret []byte
-	err := h.db.Update(func(tx *bolt.Tx) error {
+	err := updateIfWritable(h.db, func(tx *bolt.Tx) error {
 		pbkt := tx.Bucket(poolBkt)
 		if pbkt == nil {
 			desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
@@ -668,6 +3279,9 @@ func (h *Hub) CSRFSecret() ([]byte, error) {
 		if err != nil {
 			return err
 		}
+		if !tx.Writable() {
+			return nil
+		}
 		err = pbkt.Put(csrfSecret, secret)
 		if err != nil {
 			return err
@@ -1,7 +1,9 @@
 package pool
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -43,6 +45,9 @@ func testHub(t *testing.T, db *bolt.DB) {
 		MaxTxFeeReserve:       maxTxFeeReserve,
 		MaxConnectionsPerHost: 2,
 		NonceIterations:       iterations,
+		AuthTokenLifetime:     time.Hour,
+		MaxAuthFailures:       2,
+		AuthFailureBan:        time.Minute,
 		MinerPorts: map[string]uint32{
 			CPU:           5050,
 			InnosiliconD9: 5052,
@@ -57,10 +62,18 @@ func testHub(t *testing.T, db *bolt.DB) {
 		t.Fatalf("[NewHub] uexpected error: %v", err)
 	}
 
+	// Ensure endpoints created while the hub is paused are paused.
+	hub.PauseEndpoints("")
 	err = hub.Listen()
 	if err != nil {
 		t.Fatalf("[Listen] uexpected error: %v", err)
 	}
+	for _, capacity := range hub.FetchEndpointCapacity() {
+		if !capacity.Paused {
+			t.Fatalf("expected the %s endpoint to be paused", capacity.Miner)
+		}
+	}
+	hub.ResumeEndpoints()
 	go hub.Run(ctx)
 
 	// Ensure account X exists.
@@ -68,6 +81,28 @@ func testHub(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected account with id %s to exist", xID)
 	}
 
+	// Ensure block submission rejects are counted by reason category.
+	reasons := map[string]string{
+		"":                   RejectUnknown,
+		"block is an orphan": RejectStale,
+		"block timestamp is too far in the future": RejectTimestamp,
+		"already have block":                       RejectDuplicate,
+		"Invalid block header: malformed":          RejectInvalid,
+	}
+	for reason, category := range reasons {
+		if rejectCategory(reason) != category {
+			t.Fatalf("[rejectCategory] expected %q to be categorized "+
+				"as %s, got %s", reason, category, rejectCategory(reason))
+		}
+	}
+	hub.recordReject("")
+	hub.recordReject("block is an orphan")
+	hub.recordReject("previous block is not known")
+	rejects := hub.FetchRejectCounts()
+	if rejects[RejectStale] != 2 || rejects[RejectUnknown] != 1 {
+		t.Fatalf("[FetchRejectCounts] unexpected reject counts: %v", rejects)
+	}
+
 	// Ensure the gui CSRF secret can be generated.
 	csrf, err := hub.CSRFSecret()
 	if err != nil {
@@ -77,6 +112,476 @@ func testHub(t *testing.T, db *bolt.DB) {
 		t.Fatal("expected a non-nil csrf secref")
 	}
 
+	// Ensure accounts are only locked by signed challenges of their
+	// address, and tokens are only issued for locked accounts.
+	key, address := newSigningKey(t, activeNet)
+	lockedAccount, err := NewAccount(address, activeNet)
+	if err != nil {
+		t.Fatalf("[NewAccount] unexpected error: %v", err)
+	}
+	err = lockedAccount.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	challenge := AuthChallenge(TokenAction, address,
+		time.Now().Add(-time.Minute))
+	_, _, err = hub.GenerateAuthToken(address, challenge,
+		signMessage(t, key, challenge))
+	if !IsError(err, ErrNotSupported) {
+		t.Fatalf("[GenerateAuthToken] expected a not supported error, "+
+			"got %v", err)
+	}
+	challenge = AuthChallenge(LockAction, address, time.Now())
+	err = hub.SetAccountLock(address, challenge, "", true)
+	if !IsError(err, ErrUnauthorized) {
+		t.Fatalf("[SetAccountLock] expected an unauthorized error, got %v",
+			err)
+	}
+	lockSig := signMessage(t, key, challenge)
+	err = hub.SetAccountLock(address, challenge, lockSig, true)
+	if err != nil {
+		t.Fatalf("[SetAccountLock] unexpected error: %v", err)
+	}
+	lockChallenge := challenge
+	challenge = AuthChallenge(TokenAction, address, time.Now())
+	token, expiry, err := hub.GenerateAuthToken(address, challenge,
+		signMessage(t, key, challenge))
+	if err != nil {
+		t.Fatalf("[GenerateAuthToken] unexpected error: %v", err)
+	}
+
+	// Ensure replayed signed challenges are refused.
+	err = hub.SetAccountLock(address, lockChallenge, lockSig, true)
+	if !IsError(err, ErrUnauthorized) {
+		t.Fatalf("[SetAccountLock] expected a replayed challenge to be "+
+			"refused, got %v", err)
+	}
+	_, _, err = hub.GenerateAuthToken(address, challenge,
+		signMessage(t, key, challenge))
+	if !IsError(err, ErrUnauthorized) {
+		t.Fatalf("[GenerateAuthToken] expected a replayed challenge to be "+
+			"refused, got %v", err)
+	}
+	if time.Until(expiry) > time.Hour {
+		t.Fatalf("[GenerateAuthToken] expected a token expiring within "+
+			"an hour, got %v", expiry)
+	}
+	settings, err := fetchAccountSettings(db, lockedAccount.UUID)
+	if err != nil {
+		t.Fatalf("[fetchAccountSettings] unexpected error: %v", err)
+	}
+	if !settings.Locked || !validAuthToken(settings.LockSecret,
+		lockedAccount.UUID, token, time.Now()) {
+		t.Fatal("expected a valid token for the locked account")
+	}
+	challenge = AuthChallenge(UnlockAction, address, time.Now())
+	err = hub.SetAccountLock(address, challenge,
+		signMessage(t, key, challenge), false)
+	if err != nil {
+		t.Fatalf("[SetAccountLock] unexpected error: %v", err)
+	}
+	settings, err = fetchAccountSettings(db, lockedAccount.UUID)
+	if err != nil {
+		t.Fatalf("[fetchAccountSettings] unexpected error: %v", err)
+	}
+	if settings.Locked || settings.LockSecret != nil {
+		t.Fatal("expected the account to be unlocked")
+	}
+
+	// Ensure api keys are only issued by signed api key challenges of the
+	// address, rotated keys replace the previous key, revoked keys are
+	// invalid and failed verifications ban the host once they exceed the
+	// failed authorization limit.
+	challenge = AuthChallenge(TokenAction, address, time.Now())
+	_, err = hub.SetAPIKey(address, challenge, signMessage(t, key, challenge),
+		false)
+	if !IsError(err, ErrUnauthorized) {
+		t.Fatalf("[SetAPIKey] expected an unauthorized error, got %v", err)
+	}
+	challenge = AuthChallenge(APIKeyAction, address, time.Now())
+	apiKeySig := signMessage(t, key, challenge)
+	apiKey, err := hub.SetAPIKey(address, challenge, apiKeySig, false)
+	if err != nil {
+		t.Fatalf("[SetAPIKey] unexpected error: %v", err)
+	}
+
+	// Ensure a replayed api key challenge neither returns a key nor
+	// rotates the issued one.
+	replayed, err := hub.SetAPIKey(address, challenge, apiKeySig, false)
+	if !IsError(err, ErrUnauthorized) || replayed != "" {
+		t.Fatalf("[SetAPIKey] expected a replayed challenge to be refused, "+
+			"got key %q and %v", replayed, err)
+	}
+	err = hub.VerifyAPIKey(lockedAccount.UUID, apiKey, "10.0.0.2")
+	if err != nil {
+		t.Fatalf("[VerifyAPIKey] unexpected error: %v", err)
+	}
+	view, err := hub.FetchAccountAdminView(lockedAccount.UUID)
+	if err != nil {
+		t.Fatalf("[FetchAccountAdminView] unexpected error: %v", err)
+	}
+	if !view.APIKey {
+		t.Fatal("expected the account to have an api key")
+	}
+	for i := 0; i < 2; i++ {
+		err = hub.VerifyAPIKey(lockedAccount.UUID, "invalid", "10.0.0.2")
+		if !IsError(err, ErrUnauthorized) {
+			t.Fatalf("[VerifyAPIKey] expected an unauthorized error, got %v",
+				err)
+		}
+	}
+	if !hub.isBanned(net.ParseIP("10.0.0.2")) {
+		t.Fatal("expected host 10.0.0.2 to be banned")
+	}
+	err = hub.VerifyAPIKey(lockedAccount.UUID, apiKey, "10.0.0.2")
+	if !IsError(err, ErrUnauthorized) {
+		t.Fatalf("[VerifyAPIKey] expected banned host to be refused, got %v",
+			err)
+	}
+	rotated, err := hub.ResetAPIKey(lockedAccount.UUID, false)
+	if err != nil {
+		t.Fatalf("[ResetAPIKey] unexpected error: %v", err)
+	}
+	err = hub.VerifyAPIKey(lockedAccount.UUID, apiKey, "10.0.0.3")
+	if !IsError(err, ErrUnauthorized) {
+		t.Fatalf("[VerifyAPIKey] expected a rotated key to be invalid, "+
+			"got %v", err)
+	}
+	err = hub.VerifyAPIKey(lockedAccount.UUID, rotated, "10.0.0.4")
+	if err != nil {
+		t.Fatalf("[VerifyAPIKey] unexpected error: %v", err)
+	}
+	// Date the revocation challenge apart from the used api key challenge.
+	challenge = AuthChallenge(APIKeyAction, address,
+		time.Now().Add(time.Second))
+	apiKey, err = hub.SetAPIKey(address, challenge,
+		signMessage(t, key, challenge), true)
+	if err != nil {
+		t.Fatalf("[SetAPIKey] unexpected error: %v", err)
+	}
+	if apiKey != "" {
+		t.Fatalf("expected no key for a revocation, got %s", apiKey)
+	}
+	err = hub.VerifyAPIKey(lockedAccount.UUID, rotated, "10.0.0.4")
+	if !IsError(err, ErrUnauthorized) {
+		t.Fatalf("[VerifyAPIKey] expected a revoked key to be invalid, "+
+			"got %v", err)
+	}
+	err = lockedAccount.Delete(db)
+	if err != nil {
+		t.Fatalf("[Delete] unexpected error: %v", err)
+	}
+	err = emptyBucket(db, accountSettingsBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+
+	// Ensure hosts are banned once they exceed the failed authorization
+	// limit.
+	hub.recordAuthFailure("10.0.0.1")
+	if hub.isBanned(net.ParseIP("10.0.0.1")) {
+		t.Fatal("expected host 10.0.0.1 not to be banned")
+	}
+	hub.recordAuthFailure("10.0.0.1")
+	if !hub.isBanned(net.ParseIP("10.0.0.1")) {
+		t.Fatal("expected host 10.0.0.1 to be banned")
+	}
+
+	// Ensure unknown health components are refused.
+	_, err = NewHub(cancel, &HubConfig{HealthCritical: []string{"unknown"}})
+	if err == nil {
+		t.Fatal("[NewHub] expected an unknown health component error")
+	}
+
+	// Ensure hubs are refused non-positive nonce iterations.
+	for _, iterations := range []float64{0, -1, math.NaN()} {
+		invalid := *hcfg
+		invalid.NonceIterations = iterations
+		_, err = NewHub(cancel, &invalid)
+		if !IsError(err, ErrCalcPoolTarget) {
+			t.Fatalf("[NewHub] expected a nonce iterations error for %v, "+
+				"got %v", iterations, err)
+		}
+	}
+
+	// Ensure only padding extending a block header to the getwork data
+	// length is valid.
+	pad := generateBlake256Pad()
+	err = validateBlake256Pad(pad)
+	if err != nil {
+		t.Fatalf("[validateBlake256Pad] unexpected error: %v", err)
+	}
+	err = validateBlake256Pad(pad[1:])
+	if !IsError(err, ErrWrongInputLength) {
+		t.Fatalf("expected a padding length error, got %v", err)
+	}
+	corrupt := append([]byte(nil), pad...)
+	corrupt[len(corrupt)-1]++
+	err = validateBlake256Pad(corrupt)
+	if !IsError(err, ErrWrongInputLength) {
+		t.Fatalf("expected a padding error, got %v", err)
+	}
+
+	// Ensure the pool is only unhealthy when its critical components fail.
+	hub.cfg.HealthCritical = []string{HealthDB, HealthEndpoints}
+	health := hub.HealthStatus()
+	if !health.Healthy || !health.DBWritable ||
+		len(health.Endpoints) != len(hcfg.MinerPorts) {
+		t.Fatalf("expected a healthy pool with %d endpoints, got %+v",
+			len(hcfg.MinerPorts), health)
+	}
+	for _, endpoint := range health.Endpoints {
+		if !endpoint.Listening || len(endpoint.Listeners) != 1 ||
+			!endpoint.Listeners[0].Listening {
+			t.Fatalf("expected the %s endpoint to be listening",
+				endpoint.Miner)
+		}
+	}
+	if health.Daemon.Reachable || health.Wallet == nil ||
+		health.Wallet.Reachable {
+		t.Fatalf("expected unreachable daemon and wallet, got %+v", health)
+	}
+
+	// Ensure paused endpoints are reported without failing.
+	hub.PauseEndpoints("")
+	health = hub.HealthStatus()
+	if !health.Healthy || !health.EndpointsPaused {
+		t.Fatalf("expected a healthy pool with paused endpoints, got %+v",
+			health)
+	}
+	for _, endpoint := range health.Endpoints {
+		if !endpoint.Paused {
+			t.Fatalf("expected the %s endpoint to be paused", endpoint.Miner)
+		}
+	}
+	hub.ResumeEndpoints()
+	health = hub.HealthStatus()
+	if health.EndpointsPaused || health.Endpoints[0].Paused {
+		t.Fatal("expected resumed endpoints")
+	}
+	hub.cfg.HealthCritical = []string{HealthDaemon, HealthWork,
+		HealthPayments}
+	health = hub.HealthStatus()
+	if health.Healthy || strings.Join(health.Failing, ",") != "daemon,work" {
+		t.Fatalf("expected failing daemon and work, got %v", health.Failing)
+	}
+	hub.chainState.setCurrentWork("work")
+	hub.paymentMgr.status.recordError(fmt.Errorf("wallet unavailable"))
+	health = hub.HealthStatus()
+	if strings.Join(health.Failing, ",") != "daemon,payments" ||
+		health.LastWorkUpdate == 0 ||
+		health.Payments.LastError != "wallet unavailable" {
+		t.Fatalf("expected failing daemon and payments, got %+v", health)
+	}
+	hub.paymentMgr.status.recordSuccess()
+	health = hub.HealthStatus()
+	if strings.Join(health.Failing, ",") != "daemon" {
+		t.Fatalf("expected a failing daemon, got %v", health.Failing)
+	}
+	hub.cfg.HealthCritical = nil
+
+	// Ensure the targets of all endpoints are generated when listening and
+	// regenerated when the network difficulty changes.
+	hub.chainState.setCurrentWork("")
+	targets := hub.FetchMinerTargets()
+	if targets == nil || len(targets.Targets) != len(hcfg.MinerPorts) ||
+		targets.GeneratedOn == 0 || targets.NetworkDifficulty != 0 {
+		t.Fatalf("[FetchMinerTargets] expected targets of %d endpoints "+
+			"without a network difficulty, got %+v", len(hcfg.MinerPorts),
+			targets)
+	}
+	for _, target := range targets.Targets {
+		diffInfo, err := hub.poolDiffs.fetchMinerDifficulty(target.Miner)
+		if err != nil {
+			t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+		}
+		if target.Port != hcfg.MinerPorts[target.Miner] ||
+			target.Difficulty.Cmp(diffInfo.difficulty) != 0 ||
+			target.ShareWeight.Cmp(ShareWeights[target.Miner]) != 0 ||
+			target.NonceIterations != iterations ||
+			target.DifficultyRatio != 0 {
+			t.Fatalf("[FetchMinerTargets] unexpected %s target: %+v",
+				target.Miner, target)
+		}
+		expected := new(big.Rat).Quo(new(big.Rat).SetInt(powLimit),
+			diffInfo.difficulty)
+		if new(big.Rat).SetInt(target.Target).Cmp(expected) > 0 {
+			t.Fatalf("[FetchMinerTargets] expected a %s target of at "+
+				"most %v, got %v", target.Miner, expected, target.Target)
+		}
+	}
+	if hub.minerTargetsStale() {
+		t.Fatal("expected current miner targets")
+	}
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+	hub.chainState.setCurrentWork(workE)
+	if !hub.minerTargetsStale() {
+		t.Fatal("expected stale miner targets after a network " +
+			"difficulty change")
+	}
+	err = hub.refreshMinerTargets()
+	if err != nil {
+		t.Fatalf("[refreshMinerTargets] unexpected error: %v", err)
+	}
+	targets = hub.FetchMinerTargets()
+	netDiff := hub.fetchNetworkDifficulty()
+	if targets.NetworkDifficulty != netDiff || netDiff == 0 {
+		t.Fatalf("[FetchMinerTargets] expected a network difficulty of "+
+			"%v, got %v", netDiff, targets.NetworkDifficulty)
+	}
+	for _, target := range targets.Targets {
+		diff, _ := target.Difficulty.Float64()
+		if target.DifficultyRatio != diff/netDiff {
+			t.Fatalf("[FetchMinerTargets] expected a %s difficulty ratio "+
+				"of %v, got %v", target.Miner, diff/netDiff,
+				target.DifficultyRatio)
+		}
+	}
+	poolStats, err := hub.FetchPoolStats()
+	if err != nil {
+		t.Fatalf("[FetchPoolStats] unexpected error: %v", err)
+	}
+	if poolStats.Targets != targets {
+		t.Fatal("[FetchPoolStats] expected the current miner targets")
+	}
+
+	// Ensure pool targets below the network target of the block template
+	// fail the targets health check, describing the violating miners, and
+	// the check recovers once the network target is met.
+	err = hub.validateTemplateTargets(workE)
+	if !IsError(err, ErrCalcPoolTarget) ||
+		!strings.Contains(err.Error(), WhatsminerD1) {
+		t.Fatalf("expected a pool target violation, got %v", err)
+	}
+	hub.cfg.HealthCritical = []string{HealthTargets}
+	hub.checkTemplateTargets(workE)
+	health = hub.HealthStatus()
+	if health.Healthy || strings.Join(health.Failing, ",") != HealthTargets ||
+		health.PoolTargets.LastError != err.Error() {
+		t.Fatalf("expected failing pool targets, got %+v", health)
+	}
+	hardWork := workE[:232] + "ffff001a" + workE[240:]
+	hub.checkTemplateTargets(hardWork)
+	health = hub.HealthStatus()
+	if !health.Healthy || health.PoolTargets.failing() {
+		t.Fatalf("expected valid pool targets, got %+v", health.PoolTargets)
+	}
+	hub.cfg.HealthCritical = nil
+	_, err = templateTarget("work")
+	if !IsError(err, ErrWrongInputLength) {
+		t.Fatalf("expected a short header error, got %v", err)
+	}
+
+	// Ensure the pool metadata reflects the running configuration and its
+	// hash is stable while the configuration is unchanged.
+	meta, err := hub.FetchPoolMetadata()
+	if err != nil {
+		t.Fatalf("[FetchPoolMetadata] unexpected error: %v", err)
+	}
+	if meta.Version != PoolMetadataVersion || meta.PoolFee != hcfg.PoolFee ||
+		meta.PaymentMethod != hcfg.PaymentMethod ||
+		meta.MinPayout != hcfg.MinPayment.ToCoin() ||
+		meta.Difficulty.MaxGenTime != hcfg.MaxGenTime ||
+		meta.Retention.JobDepth != MaxReorgLimit {
+		t.Fatalf("[FetchPoolMetadata] unexpected metadata: %+v", meta)
+	}
+	if len(meta.Miners) != len(hcfg.MinerPorts)+len(hcfg.ExtraEndpoints) {
+		t.Fatalf("[FetchPoolMetadata] expected %d miner endpoints, got %d",
+			len(hcfg.MinerPorts)+len(hcfg.ExtraEndpoints), len(meta.Miners))
+	}
+	for _, miner := range meta.Miners {
+		if port, ok := hcfg.MinerPorts[miner.Miner]; ok &&
+			miner.DiffMultiplier == 1 && port != miner.Port {
+			t.Fatalf("[FetchPoolMetadata] expected %s on port %d, got %d",
+				miner.Miner, port, miner.Port)
+		}
+		if miner.Policy != hub.minerPolicy(miner.Miner) ||
+			miner.Difficulty <= 0 {
+			t.Fatalf("[FetchPoolMetadata] unexpected %s endpoint %+v",
+				miner.Miner, miner)
+		}
+	}
+	unchanged, err := hub.FetchPoolMetadata()
+	if err != nil {
+		t.Fatalf("[FetchPoolMetadata] unexpected error: %v", err)
+	}
+	if meta.Hash == "" || unchanged.Hash != meta.Hash {
+		t.Fatalf("[FetchPoolMetadata] expected a stable hash, got %s and %s",
+			meta.Hash, unchanged.Hash)
+	}
+
+	// Ensure runtime-safe configuration changes are applied to the
+	// payment manager, limiter, worker monitor and endpoint difficulties.
+	reloaded := *hcfg
+	reloaded.PoolFee = 0.05
+	reloaded.MaxGenTime = 40
+	reloaded.SubmitLimit = 5
+	reloaded.WorkerRetention = time.Hour
+	err = hub.ApplyConfig(&reloaded)
+	if err != nil {
+		t.Fatalf("[ApplyConfig] unexpected error: %v", err)
+	}
+	if hub.FetchPoolFee() != 0.05 {
+		t.Fatalf("[ApplyConfig] expected a pool fee of 0.05, got %v",
+			hub.FetchPoolFee())
+	}
+	if hub.limiter.fetchLimits().Submit != 5 {
+		t.Fatalf("[ApplyConfig] expected a submit limit of 5, got %v",
+			hub.limiter.fetchLimits().Submit)
+	}
+	if hub.workerMonitor.config().Retention != time.Hour {
+		t.Fatalf("[ApplyConfig] expected a worker retention of an hour, "+
+			"got %v", hub.workerMonitor.config().Retention)
+	}
+	reloadedMeta, err := hub.FetchPoolMetadata()
+	if err != nil {
+		t.Fatalf("[FetchPoolMetadata] unexpected error: %v", err)
+	}
+	if reloadedMeta.PoolFee != 0.05 || reloadedMeta.Difficulty.MaxGenTime != 40 ||
+		reloadedMeta.Retention.Workers != int64(time.Hour.Seconds()) ||
+		reloadedMeta.Hash == meta.Hash {
+		t.Fatalf("[ApplyConfig] expected updated pool metadata, got %+v",
+			reloadedMeta)
+	}
+	reloadedTargets := hub.FetchMinerTargets()
+	for i, target := range reloadedTargets.Targets {
+		diffInfo, err := hub.fetchPoolDiffs().fetchMinerDifficulty(target.Miner)
+		if err != nil {
+			t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+		}
+		if target.Difficulty.Cmp(diffInfo.difficulty) != 0 ||
+			target.Difficulty.Cmp(targets.Targets[i].Difficulty) == 0 {
+			t.Fatalf("[ApplyConfig] expected an updated %s difficulty, "+
+				"got %v", target.Miner, target.Difficulty)
+		}
+	}
+
+	// Ensure invalid configuration changes are rejected without applying
+	// any of the changes.
+	invalid := reloaded
+	invalid.PoolFee = 0.2
+	invalid.ExtraEndpoints = []*EndpointSpec{{Miner: CPU, Port: 5050,
+		DiffMultiplier: -1}}
+	err = hub.ApplyConfig(&invalid)
+	if err == nil {
+		t.Fatal("[ApplyConfig] expected an invalid multiplier error")
+	}
+	if hub.FetchPoolFee() != 0.05 {
+		t.Fatalf("[ApplyConfig] expected an unchanged pool fee, got %v",
+			hub.FetchPoolFee())
+	}
+	err = hub.ApplyConfig(hcfg)
+	if err != nil {
+		t.Fatalf("[ApplyConfig] unexpected error: %v", err)
+	}
+
 	// Ensure the database can be backed up.
 	rr := httptest.NewRecorder()
 	err = hub.BackupDB(rr)
@@ -128,6 +633,246 @@ func testHub(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected the sum of share percentages to be 1, got %v", sum)
 	}
 
+	// Ensure account dashboards report historical activity for accounts
+	// without connected clients.
+	dash, err := hub.FetchAccountDashboard(xID)
+	if err != nil {
+		t.Fatalf("[FetchAccountDashboard] unexpected error: %v", err)
+	}
+	if dash.HashRate.Sign() != 0 {
+		t.Fatalf("expected a zero hash rate for account x, got %v",
+			dash.HashRate)
+	}
+	if dash.RecentShares.Count != 1 ||
+		dash.RecentShares.Weight.Cmp(xWeight) != 0 {
+		t.Fatalf("expected a single recent share of weight %v for "+
+			"account x, got %d of weight %v", xWeight,
+			dash.RecentShares.Count, dash.RecentShares.Weight)
+	}
+	_, err = hub.FetchAccountDashboard("unknown")
+	if err == nil {
+		t.Fatal("[FetchAccountDashboard] expected an account not found error")
+	}
+
+	// Ensure account dashboards only read the records of their account
+	// among the records of many unrelated accounts. The records of the
+	// unrelated accounts are undecodable, reading any of them fails the
+	// dashboard.
+	pending := NewPayment(xID, dcrutil.Amount(5e7), 10, 26)
+	archived := NewPayment(xID, dcrutil.Amount(3e7), 8, 24)
+	archived.PaidOnHeight = 30
+	archived.CreatedOn = pending.CreatedOn - 1
+	type indexedRecord struct {
+		bucket  []byte
+		index   []byte
+		account string
+		key     []byte
+		value   []byte
+	}
+	records := make([]*indexedRecord, 0)
+	for _, pmt := range []*Payment{pending, archived} {
+		bucket, index := paymentBkt, accountPaymentBkt
+		if pmt.PaidOnHeight > 0 {
+			bucket, index = paymentArchiveBkt, accountPaymentArchiveBkt
+		}
+		pBytes, err := json.Marshal(pmt)
+		if err != nil {
+			t.Fatalf("[Marshal] unexpected error: %v", err)
+		}
+		records = append(records, &indexedRecord{bucket, index, xID,
+			GeneratePaymentID(pmt.CreatedOn, pmt.Height, xID), pBytes})
+	}
+	unrelated := []string{xID + "0"}
+	for i := 0; i < 200; i++ {
+		unrelated = append(unrelated, fmt.Sprintf("%064x", i))
+	}
+	for i, id := range unrelated {
+		on := now.UnixNano() + int64(i) + 1
+		undecodable := []byte("{")
+		records = append(records,
+			&indexedRecord{paymentBkt, accountPaymentBkt, id,
+				GeneratePaymentID(on, 10, id), undecodable},
+			&indexedRecord{paymentArchiveBkt, accountPaymentArchiveBkt, id,
+				GeneratePaymentID(on, 8, id), undecodable},
+			&indexedRecord{shareBkt, accountShareBkt, id,
+				nanoToBigEndianBytes(on), undecodable})
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		pbkt := tx.Bucket(poolBkt)
+		for _, record := range records {
+			err := pbkt.Bucket(record.bucket).Put(record.key, record.value)
+			if err != nil {
+				return err
+			}
+			err = pbkt.Bucket(record.index).Put(append([]byte(record.account),
+				record.key...), []byte{})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to persist indexed records: %v", err)
+	}
+	dash, err = hub.FetchAccountDashboard(xID)
+	if err != nil {
+		t.Fatalf("[FetchAccountDashboard] unexpected error: %v", err)
+	}
+	if dash.PendingBalance != pending.Amount {
+		t.Fatalf("expected a pending balance of %v, got %v", pending.Amount,
+			dash.PendingBalance)
+	}
+	if len(dash.RecentPayments) != 2 ||
+		dash.RecentPayments[0].Amount != pending.Amount ||
+		dash.RecentPayments[1].Amount != archived.Amount {
+		t.Fatalf("expected the pending and archived payments of account "+
+			"x, got %d payments", len(dash.RecentPayments))
+	}
+	if dash.RecentShares.Count != 1 {
+		t.Fatalf("expected a single recent share for account x, got %d",
+			dash.RecentShares.Count)
+	}
+	_, err = fetchShareSummaries(db, minimumTime)
+	if err == nil {
+		t.Fatal("expected summarizing the shares of all accounts to read " +
+			"the unrelated records")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		pbkt := tx.Bucket(poolBkt)
+		for _, record := range records {
+			err := pbkt.Bucket(record.bucket).Delete(record.key)
+			if err != nil {
+				return err
+			}
+			err = pbkt.Bucket(record.index).Delete(append([]byte(record.account),
+				record.key...))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to remove indexed records: %v", err)
+	}
+
+	// Ensure account fees are validated and persisted.
+	fee := 0.05
+	err = hub.SetAccountFee(xID, &fee)
+	if err != nil {
+		t.Fatalf("[SetAccountFee] unexpected error: %v", err)
+	}
+	for _, invalid := range []float64{-0.01, hcfg.PoolFee + 0.01} {
+		invalid := invalid
+		err = hub.SetAccountFee(xID, &invalid)
+		if err == nil {
+			t.Fatalf("[SetAccountFee] expected an invalid fee error for %v",
+				invalid)
+		}
+	}
+	err = hub.SetAccountFee("unknown", &fee)
+	if err == nil {
+		t.Fatal("[SetAccountFee] expected an account not found error")
+	}
+	fees, err := hub.FetchAccountFees()
+	if err != nil {
+		t.Fatalf("[FetchAccountFees] unexpected error: %v", err)
+	}
+	if len(fees) != 1 || fees[xID] != fee {
+		t.Fatalf("expected a fee of %v for account x, got %v", fee, fees)
+	}
+	err = hub.SetAccountFee(xID, nil)
+	if err != nil {
+		t.Fatalf("[SetAccountFee] unexpected error: %v", err)
+	}
+	fees, err = hub.FetchAccountFees()
+	if err != nil {
+		t.Fatalf("[FetchAccountFees] unexpected error: %v", err)
+	}
+	if len(fees) != 0 {
+		t.Fatalf("expected no account fees, got %v", fees)
+	}
+
+	// Ensure accepted work rewards are estimated from the work subsidy.
+	if hub.workSubsidy(100, 5) <= 0 {
+		t.Fatal("[workSubsidy] expected a positive work subsidy")
+	}
+	if hub.workSubsidy(1000, 3) >= hub.workSubsidy(1000, 5) {
+		t.Fatal("[workSubsidy] expected the subsidy to be reduced by " +
+			"missing votes")
+	}
+
+	// Ensure configured miner policies override the network defaults.
+	policies := hub.FetchMinerPolicies()
+	if len(policies) != len(minerHashes) || policies[CPU] != PolicyAllow {
+		t.Fatalf("expected all miner types allowed on simnet, got %v",
+			policies)
+	}
+	hub.cfg.MinerPolicies = map[string]string{CPU: PolicyNoReward}
+	if policy := hub.FetchMinerPolicies()[CPU]; policy != PolicyNoReward {
+		t.Fatalf("expected a %s cpu miner policy, got %s", PolicyNoReward,
+			policy)
+	}
+	hub.cfg.MinerPolicies = nil
+	if defaultMinerPolicy(chaincfg.MainNetParams(), CPU) != PolicyReject {
+		t.Fatal("expected cpu miners rejected on mainnet by default")
+	}
+	if ValidateMinerPolicy(CPU, "unknown") == nil {
+		t.Fatal("[ValidateMinerPolicy] expected an unknown policy error")
+	}
+	if ValidateMinerPolicy("unknown", PolicyAllow) == nil {
+		t.Fatal("[ValidateMinerPolicy] expected an unknown miner error")
+	}
+
+	// Ensure donations require a donation address and are validated.
+	err = hub.SetAccountDonation(xID, 0.5)
+	if err == nil {
+		t.Fatal("[SetAccountDonation] expected a missing donation " +
+			"address error")
+	}
+	hub.cfg.DonationAddr = poolFeeAddrs
+	for _, invalid := range []float64{-0.1, 1.1} {
+		err = hub.SetAccountDonation(xID, invalid)
+		if err == nil {
+			t.Fatalf("[SetAccountDonation] expected an invalid donation "+
+				"error for %v", invalid)
+		}
+	}
+	err = hub.SetAccountDonation(xID, 0.5)
+	if err != nil {
+		t.Fatalf("[SetAccountDonation] unexpected error: %v", err)
+	}
+	donations, err := hub.FetchAccountDonations()
+	if err != nil {
+		t.Fatalf("[FetchAccountDonations] unexpected error: %v", err)
+	}
+	if len(donations) != 1 || donations[xID] != 0.5 {
+		t.Fatalf("expected a donation of 0.5 for account x, got %v",
+			donations)
+	}
+	hub.cfg.DonationAddr = nil
+	err = emptyBucket(db, accountSettingsBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+
+	// Ensure top accounts are ordered by their recent share weight.
+	top, err := hub.FetchTopAccounts(10)
+	if err != nil {
+		t.Fatalf("[FetchTopAccounts] unexpected error: %v", err)
+	}
+	if len(top) != 2 || top[0].AccountID != yID || top[1].AccountID != xID {
+		t.Fatalf("expected accounts y and x as top accounts, got %v", top)
+	}
+	top, err = hub.FetchTopAccounts(1)
+	if err != nil {
+		t.Fatalf("[FetchTopAccounts] unexpected error: %v", err)
+	}
+	if len(top) != 1 || top[0].AccountID != yID {
+		t.Fatalf("expected account y as the top account, got %v", top)
+	}
+
 	port := uint32(3031)
 	laddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", "127.0.0.1", port))
 	if err != nil {
@@ -201,6 +946,48 @@ func testHub(t *testing.T, db *bolt.DB) {
 			"of 1, got %d", len(cInfo))
 	}
 
+	// Ensure clients can be found by their id and the identity of
+	// unauthorized clients is their id.
+	info := cInfo[""][0]
+	if info.Identity != info.ID {
+		t.Fatalf("expected identity %s, got %s", info.ID, info.Identity)
+	}
+	found := hub.FindClients(strings.ToUpper(info.ID[:8]))
+	if len(found[""]) != 1 {
+		t.Fatalf("[FindClients] expected 1 client, got %v", found)
+	}
+	found = hub.FindClients("unknown")
+	if len(found) != 0 {
+		t.Fatalf("[FindClients] expected no clients, got %v", found)
+	}
+
+	// Ensure pool stats report connected clients and pool settings.
+	stats, err := hub.FetchPoolStats()
+	if err != nil {
+		t.Fatalf("[FetchPoolStats] unexpected error: %v", err)
+	}
+	if stats.Workers != 1 {
+		t.Fatalf("[FetchPoolStats] expected 1 connected worker, got %d",
+			stats.Workers)
+	}
+	if stats.Metadata.PaymentMethod != PPS ||
+		stats.Metadata.PoolFee != hcfg.PoolFee {
+		t.Fatalf("[FetchPoolStats] unexpected pool settings: %s, %v",
+			stats.Metadata.PaymentMethod, stats.Metadata.PoolFee)
+	}
+
+	// Ensure the connected client is counted under its miner type.
+	for _, miner := range hub.FetchMinerStats() {
+		connected := uint32(0)
+		if miner.Miner == info.Miner {
+			connected = 1
+		}
+		if miner.Connected != connected {
+			t.Fatalf("[FetchMinerStats] expected %d connected %s "+
+				"clients, got %d", connected, miner.Miner, miner.Connected)
+		}
+	}
+
 	// Ensure there are no connected clients for test accounts
 	aInfo := hub.FetchAccountClientInfo(xID)
 	if len(aInfo) != 0 {
@@ -215,10 +1002,168 @@ func testHub(t *testing.T, db *bolt.DB) {
 			"of 1 for clients with no associated account, got %d", len(cInfo))
 	}
 
-	// Empty the share bucket.
-	err = emptyBucket(db, shareBkt)
+	// Ensure disconnecting unknown clients and banning invalid ips do not
+	// affect connected clients.
+	if n := hub.DisconnectClient("unknown", ""); n != 0 {
+		t.Fatalf("[DisconnectClient] expected no affected connections, "+
+			"got %d", n)
+	}
+	if n := hub.DisconnectAccount(xID, ""); n != 0 {
+		t.Fatalf("[DisconnectAccount] expected no affected connections, "+
+			"got %d", n)
+	}
+	_, err = hub.BanIP("invalid", time.Minute, "", "admin")
+	if err == nil {
+		t.Fatal("[BanIP] expected an invalid ip error")
+	}
+
+	// Ensure IPv6 bans cover the /64 prefix of the banned address and
+	// IPv4-mapped addresses are banned as their IPv4 form.
+	_, err = hub.BanIP("2001:db8::1", time.Minute, "", "admin")
 	if err != nil {
-		t.Fatalf("emptyBucket error: %v", err)
+		t.Fatalf("[BanIP] unexpected error: %v", err)
+	}
+	if !hub.isBanned(net.ParseIP("2001:db8::ffff:2")) {
+		t.Fatal("expected addresses in the banned /64 prefix to be banned")
+	}
+	if hub.isBanned(net.ParseIP("2001:db8:0:1::1")) {
+		t.Fatal("expected addresses outside the banned /64 prefix to " +
+			"not be banned")
+	}
+	_, err = hub.BanIP("::ffff:10.0.0.2", time.Minute, "", "admin")
+	if err != nil {
+		t.Fatalf("[BanIP] unexpected error: %v", err)
+	}
+	if !hub.isBanned(net.ParseIP("10.0.0.2")) {
+		t.Fatal("expected the IPv4-mapped address to be banned as IPv4")
+	}
+
+	// Ensure trace logging is toggled per client and per account.
+	hub.SetTrace(xID, true)
+	hub.SetTrace("00000000/cpu", true)
+	if !hub.isTraced("ffffffff/cpu", xID) {
+		t.Fatal("[isTraced] expected clients of account x to be traced")
+	}
+	if !hub.isTraced("00000000/cpu", "") {
+		t.Fatal("[isTraced] expected the client to be traced")
+	}
+	if hub.isTraced("ffffffff/cpu", yID) {
+		t.Fatal("[isTraced] expected clients of account y not to be traced")
+	}
+	if traced := hub.FetchTraced(); len(traced) != 2 {
+		t.Fatalf("[FetchTraced] expected 2 traced ids, got %d", len(traced))
+	}
+	hub.SetTrace(xID, false)
+	hub.SetTrace("00000000/cpu", false)
+	if hub.isTraced("00000000/cpu", xID) {
+		t.Fatal("[isTraced] expected tracing to be disabled")
+	}
+
+	// Ensure a client flooding the pool with submissions can be
+	// disconnected and gets notified of the reason.
+	reason := "too many submissions"
+	go func() {
+		id := uint64(1)
+		for {
+			req := SubmitWorkRequest(&id, "worker", "job", "00000000",
+				"00000000", "00000000")
+			b, err := json.Marshal(req)
+			if err != nil {
+				return
+			}
+			_, err = srvA.Write(append(b, '\n'))
+			if err != nil {
+				return
+			}
+			id++
+		}
+	}()
+	notified := make(chan bool)
+	go func() {
+		var received bool
+		scanner := bufio.NewScanner(srvA)
+		for scanner.Scan() {
+			msg, _, err := IdentifyMessage(scanner.Bytes())
+			if err != nil {
+				continue
+			}
+			if req, ok := msg.(*Request); ok && req.Method == ShowMessage {
+				message, err := ParseShowMessageNotification(req)
+				received = err == nil && message == reason
+			}
+		}
+		notified <- received
+	}()
+	clientID := hub.FetchAccountClientInfo("")[0].ID
+	if n := hub.DisconnectClient(clientID, reason); n != 1 {
+		t.Fatalf("[DisconnectClient] expected 1 affected connection, "+
+			"got %d", n)
+	}
+	select {
+	case received := <-notified:
+		if !received {
+			t.Fatal("expected the disconnected client to be notified")
+		}
+	case <-time.After(time.Second * 10):
+		t.Fatal("expected the disconnected client's connection to close")
+	}
+	for i := 0; i < 100 && hub.HasClients(); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if hub.HasClients() {
+		t.Fatal("expected hub to have no clients")
+	}
+
+	// Ensure banned hosts are disconnected and rejected.
+	connB, srvB, err := makeConn(ln, serverCh)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer connB.Close()
+	defer srvB.Close()
+	msgB := &connection{
+		Conn: connB,
+		Done: make(chan bool),
+	}
+	cpuEndpoint.connCh <- msgB
+	<-msgB.Done
+	n, err := hub.BanIP(host, time.Minute, "", "admin")
+	if err != nil {
+		t.Fatalf("[BanIP] unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("[BanIP] expected 1 affected connection, got %d", n)
+	}
+	connC, srvC, err := makeConn(ln, serverCh)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer connC.Close()
+	defer srvC.Close()
+	msgC := &connection{
+		Conn: connC,
+		Done: make(chan bool),
+	}
+	cpuEndpoint.connCh <- msgC
+	<-msgC.Done
+	cpuEndpoint.clientsMtx.Lock()
+	for _, client := range cpuEndpoint.clients {
+		if client.conn == connC {
+			t.Fatalf("expected connection from banned host %s to be "+
+				"rejected", host)
+		}
+	}
+	cpuEndpoint.clientsMtx.Unlock()
+	if !hub.isBanned(net.ParseIP(host)) {
+		t.Fatalf("expected host %s to be banned", host)
+	}
+
+	// Empty the share and ban buckets.
+	for _, bkt := range [][]byte{shareBkt, banBkt, banAuditBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
 	}
 
 	cancel()
@@ -10,9 +10,10 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"time"
+	"sync"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
 )
 
 // Job represents cached copies of work delivered to clients.
@@ -30,17 +31,41 @@ func nanoToBigEndianBytes(nano int64) []byte {
 	return b
 }
 
-// GenerateJobID generates a unique job id of the provided block height.
-func GenerateJobID(height uint32) (string, error) {
-	buf := bytes.Buffer{}
-	buf.Write(heightToBigEndianBytes(height))
-	buf.Write(nanoToBigEndianBytes(time.Now().UnixNano()))
-	return hex.EncodeToString(buf.Bytes()), nil
+// jobIDHashSize is the number of bytes of the header hash included in job
+// ids.
+const jobIDHashSize = 4
+
+// GenerateJobID generates the job id of the provided block header at the
+// provided height. Job ids are derived from the header, the same template
+// rolled to the same timestamp always yields the same id across restarts
+// and pool instances. The id is the big endian height and header timestamp
+// followed by a truncated hash of the header, the height and timestamp
+// keep ids of distinct rolls unique. Ids are hex encoded to 24 characters.
+// Earlier job ids were the big endian height followed by the nanosecond
+// creation time, jobs persisted with them remain fetchable.
+func GenerateJobID(header string, height uint32) (string, error) {
+	headerB, err := hex.DecodeString(header)
+	if err != nil {
+		desc := "unable to decode block header"
+		return "", MakeError(ErrDecode, desc, err)
+	}
+	if len(headerB) < 140 {
+		desc := fmt.Sprintf("block header of %d bytes is too short",
+			len(headerB))
+		return "", MakeError(ErrDecode, desc, nil)
+	}
+	timestamp := binary.LittleEndian.Uint32(headerB[136:140])
+	id := make([]byte, 8, 8+jobIDHashSize)
+	binary.BigEndian.PutUint32(id[:4], height)
+	binary.BigEndian.PutUint32(id[4:], timestamp)
+	id = append(id, chainhash.HashB(headerB)[:jobIDHashSize]...)
+	return hex.EncodeToString(id), nil
 }
 
-// NewJob creates a job instance.
+// NewJob creates a job instance of the provided block header, identified by
+// the job id derived from it.
 func NewJob(header string, height uint32) (*Job, error) {
-	id, err := GenerateJobID(height)
+	id, err := GenerateJobID(header, height)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +93,9 @@ func fetchJobBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
 	return bkt, nil
 }
 
-// FetchJob fetches the job referenced by the provided id.
+// FetchJob fetches the job referenced by the provided id. Jobs created
+// before ids were derived from their header are fetched by their random
+// ids.
 func FetchJob(db *bolt.DB, id []byte) (*Job, error) {
 	var job Job
 	err := db.View(func(tx *bolt.Tx) error {
@@ -121,7 +148,8 @@ func (job *Job) Delete(db *bolt.DB) error {
 	return deleteEntry(db, jobBkt, []byte(job.UUID))
 }
 
-// PruneJobs removes all jobs with heights less than the provided height.
+// PruneJobs removes all jobs with heights less than the provided height,
+// along with the recorded submissions of those jobs.
 func PruneJobs(db *bolt.DB, height uint32) error {
 	heightBE := heightToBigEndianBytes(height)
 	err := db.Update(func(tx *bolt.Tx) error {
@@ -150,8 +178,102 @@ func PruneJobs(db *bolt.DB, height uint32) error {
 			}
 		}
 
-		return nil
+		return pruneSubmissions(tx, heightBE)
 	})
 
 	return err
 }
+
+// defaultJobCacheSize represents the default number of jobs retained by a
+// job cache.
+const defaultJobCacheSize = 64
+
+// JobCache retains the most recently created jobs in memory so submissions
+// for them can be validated without a database lookup. Once full, the
+// oldest job is evicted for every job added.
+type JobCache struct {
+	jobs  map[string]*Job
+	order []string
+	size  int
+	mtx   sync.RWMutex
+}
+
+// NewJobCache creates a job cache retaining up to the provided number of
+// jobs, zero for the default.
+func NewJobCache(size int) *JobCache {
+	if size <= 0 {
+		size = defaultJobCacheSize
+	}
+	return &JobCache{
+		jobs:  make(map[string]*Job, size),
+		order: make([]string, 0, size),
+		size:  size,
+	}
+}
+
+// add caches the provided job, evicting the oldest cached job if the cache
+// is full.
+func (jc *JobCache) add(job *Job) {
+	if jc == nil {
+		return
+	}
+	jc.mtx.Lock()
+	defer jc.mtx.Unlock()
+	if _, ok := jc.jobs[job.UUID]; ok {
+		return
+	}
+	if len(jc.order) == jc.size {
+		delete(jc.jobs, jc.order[0])
+		jc.order = append(jc.order[:0], jc.order[1:]...)
+	}
+	jc.jobs[job.UUID] = job
+	jc.order = append(jc.order, job.UUID)
+}
+
+// fetch returns the cached job with the provided id, nil if it is not
+// cached.
+func (jc *JobCache) fetch(id string) *Job {
+	if jc == nil {
+		return nil
+	}
+	jc.mtx.RLock()
+	defer jc.mtx.RUnlock()
+	return jc.jobs[id]
+}
+
+// remove evicts the cached job with the provided id.
+func (jc *JobCache) remove(id string) {
+	if jc == nil {
+		return
+	}
+	jc.mtx.Lock()
+	defer jc.mtx.Unlock()
+	if _, ok := jc.jobs[id]; !ok {
+		return
+	}
+	delete(jc.jobs, id)
+	for i, cached := range jc.order {
+		if cached == id {
+			jc.order = append(jc.order[:i], jc.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// prune evicts all cached jobs with heights less than the provided height.
+func (jc *JobCache) prune(height uint32) {
+	if jc == nil {
+		return
+	}
+	jc.mtx.Lock()
+	defer jc.mtx.Unlock()
+	order := jc.order[:0]
+	for _, id := range jc.order {
+		if jc.jobs[id].Height < height {
+			delete(jc.jobs, id)
+			continue
+		}
+		order = append(order, id)
+	}
+	jc.order = order
+}
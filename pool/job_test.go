@@ -1,8 +1,10 @@
 package pool
 
 import (
+	"encoding/hex"
 	"fmt"
 	"testing"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
 )
@@ -50,8 +52,65 @@ func testJob(t *testing.T, db *bolt.DB) {
 		t.Fatal(err)
 	}
 
+	// Ensure job ids are derived from the header, the same template always
+	// yields the same id while rolled timestamps and other templates yield
+	// different ids.
+	if len(jobA.UUID) != 24 {
+		t.Fatalf("expected a 24 character job id, got %s", jobA.UUID)
+	}
+	sameJob, err := NewJob(jobA.Header, jobA.Height)
+	if err != nil {
+		t.Fatalf("[NewJob] unexpected error: %v", err)
+	}
+	if sameJob.UUID != jobA.UUID {
+		t.Fatalf("expected job id %s for the same template, got %s",
+			jobA.UUID, sameJob.UUID)
+	}
+	rolledHeader := jobA.Header[:272] + "f271cc5d" + jobA.Header[280:]
+	rolledJob, err := NewJob(rolledHeader, jobA.Height)
+	if err != nil {
+		t.Fatalf("[NewJob] unexpected error: %v", err)
+	}
+	if rolledJob.UUID == jobA.UUID {
+		t.Fatal("expected a different job id for a rolled timestamp")
+	}
+	otherHeader := jobA.Header[:8] + jobB.Header[8:72] + jobA.Header[72:]
+	otherJob, err := NewJob(otherHeader, jobA.Height)
+	if err != nil {
+		t.Fatalf("[NewJob] unexpected error: %v", err)
+	}
+	if otherJob.UUID == jobA.UUID {
+		t.Fatal("expected a different job id for a different template")
+	}
+	_, err = NewJob(jobA.Header[:200], jobA.Height)
+	if !IsError(err, ErrDecode) {
+		t.Fatalf("expected a decode error for a truncated header, got %v",
+			err)
+	}
+
+	// Ensure jobs persisted with random ids remain fetchable and prunable.
+	legacyID := append(heightToBigEndianBytes(55),
+		nanoToBigEndianBytes(time.Now().UnixNano())...)
+	legacyJob := &Job{
+		UUID:   hex.EncodeToString(legacyID),
+		Height: 55,
+		Header: jobA.Header,
+	}
+	err = legacyJob.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	fetchedJob, err := FetchJob(db, []byte(legacyJob.UUID))
+	if err != nil {
+		t.Fatalf("FetchJob err: %v", err)
+	}
+	if fetchedJob.Height != legacyJob.Height {
+		t.Fatalf("expected a legacy job at height %d, got %d",
+			legacyJob.Height, fetchedJob.Height)
+	}
+
 	// Fetch a job using its id.
-	fetchedJob, err := FetchJob(db, []byte(jobA.UUID))
+	fetchedJob, err = FetchJob(db, []byte(jobA.UUID))
 	if err != nil {
 		t.Fatalf("FetchJob err: %v", err)
 	}
@@ -75,6 +134,11 @@ func testJob(t *testing.T, db *bolt.DB) {
 		t.Fatalf("PruneJobs error: %v", err)
 	}
 
+	_, err = FetchJob(db, []byte(legacyJob.UUID))
+	if !IsError(err, ErrValueNotFound) {
+		t.Fatalf("expected the legacy job to be pruned, got %v", err)
+	}
+
 	// Delete the last remaining job.
 	err = jobC.Delete(db)
 	if err != nil {
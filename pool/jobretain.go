@@ -0,0 +1,254 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"container/list"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// JobRetainerConfig represents configuration details for the job retainer.
+type JobRetainerConfig struct {
+	// DB represents the pool database.
+	DB *bolt.DB
+	// MaxJobs represents the maximum number of jobs retained in the
+	// database, zero to retain jobs until they are pruned by height.
+	MaxJobs uint32
+	// HoldPeriod represents the period an evicted job remains resolvable
+	// after it was last notified to a client. It covers the read deadline
+	// of clients so submissions in flight for evicted jobs are not stale.
+	HoldPeriod time.Duration
+	// JobCache retains recently created jobs in memory, nil if jobs are
+	// not cached.
+	JobCache *JobCache
+}
+
+// retainedJob represents a job retained in the database.
+type retainedJob struct {
+	id       string
+	height   uint32
+	notified int64
+}
+
+// heldJob represents a job evicted from the database which remains
+// resolvable until its hold period after it was last notified ends.
+type heldJob struct {
+	job      *Job
+	notified int64
+}
+
+// JobRetainer caps the number of jobs retained in the database, evicting
+// the least recently notified job for every job retained beyond the cap.
+// Evicted jobs notified within the hold period are held in memory along
+// with their recorded submissions, so in-flight submissions of evicted
+// jobs still validate and duplicates of them are still refused.
+type JobRetainer struct {
+	cfg   *JobRetainerConfig
+	lru   *list.List
+	elems map[string]*list.Element
+	held  map[string]*heldJob
+	mtx   sync.Mutex
+}
+
+// jobHeight returns the height of the job with the provided id, zero if
+// the id does not carry a height.
+func jobHeight(id string) uint32 {
+	if len(id) < 8 {
+		return 0
+	}
+	heightB, err := hex.DecodeString(id[:8])
+	if err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(heightB)
+}
+
+// NewJobRetainer creates a job retainer tracking the jobs persisted to the
+// database. Jobs persisted before the retainer was created are considered
+// less recently notified than jobs retained afterwards, in key order.
+func NewJobRetainer(jCfg *JobRetainerConfig) (*JobRetainer, error) {
+	jr := &JobRetainer{
+		cfg:   jCfg,
+		lru:   list.New(),
+		elems: make(map[string]*list.Element),
+		held:  make(map[string]*heldJob),
+	}
+	err := jCfg.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchJobBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, _ []byte) error {
+			id := string(k)
+			jr.elems[id] = jr.lru.PushFront(&retainedJob{
+				id:     id,
+				height: jobHeight(id),
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jr, nil
+}
+
+// retain tracks the provided job persisted to the database as notified
+// and evicts the least recently notified jobs beyond the cap. Jobs held
+// past their hold period are released.
+func (jr *JobRetainer) retain(job *Job) error {
+	if jr == nil {
+		return nil
+	}
+	now := time.Now().UnixNano()
+	jr.mtx.Lock()
+	defer jr.mtx.Unlock()
+	if elem, ok := jr.elems[job.UUID]; ok {
+		elem.Value.(*retainedJob).notified = now
+		jr.lru.MoveToFront(elem)
+	} else {
+		jr.elems[job.UUID] = jr.lru.PushFront(&retainedJob{
+			id:       job.UUID,
+			height:   job.Height,
+			notified: now,
+		})
+	}
+	return jr.evict(now)
+}
+
+// touch tracks the job with the provided id as notified to a client.
+func (jr *JobRetainer) touch(id string) {
+	if jr == nil {
+		return
+	}
+	now := time.Now().UnixNano()
+	jr.mtx.Lock()
+	if elem, ok := jr.elems[id]; ok {
+		elem.Value.(*retainedJob).notified = now
+		jr.lru.MoveToFront(elem)
+	} else if held, ok := jr.held[id]; ok {
+		held.notified = now
+	}
+	jr.mtx.Unlock()
+}
+
+// evict removes the least recently notified jobs beyond the cap from the
+// database and the job cache, holding those notified within the hold
+// period. The recorded submissions of evicted jobs not held and of held
+// jobs past their hold period are removed. The retainer must be locked.
+func (jr *JobRetainer) evict(now int64) error {
+	holdMin := now - int64(jr.cfg.HoldPeriod)
+	released := make([]string, 0)
+	for id, held := range jr.held {
+		if held.notified < holdMin {
+			released = append(released, id)
+		}
+	}
+	evicted := make([]*retainedJob, 0)
+	if jr.cfg.MaxJobs > 0 {
+		excess := jr.lru.Len() - int(jr.cfg.MaxJobs)
+		for elem := jr.lru.Back(); elem != nil && len(evicted) < excess; elem = elem.Prev() {
+			evicted = append(evicted, elem.Value.(*retainedJob))
+		}
+	}
+	if len(released) == 0 && len(evicted) == 0 {
+		return nil
+	}
+	held := make(map[string]*heldJob)
+	err := jr.cfg.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchJobBucket(tx)
+		if err != nil {
+			return err
+		}
+		for _, retained := range evicted {
+			key := []byte(retained.id)
+			if retained.notified >= holdMin {
+				if v := bkt.Get(key); v != nil {
+					var job Job
+					err := json.Unmarshal(v, &job)
+					if err != nil {
+						return err
+					}
+					held[retained.id] = &heldJob{
+						job:      &job,
+						notified: retained.notified,
+					}
+				}
+			}
+			err := bkt.Delete(key)
+			if err != nil {
+				return err
+			}
+			if _, ok := held[retained.id]; !ok {
+				released = append(released, retained.id)
+			}
+		}
+		for _, id := range released {
+			err := deleteJobSubmissions(tx, id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range released {
+		delete(jr.held, id)
+	}
+	for _, retained := range evicted {
+		jr.lru.Remove(jr.elems[retained.id])
+		delete(jr.elems, retained.id)
+		jr.cfg.JobCache.remove(retained.id)
+	}
+	for id, job := range held {
+		jr.held[id] = job
+	}
+	return nil
+}
+
+// fetch returns the held job with the provided id, nil if the job is not
+// held or is past its hold period.
+func (jr *JobRetainer) fetch(id string) *Job {
+	if jr == nil {
+		return nil
+	}
+	holdMin := time.Now().Add(-jr.cfg.HoldPeriod).UnixNano()
+	jr.mtx.Lock()
+	defer jr.mtx.Unlock()
+	held, ok := jr.held[id]
+	if !ok || held.notified < holdMin {
+		return nil
+	}
+	return held.job
+}
+
+// prune stops tracking all jobs with heights less than the provided
+// height, they are removed from the database by height.
+func (jr *JobRetainer) prune(height uint32) {
+	if jr == nil {
+		return
+	}
+	jr.mtx.Lock()
+	defer jr.mtx.Unlock()
+	for id, elem := range jr.elems {
+		if elem.Value.(*retainedJob).height < height {
+			jr.lru.Remove(elem)
+			delete(jr.elems, id)
+		}
+	}
+	for id, held := range jr.held {
+		if held.job.Height < height {
+			delete(jr.held, id)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package pool
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+	"github.com/Eacred/eacrd/wire"
+)
+
+// countBucketKeys returns the number of keys of the provided bucket.
+func countBucketKeys(db *bolt.DB, bucket []byte) (int, error) {
+	var count int
+	err := db.View(func(tx *bolt.Tx) error {
+		pbkt := tx.Bucket(poolBkt)
+		if pbkt == nil {
+			return fmt.Errorf("bucket %s not found", string(poolBkt))
+		}
+		bkt := pbkt.Bucket(bucket)
+		if bkt == nil {
+			return fmt.Errorf("bucket %s not found", string(bucket))
+		}
+		count = bkt.Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+func testJobRetainer(t *testing.T, db *bolt.DB) {
+	const maxJobs = 8
+	jobCache := NewJobCache(0)
+	jr, err := NewJobRetainer(&JobRetainerConfig{
+		DB:         db,
+		MaxJobs:    maxJobs,
+		HoldPeriod: time.Minute,
+		JobCache:   jobCache,
+	})
+	if err != nil {
+		t.Fatalf("[NewJobRetainer] unexpected error: %v", err)
+	}
+	cCfg := &ClientConfig{
+		JobCache:    jobCache,
+		JobRetainer: jr,
+		SubmitWork: func(*string) (bool, string, error) {
+			return false, "", nil
+		},
+	}
+	client, err := fastPathClient(db, cCfg)
+	if err != nil {
+		t.Fatalf("[fastPathClient] unexpected error: %v", err)
+	}
+
+	// Ensure a burst of timestamp rolls never grows the job bucket beyond
+	// the cap, evicting the least recently notified jobs.
+	jobs := make([]*Job, 0)
+	for i := 0; i < 100; i++ {
+		job, err := fastPathJob(fmt.Sprintf("%08x", 0x5dee4c95+i), true)
+		if err != nil {
+			t.Fatalf("[fastPathJob] unexpected error: %v", err)
+		}
+		err = job.Create(db)
+		if err != nil {
+			t.Fatalf("[Create] unexpected error: %v", err)
+		}
+		jobCache.add(job)
+		err = jr.retain(job)
+		if err != nil {
+			t.Fatalf("[retain] unexpected error: %v", err)
+		}
+		_, err = recordSubmission(db, job.UUID, &chainhash.Hash{byte(i)})
+		if err != nil {
+			t.Fatalf("[recordSubmission] unexpected error: %v", err)
+		}
+		jobs = append(jobs, job)
+
+		// Keep notifying the first job, it must never be evicted.
+		jr.touch(jobs[0].UUID)
+
+		count, err := countBucketKeys(db, jobBkt)
+		if err != nil {
+			t.Fatalf("[countBucketKeys] unexpected error: %v", err)
+		}
+		if count > maxJobs {
+			t.Fatalf("expected at most %d retained jobs, got %d", maxJobs,
+				count)
+		}
+	}
+	_, err = FetchJob(db, []byte(jobs[0].UUID))
+	if err != nil {
+		t.Fatalf("expected the recently notified job to be retained: %v",
+			err)
+	}
+	_, err = FetchJob(db, []byte(jobs[1].UUID))
+	if !IsError(err, ErrValueNotFound) {
+		t.Fatalf("expected the least recently notified job to be evicted, "+
+			"got %v", err)
+	}
+	if jobCache.fetch(jobs[1].UUID) != nil {
+		t.Fatal("expected the evicted job to be removed from the job cache")
+	}
+
+	// Ensure submissions for evicted jobs notified within the hold period
+	// still validate and duplicates of them are still refused.
+	id := uint64(1)
+	submit := func(jobID string, nonce string) *StratumError {
+		req, err := fastPathRequest(SubmitWorkRequest(&id, "tcl", jobID,
+			"00000000", "954cee5d", nonce))
+		if err != nil {
+			t.Fatalf("[fastPathRequest] unexpected error: %v", err)
+		}
+		client.handleSubmitWorkRequest(req, true, client.fetchDifficultyInfo())
+		status, sErr, err := ParseSubmitWorkResponse((<-client.ch).(*Response))
+		if err != nil {
+			t.Fatalf("[ParseSubmitWorkResponse] unexpected error: %v", err)
+		}
+		if status {
+			return nil
+		}
+		return sErr
+	}
+	for _, job := range []*Job{jobs[1], jobs[50], jobs[99]} {
+		if sErr := submit(job.UUID, "00000001"); sErr != nil {
+			t.Fatalf("expected the share of job %s to be accepted, got %v",
+				job.UUID, sErr)
+		}
+	}
+	sErr := submit(jobs[1].UUID, "00000001")
+	if sErr == nil || sErr.Code != DuplicateShare {
+		t.Fatalf("expected a duplicate share error, got %v", sErr)
+	}
+
+	// Ensure evicted jobs past their hold period are stale and their
+	// recorded submissions are removed.
+	jr.cfg.HoldPeriod = 0
+	job, err := fastPathJob("00000000", true)
+	if err != nil {
+		t.Fatalf("[fastPathJob] unexpected error: %v", err)
+	}
+	err = job.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	err = jr.retain(job)
+	if err != nil {
+		t.Fatalf("[retain] unexpected error: %v", err)
+	}
+	if len(jr.held) != 0 {
+		t.Fatalf("expected no held jobs, got %d", len(jr.held))
+	}
+	sErr = submit(jobs[1].UUID, "00000002")
+	if sErr == nil || sErr.Code != StaleJob {
+		t.Fatalf("expected a stale job error, got %v", sErr)
+	}
+	for _, job := range []*Job{jobs[1], jobs[50]} {
+		err = db.View(func(tx *bolt.Tx) error {
+			bkt, err := fetchSubmissionBucket(tx)
+			if err != nil {
+				return err
+			}
+			prefix := []byte(job.UUID)
+			k, _ := bkt.Cursor().Seek(prefix)
+			if k != nil && bytes.HasPrefix(k, prefix) {
+				return fmt.Errorf("submission %s of released job %s "+
+					"still recorded", k, job.UUID)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	retained, err := countBucketKeys(db, jobBkt)
+	if err != nil {
+		t.Fatalf("[countBucketKeys] unexpected error: %v", err)
+	}
+	if retained != maxJobs {
+		t.Fatalf("expected %d retained jobs, got %d", maxJobs, retained)
+	}
+
+	// Ensure a restarted retainer tracks the persisted jobs.
+	restarted, err := NewJobRetainer(&JobRetainerConfig{
+		DB:      db,
+		MaxJobs: maxJobs,
+	})
+	if err != nil {
+		t.Fatalf("[NewJobRetainer] unexpected error: %v", err)
+	}
+	if restarted.lru.Len() != maxJobs {
+		t.Fatalf("expected %d tracked jobs, got %d", maxJobs,
+			restarted.lru.Len())
+	}
+	restarted.prune(42)
+	if restarted.lru.Len() != 0 {
+		t.Fatalf("expected pruned jobs to be untracked, got %d",
+			restarted.lru.Len())
+	}
+
+	for _, bkt := range [][]byte{jobBkt, submissionBkt, shareBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+}
+
+func testJobRetainerPruning(t *testing.T) {
+	const maxJobs = 4
+	th, err := NewTestHub(&TestHubConfig{
+		ActiveNet: chaincfg.SimNetParams(),
+		GetWork: func() (string, error) {
+			return fastPathWorkE, nil
+		},
+		Configure: func(hcfg *HubConfig) {
+			hcfg.MaxJobs = maxJobs
+		},
+	})
+	if err != nil {
+		t.Fatalf("[NewTestHub] unexpected error: %v", err)
+	}
+	defer th.Close()
+	hub := th.Hub()
+	jr := hub.jobs
+	if hub.chainState.cfg.JobRetainer != jr || jr == nil {
+		t.Fatal("expected the chain state to hold the hub's job retainer")
+	}
+
+	// Retain jobs beyond the cap so the least recently notified ones are
+	// held.
+	for i := 0; i < maxJobs*2; i++ {
+		job, err := fastPathJob(fmt.Sprintf("%08x", 0x5dee4c95+i), true)
+		if err != nil {
+			t.Fatalf("[fastPathJob] unexpected error: %v", err)
+		}
+		err = job.Create(hub.db)
+		if err != nil {
+			t.Fatalf("[Create] unexpected error: %v", err)
+		}
+		err = jr.retain(job)
+		if err != nil {
+			t.Fatalf("[retain] unexpected error: %v", err)
+		}
+	}
+	if len(jr.elems) != maxJobs || len(jr.held) != maxJobs {
+		t.Fatalf("expected %d retained and %d held jobs, got %d and %d",
+			maxJobs, maxJobs, len(jr.elems), len(jr.held))
+	}
+
+	// Ensure connecting a block past the reorg limit of the jobs prunes
+	// them from the retainer.
+	header := &wire.BlockHeader{Height: 41 + MaxReorgLimit + 1}
+	err = hub.chainState.connectBlock(header)
+	if err != nil {
+		t.Fatalf("[connectBlock] unexpected error: %v", err)
+	}
+	if len(jr.elems) != 0 || jr.lru.Len() != 0 {
+		t.Fatalf("expected no retained jobs, got %d", len(jr.elems))
+	}
+	if len(jr.held) != 0 {
+		t.Fatalf("expected no held jobs, got %d", len(jr.held))
+	}
+}
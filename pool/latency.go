@@ -0,0 +1,221 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The stages of a work submission timed by the pool.
+const (
+	stageJobFetch = iota
+	stageHeader
+	stageTarget
+	stageShareClaim
+	stageSubmit
+	numSubmitStages
+)
+
+var (
+	// submitStageNames represents the names of the work submission stages.
+	submitStageNames = [numSubmitStages]string{
+		"jobfetch", "header", "target", "shareclaim", "submit",
+	}
+
+	// latencyBuckets represents the upper bounds of the latency histogram
+	// buckets, latencies above the last bound are counted in an additional
+	// overflow bucket.
+	latencyBuckets = []time.Duration{
+		time.Millisecond, time.Millisecond * 5, time.Millisecond * 10,
+		time.Millisecond * 50, time.Millisecond * 100,
+		time.Millisecond * 500, time.Second,
+	}
+
+	// latencyWindow represents the period latencies are aggregated over
+	// before the histograms roll over. Histograms report the current and
+	// previous windows.
+	latencyWindow = time.Minute * 10
+)
+
+// StageLatency represents the rolling latency histogram of a work
+// submission stage.
+type StageLatency struct {
+	Stage string
+	Count uint64
+	Mean  time.Duration
+	Max   time.Duration
+	// Buckets represents the number of latencies at or below each of the
+	// latency bucket bounds, the last bucket counts latencies above them.
+	Buckets []uint64
+}
+
+// latencyHistogram represents the latencies of a stage within a window.
+type latencyHistogram struct {
+	count   uint64
+	total   time.Duration
+	max     time.Duration
+	buckets []uint64
+}
+
+// newLatencyHistogram creates an empty latency histogram.
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{
+		buckets: make([]uint64, len(latencyBuckets)+1),
+	}
+}
+
+// add records the provided latency.
+func (h *latencyHistogram) add(d time.Duration) {
+	h.count++
+	h.total += d
+	if d > h.max {
+		h.max = d
+	}
+	idx := len(latencyBuckets)
+	for i, bound := range latencyBuckets {
+		if d <= bound {
+			idx = i
+			break
+		}
+	}
+	h.buckets[idx]++
+}
+
+// submitTimer times the stages of a single work submission. A disabled
+// timer does not read the clock.
+type submitTimer struct {
+	enabled bool
+	start   time.Time
+	last    time.Time
+	reached [numSubmitStages]bool
+	stages  [numSubmitStages]time.Duration
+}
+
+// newSubmitTimer creates a submit timer, starting it if enabled.
+func newSubmitTimer(enabled bool) *submitTimer {
+	t := &submitTimer{enabled: enabled}
+	if enabled {
+		t.start = time.Now()
+		t.last = t.start
+	}
+	return t
+}
+
+// mark records the completion of the provided stage.
+func (t *submitTimer) mark(stage int) {
+	if !t.enabled {
+		return
+	}
+	now := time.Now()
+	t.stages[stage] = now.Sub(t.last)
+	t.reached[stage] = true
+	t.last = now
+}
+
+// total returns the time elapsed up to the last completed stage.
+func (t *submitTimer) total() time.Duration {
+	return t.last.Sub(t.start)
+}
+
+// String returns the durations of the completed stages.
+func (t *submitTimer) String() string {
+	parts := make([]string, 0, numSubmitStages)
+	for stage, reached := range t.reached {
+		if reached {
+			parts = append(parts, fmt.Sprintf("%s=%v",
+				submitStageNames[stage], t.stages[stage]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// LatencyRecorder maintains rolling latency histograms of the stages of
+// work submissions.
+type LatencyRecorder struct {
+	slowThreshold time.Duration
+	windowStart   time.Time
+	current       [numSubmitStages]*latencyHistogram
+	previous      [numSubmitStages]*latencyHistogram
+	mtx           sync.Mutex
+}
+
+// NewLatencyRecorder creates a latency recorder. Submissions taking longer
+// than the provided threshold are logged with their stage breakdown, a zero
+// threshold disables the warnings.
+func NewLatencyRecorder(slowThreshold time.Duration) *LatencyRecorder {
+	r := &LatencyRecorder{
+		slowThreshold: slowThreshold,
+		windowStart:   time.Now(),
+	}
+	for stage := range r.current {
+		r.current[stage] = newLatencyHistogram()
+		r.previous[stage] = newLatencyHistogram()
+	}
+	return r
+}
+
+// roll moves the current window to the previous window if it has elapsed.
+// This must be called with the recorder lock held.
+func (r *LatencyRecorder) roll(now time.Time) {
+	elapsed := now.Sub(r.windowStart)
+	if elapsed < latencyWindow {
+		return
+	}
+	for stage := range r.current {
+		r.previous[stage] = r.current[stage]
+		if elapsed >= latencyWindow*2 {
+			r.previous[stage] = newLatencyHistogram()
+		}
+		r.current[stage] = newLatencyHistogram()
+	}
+	r.windowStart = now
+}
+
+// record adds the stage latencies of the provided submit timer to the
+// histograms. It returns true if the submission is slow.
+func (r *LatencyRecorder) record(t *submitTimer) bool {
+	r.mtx.Lock()
+	r.roll(time.Now())
+	for stage, reached := range t.reached {
+		if reached {
+			r.current[stage].add(t.stages[stage])
+		}
+	}
+	r.mtx.Unlock()
+	return r.slowThreshold > 0 && t.total() > r.slowThreshold
+}
+
+// fetchLatencies returns the latency histograms of all stages over the
+// current and previous windows.
+func (r *LatencyRecorder) fetchLatencies() []*StageLatency {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.roll(time.Now())
+	latencies := make([]*StageLatency, 0, numSubmitStages)
+	for stage := range r.current {
+		curr, prev := r.current[stage], r.previous[stage]
+		latency := &StageLatency{
+			Stage:   submitStageNames[stage],
+			Count:   curr.count + prev.count,
+			Max:     curr.max,
+			Buckets: make([]uint64, len(curr.buckets)),
+		}
+		if prev.max > latency.Max {
+			latency.Max = prev.max
+		}
+		if latency.Count > 0 {
+			latency.Mean = (curr.total + prev.total) /
+				time.Duration(latency.Count)
+		}
+		for i := range latency.Buckets {
+			latency.Buckets[i] = curr.buckets[i] + prev.buckets[i]
+		}
+		latencies = append(latencies, latency)
+	}
+	return latencies
+}
@@ -0,0 +1,80 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func testLatencyRecorder(t *testing.T) {
+	// Ensure a disabled submit timer does not time stages.
+	timer := newSubmitTimer(false)
+	timer.mark(stageJobFetch)
+	if timer.reached[stageJobFetch] {
+		t.Fatal("expected a disabled timer to not mark stages")
+	}
+	if timer.total() != 0 {
+		t.Fatalf("expected a zero total for a disabled timer, got %v",
+			timer.total())
+	}
+
+	// Ensure only reached stages are recorded.
+	recorder := NewLatencyRecorder(time.Millisecond * 20)
+	timer = newSubmitTimer(true)
+	timer.start = timer.start.Add(-time.Millisecond * 30)
+	timer.stages[stageJobFetch] = time.Millisecond * 3
+	timer.reached[stageJobFetch] = true
+	timer.stages[stageSubmit] = time.Second * 2
+	timer.reached[stageSubmit] = true
+	if !recorder.record(timer) {
+		t.Fatal("expected the submission to be reported as slow")
+	}
+
+	latencies := recorder.fetchLatencies()
+	if len(latencies) != numSubmitStages {
+		t.Fatalf("expected %d stage latencies, got %d", numSubmitStages,
+			len(latencies))
+	}
+	jobFetch := latencies[stageJobFetch]
+	if jobFetch.Count != 1 || jobFetch.Mean != time.Millisecond*3 {
+		t.Fatalf("unexpected job fetch latency: count %d, mean %v",
+			jobFetch.Count, jobFetch.Mean)
+	}
+	if jobFetch.Buckets[1] != 1 {
+		t.Fatalf("expected the job fetch latency in the 5ms bucket, "+
+			"got %v", jobFetch.Buckets)
+	}
+	submit := latencies[stageSubmit]
+	if submit.Buckets[len(latencyBuckets)] != 1 {
+		t.Fatalf("expected the submit latency in the overflow bucket, "+
+			"got %v", submit.Buckets)
+	}
+	if latencies[stageHeader].Count != 0 {
+		t.Fatalf("expected no header latencies, got %d",
+			latencies[stageHeader].Count)
+	}
+
+	// Ensure fast submissions are not reported as slow.
+	timer = newSubmitTimer(true)
+	timer.mark(stageJobFetch)
+	if recorder.record(timer) {
+		t.Fatal("expected the submission to not be reported as slow")
+	}
+
+	// Ensure recorded latencies expire after two windows.
+	recorder.mtx.Lock()
+	recorder.windowStart = recorder.windowStart.Add(-latencyWindow)
+	recorder.mtx.Unlock()
+	latencies = recorder.fetchLatencies()
+	if latencies[stageJobFetch].Count != 2 {
+		t.Fatalf("expected 2 job fetch latencies in the previous window, "+
+			"got %d", latencies[stageJobFetch].Count)
+	}
+	recorder.mtx.Lock()
+	recorder.windowStart = recorder.windowStart.Add(-latencyWindow)
+	recorder.mtx.Unlock()
+	latencies = recorder.fetchLatencies()
+	if latencies[stageJobFetch].Count != 0 {
+		t.Fatalf("expected expired job fetch latencies, got %d",
+			latencies[stageJobFetch].Count)
+	}
+}
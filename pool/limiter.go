@@ -5,26 +5,42 @@
 package pool
 
 import (
+	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/time/rate"
 )
 
-// Client types.
+// Request classes, requests of each class are rate limited separately.
 const (
 	APIClient = iota
-	PoolClient
+	AuthorizeClass
+	SubscribeClass
+	SubmitClass
 )
 
 const (
-	// clientTokenRate is the token refill rate for the client request bucket,
-	// per second. A maximum of 5 requests per second for a pool client that
-	// will be mostly submitting work to the pool at a controlled rate is
+	// defaultAuthorizeRate is the default token refill rate for the
+	// authorize request bucket, per second. Clients authorize once per
+	// connection, allowing 6 authorizations per minute leaves room for
+	// reconnects while keeping brute-force attempts expensive.
+	defaultAuthorizeRate = 0.1
+	// defaultSubscribeRate is the default token refill rate for the
+	// subscribe request bucket, per second.
+	defaultSubscribeRate = 0.1
+	// defaultSubmitRate is the default minimum token refill rate for the
+	// submit request bucket, per second. A maximum of 5 submissions per
+	// second for a pool client submitting work at a controlled rate is
 	// adequate.
-	clientTokenRate = 5
-	// clientBurst is the maximum token usage allowed per second,
-	// for pool clients.
-	clientBurst = 5
+	defaultSubmitRate = 5
+	// handshakeBurst is the maximum token usage allowed at once for
+	// authorize and subscribe requests.
+	handshakeBurst = 2
+	// submitShareRateFactor is the factor the expected share rate of a
+	// client is scaled by to derive its submission limit.
+	submitShareRateFactor = 10
 	// apiTokenRate is the token refill rate for the api request bucket,
 	// per second.
 	apiTokenRate = 3
@@ -33,63 +49,196 @@ const (
 	apiBurst = 3
 )
 
+// RequestLimits represents the request rates, per second, of the request
+// classes of pool clients. Zero rates take their defaults.
+type RequestLimits struct {
+	Authorize float64
+	Subscribe float64
+	// Submit represents the minimum submission rate, the submission limit
+	// of a client scales with its expected share rate.
+	Submit float64
+}
+
+// limiterKey identifies the request limiter of a request class of a client.
+type limiterKey struct {
+	ip    string
+	class int
+}
+
+// requestLimiter represents the request limiter of a request class of a
+// client along with when it was last used, in nanoseconds.
+type requestLimiter struct {
+	lastUsed int64 // update atomically.
+	limiter  *rate.Limiter
+}
+
 // RateLimiter keeps connected clients within their allocated request rates.
 type RateLimiter struct {
+	limits   RequestLimits
 	mutex    sync.RWMutex
-	limiters map[string]*rate.Limiter
+	limiters map[limiterKey]*requestLimiter
 }
 
-// NewRateLimiter initializes a rate limiter.
-func NewRateLimiter() *RateLimiter {
-	limiters := &RateLimiter{
-		limiters: make(map[string]*rate.Limiter),
+// NewRateLimiter initializes a rate limiter enforcing the provided pool
+// client request limits, default limits are used if none are provided.
+func NewRateLimiter(limits *RequestLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:   resolveRequestLimits(limits),
+		limiters: make(map[limiterKey]*requestLimiter),
 	}
-	return limiters
+}
+
+// resolveRequestLimits returns the provided request limits with zero rates
+// replaced by their defaults.
+func resolveRequestLimits(limits *RequestLimits) RequestLimits {
+	resolved := RequestLimits{
+		Authorize: defaultAuthorizeRate,
+		Subscribe: defaultSubscribeRate,
+		Submit:    defaultSubmitRate,
+	}
+	if limits != nil {
+		if limits.Authorize > 0 {
+			resolved.Authorize = limits.Authorize
+		}
+		if limits.Subscribe > 0 {
+			resolved.Subscribe = limits.Subscribe
+		}
+		if limits.Submit > 0 {
+			resolved.Submit = limits.Submit
+		}
+	}
+	return resolved
+}
+
+// ApplyConfig replaces the request limits of the rate limiter at runtime.
+// Existing authorize and subscribe limiters take the updated rates
+// immediately, submission limiters are rescaled on their next request.
+func (r *RateLimiter) ApplyConfig(limits *RequestLimits) {
+	resolved := resolveRequestLimits(limits)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.limits = resolved
+	for key, reqLimiter := range r.limiters {
+		switch key.class {
+		case AuthorizeClass:
+			reqLimiter.limiter.SetLimit(rate.Limit(resolved.Authorize))
+		case SubscribeClass:
+			reqLimiter.limiter.SetLimit(rate.Limit(resolved.Subscribe))
+		}
+	}
+}
+
+// fetchLimits returns the current request limits of the rate limiter.
+func (r *RateLimiter) fetchLimits() RequestLimits {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.limits
+}
+
+// submitBurst returns the maximum token usage allowed at once for
+// submissions at the provided rate.
+func submitBurst(limit float64) int {
+	return int(math.Max(math.Ceil(limit), defaultSubmitRate))
 }
 
 // addRequestLimiter adds a new client request limiter to the limiter set.
-func (r *RateLimiter) addRequestLimiter(ip string, clientType int) *rate.Limiter {
+func (r *RateLimiter) addRequestLimiter(ip string, class int) *requestLimiter {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	limits := r.limits
 	var limiter *rate.Limiter
-	switch clientType {
+	switch class {
 	case APIClient:
 		limiter = rate.NewLimiter(apiTokenRate, apiBurst)
-	case PoolClient:
-		limiter = rate.NewLimiter(clientTokenRate, clientBurst)
+	case AuthorizeClass:
+		limiter = rate.NewLimiter(rate.Limit(limits.Authorize),
+			handshakeBurst)
+	case SubscribeClass:
+		limiter = rate.NewLimiter(rate.Limit(limits.Subscribe),
+			handshakeBurst)
+	case SubmitClass:
+		limiter = rate.NewLimiter(rate.Limit(limits.Submit),
+			submitBurst(limits.Submit))
 	default:
-		log.Errorf("unknown client type provided: %s", clientType)
+		log.Errorf("unknown request class provided: %d", class)
 		return nil
 	}
-	r.mutex.Lock()
-	r.limiters[ip] = limiter
-	r.mutex.Unlock()
-	return limiter
+	reqLimiter := &requestLimiter{
+		lastUsed: time.Now().UnixNano(),
+		limiter:  limiter,
+	}
+	r.limiters[limiterKey{ip: ip, class: class}] = reqLimiter
+	return reqLimiter
 }
 
-// fetchLimiter fetches the request limiter referenced by the provided
-// IP address.
-func (r *RateLimiter) fetchLimiter(ip string) *rate.Limiter {
+// fetchRequestLimiter fetches the request limiter of the provided request
+// class referenced by the provided IP address.
+func (r *RateLimiter) fetchRequestLimiter(ip string, class int) *requestLimiter {
 	r.mutex.RLock()
-	limiter := r.limiters[ip]
+	reqLimiter := r.limiters[limiterKey{ip: ip, class: class}]
 	r.mutex.RUnlock()
-	return limiter
+	return reqLimiter
 }
 
-// RemoveLimiter deletes the request limiter associated with the provided ip.
-func (r *RateLimiter) removeLimiter(ip string) {
+// fetchLimiter fetches the rate limiter of the provided request class
+// referenced by the provided IP address.
+func (r *RateLimiter) fetchLimiter(ip string, class int) *rate.Limiter {
+	reqLimiter := r.fetchRequestLimiter(ip, class)
+	if reqLimiter == nil {
+		return nil
+	}
+	return reqLimiter.limiter
+}
+
+// evictIdle removes the request limiters unused long enough to have
+// refilled their burst by the provided time. Such limiters are equivalent
+// to new ones, so evicting them bounds the limiter set to recently active
+// hosts without refilling the budget of any host early. It returns the
+// number of limiters evicted.
+func (r *RateLimiter) evictIdle(now time.Time) int {
 	r.mutex.Lock()
-	delete(r.limiters, ip)
-	r.mutex.Unlock()
+	defer r.mutex.Unlock()
+	var evicted int
+	for key, reqLimiter := range r.limiters {
+		limiter := reqLimiter.limiter
+		refill := time.Duration(float64(limiter.Burst()) /
+			float64(limiter.Limit()) * float64(time.Second))
+		lastUsed := atomic.LoadInt64(&reqLimiter.lastUsed)
+		if now.Sub(time.Unix(0, lastUsed)) < refill {
+			continue
+		}
+		delete(r.limiters, key)
+		evicted++
+	}
+	return evicted
 }
 
-// withinLimit asserts that the client referenced by the provided IP
-// address is within the limits of the rate limiter, therefore can make
-// further requests. If no request limiter is found for the provided IP
-// address a new one is created.
-func (r *RateLimiter) withinLimit(ip string, clientType int) bool {
-	reqLimiter := r.fetchLimiter(ip)
+// withinLimit asserts that requests of the provided class from the client
+// referenced by the provided IP address are within the limits of the rate
+// limiter, therefore further requests of the class can be made. The
+// submission limit is scaled to the provided expected share rate of the
+// client, per second, when it exceeds the minimum submission rate. If no
+// request limiter is found for the provided IP address and class a new one
+// is created.
+func (r *RateLimiter) withinLimit(ip string, class int, shareRate float64) bool {
+	reqLimiter := r.fetchRequestLimiter(ip, class)
 	if reqLimiter == nil {
 		// create a new limiter if the incoming request is from a new client.
-		reqLimiter = r.addRequestLimiter(ip, clientType)
+		reqLimiter = r.addRequestLimiter(ip, class)
+		if reqLimiter == nil {
+			return false
+		}
+	}
+	limiter := reqLimiter.limiter
+	if class == SubmitClass {
+		limit := math.Max(r.fetchLimits().Submit,
+			shareRate*submitShareRateFactor)
+		if rate.Limit(limit) != limiter.Limit() {
+			limiter.SetLimit(rate.Limit(limit))
+			limiter.SetBurst(submitBurst(limit))
+		}
 	}
-	return reqLimiter.Allow()
+	allowed := limiter.Allow()
+	atomic.StoreInt64(&reqLimiter.lastUsed, time.Now().UnixNano())
+	return allowed
 }
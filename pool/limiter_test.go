@@ -1,52 +1,132 @@
 package pool
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func testLimiter(t *testing.T) {
-	limiter := NewRateLimiter()
+	limiter := NewRateLimiter(nil)
 	apiLimiterIP := "127.0.0.1"
 
 	// Ensure the api limiter is within range.
-	if !limiter.withinLimit(apiLimiterIP, APIClient) {
+	if !limiter.withinLimit(apiLimiterIP, APIClient, 0) {
 		t.Fatal("expected limiter to be within limit")
 	}
 
 	// Exhaust the api limiter range.
-	for limiter.withinLimit(apiLimiterIP, APIClient) {
+	for limiter.withinLimit(apiLimiterIP, APIClient, 0) {
 		continue
 	}
 
 	// Fetch the api limiter
-	lmt := limiter.fetchLimiter(apiLimiterIP)
+	lmt := limiter.fetchLimiter(apiLimiterIP, APIClient)
 	if lmt == nil {
 		t.Fatalf("expected a non-nil limiter")
 	}
 
 	poolLimiterIP := "0.0.0.0"
 
-	// Ensure the api limiter is within range.
-	if !limiter.withinLimit(poolLimiterIP, PoolClient) {
+	// Ensure the submit limiter is within range.
+	if !limiter.withinLimit(poolLimiterIP, SubmitClass, 0) {
 		t.Fatal("expected limiter to be within limit")
 	}
 
-	// Exhaust the pool limiter range.
-	for limiter.withinLimit(poolLimiterIP, PoolClient) {
+	// Exhaust the submit limiter range.
+	for limiter.withinLimit(poolLimiterIP, SubmitClass, 0) {
 		continue
 	}
 
+	// Ensure exhausting the submit limiter does not affect the authorize
+	// and subscribe limiters of the client.
+	if !limiter.withinLimit(poolLimiterIP, AuthorizeClass, 0) {
+		t.Fatal("expected authorize limiter to be within limit")
+	}
+	if !limiter.withinLimit(poolLimiterIP, SubscribeClass, 0) {
+		t.Fatal("expected subscribe limiter to be within limit")
+	}
+
+	// Ensure authorizations are limited to the handshake burst.
+	for i := 1; i < handshakeBurst; i++ {
+		if !limiter.withinLimit(poolLimiterIP, AuthorizeClass, 0) {
+			t.Fatal("expected authorize limiter to be within limit")
+		}
+	}
+	if limiter.withinLimit(poolLimiterIP, AuthorizeClass, 0) {
+		t.Fatal("expected authorize limiter to be exhausted")
+	}
+
 	// Fetch the pool limiter.
-	lmt = limiter.fetchLimiter(apiLimiterIP)
+	lmt = limiter.fetchLimiter(poolLimiterIP, SubmitClass)
 	if lmt == nil {
 		t.Fatalf("expected a non-nil limiter")
 	}
 
-	// Remove limiters.
-	limiter.removeLimiter(apiLimiterIP)
-	limiter.removeLimiter(poolLimiterIP)
+	// Ensure the submission limit scales with the expected share rate
+	// once it exceeds the minimum submission rate.
+	limiter.withinLimit(poolLimiterIP, SubmitClass, 1)
+	if float64(lmt.Limit()) != defaultSubmitRate*2 {
+		t.Fatalf("expected a submission limit of %v, got %v",
+			defaultSubmitRate*2, lmt.Limit())
+	}
+	limiter.withinLimit(poolLimiterIP, SubmitClass, 0.01)
+	if float64(lmt.Limit()) != defaultSubmitRate {
+		t.Fatalf("expected a submission limit of %v, got %v",
+			defaultSubmitRate, lmt.Limit())
+	}
+
+	// Ensure configured limits override the defaults.
+	configured := NewRateLimiter(&RequestLimits{Submit: 20})
+	configured.withinLimit(poolLimiterIP, SubmitClass, 0)
+	if lmt := configured.fetchLimiter(poolLimiterIP, SubmitClass); float64(lmt.Limit()) != 20 {
+		t.Fatalf("expected a submission limit of 20, got %v", lmt.Limit())
+	}
 
-	// Ensure the limiters have been removed.
-	lmt = limiter.fetchLimiter(apiLimiterIP)
+	// Ensure applied limits update existing handshake limiters and apply
+	// to new limiters, zero limits restore the defaults.
+	configured.withinLimit(poolLimiterIP, AuthorizeClass, 0)
+	configured.ApplyConfig(&RequestLimits{Authorize: 1, Submit: 10})
+	authLmt := configured.fetchLimiter(poolLimiterIP, AuthorizeClass)
+	if float64(authLmt.Limit()) != 1 {
+		t.Fatalf("expected an authorize limit of 1, got %v", authLmt.Limit())
+	}
+	configured.withinLimit(poolLimiterIP, SubmitClass, 0)
+	if lmt := configured.fetchLimiter(poolLimiterIP, SubmitClass); float64(lmt.Limit()) != 10 {
+		t.Fatalf("expected a submission limit of 10, got %v", lmt.Limit())
+	}
+	configured.withinLimit(apiLimiterIP, SubscribeClass, 0)
+	if lmt := configured.fetchLimiter(apiLimiterIP, SubscribeClass); float64(lmt.Limit()) != defaultSubscribeRate {
+		t.Fatalf("expected a subscribe limit of %v, got %v",
+			defaultSubscribeRate, lmt.Limit())
+	}
+	configured.ApplyConfig(nil)
+	if float64(authLmt.Limit()) != defaultAuthorizeRate {
+		t.Fatalf("expected an authorize limit of %v, got %v",
+			defaultAuthorizeRate, authLmt.Limit())
+	}
+
+	// Ensure limiters are not evicted before they refill their burst.
+	now := time.Now()
+	if evicted := limiter.evictIdle(now); evicted != 0 {
+		t.Fatalf("expected no evicted limiters, got %d", evicted)
+	}
+	if limiter.fetchLimiter(poolLimiterIP, AuthorizeClass) == nil {
+		t.Fatal("expected the exhausted authorize limiter to be retained")
+	}
+
+	// Ensure limiters idle long enough to refill their burst are evicted.
+	refill := time.Duration(handshakeBurst / defaultAuthorizeRate *
+		float64(time.Second))
+	limiter.evictIdle(now.Add(refill))
+	lmt = limiter.fetchLimiter(apiLimiterIP, APIClient)
 	if lmt != nil {
 		t.Fatalf("expected a nil limiter")
 	}
+	lmt = limiter.fetchLimiter(poolLimiterIP, AuthorizeClass)
+	if lmt != nil {
+		t.Fatalf("expected a nil limiter")
+	}
+	if len(limiter.limiters) != 0 {
+		t.Fatalf("expected no limiters, got %d", len(limiter.limiters))
+	}
 }
@@ -6,6 +6,10 @@
 package pool
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/Eacred/slog"
 )
 
@@ -14,6 +18,10 @@ import (
 // requests it.
 var log slog.Logger
 
+// traceLog is the logger used for the output of traced clients, it is
+// expected to log at trace level regardless of the level of log.
+var traceLog slog.Logger
+
 // The default amount of logging is none.
 func init() {
 	DisableLog()
@@ -23,9 +31,129 @@ func init() {
 // by default until UseLogger is called.
 func DisableLog() {
 	log = slog.Disabled
+	traceLog = slog.Disabled
 }
 
 // UseLogger uses a specified Logger to output package logging info.
 func UseLogger(logger slog.Logger) {
 	log = logger
 }
+
+// UseTraceLogger uses a specified Logger to output the logging info of
+// traced clients and accounts.
+func UseTraceLogger(logger slog.Logger) {
+	traceLog = logger
+}
+
+// clientLogger logs messages of a client with the client's contextual
+// fields appended. Messages of traced clients are logged by the trace
+// logger, elevating the client's logging to trace level without affecting
+// the logging of other clients.
+type clientLogger struct {
+	id       string
+	identity string
+	miner    string
+	ip       string
+	account  string
+	worker   string
+	mtx      sync.RWMutex
+	traced   func(id string, account string) bool
+}
+
+// newClientLogger creates a logger for the provided client details.
+func newClientLogger(id string, miner string, ip string, traced func(string, string) bool) *clientLogger {
+	return &clientLogger{
+		id:       id,
+		identity: id,
+		miner:    miner,
+		ip:       ip,
+		traced:   traced,
+	}
+}
+
+// setAccount sets the identity, account and worker name fields of the
+// logger. The client id the logger was created with remains the key traced
+// clients are looked up by.
+func (l *clientLogger) setAccount(identity string, account string, worker string) {
+	l.mtx.Lock()
+	l.identity = identity
+	l.account = account
+	l.worker = worker
+	l.mtx.Unlock()
+}
+
+// fields returns the contextual fields of the logger as key=value pairs.
+// Fields of an unauthorized client without an account are omitted.
+func (l *clientLogger) fields() (string, string) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	fields := []string{"client=" + l.identity, "miner=" + l.miner, "ip=" + l.ip}
+	if l.account != "" {
+		fields = append(fields, "account="+l.account, "worker="+l.worker)
+	}
+	return strings.Join(fields, " "), l.account
+}
+
+// logger returns the logger messages of the client are logged by and the
+// client's contextual fields.
+func (l *clientLogger) logger() (slog.Logger, string) {
+	fields, account := l.fields()
+	if l.traced != nil && l.traced(l.id, account) {
+		return traceLog, fields
+	}
+	return log, fields
+}
+
+// enabled returns if messages of the provided level are logged for the
+// client, it allows expensive log parameters to be skipped.
+func (l *clientLogger) enabled(level slog.Level) bool {
+	logger, _ := l.logger()
+	return logger.Level() <= level
+}
+
+// logf formats and logs the provided message at the provided level with the
+// logger's fields appended.
+func (l *clientLogger) logf(level slog.Level, format string, params []interface{}) {
+	logger, fields := l.logger()
+	if logger.Level() > level {
+		return
+	}
+	msg := fmt.Sprintf(format, params...) + " " + fields
+	switch level {
+	case slog.LevelTrace:
+		logger.Trace(msg)
+	case slog.LevelDebug:
+		logger.Debug(msg)
+	case slog.LevelInfo:
+		logger.Info(msg)
+	case slog.LevelWarn:
+		logger.Warn(msg)
+	default:
+		logger.Error(msg)
+	}
+}
+
+// Tracef logs the provided message at trace level.
+func (l *clientLogger) Tracef(format string, params ...interface{}) {
+	l.logf(slog.LevelTrace, format, params)
+}
+
+// Debugf logs the provided message at debug level.
+func (l *clientLogger) Debugf(format string, params ...interface{}) {
+	l.logf(slog.LevelDebug, format, params)
+}
+
+// Infof logs the provided message at info level.
+func (l *clientLogger) Infof(format string, params ...interface{}) {
+	l.logf(slog.LevelInfo, format, params)
+}
+
+// Warnf logs the provided message at warn level.
+func (l *clientLogger) Warnf(format string, params ...interface{}) {
+	l.logf(slog.LevelWarn, format, params)
+}
+
+// Errorf logs the provided message at error level.
+func (l *clientLogger) Errorf(format string, params ...interface{}) {
+	l.logf(slog.LevelError, format, params)
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/wire"
+)
+
+// LostBlock represents a block candidate, a share solving the network
+// target, which failed submission to the consensus daemon. Lost block
+// candidates are recorded for manual investigation, the creation time is
+// in nanoseconds.
+type LostBlock struct {
+	Height    uint32 `json:"height"`
+	BlockHash string `json:"blockhash"`
+	Header    string `json:"header"`
+	Account   string `json:"account"`
+	Worker    string `json:"worker"`
+	Miner     string `json:"miner"`
+	Reason    string `json:"reason"`
+	CreatedOn int64  `json:"createdon"`
+}
+
+// lostBlockKey returns the key of the provided lost block candidate. Keys
+// are prefixed by the big endian creation time so candidates sort by the
+// time they were lost.
+func lostBlockKey(lost *LostBlock) []byte {
+	key := make([]byte, 8, 8+len(lost.BlockHash))
+	binary.BigEndian.PutUint64(key, uint64(lost.CreatedOn))
+	return append(key, lost.BlockHash...)
+}
+
+// fetchLostBlockBucket is a helper function for getting the lost block
+// candidate bucket.
+func fetchLostBlockBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(lostBlockBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(lostBlockBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// Create persists the lost block candidate to the database.
+func (lost *LostBlock) Create(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchLostBlockBucket(tx)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(lost)
+		if err != nil {
+			return err
+		}
+		return bkt.Put(lostBlockKey(lost), b)
+	})
+}
+
+// FetchLostBlocks fetches the recorded lost block candidates. List is
+// ordered, most recently lost candidate comes first.
+func FetchLostBlocks(db *bolt.DB) ([]*LostBlock, error) {
+	lost := make([]*LostBlock, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchLostBlockBucket(tx)
+		if err != nil {
+			return err
+		}
+		c := bkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var candidate LostBlock
+			err := json.Unmarshal(v, &candidate)
+			if err != nil {
+				return err
+			}
+			lost = append(lost, &candidate)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lost, nil
+}
+
+// handleLostBlock records the provided block candidate of the client which
+// failed submission to the consensus daemon for the provided reason and
+// accepts the share. The share met the pool target and its weighted share
+// is claimed, the miner is not penalized for the submission failure.
+func (c *Client) handleLostBlock(id uint64, header *wire.BlockHeader, headerB []byte, reason string) {
+	hash := header.BlockHash()
+	lost := &LostBlock{
+		Height:    header.Height,
+		BlockHash: hash.String(),
+		Header:    hex.EncodeToString(headerB),
+		Account:   c.account,
+		Worker:    c.name,
+		Miner:     c.cfg.FetchMiner(),
+		Reason:    reason,
+		CreatedOn: time.Now().UnixNano(),
+	}
+	err := lost.Create(c.cfg.DB)
+	if err != nil {
+		c.logger.Errorf("unable to persist lost block candidate %s: %v",
+			lost.BlockHash, err)
+	}
+
+	// The lost block event is published even if the candidate could not
+	// be persisted, it may be the only record of the candidate.
+	if c.cfg.NotifyBlockLost != nil {
+		c.cfg.NotifyBlockLost(c.id, lost)
+	}
+	resp := SubmitWorkResponse(id, true, nil)
+	c.queueMessage(resp)
+}
@@ -0,0 +1,135 @@
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/blockchain/standalone"
+)
+
+func testLostBlock(t *testing.T, db *bolt.DB) {
+	var submitReason string
+	var submitErr error
+	var notified []*LostBlock
+	cCfg := &ClientConfig{
+		SubmitWork: func(*string) (bool, string, error) {
+			return false, submitReason, submitErr
+		},
+		NotifyBlockLost: func(clientID string, lost *LostBlock) {
+			notified = append(notified, lost)
+		},
+	}
+	client, err := fastPathClient(db, cCfg)
+	if err != nil {
+		t.Fatalf("[fastPathClient] unexpected error: %v", err)
+	}
+	cCfg.SoloPool = false
+	client.account = xID
+
+	job, err := fastPathJob("984cee5d", false)
+	if err != nil {
+		t.Fatalf("[fastPathJob] unexpected error: %v", err)
+	}
+	err = job.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+
+	// Find nonces solving the job at the network target.
+	var solving []string
+	for i := uint32(0); len(solving) < 2; i++ {
+		nonce := fmt.Sprintf("%08x", i)
+		header, err := GenerateSolvedBlockHeader(job.Header,
+			client.extraNonce1, "00000000", ExtraNonce2Size, "954cee5d",
+			nonce, CPU)
+		if err != nil {
+			t.Fatalf("[GenerateSolvedBlockHeader] unexpected error: %v", err)
+		}
+		hash := header.BlockHash()
+		if standalone.HashToBig(&hash).Cmp(
+			standalone.CompactToBig(header.Bits)) <= 0 {
+			solving = append(solving, nonce)
+		}
+	}
+
+	id := uint64(1)
+	tests := []struct {
+		name   string
+		nonce  string
+		reason string
+		err    error
+	}{{
+		name:   "submission error",
+		nonce:  solving[0],
+		reason: "connection refused",
+		err:    fmt.Errorf("connection refused"),
+	}, {
+		name:   "rejected block",
+		nonce:  solving[1],
+		reason: "duplicate block",
+	}}
+
+	// Ensure block candidates failing submission are accepted, their
+	// shares credited and the candidates recorded and published.
+	for i, test := range tests {
+		submitReason, submitErr = test.reason, test.err
+		if test.err != nil {
+			submitReason = ""
+		}
+		req, err := fastPathRequest(SubmitWorkRequest(&id, "tcl", job.UUID,
+			"00000000", "954cee5d", test.nonce))
+		if err != nil {
+			t.Fatalf("[fastPathRequest] unexpected error: %v", err)
+		}
+		client.handleSubmitWorkRequest(req, true, client.fetchDifficultyInfo())
+		status, sErr, err := ParseSubmitWorkResponse((<-client.ch).(*Response))
+		if err != nil {
+			t.Fatalf("%s: [ParseSubmitWorkResponse] unexpected error: %v",
+				test.name, err)
+		}
+		if !status {
+			t.Fatalf("%s: expected an accepted share, got %v", test.name, sErr)
+		}
+
+		shares, err := PPLNSEligibleShares(db, nanoToBigEndianBytes(0))
+		if err != nil {
+			t.Fatalf("%s: [PPLNSEligibleShares] unexpected error: %v",
+				test.name, err)
+		}
+		if len(shares) != i+1 || shares[0].Account != xID {
+			t.Fatalf("%s: expected %d shares of account %s, got %d",
+				test.name, i+1, xID, len(shares))
+		}
+
+		lost, err := FetchLostBlocks(db)
+		if err != nil {
+			t.Fatalf("%s: [FetchLostBlocks] unexpected error: %v",
+				test.name, err)
+		}
+		if len(lost) != i+1 {
+			t.Fatalf("%s: expected %d lost block candidates, got %d",
+				test.name, i+1, len(lost))
+		}
+		candidate := lost[0]
+		if candidate.Reason != test.reason || candidate.Account != xID ||
+			candidate.Worker != "rig1" || candidate.Height != job.Height ||
+			len(candidate.Header) != headerHexLen {
+			t.Fatalf("%s: unexpected lost block candidate %+v", test.name,
+				candidate)
+		}
+		if len(notified) != i+1 ||
+			notified[i].BlockHash != candidate.BlockHash {
+			t.Fatalf("%s: expected the lost block candidate to be "+
+				"published", test.name)
+		}
+	}
+
+	for _, bkt := range [][]byte{jobBkt, submissionBkt, shareBkt,
+		lostBlockBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,622 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+var (
+	// maintenanceK is the key of the maintenance scheduler state.
+	maintenanceK = []byte("maintenance")
+
+	// maintenanceCheckInterval represents the interval the maintenance
+	// schedule is checked at.
+	maintenanceCheckInterval = time.Second * 5
+
+	// maxCronSearch represents the period searched for the next time
+	// matching a cron expression, long enough to find leap days.
+	maxCronSearch = time.Hour * 24 * 366 * 5
+)
+
+// cronSchedule represents the times matching a cron expression of minute,
+// hour, day of month, month and day of week fields, in UTC. Each field is
+// kept as a bitset of its matching values.
+type cronSchedule struct {
+	minutes    uint64
+	hours      uint64
+	days       uint64
+	months     uint64
+	weekdays   uint64
+	anyDay     bool
+	anyWeekday bool
+}
+
+// parseCronField parses a cron field of comma separated values, ranges and
+// steps within the provided bounds. It returns the bitset of the matching
+// values and if the field matches any value.
+func parseCronField(field string, min int, max int) (uint64, bool, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, false, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, false, fmt.Errorf("invalid range %q", part)
+			}
+			hi, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return 0, false, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			var err error
+			lo, err = strconv.Atoi(part)
+			if err != nil {
+				return 0, false, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, false, fmt.Errorf("%q is not within %d-%d", part,
+				min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, field == "*", nil
+}
+
+// parseCron parses the provided cron expression of minute, hour, day of
+// month, month and day of week fields. Days of week range from 0 to 7,
+// both 0 and 7 being Sunday.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 cron fields, got %d", len(fields))
+	}
+	var s cronSchedule
+	var err error
+	s.minutes, _, err = parseCronField(fields[0], 0, 59)
+	if err != nil {
+		return nil, fmt.Errorf("minute field: %v", err)
+	}
+	s.hours, _, err = parseCronField(fields[1], 0, 23)
+	if err != nil {
+		return nil, fmt.Errorf("hour field: %v", err)
+	}
+	s.days, s.anyDay, err = parseCronField(fields[2], 1, 31)
+	if err != nil {
+		return nil, fmt.Errorf("day of month field: %v", err)
+	}
+	s.months, _, err = parseCronField(fields[3], 1, 12)
+	if err != nil {
+		return nil, fmt.Errorf("month field: %v", err)
+	}
+	s.weekdays, s.anyWeekday, err = parseCronField(fields[4], 0, 7)
+	if err != nil {
+		return nil, fmt.Errorf("day of week field: %v", err)
+	}
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	return &s, nil
+}
+
+// matchesDay returns if the day of the provided time matches the schedule.
+// As with cron, restricted day of month and day of week fields match days
+// matching either field.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// next returns the first minute matching the schedule after the provided
+// time. It returns false if no time matches within the search period.
+func (s *cronSchedule) next(after time.Time) (time.Time, bool) {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxCronSearch)
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0,
+				time.UTC)
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// MaintenanceEntry represents an entry of the maintenance schedule, either
+// recurring windows starting at the times matching a cron expression or a
+// one-shot window.
+type MaintenanceEntry struct {
+	// Cron represents the cron expression of the start times of recurring
+	// windows, in UTC.
+	Cron string `json:"cron,omitempty"`
+	// Start represents the start time of a one-shot window, in
+	// nanoseconds.
+	Start    int64         `json:"start,omitempty"`
+	Duration time.Duration `json:"duration"`
+
+	schedule *cronSchedule
+}
+
+// ParseMaintenanceEntry parses a maintenance schedule entry of a cron
+// expression or an RFC3339 timestamp followed by the window duration.
+// eg. "0 2 * * * 15m" schedules daily windows from 02:00 to 02:15 UTC and
+// "2019-12-01T02:00:00Z 15m" a single window.
+func ParseMaintenanceEntry(spec string) (*MaintenanceEntry, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 && len(fields) != 6 {
+		desc := fmt.Sprintf("maintenance entry %q is not a cron expression "+
+			"or timestamp followed by a duration", spec)
+		return nil, MakeError(ErrParse, desc, nil)
+	}
+	duration, err := time.ParseDuration(fields[len(fields)-1])
+	if err != nil || duration <= 0 {
+		desc := fmt.Sprintf("invalid duration for maintenance entry %q", spec)
+		return nil, MakeError(ErrParse, desc, err)
+	}
+	entry := &MaintenanceEntry{Duration: duration}
+	if len(fields) == 2 {
+		start, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil {
+			desc := fmt.Sprintf("invalid timestamp for maintenance "+
+				"entry %q", spec)
+			return nil, MakeError(ErrParse, desc, err)
+		}
+		entry.Start = start.UnixNano()
+		return entry, nil
+	}
+	entry.Cron = strings.Join(fields[:5], " ")
+	entry.schedule, err = parseCron(entry.Cron)
+	if err != nil {
+		desc := fmt.Sprintf("invalid cron expression for maintenance "+
+			"entry %q", spec)
+		return nil, MakeError(ErrParse, desc, err)
+	}
+	return entry, nil
+}
+
+// window returns the start of the window of the entry in progress at the
+// provided time. It returns false if none is in progress.
+func (e *MaintenanceEntry) window(now time.Time) (time.Time, bool) {
+	if e.schedule == nil {
+		start := time.Unix(0, e.Start)
+		return start, !start.After(now) && now.Before(start.Add(e.Duration))
+	}
+	start, ok := e.schedule.next(now.Add(-e.Duration))
+	return start, ok && !start.After(now)
+}
+
+// next returns the start of the next window of the entry after the
+// provided time. It returns false if there is none.
+func (e *MaintenanceEntry) next(now time.Time) (time.Time, bool) {
+	if e.schedule == nil {
+		start := time.Unix(0, e.Start)
+		return start, start.After(now)
+	}
+	return e.schedule.next(now)
+}
+
+// MaintenanceWindow represents a maintenance window, timestamps are in
+// nanoseconds.
+type MaintenanceWindow struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// Resume indicates the miner endpoints are resumed at the end of the
+	// window, endpoints already paused when the window started are left
+	// paused.
+	Resume bool `json:"resume"`
+	// Backup represents the path of the compacted database backup taken
+	// at the start of the window, if any.
+	Backup string `json:"backup,omitempty"`
+	// Cancelled indicates the window was cancelled before its end.
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+// MaintenanceStatus represents the state of the maintenance schedule.
+type MaintenanceStatus struct {
+	// Active represents the maintenance window in progress, if any.
+	Active *MaintenanceWindow
+	// Next represents the next scheduled maintenance window, if any.
+	Next *MaintenanceWindow
+	// Scheduled represents the one-shot windows scheduled through the
+	// admin api.
+	Scheduled []*MaintenanceEntry
+}
+
+// maintenanceState represents the persisted state of the maintenance
+// scheduler.
+type maintenanceState struct {
+	Active    *MaintenanceWindow  `json:"active,omitempty"`
+	Scheduled []*MaintenanceEntry `json:"scheduled,omitempty"`
+	// Cancelled represents the start of the last cancelled window, so a
+	// cancelled window is not started again.
+	Cancelled int64 `json:"cancelled,omitempty"`
+}
+
+// MaintenanceSchedulerConfig represents configuration details for the
+// maintenance scheduler.
+type MaintenanceSchedulerConfig struct {
+	// DB represents the pool database.
+	DB *bolt.DB
+	// Entries represents the configured maintenance schedule.
+	Entries []*MaintenanceEntry
+	// Message represents the message miners are sent when maintenance
+	// starts.
+	Message string
+	// WarningLead represents the period before a window miners are warned
+	// of it, zero disables warnings.
+	WarningLead time.Duration
+	// Backup indicates a compacted database backup is taken at the start
+	// of every window.
+	Backup bool
+	// PauseEndpoints pauses the miner endpoints, sending miners the
+	// provided message.
+	PauseEndpoints func(message string)
+	// ResumeEndpoints resumes the miner endpoints, sending miners clean
+	// work.
+	ResumeEndpoints func()
+	// EndpointsPaused returns if the miner endpoints are paused.
+	EndpointsPaused func() bool
+	// BroadcastMessage sends the provided message to all subscribed
+	// miners, returning the number of miners sent the message.
+	BroadcastMessage func(message string) int
+	// NotifyMaintenance publishes the start or end of the provided window.
+	NotifyMaintenance func(window *MaintenanceWindow, started bool)
+	// HubWg represents the hub's waitgroup.
+	HubWg *sync.WaitGroup
+}
+
+// MaintenanceScheduler pauses the miner endpoints for the scheduled
+// maintenance windows. Its state is persisted so a restart during a window
+// keeps the endpoints paused until the window ends.
+type MaintenanceScheduler struct {
+	cfg    *MaintenanceSchedulerConfig
+	state  maintenanceState
+	warned int64
+	mtx    sync.Mutex
+}
+
+// NewMaintenanceScheduler creates a maintenance scheduler, loading its
+// persisted state.
+func NewMaintenanceScheduler(mCfg *MaintenanceSchedulerConfig) (*MaintenanceScheduler, error) {
+	s := &MaintenanceScheduler{cfg: mCfg}
+	err := mCfg.DB.View(func(tx *bolt.Tx) error {
+		pbkt := tx.Bucket(poolBkt)
+		if pbkt == nil {
+			desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+			return MakeError(ErrBucketNotFound, desc, nil)
+		}
+		v := pbkt.Get(maintenanceK)
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(v, &s.state)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// persist saves the state of the scheduler. This must be called with the
+// scheduler lock held.
+func (s *MaintenanceScheduler) persist() error {
+	return s.cfg.DB.Update(func(tx *bolt.Tx) error {
+		pbkt := tx.Bucket(poolBkt)
+		if pbkt == nil {
+			desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+			return MakeError(ErrBucketNotFound, desc, nil)
+		}
+		stateBytes, err := json.Marshal(&s.state)
+		if err != nil {
+			return err
+		}
+		return pbkt.Put(maintenanceK, stateBytes)
+	})
+}
+
+// entries returns the configured and scheduled entries of the maintenance
+// schedule. This must be called with the scheduler lock held.
+func (s *MaintenanceScheduler) entries() []*MaintenanceEntry {
+	entries := make([]*MaintenanceEntry, 0,
+		len(s.cfg.Entries)+len(s.state.Scheduled))
+	entries = append(entries, s.cfg.Entries...)
+	return append(entries, s.state.Scheduled...)
+}
+
+// current returns the window in progress at the provided time, ending with
+// the last of the overlapping windows. It returns nil if there is none.
+// This must be called with the scheduler lock held.
+func (s *MaintenanceScheduler) current(now time.Time) *MaintenanceWindow {
+	var window *MaintenanceWindow
+	for _, entry := range s.entries() {
+		start, ok := entry.window(now)
+		if !ok {
+			continue
+		}
+		end := start.Add(entry.Duration).UnixNano()
+		if window == nil {
+			window = &MaintenanceWindow{Start: start.UnixNano(), End: end}
+			continue
+		}
+		if start.UnixNano() < window.Start {
+			window.Start = start.UnixNano()
+		}
+		if end > window.End {
+			window.End = end
+		}
+	}
+	return window
+}
+
+// next returns the first window starting after the provided time. It
+// returns nil if there is none. This must be called with the scheduler
+// lock held.
+func (s *MaintenanceScheduler) next(now time.Time) *MaintenanceWindow {
+	var window *MaintenanceWindow
+	for _, entry := range s.entries() {
+		start, ok := entry.next(now)
+		if !ok || (window != nil && start.UnixNano() >= window.Start) {
+			continue
+		}
+		window = &MaintenanceWindow{
+			Start: start.UnixNano(),
+			End:   start.Add(entry.Duration).UnixNano(),
+		}
+	}
+	return window
+}
+
+// formatWindow returns a description of the provided window for miners.
+func formatWindow(window *MaintenanceWindow) string {
+	return fmt.Sprintf("%s to %s UTC",
+		time.Unix(0, window.Start).UTC().Format("2006-01-02 15:04"),
+		time.Unix(0, window.End).UTC().Format("15:04"))
+}
+
+// message returns the message miners are sent when the provided window
+// starts.
+func (s *MaintenanceScheduler) message(window *MaintenanceWindow) string {
+	if s.cfg.Message != "" {
+		return s.cfg.Message
+	}
+	return fmt.Sprintf("Pool maintenance from %s", formatWindow(window))
+}
+
+// start starts the provided maintenance window. Miners are sent the
+// maintenance message and the miner endpoints paused, the database is
+// backed up once they are. This must be called with the scheduler lock
+// held.
+func (s *MaintenanceScheduler) start(window *MaintenanceWindow) {
+	window.Resume = !s.cfg.EndpointsPaused()
+	s.cfg.PauseEndpoints(s.message(window))
+	log.Infof("Maintenance window from %s started", formatWindow(window))
+
+	if s.cfg.Backup {
+		file := filepath.Join(filepath.Dir(s.cfg.DB.Path()),
+			fmt.Sprintf("maintenance-%d.kv", window.Start/int64(time.Second)))
+		err := compact(s.cfg.DB, file)
+		if err != nil {
+			log.Errorf("unable to back up database: %v", err)
+		} else {
+			window.Backup = file
+			log.Infof("Database backup %s created", file)
+		}
+	}
+
+	s.state.Active = window
+	err := s.persist()
+	if err != nil {
+		log.Errorf("unable to persist maintenance state: %v", err)
+	}
+	s.cfg.NotifyMaintenance(window, true)
+}
+
+// end ends the maintenance window in progress, resuming the miner endpoints
+// unless they were paused before the window started. This must be called
+// with the scheduler lock held.
+func (s *MaintenanceScheduler) end(cancelled bool) {
+	window := s.state.Active
+	window.Cancelled = cancelled
+	s.state.Active = nil
+	if cancelled {
+		s.state.Cancelled = window.Start
+	}
+	err := s.persist()
+	if err != nil {
+		log.Errorf("unable to persist maintenance state: %v", err)
+	}
+	if window.Resume {
+		s.cfg.ResumeEndpoints()
+	}
+	if cancelled {
+		log.Infof("Maintenance window from %s cancelled",
+			formatWindow(window))
+	} else {
+		log.Infof("Maintenance window from %s ended", formatWindow(window))
+	}
+	s.cfg.NotifyMaintenance(window, false)
+}
+
+// restore pauses the miner endpoints if a window persisted as in progress
+// has not ended at the provided time, windows ended while the pool was
+// down are ended on the next check.
+func (s *MaintenanceScheduler) restore(now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	window := s.state.Active
+	if window == nil || now.UnixNano() >= window.End {
+		return
+	}
+	s.cfg.PauseEndpoints(s.message(window))
+	log.Infof("Maintenance window from %s resumed", formatWindow(window))
+}
+
+// check starts and ends maintenance windows and warns miners of upcoming
+// windows as of the provided time.
+func (s *MaintenanceScheduler) check(now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if active := s.state.Active; active != nil {
+		if now.UnixNano() >= active.End {
+			s.end(false)
+		}
+		return
+	}
+
+	// Prune scheduled one-shot windows which have ended.
+	scheduled := s.state.Scheduled[:0]
+	for _, entry := range s.state.Scheduled {
+		if now.Before(time.Unix(0, entry.Start).Add(entry.Duration)) {
+			scheduled = append(scheduled, entry)
+		}
+	}
+	if len(scheduled) != len(s.state.Scheduled) {
+		s.state.Scheduled = scheduled
+		err := s.persist()
+		if err != nil {
+			log.Errorf("unable to persist maintenance state: %v", err)
+		}
+	}
+
+	window := s.current(now)
+	if window != nil && window.Start != s.state.Cancelled {
+		s.start(window)
+		return
+	}
+
+	if s.cfg.WarningLead == 0 {
+		return
+	}
+	window = s.next(now)
+	if window == nil || window.Start == s.warned ||
+		time.Unix(0, window.Start).Sub(now) > s.cfg.WarningLead {
+		return
+	}
+	s.warned = window.Start
+	notified := s.cfg.BroadcastMessage(fmt.Sprintf("Pool maintenance "+
+		"scheduled from %s, mining pauses during maintenance",
+		formatWindow(window)))
+	log.Infof("%d clients warned of maintenance from %s", notified,
+		formatWindow(window))
+}
+
+// cancel cancels the maintenance window in progress.
+func (s *MaintenanceScheduler) cancel() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.state.Active == nil {
+		desc := "no maintenance window in progress"
+		return MakeError(ErrValueNotFound, desc, nil)
+	}
+	s.end(true)
+	return nil
+}
+
+// schedule adds a one-shot window of the provided duration starting at the
+// provided time to the maintenance schedule.
+func (s *MaintenanceScheduler) schedule(start time.Time, duration time.Duration, now time.Time) error {
+	if duration <= 0 {
+		desc := "maintenance window duration must be positive"
+		return MakeError(ErrParse, desc, nil)
+	}
+	if !now.Before(start.Add(duration)) {
+		desc := "maintenance window ends in the past"
+		return MakeError(ErrParse, desc, nil)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.state.Scheduled = append(s.state.Scheduled, &MaintenanceEntry{
+		Start:    start.UnixNano(),
+		Duration: duration,
+	})
+	return s.persist()
+}
+
+// status returns the state of the maintenance schedule as of the provided
+// time.
+func (s *MaintenanceScheduler) status(now time.Time) *MaintenanceStatus {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	status := &MaintenanceStatus{
+		Next:      s.next(now),
+		Scheduled: make([]*MaintenanceEntry, 0, len(s.state.Scheduled)),
+	}
+	if s.state.Active != nil {
+		active := *s.state.Active
+		status.Active = &active
+	}
+	for _, entry := range s.state.Scheduled {
+		scheduled := *entry
+		status.Scheduled = append(status.Scheduled, &scheduled)
+	}
+	return status
+}
+
+// run periodically checks the maintenance schedule. It must be run as a
+// goroutine.
+func (s *MaintenanceScheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceCheckInterval)
+	defer ticker.Stop()
+	s.check(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			s.cfg.HubWg.Done()
+			return
+		case now := <-ticker.C:
+			s.check(now)
+		}
+	}
+}
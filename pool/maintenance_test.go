@@ -0,0 +1,265 @@
+package pool
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func testMaintenanceScheduler(t *testing.T, db *bolt.DB) {
+	cronTests := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{{
+		expr:  "0 2 * * *",
+		after: time.Date(2019, 12, 1, 1, 30, 0, 0, time.UTC),
+		want:  time.Date(2019, 12, 1, 2, 0, 0, 0, time.UTC),
+	}, {
+		expr:  "0 2 * * *",
+		after: time.Date(2019, 12, 1, 2, 0, 0, 0, time.UTC),
+		want:  time.Date(2019, 12, 2, 2, 0, 0, 0, time.UTC),
+	}, {
+		expr:  "*/15 * * * *",
+		after: time.Date(2019, 12, 1, 1, 31, 10, 0, time.UTC),
+		want:  time.Date(2019, 12, 1, 1, 45, 0, 0, time.UTC),
+	}, {
+		expr:  "30 4 * * 7",
+		after: time.Date(2019, 12, 2, 0, 0, 0, 0, time.UTC),
+		want:  time.Date(2019, 12, 8, 4, 30, 0, 0, time.UTC),
+	}, {
+		expr:  "0 0 1,15 * 1",
+		after: time.Date(2019, 12, 2, 0, 0, 0, 0, time.UTC),
+		want:  time.Date(2019, 12, 9, 0, 0, 0, 0, time.UTC),
+	}, {
+		expr:  "0 0 29 2 *",
+		after: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC),
+		want:  time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+	}, {
+		expr:  "0 22-23/1 * 1-3 *",
+		after: time.Date(2019, 12, 31, 23, 0, 0, 0, time.UTC),
+		want:  time.Date(2020, 1, 1, 22, 0, 0, 0, time.UTC),
+	}}
+
+	// Ensure cron expressions match the next time expected.
+	for _, test := range cronTests {
+		s, err := parseCron(test.expr)
+		if err != nil {
+			t.Fatalf("%q: [parseCron] unexpected error: %v", test.expr, err)
+		}
+		next, ok := s.next(test.after)
+		if !ok || !next.Equal(test.want) {
+			t.Fatalf("%q: expected %v after %v, got %v", test.expr,
+				test.want, test.after, next)
+		}
+	}
+
+	// Ensure malformed entries are refused.
+	for _, spec := range []string{"", "0 2 * * *", "0 2 * * * 0s",
+		"60 2 * * * 15m", "0 2 * * 8 15m", "0 2-1 * * * 15m",
+		"0 */0 * * * 15m", "2019-12-01 15m", "0 2 * 15m"} {
+		_, err := ParseMaintenanceEntry(spec)
+		if !IsError(err, ErrParse) {
+			t.Fatalf("%q: expected a parse error, got %v", spec, err)
+		}
+	}
+
+	daily, err := ParseMaintenanceEntry("0 2 * * * 15m")
+	if err != nil {
+		t.Fatalf("[ParseMaintenanceEntry] unexpected error: %v", err)
+	}
+	oneShot, err := ParseMaintenanceEntry("2019-12-05T10:00:00Z 1h")
+	if err != nil {
+		t.Fatalf("[ParseMaintenanceEntry] unexpected error: %v", err)
+	}
+	if oneShot.Cron != "" || oneShot.Duration != time.Hour ||
+		oneShot.Start != time.Date(2019, 12, 5, 10, 0, 0, 0,
+			time.UTC).UnixNano() {
+		t.Fatalf("unexpected one-shot entry %+v", oneShot)
+	}
+
+	var paused bool
+	var messages []string
+	var notified []*MaintenanceWindow
+	var resumed int
+	mCfg := &MaintenanceSchedulerConfig{
+		DB:          db,
+		Entries:     []*MaintenanceEntry{daily, oneShot},
+		WarningLead: time.Minute * 5,
+		Backup:      true,
+		PauseEndpoints: func(message string) {
+			paused = true
+			messages = append(messages, message)
+		},
+		ResumeEndpoints: func() {
+			paused = false
+			resumed++
+		},
+		EndpointsPaused: func() bool {
+			return paused
+		},
+		BroadcastMessage: func(message string) int {
+			messages = append(messages, message)
+			return 1
+		},
+		NotifyMaintenance: func(window *MaintenanceWindow, started bool) {
+			notified = append(notified, window)
+		},
+		HubWg: new(sync.WaitGroup),
+	}
+	s, err := NewMaintenanceScheduler(mCfg)
+	if err != nil {
+		t.Fatalf("[NewMaintenanceScheduler] unexpected error: %v", err)
+	}
+
+	// Ensure miners are warned once of an upcoming window.
+	at := func(hour int, min int) time.Time {
+		return time.Date(2019, 12, 1, hour, min, 0, 0, time.UTC)
+	}
+	s.check(at(1, 50))
+	if len(messages) != 0 {
+		t.Fatalf("expected no warning before the warning lead, got %v",
+			messages)
+	}
+	s.check(at(1, 56))
+	s.check(at(1, 57))
+	if len(messages) != 1 || paused {
+		t.Fatalf("expected a single warning, got %v", messages)
+	}
+
+	// Ensure the window pauses the endpoints, backs up the database and
+	// publishes its start.
+	s.check(at(2, 0))
+	if !paused || len(messages) != 2 || len(notified) != 1 {
+		t.Fatal("expected the window to pause the endpoints and be published")
+	}
+	window := notified[0]
+	if window.Start != at(2, 0).UnixNano() ||
+		window.End != at(2, 15).UnixNano() || !window.Resume {
+		t.Fatalf("unexpected maintenance window %+v", window)
+	}
+	if window.Backup == "" {
+		t.Fatal("expected a database backup")
+	}
+	backup, err := openDB(window.Backup)
+	if err != nil {
+		t.Fatalf("[openDB] unexpected error: %v", err)
+	}
+	err = backup.View(func(tx *bolt.Tx) error {
+		_, err := fetchDBVersion(tx)
+		return err
+	})
+	backup.Close()
+	os.Remove(window.Backup)
+	if err != nil {
+		t.Fatalf("expected a readable backup, got %v", err)
+	}
+	mCfg.Backup = false
+
+	// Ensure a restarted scheduler keeps the endpoints paused until the
+	// window ends.
+	paused = false
+	s, err = NewMaintenanceScheduler(mCfg)
+	if err != nil {
+		t.Fatalf("[NewMaintenanceScheduler] unexpected error: %v", err)
+	}
+	s.restore(at(2, 10))
+	if !paused {
+		t.Fatal("expected the restored window to pause the endpoints")
+	}
+	s.check(at(2, 10))
+	if len(notified) != 1 || resumed != 0 {
+		t.Fatal("expected the window to be in progress")
+	}
+	status := s.status(at(2, 10))
+	if status.Active == nil || status.Active.Start != window.Start ||
+		status.Next == nil || status.Next.Start != at(2, 0).Add(
+		time.Hour*24).UnixNano() {
+		t.Fatalf("unexpected maintenance status %+v", status)
+	}
+
+	// Ensure the window resumes the endpoints and publishes its end.
+	s.check(at(2, 15))
+	if paused || resumed != 1 || len(notified) != 2 ||
+		notified[1].Cancelled {
+		t.Fatal("expected the window to resume the endpoints and be published")
+	}
+	s.check(at(2, 16))
+	if len(notified) != 2 {
+		t.Fatal("expected the ended window not to start again")
+	}
+
+	// Ensure cancelling requires a window in progress, and a cancelled
+	// window is not started again.
+	if err := s.cancel(); !IsError(err, ErrValueNotFound) {
+		t.Fatalf("expected a value not found error, got %v", err)
+	}
+	s.check(time.Unix(0, oneShot.Start))
+	if !paused || len(notified) != 3 {
+		t.Fatal("expected the one-shot window to start")
+	}
+	err = s.cancel()
+	if err != nil {
+		t.Fatalf("[cancel] unexpected error: %v", err)
+	}
+	if paused || resumed != 2 || len(notified) != 4 ||
+		!notified[3].Cancelled {
+		t.Fatal("expected the cancelled window to resume the endpoints")
+	}
+	s.check(time.Unix(0, oneShot.Start).Add(time.Minute))
+	if paused || len(notified) != 4 {
+		t.Fatal("expected the cancelled window not to start again")
+	}
+
+	// Ensure windows starting while the endpoints are paused leave them
+	// paused.
+	paused = true
+	s.check(time.Date(2019, 12, 6, 2, 0, 0, 0, time.UTC))
+	s.check(time.Date(2019, 12, 6, 2, 15, 0, 0, time.UTC))
+	if !paused || resumed != 2 || len(notified) != 6 ||
+		notified[4].Resume {
+		t.Fatal("expected the paused endpoints not to be resumed")
+	}
+	paused = false
+
+	// Ensure scheduled one-shot windows are persisted and pruned once they
+	// end.
+	now := time.Date(2019, 12, 7, 0, 0, 0, 0, time.UTC)
+	err = s.schedule(now.Add(-time.Hour), time.Minute, now)
+	if !IsError(err, ErrParse) {
+		t.Fatalf("expected a parse error for a past window, got %v", err)
+	}
+	err = s.schedule(now.Add(time.Hour), time.Minute*30, now)
+	if err != nil {
+		t.Fatalf("[schedule] unexpected error: %v", err)
+	}
+	s, err = NewMaintenanceScheduler(mCfg)
+	if err != nil {
+		t.Fatalf("[NewMaintenanceScheduler] unexpected error: %v", err)
+	}
+	status = s.status(now)
+	if len(status.Scheduled) != 1 ||
+		status.Next.Start != now.Add(time.Hour).UnixNano() {
+		t.Fatalf("expected the persisted one-shot window, got %+v", status)
+	}
+	s.check(now.Add(time.Hour))
+	s.check(now.Add(time.Minute * 105))
+	if paused || len(notified) != 8 {
+		t.Fatal("expected the scheduled window to start and end")
+	}
+	s.check(now.Add(time.Minute * 110))
+	if status := s.status(now.Add(time.Minute * 110)); len(status.Scheduled) != 0 {
+		t.Fatalf("expected the ended one-shot window to be pruned, got %d",
+			len(status.Scheduled))
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(poolBkt).Delete(maintenanceK)
+	})
+	if err != nil {
+		t.Fatalf("unable to clear maintenance state: %v", err)
+	}
+}
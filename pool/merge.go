@@ -0,0 +1,444 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+// AccountMerge represents the audit record of an account merged into
+// another account.
+type AccountMerge struct {
+	From             string `json:"from"`
+	FromAddress      string `json:"fromaddress"`
+	To               string `json:"to"`
+	ToAddress        string `json:"toaddress"`
+	Shares           uint32 `json:"shares"`
+	Payments         uint32 `json:"payments"`
+	ArchivedPayments uint32 `json:"archivedpayments"`
+	MinedWork        uint32 `json:"minedwork"`
+	Workers          uint32 `json:"workers"`
+	MergedOn         int64  `json:"mergedon"`
+}
+
+// fetchAccountMergeBucket is a helper function for getting the account
+// merge bucket.
+func fetchAccountMergeBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(accountMergeBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(accountMergeBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// fetchMergeAccount returns the persisted account referenced by the
+// provided id.
+func fetchMergeAccount(tx *bolt.Tx, id string) (*Account, error) {
+	bkt, err := fetchAccountBucket(tx)
+	if err != nil {
+		return nil, err
+	}
+	v := bkt.Get([]byte(id))
+	if v == nil {
+		desc := fmt.Sprintf("no account found for id %s", id)
+		return nil, MakeError(ErrValueNotFound, desc, nil)
+	}
+	var account Account
+	err = json.Unmarshal(v, &account)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// mergeShares reassigns the shares of the provided account to the account
+// merged into, returning the number of shares reassigned.
+func mergeShares(tx *bolt.Tx, fromID string, toID string) (uint32, error) {
+	bkt, err := fetchShareBucket(tx)
+	if err != nil {
+		return 0, err
+	}
+	merged := make(map[string][]byte)
+	err = bkt.ForEach(func(k, v []byte) error {
+		var share Share
+		err := json.Unmarshal(v, &share)
+		if err != nil {
+			return err
+		}
+		if share.Account != fromID {
+			return nil
+		}
+		share.Account = toID
+		shareBytes, err := json.Marshal(&share)
+		if err != nil {
+			return err
+		}
+		merged[string(k)] = shareBytes
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	ibkt, err := fetchAccountShareBucket(tx)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range merged {
+		err := bkt.Put([]byte(k), v)
+		if err != nil {
+			return 0, err
+		}
+		err = ibkt.Delete(accountShareKey(fromID, []byte(k)))
+		if err != nil {
+			return 0, err
+		}
+		err = ibkt.Put(accountShareKey(toID, []byte(k)), []byte{})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return uint32(len(merged)), nil
+}
+
+// mergePayments reassigns the payments of the provided account in the
+// provided payment bucket to the account merged into, returning the number
+// of payments reassigned. Payments are keyed by account so reassigned
+// payments are stored under new keys, and re-indexed in the provided
+// account payment index of the bucket.
+func mergePayments(bkt *bolt.Bucket, ibkt *bolt.Bucket, fromID string, toID string) (uint32, error) {
+	keys := make([][]byte, 0)
+	pmts := make([]*Payment, 0)
+	err := bkt.ForEach(func(k, v []byte) error {
+		if len(k) < 16 || string(k[16:]) != fromID {
+			return nil
+		}
+		var pmt Payment
+		err := json.Unmarshal(v, &pmt)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, append([]byte(nil), k...))
+		pmts = append(pmts, &pmt)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for idx, pmt := range pmts {
+		err := deletePayment(bkt, ibkt, fromID, keys[idx])
+		if err != nil {
+			return 0, err
+		}
+		pmt.Account = toID
+		id := GeneratePaymentID(pmt.CreatedOn, pmt.Height, pmt.Account)
+		for bkt.Get(id) != nil {
+			pmt.CreatedOn++
+			id = GeneratePaymentID(pmt.CreatedOn, pmt.Height, pmt.Account)
+		}
+		err = putPayment(bkt, ibkt, pmt)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return uint32(len(pmts)), nil
+}
+
+// mergePaymentTotal adds the total paid to the provided account to the
+// total of the account merged into.
+func mergePaymentTotal(tx *bolt.Tx, fromID string, toID string) error {
+	bkt, err := fetchPaymentTotalBucket(tx)
+	if err != nil {
+		return err
+	}
+	v := bkt.Get([]byte(fromID))
+	if v == nil {
+		return nil
+	}
+	total := dcrutil.Amount(binary.BigEndian.Uint64(v))
+	err = bkt.Delete([]byte(fromID))
+	if err != nil {
+		return err
+	}
+	return addPaymentTotal(bkt, toID, total)
+}
+
+// mergeMinedWork attributes the work mined by the provided account to the
+// account merged into, returning the number of work attributed.
+func mergeMinedWork(tx *bolt.Tx, fromID string, toID string) (uint32, error) {
+	bkt, err := fetchWorkBucket(tx)
+	if err != nil {
+		return 0, err
+	}
+	merged := make(map[string][]byte)
+	err = bkt.ForEach(func(k, v []byte) error {
+		var work AcceptedWork
+		err := json.Unmarshal(v, &work)
+		if err != nil {
+			return err
+		}
+		if work.MinedBy != fromID {
+			return nil
+		}
+		work.MinedBy = toID
+		workBytes, err := json.Marshal(&work)
+		if err != nil {
+			return err
+		}
+		merged[string(k)] = workBytes
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range merged {
+		err := bkt.Put([]byte(k), v)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return uint32(len(merged)), nil
+}
+
+// mergeWorkerState combines the activity of the provided worker into the
+// provided worker of the same name. Hash rate samples taken at the same
+// time are summed.
+func mergeWorkerState(into *WorkerState, from *WorkerState) {
+	into.Uptime += from.Uptime
+	into.Accepted += from.Accepted
+	into.Rejected += from.Rejected
+	if from.LastSeen > into.LastSeen {
+		into.LastSeen = from.LastSeen
+	}
+	if from.LastShare > into.LastShare {
+		into.LastShare = from.LastShare
+		into.Offline = from.Offline
+	}
+	samples := make(map[int64]*big.Rat)
+	for _, sample := range append(into.HashRates, from.HashRates...) {
+		sum, ok := samples[sample.Time]
+		if !ok {
+			sum = new(big.Rat)
+			samples[sample.Time] = sum
+		}
+		sum.Add(sum, sample.HashRate)
+	}
+	into.HashRates = make([]*HashRateSample, 0, len(samples))
+	for t, hashRate := range samples {
+		into.HashRates = append(into.HashRates, &HashRateSample{
+			Time:     t,
+			HashRate: hashRate,
+		})
+	}
+	sort.Slice(into.HashRates, func(i, j int) bool {
+		return into.HashRates[i].Time < into.HashRates[j].Time
+	})
+}
+
+// mergeWorkers reassigns the provided workers of the provided account to
+// the account merged into, keyed by worker id. Workers sharing a name with
+// a worker of the account merged into are combined with it.
+func mergeWorkers(workers map[string]*WorkerState, fromID string, toID string) uint32 {
+	var count uint32
+	for id, worker := range workers {
+		if worker.Account != fromID {
+			continue
+		}
+		delete(workers, id)
+		count++
+		toWorkerID := workerID(toID, worker.Name)
+		existing, ok := workers[toWorkerID]
+		if ok {
+			mergeWorkerState(existing, worker)
+			continue
+		}
+		worker.Account = toID
+		workers[toWorkerID] = worker
+	}
+	return count
+}
+
+// mergeWorkerHistory reassigns the persisted worker history of the
+// provided account to the account merged into, returning the number of
+// workers reassigned.
+func mergeWorkerHistory(tx *bolt.Tx, fromID string, toID string) (uint32, error) {
+	bkt, err := fetchWorkerBucket(tx)
+	if err != nil {
+		return 0, err
+	}
+	workers := make(map[string]*WorkerState)
+	err = bkt.ForEach(func(k, v []byte) error {
+		var worker WorkerState
+		err := json.Unmarshal(v, &worker)
+		if err != nil {
+			return err
+		}
+		if worker.Account == fromID || worker.Account == toID {
+			workers[string(k)] = &worker
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for id, worker := range workers {
+		if worker.Account == fromID {
+			err := bkt.Delete([]byte(id))
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	count := mergeWorkers(workers, fromID, toID)
+	for id, worker := range workers {
+		workerBytes, err := json.Marshal(worker)
+		if err != nil {
+			return 0, err
+		}
+		err = bkt.Put([]byte(id), workerBytes)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// MergeAccounts reassigns the shares, pending and archived payments, mined
+// work and worker history of the account referenced by fromID to the account
+// referenced by toID in a single transaction, and records an audit entry of
+// the merge. The merged account itself is kept so shares still in flight
+// for it remain payable. Accounts with payments in a payment cycle in flight
+// are not merged.
+//
+// Worker states are held in memory by a running pool, accounts of a running
+// pool should be merged through its hub.
+func MergeAccounts(db *bolt.DB, fromID string, toID string) (*AccountMerge, error) {
+	if fromID == toID {
+		desc := "an account cannot be merged into itself"
+		return nil, MakeError(ErrNotSupported, desc, nil)
+	}
+	var merge *AccountMerge
+	err := db.Update(func(tx *bolt.Tx) error {
+		from, err := fetchMergeAccount(tx, fromID)
+		if err != nil {
+			return err
+		}
+		to, err := fetchMergeAccount(tx, toID)
+		if err != nil {
+			return err
+		}
+		cycle, err := fetchPaymentCycle(tx)
+		if err != nil {
+			return err
+		}
+		if cycle != nil && (cycle.includes(fromID) || cycle.includes(toID)) {
+			desc := fmt.Sprintf("the payment cycle at height #%d is in "+
+				"flight for the accounts", cycle.Height)
+			return MakeError(ErrNotSupported, desc, nil)
+		}
+
+		merge = &AccountMerge{
+			From:        fromID,
+			FromAddress: from.Address,
+			To:          toID,
+			ToAddress:   to.Address,
+			MergedOn:    time.Now().UnixNano(),
+		}
+		merge.Shares, err = mergeShares(tx, fromID, toID)
+		if err != nil {
+			return err
+		}
+		pbkt, err := fetchPaymentBucket(tx)
+		if err != nil {
+			return err
+		}
+		pibkt, err := fetchAccountPaymentBucket(tx, paymentBkt)
+		if err != nil {
+			return err
+		}
+		merge.Payments, err = mergePayments(pbkt, pibkt, fromID, toID)
+		if err != nil {
+			return err
+		}
+		abkt, err := fetchPaymentArchiveBucket(tx)
+		if err != nil {
+			return err
+		}
+		aibkt, err := fetchAccountPaymentBucket(tx, paymentArchiveBkt)
+		if err != nil {
+			return err
+		}
+		merge.ArchivedPayments, err = mergePayments(abkt, aibkt, fromID,
+			toID)
+		if err != nil {
+			return err
+		}
+		err = mergePaymentTotal(tx, fromID, toID)
+		if err != nil {
+			return err
+		}
+		merge.MinedWork, err = mergeMinedWork(tx, fromID, toID)
+		if err != nil {
+			return err
+		}
+		merge.Workers, err = mergeWorkerHistory(tx, fromID, toID)
+		if err != nil {
+			return err
+		}
+
+		mbkt, err := fetchAccountMergeBucket(tx)
+		if err != nil {
+			return err
+		}
+		mergeBytes, err := json.Marshal(merge)
+		if err != nil {
+			return err
+		}
+		return mbkt.Put(nanoToBigEndianBytes(merge.MergedOn), mergeBytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge, nil
+}
+
+// fetchAccountMerges returns the audit records of merged accounts, most
+// recent first.
+func fetchAccountMerges(db *bolt.DB) ([]*AccountMerge, error) {
+	merges := make([]*AccountMerge, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountMergeBucket(tx)
+		if err != nil {
+			return err
+		}
+		c := bkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var merge AccountMerge
+			err := json.Unmarshal(v, &merge)
+			if err != nil {
+				return err
+			}
+			merges = append(merges, &merge)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merges, nil
+}
@@ -0,0 +1,252 @@
+package pool
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+func testMergeAccounts(t *testing.T, db *bolt.DB) {
+	// Persist shares, pending and archived payments, mined work and
+	// workers of both accounts.
+	now := time.Now()
+	shareCount := map[string]int{xID: 3, yID: 2}
+	for account, count := range shareCount {
+		for i := 0; i < count; i++ {
+			share := NewShare(account, new(big.Rat).SetInt64(2))
+			err := share.Create(db)
+			if err != nil {
+				t.Fatalf("[Create] unexpected error: %v", err)
+			}
+		}
+	}
+	amt, _ := dcrutil.NewAmount(1)
+	for _, account := range []string{xID, xID, yID} {
+		pmt := NewPayment(account, amt, 10, 26)
+		err := pmt.Create(db)
+		if err != nil {
+			t.Fatalf("[Create] unexpected error: %v", err)
+		}
+	}
+	for _, account := range []string{xID, yID} {
+		bundle := newPaymentBundle(account)
+		bundle.Payments = append(bundle.Payments,
+			NewPayment(account, amt, 5, 21))
+		bundle.UpdateAsPaid(db, 22, "tx")
+		err := bundle.Payments[0].Create(db)
+		if err != nil {
+			t.Fatalf("[Create] unexpected error: %v", err)
+		}
+		err = bundle.ArchivePayments(db)
+		if err != nil {
+			t.Fatalf("[ArchivePayments] unexpected error: %v", err)
+		}
+	}
+	work := NewAcceptedWork("00000000000000001e2065a7248a9b4d3886fe3ca3128eebedddaf35fb26e58c",
+		"00000000000000001d1aeca93e3d4c5f1e5fce4c86e0bf4290e6ab9b8d8b9bd0",
+		5, xID, CPU, amt)
+	work.Confirmed = true
+	err := work.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	workers := []*WorkerState{
+		{Account: xID, Name: "rig0", Uptime: 10, Accepted: 4, Rejected: 1,
+			LastSeen: now.UnixNano(), LastShare: now.UnixNano(),
+			HashRates: []*HashRateSample{
+				{Time: 1, HashRate: big.NewRat(2, 1)},
+				{Time: 2, HashRate: big.NewRat(3, 1)},
+			}},
+		{Account: xID, Name: "rig1", Uptime: 5, Accepted: 2},
+		{Account: yID, Name: "rig0", Uptime: 20, Accepted: 6,
+			LastSeen: now.Add(-time.Minute).UnixNano(),
+			HashRates: []*HashRateSample{
+				{Time: 2, HashRate: big.NewRat(1, 1)},
+			}},
+	}
+	wm, err := NewWorkerMonitor(&WorkerMonitorConfig{
+		DB:     db,
+		Events: NewEventBus(),
+	})
+	if err != nil {
+		t.Fatalf("[NewWorkerMonitor] unexpected error: %v", err)
+	}
+	for _, worker := range workers {
+		wm.workers[workerID(worker.Account, worker.Name)] = worker
+	}
+	wm.sessions["client"] = &workerSession{
+		worker: workerID(xID, "rig1"),
+		since:  now.UnixNano(),
+	}
+	err = wm.persist()
+	if err != nil {
+		t.Fatalf("[persist] unexpected error: %v", err)
+	}
+
+	balance := func(account string) dcrutil.Amount {
+		amt, err := fetchPendingBalance(db, account)
+		if err != nil {
+			t.Fatalf("[fetchPendingBalance] unexpected error: %v", err)
+		}
+		return amt
+	}
+	total := func(account string) dcrutil.Amount {
+		amt, err := fetchPaymentTotal(db, account)
+		if err != nil {
+			t.Fatalf("[fetchPaymentTotal] unexpected error: %v", err)
+		}
+		return amt
+	}
+	pendingBefore := balance(xID) + balance(yID)
+	totalBefore := total(xID) + total(yID)
+
+	// Ensure accounts are not merged into themselves, into unknown
+	// accounts or while a payment cycle including them is in flight.
+	_, err = MergeAccounts(db, xID, xID)
+	if !IsError(err, ErrNotSupported) {
+		t.Fatalf("expected a self merge error, got %v", err)
+	}
+	_, err = MergeAccounts(db, xID, "unknown")
+	if !IsError(err, ErrValueNotFound) {
+		t.Fatalf("expected an unknown account error, got %v", err)
+	}
+	for _, cycle := range []*paymentCycle{
+		{Height: 10},
+		{Height: 10, Accounts: []string{yID}},
+	} {
+		err = persistPaymentCycle(db, cycle)
+		if err != nil {
+			t.Fatalf("[persistPaymentCycle] unexpected error: %v", err)
+		}
+		_, err = MergeAccounts(db, xID, yID)
+		if !IsError(err, ErrNotSupported) {
+			t.Fatalf("expected a payment cycle in flight error, got %v",
+				err)
+		}
+	}
+	err = persistPaymentCycle(db, &paymentCycle{Height: 10,
+		Accounts: []string{"other"}})
+	if err != nil {
+		t.Fatalf("[persistPaymentCycle] unexpected error: %v", err)
+	}
+
+	// Merge account X into account Y.
+	var merge *AccountMerge
+	err = wm.mergeAccount(xID, yID, func() error {
+		var err error
+		merge, err = MergeAccounts(db, xID, yID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("[mergeAccount] unexpected error: %v", err)
+	}
+	if merge.Shares != 3 || merge.Payments != 2 ||
+		merge.ArchivedPayments != 1 || merge.MinedWork != 1 ||
+		merge.Workers != 2 || merge.FromAddress != xAddr ||
+		merge.ToAddress != yAddr {
+		t.Fatalf("unexpected merge record: %+v", merge)
+	}
+
+	// Ensure balances and histories are conserved.
+	if balance(xID) != 0 || balance(yID) != pendingBefore {
+		t.Fatalf("expected a pending balance of %v for account Y, got %v "+
+			"and %v for account X", pendingBefore, balance(yID),
+			balance(xID))
+	}
+	if total(xID) != 0 || total(yID) != totalBefore {
+		t.Fatalf("expected a payment total of %v for account Y, got %v "+
+			"and %v for account X", totalBefore, total(yID), total(xID))
+	}
+	shares, err := PPLNSEligibleShares(db, nanoToBigEndianBytes(0))
+	if err != nil {
+		t.Fatalf("[PPLNSEligibleShares] unexpected error: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("expected 5 shares, got %d", len(shares))
+	}
+	for _, share := range shares {
+		if share.Account != yID {
+			t.Fatalf("expected all shares to belong to account Y, got %s",
+				share.Account)
+		}
+	}
+	archived, err := fetchArchivedPaymentsForAccount(db, yID, 10)
+	if err != nil {
+		t.Fatalf("[fetchArchivedPaymentsForAccount] unexpected error: %v",
+			err)
+	}
+	if len(archived) != 2 {
+		t.Fatalf("expected 2 archived payments, got %d", len(archived))
+	}
+	archived, err = fetchArchivedPaymentsForAccount(db, xID, 10)
+	if err != nil {
+		t.Fatalf("[fetchArchivedPaymentsForAccount] unexpected error: %v",
+			err)
+	}
+	if len(archived) != 0 {
+		t.Fatalf("expected no archived payments, got %d", len(archived))
+	}
+	mined, err := listMinedWorkByAccount(db, yID, 10)
+	if err != nil {
+		t.Fatalf("[listMinedWorkByAccount] unexpected error: %v", err)
+	}
+	if len(mined) != 1 {
+		t.Fatalf("expected 1 mined work, got %d", len(mined))
+	}
+
+	// Ensure same named workers are combined, both in memory and in the
+	// database, and sessions of merged workers follow them.
+	merged := wm.fetchAccountWorkers(yID)
+	if len(merged) != 2 || len(wm.fetchAccountWorkers(xID)) != 0 {
+		t.Fatalf("expected 2 workers of account Y, got %d", len(merged))
+	}
+	rig0 := merged[0]
+	if rig0.Uptime != 30 || rig0.Accepted != 10 || rig0.Rejected != 1 ||
+		rig0.LastSeen != now.UnixNano() || len(rig0.HashRates) != 2 ||
+		rig0.HashRates[1].HashRate.Cmp(big.NewRat(4, 1)) != 0 {
+		t.Fatalf("unexpected combined worker: %+v", rig0)
+	}
+	if wm.sessions["client"].worker != workerID(yID, "rig1") {
+		t.Fatalf("expected the session of worker rig1 of account Y, got %s",
+			wm.sessions["client"].worker)
+	}
+	reloaded, err := NewWorkerMonitor(&WorkerMonitorConfig{
+		DB:     db,
+		Events: NewEventBus(),
+	})
+	if err != nil {
+		t.Fatalf("[NewWorkerMonitor] unexpected error: %v", err)
+	}
+	if len(reloaded.workers) != 2 {
+		t.Fatalf("expected 2 persisted workers, got %d",
+			len(reloaded.workers))
+	}
+	if reloaded.workers[workerID(yID, "rig0")].Uptime != 30 {
+		t.Fatalf("expected a persisted uptime of 30, got %d",
+			reloaded.workers[workerID(yID, "rig0")].Uptime)
+	}
+
+	// Ensure the merge is audited.
+	merges, err := fetchAccountMerges(db)
+	if err != nil {
+		t.Fatalf("[fetchAccountMerges] unexpected error: %v", err)
+	}
+	if len(merges) != 1 || merges[0].From != xID || merges[0].To != yID {
+		t.Fatalf("expected an audit record of the merge, got %v", merges)
+	}
+
+	err = persistPaymentCycle(db, nil)
+	if err != nil {
+		t.Fatalf("[persistPaymentCycle] unexpected error: %v", err)
+	}
+	for _, bkt := range [][]byte{shareBkt, paymentBkt, paymentArchiveBkt,
+		paymentTotalBkt, workBkt, workerBkt, accountMergeBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+}
@@ -9,9 +9,14 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"math/big"
+	"strconv"
 	"strings"
 
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
 	"github.com/Eacred/eacrd/wire"
 )
 
@@ -30,9 +35,23 @@ const (
 	SetDifficulty = "mining.set_difficulty"
 	Notify        = "mining.notify"
 	Submit        = "mining.submit"
+	ShowMessage   = "client.show_message"
+	GetVersion    = "client.get_version"
+	Ping          = "mining.ping"
+	SetOption     = "pool.set_option"
 )
 
-// Error codes.
+// PoolMethodPrefix prefixes the methods of the pool's stratum extensions.
+const PoolMethodPrefix = "pool."
+
+// Account options settable through the set option extension.
+const (
+	MinPayoutOption   = "minpayout"
+	DigestHoursOption = "digesthours"
+)
+
+// Error codes. Codes 20 through 25 follow the common stratum conventions,
+// the remaining codes are specific to the pool.
 const (
 	Unknown            = 20
 	StaleJob           = 21
@@ -40,11 +59,42 @@ const (
 	LowDifficultyShare = 23
 	UnauthorizedWorker = 24
 	NotSubscribed      = 25
+	PoolAtCapacity     = 26
+	MinerRejected      = 27
+	RateLimited        = 28
+	AuthTokenRequired  = 29
+	InvalidAddress     = 30
+	InvalidRequest     = 31
+	PoolUnavailable    = 32
+	BlockRejected      = 33
+	InvalidWorkerName  = 34
+	AccountNotVerified = 35
+	UnknownMethod      = 36
+	AccountIDTaken     = 37
 )
 
 // Stratum constants.
 const (
+	// ExtraNonce2Size represents the extraNonce2 size granted to miners
+	// not requesting one.
 	ExtraNonce2Size = 4
+
+	// MinExtraNonce2Size and MaxExtraNonce2Size represent the bounds of
+	// the extraNonce2 sizes granted to miners requesting one. The
+	// extraNonce2 follows the 4-byte extraNonce1 in the 32-byte extra data
+	// of the block header.
+	MinExtraNonce2Size = 2
+	MaxExtraNonce2Size = 28
+)
+
+const (
+	// maxMessageDepth is the maximum nesting depth of arrays and objects
+	// allowed in a received message.
+	maxMessageDepth = 8
+
+	// maxMessageParams is the maximum number of params allowed in a
+	// received request.
+	maxMessageParams = 16
 )
 
 // StratumError represents a stratum error message.
@@ -54,21 +104,55 @@ type StratumError struct {
 	Traceback *string `json:"traceback"`
 }
 
-// NewStratumError creates a stratum error instance.
+// NewStratumError creates a stratum error instance. The message of the error
+// describes the failure of the provided code along with what the miner can
+// do about it, details of the failure are carried by the traceback.
 func NewStratumError(code uint32, traceback *string) *StratumError {
 	var message string
 
 	switch code {
 	case StaleJob:
-		message = "Stale Job"
+		message = "Stale job, the job is outdated or no longer known to " +
+			"the pool, work on the latest job"
 	case DuplicateShare:
-		message = "Duplicate share"
+		message = "Duplicate share, the share was already submitted"
 	case LowDifficultyShare:
-		message = "Low difficulty share"
+		message = "Low difficulty share, the share does not meet the " +
+			"pool difficulty"
 	case UnauthorizedWorker:
-		message = "Unauthorized worker"
+		message = "Unauthorized worker, authorize before submitting work"
 	case NotSubscribed:
-		message = "Not subscribed"
+		message = "Not subscribed, subscribe before submitting work"
+	case PoolAtCapacity:
+		message = "Pool at capacity, try later"
+	case MinerRejected:
+		message = "Miner type not accepted by the pool"
+	case RateLimited:
+		message = "Too many pending requests, slow down"
+	case AuthTokenRequired:
+		message = "Valid authorization token required, the account is " +
+			"locked"
+	case InvalidAddress:
+		message = "Invalid username, expected address.workername with " +
+			"a valid address of the pool's network"
+	case InvalidRequest:
+		message = "Malformed request parameters"
+	case PoolUnavailable:
+		message = "Pool temporarily unable to process the request, " +
+			"retry shortly"
+	case BlockRejected:
+		message = "Block rejected by the network"
+	case InvalidWorkerName:
+		message = "Invalid worker name, use letters, digits, dashes and " +
+			"underscores within the pool's length limit"
+	case AccountNotVerified:
+		message = "Account not verified, lock the account and authorize " +
+			"with a valid authorization token to change its settings"
+	case UnknownMethod:
+		message = "Unknown method, the request is not supported by the pool"
+	case AccountIDTaken:
+		message = "Account id of the address is taken by another " +
+			"address, contact the pool operator"
 	case Unknown:
 		fallthrough
 	default:
@@ -92,6 +176,9 @@ type Request struct {
 	ID     *uint64     `json:"id"`
 	Method string      `json:"method"`
 	Params interface{} `json:"params"`
+	// RawID represents the id of the request as received when it differs
+	// from the canonical form of the id, nil otherwise.
+	RawID json.RawMessage `json:"-"`
 }
 
 // MessageType returns the request message type.
@@ -99,6 +186,42 @@ func (req *Request) MessageType() int {
 	return RequestMessage
 }
 
+// UnmarshalJSON decodes a request, canonicalizing its id.
+func (req *Request) UnmarshalJSON(data []byte) error {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params interface{}     `json:"params"`
+	}
+	err := json.Unmarshal(data, &msg)
+	if err != nil {
+		return err
+	}
+	id, rawID, err := parseMessageID(msg.ID)
+	if err != nil {
+		return err
+	}
+	req.ID = id
+	req.RawID = rawID
+	req.Method = msg.Method
+	req.Params = msg.Params
+	return nil
+}
+
+// MarshalJSON encodes a request, with its id as received if it has a raw
+// id.
+func (req *Request) MarshalJSON() ([]byte, error) {
+	type request Request
+	if req.RawID == nil {
+		return json.Marshal((*request)(req))
+	}
+	return json.Marshal(&struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params interface{}     `json:"params"`
+	}{req.RawID, req.Method, req.Params})
+}
+
 // NewRequest creates a request instance.
 func NewRequest(id *uint64, method string, params interface{}) *Request {
 	return &Request{
@@ -113,6 +236,10 @@ type Response struct {
 	ID     uint64        `json:"id"`
 	Error  *StratumError `json:"error"`
 	Result interface{}   `json:"result,omitempty"`
+	// RawID represents the id of the response as received or as echoed
+	// to the client when it differs from the canonical form of the id,
+	// nil otherwise.
+	RawID json.RawMessage `json:"-"`
 }
 
 // MessageType returns the response message type.
@@ -120,6 +247,92 @@ func (req *Response) MessageType() int {
 	return ResponseMessage
 }
 
+// UnmarshalJSON decodes a response, canonicalizing its id. Responses with
+// a null id decode to a zero id.
+func (resp *Response) UnmarshalJSON(data []byte) error {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Error  *StratumError   `json:"error"`
+		Result interface{}     `json:"result,omitempty"`
+	}
+	err := json.Unmarshal(data, &msg)
+	if err != nil {
+		return err
+	}
+	id, rawID, err := parseMessageID(msg.ID)
+	if err != nil {
+		return err
+	}
+	resp.ID = 0
+	if id != nil {
+		resp.ID = *id
+	}
+	resp.RawID = rawID
+	resp.Error = msg.Error
+	resp.Result = msg.Result
+	return nil
+}
+
+// MarshalJSON encodes a response, echoing the raw id of the request it
+// answers if it has one.
+func (resp *Response) MarshalJSON() ([]byte, error) {
+	type response Response
+	if resp.RawID == nil {
+		return json.Marshal((*response)(resp))
+	}
+	return json.Marshal(&struct {
+		ID     json.RawMessage `json:"id"`
+		Error  *StratumError   `json:"error"`
+		Result interface{}     `json:"result,omitempty"`
+	}{resp.RawID, resp.Error, resp.Result})
+}
+
+// parseMessageID canonicalizes the provided raw message id, a null id
+// yields a nil id. Numeric ids and decimal or hex encoded string ids fitting
+// a uint64 canonicalize to their value, other numeric and string ids such
+// as those exceeding a uint64 to a hash of their raw form. The raw id is
+// returned along with the canonical id if it differs from the decimal form
+// of the canonical id.
+func parseMessageID(raw json.RawMessage) (*uint64, json.RawMessage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil, nil
+	}
+	var id uint64
+	var err error
+	switch raw[0] {
+	case '"':
+		var s string
+		err = json.Unmarshal(raw, &s)
+		if err != nil {
+			return nil, nil, err
+		}
+		id, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			hexID := s
+			if strings.HasPrefix(hexID, "0x") || strings.HasPrefix(hexID, "0X") {
+				hexID = hexID[2:]
+			}
+			id, err = strconv.ParseUint(hexID, 16, 64)
+		}
+
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		id, err = strconv.ParseUint(string(raw), 10, 64)
+
+	default:
+		desc := fmt.Sprintf("invalid message id %s", raw)
+		return nil, nil, MakeError(ErrParse, desc, nil)
+	}
+	if err != nil {
+		h := fnv.New64a()
+		h.Write(raw)
+		id = h.Sum64()
+	}
+	if string(raw) == strconv.FormatUint(id, 10) {
+		return &id, nil, nil
+	}
+	return &id, append(json.RawMessage(nil), raw...), nil
+}
+
 // NewResponse creates a response instance.
 func NewResponse(id uint64, result interface{}, err *StratumError) *Response {
 	return &Response{
@@ -129,9 +342,59 @@ func NewResponse(id uint64, result interface{}, err *StratumError) *Response {
 	}
 }
 
+// messageDepth returns the maximum nesting depth of arrays and objects in
+// the provided json data. Brackets within strings are not counted.
+func messageDepth(data []byte) int {
+	var depth, maxDepth int
+	var inString, escaped bool
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case ']', '}':
+			depth--
+		}
+	}
+	return maxDepth
+}
+
+// paramArray asserts the provided value is an array of at least the
+// provided length.
+func paramArray(v interface{}, n int) ([]interface{}, bool) {
+	params, ok := v.([]interface{})
+	if !ok || len(params) < n {
+		return nil, false
+	}
+	return params, true
+}
+
 // IdentifyMessage determines the received message type. It returns the message
 // cast to the appropriate message type, the message type and an error type.
+// Messages nested deeper than the maximum message depth and requests with
+// more than the maximum number of params are refused.
 func IdentifyMessage(data []byte) (Message, int, error) {
+	if messageDepth(data) > maxMessageDepth {
+		desc := fmt.Sprintf("message exceeds the maximum nesting depth "+
+			"of %d", maxMessageDepth)
+		return nil, UnknownMessage, MakeError(ErrParse, desc, nil)
+	}
+
 	var req Request
 	err := json.Unmarshal(data, &req)
 	if err != nil {
@@ -139,6 +402,12 @@ func IdentifyMessage(data []byte) (Message, int, error) {
 	}
 
 	if req.Method != "" {
+		if params, ok := req.Params.([]interface{}); ok &&
+			len(params) > maxMessageParams {
+			desc := fmt.Sprintf("request has %d params, the maximum "+
+				"is %d", len(params), maxMessageParams)
+			return nil, UnknownMessage, MakeError(ErrParse, desc, nil)
+		}
 		if req.ID == nil {
 			return &req, NotificationMessage, nil
 		}
@@ -168,26 +437,57 @@ func AuthorizeRequest(id *uint64, name string, address string) *Request {
 	}
 }
 
-// ParseAuthorizeRequest resolves an authorize request into its components.
-func ParseAuthorizeRequest(req *Request) (string, error) {
+// ParseAuthorizeRequest resolves an authorize request into its components,
+// the username and password. The password is optional.
+func ParseAuthorizeRequest(req *Request) (string, string, error) {
 	if req.Method != Authorize {
 		desc := "request method is not authorize"
-		return "", MakeError(ErrParse, desc, nil)
+		return "", "", MakeError(ErrParse, desc, nil)
 	}
 
-	auth, ok := req.Params.([]interface{})
+	auth, ok := paramArray(req.Params, 1)
 	if !ok {
 		desc := "failed to parse authorize parameters"
-		return "", MakeError(ErrParse, desc, nil)
+		return "", "", MakeError(ErrParse, desc, nil)
 	}
 
 	username, ok := auth[0].(string)
 	if !ok {
 		desc := "failed to parse username parameter"
-		return "", MakeError(ErrParse, desc, nil)
+		return "", "", MakeError(ErrParse, desc, nil)
+	}
+
+	var password string
+	if len(auth) > 1 && auth[1] != nil {
+		password, ok = auth[1].(string)
+		if !ok {
+			desc := "failed to parse password parameter"
+			return "", "", MakeError(ErrParse, desc, nil)
+		}
 	}
 
-	return username, nil
+	return username, password, nil
+}
+
+// ParseAuthorizeUsername resolves the provided pool mining username of the
+// format address.clientid into its address and client id. The address must
+// be a valid address, with a valid checksum, of the provided network. This
+// validates the username syntactically without any database access.
+func ParseAuthorizeUsername(username string, activeNet *chaincfg.Params) (string, string, error) {
+	parts := strings.Split(username, ".")
+	if len(parts) != 2 {
+		desc := fmt.Sprintf("invalid username format, expected "+
+			"`address.clientid`, got %v", username)
+		return "", "", MakeError(ErrParse, desc, nil)
+	}
+	address := strings.TrimSpace(parts[0])
+	name := strings.TrimSpace(parts[1])
+	_, err := dcrutil.DecodeAddress(address, activeNet)
+	if err != nil {
+		desc := fmt.Sprintf("invalid address %s", address)
+		return "", "", MakeError(ErrParse, desc, err)
+	}
+	return address, name, nil
 }
 
 // AuthorizeResponse creates an authorize response.
@@ -225,40 +525,76 @@ func SubscribeRequest(id *uint64, userAgent string, version string, notifyID str
 	}
 }
 
+// ExtraNonce2SubscribeRequest creates a subscribe request message
+// requesting the provided extraNonce2 size.
+func ExtraNonce2SubscribeRequest(id *uint64, userAgent string, version string, notifyID string, extraNonce2Size int) *Request {
+	agent := fmt.Sprintf("%s/%s", userAgent, version)
+	return &Request{
+		ID:     id,
+		Method: Subscribe,
+		Params: []interface{}{agent, notifyID, extraNonce2Size},
+	}
+}
+
 // ParseSubscribeRequest resolves a subscribe request into its components.
-func ParseSubscribeRequest(req *Request) (string, string, error) {
+// The requested extraNonce2 size is zero if the request does not provide
+// one, a request providing one may leave the subscription id null.
+func ParseSubscribeRequest(req *Request) (string, string, uint64, error) {
 	if req.Method != Subscribe {
 		desc := "request method is not subscribe"
-		return "", "", MakeError(ErrParse, desc, nil)
+		return "", "", 0, MakeError(ErrParse, desc, nil)
 	}
 
 	params, ok := req.Params.([]interface{})
 	if !ok {
 		desc := "failed to parse subscribe parameters"
-		return "", "", MakeError(ErrParse, desc, nil)
+		return "", "", 0, MakeError(ErrParse, desc, nil)
 	}
 
 	if len(params) == 0 {
 		desc := "no user agent provided for subscribe request"
-		return "", "", MakeError(ErrParse, desc, nil)
+		return "", "", 0, MakeError(ErrParse, desc, nil)
 	}
 
 	miner, ok := params[0].(string)
 	if !ok {
 		desc := "failed to parse miner parameter"
-		return "", "", MakeError(ErrParse, desc, nil)
+		return "", "", 0, MakeError(ErrParse, desc, nil)
 	}
 
 	id := ""
-	if len(params) == 2 {
+	if (len(params) == 2 || len(params) == 3) && params[1] != nil {
 		id, ok = params[1].(string)
 		if !ok {
 			desc := "failed to parse id parameter"
-			return "", "", MakeError(ErrParse, desc, nil)
+			return "", "", 0, MakeError(ErrParse, desc, nil)
 		}
 	}
 
-	return miner, id, nil
+	var extraNonce2Size uint64
+	if len(params) == 3 {
+		size, ok := params[2].(float64)
+		if !ok || size < 0 || size > math.MaxUint32 ||
+			size != math.Trunc(size) {
+			desc := "failed to parse extraNonce2Size parameter"
+			return "", "", 0, MakeError(ErrParse, desc, nil)
+		}
+		extraNonce2Size = uint64(size)
+	}
+
+	return miner, id, extraNonce2Size, nil
+}
+
+// grantExtraNonce2Size returns the extraNonce2 size granted to the provided
+// miner requesting the provided size, zero if none was requested.
+// Requested sizes are clamped to the supported range. Miners ignoring the
+// extraNonce2Size provided are granted the size they use regardless.
+func grantExtraNonce2Size(miner string, requested uint64) int {
+	profile, ok := fetchMinerProfile(miner)
+	if !ok {
+		return clampExtraNonce2Size(requested)
+	}
+	return profile.ExtraNonce2Size(requested)
 }
 
 // SubscribeResponse creates a mining.subscribe response.
@@ -288,19 +624,19 @@ func ParseSubscribeResponse(resp *Response) (string, string, string, uint64, err
 		return "", "", "", 0, MakeError(ErrParse, desc, nil)
 	}
 
-	res, ok := resp.Result.([]interface{})
+	res, ok := paramArray(resp.Result, 3)
 	if !ok {
 		desc := "failed to parse result parameter"
 		return "", "", "", 0, MakeError(ErrParse, desc, nil)
 	}
 
-	subs, ok := res[0].([]interface{})
+	subs, ok := paramArray(res[0], 2)
 	if !ok {
 		desc := "failed to parse subscription details"
 		return "", "", "", 0, MakeError(ErrParse, desc, nil)
 	}
 
-	diff, ok := subs[0].([]interface{})
+	diff, ok := paramArray(subs[0], 2)
 	if !ok {
 		desc := "failed to parse difficulty id details"
 		return "", "", "", 0, MakeError(ErrParse, desc, nil)
@@ -312,7 +648,7 @@ func ParseSubscribeResponse(resp *Response) (string, string, string, uint64, err
 		return "", "", "", 0, MakeError(ErrParse, desc, nil)
 	}
 
-	notify, ok := subs[1].([]interface{})
+	notify, ok := paramArray(subs[1], 2)
 	if !ok {
 		desc := "failed to parse notify id details"
 		return "", "", "", 0, MakeError(ErrParse, desc, nil)
@@ -358,13 +694,101 @@ func ParseSetDifficultyNotification(req *Request) (uint64, error) {
 		return 0, MakeError(ErrParse, desc, nil)
 	}
 
-	params, ok := req.Params.([]interface{})
+	params, ok := paramArray(req.Params, 1)
 	if !ok {
 		desc := "failed to parse set difficulty parameters"
 		return 0, MakeError(ErrParse, desc, nil)
 	}
 
-	return uint64(params[0].(float64)), nil
+	difficulty, ok := params[0].(float64)
+	if !ok || difficulty < 0 {
+		desc := "failed to parse difficulty parameter"
+		return 0, MakeError(ErrParse, desc, nil)
+	}
+
+	return uint64(difficulty), nil
+}
+
+// ShowMessageNotification creates a show message notification message.
+func ShowMessageNotification(message string) *Request {
+	return &Request{
+		Method: ShowMessage,
+		Params: []string{message},
+	}
+}
+
+// ParseShowMessageNotification resolves a show message notification into
+// its message.
+func ParseShowMessageNotification(req *Request) (string, error) {
+	if req.Method != ShowMessage {
+		desc := "notification method is not show message"
+		return "", MakeError(ErrParse, desc, nil)
+	}
+
+	params, ok := req.Params.([]interface{})
+	if !ok || len(params) == 0 {
+		desc := "failed to parse show message parameters"
+		return "", MakeError(ErrParse, desc, nil)
+	}
+
+	message, ok := params[0].(string)
+	if !ok {
+		desc := "failed to parse show message parameter"
+		return "", MakeError(ErrParse, desc, nil)
+	}
+
+	return message, nil
+}
+
+// GetVersionRequest creates a request for the version of the client's
+// mining software.
+func GetVersionRequest(id *uint64) *Request {
+	return &Request{
+		ID:     id,
+		Method: GetVersion,
+		Params: []string{},
+	}
+}
+
+// ParseGetVersionResponse resolves a get version response into the version
+// of the client's mining software.
+func ParseGetVersionResponse(resp *Response) (string, *StratumError, error) {
+	if resp.Error != nil {
+		return "", resp.Error, nil
+	}
+
+	version, ok := resp.Result.(string)
+	if !ok {
+		desc := "failed to parse version result"
+		return "", nil, MakeError(ErrParse, desc, nil)
+	}
+
+	return version, nil, nil
+}
+
+// PingRequest creates a keepalive request message.
+func PingRequest(id *uint64) *Request {
+	return &Request{
+		ID:     id,
+		Method: Ping,
+		Params: []string{},
+	}
+}
+
+// ParsePingResponse resolves a keepalive response, the result of successful
+// keepalive responses is "pong".
+func ParsePingResponse(resp *Response) (*StratumError, error) {
+	if resp.Error != nil {
+		return resp.Error, nil
+	}
+
+	result, ok := resp.Result.(string)
+	if !ok || result != "pong" {
+		desc := "failed to parse keepalive result"
+		return nil, MakeError(ErrParse, desc, nil)
+	}
+
+	return nil, nil
 }
 
 // WorkNotification creates a work notification message.
@@ -384,7 +808,7 @@ func ParseWorkNotification(req *Request) (string, string, string, string, string
 			MakeError(ErrParse, desc, nil)
 	}
 
-	params, ok := req.Params.([]interface{})
+	params, ok := paramArray(req.Params, 9)
 	if !ok {
 		desc := "failed to parse work parameters"
 		return "", "", "", "", "", "", "", false,
@@ -481,80 +905,21 @@ func GenerateBlockHeader(blockVersionE string, prevBlockE string,
 }
 
 // GenerateSolvedBlockHeader create a block header from a mining.submit message
-// and its associated job.
+// and its associated job. The extraNonce2 of miners respecting the
+// extraNonce2Size provided is of the provided size.
 func GenerateSolvedBlockHeader(headerE string, extraNonce1E string,
-	extraNonce2E string, nTimeE string, nonceE string, miner string) (*wire.BlockHeader, error) {
+	extraNonce2E string, extraNonce2Size int, nTimeE string, nonceE string, miner string) (*wire.BlockHeader, error) {
 	headerEB := []byte(headerE)
-
-	switch miner {
-	case CPU:
-		copy(headerEB[272:280], []byte(nTimeE))
-		copy(headerEB[280:288], []byte(nonceE))
-		copy(headerEB[288:296], []byte(extraNonce1E))
-		copy(headerEB[296:304], []byte(extraNonce2E))
-
-	// The Antiminer DR3 and DR5 return a 12-byte entraNonce comprised of the
-	// the extraNonce1 and extraNonce2 regardless of the extraNonce2Size
-	// specified in the mining.subscribe message. The nTime and nonce values
-	// submitted are big endian, they have to be reversed before block header
-	// reconstruction.
-	case AntminerDR3, AntminerDR5:
-		nTimeERev, err := hexReversed(nTimeE)
-		if err != nil {
-			return nil, err
-		}
-		copy(headerEB[272:280], []byte(nTimeERev))
-
-		nonceERev, err := hexReversed(nonceE)
-		if err != nil {
-			return nil, err
-		}
-		copy(headerEB[280:288], []byte(nonceERev))
-		copy(headerEB[288:312], []byte(extraNonce2E))
-
-	// The Innosilicon D9 respects the extraNonce2Size specified in the
-	// mining.subscribe response sent to it. The extraNonce2 value submitted is
-	// exclusively the extraNonce2. The nTime and nonce values submitted are
-	// big endian, they have to be reversed to little endian before header
-	// reconstruction.
-	case InnosiliconD9:
-		nTimeERev, err := hexReversed(nTimeE)
-		if err != nil {
-			return nil, err
-		}
-		copy(headerEB[272:280], []byte(nTimeERev))
-
-		nonceERev, err := hexReversed(nonceE)
-		if err != nil {
-			return nil, err
-		}
-		copy(headerEB[280:288], []byte(nonceERev))
-		copy(headerEB[288:296], []byte(extraNonce1E))
-		copy(headerEB[296:304], []byte(extraNonce2E))
-
-	// The Whatsminer D1 does not respect the extraNonce2Size specified in the
-	// mining.subscribe response sent to it. The 8-byte extranonce submitted is
-	// is for the extraNonce1 and extraNonce2. The nTime and nonce values
-	// submitted are big endian, they have to be reversed to little endian
-	// before header reconstruction.
-	case WhatsminerD1:
-		nTimeERev, err := hexReversed(nTimeE)
-		if err != nil {
-			return nil, err
-		}
-		copy(headerEB[272:280], []byte(nTimeERev))
-
-		nonceERev, err := hexReversed(nonceE)
-		if err != nil {
-			return nil, err
-		}
-		copy(headerEB[280:288], []byte(nonceERev))
-		copy(headerEB[288:304], []byte(extraNonce2E))
-
-	default:
+	profile, ok := fetchMinerProfile(miner)
+	if !ok {
 		desc := fmt.Sprintf("specified miner %s is unknown", miner)
 		return nil, MakeError(ErrOther, desc, nil)
 	}
+	err := profile.SolveHeader(headerEB, extraNonce1E, extraNonce2E,
+		extraNonce2Size, nTimeE, nonceE)
+	if err != nil {
+		return nil, err
+	}
 
 	solvedHeaderD, err := hex.DecodeString(string(headerEB))
 	if err != nil {
@@ -582,13 +947,15 @@ func SubmitWorkRequest(id *uint64, workerName string, jobID string, extraNonce2
 }
 
 // ParseSubmitWorkRequest resolves a submit work request into its components.
-func ParseSubmitWorkRequest(req *Request, miner string) (string, string, string, string, string, error) {
+// The extraNonce2 of miners respecting the extraNonce2Size provided must be
+// of the provided size.
+func ParseSubmitWorkRequest(req *Request, miner string, extraNonce2Size int) (string, string, string, string, string, error) {
 	if req.Method != Submit {
 		desc := "request method is not submit"
 		return "", "", "", "", "", MakeError(ErrParse, desc, nil)
 	}
 
-	params, ok := req.Params.([]interface{})
+	params, ok := paramArray(req.Params, 5)
 	if !ok {
 		desc := "failed to parse submit work parameters"
 		return "", "", "", "", "", MakeError(ErrParse, desc, nil)
@@ -611,6 +978,12 @@ func ParseSubmitWorkRequest(req *Request, miner string) (string, string, string,
 		desc := "failed to parse extraNonce2 parameter"
 		return "", "", "", "", "", MakeError(ErrParse, desc, nil)
 	}
+	if profile, ok := fetchMinerProfile(miner); ok {
+		err := profile.ValidateExtraNonce2(extraNonce2, extraNonce2Size)
+		if err != nil {
+			return "", "", "", "", "", err
+		}
+	}
 
 	nTime, ok := params[3].(string)
 	if !ok {
@@ -646,3 +1019,125 @@ func ParseSubmitWorkResponse(resp *Response) (bool, *StratumError, error) {
 
 	return status, resp.Error, nil
 }
+
+// AccountOptions represents the account settings miners can change through
+// the set option extension. Options left nil are not changed.
+type AccountOptions struct {
+	// MinPayout represents the minimum payout of the account in DCR, zero
+	// for the pool's minimum payment.
+	MinPayout *float64
+	// DigestHours represents the period, in hours, covered by the activity
+	// digests of the account, zero if the account is not opted into
+	// digests.
+	DigestHours *uint32
+}
+
+// optionsMap returns the set options of the provided account options keyed
+// by option name.
+func optionsMap(options *AccountOptions) map[string]interface{} {
+	m := make(map[string]interface{})
+	if options.MinPayout != nil {
+		m[MinPayoutOption] = *options.MinPayout
+	}
+	if options.DigestHours != nil {
+		m[DigestHoursOption] = float64(*options.DigestHours)
+	}
+	return m
+}
+
+// parseOptionsMap resolves the provided options keyed by option name into
+// account options. Unknown options and invalid values are refused.
+func parseOptionsMap(m map[string]interface{}) (*AccountOptions, error) {
+	options := new(AccountOptions)
+	for name, v := range m {
+		value, ok := v.(float64)
+		if !ok || math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+			desc := fmt.Sprintf("invalid %s option value %v", name, v)
+			return nil, MakeError(ErrParse, desc, nil)
+		}
+		switch name {
+		case MinPayoutOption:
+			options.MinPayout = &value
+		case DigestHoursOption:
+			if value != math.Trunc(value) || value > math.MaxUint32 {
+				desc := fmt.Sprintf("invalid %s option value %v", name, v)
+				return nil, MakeError(ErrParse, desc, nil)
+			}
+			hours := uint32(value)
+			options.DigestHours = &hours
+		default:
+			desc := fmt.Sprintf("unknown option %s", name)
+			return nil, MakeError(ErrParse, desc, nil)
+		}
+	}
+	return options, nil
+}
+
+// SetOptionRequest creates a set option request changing the provided
+// account options.
+func SetOptionRequest(id *uint64, options *AccountOptions) *Request {
+	return &Request{
+		ID:     id,
+		Method: SetOption,
+		Params: []interface{}{optionsMap(options)},
+	}
+}
+
+// ParseSetOptionRequest resolves a set option request into the account
+// options to change. The request carries a single object of option values
+// keyed by option name, eg. {"minpayout": 2.5, "digesthours": 24}.
+func ParseSetOptionRequest(req *Request) (*AccountOptions, error) {
+	if req.Method != SetOption {
+		desc := "request method is not set option"
+		return nil, MakeError(ErrParse, desc, nil)
+	}
+
+	params, ok := paramArray(req.Params, 1)
+	if !ok {
+		desc := "failed to parse set option parameters"
+		return nil, MakeError(ErrParse, desc, nil)
+	}
+
+	m, ok := params[0].(map[string]interface{})
+	if !ok || len(m) == 0 {
+		desc := "failed to parse options parameter"
+		return nil, MakeError(ErrParse, desc, nil)
+	}
+
+	return parseOptionsMap(m)
+}
+
+// SetOptionResponse creates a set option response echoing the provided
+// account options applied.
+func SetOptionResponse(id uint64, options *AccountOptions, err *StratumError) *Response {
+	var result interface{}
+	if options != nil {
+		result = optionsMap(options)
+	}
+	return &Response{
+		ID:     id,
+		Error:  err,
+		Result: result,
+	}
+}
+
+// ParseSetOptionResponse resolves a set option response into the account
+// options applied.
+func ParseSetOptionResponse(resp *Response) (*AccountOptions, *StratumError, error) {
+	if resp.Error != nil {
+		return nil, resp.Error, nil
+	}
+
+	m, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		desc := "failed to parse set option result"
+		return nil, nil, MakeError(ErrParse, desc, nil)
+	}
+
+	options, err := parseOptionsMap(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return options, nil, nil
+}
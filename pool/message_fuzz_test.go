@@ -0,0 +1,58 @@
+//go:build go1.18
+// +build go1.18
+
+package pool
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// FuzzIdentifyMessage ensures identifying and parsing received messages
+// never panics. Identified requests are parsed as every request type.
+func FuzzIdentifyMessage(f *testing.F) {
+	id := uint64(1)
+	seeds := []*Request{
+		AuthorizeRequest(&id, "tcl", "SsiuwSRYvH7pqWmRxFJWR8Vmqc3AWsjmK2Y"),
+		SubscribeRequest(&id, "cpuminer", "1.0.0", "mn"),
+		SubmitWorkRequest(&id, "tcl", "job", "00000000", "954cee5d",
+			"6ddf0200"),
+		benchWorkNotification(),
+		ShowMessageNotification("message"),
+	}
+	for _, seed := range seeds {
+		data, err := json.Marshal(seed)
+		if err != nil {
+			f.Fatalf("unable to marshal seed: %v", err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, msgType, err := IdentifyMessage(data)
+		if err != nil {
+			return
+		}
+		switch msgType {
+		case RequestMessage, NotificationMessage:
+			req := *msg.(*Request)
+			req.Method = Authorize
+			ParseAuthorizeRequest(&req)
+			req.Method = Subscribe
+			ParseSubscribeRequest(&req)
+			req.Method = SetDifficulty
+			ParseSetDifficultyNotification(&req)
+			req.Method = ShowMessage
+			ParseShowMessageNotification(&req)
+			req.Method = Notify
+			ParseWorkNotification(&req)
+			req.Method = Submit
+			ParseSubmitWorkRequest(&req, CPU, ExtraNonce2Size)
+
+		case ResponseMessage:
+			resp := msg.(*Response)
+			ParseAuthorizeResponse(resp)
+			ParseSubscribeResponse(resp)
+			ParseSubmitWorkResponse(resp)
+		}
+	})
+}
@@ -0,0 +1,480 @@
+package pool
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/Eacred/eacrd/chaincfg"
+)
+
+// benchWorkE represents the getwork data of the work benchmarked.
+const benchWorkE = "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+	"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+	"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+	"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+	"00000000000000000000000003e133920204e00000000000029000" +
+	"000a6030000954cee5d00000000000000000000000000000000000" +
+	"000000000000000000000000000000000000000000000800000010" +
+	"0000000000005a0"
+
+// benchWorkNotification returns a work notification of the benchmarked
+// work.
+func benchWorkNotification() *Request {
+	return WorkNotification("job", benchWorkE[8:72], benchWorkE[72:288],
+		benchWorkE[352:360], benchWorkE[:8], benchWorkE[232:240],
+		benchWorkE[272:280], true)
+}
+
+// BenchmarkIdentifyMessage benchmarks identifying a submit work request.
+func BenchmarkIdentifyMessage(b *testing.B) {
+	id := uint64(1)
+	data, err := json.Marshal(SubmitWorkRequest(&id, "tcl", "job",
+		"00000000", "954cee5d", "6ddf0200"))
+	if err != nil {
+		b.Fatalf("[Marshal] unexpected error: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := IdentifyMessage(data)
+		if err != nil {
+			b.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+	}
+}
+
+// BenchmarkWorkNotification benchmarks preparing and encoding an Antminer
+// DR3 work notification.
+func BenchmarkWorkNotification(b *testing.B) {
+	data, err := json.Marshal(benchWorkNotification())
+	if err != nil {
+		b.Fatalf("[Marshal] unexpected error: %v", err)
+	}
+	msg, _, err := IdentifyMessage(data)
+	if err != nil {
+		b.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	req := msg.(*Request)
+	encoder := json.NewEncoder(ioutil.Discard)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		workNotif, err := formatWorkNotification(AntminerDR3, req)
+		if err != nil {
+			b.Fatalf("[formatWorkNotification] unexpected error: %v", err)
+		}
+		err = encoder.Encode(workNotif)
+		if err != nil {
+			b.Fatalf("[Encode] unexpected error: %v", err)
+		}
+	}
+}
+
+// BenchmarkParseSubmitWorkRequest benchmarks parsing a submit work request.
+func BenchmarkParseSubmitWorkRequest(b *testing.B) {
+	id := uint64(1)
+	data, err := json.Marshal(SubmitWorkRequest(&id, "tcl", "job",
+		"00000000", "954cee5d", "6ddf0200"))
+	if err != nil {
+		b.Fatalf("[Marshal] unexpected error: %v", err)
+	}
+	msg, _, err := IdentifyMessage(data)
+	if err != nil {
+		b.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	req := msg.(*Request)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _, _, _, err := ParseSubmitWorkRequest(req, CPU, ExtraNonce2Size)
+		if err != nil {
+			b.Fatalf("[ParseSubmitWorkRequest] unexpected error: %v", err)
+		}
+	}
+}
+
+func testMessageValidation(t *testing.T) {
+	// Ensure deeply nested messages and requests with too many params are
+	// refused.
+	refused := []string{
+		`{"id":1,"method":"mining.submit","params":[[[[[[[[[1]]]]]]]]]}`,
+		`{"id":1,"method":"mining.submit","params":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17]}`,
+	}
+	for _, data := range refused {
+		_, _, err := IdentifyMessage([]byte(data))
+		if !IsError(err, ErrParse) {
+			t.Fatalf("expected a parse error for %s, got %v", data, err)
+		}
+	}
+
+	// Ensure brackets within strings do not count towards the nesting
+	// depth.
+	data := `{"id":1,"method":"mining.submit","params":["[[[[[[[[[\"]]"]}`
+	_, _, err := IdentifyMessage([]byte(data))
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+
+	// Ensure requests with missing or mistyped params are parse errors.
+	malformed := map[string]func(*Request) error{
+		`{"id":1,"method":"mining.authorize","params":[]}`: func(req *Request) error {
+			_, _, err := ParseAuthorizeRequest(req)
+			return err
+		},
+		`{"method":"mining.set_difficulty","params":["1"]}`: func(req *Request) error {
+			_, err := ParseSetDifficultyNotification(req)
+			return err
+		},
+		`{"method":"mining.notify","params":["job","prev"]}`: func(req *Request) error {
+			_, _, _, _, _, _, _, _, err := ParseWorkNotification(req)
+			return err
+		},
+		`{"id":1,"method":"mining.submit","params":["tcl"]}`: func(req *Request) error {
+			_, _, _, _, _, err := ParseSubmitWorkRequest(req, CPU, ExtraNonce2Size)
+			return err
+		},
+	}
+	for data, parse := range malformed {
+		msg, _, err := IdentifyMessage([]byte(data))
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		err = parse(msg.(*Request))
+		if !IsError(err, ErrParse) {
+			t.Fatalf("expected a parse error for %s, got %v", data, err)
+		}
+	}
+	data = `{"id":1,"error":null,"result":[[["mining.set_difficulty"]],"00"]}`
+	msg, _, err := IdentifyMessage([]byte(data))
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	_, _, _, _, err = ParseSubscribeResponse(msg.(*Response))
+	if !IsError(err, ErrParse) {
+		t.Fatalf("expected a parse error for %s, got %v", data, err)
+	}
+
+	// Ensure usernames are validated syntactically, including the address
+	// checksum and network.
+	address, name, err := ParseAuthorizeUsername(xAddr+".rig",
+		chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatalf("[ParseAuthorizeUsername] unexpected error: %v", err)
+	}
+	if address != xAddr || name != "rig" {
+		t.Fatalf("expected address %s and name rig, got %s and %s", xAddr,
+			address, name)
+	}
+	usernames := []struct {
+		username string
+		net      *chaincfg.Params
+	}{
+		{xAddr, chaincfg.SimNetParams()},
+		{xAddr + ".rig.1", chaincfg.SimNetParams()},
+		{"garbage.rig", chaincfg.SimNetParams()},
+		{xAddr[:len(xAddr)-1] + "d.rig", chaincfg.SimNetParams()},
+		{xAddr + ".rig", chaincfg.MainNetParams()},
+	}
+	for _, test := range usernames {
+		_, _, err := ParseAuthorizeUsername(test.username, test.net)
+		if !IsError(err, ErrParse) {
+			t.Fatalf("expected a parse error for %s on %s, got %v",
+				test.username, test.net.Name, err)
+		}
+	}
+}
+
+func testMessageIDs(t *testing.T) {
+	// Ensure the request id shapes sent by miners are canonicalized and
+	// ids not in the canonical form are echoed as sent.
+	tests := []struct {
+		name  string
+		data  string
+		id    uint64
+		null  bool
+		rawID string
+	}{{
+		name: "cgminer",
+		data: `{"id": 4, "method": "mining.submit", "params": []}`,
+		id:   4,
+	}, {
+		name: "cgminer notification",
+		data: `{"id": null, "method": "mining.extranonce.subscribe", "params": []}`,
+		null: true,
+	}, {
+		name:  "DR5 stock firmware",
+		data:  `{"id":"1","method":"mining.subscribe","params":["DR5/1.0"]}`,
+		id:    1,
+		rawID: `"1"`,
+	}, {
+		name:  "NiceHash hex",
+		data:  `{"id":"0x1f","method":"mining.authorize","params":[]}`,
+		id:    0x1f,
+		rawID: `"0x1f"`,
+	}, {
+		name:  "NiceHash large",
+		data:  `{"id":18446744073709551616,"method":"mining.submit","params":[]}`,
+		rawID: `18446744073709551616`,
+	}, {
+		name:  "session id",
+		data:  `{"id":"c3d1-7","method":"mining.submit","params":[]}`,
+		rawID: `"c3d1-7"`,
+	}}
+	for _, test := range tests {
+		msg, mType, err := IdentifyMessage([]byte(test.data))
+		if err != nil {
+			t.Fatalf("%s: [IdentifyMessage] unexpected error: %v", test.name,
+				err)
+		}
+		req := msg.(*Request)
+		if test.null {
+			if mType != NotificationMessage || req.ID != nil {
+				t.Fatalf("%s: expected a notification, got type %d",
+					test.name, mType)
+			}
+			continue
+		}
+		if mType != RequestMessage {
+			t.Fatalf("%s: expected a request, got type %d", test.name, mType)
+		}
+		if string(req.RawID) != test.rawID {
+			t.Fatalf("%s: expected raw id %q, got %q", test.name, test.rawID,
+				req.RawID)
+		}
+		if test.id != 0 && *req.ID != test.id {
+			t.Fatalf("%s: expected id %d, got %d", test.name, test.id,
+				*req.ID)
+		}
+
+		// Ensure responses echo the id exactly as sent and decode to the
+		// same canonical id.
+		resp := NewResponse(*req.ID, true, nil)
+		resp.RawID = req.RawID
+		data, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatalf("%s: [Marshal] unexpected error: %v", test.name, err)
+		}
+		var raw struct {
+			ID json.RawMessage `json:"id"`
+		}
+		err = json.Unmarshal(data, &raw)
+		if err != nil {
+			t.Fatalf("%s: [Unmarshal] unexpected error: %v", test.name, err)
+		}
+		want := test.rawID
+		if want == "" {
+			want = "4"
+		}
+		if string(raw.ID) != want {
+			t.Fatalf("%s: expected response id %s, got %s", test.name, want,
+				raw.ID)
+		}
+		msg, mType, err = IdentifyMessage(data)
+		if err != nil || mType != ResponseMessage ||
+			msg.(*Response).ID != *req.ID {
+			t.Fatalf("%s: expected a response with id %d, got %v (%v)",
+				test.name, *req.ID, msg, err)
+		}
+	}
+
+	// Ensure ids of other types are refused.
+	for _, data := range []string{
+		`{"id":true,"method":"mining.submit","params":[]}`,
+		`{"id":{"n":1},"method":"mining.submit","params":[]}`,
+	} {
+		_, _, err := IdentifyMessage([]byte(data))
+		if !IsError(err, ErrParse) {
+			t.Fatalf("expected a parse error for %s, got %v", data, err)
+		}
+	}
+
+	// Ensure a client answers requests with string ids using the ids as
+	// sent and processes null id requests without answering them.
+	powLimit := chaincfg.SimNetParams().PowLimit
+	registry := newClientRegistry()
+	cfg := &ClientConfig{
+		ActiveNet:   chaincfg.SimNetParams(),
+		SoloPool:    true,
+		Blake256Pad: generateBlake256Pad(),
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt(powLimit),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   new(big.Rat).SetInt(powLimit),
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RegisterClient:   registry.register,
+		DeregisterClient: registry.deregister,
+		RemoveClient:     func(*Client) {},
+		FetchCurrentWork: func() *CurrentWork {
+			return nil
+		},
+		WithinLimit: func(string, int, float64) bool {
+			return true
+		},
+		HashCalcThreshold: 1,
+		IsTraced: func(string, string) bool {
+			return false
+		},
+		Events:   NewEventBus(),
+		Sessions: NewSessionStore(),
+	}
+	client, m := pipeMiner(t, cfg, CPU)
+	m.sendRaw([]byte(`{"id":null,"method":"mining.authorize",` +
+		`"params":["` + xAddr + `.rig0",""]}` + "\n"))
+	m.sendRaw([]byte(`{"id":"1","method":"mining.subscribe",` +
+		`"params":["DR5/1.0"]}` + "\n"))
+	resp := m.awaitResponse(1)
+	if string(resp.RawID) != `"1"` || resp.Error != nil {
+		t.Fatalf("expected a subscribe response with id \"1\", got %s (%v)",
+			resp.RawID, resp.Error)
+	}
+	if !client.isAuthorized() {
+		t.Fatal("expected the null id authorize request to be processed")
+	}
+	client.cancel()
+	m.awaitDisconnect()
+	if !registry.wait(testMinerTimeout) {
+		t.Fatal("expected the client to shut down")
+	}
+}
+
+func testExtraNonce2Size(t *testing.T) {
+	// Ensure requested extraNonce2 sizes are parsed from subscribe
+	// requests, the size and a null subscription id are optional.
+	subscribes := []struct {
+		data string
+		id   string
+		size uint64
+		err  bool
+	}{
+		{`{"id":1,"method":"mining.subscribe","params":["mcpu/1.0.1"]}`, "", 0, false},
+		{`{"id":1,"method":"mining.subscribe","params":["mcpu/1.0.1","mn01"]}`, "mn01", 0, false},
+		{`{"id":1,"method":"mining.subscribe","params":["proxy/1.0","mn01",16]}`, "mn01", 16, false},
+		{`{"id":1,"method":"mining.subscribe","params":["proxy/1.0",null,28]}`, "", 28, false},
+		{`{"id":1,"method":"mining.subscribe","params":["proxy/1.0","",-1]}`, "", 0, true},
+		{`{"id":1,"method":"mining.subscribe","params":["proxy/1.0","",2.5]}`, "", 0, true},
+		{`{"id":1,"method":"mining.subscribe","params":["proxy/1.0","","8"]}`, "", 0, true},
+	}
+	for _, test := range subscribes {
+		msg, _, err := IdentifyMessage([]byte(test.data))
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		_, id, size, err := ParseSubscribeRequest(msg.(*Request))
+		if test.err {
+			if !IsError(err, ErrParse) {
+				t.Fatalf("expected a parse error for %s, got %v", test.data,
+					err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("[ParseSubscribeRequest] unexpected error for %s: %v",
+				test.data, err)
+		}
+		if id != test.id || size != test.size {
+			t.Fatalf("expected id %q and size %d for %s, got %q and %d",
+				test.id, test.size, test.data, id, size)
+		}
+	}
+	id := uint64(1)
+	data, err := json.Marshal(ExtraNonce2SubscribeRequest(&id, "proxy", "1.0",
+		"", MaxExtraNonce2Size))
+	if err != nil {
+		t.Fatalf("[Marshal] unexpected error: %v", err)
+	}
+	msg, _, err := IdentifyMessage(data)
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	_, _, size, err := ParseSubscribeRequest(msg.(*Request))
+	if err != nil || size != MaxExtraNonce2Size {
+		t.Fatalf("expected a requested size of %d, got %d (%v)",
+			MaxExtraNonce2Size, size, err)
+	}
+
+	// Ensure requested sizes are clamped to the supported range and
+	// miners ignoring the size provided keep their size.
+	grants := []struct {
+		miner     string
+		requested uint64
+		granted   int
+	}{
+		{CPU, 0, ExtraNonce2Size},
+		{CPU, 1, MinExtraNonce2Size},
+		{CPU, MinExtraNonce2Size, MinExtraNonce2Size},
+		{CPU, MaxExtraNonce2Size, MaxExtraNonce2Size},
+		{CPU, MaxExtraNonce2Size + 1, MaxExtraNonce2Size},
+		{InnosiliconD9, 8, 8},
+		{AntminerDR3, 16, 8},
+		{AntminerDR5, MinExtraNonce2Size, 8},
+		{WhatsminerD1, 16, ExtraNonce2Size},
+	}
+	for _, test := range grants {
+		granted := grantExtraNonce2Size(test.miner, test.requested)
+		if granted != test.granted {
+			t.Fatalf("%s: expected size %d granted for %d, got %d",
+				test.miner, test.granted, test.requested, granted)
+		}
+	}
+
+	// Ensure submissions of miners respecting the size provided must be of
+	// the size granted.
+	extraNonce2 := strings.Repeat("ab", MaxExtraNonce2Size)
+	submit := SubmitWorkRequest(&id, "tcl", "job", extraNonce2, "954cee5d",
+		"6ddf0200")
+	data, err = json.Marshal(submit)
+	if err != nil {
+		t.Fatalf("[Marshal] unexpected error: %v", err)
+	}
+	msg, _, err = IdentifyMessage(data)
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	req := msg.(*Request)
+	_, _, _, _, _, err = ParseSubmitWorkRequest(req, CPU, MaxExtraNonce2Size)
+	if err != nil {
+		t.Fatalf("[ParseSubmitWorkRequest] unexpected error: %v", err)
+	}
+	_, _, _, _, _, err = ParseSubmitWorkRequest(req, InnosiliconD9,
+		ExtraNonce2Size)
+	if !IsError(err, ErrParse) {
+		t.Fatalf("expected a parse error for a mis-sized extraNonce2, got %v",
+			err)
+	}
+
+	// Ensure the extraNonce2 of the maximum size fills the extra data of
+	// the header following the extraNonce1, leaving the rest of the header
+	// intact.
+	header, err := GenerateSolvedBlockHeader(benchWorkE, "01020304",
+		extraNonce2, MaxExtraNonce2Size, "954cee5d", "6ddf0200", CPU)
+	if err != nil {
+		t.Fatalf("[GenerateSolvedBlockHeader] unexpected error: %v", err)
+	}
+	headerB, err := header.Bytes()
+	if err != nil {
+		t.Fatalf("[Bytes] unexpected error: %v", err)
+	}
+	headerE := hex.EncodeToString(headerB)
+	if headerE[288:352] != "01020304"+extraNonce2 ||
+		headerE[352:] != benchWorkE[352:360] {
+		t.Fatalf("unexpected header extra data %s", headerE[288:360])
+	}
+	for _, size := range []int{MinExtraNonce2Size - 1, MaxExtraNonce2Size + 1} {
+		_, err := GenerateSolvedBlockHeader(benchWorkE, "01020304",
+			extraNonce2, size, "954cee5d", "6ddf0200", CPU)
+		if err == nil {
+			t.Fatalf("expected an error for an extraNonce2 size of %d", size)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+)
+
+// PoolMetadataVersion is the version of the pool metadata format.
+const PoolMetadataVersion = 1
+
+// RetentionWindows represents how long the pool keeps its records, periods
+// are in seconds and depths in blocks.
+type RetentionWindows struct {
+	// Shares represents the period shares are kept for before being pruned
+	// on payment, zero when shares are pruned once paid.
+	Shares int64 `json:"shares"`
+	// Payments represents the period archived payments are kept for, zero
+	// when they are kept indefinitely.
+	Payments int64 `json:"payments"`
+	// JobDepth represents the number of blocks below the chain tip jobs
+	// are kept for.
+	JobDepth uint32 `json:"jobdepth"`
+	// MaxJobs represents the maximum number of jobs kept, zero for no
+	// limit.
+	MaxJobs uint32 `json:"maxjobs"`
+	// StaleJobWindow represents the number of blocks below the chain tip
+	// work for superseded chain tips is still accepted for.
+	StaleJobWindow uint32 `json:"stalejobwindow"`
+	// StaleGracePeriod represents the period, in milliseconds, after a
+	// clean job notification work for the job notified before it is still
+	// credited as late for, zero when late work is rejected as stale.
+	StaleGracePeriod int64 `json:"stalegraceperiod"`
+	// Workers represents the period workers no longer seen are kept for,
+	// zero when they are kept indefinitely.
+	Workers int64 `json:"workers"`
+	// Connections represents the period connection audit records are kept
+	// for, zero when connections are not audited.
+	Connections int64 `json:"connections"`
+	// StatsSamples represents the period raw stats samples are kept for
+	// before being rolled up.
+	StatsSamples int64 `json:"statssamples"`
+	// StatsRollups represents the period stats rollups are kept for.
+	StatsRollups int64 `json:"statsrollups"`
+}
+
+// MinerMetadata represents a miner endpoint of the pool.
+type MinerMetadata struct {
+	Miner          string  `json:"miner"`
+	Port           uint32  `json:"port"`
+	Policy         string  `json:"policy"`
+	DiffMultiplier float64 `json:"diffmultiplier"`
+	Difficulty     float64 `json:"difficulty"`
+}
+
+// DifficultyMetadata represents the parameters pool difficulties are
+// derived from, the maximum generation time is in seconds and the maximum
+// share rate in shares per second.
+type DifficultyMetadata struct {
+	MaxGenTime      uint64  `json:"maxgentime"`
+	MaxShareRate    float64 `json:"maxsharerate"`
+	NonceIterations float64 `json:"nonceiterations"`
+}
+
+// PoolMetadata represents the configuration of the pool relevant to miners
+// and to tools interpreting its records. The hash commits to every other
+// field, a changed hash signals a configuration change.
+type PoolMetadata struct {
+	Version           uint32              `json:"version"`
+	Hash              string              `json:"hash"`
+	Network           string              `json:"network"`
+	SoloPool          bool                `json:"solopool"`
+	PaymentMethod     string              `json:"paymentmethod"`
+	PoolFee           float64             `json:"poolfee"`
+	MinPayout         float64             `json:"minpayout"`
+	SelfServeSettings bool                `json:"selfservesettings"`
+	MaxMinPayout      float64             `json:"maxminpayout"`
+	Miners            []*MinerMetadata    `json:"miners"`
+	Difficulty        *DifficultyMetadata `json:"difficulty"`
+	Retention         *RetentionWindows   `json:"retention"`
+}
+
+// hashPoolMetadata returns the hex encoded hash of the provided metadata,
+// excluding its hash.
+func hashPoolMetadata(meta *PoolMetadata) (string, error) {
+	unhashed := *meta
+	unhashed.Hash = ""
+	b, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(chainhash.HashB(b)), nil
+}
+
+// fetchMinerMetadata returns the miner endpoints of the pool, the base
+// endpoints of each miner type first, ordered by port.
+func (h *Hub) fetchMinerMetadata() ([]*MinerMetadata, error) {
+	endpoints := make(map[uint32]*Endpoint, len(h.endpoints))
+	for _, endpoint := range h.endpoints {
+		endpoints[endpoint.port] = endpoint
+	}
+	describe := func(miner string, port uint32, multiplier float64) (*MinerMetadata, error) {
+		if endpoint, ok := endpoints[port]; ok {
+			_, multiplier = endpoint.fetchDifficultyInfo()
+		}
+		diffInfo, err := h.fetchPoolDiffs().fetchScaledMinerDifficulty(miner,
+			multiplier)
+		if err != nil {
+			return nil, err
+		}
+		diff, _ := diffInfo.difficulty.Float64()
+		return &MinerMetadata{
+			Miner:          miner,
+			Port:           port,
+			Policy:         h.minerPolicy(miner),
+			DiffMultiplier: multiplier,
+			Difficulty:     diff,
+		}, nil
+	}
+
+	base := make([]*MinerMetadata, 0, len(h.cfg.MinerPorts))
+	for miner, port := range h.cfg.MinerPorts {
+		meta, err := describe(miner, port, 1)
+		if err != nil {
+			return nil, err
+		}
+		base = append(base, meta)
+	}
+	extra := make([]*MinerMetadata, 0, len(h.cfg.ExtraEndpoints))
+	for _, spec := range h.cfg.ExtraEndpoints {
+		meta, err := describe(spec.Miner, spec.Port, spec.DiffMultiplier)
+		if err != nil {
+			return nil, err
+		}
+		extra = append(extra, meta)
+	}
+	for _, miners := range [][]*MinerMetadata{base, extra} {
+		sort.Slice(miners, func(i, j int) bool {
+			return miners[i].Port < miners[j].Port
+		})
+	}
+	return append(base, extra...), nil
+}
+
+// FetchPoolMetadata returns the metadata of the pool, assembled from its
+// running configuration.
+func (h *Hub) FetchPoolMetadata() (*PoolMetadata, error) {
+	miners, err := h.fetchMinerMetadata()
+	if err != nil {
+		return nil, err
+	}
+	pCfg := h.paymentMgr.config()
+	poolDiffs := h.fetchPoolDiffs()
+	meta := &PoolMetadata{
+		Version:           PoolMetadataVersion,
+		Network:           h.cfg.ActiveNet.Name,
+		SoloPool:          h.cfg.SoloPool,
+		PaymentMethod:     h.cfg.PaymentMethod,
+		PoolFee:           pCfg.PoolFee,
+		MinPayout:         pCfg.MinPayment.ToCoin(),
+		SelfServeSettings: h.cfg.SelfServeSettings && !h.cfg.SoloPool,
+		Miners:            miners,
+		Difficulty: &DifficultyMetadata{
+			MaxGenTime:      poolDiffs.maxGenTime.Uint64(),
+			MaxShareRate:    poolDiffs.maxShareRate,
+			NonceIterations: h.cfg.NonceIterations,
+		},
+		Retention: &RetentionWindows{
+			JobDepth:       MaxReorgLimit,
+			MaxJobs:        h.cfg.MaxJobs,
+			StaleJobWindow: h.cfg.StaleJobWindow,
+			StaleGracePeriod: int64(h.cfg.StaleGracePeriod /
+				time.Millisecond),
+			Workers:      int64(h.workerMonitor.config().Retention.Seconds()),
+			Connections:  int64(h.cfg.ConnAuditRetention.Seconds()),
+			StatsSamples: int64(statsRawRetention.Seconds()),
+			StatsRollups: int64(statsRollupRetention.Seconds()),
+		},
+	}
+	if meta.SelfServeSettings {
+		meta.MaxMinPayout = MaxMinPayout.ToCoin()
+	}
+	if pCfg.PaymentMethod == PPLNS {
+		meta.Retention.Shares = int64(pCfg.LastNPeriod)
+	}
+	meta.Hash, err = hashPoolMetadata(meta)
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+var (
+	// minerStatsPersistInterval represents the interval miner type
+	// counters are persisted to the database.
+	minerStatsPersistInterval = time.Minute * 5
+
+	// minerStatsEventQueueSize represents the number of client events
+	// queued for the miner stats tracker, events are dropped once the queue
+	// is full.
+	minerStatsEventQueueSize = 1024
+)
+
+// MinerStats represents the composition and share acceptance of the pool's
+// clients of a miner type. Share and block counts are cumulative across
+// restarts, the hash rate is the average of the type's connected clients.
+// Skewed counts the connected clients with clocks skewed beyond the maximum
+// allowed. Late counts the accepted shares credited under the stale grace
+// period.
+type MinerStats struct {
+	Miner       string   `json:"miner"`
+	Connected   uint32   `json:"connected"`
+	Skewed      uint32   `json:"skewed"`
+	Accepted    uint64   `json:"accepted"`
+	Rejected    uint64   `json:"rejected"`
+	Stale       uint64   `json:"stale"`
+	Late        uint64   `json:"late"`
+	BlocksFound uint64   `json:"blocksfound"`
+	HashRate    *big.Rat `json:"-"`
+}
+
+// minerCounters represents the cumulative counters of a miner type.
+type minerCounters struct {
+	accepted    uint64 // update atomically.
+	rejected    uint64 // update atomically.
+	stale       uint64 // update atomically.
+	late        uint64 // update atomically.
+	blocksFound uint64 // update atomically.
+}
+
+// fetchMinerStatsBucket is a helper function for getting the miner stats
+// bucket.
+func fetchMinerStatsBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(minerStatsBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(minerStatsBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// MinerStatsTrackerConfig contains all of the configuration values which
+// should be provided when creating a new instance of MinerStatsTracker.
+type MinerStatsTrackerConfig struct {
+	// DB represents the pool database.
+	DB *bolt.DB
+	// Events represents the hub's event bus share activity is tracked
+	// through.
+	Events *EventBus
+	// HubWg represents the hub's waitgroup.
+	HubWg *sync.WaitGroup
+}
+
+// MinerStatsTracker aggregates share and block counters of the pool's
+// clients by miner type, along with the number of client teardowns by
+// disconnect reason since the pool started. Counters of all known miner
+// types and disconnect reasons are created upfront so they can be updated
+// without locking.
+type MinerStatsTracker struct {
+	cfg         *MinerStatsTrackerConfig
+	events      *Subscription
+	counters    map[string]*minerCounters
+	disconnects map[string]*uint64
+}
+
+// NewMinerStatsTracker creates a miner stats tracker, loading persisted
+// counters.
+func NewMinerStatsTracker(mCfg *MinerStatsTrackerConfig) (*MinerStatsTracker, error) {
+	mt := &MinerStatsTracker{
+		cfg:         mCfg,
+		counters:    make(map[string]*minerCounters, len(ShareWeights)),
+		disconnects: make(map[string]*uint64, numDisconnectReasons),
+	}
+	for miner := range ShareWeights {
+		mt.counters[miner] = new(minerCounters)
+	}
+	for reason := DisconnectUnknown; reason < numDisconnectReasons; reason++ {
+		mt.disconnects[reason.String()] = new(uint64)
+	}
+	err := mt.cfg.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchMinerStatsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			counters, ok := mt.counters[string(k)]
+			if !ok {
+				return nil
+			}
+			var stats MinerStats
+			err := json.Unmarshal(v, &stats)
+			if err != nil {
+				return err
+			}
+			counters.accepted = stats.Accepted
+			counters.rejected = stats.Rejected
+			counters.stale = stats.Stale
+			counters.late = stats.Late
+			counters.blocksFound = stats.BlocksFound
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	mt.events = mCfg.Events.Subscribe(minerStatsEventQueueSize,
+		EventShareAccepted, EventShareRejected, EventBlockFound,
+		EventClientDisconnected)
+	return mt, nil
+}
+
+// handleEvent updates the counters of the miner type of the provided
+// event. Rejected stale jobs are counted as stale instead of rejected, late
+// shares are counted as both accepted and late. Disconnects are counted by
+// reason regardless of the miner type.
+func (mt *MinerStatsTracker) handleEvent(event *HubEvent) {
+	if event.Kind == EventClientDisconnected {
+		count, ok := mt.disconnects[event.Reason]
+		if ok {
+			atomic.AddUint64(count, 1)
+		}
+		return
+	}
+	counters, ok := mt.counters[event.Miner]
+	if !ok {
+		return
+	}
+	switch event.Kind {
+	case EventShareAccepted:
+		atomic.AddUint64(&counters.accepted, 1)
+		if event.Late {
+			atomic.AddUint64(&counters.late, 1)
+		}
+	case EventShareRejected:
+		if event.Reason == NewStratumError(StaleJob, nil).Message {
+			atomic.AddUint64(&counters.stale, 1)
+			return
+		}
+		atomic.AddUint64(&counters.rejected, 1)
+	case EventBlockFound:
+		atomic.AddUint64(&counters.blocksFound, 1)
+	}
+}
+
+// fetchMinerStats returns the counters of all known miner types ordered by
+// miner type.
+func (mt *MinerStatsTracker) fetchMinerStats() []*MinerStats {
+	stats := make([]*MinerStats, 0, len(mt.counters))
+	for miner, counters := range mt.counters {
+		stats = append(stats, &MinerStats{
+			Miner:       miner,
+			Accepted:    atomic.LoadUint64(&counters.accepted),
+			Rejected:    atomic.LoadUint64(&counters.rejected),
+			Stale:       atomic.LoadUint64(&counters.stale),
+			Late:        atomic.LoadUint64(&counters.late),
+			BlocksFound: atomic.LoadUint64(&counters.blocksFound),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Miner < stats[j].Miner
+	})
+	return stats
+}
+
+// fetchDisconnects returns the number of client teardowns by disconnect
+// reason since the pool started.
+func (mt *MinerStatsTracker) fetchDisconnects() map[string]uint64 {
+	disconnects := make(map[string]uint64, len(mt.disconnects))
+	for reason, count := range mt.disconnects {
+		disconnects[reason] = atomic.LoadUint64(count)
+	}
+	return disconnects
+}
+
+// persist saves the current miner type counters to the database.
+func (mt *MinerStatsTracker) persist() error {
+	return mt.cfg.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchMinerStatsBucket(tx)
+		if err != nil {
+			return err
+		}
+		for _, stats := range mt.fetchMinerStats() {
+			statsBytes, err := json.Marshal(stats)
+			if err != nil {
+				return err
+			}
+			err = bkt.Put([]byte(stats.Miner), statsBytes)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// run records share activity published on the hub's event bus and
+// periodically persists the miner type counters. It must be run as a
+// goroutine.
+func (mt *MinerStatsTracker) run(ctx context.Context) {
+	persistTicker := time.NewTicker(minerStatsPersistInterval)
+	defer persistTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			mt.cfg.Events.Unsubscribe(mt.events)
+			err := mt.persist()
+			if err != nil {
+				log.Errorf("unable to persist miner stats: %v", err)
+			}
+			mt.cfg.HubWg.Done()
+			return
+
+		case event := <-mt.events.Events():
+			mt.handleEvent(event)
+
+		case <-persistTicker.C:
+			err := mt.persist()
+			if err != nil {
+				log.Errorf("unable to persist miner stats: %v", err)
+			}
+		}
+	}
+}
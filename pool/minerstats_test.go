@@ -0,0 +1,100 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"sync"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func testMinerStatsTracker(t *testing.T, db *bolt.DB) {
+	mCfg := &MinerStatsTrackerConfig{
+		DB:     db,
+		Events: NewEventBus(),
+		HubWg:  new(sync.WaitGroup),
+	}
+	mt, err := NewMinerStatsTracker(mCfg)
+	if err != nil {
+		t.Fatalf("[NewMinerStatsTracker] unexpected error: %v", err)
+	}
+	stale := NewStratumError(StaleJob, nil).Message
+	lowDiff := NewStratumError(LowDifficultyShare, nil).Message
+	events := []*HubEvent{
+		{Kind: EventShareAccepted, Miner: CPU},
+		{Kind: EventShareAccepted, Miner: CPU, Late: true},
+		{Kind: EventShareRejected, Miner: CPU, Reason: stale},
+		{Kind: EventShareRejected, Miner: CPU, Reason: lowDiff},
+		{Kind: EventBlockFound, Miner: CPU},
+		{Kind: EventShareAccepted, Miner: AntminerDR3},
+		{Kind: EventShareAccepted, Miner: "unknown"},
+		{Kind: EventClientDisconnected, Miner: CPU, Reason: "eof"},
+		{Kind: EventClientDisconnected, Reason: "eof"},
+		{Kind: EventClientDisconnected, Miner: CPU, Reason: "readtimeout"},
+		{Kind: EventClientDisconnected, Miner: CPU, Reason: "bogus"},
+	}
+	for _, event := range events {
+		mt.handleEvent(event)
+	}
+
+	// Ensure counters are tracked per miner type, stale shares are counted
+	// apart from other rejected shares and late shares as accepted.
+	fetch := func(mt *MinerStatsTracker, miner string) *MinerStats {
+		for _, stats := range mt.fetchMinerStats() {
+			if stats.Miner == miner {
+				return stats
+			}
+		}
+		t.Fatalf("expected stats for miner %s", miner)
+		return nil
+	}
+	cpu := fetch(mt, CPU)
+	if cpu.Accepted != 2 || cpu.Rejected != 1 || cpu.Stale != 1 ||
+		cpu.Late != 1 || cpu.BlocksFound != 1 {
+		t.Fatalf("unexpected cpu stats: %+v", cpu)
+	}
+	dr3 := fetch(mt, AntminerDR3)
+	if dr3.Accepted != 1 || dr3.Rejected != 0 || dr3.BlocksFound != 0 {
+		t.Fatalf("unexpected %s stats: %+v", AntminerDR3, dr3)
+	}
+	if len(mt.fetchMinerStats()) != len(ShareWeights) {
+		t.Fatalf("expected stats for %d miner types, got %d",
+			len(ShareWeights), len(mt.fetchMinerStats()))
+	}
+
+	// Ensure disconnects are counted by reason, regardless of miner type.
+	disconnects := mt.fetchDisconnects()
+	if len(disconnects) != int(numDisconnectReasons) {
+		t.Fatalf("expected counts for %d disconnect reasons, got %d",
+			numDisconnectReasons, len(disconnects))
+	}
+	if disconnects[DisconnectEOF.String()] != 2 ||
+		disconnects[DisconnectReadTimeout.String()] != 1 ||
+		disconnects[DisconnectProtocolError.String()] != 0 {
+		t.Fatalf("unexpected disconnect counts: %v", disconnects)
+	}
+
+	// Ensure counters persist across tracker restarts.
+	err = mt.persist()
+	if err != nil {
+		t.Fatalf("[persist] unexpected error: %v", err)
+	}
+	mt, err = NewMinerStatsTracker(mCfg)
+	if err != nil {
+		t.Fatalf("[NewMinerStatsTracker] unexpected error: %v", err)
+	}
+	cpu = fetch(mt, CPU)
+	if cpu.Accepted != 2 || cpu.Rejected != 1 || cpu.Stale != 1 ||
+		cpu.Late != 1 || cpu.BlocksFound != 1 {
+		t.Fatalf("unexpected persisted cpu stats: %+v", cpu)
+	}
+
+	// Empty the miner stats bucket.
+	err = emptyBucket(db, minerStatsBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
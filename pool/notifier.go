@@ -0,0 +1,303 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+const (
+	// BlockFound is the event published when a block mined by the pool is
+	// confirmed by the network.
+	BlockFound = "blockfound"
+
+	// BlockAccepted is the event published when work submitted by a client
+	// is accepted by the network.
+	BlockAccepted = "blockaccepted"
+
+	// PaymentSent is the event published when a payment transaction is
+	// dispatched.
+	PaymentSent = "paymentsent"
+
+	// PaymentsDeferred is the event published when a payment cycle is
+	// deferred because the wallet's spendable balance does not cover it.
+	PaymentsDeferred = "paymentsdeferred"
+
+	// WorkerOffline is the event published when an active worker stops
+	// submitting shares.
+	WorkerOffline = "workeroffline"
+
+	// WorkerOnline is the event published when an offline worker resumes
+	// submitting shares.
+	WorkerOnline = "workeronline"
+
+	// MaintenanceStarted is the event published when a scheduled
+	// maintenance window starts.
+	MaintenanceStarted = "maintenancestarted"
+
+	// MaintenanceEnded is the event published when a maintenance window
+	// ends or is cancelled.
+	MaintenanceEnded = "maintenanceended"
+
+	// BlockLost is the event published when work submitted by a client
+	// solves a block but fails submission to the consensus daemon.
+	BlockLost = "blocklost"
+
+	// AccountDigest is the event published when the activity digest of an
+	// account opted into digests is due.
+	AccountDigest = "accountdigest"
+
+	// AccountIDCollision is the event published when an address deriving
+	// the account id of the account of another address is refused.
+	AccountIDCollision = "accountidcollision"
+
+	// WebhookSignatureHeader is the header of a webhook request carrying
+	// the hex encoded HMAC-SHA256 signature of the request body.
+	WebhookSignatureHeader = "X-Eacrpool-Signature"
+)
+
+var (
+	// webhookQueueSize represents the number of undelivered events queued
+	// per webhook, events are dropped once the queue is full.
+	webhookQueueSize = 64
+
+	// webhookMaxAttempts represents the maximum number of delivery attempts
+	// of an event to a webhook.
+	webhookMaxAttempts = 3
+
+	// webhookRetryDelay represents the delay between delivery attempts, it
+	// increases linearly with every failed attempt.
+	webhookRetryDelay = time.Second * 2
+
+	// webhookTimeout represents the timeout of a webhook request.
+	webhookTimeout = time.Second * 10
+
+	// webhookBreakerThreshold represents the number of consecutive failed
+	// deliveries after which a webhook is considered unavailable.
+	webhookBreakerThreshold = uint32(5)
+
+	// webhookBreakerCooldown represents the period deliveries to an
+	// unavailable webhook are skipped for.
+	webhookBreakerCooldown = time.Minute * 5
+)
+
+// NotifierConfig represents configuration details for the webhook notifier.
+type NotifierConfig struct {
+	// URLs represents the webhook urls events are delivered to.
+	URLs []string
+	// Events represents the events delivered to webhooks, all events are
+	// delivered if none are provided.
+	Events []string
+	// Secret represents the key used in signing webhook requests.
+	Secret string
+	// HubWg represents the hub's waitgroup.
+	HubWg *sync.WaitGroup
+}
+
+// Event represents a pool event delivered to webhooks.
+type Event struct {
+	Type      string      `json:"type"`
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// BlockFoundData represents the details of a block found event.
+type BlockFoundData struct {
+	Height  uint32         `json:"height"`
+	Hash    string         `json:"hash"`
+	Account string         `json:"account"`
+	Worker  string         `json:"worker"`
+	Reward  dcrutil.Amount `json:"reward"`
+}
+
+// PaymentSentData represents the details of a payment sent event.
+type PaymentSentData struct {
+	TransactionID string         `json:"transactionid"`
+	Total         dcrutil.Amount `json:"total"`
+	Recipients    uint32         `json:"recipients"`
+}
+
+// webhook represents an event delivery destination.
+type webhook struct {
+	url       string
+	ch        chan []byte
+	failures  uint32
+	openUntil time.Time
+}
+
+// Notifier delivers pool events to the configured webhooks.
+type Notifier struct {
+	cfg    *NotifierConfig
+	events map[string]struct{}
+	hooks  []*webhook
+	client *http.Client
+}
+
+// NewNotifier creates a webhook notifier.
+func NewNotifier(nCfg *NotifierConfig) (*Notifier, error) {
+	n := &Notifier{
+		cfg:    nCfg,
+		events: make(map[string]struct{}),
+		hooks:  make([]*webhook, 0, len(nCfg.URLs)),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+	for _, event := range nCfg.Events {
+		switch event {
+		case BlockFound, BlockAccepted, PaymentSent, PaymentsDeferred,
+			WorkerOffline, WorkerOnline, MaintenanceStarted, MaintenanceEnded,
+			BlockLost, AccountDigest, AccountIDCollision:
+			n.events[event] = struct{}{}
+		default:
+			return nil, fmt.Errorf("unknown webhook event: %s", event)
+		}
+	}
+	for _, hookURL := range nCfg.URLs {
+		u, err := url.Parse(hookURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook url %s: %v", hookURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid webhook url %s: unsupported "+
+				"scheme %q", hookURL, u.Scheme)
+		}
+		n.hooks = append(n.hooks, &webhook{
+			url: hookURL,
+			ch:  make(chan []byte, webhookQueueSize),
+		})
+	}
+	return n, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 signature of the provided payload.
+func (n *Notifier) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(n.cfg.Secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// publish queues the provided event for delivery to all webhooks. Events
+// are dropped for webhooks with full delivery queues.
+func (n *Notifier) publish(eventType string, data interface{}) {
+	if len(n.events) > 0 {
+		if _, ok := n.events[eventType]; !ok {
+			return
+		}
+	}
+	event := &Event{
+		Type:      eventType,
+		Timestamp: time.Now().Unix(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("unable to encode %s event: %v", eventType, err)
+		return
+	}
+	for _, hook := range n.hooks {
+		select {
+		case hook.ch <- payload:
+		default:
+			log.Warnf("Webhook queue for %s full, dropping %s event",
+				hook.url, eventType)
+		}
+	}
+}
+
+// deliver sends the provided payload to the webhook, retrying failed
+// deliveries.
+func (n *Notifier) deliver(ctx context.Context, hook *webhook, payload []byte) error {
+	signature := n.sign(payload)
+	var err error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(webhookRetryDelay * time.Duration(attempt-1)):
+			}
+		}
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodPost, hook.url,
+			bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(WebhookSignatureHeader, signature)
+
+		var resp *http.Response
+		resp, err = n.client.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return err
+}
+
+// handleWebhook delivers queued events to the provided webhook. Deliveries
+// are skipped while the webhook is considered unavailable after repeated
+// failures. It must be run as a goroutine.
+func (n *Notifier) handleWebhook(ctx context.Context, hook *webhook, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case payload := <-hook.ch:
+			if time.Now().Before(hook.openUntil) {
+				log.Tracef("Webhook %s unavailable, dropping event", hook.url)
+				continue
+			}
+			err := n.deliver(ctx, hook, payload)
+			if err == nil {
+				hook.failures = 0
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			hook.failures++
+			log.Errorf("unable to deliver event to webhook %s: %v",
+				hook.url, err)
+			if hook.failures >= webhookBreakerThreshold {
+				hook.openUntil = time.Now().Add(webhookBreakerCooldown)
+				hook.failures = 0
+				log.Warnf("Webhook %s unavailable, skipping deliveries "+
+					"for %v", hook.url, webhookBreakerCooldown)
+			}
+		}
+	}
+}
+
+// run handles the lifecycle of the webhook notifier. It must be run as a
+// goroutine.
+func (n *Notifier) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, hook := range n.hooks {
+		wg.Add(1)
+		go n.handleWebhook(ctx, hook, &wg)
+	}
+	wg.Wait()
+	n.cfg.HubWg.Done()
+}
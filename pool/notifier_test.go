@@ -0,0 +1,170 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+func testNotifier(t *testing.T) {
+	secret := "secret"
+	var calls int32
+	var received []*Event
+	var receivedMtx sync.Mutex
+	events := make(chan struct{}, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := atomic.AddInt32(&calls, 1)
+
+		// Fail the first delivery attempt.
+		if call == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := hex.EncodeToString(mac.Sum(nil))
+		if r.Header.Get(WebhookSignatureHeader) != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event Event
+		err = json.Unmarshal(body, &event)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		receivedMtx.Lock()
+		received = append(received, &event)
+		receivedMtx.Unlock()
+		events <- struct{}{}
+	}))
+	defer server.Close()
+
+	var deadCalls int32
+	deadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&deadCalls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer deadServer.Close()
+
+	retryDelay := webhookRetryDelay
+	breakerThreshold := webhookBreakerThreshold
+	webhookRetryDelay = time.Millisecond * 10
+	webhookBreakerThreshold = 1
+	defer func() {
+		webhookRetryDelay = retryDelay
+		webhookBreakerThreshold = breakerThreshold
+	}()
+
+	// Ensure invalid configurations are rejected.
+	_, err := NewNotifier(&NotifierConfig{
+		URLs:   []string{server.URL},
+		Events: []string{"unknown"},
+	})
+	if err == nil {
+		t.Fatal("[NewNotifier] expected an unknown event error")
+	}
+	_, err = NewNotifier(&NotifierConfig{
+		URLs: []string{"ftp://127.0.0.1"},
+	})
+	if err == nil {
+		t.Fatal("[NewNotifier] expected an invalid url error")
+	}
+
+	nCfg := &NotifierConfig{
+		URLs:   []string{server.URL, deadServer.URL},
+		Events: []string{BlockFound},
+		Secret: secret,
+		HubWg:  new(sync.WaitGroup),
+	}
+	n, err := NewNotifier(nCfg)
+	if err != nil {
+		t.Fatalf("[NewNotifier] unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	nCfg.HubWg.Add(1)
+	go n.run(ctx)
+
+	// Ensure filtered events are not delivered and failed deliveries are
+	// retried.
+	n.publish(PaymentSent, &PaymentSentData{
+		TransactionID: "txid",
+		Total:         dcrutil.Amount(100),
+		Recipients:    2,
+	})
+	n.publish(BlockFound, &BlockFoundData{
+		Height:  42,
+		Hash:    "hash",
+		Account: xID,
+		Reward:  dcrutil.Amount(100),
+	})
+	select {
+	case <-events:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected a block found event delivery")
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("expected 2 delivery attempts, got %d",
+			atomic.LoadInt32(&calls))
+	}
+	receivedMtx.Lock()
+	if len(received) != 1 || received[0].Type != BlockFound {
+		t.Fatalf("expected a single %s event", BlockFound)
+	}
+	data, ok := received[0].Data.(map[string]interface{})
+	if !ok || data["height"] != float64(42) || data["account"] != xID {
+		t.Fatalf("unexpected block found event data: %v", received[0].Data)
+	}
+	receivedMtx.Unlock()
+
+	// Ensure an unavailable webhook does not hold up deliveries to other
+	// webhooks and is skipped after repeated failures.
+	for i := 0; i < 2; i++ {
+		n.publish(BlockFound, &BlockFoundData{Height: 43})
+		select {
+		case <-events:
+		case <-time.After(time.Second * 5):
+			t.Fatal("expected a block found event delivery")
+		}
+	}
+	deadHook := n.hooks[1]
+	for i := 0; i < 100; i++ {
+		if atomic.LoadInt32(&deadCalls) == int32(webhookMaxAttempts) &&
+			len(deadHook.ch) == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if atomic.LoadInt32(&deadCalls) != int32(webhookMaxAttempts) {
+		t.Fatalf("expected %d delivery attempts to the unavailable "+
+			"webhook, got %d", webhookMaxAttempts,
+			atomic.LoadInt32(&deadCalls))
+	}
+
+	cancel()
+	nCfg.HubWg.Wait()
+	if !time.Now().Before(deadHook.openUntil) {
+		t.Fatal("expected the unavailable webhook to be skipped")
+	}
+}
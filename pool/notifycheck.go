@@ -0,0 +1,94 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// headerHexLen represents the length of a hex encoded block header.
+const headerHexLen = 360
+
+// validateWorkNotification asserts the provided work notification, as
+// formatted for the provided miner, carries the header of the provided
+// work. The header is reassembled from the notification fields the way a
+// compliant miner does, with a zero extraNonce, and compared with the
+// header of the work outside of the extraNonce region. The nBits and nTime
+// fields some miners read instead of the header must match the header.
+func validateWorkNotification(miner string, workE string, req *Request) error {
+	if len(workE) < headerHexLen {
+		desc := fmt.Sprintf("work of length %d is shorter than a block "+
+			"header", len(workE))
+		return MakeError(ErrWrongInputLength, desc, nil)
+	}
+	_, prevBlock, genTx1, genTx2, blockVersion, nBits, nTime, _, err :=
+		ParseWorkNotification(req)
+	if err != nil {
+		return err
+	}
+	fields := []struct {
+		name  string
+		value string
+		size  int
+	}{
+		{"prevBlock", prevBlock, 64},
+		{"genTx1", genTx1, 216},
+		{"genTx2", genTx2, 8},
+		{"blockVersion", blockVersion, 8},
+		{"nBits", nBits, 8},
+		{"nTime", nTime, 8},
+	}
+	for _, field := range fields {
+		if len(field.value) != field.size {
+			desc := fmt.Sprintf("%s of length %d, expected %d", field.name,
+				len(field.value), field.size)
+			return MakeError(ErrWrongInputLength, desc, nil)
+		}
+	}
+
+	// Undo the encodings of the miner, see formatWorkNotification.
+	profile, ok := fetchMinerProfile(miner)
+	if !ok {
+		desc := fmt.Sprintf("unknown miner provided: %s", miner)
+		return MakeError(ErrNotSupported, desc, nil)
+	}
+	restored, err := profile.RestoreWorkNotification(req)
+	if err != nil {
+		return err
+	}
+	_, prevBlock, genTx1, genTx2, blockVersion, nBits, nTime, _, err =
+		ParseWorkNotification(restored)
+	if err != nil {
+		return err
+	}
+
+	header, err := GenerateBlockHeader(blockVersion, prevBlock, genTx1,
+		"00000000", genTx2)
+	if err != nil {
+		return err
+	}
+	headerB, err := header.Bytes()
+	if err != nil {
+		return err
+	}
+	headerE := hex.EncodeToString(headerB)
+	for _, r := range [][2]int{{0, 288}, {352, headerHexLen}} {
+		for i := r[0]; i < r[1]; i++ {
+			if headerE[i] != workE[i] {
+				desc := fmt.Sprintf("reassembled %s header differs from "+
+					"the work at offset %d", miner, i)
+				return MakeError(ErrOther, desc, nil)
+			}
+		}
+	}
+	if nBits != workE[232:240] || nTime != workE[272:280] {
+		desc := fmt.Sprintf("%s nBits %s and nTime %s differ from the "+
+			"work's %s and %s", miner, nBits, nTime, workE[232:240],
+			workE[272:280])
+		return MakeError(ErrOther, desc, nil)
+	}
+	return nil
+}
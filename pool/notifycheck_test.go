@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"testing"
+)
+
+func testWorkNotificationIntegrity(t *testing.T) {
+	workE := fixtureWorkE
+	miners := []string{CPU, AntminerDR3, AntminerDR5, InnosiliconD9,
+		WhatsminerD1}
+
+	// Ensure notifications of correctly sliced work carry the work header
+	// in the encoding of every miner.
+	notif := WorkNotification(fixtureJobID, workE[8:72], workE[72:288],
+		workE[352:360], workE[:8], workE[232:240], workE[272:280], true)
+	for _, miner := range miners {
+		formatted, err := formatWorkNotification(miner, notif)
+		if err != nil {
+			t.Fatalf("[formatWorkNotification] unexpected error: %v", err)
+		}
+		err = validateWorkNotification(miner, workE, formatted)
+		if err != nil {
+			t.Fatalf("[validateWorkNotification] unexpected %s error: %v",
+				miner, err)
+		}
+	}
+
+	// Ensure notifications of work sliced off by one, with mismatched
+	// nBits or nTime fields or unformatted for a miner are refused.
+	shifted := WorkNotification(fixtureJobID, workE[8:72], workE[74:290],
+		workE[352:360], workE[:8], workE[232:240], workE[272:280], true)
+	nBits := WorkNotification(fixtureJobID, workE[8:72], workE[72:288],
+		workE[352:360], workE[:8], "ffff001d", workE[272:280], true)
+	nTime := WorkNotification(fixtureJobID, workE[8:72], workE[72:288],
+		workE[352:360], workE[:8], workE[232:240], "00000000", true)
+	short := WorkNotification(fixtureJobID, workE[8:72], workE[72:286],
+		workE[352:360], workE[:8], workE[232:240], workE[272:280], true)
+	for _, miner := range miners {
+		for _, req := range []*Request{shifted, nBits, nTime, short} {
+			formatted, err := formatWorkNotification(miner, req)
+			if err != nil {
+				t.Fatalf("[formatWorkNotification] unexpected error: %v",
+					err)
+			}
+			err = validateWorkNotification(miner, workE, formatted)
+			if err == nil {
+				t.Fatalf("expected an invalid %s notification %v", miner,
+					req.Params)
+			}
+		}
+	}
+	err := validateWorkNotification(AntminerDR3, workE, notif)
+	if err == nil {
+		t.Fatal("expected an unformatted notification to be refused")
+	}
+}
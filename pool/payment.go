@@ -6,13 +6,43 @@ package pool
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"time"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
 	"github.com/Eacred/eacrd/dcrutil"
+	"github.com/Eacred/eacrd/mempool"
+	"github.com/Eacred/eacrd/txscript"
+	txrules "github.com/Eacred/eacrwallet/wallet/txrules"
+)
+
+const (
+	// p2pkhOutputSize is the serialized size of a transaction output paying
+	// to a P2PKH address. It is calculated as:
+	//
+	//   - 8 bytes output value
+	//   - 2 bytes version
+	//   - 1 byte compact int encoding value 25
+	//   - 25 bytes P2PKH output script
+	p2pkhOutputSize = 8 + 2 + 1 + 25
+
+	// paymentTxOverhead is the estimated serialized size of a payment
+	// transaction excluding its payout outputs, assuming a single P2PKH
+	// input and a change output. It is calculated as:
+	//
+	//   - 4 bytes version, 4 bytes lock time and 4 bytes expiry
+	//   - 3 bytes compact int encodings of the input, output and
+	//     witness counts
+	//   - 41 bytes input prefix (outpoint, tree and sequence)
+	//   - 125 bytes input witness (value, block height and index, and the
+	//     108 byte P2PKH signature script with its length)
+	//   - the change output
+	paymentTxOverhead = 4 + 4 + 4 + 3 + 41 + 125 + p2pkhOutputSize
 )
 
 // Payment represents an outstanding payment for a pool account.
@@ -24,6 +54,33 @@ type Payment struct {
 	CreatedOn         int64          `json:"createdon"`
 	PaidOnHeight      uint32         `json:"paidonheight"`
 	TransactionID     string         `json:"transactionid"`
+
+	// FeeRate represents the pool fee rate charged in calculating the
+	// payment.
+	FeeRate float64 `json:"feerate"`
+
+	// Donation indicates the payment is a donation by the account, paid
+	// to the pool's donation address.
+	Donation bool `json:"donation,omitempty"`
+
+	// Quarantine represents the reason the payment requires attention
+	// before it can be paid out, quarantined payments remain pending
+	// until they are requeued.
+	Quarantine string `json:"quarantine,omitempty"`
+
+	// BlockHash represents the hash of the mined block at the payment
+	// height the payment derives from.
+	BlockHash string `json:"blockhash,omitempty"`
+
+	// Percentage represents the share percentage of the account used in
+	// calculating the payment. It is nil for pool fee payments and
+	// payments created before percentages were recorded.
+	Percentage *big.Rat `json:"percentage,omitempty"`
+
+	// ShareBoundary represents the window of shares the payment batch was
+	// calculated from. It is nil for payments created before share
+	// windows were recorded.
+	ShareBoundary *ShareBoundary `json:"shareboundary,omitempty"`
 }
 
 // NewPayment creates a payment instance.
@@ -76,6 +133,118 @@ func fetchPaymentArchiveBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
 	return bkt, nil
 }
 
+// fetchPaymentTotalBucket is a helper function for getting the payment
+// total bucket.
+func fetchPaymentTotalBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(paymentTotalBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(paymentTotalBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// fetchAccountPaymentBucket is a helper function for getting the account
+// payment index bucket of the provided payment bucket, the pending or the
+// archived payment bucket.
+func fetchAccountPaymentBucket(tx *bolt.Tx, bucket []byte) (*bolt.Bucket, error) {
+	index := accountPaymentBkt
+	if bytes.Equal(bucket, paymentArchiveBkt) {
+		index = accountPaymentArchiveBkt
+	}
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(index)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(index))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// accountPaymentKey returns the account payment index key of the payment of
+// the provided account with the provided id. Keys are prefixed by the
+// account id followed by the payment id so the payments of an account are
+// contiguous and sorted by time.
+func accountPaymentKey(account string, id []byte) []byte {
+	k := make([]byte, 0, len(account)+len(id))
+	k = append(k, account...)
+	return append(k, id...)
+}
+
+// forEachAccountPayment calls the provided function with the payments of
+// the provided account in the provided payment bucket, most recent first,
+// until it returns false. Payments are read through the provided account
+// payment index of the bucket, index entries of removed payments and of
+// other accounts sharing the prefix of the account id are skipped.
+func forEachAccountPayment(bkt *bolt.Bucket, ibkt *bolt.Bucket, id string, f func(*Payment) bool) error {
+	prefix := []byte(id)
+	c := ibkt.Cursor()
+	k, _ := c.Seek(append(append([]byte(nil), prefix...), 0xff))
+	if k == nil {
+		k, _ = c.Last()
+	} else {
+		k, _ = c.Prev()
+	}
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Prev() {
+		v := bkt.Get(k[len(prefix):])
+		if v == nil {
+			continue
+		}
+		var payment Payment
+		err := json.Unmarshal(v, &payment)
+		if err != nil {
+			return err
+		}
+		if payment.Account != id {
+			continue
+		}
+		if !f(&payment) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// addPaymentTotal adds the provided amount to the total paid to the
+// provided account.
+func addPaymentTotal(bkt *bolt.Bucket, account string, amt dcrutil.Amount) error {
+	total := amt
+	v := bkt.Get([]byte(account))
+	if v != nil {
+		total += dcrutil.Amount(binary.BigEndian.Uint64(v))
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(total))
+	return bkt.Put([]byte(account), b)
+}
+
+// fetchPaymentTotal fetches the total amount of archived payments paid to the
+// provided account.
+func fetchPaymentTotal(db *bolt.DB, account string) (dcrutil.Amount, error) {
+	var total dcrutil.Amount
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchPaymentTotalBucket(tx)
+		if err != nil {
+			return err
+		}
+		v := bkt.Get([]byte(account))
+		if v != nil {
+			total = dcrutil.Amount(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return total, err
+}
+
 // GetPayment fetches the payment referenced by the provided id.
 func GetPayment(db *bolt.DB, id []byte) (*Payment, error) {
 	var payment Payment
@@ -98,6 +267,32 @@ func GetPayment(db *bolt.DB, id []byte) (*Payment, error) {
 	return &payment, err
 }
 
+// putPayment persists the provided payment to the provided payment bucket
+// and indexes it in the provided account payment index of the bucket.
+func putPayment(bkt *bolt.Bucket, ibkt *bolt.Bucket, pmt *Payment) error {
+	b, err := json.Marshal(pmt)
+	if err != nil {
+		return err
+	}
+	id := GeneratePaymentID(pmt.CreatedOn, pmt.Height, pmt.Account)
+	err = bkt.Put(id, b)
+	if err != nil {
+		return err
+	}
+	return ibkt.Put(accountPaymentKey(pmt.Account, id), []byte{})
+}
+
+// deletePayment removes the payment with the provided id from the provided
+// payment bucket and its entry from the provided account payment index of
+// the bucket.
+func deletePayment(bkt *bolt.Bucket, ibkt *bolt.Bucket, account string, id []byte) error {
+	err := bkt.Delete(id)
+	if err != nil {
+		return err
+	}
+	return ibkt.Delete(accountPaymentKey(account, id))
+}
+
 // Create persists a payment to the database.
 func (pmt *Payment) Create(db *bolt.DB) error {
 	err := db.Update(func(tx *bolt.Tx) error {
@@ -105,12 +300,11 @@ func (pmt *Payment) Create(db *bolt.DB) error {
 		if err != nil {
 			return err
 		}
-		b, err := json.Marshal(pmt)
+		ibkt, err := fetchAccountPaymentBucket(tx, paymentBkt)
 		if err != nil {
 			return err
 		}
-		id := GeneratePaymentID(pmt.CreatedOn, pmt.Height, pmt.Account)
-		return bkt.Put(id, b)
+		return putPayment(bkt, ibkt, pmt)
 	})
 	return err
 }
@@ -122,8 +316,18 @@ func (pmt *Payment) Update(db *bolt.DB) error {
 
 // Delete purges the referenced pending payment from the database.
 func (pmt *Payment) Delete(db *bolt.DB) error {
-	id := GeneratePaymentID(pmt.CreatedOn, pmt.Height, pmt.Account)
-	return deleteEntry(db, paymentBkt, id)
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchPaymentBucket(tx)
+		if err != nil {
+			return err
+		}
+		ibkt, err := fetchAccountPaymentBucket(tx, paymentBkt)
+		if err != nil {
+			return err
+		}
+		id := GeneratePaymentID(pmt.CreatedOn, pmt.Height, pmt.Account)
+		return deletePayment(bkt, ibkt, pmt.Account, id)
+	})
 }
 
 // PaymentBundle is a convenience type for grouping payments for an account.
@@ -170,43 +374,61 @@ func (bundle *PaymentBundle) ArchivePayments(db *bolt.DB) error {
 		if err != nil {
 			return err
 		}
+		tbkt, err := fetchPaymentTotalBucket(tx)
+		if err != nil {
+			return err
+		}
+		pibkt, err := fetchAccountPaymentBucket(tx, paymentBkt)
+		if err != nil {
+			return err
+		}
+		aibkt, err := fetchAccountPaymentBucket(tx, paymentArchiveBkt)
+		if err != nil {
+			return err
+		}
 		for _, pmt := range bundle.Payments {
 			id := GeneratePaymentID(pmt.CreatedOn, pmt.Height, pmt.Account)
-			err := pbkt.Delete(id)
+			err := deletePayment(pbkt, pibkt, pmt.Account, id)
 			if err != nil {
 				return err
 			}
 			pmt.CreatedOn = time.Now().UnixNano()
-			pmtBytes, err := json.Marshal(pmt)
+			err = putPayment(abkt, aibkt, pmt)
 			if err != nil {
 				return err
 			}
-			id = GeneratePaymentID(pmt.CreatedOn, pmt.Height, pmt.Account)
-			err = abkt.Put(id, pmtBytes)
+			if pmt.Donation {
+				continue
+			}
+			err = addPaymentTotal(tbkt, pmt.Account, pmt.Amount)
 			if err != nil {
 				return err
 			}
 		}
-		return nil
+		return accrueDigestPayments(tx, bundle.Payments, true)
 	})
 	return err
 }
 
 // generatePaymentBundles creates batched payments from the provided
-// set of payments.
+// set of payments. Donations of all accounts are bundled together.
 func generatePaymentBundles(payments []*Payment) []*PaymentBundle {
 	bundles := make([]*PaymentBundle, 0)
 	for _, payment := range payments {
+		account := payment.Account
+		if payment.Donation {
+			account = donationsK
+		}
 		match := false
 		for _, bdl := range bundles {
-			if payment.Account == bdl.Account {
+			if account == bdl.Account {
 				bdl.Payments = append(bdl.Payments, payment)
 				match = true
 				break
 			}
 		}
 		if !match {
-			bdl := newPaymentBundle(payment.Account)
+			bdl := newPaymentBundle(account)
 			bdl.Payments = append(bdl.Payments, payment)
 			bundles = append(bundles, bdl)
 		}
@@ -214,6 +436,32 @@ func generatePaymentBundles(payments []*Payment) []*PaymentBundle {
 	return bundles
 }
 
+// chunkPaymentBundles splits the provided payment bundles into groups which
+// can each be paid out by a single transaction. Every bundle results in one
+// transaction output, groups are bounded by the provided maximum output count
+// and the estimated serialized size of their outputs. A zero bound is treated
+// as unbounded. A group always has at least one bundle.
+func chunkPaymentBundles(bundles []*PaymentBundle, maxOutputs uint32, maxSize uint32) [][]*PaymentBundle {
+	chunks := make([][]*PaymentBundle, 0)
+	chunk := make([]*PaymentBundle, 0)
+	var chunkSize uint32
+	for _, bundle := range bundles {
+		exceedsCount := maxOutputs > 0 && uint32(len(chunk)) >= maxOutputs
+		exceedsSize := maxSize > 0 && chunkSize+p2pkhOutputSize > maxSize
+		if len(chunk) > 0 && (exceedsCount || exceedsSize) {
+			chunks = append(chunks, chunk)
+			chunk = make([]*PaymentBundle, 0)
+			chunkSize = 0
+		}
+		chunk = append(chunk, bundle)
+		chunkSize += p2pkhOutputSize
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
 // filterPayments iterates the payments bucket, the result set is generated
 // based on the provided filter.
 func filterPayments(db *bolt.DB, filter func(payment *Payment) bool) ([]*Payment, error) {
@@ -242,6 +490,32 @@ func filterPayments(db *bolt.DB, filter func(payment *Payment) bool) ([]*Payment
 	return payments, nil
 }
 
+// filterAccountPayments iterates the pending payments of the provided
+// account, the result set is generated based on the provided filter.
+func filterAccountPayments(db *bolt.DB, id string, filter func(payment *Payment) bool) ([]*Payment, error) {
+	payments := make([]*Payment, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchPaymentBucket(tx)
+		if err != nil {
+			return err
+		}
+		ibkt, err := fetchAccountPaymentBucket(tx, paymentBkt)
+		if err != nil {
+			return err
+		}
+		return forEachAccountPayment(bkt, ibkt, id, func(payment *Payment) bool {
+			if filter(payment) {
+				payments = append(payments, payment)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
 // fetchPendingPayments fetches all unpaid payments.
 func fetchPendingPayments(db *bolt.DB) ([]*Payment, error) {
 	filter := func(payment *Payment) bool {
@@ -254,6 +528,29 @@ func fetchPendingPayments(db *bolt.DB) ([]*Payment, error) {
 	return payments, nil
 }
 
+// fetchPendingBalance fetches the total amount of unpaid payments due the
+// provided account.
+func fetchPendingBalance(db *bolt.DB, id string) (dcrutil.Amount, error) {
+	var balance dcrutil.Amount
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchPaymentBucket(tx)
+		if err != nil {
+			return err
+		}
+		ibkt, err := fetchAccountPaymentBucket(tx, paymentBkt)
+		if err != nil {
+			return err
+		}
+		return forEachAccountPayment(bkt, ibkt, id, func(payment *Payment) bool {
+			if payment.PaidOnHeight == 0 && !payment.Donation {
+				balance += payment.Amount
+			}
+			return true
+		})
+	})
+	return balance, err
+}
+
 // fetchMaturePendingPayments fetches all payments past their estimated
 // maturities which have not been paid yet.
 func fetchMaturePendingPayments(db *bolt.DB, height uint32) ([]*Payment, error) {
@@ -268,6 +565,40 @@ func fetchMaturePendingPayments(db *bolt.DB, height uint32) ([]*Payment, error)
 	return payments, nil
 }
 
+// fetchQuarantinedPayments fetches all pending payments requiring
+// attention, optionally limited to the provided account id.
+func fetchQuarantinedPayments(db *bolt.DB, accountID string) ([]*Payment, error) {
+	filter := func(payment *Payment) bool {
+		return payment.PaidOnHeight == 0 && payment.Quarantine != "" &&
+			(accountID == "" || payment.Account == accountID)
+	}
+	return filterPayments(db, filter)
+}
+
+// quarantinePayments marks the provided pending payments as requiring
+// attention for the provided reason.
+func quarantinePayments(db *bolt.DB, payments []*Payment, reason string) error {
+	for _, payment := range payments {
+		payment.Quarantine = reason
+		err := payment.Update(db)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePayoutAddress asserts the provided address decodes for the
+// provided network and a payout script can be constructed for it.
+func validatePayoutAddress(address string, net *chaincfg.Params) error {
+	addr, err := dcrutil.DecodeAddress(address, net)
+	if err != nil {
+		return err
+	}
+	_, err = txscript.PayToAddrScript(addr)
+	return err
+}
+
 // fetchPendingPaymentsAtHeight fetches all pending payments at the provided
 // height.
 func fetchPendingPaymentsAtHeight(db *bolt.DB, height uint32) ([]*Payment, error) {
@@ -281,10 +612,85 @@ func fetchPendingPaymentsAtHeight(db *bolt.DB, height uint32) ([]*Payment, error
 	return payments, nil
 }
 
+// fetchPaymentSources fetches the archived payments of the provided account
+// paid out by the transaction with the provided id. Each payment records
+// the mined block it derives from and the share percentage of the account
+// used in calculating it.
+func fetchPaymentSources(db *bolt.DB, accountID string, txid string) ([]*Payment, error) {
+	pmts := make([]*Payment, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		abkt, err := fetchPaymentArchiveBucket(tx)
+		if err != nil {
+			return err
+		}
+		ibkt, err := fetchAccountPaymentBucket(tx, paymentArchiveBkt)
+		if err != nil {
+			return err
+		}
+		return forEachAccountPayment(abkt, ibkt, accountID, func(payment *Payment) bool {
+			if payment.TransactionID == txid {
+				pmts = append(pmts, payment)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pmts, nil
+}
+
+// fetchBlockPayments fetches the pending and archived payments funded by
+// the block mined by the pool at the provided height. Payments of a block
+// are removed when it is disconnected, so the height identifies the block.
+func fetchBlockPayments(db *bolt.DB, height uint32) ([]*Payment, error) {
+	pmts := make([]*Payment, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		pbkt, err := fetchPaymentBucket(tx)
+		if err != nil {
+			return err
+		}
+		abkt, err := fetchPaymentArchiveBucket(tx)
+		if err != nil {
+			return err
+		}
+		for _, bkt := range []*bolt.Bucket{pbkt, abkt} {
+			c := bkt.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				var payment Payment
+				err := json.Unmarshal(v, &payment)
+				if err != nil {
+					return err
+				}
+				if payment.Height == height {
+					pmts = append(pmts, &payment)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pmts, nil
+}
+
+// estimatePaymentFees returns the estimated transaction fees of paying out
+// the provided payment chunks, one transaction per chunk.
+func estimatePaymentFees(chunks [][]*PaymentBundle) dcrutil.Amount {
+	var fees dcrutil.Amount
+	for _, chunk := range chunks {
+		size := paymentTxOverhead + len(chunk)*p2pkhOutputSize
+		fees += txrules.FeeForSerializeSize(mempool.DefaultMinRelayTxFee,
+			size)
+	}
+	return fees
+}
+
 // generatePaymentDetails generates kv pair of addresses and payment amounts
 // from the provided eligible payments.
 func generatePaymentDetails(db *bolt.DB, poolFeeAddr dcrutil.Address,
-	eligiblePmts []*PaymentBundle) (map[string]dcrutil.Amount, *dcrutil.Amount, error) {
+	donationAddr dcrutil.Address, eligiblePmts []*PaymentBundle) (map[string]dcrutil.Amount, *dcrutil.Amount, error) {
 	var targetAmt dcrutil.Amount
 	pmts := make(map[string]dcrutil.Amount)
 	for _, p := range eligiblePmts {
@@ -294,6 +700,16 @@ func generatePaymentDetails(db *bolt.DB, poolFeeAddr dcrutil.Address,
 			targetAmt += bundleAmt
 			continue
 		}
+		if p.Account == donationsK {
+			if donationAddr == nil {
+				desc := "no donation address set for donation payments"
+				return nil, nil, MakeError(ErrOther, desc, nil)
+			}
+			bundleAmt := p.Total()
+			pmts[donationAddr.String()] += bundleAmt
+			targetAmt += bundleAmt
+			continue
+		}
 		acc, err := FetchAccount(db, []byte(p.Account))
 		if err != nil {
 			return nil, nil, err
@@ -318,22 +734,14 @@ func fetchArchivedPaymentsForAccount(db *bolt.DB, id string, n uint) ([]*Payment
 		if err != nil {
 			return err
 		}
-		c := abkt.Cursor()
-		for k, v := c.Last(); k != nil; k, v = c.Prev() {
-			accountE := k[16:]
-			if bytes.Equal(accountE, []byte(id)) {
-				var payment Payment
-				err := json.Unmarshal(v, &payment)
-				if err != nil {
-					return err
-				}
-				pmts = append(pmts, &payment)
-				if len(pmts) == int(n) {
-					return nil
-				}
-			}
+		ibkt, err := fetchAccountPaymentBucket(tx, paymentArchiveBkt)
+		if err != nil {
+			return err
 		}
-		return nil
+		return forEachAccountPayment(abkt, ibkt, id, func(payment *Payment) bool {
+			pmts = append(pmts, payment)
+			return len(pmts) < int(n)
+		})
 	})
 	if err != nil {
 		return nil, err
@@ -350,28 +758,20 @@ func fetchPendingPaymentsForAccount(db *bolt.DB, id string, n uint) ([]*Payment,
 		return pmts, nil
 	}
 	err := db.View(func(tx *bolt.Tx) error {
-		abkt, err := fetchPaymentBucket(tx)
+		bkt, err := fetchPaymentBucket(tx)
 		if err != nil {
 			return err
 		}
-		c := abkt.Cursor()
-		for k, v := c.Last(); k != nil; k, v = c.Prev() {
-			accountE := k[16:]
-			if bytes.Equal(accountE, []byte(id)) {
-				var payment Payment
-				err := json.Unmarshal(v, &payment)
-				if err != nil {
-					return err
-				}
-				if payment.PaidOnHeight == 0 {
-					pmts = append(pmts, &payment)
-					if len(pmts) == int(n) {
-						return nil
-					}
-				}
-			}
+		ibkt, err := fetchAccountPaymentBucket(tx, paymentBkt)
+		if err != nil {
+			return err
 		}
-		return nil
+		return forEachAccountPayment(bkt, ibkt, id, func(payment *Payment) bool {
+			if payment.PaidOnHeight == 0 {
+				pmts = append(pmts, payment)
+			}
+			return len(pmts) < int(n)
+		})
 	})
 	if err != nil {
 		return nil, err
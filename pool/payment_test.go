@@ -5,6 +5,7 @@
 package pool
 
 import (
+	"math/big"
 	"testing"
 	"time"
 
@@ -31,7 +32,7 @@ func testGeneratePaymentDetails(t *testing.T, db *bolt.DB) {
 	bundles := make([]*PaymentBundle, 0)
 	bundles = append(bundles, bundleX)
 	bundles = append(bundles, bundleY)
-	details, totalAmt, err := generatePaymentDetails(db, poolFeeAddrs, bundles)
+	details, totalAmt, err := generatePaymentDetails(db, poolFeeAddrs, nil, bundles)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -68,7 +69,7 @@ func testGeneratePaymentDetails(t *testing.T, db *bolt.DB) {
 	bundles = append(bundles, bundleX)
 	bundles = append(bundles, bundleY)
 
-	details, totalAmt, err = generatePaymentDetails(db, poolFeeAddrs, bundles)
+	details, totalAmt, err = generatePaymentDetails(db, poolFeeAddrs, nil, bundles)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -99,6 +100,40 @@ func testGeneratePaymentDetails(t *testing.T, db *bolt.DB) {
 	}
 }
 
+func testChunkPaymentBundles(t *testing.T) {
+	amt, _ := dcrutil.NewAmount(1)
+	bundles := make([]*PaymentBundle, 0)
+	for idx := 0; idx < 5; idx++ {
+		bundles = append(bundles, makePaymentBundle(xID, 1, amt))
+	}
+
+	tests := []struct {
+		name       string
+		maxOutputs uint32
+		maxSize    uint32
+		expected   []int
+	}{
+		{"unbounded", 0, 0, []int{5}},
+		{"output bound", 2, 0, []int{2, 2, 1}},
+		{"size bound", 0, p2pkhOutputSize * 3, []int{3, 2}},
+		{"both bounds", 4, p2pkhOutputSize * 3, []int{3, 2}},
+		{"undersized bound", 0, p2pkhOutputSize - 1, []int{1, 1, 1, 1, 1}},
+	}
+	for _, test := range tests {
+		chunks := chunkPaymentBundles(bundles, test.maxOutputs, test.maxSize)
+		if len(chunks) != len(test.expected) {
+			t.Fatalf("[%s] expected %v chunks, got %v", test.name,
+				len(test.expected), len(chunks))
+		}
+		for idx, chunk := range chunks {
+			if len(chunk) != test.expected[idx] {
+				t.Fatalf("[%s] expected chunk %v to have %v bundles, got %v",
+					test.name, idx, test.expected[idx], len(chunk))
+			}
+		}
+	}
+}
+
 func testArchivedPaymentsFiltering(t *testing.T, db *bolt.DB) {
 	count := uint32(2)
 	amt, _ := dcrutil.NewAmount(5)
@@ -138,11 +173,29 @@ func testArchivedPaymentsFiltering(t *testing.T, db *bolt.DB) {
 			" (per filter criteria), got %v", expectedPmts, len(pmts))
 	}
 
+	// Ensure the totals paid to both accounts are tracked.
+	for _, id := range []string{xID, yID} {
+		total, err := fetchPaymentTotal(db, id)
+		if err != nil {
+			t.Fatalf("[fetchPaymentTotal] unexpected error: %v", err)
+		}
+		if total != amt*dcrutil.Amount(count) {
+			t.Fatalf("expected a payment total of %v for account %s, "+
+				"got %v", amt*dcrutil.Amount(count), id, total)
+		}
+	}
+
 	// Empty the payment archive bucket.
 	err = emptyBucket(db, paymentArchiveBkt)
 	if err != nil {
 		t.Fatalf("emptyBucket error: %v", err)
 	}
+
+	// Empty the payment total bucket.
+	err = emptyBucket(db, paymentTotalBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
 }
 
 func testAccountPayments(t *testing.T, db *bolt.DB) {
@@ -190,6 +243,17 @@ func testAccountPayments(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected archived payments to be %v, got %v", 2, paid)
 	}
 
+	// Ensure the pending balance of the account only includes unpaid
+	// payments.
+	balance, err := fetchPendingBalance(db, xID)
+	if err != nil {
+		t.Fatalf("[fetchPendingBalance] unexpected error: %v", err)
+	}
+	if balance != amt*dcrutil.Amount(count) {
+		t.Fatalf("expected a pending balance of %v, got %v",
+			amt*dcrutil.Amount(count), balance)
+	}
+
 	// Empty the payment bucket.
 	err = emptyBucket(db, paymentBkt)
 	if err != nil {
@@ -201,4 +265,98 @@ func testAccountPayments(t *testing.T, db *bolt.DB) {
 	if err != nil {
 		t.Fatalf("emptyBucket error: %v", err)
 	}
+
+	// Empty the payment total bucket.
+	err = emptyBucket(db, paymentTotalBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
+
+func testPaymentSources(t *testing.T, db *bolt.DB) {
+	amt, _ := dcrutil.NewAmount(5)
+	newPayment := func(account string, height uint32, blockHash string) *Payment {
+		pmt := NewPayment(account, amt, height, height)
+		pmt.BlockHash = blockHash
+		pmt.Percentage = big.NewRat(1, 2)
+		return pmt
+	}
+
+	// Archive payments of account X funded by two blocks in the same
+	// transaction, along with a payment of account Y funded by the first
+	// block in another transaction.
+	bx := newPaymentBundle(xID)
+	bx.Payments = append(bx.Payments, newPayment(xID, 10, "a"),
+		newPayment(xID, 11, "b"))
+	by := newPaymentBundle(yID)
+	by.Payments = append(by.Payments, newPayment(yID, 10, "a"))
+	bx.UpdateAsPaid(db, 20, "x")
+	by.UpdateAsPaid(db, 20, "y")
+	for _, bundle := range []*PaymentBundle{bx, by} {
+		for _, pmt := range bundle.Payments {
+			err := pmt.Create(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := bundle.ArchivePayments(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending := newPayment(xID, 12, "c")
+	err := pending.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure the sources of a payment are the archived payments of the
+	// account paid out by its transaction.
+	pmts, err := fetchPaymentSources(db, xID, "x")
+	if err != nil {
+		t.Fatalf("[fetchPaymentSources] unexpected error: %v", err)
+	}
+	if len(pmts) != 2 {
+		t.Fatalf("expected 2 payment sources, got %d", len(pmts))
+	}
+	for _, pmt := range pmts {
+		if pmt.Percentage == nil || pmt.Percentage.Cmp(big.NewRat(1, 2)) != 0 {
+			t.Fatalf("expected a share percentage of 1/2, got %v",
+				pmt.Percentage)
+		}
+		if (pmt.Height == 10 && pmt.BlockHash != "a") ||
+			(pmt.Height == 11 && pmt.BlockHash != "b") {
+			t.Fatalf("unexpected source block %s at height %d",
+				pmt.BlockHash, pmt.Height)
+		}
+	}
+	pmts, err = fetchPaymentSources(db, yID, "x")
+	if err != nil {
+		t.Fatalf("[fetchPaymentSources] unexpected error: %v", err)
+	}
+	if len(pmts) != 0 {
+		t.Fatalf("expected no payment sources for account Y, got %d",
+			len(pmts))
+	}
+
+	// Ensure the payments funded by a block include pending and archived
+	// payments of all accounts.
+	for height, expected := range map[uint32]int{10: 2, 11: 1, 12: 1, 13: 0} {
+		pmts, err := fetchBlockPayments(db, height)
+		if err != nil {
+			t.Fatalf("[fetchBlockPayments] unexpected error: %v", err)
+		}
+		if len(pmts) != expected {
+			t.Fatalf("expected %d payments funded by block #%d, got %d",
+				expected, height, len(pmts))
+		}
+	}
+
+	for _, bkt := range [][]byte{paymentBkt, paymentArchiveBkt,
+		paymentTotalBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
 }
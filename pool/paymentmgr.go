@@ -2,9 +2,11 @@ package pool
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"math/rand"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +18,16 @@ import (
 	txrules "github.com/Eacred/eacrwallet/wallet/txrules"
 )
 
+const (
+	// maxPaymentRetryBackoff is the maximum delay between payment dispatch
+	// retries.
+	maxPaymentRetryBackoff = time.Hour * 6
+
+	// shareWindowTTL is the period a computed share payout window is
+	// served from cache.
+	shareWindowTTL = time.Second * 15
+)
+
 type PaymentMgrConfig struct {
 	// DB represents the pool database.
 	DB *bolt.DB
@@ -35,11 +47,46 @@ type PaymentMgrConfig struct {
 	MinPayment dcrutil.Amount
 	// PoolFeeAddrs represents the pool fee addresses of the pool.
 	PoolFeeAddrs []dcrutil.Address
+	// DonationAddr represents the address account donations are paid to,
+	// donations are disabled if it is nil.
+	DonationAddr dcrutil.Address
 	// MaxTxFeeReserve represents the maximum value the tx free reserve can be.
 	MaxTxFeeReserve dcrutil.Amount
+	// MaxPaymentOutputs represents the maximum number of payout outputs
+	// allowed in a single payment transaction.
+	MaxPaymentOutputs uint32
+	// MaxPaymentTxSize represents the maximum estimated serialized size, in
+	// bytes, of the payout outputs of a single payment transaction.
+	MaxPaymentTxSize uint32
+	// MaxPaymentRetries represents the maximum number of times a failed
+	// payment dispatch is retried before it requires attention.
+	MaxPaymentRetries uint32
+	// PaymentRetryBackoff represents the delay before the first retry of a
+	// failed payment dispatch. The delay doubles with every failed retry.
+	PaymentRetryBackoff time.Duration
 	// PublishTransaction generates a transaction from the provided payouts
 	// and publishes it.
 	PublishTransaction func(map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error)
+	// NotifyPaymentSent publishes a payment sent event for the provided
+	// transaction id, total amount paid and recipient count, nil if events
+	// are not published.
+	NotifyPaymentSent func(string, dcrutil.Amount, uint32)
+	// FetchSpendableBalance fetches the spendable balance of the wallet
+	// payments are dispatched from. The balance preflight is skipped if it
+	// is nil.
+	FetchSpendableBalance func() (dcrutil.Amount, error)
+	// BalanceRetryInterval represents the delay before the wallet balance
+	// of a deferred payment cycle is checked again.
+	BalanceRetryInterval time.Duration
+	// NotifyPaymentsDeferred publishes a payments deferred event for the
+	// provided deferral.
+	NotifyPaymentsDeferred func(*PaymentDeferral)
+	// DryRun indicates payment cycles are planned and recorded without
+	// being dispatched, payment state is left untouched.
+	DryRun bool
+	// NotifyPaymentPlanned publishes a payment planned event for the
+	// provided payment plan.
+	NotifyPaymentPlanned func(*PaymentPlan)
 }
 
 // PaymentMgr handles generating shares and paying out dividends to
@@ -50,10 +97,149 @@ type PaymentMgr struct {
 	lastPaymentCreatedOn uint64 // update atomically.
 
 	cfg             *PaymentMgrConfig
+	cfgMtx          sync.RWMutex
 	txFeeReserve    dcrutil.Amount
 	txFeeReserveMtx sync.RWMutex
 	paymentReqs     map[string]struct{}
 	paymentReqsMtx  sync.RWMutex
+	dispatchFail    *DispatchFailure
+	dispatchFailMtx sync.RWMutex
+	deferral        *PaymentDeferral
+	deferralMtx     sync.RWMutex
+	shareWindow     *ShareWindow
+	shareWindowMtx  sync.Mutex
+	status          statusRecorder
+
+	// cycles tracks the payment cycles being processed, new cycles are
+	// not started once the payment manager is stopping.
+	cycles      sync.WaitGroup
+	stopping    bool
+	stoppingMtx sync.RWMutex
+}
+
+// config returns the current configuration of the payment manager, the
+// returned configuration must not be modified.
+func (pm *PaymentMgr) config() *PaymentMgrConfig {
+	pm.cfgMtx.RLock()
+	defer pm.cfgMtx.RUnlock()
+	return pm.cfg
+}
+
+// ApplyConfig applies the fee and payment parameters of the provided
+// configuration to the payment manager at runtime. Other fields of the
+// provided configuration are ignored. Payments already generated are not
+// affected, the updated parameters apply from the next payment cycle.
+func (pm *PaymentMgr) ApplyConfig(pCfg *PaymentMgrConfig) {
+	pm.cfgMtx.Lock()
+	cfg := *pm.cfg
+	cfg.PoolFee = pCfg.PoolFee
+	cfg.LastNPeriod = pCfg.LastNPeriod
+	cfg.MinPayment = pCfg.MinPayment
+	cfg.MaxTxFeeReserve = pCfg.MaxTxFeeReserve
+	cfg.MaxPaymentOutputs = pCfg.MaxPaymentOutputs
+	cfg.MaxPaymentTxSize = pCfg.MaxPaymentTxSize
+	cfg.MaxPaymentRetries = pCfg.MaxPaymentRetries
+	cfg.PaymentRetryBackoff = pCfg.PaymentRetryBackoff
+	cfg.BalanceRetryInterval = pCfg.BalanceRetryInterval
+	cfg.DryRun = pCfg.DryRun
+	pm.cfg = &cfg
+	pm.cfgMtx.Unlock()
+
+	// Discard the cached share window, it may span a superseded PPLNS
+	// period.
+	pm.discardShareWindow()
+}
+
+// discardShareWindow discards the cached share window, the next share
+// window fetched is computed afresh.
+func (pm *PaymentMgr) discardShareWindow() {
+	pm.shareWindowMtx.Lock()
+	pm.shareWindow = nil
+	pm.shareWindowMtx.Unlock()
+}
+
+// DispatchFailure represents a failed payment dispatch awaiting a retry.
+type DispatchFailure struct {
+	Height            uint32 `json:"height"`
+	Attempts          uint32 `json:"attempts"`
+	Error             string `json:"error"`
+	LastAttempt       int64  `json:"lastattempt"`
+	NextAttempt       int64  `json:"nextattempt"`
+	RequiresAttention bool   `json:"requiresattention"`
+}
+
+// PaymentDeferral represents a payment cycle deferred because the wallet's
+// spendable balance does not cover the eligible payments and their
+// estimated transaction fees.
+type PaymentDeferral struct {
+	Height    uint32         `json:"height"`
+	Required  dcrutil.Amount `json:"required"`
+	Spendable dcrutil.Amount `json:"spendable"`
+	Since     int64          `json:"since"`
+	NextCheck int64          `json:"nextcheck"`
+}
+
+// paymentCycle represents a payment cycle whose payments are being
+// dispatched, or awaiting the retry of a failed dispatch.
+type paymentCycle struct {
+	Height uint32 `json:"height"`
+	// Accounts represents the accounts with payments in the cycle, nil
+	// until the eligible payments of the cycle are determined.
+	Accounts []string `json:"accounts,omitempty"`
+}
+
+// includes returns if the payment cycle may include payments of the
+// provided account.
+func (cycle *paymentCycle) includes(account string) bool {
+	if cycle.Accounts == nil {
+		return true
+	}
+	for _, acc := range cycle.Accounts {
+		if acc == account {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchPaymentCycle returns the payment cycle in flight, nil if there is
+// none.
+func fetchPaymentCycle(tx *bolt.Tx) (*paymentCycle, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	v := pbkt.Get(paymentCycleK)
+	if v == nil {
+		return nil, nil
+	}
+	var cycle paymentCycle
+	err := json.Unmarshal(v, &cycle)
+	if err != nil {
+		return nil, err
+	}
+	return &cycle, nil
+}
+
+// persistPaymentCycle saves the provided payment cycle as the payment cycle
+// in flight, a nil cycle clears it.
+func persistPaymentCycle(db *bolt.DB, cycle *paymentCycle) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		pbkt := tx.Bucket(poolBkt)
+		if pbkt == nil {
+			desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+			return MakeError(ErrBucketNotFound, desc, nil)
+		}
+		if cycle == nil {
+			return pbkt.Delete(paymentCycleK)
+		}
+		cycleBytes, err := json.Marshal(cycle)
+		if err != nil {
+			return err
+		}
+		return pbkt.Put(paymentCycleK, cycleBytes)
+	})
 }
 
 // NewPaymentMgr creates a new payment manager.
@@ -64,7 +250,7 @@ func NewPaymentMgr(pCfg *PaymentMgrConfig) (*PaymentMgr, error) {
 		paymentReqs:  make(map[string]struct{}),
 	}
 	rand.Seed(time.Now().UnixNano())
-	err := pm.cfg.DB.Update(func(tx *bolt.Tx) error {
+	err := updateIfWritable(pm.config().DB, func(tx *bolt.Tx) error {
 		err := pm.loadLastPaymentHeight(tx)
 		if err != nil {
 			return err
@@ -77,7 +263,11 @@ func NewPaymentMgr(pCfg *PaymentMgrConfig) (*PaymentMgr, error) {
 		if err != nil {
 			return err
 		}
-		return pm.loadTxFeeReserve(tx)
+		err = pm.loadTxFeeReserve(tx)
+		if err != nil {
+			return err
+		}
+		return pm.loadDispatchFailure(tx)
 	})
 	if err != nil {
 		return nil, err
@@ -119,6 +309,9 @@ func (pm *PaymentMgr) loadLastPaymentHeight(tx *bolt.Tx) error {
 	lastPaymentHeightB := pbkt.Get(lastPaymentHeight)
 	if lastPaymentHeightB == nil {
 		pm.setLastPaymentHeight(0)
+		if !tx.Writable() {
+			return nil
+		}
 		b := make([]byte, 4)
 		binary.LittleEndian.PutUint32(b, 0)
 		return pbkt.Put(lastPaymentHeight, b)
@@ -164,6 +357,9 @@ func (pm *PaymentMgr) loadLastPaymentPaidOn(tx *bolt.Tx) error {
 	lastPaymentPaidOnB := pbkt.Get(lastPaymentPaidOn)
 	if lastPaymentPaidOnB == nil {
 		pm.setLastPaymentPaidOn(0)
+		if !tx.Writable() {
+			return nil
+		}
 		b := make([]byte, 8)
 		binary.LittleEndian.PutUint64(b, 0)
 		return pbkt.Put(lastPaymentPaidOn, b)
@@ -203,6 +399,9 @@ func (pm *PaymentMgr) loadLastPaymentCreatedOn(tx *bolt.Tx) error {
 	lastPaymentCreatedOnB := pbkt.Get(lastPaymentCreatedOn)
 	if lastPaymentCreatedOnB == nil {
 		pm.setLastPaymentCreatedOn(0)
+		if !tx.Writable() {
+			return nil
+		}
 		b := make([]byte, 8)
 		binary.LittleEndian.PutUint64(b, 0)
 		return pbkt.Put(lastPaymentCreatedOn, b)
@@ -247,6 +446,9 @@ func (pm *PaymentMgr) loadTxFeeReserve(tx *bolt.Tx) error {
 	txFeeReserveB := pbkt.Get(txFeeReserve)
 	if txFeeReserveB == nil {
 		pm.setTxFeeReserve(dcrutil.Amount(0))
+		if !tx.Writable() {
+			return nil
+		}
 		b := make([]byte, 4)
 		binary.LittleEndian.PutUint32(b, 0)
 		return pbkt.Put(txFeeReserve, b)
@@ -260,17 +462,23 @@ func (pm *PaymentMgr) loadTxFeeReserve(tx *bolt.Tx) error {
 // pool's tx fee reserve. The remaining pool fee amount after replenishing
 // the fee reserve is returned.
 func (pm *PaymentMgr) replenishTxFeeReserve(poolFee dcrutil.Amount) dcrutil.Amount {
-	txFeeReserve := pm.fetchTxFeeReserve()
-	if txFeeReserve < pm.cfg.MaxTxFeeReserve {
-		diff := pm.cfg.MaxTxFeeReserve - txFeeReserve
+	txFeeReserve, remaining := pm.replenishedTxFeeReserve(pm.fetchTxFeeReserve(),
+		poolFee)
+	pm.setTxFeeReserve(txFeeReserve)
+	return remaining
+}
+
+// replenishedTxFeeReserve returns the provided tx fee reserve replenished
+// from the provided pool fee, along with the remaining pool fee amount.
+func (pm *PaymentMgr) replenishedTxFeeReserve(txFeeReserve dcrutil.Amount, poolFee dcrutil.Amount) (dcrutil.Amount, dcrutil.Amount) {
+	if txFeeReserve < pm.config().MaxTxFeeReserve {
+		diff := pm.config().MaxTxFeeReserve - txFeeReserve
 		if poolFee > diff {
-			pm.setTxFeeReserve(txFeeReserve + diff)
-			return poolFee - diff
+			return txFeeReserve + diff, poolFee - diff
 		}
-		pm.setTxFeeReserve(txFeeReserve + poolFee)
-		return dcrutil.Amount(0)
+		return txFeeReserve + poolFee, dcrutil.Amount(0)
 	}
-	return poolFee
+	return txFeeReserve, poolFee
 }
 
 // PPLNSSharePercentages calculates the current mining reward percentages
@@ -278,8 +486,11 @@ func (pm *PaymentMgr) replenishTxFeeReserve(poolFee dcrutil.Amount) dcrutil.Amou
 // the PPS payment scheme.
 func (pm *PaymentMgr) PPSSharePercentages() (map[string]*big.Rat, error) {
 	now := nanoToBigEndianBytes(time.Now().UnixNano())
-	lastPaymentCreatedOn := pm.fetchLastPaymentCreatedOn()
-	shares, err := PPSEligibleShares(pm.cfg.DB, nanoToBigEndianBytes(int64(lastPaymentCreatedOn)), now)
+	start, err := pm.ppsWindowStart()
+	if err != nil {
+		return nil, err
+	}
+	shares, err := PPSEligibleShares(pm.config().DB, nanoToBigEndianBytes(start), now)
 	if err != nil {
 		return nil, err
 	}
@@ -297,9 +508,9 @@ func (pm *PaymentMgr) PPSSharePercentages() (map[string]*big.Rat, error) {
 // accounts based on work performed measured by the PPLNS payment scheme.
 func (pm *PaymentMgr) PPLNSSharePercentages() (map[string]*big.Rat, error) {
 	now := time.Now()
-	min := now.Add(-(time.Second * time.Duration(pm.cfg.LastNPeriod)))
+	min := now.Add(-(time.Second * time.Duration(pm.config().LastNPeriod)))
 	minNano := nanoToBigEndianBytes(min.UnixNano())
-	shares, err := PPLNSEligibleShares(pm.cfg.DB, minNano)
+	shares, err := PPLNSEligibleShares(pm.config().DB, minNano)
 	if err != nil {
 		return nil, err
 	}
@@ -316,48 +527,390 @@ func (pm *PaymentMgr) PPLNSSharePercentages() (map[string]*big.Rat, error) {
 	return percentages, nil
 }
 
-// PayPerShare generates a payment bundle comprised of payments to all
-// participating accounts. Payments are calculated based on work contributed
-// to the pool since the last payment batch.
-func (pm *PaymentMgr) payPerShare(coinbase dcrutil.Amount, height uint32) error {
+// ShareWindowAccount represents the shares of an account within the share
+// payout window and its projected percentage of the next payout.
+type ShareWindowAccount struct {
+	AccountID  string
+	Address    string
+	Count      uint32
+	Weight     *big.Rat
+	Percentage *big.Rat
+}
+
+// ShareWindow represents the unpaid shares the next payout is calculated
+// from, grouped by account. Timestamps are in nanoseconds. With the PPS
+// payment scheme the window spans the shares created since the last share
+// boundary, with PPLNS it spans the last N period.
+type ShareWindow struct {
+	PaymentMethod        string
+	Start                int64
+	End                  int64
+	LastNPeriod          uint32
+	LastPaymentHeight    uint32
+	LastPaymentCreatedOn int64
+	Count                uint32
+	Weight               *big.Rat
+	Accounts             []*ShareWindowAccount
+	GeneratedOn          int64
+}
+
+// fetchAccountAddresses fetches the addresses of the provided account ids
+// in a single read transaction. Unknown accounts are omitted.
+func fetchAccountAddresses(db *bolt.DB, ids []string) (map[string]string, error) {
+	addrs := make(map[string]string, len(ids))
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchAccountBucket(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			v := bkt.Get([]byte(id))
+			if v == nil {
+				continue
+			}
+			var account Account
+			err := json.Unmarshal(v, &account)
+			if err != nil {
+				return err
+			}
+			addrs[id] = account.Address
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// fetchShareWindow returns the current share payout window. The window is
+// computed from read transactions and cached for a short period, the
+// returned window must not be modified.
+func (pm *PaymentMgr) fetchShareWindow() (*ShareWindow, error) {
+	pm.shareWindowMtx.Lock()
+	defer pm.shareWindowMtx.Unlock()
 	now := time.Now()
-	percentages, err := pm.PPSSharePercentages()
+	if pm.shareWindow != nil &&
+		now.Sub(time.Unix(0, pm.shareWindow.GeneratedOn)) < shareWindowTTL {
+		return pm.shareWindow, nil
+	}
+
+	window := &ShareWindow{
+		PaymentMethod:        pm.config().PaymentMethod,
+		End:                  now.UnixNano(),
+		LastPaymentHeight:    pm.fetchLastPaymentHeight(),
+		LastPaymentCreatedOn: int64(pm.fetchLastPaymentCreatedOn()),
+		Weight:               new(big.Rat),
+		GeneratedOn:          now.UnixNano(),
+	}
+	var shares []*Share
+	var err error
+	switch pm.config().PaymentMethod {
+	case PPS:
+		window.Start, err = pm.ppsWindowStart()
+		if err != nil {
+			return nil, err
+		}
+		shares, err = PPSEligibleShares(pm.config().DB,
+			nanoToBigEndianBytes(window.Start),
+			nanoToBigEndianBytes(window.End))
+	default:
+		window.LastNPeriod = pm.config().LastNPeriod
+		window.Start = now.Add(-(time.Second *
+			time.Duration(pm.config().LastNPeriod))).UnixNano()
+		shares, err = PPLNSEligibleShares(pm.config().DB,
+			nanoToBigEndianBytes(window.Start))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make(map[string]*ShareWindowAccount)
+	ids := make([]string, 0)
+	for _, share := range shares {
+		account, ok := accounts[share.Account]
+		if !ok {
+			account = &ShareWindowAccount{
+				AccountID: share.Account,
+				Weight:    new(big.Rat),
+			}
+			accounts[share.Account] = account
+			ids = append(ids, share.Account)
+		}
+		account.Count++
+		account.Weight.Add(account.Weight, share.Weight)
+		window.Count++
+		window.Weight.Add(window.Weight, share.Weight)
+	}
+	if len(shares) > 0 {
+		percentages, err := sharePercentages(shares)
+		if err != nil {
+			return nil, err
+		}
+		for id, percentage := range percentages {
+			accounts[id].Percentage = percentage
+		}
+	}
+	addrs, err := fetchAccountAddresses(pm.config().DB, ids)
+	if err != nil {
+		return nil, err
+	}
+	window.Accounts = make([]*ShareWindowAccount, 0, len(accounts))
+	for _, id := range ids {
+		account := accounts[id]
+		account.Address = addrs[id]
+		window.Accounts = append(window.Accounts, account)
+	}
+	sort.Slice(window.Accounts, func(i, j int) bool {
+		cmp := window.Accounts[i].Weight.Cmp(window.Accounts[j].Weight)
+		if cmp != 0 {
+			return cmp > 0
+		}
+		return window.Accounts[i].AccountID < window.Accounts[j].AccountID
+	})
+	pm.shareWindow = window
+	return window, nil
+}
+
+// fetchDonations returns the donation fractions of all donating accounts,
+// no donations are returned if donations are disabled.
+func (pm *PaymentMgr) fetchDonations() (map[string]float64, error) {
+	if pm.config().DonationAddr == nil {
+		return nil, nil
+	}
+	return fetchDonations(pm.config().DB)
+}
+
+// currentSharePercentages calculates the current mining reward percentages
+// due participating pool accounts per the payment scheme of the pool.
+func (pm *PaymentMgr) currentSharePercentages() (map[string]*big.Rat, error) {
+	switch pm.config().PaymentMethod {
+	case PPS:
+		return pm.PPSSharePercentages()
+	case PPLNS:
+		return pm.PPLNSSharePercentages()
+	default:
+		desc := fmt.Sprintf("unknown payment method provided %v",
+			pm.config().PaymentMethod)
+		return nil, MakeError(ErrOther, desc, nil)
+	}
+}
+
+// AccountBalance represents the unpaid earnings of an account.
+type AccountBalance struct {
+	// Pending represents mature dividends awaiting dispatch.
+	Pending dcrutil.Amount
+	// Immature represents dividends of mined blocks yet to mature,
+	// including the estimated portion of accepted work awaiting
+	// confirmation.
+	Immature dcrutil.Amount
+	// CarriedOver represents mature dividends below the minimum payment,
+	// carried over until the account's balance exceeds it.
+	CarriedOver dcrutil.Amount
+	// Held represents mature dividends withheld while the account's
+	// payments are held.
+	Held dcrutil.Amount
+}
+
+// fetchAccountBalance calculates the unpaid earnings of the provided account
+// at the provided height. The account's portion of the provided unconfirmed
+// accepted work is estimated from the current share percentages the same
+// way dividends are generated once the work is confirmed.
+func (pm *PaymentMgr) fetchAccountBalance(accountID string, height uint32, unconfirmed []*AcceptedWork) (*AccountBalance, error) {
+	filter := func(payment *Payment) bool {
+		return payment.PaidOnHeight == 0 && !payment.Donation
+	}
+	payments, err := filterAccountPayments(pm.config().DB, accountID, filter)
+	if err != nil {
+		return nil, err
+	}
+	balance := new(AccountBalance)
+	var mature dcrutil.Amount
+	for _, payment := range payments {
+		if payment.EstimatedMaturity <= height {
+			mature += payment.Amount
+			continue
+		}
+		balance.Immature += payment.Amount
+	}
+
+	settings, err := fetchAccountSettings(pm.config().DB, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mature dividends below the minimum payment are only dispatched if
+	// requested and not dust, see fetchEligiblePaymentBundles.
+	minPayment := pm.config().MinPayment
+	if settings.MinPayout > 0 {
+		minPayment = settings.MinPayout
+	}
+	switch {
+	case settings.PaymentsHeld:
+		balance.Held = mature
+	case mature >= minPayment:
+		balance.Pending = mature
+	case pm.isPaymentRequested(accountID) && !txrules.IsDustAmount(mature,
+		25, // P2PKHScriptSize
+		mempool.DefaultMinRelayTxFee):
+		balance.Pending = mature
+	default:
+		balance.CarriedOver = mature
+	}
+
+	if len(unconfirmed) == 0 {
+		return balance, nil
+	}
+	percentages, err := pm.currentSharePercentages()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := percentages[accountID]; !ok {
+		return balance, nil
+	}
+	feeOverrides, err := fetchFeeOverrides(pm.config().DB)
+	if err != nil {
+		return nil, err
+	}
+	donations, err := pm.fetchDonations()
+	if err != nil {
+		return nil, err
+	}
+	for _, work := range unconfirmed {
+		estimates, err := CalculatePayments(percentages, work.Reward,
+			pm.config().PoolFee, feeOverrides, donations, work.Height, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, estimate := range estimates {
+			if estimate.Account == accountID && !estimate.Donation {
+				balance.Immature += estimate.Amount
+			}
+		}
+	}
+	return balance, nil
+}
+
+// createPaymentBatch creates the payments of the mined block with the
+// provided height and hash from the shares within the provided window.
+// Marking the share boundary, calculating and persisting the payments and
+// pruning shares older than the provided minimum happen in a single
+// transaction, shares persisted concurrently either precede the boundary
+// or belong to the next window.
+func (pm *PaymentMgr) createPaymentBatch(coinbase dcrutil.Amount, height uint32, blockHash string, estMaturity uint32, boundary *ShareBoundary, pruneMin int64) error {
+	feeOverrides, err := fetchFeeOverrides(pm.config().DB)
 	if err != nil {
 		return err
 	}
-	estMaturity := height + uint32(pm.cfg.ActiveNet.CoinbaseMaturity)
-	payments, err := CalculatePayments(percentages, coinbase, pm.cfg.PoolFee, height, estMaturity)
+	donations, err := pm.fetchDonations()
 	if err != nil {
 		return err
 	}
-	for _, payment := range payments {
-		err := payment.Create(pm.cfg.DB)
+	var lastPaymentCreatedOnNano int64
+	err = pm.config().DB.Update(func(tx *bolt.Tx) error {
+		shares, err := markShareBoundary(tx, boundary)
 		if err != nil {
 			return err
 		}
-	}
-	lastPaymentCreatedOn := uint64(payments[len(payments)-1].CreatedOn)
-	pm.setLastPaymentCreatedOn(lastPaymentCreatedOn)
-	err = pm.cfg.DB.Update(func(tx *bolt.Tx) error {
+		percentages := make(map[string]*big.Rat)
+		if len(shares) > 0 {
+			percentages, err = sharePercentages(shares)
+			if err != nil {
+				return err
+			}
+		}
+		payments, err := CalculatePayments(percentages, coinbase,
+			pm.config().PoolFee, feeOverrides, donations, height, estMaturity)
+		if err != nil {
+			return err
+		}
+		bkt, err := fetchPaymentBucket(tx)
+		if err != nil {
+			return err
+		}
+		ibkt, err := fetchAccountPaymentBucket(tx, paymentBkt)
+		if err != nil {
+			return err
+		}
+		for _, payment := range payments {
+			payment.BlockHash = blockHash
+			payment.ShareBoundary = boundary
+			err := putPayment(bkt, ibkt, payment)
+			if err != nil {
+				return err
+			}
+		}
+		err = accrueDigestPayments(tx, payments, false)
+		if err != nil {
+			return err
+		}
+
 		// Update the last payment created on time and prune invalidated shares.
-		err := pm.persistLastPaymentCreatedOn(tx)
+		lastPaymentCreatedOnNano = payments[len(payments)-1].CreatedOn
+		err = tx.Bucket(poolBkt).Put(lastPaymentCreatedOn,
+			nanoToBigEndianBytes(lastPaymentCreatedOnNano))
 		if err != nil {
 			return err
 		}
-		return pruneShares(tx, now.UnixNano())
+		return pruneShares(tx, pruneMin)
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	pm.setLastPaymentCreatedOn(uint64(lastPaymentCreatedOnNano))
+	return nil
 }
 
-// payPerLastNShares generates a payment bundle comprised of payments to all
-// participating accounts within the lastNPeriod of the pool.
-func (pm *PaymentMgr) payPerLastNShares(coinbase dcrutil.Amount, height uint32) error {
-	percentages, err := pm.PPLNSSharePercentages()
+// ppsWindowStart returns the start of the current PPS share window, the
+// share key following the last share boundary marked. It is the last
+// payment created on time if no boundary has been marked.
+func (pm *PaymentMgr) ppsWindowStart() (int64, error) {
+	var boundary int64
+	err := pm.config().DB.View(func(tx *bolt.Tx) error {
+		var err error
+		boundary, err = fetchShareBoundary(tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if boundary == 0 {
+		return int64(pm.fetchLastPaymentCreatedOn()), nil
+	}
+	return boundary + 1, nil
+}
+
+// PayPerShare generates a payment bundle comprised of payments to all
+// participating accounts. Payments are calculated based on work contributed
+// to the pool since the last payment batch.
+func (pm *PaymentMgr) payPerShare(coinbase dcrutil.Amount, height uint32, blockHash string) error {
+	start, err := pm.ppsWindowStart()
 	if err != nil {
 		return err
 	}
+	boundary := &ShareBoundary{
+		Start: start,
+		End:   time.Now().UnixNano(),
+	}
+	estMaturity := height + uint32(pm.config().ActiveNet.CoinbaseMaturity)
+
+	// Shares within the window are invalidated once paid.
+	return pm.createPaymentBatch(coinbase, height, blockHash, estMaturity,
+		boundary, boundary.End+1)
+}
+
+// payPerLastNShares generates a payment bundle comprised of payments to all
+// participating accounts within the lastNPeriod of the pool.
+func (pm *PaymentMgr) payPerLastNShares(coinbase dcrutil.Amount, height uint32, blockHash string) error {
+	now := time.Now()
+	minNano := now.Add(-(time.Second *
+		time.Duration(pm.config().LastNPeriod))).UnixNano()
+	boundary := &ShareBoundary{
+		Start: minNano + 1,
+		End:   now.UnixNano(),
+	}
 	var estMaturity uint32
-	coinbaseMaturity := pm.cfg.ActiveNet.CoinbaseMaturity
+	coinbaseMaturity := pm.config().ActiveNet.CoinbaseMaturity
 	if coinbaseMaturity == 0 {
 		// Allow immediately mature payments for testing purposes.
 		estMaturity = height
@@ -365,41 +918,21 @@ func (pm *PaymentMgr) payPerLastNShares(coinbase dcrutil.Amount, height uint32)
 	if coinbaseMaturity > 0 {
 		estMaturity = height + uint32(coinbaseMaturity)
 	}
-	payments, err := CalculatePayments(percentages, coinbase, pm.cfg.PoolFee,
-		height, estMaturity)
-	if err != nil {
-		return err
-	}
-	for _, payment := range payments {
-		err := payment.Create(pm.cfg.DB)
-		if err != nil {
-			return err
-		}
-	}
-	lastPaymentCreatedOn := uint64(payments[len(payments)-1].CreatedOn)
-	pm.setLastPaymentCreatedOn(lastPaymentCreatedOn)
-	err = pm.cfg.DB.Update(func(tx *bolt.Tx) error {
-		// Update the last payment created on time and prune invalidated shares.
-		err := pm.persistLastPaymentCreatedOn(tx)
-		if err != nil {
-			return err
-		}
-		minNano := time.Now().Add(-(time.Second * time.Duration(pm.cfg.LastNPeriod))).UnixNano()
-		return pruneShares(tx, minNano)
-	})
-	return err
+	return pm.createPaymentBatch(coinbase, height, blockHash, estMaturity,
+		boundary, minNano)
 }
 
-// generatePayments creates payments for participating accounts. This should
-// only be called when a block is confirmed mined, in pool mining mode.
-func (pm *PaymentMgr) generatePayments(height uint32, coinbase dcrutil.Amount) error {
+// generatePayments creates payments for participating accounts funded by
+// the mined block with the provided height and hash. This should only be
+// called when a block is confirmed mined, in pool mining mode.
+func (pm *PaymentMgr) generatePayments(height uint32, blockHash string, coinbase dcrutil.Amount) error {
 	cfg := pm.cfg
 	switch cfg.PaymentMethod {
 	case PPS:
-		return pm.payPerShare(coinbase, height)
+		return pm.payPerShare(coinbase, height, blockHash)
 
 	case PPLNS:
-		return pm.payPerLastNShares(coinbase, height)
+		return pm.payPerLastNShares(coinbase, height, blockHash)
 
 	default:
 		return fmt.Errorf("unknown payment method provided %v", cfg.PaymentMethod)
@@ -418,7 +951,7 @@ func (pm *PaymentMgr) isPaymentRequested(accountID string) bool {
 // addPaymentRequest creates a payment request from the provided account
 // if not already requested.
 func (pm *PaymentMgr) addPaymentRequest(addr string) error {
-	id, err := AccountID(addr, pm.cfg.ActiveNet)
+	id, err := AccountID(addr, pm.config().ActiveNet)
 	if err != nil {
 		return err
 	}
@@ -426,6 +959,13 @@ func (pm *PaymentMgr) addPaymentRequest(addr string) error {
 		return fmt.Errorf("payment already requested for account"+
 			" with id %s", id)
 	}
+	settings, err := fetchAccountSettings(pm.config().DB, id)
+	if err != nil {
+		return err
+	}
+	if settings.PaymentsHeld {
+		return fmt.Errorf("payments of account with id %s are held", id)
+	}
 	pm.paymentReqsMtx.Lock()
 	pm.paymentReqs[id] = struct{}{}
 	pm.paymentReqsMtx.Unlock()
@@ -433,18 +973,46 @@ func (pm *PaymentMgr) addPaymentRequest(addr string) error {
 }
 
 // fetchEligiblePaymentBundles fetches payment bundles greater than the
-// configured minimum payment.
+// configured minimum payment, or the minimum payout of their account if
+// set. Payments of accounts with held payments,
+// including their donations, remain pending until the hold is released.
+// Quarantined payments remain pending until they are requeued.
 func (pm *PaymentMgr) fetchEligiblePaymentBundles(height uint32) ([]*PaymentBundle, error) {
-	maturePayments, err := fetchMaturePendingPayments(pm.cfg.DB, height)
+	maturePayments, err := fetchMaturePendingPayments(pm.config().DB, height)
 	if err != nil {
 		return nil, err
 	}
+	held, err := fetchHeldAccounts(pm.config().DB)
+	if err != nil {
+		return nil, err
+	}
+	minPayouts, err := fetchMinPayouts(pm.config().DB)
+	if err != nil {
+		return nil, err
+	}
+	eligible := maturePayments[:0]
+	for _, payment := range maturePayments {
+		if payment.Quarantine != "" {
+			continue
+		}
+		if _, ok := held[payment.Account]; ok {
+			log.Tracef("Holding payment of %v to account %s",
+				payment.Amount, payment.Account)
+			continue
+		}
+		eligible = append(eligible, payment)
+	}
+	maturePayments = eligible
 	bundles := generatePaymentBundles(maturePayments)
 
 	// Iterating the bundles backwards implicitly handles decrementing the
 	// slice index when a bundle entry in the slice is removed.
 	for idx := len(bundles) - 1; idx >= 0; idx-- {
-		if bundles[idx].Total() < pm.cfg.MinPayment {
+		minPayment := pm.config().MinPayment
+		if minPayout, ok := minPayouts[bundles[idx].Account]; ok {
+			minPayment = minPayout
+		}
+		if bundles[idx].Total() < minPayment {
 			// Remove payments below the minimum payment if they have not been
 			// requested for by the user.
 			if !pm.isPaymentRequested(bundles[idx].Account) {
@@ -462,8 +1030,130 @@ func (pm *PaymentMgr) fetchEligiblePaymentBundles(height uint32) ([]*PaymentBund
 	return bundles, nil
 }
 
-// PayDividends pays mature mining rewards to participating accounts.
+// quarantineInvalidPayouts validates the payout address of every account
+// bundle, the payments of bundles with an invalid payout address are
+// quarantined and removed from the returned bundles.
+func (pm *PaymentMgr) quarantineInvalidPayouts(bundles []*PaymentBundle) ([]*PaymentBundle, error) {
+	valid := bundles[:0]
+	for _, bundle := range bundles {
+		reason, err := pm.invalidPayoutReason(bundle)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			valid = append(valid, bundle)
+			continue
+		}
+		err = quarantinePayments(pm.config().DB, bundle.Payments, reason)
+		if err != nil {
+			return nil, err
+		}
+		log.Errorf("Quarantined %d payment(s) of %v to account %s, they "+
+			"require attention: %s", len(bundle.Payments), bundle.Total(),
+			bundle.Account, reason)
+	}
+	return valid, nil
+}
+
+// invalidPayoutReason returns the reason the payout address of the provided
+// bundle is invalid, an empty reason if it is valid. Pool fee and donation
+// bundles are always valid.
+func (pm *PaymentMgr) invalidPayoutReason(bundle *PaymentBundle) (string, error) {
+	if bundle.Account == poolFeesK || bundle.Account == donationsK {
+		return "", nil
+	}
+	account, err := FetchAccount(pm.config().DB, []byte(bundle.Account))
+	switch {
+	case IsError(err, ErrValueNotFound):
+		return "no account record found", nil
+	case err != nil:
+		return "", err
+	}
+	err = validatePayoutAddress(account.Address, pm.config().ActiveNet)
+	if err != nil {
+		return fmt.Sprintf("invalid payout address %q: %v", account.Address,
+			err), nil
+	}
+	return "", nil
+}
+
+// requeueQuarantinedPayments clears the quarantine of the pending payments
+// of the provided account id, they are paid out on the next payment
+// attempt. The number of requeued payments is returned.
+func (pm *PaymentMgr) requeueQuarantinedPayments(accountID string) (int, error) {
+	payments, err := fetchQuarantinedPayments(pm.config().DB, accountID)
+	if err != nil {
+		return 0, err
+	}
+	err = quarantinePayments(pm.config().DB, payments, "")
+	if err != nil {
+		return 0, err
+	}
+	return len(payments), nil
+}
+
+// beginCycle marks a payment cycle as being processed, it returns false
+// without marking it if the payment manager is stopping.
+func (pm *PaymentMgr) beginCycle() bool {
+	pm.stoppingMtx.Lock()
+	defer pm.stoppingMtx.Unlock()
+	if pm.stopping {
+		return false
+	}
+	pm.cycles.Add(1)
+	return true
+}
+
+// isStopping returns if the payment manager is stopping.
+func (pm *PaymentMgr) isStopping() bool {
+	pm.stoppingMtx.RLock()
+	defer pm.stoppingMtx.RUnlock()
+	return pm.stopping
+}
+
+// stop prevents new payment cycles from starting and waits for the payment
+// cycle being processed, if any, for at most the provided timeout. A cycle
+// with payment chunks left to dispatch is checkpointed before its next
+// chunk, the remaining chunks are dispatched by the next payment cycle
+// after a restart. It returns false if the cycle did not finish in time.
+func (pm *PaymentMgr) stop(timeout time.Duration) bool {
+	pm.stoppingMtx.Lock()
+	pm.stopping = true
+	pm.stoppingMtx.Unlock()
+	done := make(chan struct{})
+	go func() {
+		pm.cycles.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// payDividends pays mature mining rewards to participating accounts and
+// records the outcome for health reporting. Payments are not processed
+// once the payment manager is stopping.
 func (pm *PaymentMgr) payDividends(height uint32) error {
+	if !pm.beginCycle() {
+		log.Debugf("Skipping payments at height #%d, the payment manager "+
+			"is stopping", height)
+		return nil
+	}
+	defer pm.cycles.Done()
+	err := pm.processDividends(height)
+	if err != nil {
+		pm.status.recordError(err)
+		return err
+	}
+	pm.status.recordSuccess()
+	return nil
+}
+
+// processDividends pays mature mining rewards to participating accounts.
+func (pm *PaymentMgr) processDividends(height uint32) error {
 	// Waiting two blocks after a successful payment before proceeding with
 	// the next one because the reserved amount for transaction fees becomes
 	// change after a successful transaction. Change matures after the next
@@ -475,56 +1165,434 @@ func (pm *PaymentMgr) payDividends(height uint32) error {
 	if lastPaymentHeight != 0 && (height-lastPaymentHeight) < 3 {
 		return nil
 	}
+
+	// Retry a failed payment dispatch at the height it was first attempted
+	// once its backoff elapses. This ensures a successful retry results in
+	// the same payments being archived as a successful first attempt.
+	failure := pm.fetchDispatchFailure()
+	if failure != nil {
+		if failure.RequiresAttention {
+			log.Tracef("Payments at height #%d require attention, "+
+				"skipping dispatch", failure.Height)
+			return nil
+		}
+		if time.Now().UnixNano() < failure.NextAttempt {
+			return nil
+		}
+		height = failure.Height
+	}
+
+	// A dry run plans the payment cycle without dispatching it or
+	// modifying any payment state.
+	if pm.config().DryRun {
+		return pm.planPayments(height)
+	}
+
+	// Check the wallet balance of a deferred payment cycle again only
+	// once the retry interval elapses.
+	deferral := pm.fetchPaymentDeferral()
+	if deferral != nil && time.Now().UnixNano() < deferral.NextCheck {
+		return nil
+	}
+
+	// The payment cycle is marked in flight while its payments are
+	// dispatched so the accounts paid are not merged meanwhile. A cycle
+	// with a failed dispatch remains in flight until it is retried.
+	err := persistPaymentCycle(pm.config().DB, &paymentCycle{Height: height})
+	if err != nil {
+		return err
+	}
+	var inFlight bool
+	defer func() {
+		if inFlight {
+			return
+		}
+		err := persistPaymentCycle(pm.config().DB, nil)
+		if err != nil {
+			log.Errorf("unable to clear payment cycle: %v", err)
+		}
+	}()
+
 	eligiblePmts, err := pm.fetchEligiblePaymentBundles(height)
 	if err != nil {
 		return err
 	}
+
+	// Payments to invalid payout addresses are quarantined so the rest of
+	// the payment cycle proceeds without them.
+	eligiblePmts, err = pm.quarantineInvalidPayouts(eligiblePmts)
+	if err != nil {
+		return err
+	}
+	if len(eligiblePmts) > 0 {
+		cycle := &paymentCycle{Height: height}
+		for _, bundle := range eligiblePmts {
+			for _, pmt := range bundle.Payments {
+				cycle.Accounts = append(cycle.Accounts, pmt.Account)
+			}
+		}
+		err = persistPaymentCycle(pm.config().DB, cycle)
+		if err != nil {
+			return err
+		}
+	}
+	if len(eligiblePmts) == 0 {
+		pm.clearPaymentRequests()
+		pm.resetDispatchFailure()
+		pm.resetPaymentDeferral()
+		return nil
+	}
+
+	// Split the eligible payments into chunks to keep the resulting payment
+	// transactions within standardness limits. Chunks are dispatched
+	// sequentially, a failed chunk does not affect previously dispatched
+	// chunks and is picked up again on the next payment attempt since its
+	// payments remain pending.
+	addr := pm.config().PoolFeeAddrs[rand.Intn(len(pm.config().PoolFeeAddrs))]
+	chunks := chunkPaymentBundles(eligiblePmts, pm.config().MaxPaymentOutputs,
+		pm.config().MaxPaymentTxSize)
+
+	// The entire payment cycle is deferred if the wallet cannot cover it
+	// instead of dispatching the chunks it can partially cover.
+	err = pm.preflightBalance(height, chunks)
+	if err != nil {
+		if IsError(err, ErrInsufficientBalance) {
+			return nil
+		}
+		return err
+	}
+
+	for idx, chunk := range chunks {
+		// The cycle is checkpointed between chunks on shutdown, it remains
+		// in flight if chunks were already dispatched.
+		if pm.isStopping() {
+			log.Infof("Checkpointed the payment cycle at height #%d "+
+				"after %d of %d payment chunk(s), the remaining chunks "+
+				"are dispatched after a restart", height, idx, len(chunks))
+			inFlight = idx > 0
+			return nil
+		}
+		err := pm.dispatchPayments(chunk, addr, height)
+		if err != nil {
+			err = fmt.Errorf("unable to dispatch payment chunk %d of %d: %v",
+				idx+1, len(chunks), err)
+			pm.recordDispatchFailure(height, err)
+			inFlight = true
+			return err
+		}
+	}
+
+	// Payment requests are only cleared once all eligible payments have
+	// been dispatched so requested payments below the minimum payment are
+	// retried along with the rest.
+	pm.clearPaymentRequests()
+	pm.resetDispatchFailure()
+	return nil
+}
+
+// clearPaymentRequests removes all pending payment requests.
+func (pm *PaymentMgr) clearPaymentRequests() {
 	pm.paymentReqsMtx.Lock()
 	for accountID := range pm.paymentReqs {
 		delete(pm.paymentReqs, accountID)
 	}
 	pm.paymentReqsMtx.Unlock()
+}
 
-	if len(eligiblePmts) == 0 {
-		return nil
+// fetchPaymentFailureBucket is a helper function for getting the payment
+// failure bucket.
+func fetchPaymentFailureBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(paymentFailureBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(paymentFailureBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
 	}
+	return bkt, nil
+}
 
-	addr := pm.cfg.PoolFeeAddrs[rand.Intn(len(pm.cfg.PoolFeeAddrs))]
-	pmtDetails, targetAmt, err := generatePaymentDetails(pm.cfg.DB, addr, eligiblePmts)
+// persistDispatchFailure saves the provided failed payment dispatch as the
+// failed dispatch awaiting a retry or requiring attention, a nil failure
+// clears it.
+func persistDispatchFailure(db *bolt.DB, failure *DispatchFailure) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchPaymentFailureBucket(tx)
+		if err != nil {
+			return err
+		}
+		keys := make([][]byte, 0)
+		c := bkt.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			err := bkt.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		if failure == nil {
+			return nil
+		}
+		failureBytes, err := json.Marshal(failure)
+		if err != nil {
+			return err
+		}
+		k := make([]byte, 4)
+		binary.BigEndian.PutUint32(k, failure.Height)
+		return bkt.Put(k, failureBytes)
+	})
+}
+
+// loadDispatchFailure fetches the failed payment dispatch persisted before
+// the payment manager was last stopped, its retry schedule and whether it
+// requires attention carry over.
+func (pm *PaymentMgr) loadDispatchFailure(tx *bolt.Tx) error {
+	bkt, err := fetchPaymentFailureBucket(tx)
 	if err != nil {
 		return err
 	}
-	poolFee, ok := pmtDetails[addr.String()]
-	if ok {
-		// Replenish the tx fee reserve if a pool fee bundle entry exists.
-		updatedFee := pm.replenishTxFeeReserve(poolFee)
-		if updatedFee == 0 {
-			delete(pmtDetails, addr.String())
-		} else {
-			pmtDetails[addr.String()] = updatedFee
+	_, v := bkt.Cursor().Last()
+	if v == nil {
+		return nil
+	}
+	var failure DispatchFailure
+	err = json.Unmarshal(v, &failure)
+	if err != nil {
+		return err
+	}
+	if failure.RequiresAttention {
+		log.Warnf("Payments at height #%d require attention after %d "+
+			"failed dispatch attempt(s): %s", failure.Height,
+			failure.Attempts, failure.Error)
+	}
+	pm.dispatchFailMtx.Lock()
+	pm.dispatchFail = &failure
+	pm.dispatchFailMtx.Unlock()
+	return nil
+}
+
+// recordDispatchFailure records a failed payment dispatch attempt at the
+// provided height and schedules its retry. The failure requires attention
+// once the maximum number of retries have been exhausted. The failure is
+// persisted so it survives restarts.
+func (pm *PaymentMgr) recordDispatchFailure(height uint32, dispatchErr error) {
+	now := time.Now()
+	pm.dispatchFailMtx.Lock()
+	defer pm.dispatchFailMtx.Unlock()
+	if pm.dispatchFail == nil {
+		pm.dispatchFail = &DispatchFailure{Height: height}
+	}
+	failure := pm.dispatchFail
+	failure.Attempts++
+	failure.Error = dispatchErr.Error()
+	failure.LastAttempt = now.UnixNano()
+	defer func() {
+		err := persistDispatchFailure(pm.config().DB, failure)
+		if err != nil {
+			log.Errorf("unable to persist the payment dispatch failure at "+
+				"height #%d: %v", failure.Height, err)
 		}
+	}()
+	if failure.Attempts > pm.config().MaxPaymentRetries {
+		failure.RequiresAttention = true
+		failure.NextAttempt = 0
+		log.Errorf("Payments at height #%d require attention after %d "+
+			"failed dispatch attempt(s): %s", failure.Height,
+			failure.Attempts, failure.Error)
+		return
 	}
-	pmts := make(map[dcrutil.Address]dcrutil.Amount, len(pmtDetails))
-	for dest, amt := range pmtDetails {
-		addr, err := dcrutil.DecodeAddress(dest, pm.cfg.ActiveNet)
+
+	backoff := maxPaymentRetryBackoff
+	shift := failure.Attempts - 1
+	if shift < 32 {
+		delay := pm.config().PaymentRetryBackoff << shift
+		if delay >= 0 && delay < maxPaymentRetryBackoff {
+			backoff = delay
+		}
+	}
+	failure.NextAttempt = now.Add(backoff).UnixNano()
+	log.Infof("Payment dispatch at height #%d failed (attempt %d of %d), "+
+		"retrying in %v", failure.Height, failure.Attempts,
+		pm.config().MaxPaymentRetries+1, backoff)
+}
+
+// fetchDispatchFailure returns a copy of the failed payment dispatch
+// awaiting a retry, or nil if there is none.
+func (pm *PaymentMgr) fetchDispatchFailure() *DispatchFailure {
+	pm.dispatchFailMtx.RLock()
+	defer pm.dispatchFailMtx.RUnlock()
+	if pm.dispatchFail == nil {
+		return nil
+	}
+	failure := *pm.dispatchFail
+	return &failure
+}
+
+// resetDispatchFailure clears the failed payment dispatch state and its
+// persisted record, pending payments are dispatched again on the next
+// payment attempt.
+func (pm *PaymentMgr) resetDispatchFailure() {
+	pm.dispatchFailMtx.Lock()
+	defer pm.dispatchFailMtx.Unlock()
+	if pm.dispatchFail == nil {
+		return
+	}
+	err := persistDispatchFailure(pm.config().DB, nil)
+	if err != nil {
+		log.Errorf("unable to clear the payment dispatch failure at "+
+			"height #%d: %v", pm.dispatchFail.Height, err)
+	}
+	pm.dispatchFail = nil
+}
+
+// preflightBalance asserts the wallet's spendable balance covers the
+// provided payment chunks and their estimated transaction fees. The payment
+// cycle at the provided height is deferred if it does not, the deferral is
+// cleared once the balance is sufficient.
+func (pm *PaymentMgr) preflightBalance(height uint32, chunks [][]*PaymentBundle) error {
+	if pm.config().FetchSpendableBalance == nil {
+		return nil
+	}
+	var required dcrutil.Amount
+	for _, chunk := range chunks {
+		for _, bundle := range chunk {
+			required += bundle.Total()
+		}
+	}
+	required += estimatePaymentFees(chunks)
+	spendable, err := pm.config().FetchSpendableBalance()
+	if err != nil {
+		return fmt.Errorf("unable to fetch spendable balance: %v", err)
+	}
+	if spendable >= required {
+		if pm.fetchPaymentDeferral() != nil {
+			log.Infof("Wallet balance of %v covers deferred payments of "+
+				"%v, resuming payments", spendable, required)
+			pm.resetPaymentDeferral()
+		}
+		return nil
+	}
+
+	now := time.Now()
+	pm.deferralMtx.Lock()
+	deferred := pm.deferral == nil
+	if deferred {
+		pm.deferral = &PaymentDeferral{Since: now.UnixNano()}
+	}
+	pm.deferral.Height = height
+	pm.deferral.Required = required
+	pm.deferral.Spendable = spendable
+	pm.deferral.NextCheck = now.Add(pm.config().BalanceRetryInterval).UnixNano()
+	deferral := *pm.deferral
+	pm.deferralMtx.Unlock()
+
+	if deferred {
+		log.Warnf("Deferring payments at height #%d, wallet balance of %v "+
+			"does not cover payments of %v, checking again in %v", height,
+			spendable, required, pm.config().BalanceRetryInterval)
+		if pm.config().NotifyPaymentsDeferred != nil {
+			pm.config().NotifyPaymentsDeferred(&deferral)
+		}
+	}
+	desc := fmt.Sprintf("spendable balance of %v does not cover payments "+
+		"of %v", spendable, required)
+	return MakeError(ErrInsufficientBalance, desc, nil)
+}
+
+// fetchPaymentDeferral returns a copy of the deferred payment cycle
+// awaiting a sufficient wallet balance, or nil if there is none.
+func (pm *PaymentMgr) fetchPaymentDeferral() *PaymentDeferral {
+	pm.deferralMtx.RLock()
+	defer pm.deferralMtx.RUnlock()
+	if pm.deferral == nil {
+		return nil
+	}
+	deferral := *pm.deferral
+	return &deferral
+}
+
+// resetPaymentDeferral clears the deferred payment cycle state.
+func (pm *PaymentMgr) resetPaymentDeferral() {
+	pm.deferralMtx.Lock()
+	pm.deferral = nil
+	pm.deferralMtx.Unlock()
+}
+
+// retryPayments clears the failed payment dispatch and deferred payment
+// cycle states, pending payments are dispatched again on the next payment
+// attempt. An insufficient balance error is returned and the payment cycle
+// remains deferred if the wallet cannot cover the payments eligible at the
+// provided height.
+func (pm *PaymentMgr) retryPayments(height uint32) error {
+	failure := pm.fetchDispatchFailure()
+	if failure != nil {
+		height = failure.Height
+	}
+	eligiblePmts, err := pm.fetchEligiblePaymentBundles(height)
+	if err != nil {
+		return err
+	}
+	eligiblePmts, err = pm.quarantineInvalidPayouts(eligiblePmts)
+	if err != nil {
+		return err
+	}
+	if len(eligiblePmts) > 0 {
+		chunks := chunkPaymentBundles(eligiblePmts,
+			pm.config().MaxPaymentOutputs, pm.config().MaxPaymentTxSize)
+		err = pm.preflightBalance(height, chunks)
 		if err != nil {
 			return err
 		}
-		pmts[addr] = amt
 	}
+	pm.resetDispatchFailure()
+	pm.resetPaymentDeferral()
+	return nil
+}
 
-	txid, err := pm.cfg.PublishTransaction(pmts, *targetAmt)
+// dispatchPayments pays out the provided payment bundles in a single
+// transaction and archives them once the transaction is published. The
+// tx fee reserve and last payment details are persisted per dispatched
+// transaction.
+func (pm *PaymentMgr) dispatchPayments(bundles []*PaymentBundle, feeAddr dcrutil.Address, height uint32) error {
+	pmts, targetAmt, txFeeReserve, err := pm.paymentOutputs(bundles, feeAddr,
+		pm.fetchTxFeeReserve())
 	if err != nil {
 		return err
 	}
-	for _, bundle := range eligiblePmts {
-		bundle.UpdateAsPaid(pm.cfg.DB, height, txid)
-		err = bundle.ArchivePayments(pm.cfg.DB)
+
+	// A chunk comprised of only a pool fee payment which was fully used in
+	// replenishing the tx fee reserve has nothing left to pay out. The tx
+	// fee reserve is only replenished once the pool fee is paid out.
+	var txid string
+	if len(pmts) > 0 {
+		txid, err = pm.config().PublishTransaction(pmts, targetAmt)
 		if err != nil {
 			return err
 		}
+		log.Tracef("Payment transaction %s pays %d bundle(s) at height #%d",
+			txid, len(bundles), height)
+		if pm.config().NotifyPaymentSent != nil {
+			var total dcrutil.Amount
+			for _, amt := range pmts {
+				total += amt
+			}
+			pm.config().NotifyPaymentSent(txid, total, uint32(len(pmts)))
+		}
 	}
-	err = pm.cfg.DB.Update(func(tx *bolt.Tx) error {
+	pm.setTxFeeReserve(txFeeReserve)
+	for _, bundle := range bundles {
+		bundle.UpdateAsPaid(pm.config().DB, height, txid)
+		err = bundle.ArchivePayments(pm.config().DB)
+		if err != nil {
+			return err
+		}
+	}
+	err = pm.config().DB.Update(func(tx *bolt.Tx) error {
 		err = pm.persistTxFeeReserve(tx)
 		if err != nil {
 			return err
@@ -538,3 +1606,36 @@ func (pm *PaymentMgr) payDividends(height uint32) error {
 	})
 	return err
 }
+
+// paymentOutputs returns the outputs of the transaction paying out the
+// provided payment bundles and the target amount of the transaction. The
+// pool fee output is used to replenish the provided tx fee reserve first,
+// the replenished tx fee reserve is returned along with the outputs.
+func (pm *PaymentMgr) paymentOutputs(bundles []*PaymentBundle, feeAddr dcrutil.Address, txFeeReserve dcrutil.Amount) (map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount, dcrutil.Amount, error) {
+	pmtDetails, targetAmt, err := generatePaymentDetails(pm.config().DB, feeAddr,
+		pm.config().DonationAddr, bundles)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	poolFee, ok := pmtDetails[feeAddr.String()]
+	if ok {
+		// Replenish the tx fee reserve if a pool fee bundle entry exists.
+		var updatedFee dcrutil.Amount
+		txFeeReserve, updatedFee = pm.replenishedTxFeeReserve(txFeeReserve,
+			poolFee)
+		if updatedFee == 0 {
+			delete(pmtDetails, feeAddr.String())
+		} else {
+			pmtDetails[feeAddr.String()] = updatedFee
+		}
+	}
+	pmts := make(map[dcrutil.Address]dcrutil.Amount, len(pmtDetails))
+	for dest, amt := range pmtDetails {
+		addr, err := dcrutil.DecodeAddress(dest, pm.config().ActiveNet)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		pmts[addr] = amt
+	}
+	return pmts, *targetAmt, txFeeReserve, nil
+}
@@ -3,6 +3,8 @@ package pool
 import (
 	"fmt"
 	"math/big"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,6 +36,8 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 		PublishTransaction: func(map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
 			return "", nil
 		},
+		// NotifyPaymentSent is left unset, dispatching payments must not
+		// require it.
 	}
 	mgr, err := NewPaymentMgr(pCfg)
 	if err != nil {
@@ -199,6 +203,10 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	mgr.setLastPaymentPaidOn(0)
 	mgr.setLastPaymentCreatedOn(0)
 	mgr.setTxFeeReserve(zeroAmount)
+	err = resetTestDB(db)
+	if err != nil {
+		t.Fatalf("[resetTestDB] unexpected error: %v", err)
+	}
 	err = db.Update(func(tx *bolt.Tx) error {
 		err := mgr.persistLastPaymentHeight(tx)
 		if err != nil {
@@ -230,6 +238,7 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	shareCount := 10
 	coinbaseValue := 80
 	height := uint32(20)
+	blockHash := "00000000000000000000000000000000000000000000000000000000000000aa"
 	paymentMaturity := height + uint32(activeNet.CoinbaseMaturity)
 
 	// Create shares for account x and y.
@@ -251,7 +260,7 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 
 	// Ensure the last payment created on time was updated.
 	previousPaymentCreatedOn := int64(mgr.fetchLastPaymentCreatedOn())
-	err = mgr.generatePayments(height, coinbase)
+	err = mgr.generatePayments(height, blockHash, coinbase)
 	if err != nil {
 		t.Fatalf("[PPS] unable to generate payments: %v", err)
 	}
@@ -272,6 +281,17 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	if err != nil {
 		t.Error(err)
 	}
+	for _, pmt := range pmts {
+		if pmt.BlockHash != blockHash {
+			t.Fatalf("[PPS] expected payments funded by block %s, got %s",
+				blockHash, pmt.BlockHash)
+		}
+		if pmt.Account != poolFeesK &&
+			(pmt.Percentage == nil || pmt.Percentage.Cmp(big.NewRat(1, 2)) != 0) {
+			t.Fatalf("[PPS] expected a share percentage of 1/2 for "+
+				"account %s, got %v", pmt.Account, pmt.Percentage)
+		}
+	}
 	expectedBundleCount := 3
 	bundles := generatePaymentBundles(pmts)
 	if len(bundles) != expectedBundleCount {
@@ -330,6 +350,10 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	mgr.setLastPaymentPaidOn(0)
 	mgr.setLastPaymentCreatedOn(0)
 	mgr.setTxFeeReserve(zeroAmount)
+	err = resetTestDB(db)
+	if err != nil {
+		t.Fatalf("[resetTestDB] unexpected error: %v", err)
+	}
 	err = db.Update(func(tx *bolt.Tx) error {
 		err := mgr.persistLastPaymentHeight(tx)
 		if err != nil {
@@ -377,7 +401,7 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 
 	// Ensure the last payment created on time was updated.
 	previousPaymentCreatedOn = int64(mgr.fetchLastPaymentCreatedOn())
-	err = mgr.generatePayments(height, coinbase)
+	err = mgr.generatePayments(height, blockHash, coinbase)
 	if err != nil {
 		t.Fatalf("[PPLNS] unable to generate payments: %v", err)
 	}
@@ -457,6 +481,10 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	mgr.setLastPaymentPaidOn(0)
 	mgr.setLastPaymentCreatedOn(0)
 	mgr.setTxFeeReserve(zeroAmount)
+	err = resetTestDB(db)
+	if err != nil {
+		t.Fatalf("[resetTestDB] unexpected error: %v", err)
+	}
 	err = db.Update(func(tx *bolt.Tx) error {
 		err := mgr.persistLastPaymentHeight(tx)
 		if err != nil {
@@ -500,7 +528,7 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	}
 
 	// Generate payments.
-	err = mgr.generatePayments(height, coinbase)
+	err = mgr.generatePayments(height, blockHash, coinbase)
 	if err != nil {
 		t.Fatalf("unable to generate payments: %v", err)
 	}
@@ -520,6 +548,24 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 		t.Fatalf("expected %v payment bundles, got %v", expectedBundleCount, len(bundles))
 	}
 
+	// Ensure the minimum payout of an account applies in place of the
+	// minimum payment.
+	err = persistAccountSettings(db, xID, &AccountSettings{MinPayout: coinbase})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	bundles, err = mgr.fetchEligiblePaymentBundles(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[fetchEligiblePaymentBundles] unexpected error: %v", err)
+	}
+	if len(bundles) != 0 {
+		t.Fatalf("expected no payment bundles, got %v", len(bundles))
+	}
+	err = emptyBucket(db, accountSettingsBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+
 	// Empty the share bucket.
 	err = emptyBucket(db, shareBkt)
 	if err != nil {
@@ -537,6 +583,10 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	mgr.setLastPaymentPaidOn(0)
 	mgr.setLastPaymentCreatedOn(0)
 	mgr.setTxFeeReserve(zeroAmount)
+	err = resetTestDB(db)
+	if err != nil {
+		t.Fatalf("[resetTestDB] unexpected error: %v", err)
+	}
 	err = db.Update(func(tx *bolt.Tx) error {
 		err := mgr.persistLastPaymentHeight(tx)
 		if err != nil {
@@ -576,7 +626,7 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	}
 
 	// Generate readily available payments.
-	err = mgr.generatePayments(height, coinbase)
+	err = mgr.generatePayments(height, blockHash, coinbase)
 	if err != nil {
 		t.Fatalf("unable to generate payments: %v", err)
 	}
@@ -620,6 +670,10 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	mgr.setLastPaymentPaidOn(0)
 	mgr.setLastPaymentCreatedOn(0)
 	mgr.setTxFeeReserve(zeroAmount)
+	err = resetTestDB(db)
+	if err != nil {
+		t.Fatalf("[resetTestDB] unexpected error: %v", err)
+	}
 	err = db.Update(func(tx *bolt.Tx) error {
 		err := mgr.persistLastPaymentHeight(tx)
 		if err != nil {
@@ -661,7 +715,7 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 		}
 	}
 
-	err = mgr.generatePayments(height, coinbase)
+	err = mgr.generatePayments(height, blockHash, coinbase)
 	if err != nil {
 		t.Fatalf("unable to generate payments: %v", err)
 	}
@@ -723,6 +777,669 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 		t.Fatal("expected an updated payment height")
 	}
 
+	// Ensure large payouts are split across multiple transactions and a
+	// failed transaction only leaves its own payments pending.
+	err = emptyBucket(db, shareBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, paymentBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	mgr.setLastPaymentCreatedOn(0)
+	fiveBefore := time.Now().Add(-(time.Second * 5)).UnixNano()
+	for i := 0; i < shareCount; i++ {
+		err = persistShare(db, xID, weight, fiveBefore+int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = persistShare(db, yID, weight, fiveBefore+int64(shareCount+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = mgr.generatePayments(height, blockHash, coinbase)
+	if err != nil {
+		t.Fatalf("unable to generate payments: %v", err)
+	}
+	bundles, err = mgr.fetchEligiblePaymentBundles(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[fetchEligiblePaymentBundles] unexpected error: %v", err)
+	}
+	expectedBundleCount = 3
+	if len(bundles) != expectedBundleCount {
+		t.Fatalf("expected %v payment bundles, got %v", expectedBundleCount, len(bundles))
+	}
+
+	chunkTxID := "chunk-1"
+	publishCalls := 0
+	mgr.cfg.MaxPaymentOutputs = 1
+	mgr.cfg.MaxPaymentRetries = 1
+	mgr.cfg.PublishTransaction = func(map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
+		publishCalls++
+		if publishCalls > 1 {
+			return "", fmt.Errorf("unable to publish transaction")
+		}
+		return chunkTxID, nil
+	}
+	mgr.setLastPaymentHeight(0)
+	err = mgr.payDividends(paymentMaturity)
+	if err == nil {
+		t.Fatal("[payDividends] expected a chunk dispatch error")
+	}
+	if publishCalls != 2 {
+		t.Fatalf("expected 2 publish attempts, got %v", publishCalls)
+	}
+
+	// Ensure the first chunk was archived with its transaction id.
+	paid := 0
+	for _, id := range []string{xID, yID, poolFeesK} {
+		pmts, err := fetchArchivedPaymentsForAccount(db, id, 100)
+		if err != nil {
+			t.Fatalf("[fetchArchivedPaymentsForAccount] unexpected error: %v", err)
+		}
+		for _, pmt := range pmts {
+			if pmt.TransactionID == chunkTxID {
+				paid++
+			}
+		}
+	}
+	if paid == 0 {
+		t.Fatalf("expected archived payments with transaction id %s", chunkTxID)
+	}
+
+	// Ensure only the failed and undispatched chunks remain pending.
+	bundles, err = mgr.fetchEligiblePaymentBundles(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[fetchEligiblePaymentBundles] unexpected error: %v", err)
+	}
+	expectedBundleCount = 2
+	if len(bundles) != expectedBundleCount {
+		t.Fatalf("expected %v payment bundles, got %v", expectedBundleCount, len(bundles))
+	}
+
+	// Ensure the remaining chunks are paid on the next attempt.
+	mgr.cfg.PublishTransaction = func(map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
+		return "", nil
+	}
+	mgr.setLastPaymentHeight(0)
+	err = mgr.payDividends(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	bundles, err = mgr.fetchEligiblePaymentBundles(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[fetchEligiblePaymentBundles] unexpected error: %v", err)
+	}
+	if len(bundles) != 0 {
+		t.Fatalf("expected no payment bundles, got %v", len(bundles))
+	}
+	mgr.cfg.MaxPaymentOutputs = 0
+
+	// Empty the payment archive bucket.
+	err = emptyBucket(db, paymentArchiveBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+
+	// Empty the payment total bucket.
+	err = emptyBucket(db, paymentTotalBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+
+	// createMaturePayments creates payments for accounts X, Y and
+	// pool fees which are eligible for payment at payment maturity.
+	createMaturePayments := func() {
+		err := emptyBucket(db, shareBkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+		mgr.setLastPaymentCreatedOn(0)
+		mgr.setLastPaymentHeight(0)
+		before := time.Now().Add(-(time.Second * 5)).UnixNano()
+		for i := 0; i < shareCount; i++ {
+			err = persistShare(db, xID, weight, before+int64(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = persistShare(db, yID, weight, before+int64(shareCount+i))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = mgr.generatePayments(height, blockHash, coinbase)
+		if err != nil {
+			t.Fatalf("unable to generate payments: %v", err)
+		}
+	}
+
+	// Ensure a failed payment dispatch is retried at its original height
+	// and a successful retry archives the same records as a first attempt.
+	createMaturePayments()
+	retryTxID := "retry"
+	publishCalls = 0
+	mgr.cfg.MaxPaymentRetries = 2
+	mgr.cfg.PaymentRetryBackoff = 0
+	mgr.cfg.PublishTransaction = func(map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
+		publishCalls++
+		if publishCalls <= 2 {
+			return "", fmt.Errorf("wallet unavailable")
+		}
+		return retryTxID, nil
+	}
+	for attempt := uint32(1); attempt <= 2; attempt++ {
+		err = mgr.payDividends(paymentMaturity + attempt - 1)
+		if err == nil {
+			t.Fatalf("[payDividends] expected a dispatch error on attempt %d",
+				attempt)
+		}
+		failure := mgr.fetchDispatchFailure()
+		if failure == nil {
+			t.Fatalf("expected a dispatch failure on attempt %d", attempt)
+		}
+		if failure.Attempts != attempt {
+			t.Fatalf("expected %d dispatch attempts, got %d", attempt,
+				failure.Attempts)
+		}
+		if failure.Height != paymentMaturity {
+			t.Fatalf("expected dispatch failure height %d, got %d",
+				paymentMaturity, failure.Height)
+		}
+		if failure.RequiresAttention {
+			t.Fatalf("expected dispatch failure on attempt %d to not "+
+				"require attention", attempt)
+		}
+	}
+
+	// Ensure the payment cycle of a failed dispatch remains in flight
+	// until it is dispatched.
+	fetchCycle := func() *paymentCycle {
+		var cycle *paymentCycle
+		err := db.View(func(tx *bolt.Tx) error {
+			var err error
+			cycle, err = fetchPaymentCycle(tx)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("[fetchPaymentCycle] unexpected error: %v", err)
+		}
+		return cycle
+	}
+	cycle := fetchCycle()
+	if cycle == nil || !cycle.includes(xID) || cycle.includes("other") {
+		t.Fatalf("expected a payment cycle in flight for account X, got %v",
+			cycle)
+	}
+	err = mgr.payDividends(paymentMaturity + 2)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	if mgr.fetchDispatchFailure() != nil {
+		t.Fatal("expected the dispatch failure to be cleared")
+	}
+	if fetchCycle() != nil {
+		t.Fatal("expected the payment cycle to be cleared")
+	}
+	if mgr.fetchLastPaymentHeight() != paymentMaturity {
+		t.Fatalf("expected last payment height %d, got %d",
+			paymentMaturity, mgr.fetchLastPaymentHeight())
+	}
+	for _, id := range []string{xID, yID, poolFeesK} {
+		pmts, err := fetchArchivedPaymentsForAccount(db, id, 100)
+		if err != nil {
+			t.Fatalf("[fetchArchivedPaymentsForAccount] unexpected error: %v", err)
+		}
+		if len(pmts) != 1 {
+			t.Fatalf("expected 1 archived payment for %s, got %d", id, len(pmts))
+		}
+		if pmts[0].PaidOnHeight != paymentMaturity {
+			t.Fatalf("expected payment for %s paid on height %d, got %d",
+				id, paymentMaturity, pmts[0].PaidOnHeight)
+		}
+		if pmts[0].TransactionID != retryTxID {
+			t.Fatalf("expected payment for %s to have transaction id %s, "+
+				"got %s", id, retryTxID, pmts[0].TransactionID)
+		}
+	}
+	err = emptyBucket(db, paymentArchiveBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+
+	// Empty the payment total bucket.
+	err = emptyBucket(db, paymentTotalBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+
+	// Ensure retries are deferred until the backoff elapses and failed
+	// dispatches require attention once retries are exhausted.
+	createMaturePayments()
+	publishCalls = 0
+	mgr.cfg.MaxPaymentRetries = 1
+	mgr.cfg.PaymentRetryBackoff = time.Hour
+	mgr.cfg.PublishTransaction = func(map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
+		publishCalls++
+		return "", fmt.Errorf("wallet unavailable")
+	}
+	err = mgr.payDividends(paymentMaturity)
+	if err == nil {
+		t.Fatal("[payDividends] expected a dispatch error")
+	}
+	err = mgr.payDividends(paymentMaturity + 1)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	if publishCalls != 1 {
+		t.Fatalf("expected retry to be deferred, got %d publish attempts",
+			publishCalls)
+	}
+	mgr.cfg.PaymentRetryBackoff = 0
+	mgr.dispatchFailMtx.Lock()
+	mgr.dispatchFail.NextAttempt = 0
+	mgr.dispatchFailMtx.Unlock()
+	err = mgr.payDividends(paymentMaturity + 1)
+	if err == nil {
+		t.Fatal("[payDividends] expected a dispatch error")
+	}
+	failure := mgr.fetchDispatchFailure()
+	if failure == nil || !failure.RequiresAttention {
+		t.Fatal("expected the dispatch failure to require attention")
+	}
+	err = mgr.payDividends(paymentMaturity + 2)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	if publishCalls != 2 {
+		t.Fatalf("expected no dispatch attempts once attention is "+
+			"required, got %d publish attempts", publishCalls)
+	}
+
+	// Ensure the dispatch failure is reloaded when the payment manager
+	// is restarted.
+	restarted, err := NewPaymentMgr(mgr.cfg)
+	if err != nil {
+		t.Fatalf("[NewPaymentMgr] unexpected error: %v", err)
+	}
+	reloaded := restarted.fetchDispatchFailure()
+	if reloaded == nil || !reloaded.RequiresAttention {
+		t.Fatal("expected the reloaded dispatch failure to require attention")
+	}
+	if reloaded.Height != failure.Height {
+		t.Fatalf("expected reloaded dispatch failure height %d, got %d",
+			failure.Height, reloaded.Height)
+	}
+	if reloaded.Attempts != failure.Attempts {
+		t.Fatalf("expected %d reloaded dispatch attempts, got %d",
+			failure.Attempts, reloaded.Attempts)
+	}
+	if reloaded.Error != failure.Error {
+		t.Fatalf("expected reloaded dispatch error %q, got %q",
+			failure.Error, reloaded.Error)
+	}
+
+	// Ensure resetting the dispatch failure resumes payments and clears
+	// the persisted failure.
+	mgr.resetDispatchFailure()
+	restarted, err = NewPaymentMgr(mgr.cfg)
+	if err != nil {
+		t.Fatalf("[NewPaymentMgr] unexpected error: %v", err)
+	}
+	if restarted.fetchDispatchFailure() != nil {
+		t.Fatal("expected no dispatch failure after a reset")
+	}
+	mgr.cfg.PublishTransaction = func(map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
+		return "", nil
+	}
+	err = mgr.payDividends(paymentMaturity + 2)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	bundles, err = mgr.fetchEligiblePaymentBundles(paymentMaturity + 2)
+	if err != nil {
+		t.Fatalf("[fetchEligiblePaymentBundles] unexpected error: %v", err)
+	}
+	if len(bundles) != 0 {
+		t.Fatalf("expected no payment bundles, got %v", len(bundles))
+	}
+	mgr.cfg.MaxPaymentRetries = 0
+
+	// Ensure a payment cycle the wallet balance does not cover is deferred
+	// without dispatching any payments.
+	for _, bkt := range [][]byte{paymentArchiveBkt, paymentTotalBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+	createMaturePayments()
+	bundles, err = mgr.fetchEligiblePaymentBundles(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[fetchEligiblePaymentBundles] unexpected error: %v", err)
+	}
+	var payouts dcrutil.Amount
+	for _, bundle := range bundles {
+		payouts += bundle.Total()
+	}
+	chunks := chunkPaymentBundles(bundles, 0, 0)
+	required := payouts + estimatePaymentFees(chunks)
+	if required <= payouts {
+		t.Fatalf("expected estimated fees in required amount %v", required)
+	}
+	spendable := required - 1
+	publishCalls = 0
+	var deferrals []*PaymentDeferral
+	mgr.cfg.BalanceRetryInterval = time.Hour
+	mgr.cfg.FetchSpendableBalance = func() (dcrutil.Amount, error) {
+		return spendable, nil
+	}
+	mgr.cfg.NotifyPaymentsDeferred = func(deferral *PaymentDeferral) {
+		deferrals = append(deferrals, deferral)
+	}
+	mgr.cfg.PublishTransaction = func(map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
+		publishCalls++
+		return "deferred", nil
+	}
+	err = mgr.payDividends(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	if publishCalls != 0 {
+		t.Fatalf("expected no publish attempts, got %d", publishCalls)
+	}
+	deferral := mgr.fetchPaymentDeferral()
+	if deferral == nil {
+		t.Fatal("expected a payment deferral")
+	}
+	if deferral.Required != required || deferral.Spendable != spendable {
+		t.Fatalf("expected a deferral requiring %v with %v spendable, "+
+			"got %v with %v spendable", required, spendable,
+			deferral.Required, deferral.Spendable)
+	}
+	if len(deferrals) != 1 {
+		t.Fatalf("expected 1 deferral notification, got %d", len(deferrals))
+	}
+
+	// Ensure the balance is not checked again before the retry interval
+	// elapses and a deferred cycle is only notified once.
+	err = mgr.payDividends(paymentMaturity + 1)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	mgr.deferralMtx.Lock()
+	mgr.deferral.NextCheck = 0
+	mgr.deferralMtx.Unlock()
+	err = mgr.payDividends(paymentMaturity + 1)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	if publishCalls != 0 || len(deferrals) != 1 {
+		t.Fatalf("expected no publish attempts and 1 deferral "+
+			"notification, got %d and %d", publishCalls, len(deferrals))
+	}
+
+	// Ensure forcing a payment retry errors while the balance remains
+	// insufficient.
+	err = mgr.retryPayments(paymentMaturity)
+	if !IsError(err, ErrInsufficientBalance) {
+		t.Fatalf("[retryPayments] expected an insufficient balance "+
+			"error, got %v", err)
+	}
+	if mgr.fetchPaymentDeferral() == nil {
+		t.Fatal("expected the payment deferral to remain")
+	}
+
+	// Ensure a sufficient balance clears the deferral and resumes payments.
+	spendable = required
+	err = mgr.retryPayments(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[retryPayments] unexpected error: %v", err)
+	}
+	if mgr.fetchPaymentDeferral() != nil {
+		t.Fatal("expected the payment deferral to be cleared")
+	}
+	err = mgr.payDividends(paymentMaturity + 1)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	if publishCalls != 1 {
+		t.Fatalf("expected 1 publish attempt, got %d", publishCalls)
+	}
+	bundles, err = mgr.fetchEligiblePaymentBundles(paymentMaturity + 1)
+	if err != nil {
+		t.Fatalf("[fetchEligiblePaymentBundles] unexpected error: %v", err)
+	}
+	if len(bundles) != 0 {
+		t.Fatalf("expected no payment bundles, got %v", len(bundles))
+	}
+	mgr.cfg.FetchSpendableBalance = nil
+	mgr.cfg.NotifyPaymentsDeferred = nil
+
+	// Empty the share and payment buckets.
+	err = emptyBucket(db, shareBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, paymentBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+
+	// Ensure payments of held accounts accrue across payment cycles
+	// without being dispatched.
+	for _, bkt := range [][]byte{paymentArchiveBkt, paymentTotalBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+	err = persistAccountSettings(db, xID, &AccountSettings{PaymentsHeld: true})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	mgr.cfg.PublishTransaction = func(map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
+		return "held", nil
+	}
+	cycles := 3
+	for i := 1; i <= cycles; i++ {
+		createMaturePayments()
+		err = mgr.payDividends(paymentMaturity)
+		if err != nil {
+			t.Fatalf("[payDividends] unexpected error: %v", err)
+		}
+		for id, expected := range map[string]int{xID: 0, yID: i} {
+			pmts, err := fetchArchivedPaymentsForAccount(db, id, 100)
+			if err != nil {
+				t.Fatalf("[fetchArchivedPaymentsForAccount] unexpected error: %v", err)
+			}
+			if len(pmts) != expected {
+				t.Fatalf("expected %d archived payments for %s after "+
+					"cycle %d, got %d", expected, id, i, len(pmts))
+			}
+		}
+	}
+	heldPmts, err := fetchPendingPaymentsForAccount(db, xID, 100)
+	if err != nil {
+		t.Fatalf("[fetchPendingPaymentsForAccount] unexpected error: %v", err)
+	}
+	if len(heldPmts) != cycles {
+		t.Fatalf("expected %d pending payments for held account, got %d",
+			cycles, len(heldPmts))
+	}
+	var heldAmt dcrutil.Amount
+	for _, pmt := range heldPmts {
+		heldAmt += pmt.Amount
+	}
+	balance, err := mgr.fetchAccountBalance(xID, paymentMaturity, nil)
+	if err != nil {
+		t.Fatalf("[fetchAccountBalance] unexpected error: %v", err)
+	}
+	if balance.Held != heldAmt || balance.Pending != 0 ||
+		balance.CarriedOver != 0 {
+		t.Fatalf("expected a held balance of %v, got %v", heldAmt, balance)
+	}
+	err = mgr.addPaymentRequest(xAddr)
+	if err == nil {
+		t.Fatal("[addPaymentRequest] expected an error for a held account")
+	}
+
+	// Ensure releasing the hold makes the accrued payments eligible.
+	err = persistAccountSettings(db, xID, &AccountSettings{})
+	if err != nil {
+		t.Fatalf("[persistAccountSettings] unexpected error: %v", err)
+	}
+	mgr.setLastPaymentHeight(0)
+	err = mgr.payDividends(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	pmts, err = fetchArchivedPaymentsForAccount(db, xID, 100)
+	if err != nil {
+		t.Fatalf("[fetchArchivedPaymentsForAccount] unexpected error: %v", err)
+	}
+	if len(pmts) != cycles {
+		t.Fatalf("expected %d archived payments for released account, "+
+			"got %d", cycles, len(pmts))
+	}
+	for _, bkt := range [][]byte{shareBkt, paymentBkt, paymentArchiveBkt,
+		paymentTotalBkt, accountSettingsBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+
+	// Ensure payments to an invalid payout address are quarantined while
+	// the rest of the payment cycle proceeds.
+	err = updateAccountAddress(db, xID, "invalid")
+	if err != nil {
+		t.Fatalf("[updateAccountAddress] unexpected error: %v", err)
+	}
+	var payees []string
+	mgr.cfg.PublishTransaction = func(payouts map[dcrutil.Address]dcrutil.Amount, target dcrutil.Amount) (string, error) {
+		for addr := range payouts {
+			payees = append(payees, addr.String())
+		}
+		return "quarantine", nil
+	}
+	createMaturePayments()
+	err = mgr.payDividends(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	for _, payee := range payees {
+		if payee == xAddr || payee == "invalid" {
+			t.Fatalf("expected no payout to the quarantined account")
+		}
+	}
+	pmts, err = fetchArchivedPaymentsForAccount(db, yID, 100)
+	if err != nil {
+		t.Fatalf("[fetchArchivedPaymentsForAccount] unexpected error: %v", err)
+	}
+	if len(pmts) != 1 {
+		t.Fatalf("expected 1 archived payment for the valid account, got %d",
+			len(pmts))
+	}
+	quarantined, err := fetchQuarantinedPayments(db, "")
+	if err != nil {
+		t.Fatalf("[fetchQuarantinedPayments] unexpected error: %v", err)
+	}
+	if len(quarantined) != 1 || quarantined[0].Account != xID ||
+		!strings.Contains(quarantined[0].Quarantine, "invalid payout address") {
+		t.Fatalf("expected a quarantined payment for %s, got %v", xID,
+			quarantined)
+	}
+
+	// Ensure quarantined payments are not retried until requeued.
+	mgr.setLastPaymentHeight(0)
+	payees = nil
+	err = mgr.payDividends(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	if len(payees) != 0 {
+		t.Fatalf("expected no payouts, got %v", payees)
+	}
+
+	// Ensure correcting the address and requeueing the quarantined
+	// payments pays them out.
+	err = updateAccountAddress(db, xID, xAddr)
+	if err != nil {
+		t.Fatalf("[updateAccountAddress] unexpected error: %v", err)
+	}
+	requeued, err := mgr.requeueQuarantinedPayments(xID)
+	if err != nil {
+		t.Fatalf("[requeueQuarantinedPayments] unexpected error: %v", err)
+	}
+	if requeued != 1 {
+		t.Fatalf("expected 1 requeued payment, got %d", requeued)
+	}
+	mgr.setLastPaymentHeight(0)
+	err = mgr.payDividends(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	if len(payees) != 1 || payees[0] != xAddr {
+		t.Fatalf("expected a payout to %s, got %v", xAddr, payees)
+	}
+	for _, bkt := range [][]byte{shareBkt, paymentBkt, paymentArchiveBkt,
+		paymentTotalBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+
+	// Ensure account balances separate pending, immature and carried
+	// over dividends.
+	amt := minPayment / 2
+	mature := NewPayment(xID, amt, 10, 15)
+	immature := NewPayment(xID, amt*3, 20, 60)
+	for _, pmt := range []*Payment{mature, immature} {
+		err = pmt.Create(db)
+		if err != nil {
+			t.Fatalf("[Create] unexpected error: %v", err)
+		}
+	}
+	balance, err = mgr.fetchAccountBalance(xID, 30, nil)
+	if err != nil {
+		t.Fatalf("[fetchAccountBalance] unexpected error: %v", err)
+	}
+	if balance.Pending != 0 || balance.CarriedOver != amt ||
+		balance.Immature != amt*3 {
+		t.Fatalf("expected a carried over balance of %v and an immature "+
+			"balance of %v, got %v", amt, amt*3, balance)
+	}
+	balance, err = mgr.fetchAccountBalance(xID, 60, nil)
+	if err != nil {
+		t.Fatalf("[fetchAccountBalance] unexpected error: %v", err)
+	}
+	if balance.Pending != amt*4 || balance.CarriedOver != 0 ||
+		balance.Immature != 0 {
+		t.Fatalf("expected a pending balance of %v, got %v", amt*4, balance)
+	}
+
+	// Ensure the account's portion of unconfirmed work is estimated as
+	// immature.
+	err = persistShare(db, xID, weight, time.Now().UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := NewAcceptedWork("00000000000000001e2065a7248a9b4d3886fe3ca3128eebedddaf35fb26e58c",
+		"000000000000000000000000000000000000000000000000000000000000000",
+		40, xID, CPU, amt*10)
+	balance, err = mgr.fetchAccountBalance(xID, 30, []*AcceptedWork{work})
+	if err != nil {
+		t.Fatalf("[fetchAccountBalance] unexpected error: %v", err)
+	}
+	expected := amt*3 + amt*9
+	if balance.Immature != expected {
+		t.Fatalf("expected an immature balance of %v, got %v", expected,
+			balance.Immature)
+	}
+
 	// Empty the share bucket.
 	err = emptyBucket(db, shareBkt)
 	if err != nil {
@@ -740,6 +1457,10 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 	mgr.setLastPaymentPaidOn(0)
 	mgr.setLastPaymentCreatedOn(0)
 	mgr.setTxFeeReserve(zeroAmount)
+	err = resetTestDB(db)
+	if err != nil {
+		t.Fatalf("[resetTestDB] unexpected error: %v", err)
+	}
 	err = db.Update(func(tx *bolt.Tx) error {
 		err := mgr.persistLastPaymentHeight(tx)
 		if err != nil {
@@ -763,3 +1484,334 @@ func testPaymentMgr(t *testing.T, db *bolt.DB) {
 		t.Fatal(err)
 	}
 }
+
+func testShareWindow(t *testing.T, db *bolt.DB) {
+	mgr, err := NewPaymentMgr(&PaymentMgrConfig{
+		DB:            db,
+		ActiveNet:     chaincfg.SimNetParams(),
+		LastNPeriod:   120,
+		PaymentMethod: PPLNS,
+	})
+	if err != nil {
+		t.Fatalf("[NewPaymentMgr] unexpected error: %v", err)
+	}
+
+	// Ensure the window groups shares within the last N period by account
+	// along with their projected percentages.
+	now := time.Now()
+	stale := now.Add(-time.Second * 300).UnixNano()
+	err = persistShare(db, xID, new(big.Rat).SetInt64(8), stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent := now.Add(-time.Second * 10).UnixNano()
+	shares := []struct {
+		account string
+		weight  int64
+	}{
+		{xID, 1}, {yID, 2}, {yID, 4}, {xID, 1},
+	}
+	for i, share := range shares {
+		err = persistShare(db, share.account,
+			new(big.Rat).SetInt64(share.weight), recent+int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	window, err := mgr.fetchShareWindow()
+	if err != nil {
+		t.Fatalf("[fetchShareWindow] unexpected error: %v", err)
+	}
+	if window.PaymentMethod != PPLNS || window.LastNPeriod != 120 {
+		t.Fatalf("expected a PPLNS window of 120 seconds, got %s of %d",
+			window.PaymentMethod, window.LastNPeriod)
+	}
+	if window.Count != 4 || window.Weight.Cmp(new(big.Rat).SetInt64(8)) != 0 {
+		t.Fatalf("expected 4 shares weighing 8, got %d weighing %v",
+			window.Count, window.Weight)
+	}
+	if len(window.Accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(window.Accounts))
+	}
+	expected := []struct {
+		id         string
+		address    string
+		count      uint32
+		weight     *big.Rat
+		percentage *big.Rat
+	}{
+		{yID, yAddr, 2, new(big.Rat).SetInt64(6), big.NewRat(3, 4)},
+		{xID, xAddr, 2, new(big.Rat).SetInt64(2), big.NewRat(1, 4)},
+	}
+	for i, exp := range expected {
+		account := window.Accounts[i]
+		if account.AccountID != exp.id || account.Address != exp.address {
+			t.Fatalf("expected account %s (%s) at index %d, got %s (%s)",
+				exp.id, exp.address, i, account.AccountID, account.Address)
+		}
+		if account.Count != exp.count ||
+			account.Weight.Cmp(exp.weight) != 0 ||
+			account.Percentage.Cmp(exp.percentage) != 0 {
+			t.Fatalf("expected %d shares weighing %v (%v) for %s, got "+
+				"%d weighing %v (%v)", exp.count, exp.weight,
+				exp.percentage, exp.id, account.Count, account.Weight,
+				account.Percentage)
+		}
+	}
+
+	// Ensure the window is served from cache until it expires.
+	err = persistShare(db, xID, new(big.Rat).SetInt64(1), recent+10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := mgr.fetchShareWindow()
+	if err != nil {
+		t.Fatalf("[fetchShareWindow] unexpected error: %v", err)
+	}
+	if cached != window {
+		t.Fatal("expected the cached share window")
+	}
+	mgr.shareWindowMtx.Lock()
+	mgr.shareWindow.GeneratedOn -= int64(shareWindowTTL)
+	mgr.shareWindowMtx.Unlock()
+	window, err = mgr.fetchShareWindow()
+	if err != nil {
+		t.Fatalf("[fetchShareWindow] unexpected error: %v", err)
+	}
+	if window.Count != 5 {
+		t.Fatalf("expected 5 shares after expiry, got %d", window.Count)
+	}
+
+	// Ensure applying a configuration updates the payment parameters,
+	// leaves the remaining fields intact and discards the cached window.
+	mgr.ApplyConfig(&PaymentMgrConfig{
+		LastNPeriod: 600,
+		PoolFee:     0.05,
+		MinPayment:  dcrutil.Amount(1e6),
+	})
+	cfg := mgr.config()
+	if cfg.LastNPeriod != 600 || cfg.PoolFee != 0.05 ||
+		cfg.MinPayment != dcrutil.Amount(1e6) {
+		t.Fatalf("expected the applied payment parameters, got %d, %v, %v",
+			cfg.LastNPeriod, cfg.PoolFee, cfg.MinPayment)
+	}
+	if cfg.DB != db || cfg.PaymentMethod != PPLNS {
+		t.Fatal("expected the remaining configuration to be retained")
+	}
+	mgr.shareWindowMtx.Lock()
+	discarded := mgr.shareWindow == nil
+	mgr.shareWindowMtx.Unlock()
+	if !discarded {
+		t.Fatal("expected the cached share window to be discarded")
+	}
+	window, err = mgr.fetchShareWindow()
+	if err != nil {
+		t.Fatalf("[fetchShareWindow] unexpected error: %v", err)
+	}
+	if window.LastNPeriod != 600 || window.Count != 6 {
+		t.Fatalf("expected 6 shares within 600 seconds, got %d within %d",
+			window.Count, window.LastNPeriod)
+	}
+
+	// Ensure the PPS window spans the shares created since the last
+	// payment was created.
+	mgr.cfg.PaymentMethod = PPS
+	mgr.setLastPaymentCreatedOn(uint64(recent + 2))
+	mgr.shareWindowMtx.Lock()
+	mgr.shareWindow = nil
+	mgr.shareWindowMtx.Unlock()
+	window, err = mgr.fetchShareWindow()
+	if err != nil {
+		t.Fatalf("[fetchShareWindow] unexpected error: %v", err)
+	}
+	if window.Start != recent+2 || window.Count != 3 {
+		t.Fatalf("expected 3 shares since %d, got %d since %d", recent+2,
+			window.Count, window.Start)
+	}
+
+	err = emptyBucket(db, shareBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
+
+func testShareBoundary(t *testing.T, db *bolt.DB) {
+	activeNet := chaincfg.SimNetParams()
+	mgr, err := NewPaymentMgr(&PaymentMgrConfig{
+		DB:            db,
+		ActiveNet:     activeNet,
+		PoolFee:       0.1,
+		LastNPeriod:   120,
+		PaymentMethod: PPLNS,
+	})
+	if err != nil {
+		t.Fatalf("[NewPaymentMgr] unexpected error: %v", err)
+	}
+
+	weight := new(big.Rat).SetInt64(1)
+	before := time.Now().Add(-(time.Second * 5)).UnixNano()
+	for i := 0; i < 10; i++ {
+		err = persistShare(db, xID, weight, before+int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = persistShare(db, yID, weight, before+int64(10+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Claim shares concurrently while dividends are generated, some of
+	// them created before being persisted to mimic in flight shares.
+	var claimedMtx sync.Mutex
+	claimed := make([]*Share, 0)
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, id := range []string{xID, yID} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-quit:
+					return
+				default:
+				}
+				share := NewShare(id, weight)
+				if i%2 == 0 {
+					time.Sleep(time.Microsecond * 50)
+				}
+				err := share.Create(db)
+				if err != nil {
+					t.Errorf("[Create] unexpected error: %v", err)
+					return
+				}
+				claimedMtx.Lock()
+				claimed = append(claimed, share)
+				claimedMtx.Unlock()
+			}
+		}(id)
+	}
+	time.Sleep(time.Millisecond * 10)
+	height := uint32(30)
+	blockHash := "00000000000000000000000000000000000000000000000000000000000000cd"
+	coinbase, err := dcrutil.NewAmount(50)
+	if err != nil {
+		t.Fatalf("[NewAmount] unexpected error: %v", err)
+	}
+	err = mgr.generatePayments(height, blockHash, coinbase)
+	if err != nil {
+		t.Fatalf("[generatePayments] unexpected error: %v", err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	close(quit)
+	wg.Wait()
+
+	// Ensure the payments of the batch record the share boundary.
+	payments, err := fetchBlockPayments(db, height)
+	if err != nil {
+		t.Fatalf("[fetchBlockPayments] unexpected error: %v", err)
+	}
+	if len(payments) != 3 {
+		t.Fatalf("expected 3 payments, got %d", len(payments))
+	}
+	boundary := payments[0].ShareBoundary
+	if boundary == nil || boundary.LastShare == 0 ||
+		boundary.LastShare > boundary.End || boundary.Start > before {
+		t.Fatalf("unexpected share boundary %+v", boundary)
+	}
+	for _, payment := range payments {
+		if payment.ShareBoundary == nil ||
+			*payment.ShareBoundary != *boundary {
+			t.Fatalf("expected share boundary %+v, got %+v", boundary,
+				payment.ShareBoundary)
+		}
+	}
+
+	// Ensure shares claimed concurrently precede the boundary or are keyed
+	// after it, none of them are lost.
+	inWindow := 20
+	for _, share := range claimed {
+		if share.CreatedOn <= boundary.End {
+			inWindow++
+		}
+	}
+	shares, err := PPSEligibleShares(db, nanoToBigEndianBytes(boundary.Start),
+		nanoToBigEndianBytes(boundary.End))
+	if err != nil {
+		t.Fatalf("[PPSEligibleShares] unexpected error: %v", err)
+	}
+	if len(shares) != inWindow {
+		t.Fatalf("expected %d shares within the window, got %d", inWindow,
+			len(shares))
+	}
+	all, err := PPLNSEligibleShares(db, nanoToBigEndianBytes(before-1))
+	if err != nil {
+		t.Fatalf("[PPLNSEligibleShares] unexpected error: %v", err)
+	}
+	if len(all) != 20+len(claimed) {
+		t.Fatalf("expected %d shares, got %d", 20+len(claimed), len(all))
+	}
+
+	// Ensure recomputing the batch from the shares within the recorded
+	// window matches the payments created.
+	percentages, err := sharePercentages(shares)
+	if err != nil {
+		t.Fatalf("[sharePercentages] unexpected error: %v", err)
+	}
+	recomputed, err := CalculatePayments(percentages, coinbase,
+		mgr.cfg.PoolFee, nil, nil, height, payments[0].EstimatedMaturity)
+	if err != nil {
+		t.Fatalf("[CalculatePayments] unexpected error: %v", err)
+	}
+	amounts := make(map[string]dcrutil.Amount)
+	for _, payment := range recomputed {
+		amounts[payment.Account] = payment.Amount
+	}
+	for _, payment := range payments {
+		if amounts[payment.Account] != payment.Amount {
+			t.Fatalf("expected a recomputed amount of %v for %s, got %v",
+				payment.Amount, payment.Account, amounts[payment.Account])
+		}
+		if payment.Account == poolFeesK {
+			continue
+		}
+		if payment.Percentage.Cmp(percentages[payment.Account]) != 0 {
+			t.Fatalf("expected a recomputed percentage of %v for %s, "+
+				"got %v", payment.Percentage, payment.Account,
+				percentages[payment.Account])
+		}
+	}
+
+	// Ensure a share created before the boundary and persisted after it
+	// belongs to the next window.
+	late := &Share{Account: xID, Weight: weight, CreatedOn: boundary.End}
+	err = late.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	if late.CreatedOn <= boundary.End {
+		t.Fatalf("expected the late share to be keyed after %d, got %d",
+			boundary.End, late.CreatedOn)
+	}
+
+	err = emptyBucket(db, shareBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, paymentBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = resetTestDB(db)
+	if err != nil {
+		t.Fatalf("[resetTestDB] unexpected error: %v", err)
+	}
+	mgr.setLastPaymentCreatedOn(0)
+	err = db.Update(func(tx *bolt.Tx) error {
+		return mgr.persistLastPaymentCreatedOn(tx)
+	})
+	if err != nil {
+		t.Fatalf("unable to reset payment values: %v", err)
+	}
+}
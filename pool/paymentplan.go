@@ -0,0 +1,239 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/dcrutil"
+	"github.com/Eacred/eacrd/mempool"
+	txrules "github.com/Eacred/eacrwallet/wallet/txrules"
+)
+
+// maxPaymentPlans is the number of most recent payment plans kept.
+const maxPaymentPlans = 32
+
+// PlannedTransaction represents a payment transaction planned by a payment
+// dry run.
+type PlannedTransaction struct {
+	// Outputs represents the payout amounts of the transaction keyed by
+	// payout address.
+	Outputs map[string]dcrutil.Amount `json:"outputs"`
+	// Target represents the total amount paid out by the transaction,
+	// before the tx fee reserve replenishment.
+	Target dcrutil.Amount `json:"target"`
+	// EstimatedSize represents the estimated serialized size of the
+	// transaction in bytes.
+	EstimatedSize uint32 `json:"estimatedsize"`
+	// EstimatedFee represents the estimated fee of the transaction.
+	EstimatedFee dcrutil.Amount `json:"estimatedfee"`
+}
+
+// PaymentPlan represents the payments a payment cycle would dispatch, as
+// recorded by a payment dry run.
+type PaymentPlan struct {
+	// Height represents the height of the planned payment cycle.
+	Height uint32 `json:"height"`
+	// CreatedOn represents the time the plan was recorded, in nanoseconds.
+	CreatedOn int64 `json:"createdon"`
+	// PoolFeeAddress represents the address the pool fee is paid to.
+	PoolFeeAddress string `json:"poolfeeaddress"`
+	// Accounts represents the amounts paid to participating accounts.
+	Accounts map[string]dcrutil.Amount `json:"accounts"`
+	// PoolFee represents the pool fee collected by the payment cycle.
+	PoolFee dcrutil.Amount `json:"poolfee"`
+	// Donations represents the donations paid by the payment cycle.
+	Donations dcrutil.Amount `json:"donations"`
+	// Quarantined represents the accounts whose payments would be
+	// quarantined, along with the reason.
+	Quarantined map[string]string `json:"quarantined"`
+	// Transactions represents the payment transactions of the cycle.
+	Transactions []*PlannedTransaction `json:"transactions"`
+	// EstimatedFees represents the estimated fees of all transactions.
+	EstimatedFees dcrutil.Amount `json:"estimatedfees"`
+	// Required represents the wallet balance required by the payment
+	// cycle, including the estimated fees.
+	Required dcrutil.Amount `json:"required"`
+	// Spendable represents the spendable wallet balance at the time of the
+	// plan, zero if the balance preflight is disabled.
+	Spendable dcrutil.Amount `json:"spendable"`
+	// Deferred indicates the payment cycle would be deferred because the
+	// spendable wallet balance does not cover it.
+	Deferred bool `json:"deferred"`
+	// TxFeeReserve represents the tx fee reserve after the payment cycle.
+	TxFeeReserve dcrutil.Amount `json:"txfeereserve"`
+}
+
+// fetchPaymentPlanBucket is a helper function for getting the payment plan
+// bucket.
+func fetchPaymentPlanBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(paymentPlanBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(paymentPlanBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// persistPaymentPlan saves the provided payment plan to the database,
+// replacing a plan of the same height. Only the most recent plans are kept.
+func persistPaymentPlan(db *bolt.DB, plan *PaymentPlan) error {
+	b, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchPaymentPlanBucket(tx)
+		if err != nil {
+			return err
+		}
+		err = bkt.Put(heightToBigEndianBytes(plan.Height), b)
+		if err != nil {
+			return err
+		}
+		var keys [][]byte
+		c := bkt.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+		for len(keys) > maxPaymentPlans {
+			err = bkt.Delete(keys[0])
+			if err != nil {
+				return err
+			}
+			keys = keys[1:]
+		}
+		return nil
+	})
+}
+
+// FetchLatestPaymentPlan fetches the most recent payment plan recorded by a
+// payment dry run. An ErrValueNotFound error is returned if no plan has
+// been recorded.
+func FetchLatestPaymentPlan(db *bolt.DB) (*PaymentPlan, error) {
+	var plan PaymentPlan
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchPaymentPlanBucket(tx)
+		if err != nil {
+			return err
+		}
+		k, v := bkt.Cursor().Last()
+		if k == nil {
+			desc := "no payment plan found"
+			return MakeError(ErrValueNotFound, desc, nil)
+		}
+		return json.Unmarshal(v, &plan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// planPayments evaluates the payment cycle at the provided height like
+// processDividends does and records the payments it would dispatch as a
+// payment plan. The payment cycle, quarantines, tx fee reserve, payment
+// requests and dispatch states are left untouched so a later payment
+// cycle dispatches the planned payments. No plan is recorded if there are
+// no payments to dispatch.
+func (pm *PaymentMgr) planPayments(height uint32) error {
+	eligiblePmts, err := pm.fetchEligiblePaymentBundles(height)
+	if err != nil {
+		return err
+	}
+	plan := &PaymentPlan{
+		Height:      height,
+		CreatedOn:   time.Now().UnixNano(),
+		Accounts:    make(map[string]dcrutil.Amount),
+		Quarantined: make(map[string]string),
+	}
+	valid := eligiblePmts[:0]
+	for _, bundle := range eligiblePmts {
+		reason, err := pm.invalidPayoutReason(bundle)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			plan.Quarantined[bundle.Account] = reason
+			continue
+		}
+		valid = append(valid, bundle)
+	}
+	if len(valid) == 0 && len(plan.Quarantined) == 0 {
+		return nil
+	}
+
+	addr := pm.config().PoolFeeAddrs[rand.Intn(len(pm.config().PoolFeeAddrs))]
+	plan.PoolFeeAddress = addr.String()
+	chunks := chunkPaymentBundles(valid, pm.config().MaxPaymentOutputs,
+		pm.config().MaxPaymentTxSize)
+	txFeeReserve := pm.fetchTxFeeReserve()
+	for _, chunk := range chunks {
+		for _, bundle := range chunk {
+			switch bundle.Account {
+			case poolFeesK:
+				plan.PoolFee += bundle.Total()
+			case donationsK:
+				plan.Donations += bundle.Total()
+			default:
+				plan.Accounts[bundle.Account] += bundle.Total()
+			}
+			plan.Required += bundle.Total()
+		}
+		pmts, targetAmt, reserve, err := pm.paymentOutputs(chunk, addr,
+			txFeeReserve)
+		if err != nil {
+			return err
+		}
+		txFeeReserve = reserve
+		if len(pmts) == 0 {
+			continue
+		}
+		size := paymentTxOverhead + len(chunk)*p2pkhOutputSize
+		ptx := &PlannedTransaction{
+			Outputs:       make(map[string]dcrutil.Amount, len(pmts)),
+			Target:        targetAmt,
+			EstimatedSize: uint32(size),
+			EstimatedFee: txrules.FeeForSerializeSize(
+				mempool.DefaultMinRelayTxFee, size),
+		}
+		for dest, amt := range pmts {
+			ptx.Outputs[dest.String()] = amt
+		}
+		plan.Transactions = append(plan.Transactions, ptx)
+	}
+	plan.EstimatedFees = estimatePaymentFees(chunks)
+	plan.Required += plan.EstimatedFees
+	plan.TxFeeReserve = txFeeReserve
+	if len(chunks) > 0 && pm.config().FetchSpendableBalance != nil {
+		plan.Spendable, err = pm.config().FetchSpendableBalance()
+		if err != nil {
+			return fmt.Errorf("unable to fetch spendable balance: %v", err)
+		}
+		plan.Deferred = plan.Spendable < plan.Required
+	}
+
+	err = persistPaymentPlan(pm.config().DB, plan)
+	if err != nil {
+		return err
+	}
+	log.Infof("Planned payments at height #%d: %d account(s), pool fee "+
+		"of %v, %d transaction(s) with estimated fees of %v, %d "+
+		"quarantined account(s)", height, len(plan.Accounts), plan.PoolFee,
+		len(plan.Transactions), plan.EstimatedFees, len(plan.Quarantined))
+	if pm.config().NotifyPaymentPlanned != nil {
+		pm.config().NotifyPaymentPlanned(plan)
+	}
+	return nil
+}
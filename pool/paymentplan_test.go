@@ -0,0 +1,305 @@
+package pool
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+// snapshotDB returns the contents of every bucket of the pool database
+// other than the excluded buckets, keyed by bucket path and key.
+func snapshotDB(t *testing.T, db *bolt.DB, exclude ...[]byte) map[string]string {
+	snapshot := make(map[string]string)
+	var walk func(bkt *bolt.Bucket, path string) error
+	walk = func(bkt *bolt.Bucket, path string) error {
+		return bkt.ForEach(func(k, v []byte) error {
+			if v != nil {
+				snapshot[path+"/"+string(k)] = string(v)
+				return nil
+			}
+			for _, name := range exclude {
+				if string(k) == string(name) {
+					return nil
+				}
+			}
+			return walk(bkt.Bucket(k), path+"/"+string(k))
+		})
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		return walk(tx.Bucket(poolBkt), string(poolBkt))
+	})
+	if err != nil {
+		t.Fatalf("unable to snapshot database: %v", err)
+	}
+	return snapshot
+}
+
+// paymentMgrState represents the in-memory payment state of a payment
+// manager.
+type paymentMgrState struct {
+	lastPaymentHeight    uint32
+	lastPaymentPaidOn    uint64
+	lastPaymentCreatedOn uint64
+	txFeeReserve         dcrutil.Amount
+	paymentReqs          map[string]struct{}
+	dispatchFail         *DispatchFailure
+	deferral             *PaymentDeferral
+}
+
+// snapshotPaymentMgr returns the in-memory payment state of the provided
+// payment manager.
+func snapshotPaymentMgr(mgr *PaymentMgr) *paymentMgrState {
+	state := &paymentMgrState{
+		lastPaymentHeight:    mgr.fetchLastPaymentHeight(),
+		lastPaymentPaidOn:    mgr.fetchLastPaymentPaidOn(),
+		lastPaymentCreatedOn: mgr.fetchLastPaymentCreatedOn(),
+		txFeeReserve:         mgr.fetchTxFeeReserve(),
+		paymentReqs:          make(map[string]struct{}),
+		dispatchFail:         mgr.fetchDispatchFailure(),
+		deferral:             mgr.fetchPaymentDeferral(),
+	}
+	mgr.paymentReqsMtx.RLock()
+	for id := range mgr.paymentReqs {
+		state.paymentReqs[id] = struct{}{}
+	}
+	mgr.paymentReqsMtx.RUnlock()
+	return state
+}
+
+func testPaymentPlan(t *testing.T, db *bolt.DB) {
+	activeNet := chaincfg.SimNetParams()
+	minPayment, err := dcrutil.NewAmount(2.0)
+	if err != nil {
+		t.Fatalf("[NewAmount] unexpected error: %v", err)
+	}
+	maxTxFeeReserve, err := dcrutil.NewAmount(0.1)
+	if err != nil {
+		t.Fatalf("[NewAmount] unexpected error: %v", err)
+	}
+	spendable, err := dcrutil.NewAmount(1000)
+	if err != nil {
+		t.Fatalf("[NewAmount] unexpected error: %v", err)
+	}
+	var publishCalls int
+	var payouts map[dcrutil.Address]dcrutil.Amount
+	var target dcrutil.Amount
+	mgr, err := NewPaymentMgr(&PaymentMgrConfig{
+		DB:              db,
+		ActiveNet:       activeNet,
+		PoolFee:         0.1,
+		PaymentMethod:   PPS,
+		MinPayment:      minPayment,
+		PoolFeeAddrs:    []dcrutil.Address{poolFeeAddrs},
+		MaxTxFeeReserve: maxTxFeeReserve,
+		PublishTransaction: func(pmts map[dcrutil.Address]dcrutil.Amount, targetAmt dcrutil.Amount) (string, error) {
+			publishCalls++
+			payouts = pmts
+			target = targetAmt
+			return "planned", nil
+		},
+		NotifyPaymentSent: func(string, dcrutil.Amount, uint32) {},
+		FetchSpendableBalance: func() (dcrutil.Amount, error) {
+			return spendable, nil
+		},
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatalf("[NewPaymentMgr] unexpected error: %v", err)
+	}
+
+	// Ensure fetching the latest payment plan fails when none has been
+	// recorded.
+	_, err = FetchLatestPaymentPlan(db)
+	if !IsError(err, ErrValueNotFound) {
+		t.Fatalf("expected a value not found error, got %v", err)
+	}
+
+	// Create mature payments for accounts X and Y and the pool fees, the
+	// payout address of account X is invalid.
+	weight := new(big.Rat).SetFloat64(1.0)
+	height := uint32(20)
+	blockHash := "00000000000000000000000000000000000000000000000000000000000000ab"
+	paymentMaturity := height + uint32(activeNet.CoinbaseMaturity)
+	before := time.Now().Add(-(time.Second * 5)).UnixNano()
+	for i := 0; i < 10; i++ {
+		err = persistShare(db, xID, weight, before+int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = persistShare(db, yID, weight, before+int64(10+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	coinbase, err := dcrutil.NewAmount(80)
+	if err != nil {
+		t.Fatalf("[NewAmount] unexpected error: %v", err)
+	}
+	err = mgr.generatePayments(height, blockHash, coinbase)
+	if err != nil {
+		t.Fatalf("[generatePayments] unexpected error: %v", err)
+	}
+	err = updateAccountAddress(db, xID, "invalid")
+	if err != nil {
+		t.Fatalf("[updateAccountAddress] unexpected error: %v", err)
+	}
+	mgr.setTxFeeReserve(maxTxFeeReserve / 2)
+	err = mgr.addPaymentRequest(yAddr)
+	if err != nil {
+		t.Fatalf("[addPaymentRequest] unexpected error: %v", err)
+	}
+
+	// Ensure a dry run records a payment plan and leaves the database and
+	// the payment state of the manager bit-identical.
+	dbBefore := snapshotDB(t, db, paymentPlanBkt)
+	stateBefore := snapshotPaymentMgr(mgr)
+	err = mgr.payDividends(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected dry run error: %v", err)
+	}
+	if publishCalls != 0 {
+		t.Fatalf("expected no published transactions, got %d", publishCalls)
+	}
+	dbAfter := snapshotDB(t, db, paymentPlanBkt)
+	if !reflect.DeepEqual(dbBefore, dbAfter) {
+		t.Fatal("expected the database to be unchanged by a dry run")
+	}
+	stateAfter := snapshotPaymentMgr(mgr)
+	if !reflect.DeepEqual(stateBefore, stateAfter) {
+		t.Fatalf("expected the payment state to be unchanged by a dry "+
+			"run, got %+v, want %+v", stateAfter, stateBefore)
+	}
+
+	plan, err := FetchLatestPaymentPlan(db)
+	if err != nil {
+		t.Fatalf("[FetchLatestPaymentPlan] unexpected error: %v", err)
+	}
+	if plan.Height != paymentMaturity {
+		t.Fatalf("expected a plan at height %d, got %d", paymentMaturity,
+			plan.Height)
+	}
+	if _, ok := plan.Quarantined[xID]; !ok || len(plan.Quarantined) != 1 {
+		t.Fatalf("expected account %s to be quarantined, got %v", xID,
+			plan.Quarantined)
+	}
+	if _, ok := plan.Accounts[yID]; !ok || len(plan.Accounts) != 1 {
+		t.Fatalf("expected a planned payment to account %s, got %v", yID,
+			plan.Accounts)
+	}
+	if plan.PoolFee == 0 {
+		t.Fatal("expected a planned pool fee")
+	}
+	if len(plan.Transactions) != 1 {
+		t.Fatalf("expected 1 planned transaction, got %d",
+			len(plan.Transactions))
+	}
+	if plan.Spendable != spendable || plan.Deferred {
+		t.Fatalf("expected a covered payment cycle, got spendable %v and "+
+			"deferred %v", plan.Spendable, plan.Deferred)
+	}
+
+	// Ensure the real run dispatches the planned payments.
+	mgr.cfg.DryRun = false
+	err = mgr.payDividends(paymentMaturity)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	if publishCalls != 1 {
+		t.Fatalf("expected 1 published transaction, got %d", publishCalls)
+	}
+	planned := plan.Transactions[0]
+	if target != planned.Target {
+		t.Fatalf("expected a target amount of %v, got %v", planned.Target,
+			target)
+	}
+	if len(payouts) != len(planned.Outputs) {
+		t.Fatalf("expected %d payouts, got %d", len(planned.Outputs),
+			len(payouts))
+	}
+	for addr, amt := range payouts {
+		if planned.Outputs[addr.String()] != amt {
+			t.Fatalf("expected a payout of %v to %s, got %v",
+				planned.Outputs[addr.String()], addr, amt)
+		}
+	}
+	if mgr.fetchTxFeeReserve() != plan.TxFeeReserve {
+		t.Fatalf("expected a tx fee reserve of %v, got %v",
+			plan.TxFeeReserve, mgr.fetchTxFeeReserve())
+	}
+
+	// Ensure only the most recent payment plans are kept.
+	for i := uint32(0); i <= maxPaymentPlans; i++ {
+		err = persistPaymentPlan(db, &PaymentPlan{Height: i + 1000})
+		if err != nil {
+			t.Fatalf("[persistPaymentPlan] unexpected error: %v", err)
+		}
+	}
+	var plans int
+	err = db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchPaymentPlanBucket(tx)
+		if err != nil {
+			return err
+		}
+		plans = bkt.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to count payment plans: %v", err)
+	}
+	if plans != maxPaymentPlans {
+		t.Fatalf("expected %d payment plans, got %d", maxPaymentPlans, plans)
+	}
+	plan, err = FetchLatestPaymentPlan(db)
+	if err != nil {
+		t.Fatalf("[FetchLatestPaymentPlan] unexpected error: %v", err)
+	}
+	if plan.Height != maxPaymentPlans+1000 {
+		t.Fatalf("expected the latest plan at height %d, got %d",
+			maxPaymentPlans+1000, plan.Height)
+	}
+
+	err = updateAccountAddress(db, xID, xAddr)
+	if err != nil {
+		t.Fatalf("[updateAccountAddress] unexpected error: %v", err)
+	}
+	for _, bkt := range [][]byte{shareBkt, paymentBkt, paymentArchiveBkt,
+		paymentTotalBkt, paymentPlanBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+
+	// Reset backed up values to their defaults.
+	mgr.setLastPaymentHeight(0)
+	mgr.setLastPaymentPaidOn(0)
+	mgr.setLastPaymentCreatedOn(0)
+	mgr.setTxFeeReserve(0)
+	err = resetTestDB(db)
+	if err != nil {
+		t.Fatalf("[resetTestDB] unexpected error: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		err := mgr.persistLastPaymentHeight(tx)
+		if err != nil {
+			return err
+		}
+		err = mgr.persistLastPaymentPaidOn(tx)
+		if err != nil {
+			return err
+		}
+		err = mgr.persistLastPaymentCreatedOn(tx)
+		if err != nil {
+			return err
+		}
+		return mgr.persistTxFeeReserve(tx)
+	})
+	if err != nil {
+		t.Fatalf("unable to persist default payment values: %v", err)
+	}
+}
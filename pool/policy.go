@@ -0,0 +1,49 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"fmt"
+
+	"github.com/Eacred/eacrd/chaincfg"
+)
+
+const (
+	// PolicyAllow accepts the miner type and rewards its shares.
+	PolicyAllow = "allow"
+
+	// PolicyReject refuses authorization to the miner type.
+	PolicyReject = "reject"
+
+	// PolicyNoReward accepts the miner type without rewarding its shares.
+	PolicyNoReward = "noreward"
+)
+
+// ValidateMinerPolicy asserts the provided miner type is supported and the
+// provided policy is a known miner policy.
+func ValidateMinerPolicy(miner string, policy string) error {
+	err := ValidateMiner(miner)
+	if err != nil {
+		return err
+	}
+	switch policy {
+	case PolicyAllow, PolicyReject, PolicyNoReward:
+		return nil
+	default:
+		desc := fmt.Sprintf("unknown miner policy %s, expected one of "+
+			"%s, %s or %s", policy, PolicyAllow, PolicyReject, PolicyNoReward)
+		return MakeError(ErrOther, desc, nil)
+	}
+}
+
+// defaultMinerPolicy returns the policy applied to the provided miner type
+// when none is configured. CPU miners are reserved for testing and are
+// rejected on mainnet.
+func defaultMinerPolicy(net *chaincfg.Params, miner string) string {
+	if miner == CPU && net.Name == chaincfg.MainNetParams().Name {
+		return PolicyReject
+	}
+	return PolicyAllow
+}
@@ -10,8 +10,8 @@ import (
 )
 
 var (
-	// testDB represents the database used in testing.
-	testDB = "testdb"
+	// testNet represents the network the pool tests run on.
+	testNet = chaincfg.SimNetParams()
 	// Account X address.
 	xAddr = "SsWKp7wtdTZYabYFYSc9cnxhwFEjA5g4pFc"
 	// Account X id.
@@ -20,45 +20,63 @@ var (
 	yAddr = "Ssp7J7TUmi5iPhoQnWYNGQbeGhu6V3otJcS"
 	// Account Y id.
 	yID = ""
-	// Pool fee address.
-	poolFeeAddrs, _ = dcrutil.DecodeAddress(
-		"SsnbEmxCVXskgTHXvf3rEa17NA39qQuGHwQ",
-		chaincfg.SimNetParams())
+	// Pool fee address, the fee address of the test hub.
+	poolFeeAddrs dcrutil.Address
 )
 
-// setupDB initializes the pool database.
-func setupDB() (*bolt.DB, error) {
-	os.Remove(testDB)
-	db, err := openDB(testDB)
+// setupTestHub creates the test hub the pool tests run against, mining on
+// the test network, and creates the accounts of the test addresses in its
+// database.
+func setupTestHub() (*TestHub, error) {
+	th, err := NewTestHub(&TestHubConfig{
+		ActiveNet: testNet,
+		GetWork: func() (string, error) {
+			return fastPathWorkE, nil
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = createBuckets(db)
+	db := th.Hub().db
+	poolFeeAddrs = th.Hub().cfg.PoolFeeAddrs[0]
+	xID, err = AccountID(xAddr, testNet)
 	if err != nil {
+		th.Close()
 		return nil, err
 	}
-	err = upgradeDB(db)
+	yID, err = AccountID(yAddr, testNet)
 	if err != nil {
+		th.Close()
 		return nil, err
 	}
-
-	xID, err = AccountID(xAddr, chaincfg.SimNetParams())
+	_, err = persistAccount(db, xAddr, testNet)
 	if err != nil {
+		th.Close()
 		return nil, err
 	}
-	yID, err = AccountID(yAddr, chaincfg.SimNetParams())
+	_, err = persistAccount(db, yAddr, testNet)
 	if err != nil {
+		th.Close()
 		return nil, err
 	}
-	_, err = persistAccount(db, xAddr, chaincfg.SimNetParams())
+	return th, nil
+}
+
+// resetTestDB purges the test database and recreates the accounts of the
+// test addresses, so subtests sharing it do not observe the pool state
+// left by earlier ones.
+func resetTestDB(db *bolt.DB) error {
+	err := purge(db)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	_, err = persistAccount(db, yAddr, chaincfg.SimNetParams())
-	if err != nil {
-		return nil, err
+	for _, addr := range []string{xAddr, yAddr} {
+		_, err = persistAccount(db, addr, testNet)
+		if err != nil {
+			return err
+		}
 	}
-	return db, err
+	return nil
 }
 
 // teardownDB closes the connection to the db and deletes the db file.
@@ -74,38 +92,110 @@ func teardownDB(db *bolt.DB, dbPath string) error {
 	return nil
 }
 
-// TestPool runs all pool related tests.
+// TestPool runs all pool related tests against the database of a simnet
+// test hub, each subsystem as a subtest so it can be run on its own with
+// -run TestPool/<subsystem>. Subtests run in order and share the database.
 func TestPool(t *testing.T) {
-	db, err := setupDB()
+	th, err := setupTestHub()
 	if err != nil {
 		t.Fatalf("setup error: %v", err)
 	}
-
-	td := func() {
-		err = teardownDB(db, testDB)
+	defer func() {
+		err := th.Close()
 		if err != nil {
 			t.Fatalf("teardown error: %v", err)
 		}
-	}
-
-	defer td()
+	}()
+	db := th.Hub().db
 
-	testInitDB(t)
-	testDatabase(t, db)
-	testAcceptedWork(t, db)
-	testAccount(t, db)
-	testJob(t, db)
-	testShares(t, db)
-	testLimiter(t)
-	testSharePercentages(t)
-	testCalculatePoolTarget(t)
-	testGeneratePaymentDetails(t, db)
-	testArchivedPaymentsFiltering(t, db)
-	testAccountPayments(t, db)
-	testDifficulty(t)
-	testEndpoint(t, db)
-	testClient(t, db)
-	testPaymentMgr(t, db)
-	testChainState(t, db)
-	testHub(t, db)
+	t.Run("InitDB", func(t *testing.T) { testInitDB(t) })
+	t.Run("Database", func(t *testing.T) { testDatabase(t, db) })
+	t.Run("ReadOnlyDB", func(t *testing.T) { testReadOnlyDB(t, db) })
+	t.Run("AcceptedWork", func(t *testing.T) { testAcceptedWork(t, db) })
+	t.Run("Account", func(t *testing.T) { testAccount(t, db) })
+	t.Run("Job", func(t *testing.T) { testJob(t, db) })
+	t.Run("Shares", func(t *testing.T) { testShares(t, db) })
+	t.Run("VerifyDB", func(t *testing.T) { testVerifyDB(t, db) })
+	t.Run("Limiter", func(t *testing.T) { testLimiter(t) })
+	t.Run("SharePercentages", func(t *testing.T) { testSharePercentages(t) })
+	t.Run("CalculatePoolTarget", func(t *testing.T) { testCalculatePoolTarget(t) })
+	t.Run("CalculatePayments", func(t *testing.T) { testCalculatePayments(t) })
+	t.Run("GeneratePaymentDetails", func(t *testing.T) { testGeneratePaymentDetails(t, db) })
+	t.Run("ChunkPaymentBundles", func(t *testing.T) { testChunkPaymentBundles(t) })
+	t.Run("ArchivedPaymentsFiltering", func(t *testing.T) { testArchivedPaymentsFiltering(t, db) })
+	t.Run("AccountPayments", func(t *testing.T) { testAccountPayments(t, db) })
+	t.Run("PaymentSources", func(t *testing.T) { testPaymentSources(t, db) })
+	t.Run("MergeAccounts", func(t *testing.T) { testMergeAccounts(t, db) })
+	t.Run("Difficulty", func(t *testing.T) { testDifficulty(t) })
+	t.Run("MinerProfiles", func(t *testing.T) { testMinerProfiles(t) })
+	t.Run("Endpoint", func(t *testing.T) { testEndpoint(t, db) })
+	t.Run("EndpointListenerRecovery", func(t *testing.T) { testEndpointListenerRecovery(t) })
+	t.Run("EndpointListenAddrs", func(t *testing.T) { testEndpointListenAddrs(t) })
+	t.Run("EndpointApplyConfig", func(t *testing.T) { testEndpointApplyConfig(t, db) })
+	t.Run("EndpointPause", func(t *testing.T) { testEndpointPause(t, db) })
+	t.Run("Client", func(t *testing.T) { testClient(t, db) })
+	t.Run("ClientRegistry", func(t *testing.T) { testClientRegistry(t, db) })
+	t.Run("WorkCoalescing", func(t *testing.T) { testWorkCoalescing(t) })
+	t.Run("DropRate", func(t *testing.T) { testDropRate(t) })
+	t.Run("ResponseDispatch", func(t *testing.T) { testResponseDispatch(t) })
+	t.Run("ConcurrentAuthorization", func(t *testing.T) { testConcurrentAuthorization(t, db) })
+	t.Run("AccountLock", func(t *testing.T) { testAccountLock(t, db) })
+	t.Run("AccountMetadata", func(t *testing.T) { testAccountMetadata(t, db) })
+	t.Run("SessionResumption", func(t *testing.T) { testSessionResumption(t, db) })
+	t.Run("DifficultyUpdates", func(t *testing.T) { testDifficultyUpdates(t) })
+	t.Run("ClientWriteTimeout", func(t *testing.T) { testClientWriteTimeout(t) })
+	t.Run("MessageQueueing", func(t *testing.T) { testMessageQueueing(t) })
+	t.Run("DisconnectReasons", func(t *testing.T) { testDisconnectReasons(t) })
+	t.Run("MessageSizeLimits", func(t *testing.T) { testMessageSizeLimits(t) })
+	t.Run("HexReversal", func(t *testing.T) { testHexReversal(t) })
+	t.Run("MessageValidation", func(t *testing.T) { testMessageValidation(t) })
+	t.Run("MessageIDs", func(t *testing.T) { testMessageIDs(t) })
+	t.Run("ExtraNonce2Size", func(t *testing.T) { testExtraNonce2Size(t) })
+	t.Run("StratumFixtures", func(t *testing.T) { testStratumFixtures(t) })
+	t.Run("WorkNotificationIntegrity", func(t *testing.T) { testWorkNotificationIntegrity(t) })
+	t.Run("InFlightBudget", func(t *testing.T) { testInFlightBudget(t) })
+	t.Run("RequestLimits", func(t *testing.T) { testRequestLimits(t) })
+	t.Run("SoloAttribution", func(t *testing.T) { testSoloAttribution(t) })
+	t.Run("BlockAccepted", func(t *testing.T) { testBlockAccepted(t, db) })
+	t.Run("SubmitResponses", func(t *testing.T) { testSubmitResponses(t, db) })
+	t.Run("MinerQuirks", func(t *testing.T) { testMinerQuirks(t, db) })
+	t.Run("SubmissionReplay", func(t *testing.T) { testSubmissionReplay(t, db) })
+	t.Run("NoncePartitioning", func(t *testing.T) { testNoncePartitioning(t) })
+	t.Run("AuthorizeResponses", func(t *testing.T) { testAuthorizeResponses(t, db) })
+	t.Run("SetOptionRequests", func(t *testing.T) { testSetOptionRequests(t, db) })
+	t.Run("AuthRejectCache", func(t *testing.T) { testAuthRejectCache(t) })
+	t.Run("WorkerNames", func(t *testing.T) { testWorkerNames(t, db) })
+	t.Run("InitialWork", func(t *testing.T) { testInitialWork(t, db) })
+	t.Run("WorkSequencing", func(t *testing.T) { testWorkSequencing(t, db) })
+	t.Run("SubmissionOrdering", func(t *testing.T) { testSubmissionOrdering(t, db) })
+	t.Run("LatencyRecorder", func(t *testing.T) { testLatencyRecorder(t) })
+	t.Run("EventBus", func(t *testing.T) { testEventBus(t) })
+	t.Run("ShareLog", func(t *testing.T) { testShareLog(t) })
+	t.Run("ConnectionAudit", func(t *testing.T) { testConnectionAudit(t, db) })
+	t.Run("MaintenanceScheduler", func(t *testing.T) { testMaintenanceScheduler(t, db) })
+	t.Run("FastPath", func(t *testing.T) { testFastPath(t, db) })
+	t.Run("AccountExport", func(t *testing.T) { testAccountExport(t, db) })
+	t.Run("AccountIDs", func(t *testing.T) { testAccountIDs(t, db) })
+	t.Run("LostBlock", func(t *testing.T) { testLostBlock(t, db) })
+	t.Run("BanList", func(t *testing.T) { testBanList(t, db) })
+	t.Run("DigestGenerator", func(t *testing.T) { testDigestGenerator(t, db) })
+	t.Run("JobRetainer", func(t *testing.T) { testJobRetainer(t, db) })
+	t.Run("JobRetainerPruning", func(t *testing.T) { testJobRetainerPruning(t) })
+	t.Run("StaleGrace", func(t *testing.T) { testStaleGrace(t, db) })
+	t.Run("ClockSkew", func(t *testing.T) { testClockSkew(t, db) })
+	t.Run("ConnChurn", func(t *testing.T) { testConnChurn(t) })
+	t.Run("Shutdown", func(t *testing.T) { testShutdown(t) })
+	t.Run("Captures", func(t *testing.T) { testCaptures(t) })
+	t.Run("PaymentMgr", func(t *testing.T) { testPaymentMgr(t, db) })
+	t.Run("PaymentPlan", func(t *testing.T) { testPaymentPlan(t, db) })
+	t.Run("ShareWindow", func(t *testing.T) { testShareWindow(t, db) })
+	t.Run("ShareBoundary", func(t *testing.T) { testShareBoundary(t, db) })
+	t.Run("Notifier", func(t *testing.T) { testNotifier(t) })
+	t.Run("WorkerMonitor", func(t *testing.T) { testWorkerMonitor(t, db) })
+	t.Run("MinerStatsTracker", func(t *testing.T) { testMinerStatsTracker(t, db) })
+	t.Run("StatsRecorder", func(t *testing.T) { testStatsRecorder(t, db) })
+	t.Run("ChainState", func(t *testing.T) { testChainState(t, db) })
+	t.Run("ChainStateResync", func(t *testing.T) { testChainStateResync(t, db) })
+	t.Run("DistributableReward", func(t *testing.T) { testDistributableReward(t) })
+	t.Run("Hub", func(t *testing.T) { testHub(t, db) })
 }
@@ -0,0 +1,471 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// MinerProfile represents the stratum behavior of a miner type. Every
+// supported miner type is described by a registered profile, the quirks of
+// miners deviating from the stratum spec are confined to their profiles.
+type MinerProfile interface {
+	// Miner returns the miner type described by the profile.
+	Miner() string
+
+	// HashRate returns the nominal hash rate of the miner type, in hashes
+	// per second, its pool difficulties are derived from.
+	HashRate() *big.Int
+
+	// ShareWeight returns the weight of a share of the miner type relative
+	// to the lowest hash rate miner.
+	ShareWeight() *big.Rat
+
+	// ExtraNonce2Size returns the extraNonce2 size granted to a miner
+	// requesting the provided size, zero if none was requested.
+	ExtraNonce2Size(requested uint64) int
+
+	// SubscribeResponse creates the mining.subscribe response granting the
+	// provided extraNonce1 and extraNonce2 size.
+	SubscribeResponse(id uint64, notifyID string, extraNonce1 string, extraNonce2Size int) *Response
+
+	// FormatWorkNotification transforms the provided work notification of
+	// the pool into the format expected by the miner.
+	FormatWorkNotification(req *Request) (*Request, error)
+
+	// RestoreWorkNotification reverses FormatWorkNotification, returning
+	// the work notification of the pool the provided formatted work
+	// notification was created from.
+	RestoreWorkNotification(req *Request) (*Request, error)
+
+	// ValidateExtraNonce2 asserts the provided extraNonce2 of a
+	// mining.submit request is valid for the granted extraNonce2 size.
+	ValidateExtraNonce2(extraNonce2 string, extraNonce2Size int) error
+
+	// SolveHeader writes the provided extraNonce1 along with the
+	// extraNonce2, nTime and nonce of a mining.submit request into the
+	// provided hex encoded block header of the job the work was submitted
+	// for.
+	SolveHeader(headerE []byte, extraNonce1 string, extraNonce2 string, extraNonce2Size int, nTime string, nonce string) error
+}
+
+// minerProfiles represents the registered miner profiles keyed by miner
+// type.
+var minerProfiles = make(map[string]MinerProfile)
+
+func init() {
+	for _, profile := range []MinerProfile{
+		cpuProfile{},
+		innosiliconD9Profile{},
+		&antminerProfile{
+			miner:    AntminerDR3,
+			hashRate: new(big.Int).SetInt64(7.8e12),
+			weight:   new(big.Rat).SetFloat64(7.091),
+		},
+		&antminerProfile{
+			miner:    AntminerDR5,
+			hashRate: new(big.Int).SetInt64(35e12),
+			weight:   new(big.Rat).SetFloat64(31.181),
+		},
+		whatsminerD1Profile{},
+	} {
+		addMinerProfile(profile)
+	}
+}
+
+// addMinerProfile registers the provided miner profile.
+func addMinerProfile(profile MinerProfile) {
+	miner := profile.Miner()
+	minerProfiles[miner] = profile
+	minerHashes[miner] = profile.HashRate()
+	ShareWeights[miner] = profile.ShareWeight()
+}
+
+// RegisterMinerProfile registers the provided profile of an additional
+// miner type. The difficulties, policies and stats of miner types are set
+// up when the hub is created, profiles must be registered before. It is
+// not safe to register profiles while a hub is running.
+func RegisterMinerProfile(profile MinerProfile) error {
+	if profile == nil {
+		desc := "no miner profile provided"
+		return MakeError(ErrOther, desc, nil)
+	}
+	miner := profile.Miner()
+	if miner == "" || strings.TrimSpace(miner) != miner ||
+		strings.ToLower(miner) != miner {
+		desc := fmt.Sprintf("invalid miner type %q, expected a non-empty "+
+			"lowercase name", miner)
+		return MakeError(ErrOther, desc, nil)
+	}
+	if _, ok := minerProfiles[miner]; ok {
+		desc := fmt.Sprintf("miner type %s is already registered", miner)
+		return MakeError(ErrOther, desc, nil)
+	}
+	hashRate := profile.HashRate()
+	if hashRate == nil || hashRate.Sign() <= 0 {
+		desc := fmt.Sprintf("hash rate of miner type %s must be positive",
+			miner)
+		return MakeError(ErrOther, desc, nil)
+	}
+	weight := profile.ShareWeight()
+	if weight == nil || weight.Sign() <= 0 {
+		desc := fmt.Sprintf("share weight of miner type %s must be positive",
+			miner)
+		return MakeError(ErrOther, desc, nil)
+	}
+	addMinerProfile(profile)
+	return nil
+}
+
+// fetchMinerProfile returns the registered profile of the provided miner
+// type.
+func fetchMinerProfile(miner string) (MinerProfile, bool) {
+	profile, ok := minerProfiles[miner]
+	return profile, ok
+}
+
+// clampExtraNonce2Size returns the extraNonce2 size granted to a miner
+// respecting the extraNonce2Size provided that requested the provided size,
+// zero if none was requested. Requested sizes are clamped to the supported
+// range.
+func clampExtraNonce2Size(requested uint64) int {
+	switch {
+	case requested == 0:
+		return ExtraNonce2Size
+	case requested < MinExtraNonce2Size:
+		return MinExtraNonce2Size
+	case requested > MaxExtraNonce2Size:
+		return MaxExtraNonce2Size
+	default:
+		return int(requested)
+	}
+}
+
+// validateExtraNonce2Size asserts the provided granted extraNonce2 size is
+// within the supported range.
+func validateExtraNonce2Size(extraNonce2Size int) error {
+	if extraNonce2Size < MinExtraNonce2Size ||
+		extraNonce2Size > MaxExtraNonce2Size {
+		desc := fmt.Sprintf("extraNonce2 size %d is not between %d "+
+			"and %d", extraNonce2Size, MinExtraNonce2Size,
+			MaxExtraNonce2Size)
+		return MakeError(ErrOther, desc, nil)
+	}
+	return nil
+}
+
+// validateExtraNonce2Length asserts the provided extraNonce2 is of the
+// provided size.
+func validateExtraNonce2Length(extraNonce2 string, extraNonce2Size int) error {
+	if len(extraNonce2) != extraNonce2Size*2 {
+		desc := fmt.Sprintf("extraNonce2 %s is not %d bytes",
+			extraNonce2, extraNonce2Size)
+		return MakeError(ErrParse, desc, nil)
+	}
+	return nil
+}
+
+// reverseWorkNotification reverses the words of the previous block hash
+// of the provided work notification, along with the bytes of its nBits and
+// nTime if requested. Both reversals are their own inverse.
+func reverseWorkNotification(req *Request, reverseFields bool) (*Request, error) {
+	jobID, prevBlock, genTx1, genTx2, blockVersion, nBits, nTime,
+		cleanJob, err := ParseWorkNotification(req)
+	if err != nil {
+		return nil, err
+	}
+	if reverseFields {
+		nBits, err = hexReversed(nBits)
+		if err != nil {
+			return nil, err
+		}
+		nTime, err = hexReversed(nTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	prevBlockRev := reversePrevBlockWords(prevBlock)
+	return WorkNotification(jobID, prevBlockRev, genTx1, genTx2,
+		blockVersion, nBits, nTime, cleanJob), nil
+}
+
+// solveReversedHeader writes the provided big endian nTime and nonce of a
+// mining.submit request into the provided hex encoded block header as
+// little endian.
+func solveReversedHeader(headerE []byte, nTime string, nonce string) error {
+	nTimeRev, err := hexReversed(nTime)
+	if err != nil {
+		return err
+	}
+	copy(headerE[272:280], []byte(nTimeRev))
+
+	nonceRev, err := hexReversed(nonce)
+	if err != nil {
+		return err
+	}
+	copy(headerE[280:288], []byte(nonceRev))
+	return nil
+}
+
+// cpuProfile represents the profile of the CPU miner, reserved for testing.
+// It follows the stratum spec and expects work in the pool's encoding.
+type cpuProfile struct{}
+
+// Miner returns the miner type described by the profile.
+func (cpuProfile) Miner() string {
+	return CPU
+}
+
+// HashRate returns the nominal hash rate of the miner type.
+func (cpuProfile) HashRate() *big.Int {
+	return new(big.Int).SetInt64(5e3)
+}
+
+// ShareWeight returns the weight of a share of the miner type.
+func (cpuProfile) ShareWeight() *big.Rat {
+	return new(big.Rat).SetFloat64(1.0)
+}
+
+// ExtraNonce2Size returns the extraNonce2 size granted to the miner.
+func (cpuProfile) ExtraNonce2Size(requested uint64) int {
+	return clampExtraNonce2Size(requested)
+}
+
+// SubscribeResponse creates the mining.subscribe response of the miner.
+func (cpuProfile) SubscribeResponse(id uint64, notifyID string, extraNonce1 string, extraNonce2Size int) *Response {
+	return SubscribeResponse(id, notifyID, extraNonce1, extraNonce2Size, nil)
+}
+
+// FormatWorkNotification returns the provided work notification unchanged.
+func (cpuProfile) FormatWorkNotification(req *Request) (*Request, error) {
+	return req, nil
+}
+
+// RestoreWorkNotification returns the provided work notification
+// unchanged.
+func (cpuProfile) RestoreWorkNotification(req *Request) (*Request, error) {
+	return req, nil
+}
+
+// ValidateExtraNonce2 asserts the extraNonce2 is of the granted size.
+func (cpuProfile) ValidateExtraNonce2(extraNonce2 string, extraNonce2Size int) error {
+	return validateExtraNonce2Length(extraNonce2, extraNonce2Size)
+}
+
+// SolveHeader writes the submitted work into the provided header. The
+// nTime and nonce submitted are little endian.
+func (cpuProfile) SolveHeader(headerE []byte, extraNonce1 string, extraNonce2 string, extraNonce2Size int, nTime string, nonce string) error {
+	err := validateExtraNonce2Size(extraNonce2Size)
+	if err != nil {
+		return err
+	}
+	copy(headerE[272:280], []byte(nTime))
+	copy(headerE[280:288], []byte(nonce))
+	copy(headerE[288:296], []byte(extraNonce1))
+	copy(headerE[296:296+extraNonce2Size*2], []byte(extraNonce2))
+	return nil
+}
+
+// innosiliconD9Profile represents the profile of the Innosilicon D9. The
+// D9 respects the extraNonce2Size specified in the mining.subscribe
+// response sent to it and the extraNonce2 value it submits is exclusively
+// the extraNonce2. It requires the nBits and nTime fields of a
+// mining.notify message as big endian and submits big endian nTime and
+// nonce values.
+type innosiliconD9Profile struct{}
+
+// Miner returns the miner type described by the profile.
+func (innosiliconD9Profile) Miner() string {
+	return InnosiliconD9
+}
+
+// HashRate returns the nominal hash rate of the miner type.
+func (innosiliconD9Profile) HashRate() *big.Int {
+	return new(big.Int).SetInt64(2.4e12)
+}
+
+// ShareWeight returns the weight of a share of the miner type.
+func (innosiliconD9Profile) ShareWeight() *big.Rat {
+	return new(big.Rat).SetFloat64(2.182)
+}
+
+// ExtraNonce2Size returns the extraNonce2 size granted to the miner.
+func (innosiliconD9Profile) ExtraNonce2Size(requested uint64) int {
+	return clampExtraNonce2Size(requested)
+}
+
+// SubscribeResponse creates the mining.subscribe response of the miner.
+func (innosiliconD9Profile) SubscribeResponse(id uint64, notifyID string, extraNonce1 string, extraNonce2Size int) *Response {
+	return SubscribeResponse(id, notifyID, extraNonce1, extraNonce2Size, nil)
+}
+
+// FormatWorkNotification reverses the previous block hash words along with
+// the nBits and nTime of the provided work notification.
+func (innosiliconD9Profile) FormatWorkNotification(req *Request) (*Request, error) {
+	return reverseWorkNotification(req, true)
+}
+
+// RestoreWorkNotification reverses FormatWorkNotification.
+func (innosiliconD9Profile) RestoreWorkNotification(req *Request) (*Request, error) {
+	return reverseWorkNotification(req, true)
+}
+
+// ValidateExtraNonce2 asserts the extraNonce2 is of the granted size.
+func (innosiliconD9Profile) ValidateExtraNonce2(extraNonce2 string, extraNonce2Size int) error {
+	return validateExtraNonce2Length(extraNonce2, extraNonce2Size)
+}
+
+// SolveHeader writes the submitted work into the provided header.
+func (innosiliconD9Profile) SolveHeader(headerE []byte, extraNonce1 string, extraNonce2 string, extraNonce2Size int, nTime string, nonce string) error {
+	err := validateExtraNonce2Size(extraNonce2Size)
+	if err != nil {
+		return err
+	}
+	err = solveReversedHeader(headerE, nTime, nonce)
+	if err != nil {
+		return err
+	}
+	copy(headerE[288:296], []byte(extraNonce1))
+	copy(headerE[296:296+extraNonce2Size*2], []byte(extraNonce2))
+	return nil
+}
+
+// antminerProfile represents the profile of the Antminer DR3 and DR5. They
+// are not fully compliant with the stratum spec and use an 8-byte
+// extraNonce2 regardless of the extraNonce2Size provided. They return a
+// 12-byte extraNonce comprised of the extraNonce1 and extraNonce2, require
+// the nBits and nTime fields of a mining.notify message as big endian and
+// submit big endian nTime and nonce values.
+type antminerProfile struct {
+	miner    string
+	hashRate *big.Int
+	weight   *big.Rat
+}
+
+// Miner returns the miner type described by the profile.
+func (p *antminerProfile) Miner() string {
+	return p.miner
+}
+
+// HashRate returns the nominal hash rate of the miner type.
+func (p *antminerProfile) HashRate() *big.Int {
+	return new(big.Int).Set(p.hashRate)
+}
+
+// ShareWeight returns the weight of a share of the miner type.
+func (p *antminerProfile) ShareWeight() *big.Rat {
+	return new(big.Rat).Set(p.weight)
+}
+
+// ExtraNonce2Size returns the 8-byte extraNonce2 size used by the miner.
+func (p *antminerProfile) ExtraNonce2Size(uint64) int {
+	return 8
+}
+
+// SubscribeResponse creates the mining.subscribe response of the miner.
+// The extraNonce1 is appended to the extraNonce2 in the extraNonce2 value
+// returned in mining.submit. As a result, the extraNonce1 sent in the
+// mining.subscribe response is formatted as:
+// 	extraNonce2 space (8-byte) + miner's extraNonce1 (4-byte)
+func (p *antminerProfile) SubscribeResponse(id uint64, notifyID string, extraNonce1 string, extraNonce2Size int) *Response {
+	paddedExtraNonce1 := strings.Repeat("0", 16) + extraNonce1
+	return SubscribeResponse(id, notifyID, paddedExtraNonce1, 8, nil)
+}
+
+// FormatWorkNotification reverses the previous block hash words along with
+// the nBits and nTime of the provided work notification.
+func (p *antminerProfile) FormatWorkNotification(req *Request) (*Request, error) {
+	return reverseWorkNotification(req, true)
+}
+
+// RestoreWorkNotification reverses FormatWorkNotification.
+func (p *antminerProfile) RestoreWorkNotification(req *Request) (*Request, error) {
+	return reverseWorkNotification(req, true)
+}
+
+// ValidateExtraNonce2 accepts any extraNonce2, the miner does not respect
+// the extraNonce2 size granted.
+func (p *antminerProfile) ValidateExtraNonce2(string, int) error {
+	return nil
+}
+
+// SolveHeader writes the submitted work into the provided header.
+func (p *antminerProfile) SolveHeader(headerE []byte, extraNonce1 string, extraNonce2 string, extraNonce2Size int, nTime string, nonce string) error {
+	err := solveReversedHeader(headerE, nTime, nonce)
+	if err != nil {
+		return err
+	}
+	copy(headerE[288:312], []byte(extraNonce2))
+	return nil
+}
+
+// whatsminerD1Profile represents the profile of the Whatsminer D1. The D1
+// is not fully compliant with the stratum spec and uses a 4-byte
+// extraNonce2 regardless of the extraNonce2Size provided. The 8-byte
+// extraNonce it submits is for the extraNonce1 and extraNonce2. It requires
+// the nBits and nTime fields of a mining.notify message as little endian,
+// they are already in the preferred format, and submits big endian nTime
+// and nonce values.
+type whatsminerD1Profile struct{}
+
+// Miner returns the miner type described by the profile.
+func (whatsminerD1Profile) Miner() string {
+	return WhatsminerD1
+}
+
+// HashRate returns the nominal hash rate of the miner type.
+func (whatsminerD1Profile) HashRate() *big.Int {
+	return new(big.Int).SetInt64(48e12)
+}
+
+// ShareWeight returns the weight of a share of the miner type.
+func (whatsminerD1Profile) ShareWeight() *big.Rat {
+	return new(big.Rat).SetFloat64(43.636)
+}
+
+// ExtraNonce2Size returns the 4-byte extraNonce2 size used by the miner.
+func (whatsminerD1Profile) ExtraNonce2Size(uint64) int {
+	return ExtraNonce2Size
+}
+
+// SubscribeResponse creates the mining.subscribe response of the miner.
+// The extraNonce1 is appended to the extraNonce2 in the extraNonce2 value
+// returned in mining.submit. As a result, the extraNonce1 sent in the
+// mining.subscribe response is formatted as:
+// 	extraNonce2 space (4-byte) + miner's extraNonce1 (4-byte)
+func (whatsminerD1Profile) SubscribeResponse(id uint64, notifyID string, extraNonce1 string, extraNonce2Size int) *Response {
+	paddedExtraNonce1 := strings.Repeat("0", 8) + extraNonce1
+	return SubscribeResponse(id, notifyID, paddedExtraNonce1,
+		ExtraNonce2Size, nil)
+}
+
+// FormatWorkNotification reverses the previous block hash words of the
+// provided work notification.
+func (whatsminerD1Profile) FormatWorkNotification(req *Request) (*Request, error) {
+	return reverseWorkNotification(req, false)
+}
+
+// RestoreWorkNotification reverses FormatWorkNotification.
+func (whatsminerD1Profile) RestoreWorkNotification(req *Request) (*Request, error) {
+	return reverseWorkNotification(req, false)
+}
+
+// ValidateExtraNonce2 accepts any extraNonce2, the miner does not respect
+// the extraNonce2 size granted.
+func (whatsminerD1Profile) ValidateExtraNonce2(string, int) error {
+	return nil
+}
+
+// SolveHeader writes the submitted work into the provided header.
+func (whatsminerD1Profile) SolveHeader(headerE []byte, extraNonce1 string, extraNonce2 string, extraNonce2Size int, nTime string, nonce string) error {
+	err := solveReversedHeader(headerE, nTime, nonce)
+	if err != nil {
+		return err
+	}
+	copy(headerE[288:304], []byte(extraNonce2))
+	return nil
+}
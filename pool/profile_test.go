@@ -0,0 +1,186 @@
+package pool
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/Eacred/eacrd/chaincfg"
+)
+
+// quirkMiner represents the miner type of quirkProfile.
+const quirkMiner = "quirkminer"
+
+// quirkProfile represents a miner following the stratum spec like the CPU
+// miner, except for using a 6-byte extraNonce2 regardless of the
+// extraNonce2Size provided and expecting the nTime of work notifications
+// big endian.
+type quirkProfile struct {
+	cpuProfile
+}
+
+func (quirkProfile) Miner() string {
+	return quirkMiner
+}
+
+func (quirkProfile) ShareWeight() *big.Rat {
+	return new(big.Rat).SetInt64(3)
+}
+
+func (quirkProfile) ExtraNonce2Size(uint64) int {
+	return 6
+}
+
+func (quirkProfile) ValidateExtraNonce2(string, int) error {
+	return nil
+}
+
+func (p quirkProfile) FormatWorkNotification(req *Request) (*Request, error) {
+	jobID, prevBlock, genTx1, genTx2, blockVersion, nBits, nTime,
+		cleanJob, err := ParseWorkNotification(req)
+	if err != nil {
+		return nil, err
+	}
+	nTime, err = hexReversed(nTime)
+	if err != nil {
+		return nil, err
+	}
+	return WorkNotification(jobID, prevBlock, genTx1, genTx2,
+		blockVersion, nBits, nTime, cleanJob), nil
+}
+
+func (p quirkProfile) RestoreWorkNotification(req *Request) (*Request, error) {
+	return p.FormatWorkNotification(req)
+}
+
+func (quirkProfile) SolveHeader(headerE []byte, extraNonce1 string, extraNonce2 string, extraNonce2Size int, nTime string, nonce string) error {
+	copy(headerE[272:280], []byte(nTime))
+	copy(headerE[280:288], []byte(nonce))
+	copy(headerE[288:296], []byte(extraNonce1))
+	copy(headerE[296:308], []byte(extraNonce2))
+	return nil
+}
+
+func testMinerProfiles(t *testing.T) {
+	// Ensure invalid and duplicate profiles are refused.
+	for _, profile := range []MinerProfile{nil, cpuProfile{},
+		&antminerProfile{miner: "Quirk", hashRate: big.NewInt(1),
+			weight: big.NewRat(1, 1)},
+		&antminerProfile{miner: "quirk", hashRate: big.NewInt(0),
+			weight: big.NewRat(1, 1)},
+		&antminerProfile{miner: "quirk", hashRate: big.NewInt(1),
+			weight: new(big.Rat)}} {
+		err := RegisterMinerProfile(profile)
+		if err == nil {
+			t.Fatalf("expected profile %v to be refused", profile)
+		}
+	}
+	if err := ValidateMiner("quirk"); err == nil {
+		t.Fatal("expected refused profiles to not be registered")
+	}
+
+	// Ensure the profile of an additional miner type is used wherever
+	// miner types are resolved.
+	err := RegisterMinerProfile(quirkProfile{})
+	if err != nil {
+		t.Fatalf("[RegisterMinerProfile] unexpected error: %v", err)
+	}
+	defer func() {
+		delete(minerProfiles, quirkMiner)
+		delete(minerHashes, quirkMiner)
+		delete(ShareWeights, quirkMiner)
+	}()
+	err = ValidateMiner(quirkMiner)
+	if err != nil {
+		t.Fatalf("[ValidateMiner] unexpected error: %v", err)
+	}
+	if ShareWeights[quirkMiner].Cmp(big.NewRat(3, 1)) != 0 {
+		t.Fatalf("expected a share weight of 3, got %v",
+			ShareWeights[quirkMiner])
+	}
+	powLimit := chaincfg.SimNetParams().PowLimit
+	poolDiffs, err := NewDifficultySet(chaincfg.SimNetParams(),
+		new(big.Rat).SetInt(powLimit), new(big.Int).SetUint64(20), 0)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error: %v", err)
+	}
+	quirkDiff, err := poolDiffs.fetchMinerDifficulty(quirkMiner)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	cpuDiff, err := poolDiffs.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	if quirkDiff.difficulty.Cmp(cpuDiff.difficulty) != 0 {
+		t.Fatalf("expected the cpu difficulty of %v, got %v",
+			cpuDiff.difficulty, quirkDiff.difficulty)
+	}
+
+	if size := grantExtraNonce2Size(quirkMiner, 12); size != 6 {
+		t.Fatalf("expected an extraNonce2 size of 6, got %d", size)
+	}
+	data, err := json.Marshal(minerSubscribeResponse(quirkMiner, 1, "nid",
+		"fe1a0000", 6))
+	if err != nil {
+		t.Fatalf("unable to encode subscribe response: %v", err)
+	}
+	msg, _, err := IdentifyMessage(data)
+	if err != nil {
+		t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	_, _, extraNonce1, size, err := ParseSubscribeResponse(msg.(*Response))
+	if err != nil {
+		t.Fatalf("[ParseSubscribeResponse] unexpected error: %v", err)
+	}
+	if extraNonce1 != "fe1a0000" || size != 6 {
+		t.Fatalf("unexpected subscribe response extraNonce1 %s and "+
+			"extraNonce2Size %d", extraNonce1, size)
+	}
+
+	workE := fastPathWorkE
+	notif := WorkNotification("job", workE[8:72], workE[72:288],
+		workE[352:360], workE[:8], workE[232:240], workE[272:280], true)
+	formatted, err := formatWorkNotification(quirkMiner, notif)
+	if err != nil {
+		t.Fatalf("[formatWorkNotification] unexpected error: %v", err)
+	}
+	_, _, _, _, _, _, nTime, _, err := ParseWorkNotification(formatted)
+	if err != nil {
+		t.Fatalf("[ParseWorkNotification] unexpected error: %v", err)
+	}
+	if nTime != "5dee4c95" {
+		t.Fatalf("expected a big endian nTime, got %s", nTime)
+	}
+	err = validateWorkNotification(quirkMiner, workE, formatted)
+	if err != nil {
+		t.Fatalf("[validateWorkNotification] unexpected error: %v", err)
+	}
+
+	id := uint64(1)
+	req, err := fastPathRequest(SubmitWorkRequest(&id, "tcl", "job",
+		"000000000001", "954cee5d", "00000001"))
+	if err != nil {
+		t.Fatalf("[fastPathRequest] unexpected error: %v", err)
+	}
+	_, _, extraNonce2, _, _, err := ParseSubmitWorkRequest(req, quirkMiner, 4)
+	if err != nil {
+		t.Fatalf("[ParseSubmitWorkRequest] unexpected error: %v", err)
+	}
+	header, err := GenerateSolvedBlockHeader(workE, "fe1a0000", extraNonce2,
+		6, "954cee5d", "00000001", quirkMiner)
+	if err != nil {
+		t.Fatalf("[GenerateSolvedBlockHeader] unexpected error: %v", err)
+	}
+	headerB, err := header.Bytes()
+	if err != nil {
+		t.Fatalf("[Bytes] unexpected error: %v", err)
+	}
+	extraNonce := hex.EncodeToString(headerB[144:])
+	if !strings.HasPrefix(extraNonce, "fe1a0000000000000001") {
+		t.Fatalf("expected the extraNonce of the submission, got %s",
+			extraNonce)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	// clientReconcileInterval is the interval between reconciliations of
+	// the client registry.
+	clientReconcileInterval = time.Minute
+
+	// clientShutdownGrace is the period a cancelled client is given to shut
+	// down before it is forcibly cleaned up.
+	clientShutdownGrace = time.Second * 30
+)
+
+// registryEntry represents a running client tracked by the registry.
+type registryEntry struct {
+	client      *Client
+	cancelledOn time.Time
+}
+
+// clientRegistry is the authoritative record of running pool clients.
+// Clients are registered when they start running and deregistered once
+// shut down, registered clients which were cancelled but never shut down
+// are found by reconciling the registry.
+type clientRegistry struct {
+	clients map[*Client]*registryEntry
+	closed  bool
+	mtx     sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// newClientRegistry creates an empty client registry.
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{
+		clients: make(map[*Client]*registryEntry),
+	}
+}
+
+// register records the provided client as running. It returns false if
+// the registry is closed, the client must not run in that case.
+func (r *clientRegistry) register(c *Client) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.closed {
+		return false
+	}
+	if _, ok := r.clients[c]; ok {
+		return true
+	}
+	r.clients[c] = &registryEntry{client: c}
+	r.wg.Add(1)
+	return true
+}
+
+// deregister removes the provided client from the registry, deregistering
+// an unregistered client is a no-op.
+func (r *clientRegistry) deregister(c *Client) {
+	r.mtx.Lock()
+	_, ok := r.clients[c]
+	delete(r.clients, c)
+	r.mtx.Unlock()
+	if ok {
+		r.wg.Done()
+	}
+}
+
+// count returns the number of registered clients.
+func (r *clientRegistry) count() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return len(r.clients)
+}
+
+// isRegistered returns if the provided client is registered.
+func (r *clientRegistry) isRegistered(c *Client) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, ok := r.clients[c]
+	return ok
+}
+
+// hasClient returns if a client with the provided id is registered.
+func (r *clientRegistry) hasClient(id string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for c := range r.clients {
+		if c.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile returns the registered clients which were cancelled longer
+// than the provided grace period ago, as of the provided time. Cancelled
+// clients are timestamped on the first reconciliation they are found in.
+func (r *clientRegistry) reconcile(now time.Time, grace time.Duration) []*Client {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	var stuck []*Client
+	for c, entry := range r.clients {
+		if c.ctx.Err() == nil {
+			continue
+		}
+		if entry.cancelledOn.IsZero() {
+			entry.cancelledOn = now
+		}
+		if now.Sub(entry.cancelledOn) >= grace {
+			stuck = append(stuck, c)
+		}
+	}
+	return stuck
+}
+
+// close prevents further registrations and cancels all registered
+// clients.
+func (r *clientRegistry) close() {
+	r.mtx.Lock()
+	r.closed = true
+	for c := range r.clients {
+		c.cancelWithReason(DisconnectShutdown)
+	}
+	r.mtx.Unlock()
+}
+
+// wait blocks until all registered clients are deregistered or the
+// provided timeout elapses. It returns false if the timeout elapsed.
+func (r *clientRegistry) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
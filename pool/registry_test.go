@@ -0,0 +1,276 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+func testClientRegistry(t *testing.T, db *bolt.DB) {
+	powLimit := chaincfg.SimNetParams().PowLimit
+	powLimitF, _ := new(big.Float).SetInt(powLimit).Float64()
+	iterations := math.Pow(2, 256-math.Floor(math.Log2(powLimitF)))
+	poolDiffs, err := NewDifficultySet(chaincfg.SimNetParams(),
+		new(big.Rat).SetInt(powLimit), new(big.Int).SetUint64(20), 0)
+	if err != nil {
+		t.Fatalf("[NewDifficultySet] unexpected error: %v", err)
+	}
+	diffInfo, err := poolDiffs.fetchMinerDifficulty(CPU)
+	if err != nil {
+		t.Fatalf("[fetchMinerDifficulty] unexpected error: %v", err)
+	}
+	connections := make(map[string]uint32)
+	var connectionsMtx sync.RWMutex
+	registry := newClientRegistry()
+	eCfg := &EndpointConfig{
+		ActiveNet:             chaincfg.SimNetParams(),
+		DB:                    db,
+		SoloPool:              true,
+		Blake256Pad:           generateBlake256Pad(),
+		NonceIterations:       iterations,
+		MaxConnectionsPerHost: 1000,
+		HubWg:                 new(sync.WaitGroup),
+		RegisterClient:        registry.register,
+		DeregisterClient:      registry.deregister,
+		SubmitWork: func(*string) (bool, string, error) {
+			return false, "", nil
+		},
+		FetchCurrentWork: func() *CurrentWork {
+			return &CurrentWork{}
+		},
+		WithinLimit: func(string, int, float64) bool {
+			return true
+		},
+		FetchMinerPolicy: func(string) string {
+			return PolicyAllow
+		},
+		WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+			return 0
+		},
+		IsTraced: func(string, string) bool {
+			return false
+		},
+		Sessions: NewSessionStore(),
+		AddConnection: func(host string) {
+			connectionsMtx.Lock()
+			connections[host]++
+			connectionsMtx.Unlock()
+		},
+		RemoveConnection: func(host string) {
+			connectionsMtx.Lock()
+			connections[host]--
+			connectionsMtx.Unlock()
+		},
+		FetchHostConnections: func(host string) uint32 {
+			connectionsMtx.RLock()
+			defer connectionsMtx.RUnlock()
+			return connections[host]
+		},
+		IsBanned: func(net.IP) bool {
+			return false
+		},
+		Events: NewEventBus(),
+	}
+	endpoint, err := NewEndpoint(eCfg, diffInfo, 3040, CPU)
+	if err != nil {
+		t.Fatalf("[NewEndpoint] unexpected error: %v", err)
+	}
+	hub := &Hub{
+		registry:  registry,
+		endpoints: []*Endpoint{endpoint},
+	}
+	endpoint.cfg.HubWg.Add(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	go endpoint.run(ctx)
+
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("[ListenTCP] unexpected error: %v", err)
+	}
+	defer ln.Close()
+	serverCh := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			serverCh <- conn
+		}
+	}()
+
+	// Connect clients which abruptly disconnect, send malformed data,
+	// complete a subscription or stay idle in random order.
+	rng := rand.New(rand.NewSource(871))
+	var remotes []net.Conn
+	var remotesMtx sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 60; i++ {
+		local, remote, err := makeConn(ln, serverCh)
+		if err != nil {
+			t.Fatalf("[makeConn] unexpected error: %v", err)
+		}
+		msg := &connection{
+			Conn: remote,
+			Done: make(chan bool),
+		}
+		endpoint.connCh <- msg
+		<-msg.Done
+		action := rng.Intn(4)
+		delay := time.Duration(rng.Intn(20)) * time.Millisecond
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(delay)
+			switch action {
+			case 0:
+				local.Close()
+			case 1:
+				local.Write([]byte("{\"id\": 1, \"method\": [}\n"))
+				local.Close()
+			case 2:
+				id := uint64(1)
+				data, _ := json.Marshal(SubscribeRequest(&id, "mcpu",
+					"1.0.1", ""))
+				local.Write(append(data, '\n'))
+				fallthrough
+			default:
+				remotesMtx.Lock()
+				remotes = append(remotes, local)
+				remotesMtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Wait for the clients of closed connections to shut down.
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		endpoint.clientsMtx.Lock()
+		connected := len(endpoint.clients)
+		endpoint.clientsMtx.Unlock()
+		if connected == len(remotes) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d connected clients, got %d", len(remotes),
+				connected)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// Inject clients cancelled without being shut down, one registered and
+	// one never registered.
+	stuck := make([]*Client, 0, 2)
+	for i := 0; i < 2; i++ {
+		local, remote, err := makeConn(ln, serverCh)
+		if err != nil {
+			t.Fatalf("[makeConn] unexpected error: %v", err)
+		}
+		defer local.Close()
+		tcpAddr := remote.RemoteAddr().(*net.TCPAddr)
+		cCfg := &ClientConfig{
+			ActiveNet:       eCfg.ActiveNet,
+			DB:              eCfg.DB,
+			Blake256Pad:     eCfg.Blake256Pad,
+			NonceIterations: eCfg.NonceIterations,
+			FetchMiner: func() string {
+				return CPU
+			},
+			DifficultyInfo:    diffInfo,
+			RegisterClient:    registry.register,
+			DeregisterClient:  registry.deregister,
+			RemoveClient:      endpoint.removeClient,
+			SubmitWork:        eCfg.SubmitWork,
+			FetchCurrentWork:  eCfg.FetchCurrentWork,
+			WithinLimit:       eCfg.WithinLimit,
+			HashCalcThreshold: hashCalcThreshold,
+			Events:            eCfg.Events,
+			FetchMinerPolicy: func() string {
+				return PolicyAllow
+			},
+			WorkSubsidy: eCfg.WorkSubsidy,
+			IsTraced:    eCfg.IsTraced,
+			Sessions:    eCfg.Sessions,
+		}
+		client, err := NewClient(remote, tcpAddr, cCfg)
+		if err != nil {
+			t.Fatalf("[NewClient] unexpected error: %v", err)
+		}
+		endpoint.acquireSlot()
+		endpoint.clientsMtx.Lock()
+		endpoint.clients[client.id] = client
+		endpoint.clientsMtx.Unlock()
+		eCfg.AddConnection(hostKey(tcpAddr.IP))
+		if i == 0 && !registry.register(client) {
+			t.Fatal("expected the client to register")
+		}
+		client.cancel()
+		stuck = append(stuck, client)
+	}
+
+	// Ensure only clients cancelled longer than the grace period are
+	// cleaned up by reconciliation.
+	now := time.Now()
+	if cleaned := hub.reconcileClients(now, time.Hour); cleaned != 1 {
+		t.Fatalf("expected the unregistered client to be cleaned up, "+
+			"got %d cleanups", cleaned)
+	}
+	if !registry.isRegistered(stuck[0]) {
+		t.Fatal("expected the registered client to remain within its grace")
+	}
+	if cleaned := hub.reconcileClients(now.Add(time.Hour), time.Hour); cleaned != 1 {
+		t.Fatalf("expected the registered client to be cleaned up, got "+
+			"%d cleanups", cleaned)
+	}
+	if registry.isRegistered(stuck[0]) {
+		t.Fatal("expected the cleaned up client to be deregistered")
+	}
+
+	// Ensure registration is refused once the registry is closed and
+	// shutdown does not block on connected clients.
+	cancel()
+	endpoint.cfg.HubWg.Wait()
+	registry.close()
+	if !registry.wait(time.Second * 5) {
+		t.Fatalf("expected all clients to shut down, %d registered",
+			registry.count())
+	}
+	if registry.register(stuck[0]) {
+		t.Fatal("expected registration to be refused once closed")
+	}
+	if count := registry.count(); count != 0 {
+		t.Fatalf("expected an empty registry, got %d clients", count)
+	}
+	endpoint.clientsMtx.Lock()
+	remaining := len(endpoint.clients)
+	endpoint.clientsMtx.Unlock()
+	if remaining != 0 {
+		t.Fatalf("expected no endpoint clients, got %d", remaining)
+	}
+	if slots := atomic.LoadInt32(&endpoint.numClients); slots != 0 {
+		t.Fatalf("expected all client slots released, got %d", slots)
+	}
+	connectionsMtx.RLock()
+	for host, count := range connections {
+		if count != 0 {
+			t.Fatalf("expected no connections for host %s, got %d",
+				host, count)
+		}
+	}
+	connectionsMtx.RUnlock()
+	for _, conn := range remotes {
+		conn.Close()
+	}
+}
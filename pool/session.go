@@ -0,0 +1,120 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	// sessionTTL represents the period the session of a disconnected client
+	// can be resumed for.
+	sessionTTL = time.Minute * 2
+)
+
+// session represents the subscription and authorization details of a
+// disconnected client.
+type session struct {
+	extraNonce1 string
+	miner       string
+	username    string
+	account     string
+	address     string
+	name        string
+	defaultName bool
+	counters    sessionCounters
+	expiry      time.Time
+}
+
+// sessionCounters represents the delivery counters of a disconnected
+// client, carried over to the client resuming its session.
+type sessionCounters struct {
+	coalesced     int64
+	dropped       int64
+	offered       int64
+	writeFailures int64
+}
+
+// SessionStore reserves the extraNonce1s of connected clients and keeps the
+// sessions of recently disconnected clients, keyed by their subscription
+// id, so reconnecting clients can resume them. The extraNonce1 of a session
+// stays reserved until the session is resumed or expires.
+type SessionStore struct {
+	reserved    map[string]struct{}
+	sessions    map[string]*session
+	sessionsMtx sync.Mutex
+}
+
+// NewSessionStore creates a session store.
+func NewSessionStore() *SessionStore {
+	return &SessionStore{
+		reserved: make(map[string]struct{}),
+		sessions: make(map[string]*session),
+	}
+}
+
+// pruneSessions removes expired sessions and releases their extraNonce1s.
+// This must be called with the sessions lock held.
+func (s *SessionStore) pruneSessions(now time.Time) {
+	for nid, sess := range s.sessions {
+		if now.After(sess.expiry) {
+			delete(s.sessions, nid)
+			delete(s.reserved, sess.extraNonce1)
+		}
+	}
+}
+
+// reserve reserves the provided extraNonce1, it returns false if the
+// extraNonce1 is already reserved.
+func (s *SessionStore) reserve(extraNonce1 string) bool {
+	s.sessionsMtx.Lock()
+	defer s.sessionsMtx.Unlock()
+	s.pruneSessions(time.Now())
+	if _, ok := s.reserved[extraNonce1]; ok {
+		return false
+	}
+	s.reserved[extraNonce1] = struct{}{}
+	return true
+}
+
+// release releases the provided extraNonce1.
+func (s *SessionStore) release(extraNonce1 string) {
+	s.sessionsMtx.Lock()
+	delete(s.reserved, extraNonce1)
+	s.sessionsMtx.Unlock()
+}
+
+// suspend keeps the provided session of a disconnected client for the
+// session ttl under the provided subscription id. The session's
+// extraNonce1 stays reserved while it is kept.
+func (s *SessionStore) suspend(nid string, sess *session) {
+	s.sessionsMtx.Lock()
+	defer s.sessionsMtx.Unlock()
+	now := time.Now()
+	s.pruneSessions(now)
+	if prev, ok := s.sessions[nid]; ok &&
+		prev.extraNonce1 != sess.extraNonce1 {
+		delete(s.reserved, prev.extraNonce1)
+	}
+	sess.expiry = now.Add(sessionTTL)
+	s.sessions[nid] = sess
+	s.reserved[sess.extraNonce1] = struct{}{}
+}
+
+// resume returns the unexpired session of the provided subscription id if
+// it was established by the provided miner type. The session is removed
+// from the store, its extraNonce1 stays reserved for the resuming client.
+func (s *SessionStore) resume(nid string, miner string) (*session, bool) {
+	s.sessionsMtx.Lock()
+	defer s.sessionsMtx.Unlock()
+	s.pruneSessions(time.Now())
+	sess, ok := s.sessions[nid]
+	if !ok || sess.miner != miner {
+		return nil, false
+	}
+	delete(s.sessions, nid)
+	return sess, true
+}
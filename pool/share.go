@@ -15,6 +15,8 @@ import (
 	bolt "github.com/coreos/bbolt"
 	"github.com/Eacred/eacrd/chaincfg"
 	"github.com/Eacred/eacrd/dcrutil"
+	"github.com/Eacred/eacrd/mempool"
+	txrules "github.com/Eacred/eacrwallet/wallet/txrules"
 )
 
 var (
@@ -28,27 +30,28 @@ var (
 // ShareWeights reprsents the associated weights for each known DCR miner.
 // With the share weight of the lowest hash DCR miner (LHM) being 1, the
 // rest were calculated as :
+//
 // 				(Hash of Miner X * Weight of LHM)/ Hash of LHM
-var ShareWeights = map[string]*big.Rat{
-	CPU: new(big.Rat).SetFloat64(1.0), // Reserved for testing.
-	// ObeliskDCR1:   new(big.Rat).SetFloat64(1.0),
-	InnosiliconD9: new(big.Rat).SetFloat64(2.182),
-	AntminerDR3:   new(big.Rat).SetFloat64(7.091),
-	AntminerDR5:   new(big.Rat).SetFloat64(31.181),
-	WhatsminerD1:  new(big.Rat).SetFloat64(43.636),
+//
+// The weights are populated from the registered miner profiles.
+var ShareWeights = make(map[string]*big.Rat)
+
+// powIterations returns the number of hashes expected to find a hash
+// meeting a difficulty of one on the provided network.
+func powIterations(net *chaincfg.Params) float64 {
+	powLimitFloat, _ := new(big.Float).SetInt(net.PowLimit).Float64()
+
+	// The number of possible iterations is calculated as:
+	//
+	//    iterations := 2^(256 - floor(log2(pow_limit)))
+	return math.Pow(2, 256-math.Floor(math.Log2(powLimitFloat)))
 }
 
 // calculatePoolDifficulty determines the difficulty at which the provided
 // hashrate can generate a pool share by the provided target time.
 func calculatePoolDifficulty(net *chaincfg.Params, hashRate *big.Int, targetTimeSecs *big.Int) *big.Rat {
 	hashesPerTargetTime := new(big.Int).Mul(hashRate, targetTimeSecs)
-	powLimit := net.PowLimit
-	powLimitFloat, _ := new(big.Float).SetInt(powLimit).Float64()
-
-	// The number of possible iterations is calculated as:
-	//
-	//    iterations := 2^(256 - floor(log2(pow_limit)))
-	iterations := math.Pow(2, 256-math.Floor(math.Log2(powLimitFloat)))
+	iterations := powIterations(net)
 
 	// The difficulty at which the provided hashrate can mine a block is
 	// calculated as:
@@ -95,6 +98,9 @@ type Share struct {
 	Account   string   `json:"account"`
 	Weight    *big.Rat `json:"weight"`
 	CreatedOn int64    `json:"createdOn"`
+	// Late represents if the share was credited for work of a superseded
+	// job within the stale grace period.
+	Late bool `json:"late,omitempty"`
 }
 
 // NewShare creates a share with the provided account and weight.
@@ -122,19 +128,126 @@ func fetchShareBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
 	return bkt, nil
 }
 
-// Create persists a share to the database.
+// fetchAccountShareBucket is a helper function for getting the account share
+// index bucket.
+func fetchAccountShareBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(accountShareBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(accountShareBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// accountShareKey returns the account share index key of the share of the
+// provided account with the provided key. Keys are prefixed by the account
+// id followed by the share key so the shares of an account are contiguous
+// and sorted by time.
+func accountShareKey(account string, key []byte) []byte {
+	k := make([]byte, 0, len(account)+len(key))
+	k = append(k, account...)
+	return append(k, key...)
+}
+
+// ShareBoundary represents the window of shares a payment batch was
+// calculated from, an auditor can recompute the batch exactly from the
+// shares within it. Bounds are inclusive share keys in nanoseconds.
+type ShareBoundary struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+
+	// LastShare represents the key of the last share within the window,
+	// it is zero if the window has no shares.
+	LastShare int64 `json:"lastshare"`
+}
+
+// fetchShareBoundary returns the end of the last share window marked, zero
+// if no window has been marked.
+func fetchShareBoundary(tx *bolt.Tx) (int64, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return 0, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	v := pbkt.Get(shareBoundaryK)
+	if v == nil {
+		return 0, nil
+	}
+	return int64(bigEndianBytesToNano(v)), nil
+}
+
+// markShareBoundary persists the end of the provided share window as the
+// share boundary and returns the shares within the window, setting the key
+// of the last one. Shares created at or before the boundary but persisted
+// after it is marked are moved past it, into the next window.
+func markShareBoundary(tx *bolt.Tx, boundary *ShareBoundary) ([]*Share, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt, err := fetchShareBucket(tx)
+	if err != nil {
+		return nil, err
+	}
+	shares := make([]*Share, 0)
+	max := nanoToBigEndianBytes(boundary.End)
+	c := bkt.Cursor()
+	for k, v := c.Seek(nanoToBigEndianBytes(boundary.Start)); k != nil &&
+		bytes.Compare(k, max) <= 0; k, v = c.Next() {
+		var share Share
+		err := json.Unmarshal(v, &share)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, &share)
+		boundary.LastShare = int64(bigEndianBytesToNano(k))
+	}
+	err = pbkt.Put(shareBoundaryK, max)
+	if err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// Create persists a share to the database. A share created at or before
+// the share boundary is keyed after it, since the window it was created in
+// has already been paid out.
 func (s *Share) Create(db *bolt.DB) error {
 	err := db.Update(func(tx *bolt.Tx) error {
 		bkt, err := fetchShareBucket(tx)
 		if err != nil {
 			return err
 		}
+		boundary, err := fetchShareBoundary(tx)
+		if err != nil {
+			return err
+		}
+		if s.CreatedOn <= boundary {
+			s.CreatedOn = boundary + 1
+			for bkt.Get(nanoToBigEndianBytes(s.CreatedOn)) != nil {
+				s.CreatedOn++
+			}
+		}
 		sBytes, err := json.Marshal(s)
 		if err != nil {
 			return err
 		}
-		err = bkt.Put(nanoToBigEndianBytes(s.CreatedOn), sBytes)
-		return err
+		key := nanoToBigEndianBytes(s.CreatedOn)
+		err = bkt.Put(key, sBytes)
+		if err != nil {
+			return err
+		}
+		ibkt, err := fetchAccountShareBucket(tx)
+		if err != nil {
+			return err
+		}
+		return ibkt.Put(accountShareKey(s.Account, key), []byte{})
 	})
 	return err
 }
@@ -214,6 +327,95 @@ func PPLNSEligibleShares(db *bolt.DB, min []byte) ([]*Share, error) {
 	return eligibleShares, err
 }
 
+// ShareSummary represents the shares submitted by an account within a
+// period.
+type ShareSummary struct {
+	Count     uint32   `json:"count"`
+	Weight    *big.Rat `json:"weight"`
+	LastShare int64    `json:"lastshare"`
+}
+
+// fetchShareSummaries summarizes the shares of each account created after
+// the provided nanosecond time. Only shares within the period are read.
+func fetchShareSummaries(db *bolt.DB, min int64) (map[string]*ShareSummary, error) {
+	summaries := make(map[string]*ShareSummary)
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchShareBucket(tx)
+		if err != nil {
+			return err
+		}
+		c := bkt.Cursor()
+		for k, v := c.Seek(nanoToBigEndianBytes(min)); k != nil; k, v = c.Next() {
+			var share Share
+			err := json.Unmarshal(v, &share)
+			if err != nil {
+				return err
+			}
+			summary, ok := summaries[share.Account]
+			if !ok {
+				summary = &ShareSummary{Weight: new(big.Rat)}
+				summaries[share.Account] = summary
+			}
+			summary.Count++
+			summary.Weight.Add(summary.Weight, share.Weight)
+			if share.CreatedOn > summary.LastShare {
+				summary.LastShare = share.CreatedOn
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// fetchAccountShareSummary summarizes the shares of the provided account
+// created after the provided nanosecond time. Only the shares of the account
+// within the period are read, through the account share index.
+func fetchAccountShareSummary(db *bolt.DB, id string, min int64) (*ShareSummary, error) {
+	summary := &ShareSummary{Weight: new(big.Rat)}
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchShareBucket(tx)
+		if err != nil {
+			return err
+		}
+		ibkt, err := fetchAccountShareBucket(tx)
+		if err != nil {
+			return err
+		}
+		prefix := []byte(id)
+		start := accountShareKey(id, nanoToBigEndianBytes(min))
+		c := ibkt.Cursor()
+		for k, _ := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			// Index entries of other accounts sharing the prefix
+			// and of removed shares are skipped.
+			v := bkt.Get(k[len(prefix):])
+			if v == nil {
+				continue
+			}
+			var share Share
+			err := json.Unmarshal(v, &share)
+			if err != nil {
+				return err
+			}
+			if share.Account != id || share.CreatedOn < min {
+				continue
+			}
+			summary.Count++
+			summary.Weight.Add(summary.Weight, share.Weight)
+			if share.CreatedOn > summary.LastShare {
+				summary.LastShare = share.CreatedOn
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
 // sharePercentages calculates the percentages due each account
 // according to their weighted shares.
 func sharePercentages(shares []*Share) (map[string]*big.Rat, error) {
@@ -244,22 +446,67 @@ func sharePercentages(shares []*Share) (map[string]*big.Rat, error) {
 }
 
 // CalculatePayments calculates the payments due participating accounts.
+// Accounts with a fee override are charged their override in place of the
+// pool fee. The donated fraction of an account's portion is paid as a
+// separate donation payment, the full portion is donated if the remainder
+// would be dust. The pool fee payment is the remainder of the total after
+// all account payments, the payments always sum up to the provided total.
 func CalculatePayments(percentages map[string]*big.Rat, total dcrutil.Amount,
-	poolFee float64, height uint32, estMaturity uint32) ([]*Payment, error) {
-	// Deduct pool fee from the amount to be shared.
-	fee := total.MulF64(poolFee)
-	amtSansFees := total - fee
-
-	// Calculate each participating account's portion of the amount after fees.
+	poolFee float64, feeOverrides map[string]float64,
+	donations map[string]float64, height uint32,
+	estMaturity uint32) ([]*Payment, error) {
+	// Calculate each participating account's portion of the amount after
+	// deducting its fee.
 	payments := make([]*Payment, 0)
+	var paid dcrutil.Amount
 	for account, percentage := range percentages {
+		feeRate := poolFee
+		if override, ok := feeOverrides[account]; ok {
+			feeRate = override
+		}
 		percent, _ := percentage.Float64()
-		amt := amtSansFees.MulF64(percent)
-		payments = append(payments, NewPayment(account, amt, height, estMaturity))
+		amt := total.MulF64(percent)
+		amt -= amt.MulF64(feeRate)
+		paid += amt
+
+		donation := amt.MulF64(donations[account])
+		kept := amt - donation
+		if donation > 0 && kept > 0 && txrules.IsDustAmount(kept,
+			25, // P2PKHScriptSize
+			mempool.DefaultMinRelayTxFee) {
+			donation, kept = amt, 0
+		}
+		var createdOn int64
+		if kept > 0 || donation == 0 {
+			payment := NewPayment(account, kept, height, estMaturity)
+			payment.FeeRate = feeRate
+			payment.Percentage = percentage
+			payments = append(payments, payment)
+			createdOn = payment.CreatedOn
+		}
+		if donation > 0 {
+			payment := NewPayment(account, donation, height, estMaturity)
+			payment.FeeRate = feeRate
+			payment.Percentage = percentage
+			payment.Donation = true
+
+			// Ensure the donation does not share the payment id of the
+			// payment kept by the account.
+			if payment.CreatedOn <= createdOn {
+				payment.CreatedOn = createdOn + 1
+			}
+			payments = append(payments, payment)
+		}
+	}
+	if paid > total {
+		desc := fmt.Sprintf("account payments of %v exceed the total "+
+			"amount of %v", paid, total)
+		return nil, MakeError(ErrOther, desc, nil)
 	}
 
 	// Add a payout entry for pool fees.
-	payments = append(payments, NewPayment(poolFeesK, fee, height, estMaturity))
+	payments = append(payments, NewPayment(poolFeesK, total-paid, height,
+		estMaturity))
 	return payments, nil
 }
 
@@ -270,18 +517,31 @@ func pruneShares(tx *bolt.Tx, minNano int64) error {
 	if err != nil {
 		return err
 	}
+	ibkt, err := fetchAccountShareBucket(tx)
+	if err != nil {
+		return err
+	}
 	toDelete := [][]byte{}
+	accounts := []string{}
 	cursor := bkt.Cursor()
-	for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
-		if bytes.Compare(minBytes, k) > 0 {
-			toDelete = append(toDelete, k)
-		}
+	for k, v := cursor.First(); k != nil &&
+		bytes.Compare(minBytes, k) > 0; k, v = cursor.Next() {
+		// The index entries of undecodable shares are left to be
+		// skipped by index reads.
+		var share Share
+		_ = json.Unmarshal(v, &share)
+		toDelete = append(toDelete, k)
+		accounts = append(accounts, share.Account)
 	}
-	for _, entry := range toDelete {
+	for idx, entry := range toDelete {
 		err := bkt.Delete(entry)
 		if err != nil {
 			return err
 		}
+		err = ibkt.Delete(accountShareKey(accounts[idx], entry))
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -12,6 +12,7 @@ import (
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
 )
 
 // persistShare creates a persisted share with the provided account, share
@@ -315,3 +316,115 @@ func testCalculatePoolTarget(t *testing.T) {
 		}
 	}
 }
+
+func testCalculatePayments(t *testing.T) {
+	total := dcrutil.Amount(1234567891)
+	third := big.NewRat(1, 3)
+	percentages := map[string]*big.Rat{
+		xID: third,
+		yID: third,
+		"z": third,
+	}
+	feeOverrides := map[string]float64{
+		xID: 0,
+		yID: 0.005,
+	}
+	payments, err := CalculatePayments(percentages, total, 0.01,
+		feeOverrides, nil, 100, 116)
+	if err != nil {
+		t.Fatalf("[CalculatePayments] unexpected error: %v", err)
+	}
+	if len(payments) != 4 {
+		t.Fatalf("expected 4 payments, got %d", len(payments))
+	}
+
+	// Ensure accounts are charged their effective fee rate and the
+	// payments conserve the total amount exactly.
+	expectedRates := map[string]float64{xID: 0, yID: 0.005, "z": 0.01}
+	amounts := make(map[string]dcrutil.Amount)
+	var sum dcrutil.Amount
+	for _, pmt := range payments {
+		sum += pmt.Amount
+		amounts[pmt.Account] = pmt.Amount
+		if pmt.Account == poolFeesK {
+			continue
+		}
+		if pmt.FeeRate != expectedRates[pmt.Account] {
+			t.Fatalf("expected a fee rate of %v for account %s, got %v",
+				expectedRates[pmt.Account], pmt.Account, pmt.FeeRate)
+		}
+	}
+	if sum != total {
+		t.Fatalf("expected payments to sum up to %v, got %v", total, sum)
+	}
+	if !(amounts[xID] > amounts[yID] && amounts[yID] > amounts["z"]) {
+		t.Fatalf("expected discounted accounts to be paid more, got %v",
+			amounts)
+	}
+	if amounts[poolFeesK] <= 0 {
+		t.Fatalf("expected a positive pool fee, got %v", amounts[poolFeesK])
+	}
+
+	// Ensure donations are paid separately, dust remainders are donated
+	// in full and the payments still conserve the total amount.
+	donations := map[string]float64{
+		xID: 0.25,
+		yID: 1,
+		"z": 0.999999,
+	}
+	payments, err = CalculatePayments(percentages, total, 0.01,
+		feeOverrides, donations, 100, 116)
+	if err != nil {
+		t.Fatalf("[CalculatePayments] unexpected error: %v", err)
+	}
+	kept := make(map[string]dcrutil.Amount)
+	donated := make(map[string]dcrutil.Amount)
+	ids := make(map[string]struct{})
+	sum = 0
+	for _, pmt := range payments {
+		sum += pmt.Amount
+		ids[string(GeneratePaymentID(pmt.CreatedOn, pmt.Height,
+			pmt.Account))] = struct{}{}
+		if pmt.Donation {
+			donated[pmt.Account] += pmt.Amount
+			continue
+		}
+		kept[pmt.Account] += pmt.Amount
+	}
+	if sum != total {
+		t.Fatalf("expected payments to sum up to %v, got %v", total, sum)
+	}
+	if len(ids) != len(payments) {
+		t.Fatal("expected donations to have distinct payment ids")
+	}
+	if kept[xID]+donated[xID] != amounts[xID] ||
+		donated[xID] != amounts[xID].MulF64(0.25) {
+		t.Fatalf("expected a quarter of %v donated by account x, got %v "+
+			"kept and %v donated", amounts[xID], kept[xID], donated[xID])
+	}
+	for _, account := range []string{yID, "z"} {
+		if _, ok := kept[account]; ok || donated[account] != amounts[account] {
+			t.Fatalf("expected all of %v donated by account %s, got %v "+
+				"kept and %v donated", amounts[account], account,
+				kept[account], donated[account])
+		}
+	}
+
+	// Ensure donations of all accounts are bundled together.
+	bundles := generatePaymentBundles(payments)
+	var donationBundles int
+	for _, bdl := range bundles {
+		if bdl.Account != donationsK {
+			continue
+		}
+		donationBundles++
+		if len(bdl.Payments) != 3 {
+			t.Fatalf("expected 3 donations bundled, got %d",
+				len(bdl.Payments))
+		}
+	}
+	if donationBundles != 1 {
+		t.Fatalf("expected a single donation bundle, got %d",
+			donationBundles)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// ShareLogSyncNone leaves syncing the share log file to disk to the
+	// operating system.
+	ShareLogSyncNone = "none"
+
+	// ShareLogSyncWrite syncs the share log file to disk after every batch
+	// of queued shares is written.
+	ShareLogSyncWrite = "write"
+
+	// ShareLogSyncInterval syncs the share log file to disk periodically
+	// when shares were written since the last sync.
+	ShareLogSyncInterval = "interval"
+
+	// ShareAccepted is the result of a logged share meeting its pool
+	// target.
+	ShareAccepted = "accepted"
+
+	// ShareRejected is the result of a logged share refused by the pool.
+	ShareRejected = "rejected"
+)
+
+var (
+	// shareLogQueueSize represents the default number of shares queued for
+	// writing to the share log, shares are dropped once the queue is full.
+	shareLogQueueSize = 4096
+
+	// shareLogSyncInterval represents the default period between syncs of
+	// the share log file with the interval sync policy.
+	shareLogSyncInterval = time.Second
+
+	// shareLogDropReportInterval represents the period between warnings of
+	// shares dropped from the share log.
+	shareLogDropReportInterval = time.Minute
+)
+
+// ShareLogConfig represents configuration details for the share log.
+type ShareLogConfig struct {
+	// Path represents the path of the share log file.
+	Path string
+	// MaxSize represents the size, in bytes, the share log file is rotated
+	// at, zero disables rotation.
+	MaxSize int64
+	// MaxRolls represents the number of rotated share log files kept.
+	MaxRolls int
+	// SyncPolicy represents when the share log file is synced to disk.
+	SyncPolicy string
+	// SyncInterval represents the period between syncs of the share log
+	// file with the interval sync policy. Zero uses the default.
+	SyncInterval time.Duration
+	// QueueSize represents the number of shares queued for writing, shares
+	// are dropped once the queue is full. Zero uses the default.
+	QueueSize int
+	// Events represents the hub's event bus shares are logged from.
+	Events *EventBus
+	// HubWg represents the hub's waitgroup.
+	HubWg *sync.WaitGroup
+}
+
+// ShareRecord represents a share written to the share log as a JSON line.
+type ShareRecord struct {
+	Timestamp  int64   `json:"timestamp"`
+	Account    string  `json:"account"`
+	Worker     string  `json:"worker"`
+	Miner      string  `json:"miner"`
+	Difficulty float64 `json:"difficulty"`
+	Result     string  `json:"result"`
+	Reason     string  `json:"reason,omitempty"`
+	JobID      string  `json:"jobid"`
+	Late       bool    `json:"late,omitempty"`
+}
+
+// ShareLog appends the accepted and rejected shares published on the hub's
+// event bus to a size-rotated file for external analytics. Shares are
+// queued and written asynchronously, share submissions are never blocked
+// on the share log.
+type ShareLog struct {
+	cfg    *ShareLogConfig
+	events *Subscription
+	file   *os.File
+	size   int64
+	dirty  bool
+}
+
+// NewShareLog creates a share log appending to the configured file.
+func NewShareLog(sCfg *ShareLogConfig) (*ShareLog, error) {
+	switch sCfg.SyncPolicy {
+	case ShareLogSyncNone, ShareLogSyncWrite, ShareLogSyncInterval:
+	default:
+		return nil, fmt.Errorf("unknown share log sync policy: %s",
+			sCfg.SyncPolicy)
+	}
+	sl := &ShareLog{cfg: sCfg}
+	err := sl.open()
+	if err != nil {
+		return nil, err
+	}
+	queueSize := sCfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = shareLogQueueSize
+	}
+	sl.events = sCfg.Events.Subscribe(queueSize, EventShareAccepted,
+		EventShareRejected)
+	return sl, nil
+}
+
+// open opens the share log file for appending.
+func (sl *ShareLog) open() error {
+	f, err := os.OpenFile(sl.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY,
+		0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	sl.file = f
+	sl.size = info.Size()
+	return nil
+}
+
+// rotate closes the share log file, shifts the rotated files and reopens
+// an empty share log file. The oldest rotated file is discarded once the
+// maximum number of rotated files is kept.
+func (sl *ShareLog) rotate() error {
+	err := sl.sync()
+	if err != nil {
+		return err
+	}
+	err = sl.file.Close()
+	if err != nil {
+		return err
+	}
+	path := sl.cfg.Path
+	if sl.cfg.MaxRolls <= 0 {
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+		return sl.open()
+	}
+	for i := sl.cfg.MaxRolls - 1; i > 0; i-- {
+		err = os.Rename(fmt.Sprintf("%s.%d", path, i),
+			fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err = os.Rename(path, path+".1")
+	if err != nil {
+		return err
+	}
+	return sl.open()
+}
+
+// sync syncs the share log file to disk if shares were written since the
+// last sync.
+func (sl *ShareLog) sync() error {
+	if !sl.dirty {
+		return nil
+	}
+	sl.dirty = false
+	return sl.file.Sync()
+}
+
+// write appends the share of the provided event to the share log file,
+// rotating the file first if the share would grow it past its maximum
+// size.
+func (sl *ShareLog) write(event *HubEvent) error {
+	record := &ShareRecord{
+		Timestamp:  event.Timestamp,
+		Account:    event.Account,
+		Worker:     event.Worker,
+		Miner:      event.Miner,
+		Difficulty: event.Difficulty,
+		Result:     ShareAccepted,
+		JobID:      event.JobID,
+		Late:       event.Late,
+	}
+	if event.Kind == EventShareRejected {
+		record.Result = ShareRejected
+		record.Reason = event.Reason
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if sl.cfg.MaxSize > 0 && sl.size > 0 &&
+		sl.size+int64(len(line)) > sl.cfg.MaxSize {
+		err := sl.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	n, err := sl.file.Write(line)
+	sl.size += int64(n)
+	sl.dirty = true
+	return err
+}
+
+// writeBatch writes the provided share along with all shares queued behind
+// it, syncing the file afterwards with the write sync policy.
+func (sl *ShareLog) writeBatch(event *HubEvent) {
+	for event != nil {
+		err := sl.write(event)
+		if err != nil {
+			log.Errorf("unable to write to share log %s: %v", sl.cfg.Path,
+				err)
+		}
+		event = sl.nextQueued()
+	}
+	if sl.cfg.SyncPolicy == ShareLogSyncWrite {
+		err := sl.sync()
+		if err != nil {
+			log.Errorf("unable to sync share log %s: %v", sl.cfg.Path, err)
+		}
+	}
+}
+
+// nextQueued returns the next queued share without blocking, nil if no
+// share is queued.
+func (sl *ShareLog) nextQueued() *HubEvent {
+	select {
+	case event := <-sl.events.Events():
+		return event
+	default:
+		return nil
+	}
+}
+
+// Dropped returns the number of shares dropped because the share log queue
+// was full.
+func (sl *ShareLog) Dropped() uint64 {
+	return sl.events.Dropped()
+}
+
+// close writes the shares still queued and closes the share log file.
+func (sl *ShareLog) close() {
+	sl.cfg.Events.Unsubscribe(sl.events)
+	for event := range sl.events.Events() {
+		err := sl.write(event)
+		if err != nil {
+			log.Errorf("unable to write to share log %s: %v", sl.cfg.Path,
+				err)
+			break
+		}
+	}
+	if sl.cfg.SyncPolicy != ShareLogSyncNone {
+		err := sl.sync()
+		if err != nil {
+			log.Errorf("unable to sync share log %s: %v", sl.cfg.Path, err)
+		}
+	}
+	err := sl.file.Close()
+	if err != nil {
+		log.Errorf("unable to close share log %s: %v", sl.cfg.Path, err)
+	}
+	if dropped := sl.Dropped(); dropped > 0 {
+		log.Warnf("%d share(s) were dropped from the share log", dropped)
+	}
+}
+
+// run writes queued shares to the share log file until the provided
+// context is cancelled. It must be run as a goroutine.
+func (sl *ShareLog) run(ctx context.Context) {
+	var syncCh <-chan time.Time
+	if sl.cfg.SyncPolicy == ShareLogSyncInterval {
+		interval := sl.cfg.SyncInterval
+		if interval <= 0 {
+			interval = shareLogSyncInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		syncCh = ticker.C
+	}
+	dropTicker := time.NewTicker(shareLogDropReportInterval)
+	defer dropTicker.Stop()
+	var dropped uint64
+	for {
+		select {
+		case <-ctx.Done():
+			sl.close()
+			sl.cfg.HubWg.Done()
+			return
+
+		case event := <-sl.events.Events():
+			sl.writeBatch(event)
+
+		case <-syncCh:
+			err := sl.sync()
+			if err != nil {
+				log.Errorf("unable to sync share log %s: %v", sl.cfg.Path,
+					err)
+			}
+
+		case <-dropTicker.C:
+			if current := sl.Dropped(); current > dropped {
+				log.Warnf("Share log queue full, %d share(s) dropped",
+					current-dropped)
+				dropped = current
+			}
+		}
+	}
+}
+
+// ReadShareLog reads the shares of the provided share log, one JSON line
+// per share.
+func ReadShareLog(r io.Reader) ([]*ShareRecord, error) {
+	records := make([]*ShareRecord, 0)
+	scanner := bufio.NewScanner(r)
+	var line int
+	for scanner.Scan() {
+		line++
+		var record ShareRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return nil, fmt.Errorf("malformed share on line %d: %v", line,
+				err)
+		}
+		records = append(records, &record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
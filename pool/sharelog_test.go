@@ -0,0 +1,161 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testShareLog(t *testing.T) {
+	d, err := ioutil.TempDir("", "eacrpool_test_sharelog")
+	if err != nil {
+		t.Fatalf("[TempDir] unexpected error: %v", err)
+	}
+	defer os.RemoveAll(d)
+	path := filepath.Join(d, "shares.log")
+
+	// Ensure unknown sync policies are rejected.
+	bus := NewEventBus()
+	_, err = NewShareLog(&ShareLogConfig{
+		Path:       path,
+		SyncPolicy: "always",
+		Events:     bus,
+	})
+	if err == nil {
+		t.Fatal("[NewShareLog] expected an unknown sync policy error")
+	}
+
+	// Ensure accepted and rejected shares are appended as JSON lines.
+	var wg sync.WaitGroup
+	sl, err := NewShareLog(&ShareLogConfig{
+		Path:       path,
+		SyncPolicy: ShareLogSyncWrite,
+		Events:     bus,
+		HubWg:      &wg,
+	})
+	if err != nil {
+		t.Fatalf("[NewShareLog] unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg.Add(1)
+	go sl.run(ctx)
+	bus.publish(&HubEvent{
+		Kind:       EventShareAccepted,
+		Account:    xID,
+		Worker:     "rig0",
+		Miner:      CPU,
+		Difficulty: 2,
+		JobID:      "0000000a",
+	})
+	bus.publish(&HubEvent{
+		Kind:       EventShareRejected,
+		Account:    yID,
+		Worker:     "rig1",
+		Miner:      AntminerDR5,
+		Difficulty: 4,
+		Reason:     "Stale Job",
+		JobID:      "0000000b",
+	})
+	bus.publish(&HubEvent{Kind: EventClientConnected, Account: xID})
+	cancel()
+	wg.Wait()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("[Open] unexpected error: %v", err)
+	}
+	records, err := ReadShareLog(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("[ReadShareLog] unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 logged shares, got %d", len(records))
+	}
+	accepted := records[0]
+	if accepted.Result != ShareAccepted || accepted.Account != xID ||
+		accepted.Worker != "rig0" || accepted.Miner != CPU ||
+		accepted.Difficulty != 2 || accepted.JobID != "0000000a" ||
+		accepted.Reason != "" || accepted.Timestamp == 0 {
+		t.Fatalf("unexpected accepted share record: %+v", accepted)
+	}
+	rejected := records[1]
+	if rejected.Result != ShareRejected || rejected.Account != yID ||
+		rejected.Reason != "Stale Job" || rejected.JobID != "0000000b" ||
+		rejected.Difficulty != 4 {
+		t.Fatalf("unexpected rejected share record: %+v", rejected)
+	}
+
+	// Ensure the share log is rotated once it reaches its maximum size and
+	// only the configured number of rotated files are kept.
+	rotPath := filepath.Join(d, "rotated.log")
+	sl, err = NewShareLog(&ShareLogConfig{
+		Path:       rotPath,
+		MaxSize:    1,
+		MaxRolls:   2,
+		SyncPolicy: ShareLogSyncNone,
+		Events:     bus,
+		HubWg:      &wg,
+	})
+	if err != nil {
+		t.Fatalf("[NewShareLog] unexpected error: %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	wg.Add(1)
+	go sl.run(ctx)
+	for _, jobID := range []string{"1", "2", "3", "4"} {
+		bus.publish(&HubEvent{Kind: EventShareAccepted, JobID: jobID})
+	}
+	cancel()
+	wg.Wait()
+
+	for suffix, jobID := range map[string]string{"": "4", ".1": "3",
+		".2": "2"} {
+		content, err := ioutil.ReadFile(rotPath + suffix)
+		if err != nil {
+			t.Fatalf("[ReadFile] unexpected error: %v", err)
+		}
+		records, err := ReadShareLog(bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("[ReadShareLog] unexpected error: %v", err)
+		}
+		if len(records) != 1 || records[0].JobID != jobID {
+			t.Fatalf("expected share of job %s in %s, got %v", jobID,
+				rotPath+suffix, records)
+		}
+	}
+	if _, err := os.Stat(rotPath + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected no third rotated share log, got %v", err)
+	}
+
+	// Ensure shares are dropped and counted once the queue is full.
+	sl, err = NewShareLog(&ShareLogConfig{
+		Path:       filepath.Join(d, "dropped.log"),
+		SyncPolicy: ShareLogSyncNone,
+		QueueSize:  1,
+		Events:     bus,
+		HubWg:      &wg,
+	})
+	if err != nil {
+		t.Fatalf("[NewShareLog] unexpected error: %v", err)
+	}
+	bus.publish(&HubEvent{Kind: EventShareAccepted})
+	bus.publish(&HubEvent{Kind: EventShareAccepted})
+	bus.publish(&HubEvent{Kind: EventShareRejected})
+	if sl.Dropped() != 2 {
+		t.Fatalf("expected 2 dropped shares, got %d", sl.Dropped())
+	}
+	sl.close()
+
+	// Ensure malformed share log lines are reported.
+	malformed := `{"timestamp":1,"result":"accepted"}` + "\n" + `{"timestamp":`
+	_, err = ReadShareLog(strings.NewReader(malformed))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected a malformed line 2 error, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Shutdown phases of the hub, in the order they are entered.
+const (
+	// ShutdownRunning is the phase of a hub which is not shutting down.
+	ShutdownRunning = "running"
+	// ShutdownListeners is the phase the miner endpoints stop accepting
+	// connections and cancel their clients in.
+	ShutdownListeners = "listeners"
+	// ShutdownClients is the phase cancelled clients are drained and trace
+	// captures are stopped in.
+	ShutdownClients = "clients"
+	// ShutdownChainState is the phase chain state processing stops in,
+	// once the block being processed is.
+	ShutdownChainState = "chainstate"
+	// ShutdownPayments is the phase the payment cycle being processed
+	// finishes or is checkpointed in.
+	ShutdownPayments = "payments"
+	// ShutdownWriters is the phase batched writers flush their records
+	// and stop in.
+	ShutdownWriters = "writers"
+	// ShutdownDB is the phase the chain and wallet connections and the
+	// database are closed in.
+	ShutdownDB = "db"
+	// ShutdownComplete is the phase of a hub which has shut down.
+	ShutdownComplete = "complete"
+)
+
+// shutdownPhases represents the shutdown phases of the hub in order.
+var shutdownPhases = []string{ShutdownRunning, ShutdownListeners,
+	ShutdownClients, ShutdownChainState, ShutdownPayments, ShutdownWriters,
+	ShutdownDB, ShutdownComplete}
+
+var (
+	// shutdownStageTimeout is the period the components stopped in a
+	// shutdown phase are waited on before shutdown proceeds regardless.
+	shutdownStageTimeout = time.Second * 30
+
+	// paymentShutdownTimeout is the period the payment cycle being
+	// processed is waited on during shutdown, dispatching a payment chunk
+	// can take as long as the wallet takes to publish it.
+	paymentShutdownTimeout = time.Minute * 2
+)
+
+// ShutdownStatus represents the shutdown phase of the hub and the time it
+// was entered, in nanoseconds. KillSafe reports if killing the process in
+// the phase loses no more than the connections of miners, it is false
+// while the hub runs and from the chain state phase until the database is
+// closed.
+type ShutdownStatus struct {
+	Phase    string
+	Since    int64
+	KillSafe bool
+}
+
+// shutdownTracker tracks the shutdown phase of the hub.
+type shutdownTracker struct {
+	phase int
+	since int64
+	mtx   sync.RWMutex
+}
+
+// phaseIndex returns the position of the provided phase in the shutdown
+// order.
+func phaseIndex(phase string) int {
+	for idx, p := range shutdownPhases {
+		if p == phase {
+			return idx
+		}
+	}
+	return len(shutdownPhases)
+}
+
+// enter moves the tracker to the provided shutdown phase.
+func (s *shutdownTracker) enter(phase string) {
+	s.mtx.Lock()
+	s.phase = phaseIndex(phase)
+	s.since = time.Now().UnixNano()
+	s.mtx.Unlock()
+	log.Infof("Shutdown phase: %s", phase)
+}
+
+// reached returns if the tracker entered the provided shutdown phase or a
+// later one. The caller must hold the tracker's mutex.
+func (s *shutdownTracker) reached(phase string) bool {
+	return s.phase >= phaseIndex(phase)
+}
+
+// status returns the shutdown status of the tracker.
+func (s *shutdownTracker) status() *ShutdownStatus {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	phase := shutdownPhases[s.phase]
+	return &ShutdownStatus{
+		Phase: phase,
+		Since: s.since,
+		KillSafe: phase == ShutdownListeners || phase == ShutdownClients ||
+			phase == ShutdownComplete,
+	}
+}
+
+// awaitStage waits for the provided components of a shutdown phase to stop,
+// for at most the provided timeout. It returns false if they did not stop
+// in time.
+func awaitStage(phase string, wg *sync.WaitGroup, timeout time.Duration) bool {
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Infof("Shutdown phase %s completed in %v", phase,
+			time.Since(start))
+		return true
+	case <-time.After(timeout):
+		log.Warnf("Shutdown phase %s did not complete within %v, "+
+			"proceeding", phase, timeout)
+		return false
+	}
+}
+
+// FetchShutdownStatus returns the shutdown phase of the hub.
+func (h *Hub) FetchShutdownStatus() *ShutdownStatus {
+	return h.phases.status()
+}
+
+// shuttingDown returns if the hub has entered the provided shutdown phase
+// or a later one.
+func (h *Hub) shuttingDown(phase string) bool {
+	h.phases.mtx.RLock()
+	defer h.phases.mtx.RUnlock()
+	return h.phases.reached(phase)
+}
+
+// hubStages represents the components of the hub stopped together during
+// shutdown, each stage stops once its context is cancelled.
+type hubStages struct {
+	endpointsCtx    context.Context
+	cancelEndpoints context.CancelFunc
+	endpointsWg     sync.WaitGroup
+	chainCtx        context.Context
+	cancelChain     context.CancelFunc
+	chainWg         sync.WaitGroup
+	writersCtx      context.Context
+	cancelWriters   context.CancelFunc
+	writersWg       sync.WaitGroup
+}
+
+// newHubStages creates the shutdown stages of the hub.
+func newHubStages() *hubStages {
+	s := new(hubStages)
+	s.endpointsCtx, s.cancelEndpoints = context.WithCancel(context.Background())
+	s.chainCtx, s.cancelChain = context.WithCancel(context.Background())
+	s.writersCtx, s.cancelWriters = context.WithCancel(context.Background())
+	return s
+}
+
+// start runs the provided component as a goroutine until the provided
+// stage context is cancelled, tracking it with the hub's waitgroup and the
+// provided stage waitgroup.
+func (h *Hub) start(ctx context.Context, wg *sync.WaitGroup, run func(context.Context)) {
+	h.wg.Add(1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		run(ctx)
+	}()
+}
+
+// stopStages shuts the hub down in order: the endpoints stop accepting
+// connections, their clients are drained, chain state processing stops
+// once the block being processed is, the payment cycle being processed
+// finishes or is checkpointed, batched writers flush their records and
+// the connections and database are closed. Each phase is logged and given
+// a timeout so a stuck component does not block shutdown.
+func (h *Hub) stopStages(stages *hubStages) {
+	h.phases.enter(ShutdownListeners)
+	stages.cancelEndpoints()
+	awaitStage(ShutdownListeners, &stages.endpointsWg, shutdownStageTimeout)
+
+	h.phases.enter(ShutdownClients)
+	h.shutdownClients()
+	h.captures.close()
+
+	h.phases.enter(ShutdownChainState)
+	stages.cancelChain()
+	awaitStage(ShutdownChainState, &stages.chainWg, shutdownStageTimeout)
+
+	h.phases.enter(ShutdownPayments)
+	if !h.paymentMgr.stop(paymentShutdownTimeout) {
+		log.Warnf("The payment cycle did not finish within %v, it is "+
+			"resumed after a restart", paymentShutdownTimeout)
+	}
+
+	h.phases.enter(ShutdownWriters)
+	stages.cancelWriters()
+	awaitStage(ShutdownWriters, &stages.writersWg, shutdownStageTimeout)
+
+	h.phases.enter(ShutdownDB)
+	h.shutdown()
+	h.phases.enter(ShutdownComplete)
+}
@@ -0,0 +1,83 @@
+package pool
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func testShutdown(t *testing.T) {
+	// Ensure the shutdown phase is reported along with whether killing the
+	// process in it is safe.
+	var tracker shutdownTracker
+	if status := tracker.status(); status.Phase != ShutdownRunning ||
+		status.KillSafe {
+		t.Fatalf("expected a running phase, got %+v", status)
+	}
+	for phase, killSafe := range map[string]bool{
+		ShutdownListeners:  true,
+		ShutdownClients:    true,
+		ShutdownChainState: false,
+		ShutdownPayments:   false,
+		ShutdownWriters:    false,
+		ShutdownDB:         false,
+		ShutdownComplete:   true,
+	} {
+		tracker.enter(phase)
+		status := tracker.status()
+		if status.Phase != phase || status.KillSafe != killSafe ||
+			status.Since == 0 {
+			t.Fatalf("unexpected status of phase %s: %+v", phase, status)
+		}
+	}
+
+	// Ensure stages not stopping in time do not block shutdown.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	if awaitStage(ShutdownWriters, &wg, time.Millisecond*10) {
+		t.Fatal("expected the stage to time out")
+	}
+	wg.Done()
+	if !awaitStage(ShutdownWriters, &wg, time.Second) {
+		t.Fatal("expected the stage to complete")
+	}
+
+	// Ensure block notifications are dropped once chain state processing
+	// stops, they would otherwise block on the unbuffered channels.
+	hub := &Hub{
+		chainState: &ChainState{
+			connCh: make(chan *blockNotification),
+			discCh: make(chan *blockNotification),
+		},
+	}
+	hub.phases.enter(ShutdownChainState)
+	hub.HandleBlockConnected(nil)
+	hub.HandleBlockDisconnected(nil)
+	if !hub.shuttingDown(ShutdownListeners) {
+		t.Fatal("expected the hub to be shutting down")
+	}
+	if hub.shuttingDown(ShutdownPayments) {
+		t.Fatal("expected the payments phase not to be entered")
+	}
+
+	// Ensure stopping the payment manager waits for the payment cycle being
+	// processed and refuses new cycles.
+	pm := new(PaymentMgr)
+	if !pm.beginCycle() {
+		t.Fatal("expected a payment cycle to begin")
+	}
+	if pm.stop(time.Millisecond * 10) {
+		t.Fatal("expected the payment cycle to still be in flight")
+	}
+	if pm.beginCycle() {
+		t.Fatal("expected no payment cycle to begin once stopping")
+	}
+	err := pm.payDividends(10)
+	if err != nil {
+		t.Fatalf("[payDividends] unexpected error: %v", err)
+	}
+	pm.cycles.Done()
+	if !pm.stop(time.Second) {
+		t.Fatal("expected the payment cycle to finish")
+	}
+}
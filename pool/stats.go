@@ -0,0 +1,322 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+var (
+	// statsRawRetention represents the period raw stats samples are kept
+	// for before being rolled up.
+	statsRawRetention = time.Hour * 48
+
+	// statsRollupPeriod represents the period raw stats samples are rolled
+	// up over.
+	statsRollupPeriod = time.Hour
+
+	// statsRollupRetention represents the period stats rollups are kept
+	// for before being pruned.
+	statsRollupRetention = time.Hour * 24 * 90
+)
+
+// StatsSample represents a snapshot of the pool's mining activity. Rollups
+// average the raw samples taken over their rollup period.
+type StatsSample struct {
+	Time              int64             `json:"time"`
+	HashRate          float64           `json:"hashrate"`
+	NetworkDifficulty float64           `json:"networkdifficulty"`
+	Clients           map[string]uint32 `json:"clients"`
+	Workers           map[string]uint32 `json:"workers"`
+	Samples           uint32            `json:"samples"`
+}
+
+// fetchStatsBucket is a helper function for getting the raw stats bucket.
+func fetchStatsBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(statsBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(statsBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// fetchStatsRollupBucket is a helper function for getting the stats
+// rollup bucket.
+func fetchStatsRollupBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(statsRollupBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(statsRollupBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// putStatsSample persists the provided sample to the provided bucket keyed
+// by its time.
+func putStatsSample(bkt *bolt.Bucket, sample *StatsSample) error {
+	sampleBytes, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	return bkt.Put(nanoToBigEndianBytes(sample.Time), sampleBytes)
+}
+
+// rollupStatsSamples averages the provided samples into a single sample of
+// the provided time.
+func rollupStatsSamples(t int64, samples []*StatsSample) *StatsSample {
+	rollup := &StatsSample{
+		Time:    t,
+		Clients: make(map[string]uint32),
+		Workers: make(map[string]uint32),
+		Samples: uint32(len(samples)),
+	}
+	clients := make(map[string]uint64)
+	workers := make(map[string]uint64)
+	for _, sample := range samples {
+		rollup.HashRate += sample.HashRate
+		rollup.NetworkDifficulty += sample.NetworkDifficulty
+		for miner, count := range sample.Clients {
+			clients[miner] += uint64(count)
+		}
+		for account, count := range sample.Workers {
+			workers[account] += uint64(count)
+		}
+	}
+	n := float64(len(samples))
+	rollup.HashRate /= n
+	rollup.NetworkDifficulty /= n
+	for miner, count := range clients {
+		rollup.Clients[miner] = uint32(math.Round(float64(count) / n))
+	}
+	for account, count := range workers {
+		rollup.Workers[account] = uint32(math.Round(float64(count) / n))
+	}
+	return rollup
+}
+
+// pruneStats rolls up raw stats samples older than the raw retention period
+// and removes rollups older than the rollup retention period.
+func pruneStats(tx *bolt.Tx, now time.Time) error {
+	bkt, err := fetchStatsBucket(tx)
+	if err != nil {
+		return err
+	}
+	rbkt, err := fetchStatsRollupBucket(tx)
+	if err != nil {
+		return err
+	}
+
+	// Only complete rollup periods are rolled up.
+	cutoff := now.Add(-statsRawRetention).Truncate(statsRollupPeriod)
+	maxK := nanoToBigEndianBytes(cutoff.UnixNano())
+	periods := make(map[int64][]*StatsSample)
+	toDelete := make([][]byte, 0)
+	cursor := bkt.Cursor()
+	for k, v := cursor.First(); k != nil && bytes.Compare(k, maxK) < 0; k, v = cursor.Next() {
+		var sample StatsSample
+		err := json.Unmarshal(v, &sample)
+		if err != nil {
+			return err
+		}
+		period := time.Unix(0, sample.Time).Truncate(statsRollupPeriod).UnixNano()
+		periods[period] = append(periods[period], &sample)
+		toDelete = append(toDelete, k)
+	}
+	for period, samples := range periods {
+		err := putStatsSample(rbkt, rollupStatsSamples(period, samples))
+		if err != nil {
+			return err
+		}
+	}
+	for _, k := range toDelete {
+		err := bkt.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	minK := nanoToBigEndianBytes(now.Add(-statsRollupRetention).UnixNano())
+	toDelete = toDelete[:0]
+	cursor = rbkt.Cursor()
+	for k, _ := cursor.First(); k != nil && bytes.Compare(k, minK) < 0; k, _ = cursor.Next() {
+		toDelete = append(toDelete, k)
+	}
+	for _, k := range toDelete {
+		err := rbkt.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listStatsSamples returns the samples of the provided bucket taken within
+// the provided range, ordered by time.
+func listStatsSamples(bkt *bolt.Bucket, min int64, max int64) ([]*StatsSample, error) {
+	samples := make([]*StatsSample, 0)
+	minK := nanoToBigEndianBytes(min)
+	maxK := nanoToBigEndianBytes(max)
+	cursor := bkt.Cursor()
+	for k, v := cursor.Seek(minK); k != nil && bytes.Compare(k, maxK) <= 0; k, v = cursor.Next() {
+		var sample StatsSample
+		err := json.Unmarshal(v, &sample)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, &sample)
+	}
+	return samples, nil
+}
+
+// fetchStatsSamples returns the stats samples taken within the provided
+// range, ordered by time. Samples older than the raw retention period are
+// returned as rollups.
+func fetchStatsSamples(db *bolt.DB, min int64, max int64) ([]*StatsSample, error) {
+	var samples []*StatsSample
+	err := db.View(func(tx *bolt.Tx) error {
+		rbkt, err := fetchStatsRollupBucket(tx)
+		if err != nil {
+			return err
+		}
+		bkt, err := fetchStatsBucket(tx)
+		if err != nil {
+			return err
+		}
+		samples, err = listStatsSamples(rbkt, min, max)
+		if err != nil {
+			return err
+		}
+		raw, err := listStatsSamples(bkt, min, max)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, raw...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// StatsRecorderConfig represents configuration details for the stats
+// recorder.
+type StatsRecorderConfig struct {
+	// DB represents the pool database.
+	DB *bolt.DB
+	// Interval represents the interval pool stats are sampled at.
+	Interval time.Duration
+	// FetchPoolHashRate returns the hash rate of the pool and its clients
+	// grouped by miner type.
+	FetchPoolHashRate func() (*big.Rat, map[string][]*ClientInfo)
+	// FetchNetworkDifficulty returns the difficulty of the current work.
+	FetchNetworkDifficulty func() float64
+	// FetchOnlineWorkers returns the number of online workers of each
+	// account.
+	FetchOnlineWorkers func() map[string]uint32
+	// HubWg represents the hub's waitgroup.
+	HubWg *sync.WaitGroup
+}
+
+// StatsRecorder periodically persists snapshots of the pool's mining
+// activity for historical charts.
+type StatsRecorder struct {
+	recording int32 // update atomically.
+
+	cfg *StatsRecorderConfig
+	wg  sync.WaitGroup
+}
+
+// NewStatsRecorder creates a stats recorder.
+func NewStatsRecorder(sCfg *StatsRecorderConfig) *StatsRecorder {
+	return &StatsRecorder{cfg: sCfg}
+}
+
+// sample takes a snapshot of the pool's mining activity.
+func (sr *StatsRecorder) sample(now time.Time) *StatsSample {
+	hashRate, clientInfo := sr.cfg.FetchPoolHashRate()
+	hashRateF, _ := hashRate.Float64()
+	sample := &StatsSample{
+		Time:              now.UnixNano(),
+		HashRate:          hashRateF,
+		NetworkDifficulty: sr.cfg.FetchNetworkDifficulty(),
+		Clients:           make(map[string]uint32),
+		Workers:           sr.cfg.FetchOnlineWorkers(),
+		Samples:           1,
+	}
+	for miner, clients := range clientInfo {
+		sample.Clients[miner] = uint32(len(clients))
+	}
+	return sample
+}
+
+// record persists a snapshot of the pool's mining activity and prunes old
+// samples. The snapshot is skipped if the previous one is still being
+// persisted, a busy database does not queue up snapshots.
+func (sr *StatsRecorder) record(now time.Time) bool {
+	if !atomic.CompareAndSwapInt32(&sr.recording, 0, 1) {
+		log.Warnf("Stats recording in progress, skipping sample")
+		return false
+	}
+	sample := sr.sample(now)
+	sr.wg.Add(1)
+	go func() {
+		defer sr.wg.Done()
+		defer atomic.StoreInt32(&sr.recording, 0)
+		err := sr.cfg.DB.Update(func(tx *bolt.Tx) error {
+			bkt, err := fetchStatsBucket(tx)
+			if err != nil {
+				return err
+			}
+			err = putStatsSample(bkt, sample)
+			if err != nil {
+				return err
+			}
+			return pruneStats(tx, now)
+		})
+		if err != nil {
+			log.Errorf("unable to record pool stats: %v", err)
+		}
+	}()
+	return true
+}
+
+// run periodically records pool stats. It must be run as a goroutine.
+func (sr *StatsRecorder) run(ctx context.Context) {
+	ticker := time.NewTicker(sr.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			sr.wg.Wait()
+			sr.cfg.HubWg.Done()
+			return
+
+		case now := <-ticker.C:
+			sr.record(now)
+		}
+	}
+}
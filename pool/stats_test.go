@@ -0,0 +1,100 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func testStatsRecorder(t *testing.T, db *bolt.DB) {
+	var hashRate int64
+	rCfg := &StatsRecorderConfig{
+		DB:       db,
+		Interval: time.Minute,
+		FetchPoolHashRate: func() (*big.Rat, map[string][]*ClientInfo) {
+			hashRate += 100
+			return new(big.Rat).SetInt64(hashRate), map[string][]*ClientInfo{
+				CPU: {{Miner: CPU}, {Miner: CPU}},
+			}
+		},
+		FetchNetworkDifficulty: func() float64 {
+			return 10
+		},
+		FetchOnlineWorkers: func() map[string]uint32 {
+			return map[string]uint32{xID: 1}
+		},
+		HubWg: new(sync.WaitGroup),
+	}
+	sr := NewStatsRecorder(rCfg)
+
+	// Ensure samples are skipped while a sample is being persisted.
+	atomic.StoreInt32(&sr.recording, 1)
+	if sr.record(time.Now()) {
+		t.Fatal("[record] expected the sample to be skipped")
+	}
+	atomic.StoreInt32(&sr.recording, 0)
+
+	now := time.Now()
+	expired := now.Add(-(statsRollupRetention + time.Hour*24))
+	old := now.Add(-(statsRawRetention + time.Hour*2)).Truncate(statsRollupPeriod)
+	for _, sampleTime := range []time.Time{expired, old,
+		old.Add(time.Minute * 10), now} {
+		if !sr.record(sampleTime) {
+			t.Fatal("[record] expected the sample to be recorded")
+		}
+		sr.wg.Wait()
+	}
+
+	// Ensure raw samples past the raw retention period are rolled up and
+	// rollups past the rollup retention period are pruned.
+	samples, err := fetchStatsSamples(db, 0, now.UnixNano())
+	if err != nil {
+		t.Fatalf("[fetchStatsSamples] unexpected error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 stats samples, got %d", len(samples))
+	}
+	rollup := samples[0]
+	if rollup.Time != old.UnixNano() || rollup.Samples != 2 {
+		t.Fatalf("expected a rollup of 2 samples at %d, got %d samples "+
+			"at %d", old.UnixNano(), rollup.Samples, rollup.Time)
+	}
+	if rollup.HashRate != 250 || rollup.NetworkDifficulty != 10 {
+		t.Fatalf("unexpected rollup hash rate %v and network "+
+			"difficulty %v", rollup.HashRate, rollup.NetworkDifficulty)
+	}
+	if rollup.Clients[CPU] != 2 || rollup.Workers[xID] != 1 {
+		t.Fatalf("unexpected rollup clients %v and workers %v",
+			rollup.Clients, rollup.Workers)
+	}
+	if samples[1].Time != now.UnixNano() || samples[1].HashRate != 400 {
+		t.Fatalf("expected the latest raw sample, got %v", samples[1])
+	}
+
+	// Ensure samples are queried by range.
+	samples, err = fetchStatsSamples(db, now.Add(-time.Hour).UnixNano(),
+		now.UnixNano())
+	if err != nil {
+		t.Fatalf("[fetchStatsSamples] unexpected error: %v", err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("expected 1 stats sample, got %d", len(samples))
+	}
+
+	err = emptyBucket(db, statsBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, statsRollupBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+)
+
+// submissionDigestLen is the number of leading block hash bytes recorded as
+// the digest of an accepted submission.
+const submissionDigestLen = 8
+
+// maxJobSubmissions is the maximum number of accepted submissions recorded
+// per job, bounding the size of the submission records.
+var maxJobSubmissions uint32 = 1 << 16
+
+// fetchSubmissionBucket is a helper function for getting the submission
+// bucket.
+func fetchSubmissionBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(submissionBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(submissionBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// submissionKey returns the key of the accepted submission of the provided
+// job solving to the provided block hash. Keys are prefixed by the job id
+// so they sort by job height like jobs do.
+func submissionKey(jobID string, hash *chainhash.Hash) []byte {
+	key := make([]byte, 0, len(jobID)+submissionDigestLen)
+	key = append(key, jobID...)
+	return append(key, hash[:submissionDigestLen]...)
+}
+
+// recordSubmission records the accepted submission of the provided job
+// solving to the provided block hash, returning an ErrDuplicateSubmission
+// error if it was recorded before. The records persist across restarts
+// until the job is pruned. It returns false if the submission was not
+// recorded because the job reached the maximum number of recorded
+// submissions.
+//
+// Records are written in batched transactions so submissions accepted
+// concurrently share a commit.
+func recordSubmission(db *bolt.DB, jobID string, hash *chainhash.Hash) (bool, error) {
+	key := submissionKey(jobID, hash)
+	countK := []byte(jobID)
+	var recorded bool
+	err := db.Batch(func(tx *bolt.Tx) error {
+		recorded = false
+		bkt, err := fetchSubmissionBucket(tx)
+		if err != nil {
+			return err
+		}
+		if bkt.Get(key) != nil {
+			desc := fmt.Sprintf("submission %s of job %s already recorded",
+				hash, jobID)
+			return MakeError(ErrDuplicateSubmission, desc, nil)
+		}
+		var count uint32
+		if v := bkt.Get(countK); v != nil {
+			count = binary.LittleEndian.Uint32(v)
+		}
+		if count >= maxJobSubmissions {
+			return nil
+		}
+		err = bkt.Put(key, []byte{})
+		if err != nil {
+			return err
+		}
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, count+1)
+		recorded = true
+		return bkt.Put(countK, b)
+	})
+	return recorded, err
+}
+
+// deleteJobSubmissions removes the recorded submissions of the job with
+// the provided id.
+func deleteJobSubmissions(tx *bolt.Tx, jobID string) error {
+	bkt, err := fetchSubmissionBucket(tx)
+	if err != nil {
+		return err
+	}
+	prefix := []byte(jobID)
+	toDelete := [][]byte{}
+	c := bkt.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		toDelete = append(toDelete, k)
+	}
+	for _, k := range toDelete {
+		err := bkt.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneSubmissions removes the recorded submissions of all jobs with
+// heights less than the provided big endian height.
+func pruneSubmissions(tx *bolt.Tx, heightBE []byte) error {
+	bkt, err := fetchSubmissionBucket(tx)
+	if err != nil {
+		return err
+	}
+	toDelete := [][]byte{}
+	c := bkt.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		height, err := hex.DecodeString(string(k[:8]))
+		if err != nil {
+			return err
+		}
+		if bytes.Compare(height, heightBE) >= 0 {
+			break
+		}
+		toDelete = append(toDelete, k)
+	}
+	for _, k := range toDelete {
+		err := bkt.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
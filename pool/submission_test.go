@@ -0,0 +1,172 @@
+package pool
+
+import (
+	"math/big"
+	"net"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+func testSubmissionReplay(t *testing.T, db *bolt.DB) {
+	powLimit := chaincfg.SimNetParams().PowLimit
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+
+	// Lower the network target of the work so shares are not blocks.
+	workE = workE[:232] + "ffff001e" + workE[240:]
+	diff := int64(1 << 8)
+	newConfig := func(registry *clientRegistry) *ClientConfig {
+		return &ClientConfig{
+			ActiveNet:   chaincfg.SimNetParams(),
+			DB:          db,
+			SoloPool:    true,
+			Blake256Pad: generateBlake256Pad(),
+			DifficultyInfo: &DifficultyInfo{
+				target:     new(big.Rat).SetFrac(powLimit, big.NewInt(diff)),
+				difficulty: new(big.Rat).SetInt64(diff),
+				powLimit:   new(big.Rat).SetInt(powLimit),
+				multiplier: new(big.Rat).SetInt64(1),
+			},
+			FetchMiner: func() string {
+				return CPU
+			},
+			FetchMinerPolicy: func() string {
+				return PolicyAllow
+			},
+			RegisterClient:   registry.register,
+			DeregisterClient: registry.deregister,
+			RemoveClient:     func(*Client) {},
+			SubmitWork: func(*string) (bool, string, error) {
+				return false, "", nil
+			},
+			FetchCurrentWork: func() *CurrentWork {
+				return &CurrentWork{Header: workE, Height: 41}
+			},
+			WithinLimit: func(string, int, float64) bool {
+				return true
+			},
+			HashCalcThreshold: 1,
+			WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+				return 0
+			},
+			IsTraced: func(string, string) bool {
+				return false
+			},
+			Events:   NewEventBus(),
+			Sessions: NewSessionStore(),
+		}
+	}
+
+	// Ensure a share replayed to the same pool is rejected as a duplicate.
+	registry := newClientRegistry()
+	client, m := pipeMiner(t, newConfig(registry), CPU)
+	m.subscribe()
+	status, sErr := m.authorize("tm", xAddr)
+	if !status {
+		t.Fatalf("unexpected authorize error: %v", sErr)
+	}
+	job := m.awaitWork()
+	extraNonce2, nTime, nonce := m.solve(job)
+	status, sErr = m.submit(job, extraNonce2, nTime, nonce)
+	if !status {
+		t.Fatalf("expected an accepted share, got %v", sErr)
+	}
+	status, sErr = m.submit(job, extraNonce2, nTime, nonce)
+	if status || sErr == nil || sErr.Code != DuplicateShare {
+		t.Fatalf("expected a duplicate share error, got %v", sErr)
+	}
+
+	// Restart the pool and ensure the share replayed by a miner assigned
+	// the same extraNonce1 is still rejected as a duplicate while new
+	// shares are accepted.
+	extraNonce1 := client.extraNonce1
+	client.cancel()
+	if !registry.wait(testMinerTimeout) {
+		t.Fatal("expected the client to shut down")
+	}
+	registry = newClientRegistry()
+	server, conn := net.Pipe()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4000}
+	client, err := NewClient(server, addr, newConfig(registry))
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+	client.extraNonce1 = extraNonce1
+	go client.run(client.ctx)
+	replay := newTestMiner(t, conn, CPU)
+	replay.nonce = m.nonce
+	replay.subscribe()
+	status, sErr = replay.authorize("tm", xAddr)
+	if !status {
+		t.Fatalf("unexpected authorize error: %v", sErr)
+	}
+	replay.awaitWork()
+	status, sErr = replay.submit(job, extraNonce2, nTime, nonce)
+	if status || sErr == nil || sErr.Code != DuplicateShare {
+		t.Fatalf("expected a duplicate share error after a restart, got %v",
+			sErr)
+	}
+	extraNonce2, nTime, nonce = replay.solve(job)
+	status, sErr = replay.submit(job, extraNonce2, nTime, nonce)
+	if !status {
+		t.Fatalf("expected an accepted share, got %v", sErr)
+	}
+	client.cancel()
+	if !registry.wait(testMinerTimeout) {
+		t.Fatal("expected the client to shut down")
+	}
+
+	// Ensure recorded submissions are pruned along with their jobs.
+	hash := chainhash.HashH([]byte("submission"))
+	_, err = recordSubmission(db, job.id, &hash)
+	if err != nil {
+		t.Fatalf("[recordSubmission] unexpected error: %v", err)
+	}
+	err = PruneJobs(db, 42)
+	if err != nil {
+		t.Fatalf("[PruneJobs] unexpected error: %v", err)
+	}
+	recorded, err := recordSubmission(db, job.id, &hash)
+	if err != nil {
+		t.Fatalf("[recordSubmission] unexpected error after pruning: %v",
+			err)
+	}
+	if !recorded {
+		t.Fatal("expected the submission to be recorded")
+	}
+
+	// Ensure submissions beyond the maximum recorded per job are not
+	// recorded.
+	maxSubmissions := maxJobSubmissions
+	maxJobSubmissions = 1
+	defer func() {
+		maxJobSubmissions = maxSubmissions
+	}()
+	other := chainhash.HashH([]byte("other"))
+	for i := 0; i < 2; i++ {
+		recorded, err = recordSubmission(db, job.id, &other)
+		if err != nil {
+			t.Fatalf("[recordSubmission] unexpected error: %v", err)
+		}
+		if recorded {
+			t.Fatal("expected the submission not to be recorded")
+		}
+	}
+
+	for _, bkt := range [][]byte{jobBkt, submissionBkt} {
+		err = emptyBucket(db, bkt)
+		if err != nil {
+			t.Fatalf("emptyBucket error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+	"github.com/Eacred/eacrd/dcrec"
+	"github.com/Eacred/eacrd/dcrutil"
+	chainjson "github.com/Eacred/eacrd/rpc/jsonrpc/types"
+	"github.com/Eacred/eacrd/wire"
+)
+
+// TestHubConfig represents configuration details for a test hub.
+type TestHubConfig struct {
+	// ActiveNet represents the network mined on.
+	ActiveNet *chaincfg.Params
+	// GetWork returns the work served by the stubbed consensus daemon, the
+	// initial work of the hub is fetched from it.
+	GetWork func() (string, error)
+	// SubmitWork receives the solved work submitted to the stubbed
+	// consensus daemon and returns whether it is accepted. Submissions are
+	// rejected if it is nil.
+	SubmitWork func(data string) (bool, error)
+	// Configure adjusts the hub configuration of the test hub before the
+	// hub is created, nil keeps the defaults.
+	Configure func(*HubConfig)
+}
+
+// testChain is a consensus daemon client serving the work of a test hub.
+type testChain struct {
+	cfg *TestHubConfig
+}
+
+// testChainError returns the error of consensus daemon requests a test hub
+// does not serve.
+func testChainError(request string) error {
+	desc := request + " is not served by test hubs"
+	return MakeError(ErrNotSupported, desc, nil)
+}
+
+// GetWork returns the work of the work stub of the test hub.
+func (c *testChain) GetWork() (*chainjson.GetWorkResult, error) {
+	work, err := c.cfg.GetWork()
+	if err != nil {
+		return nil, err
+	}
+	return &chainjson.GetWorkResult{Data: work}, nil
+}
+
+// GetWorkSubmit submits the provided solved work to the submit stub of the
+// test hub, the work is rejected if the test hub has no submit stub.
+func (c *testChain) GetWorkSubmit(data string) (bool, error) {
+	if c.cfg.SubmitWork == nil {
+		return false, nil
+	}
+	return c.cfg.SubmitWork(data)
+}
+
+// GetBlock is not served by test hubs, it always returns an error.
+func (c *testChain) GetBlock(*chainhash.Hash) (*wire.MsgBlock, error) {
+	return nil, testChainError("getblock")
+}
+
+// GetBestBlock is not served by test hubs, it always returns an error.
+func (c *testChain) GetBestBlock() (*chainhash.Hash, int64, error) {
+	return nil, 0, testChainError("getbestblock")
+}
+
+// GetBlockHash is not served by test hubs, it always returns an error.
+func (c *testChain) GetBlockHash(int64) (*chainhash.Hash, error) {
+	return nil, testChainError("getblockhash")
+}
+
+// GetBlockHeader is not served by test hubs, it always returns an error.
+func (c *testChain) GetBlockHeader(*chainhash.Hash) (*wire.BlockHeader, error) {
+	return nil, testChainError("getblockheader")
+}
+
+// GetBlockChainInfo is not served by test hubs, it always returns an
+// error.
+func (c *testChain) GetBlockChainInfo() (*chainjson.GetBlockChainInfoResult, error) {
+	return nil, testChainError("getblockchaininfo")
+}
+
+// testWallet is a wallet with a fixed balance which publishes nothing.
+type testWallet struct{}
+
+// Ping always succeeds, the test wallet is always reachable.
+func (testWallet) Ping(context.Context) error {
+	return nil
+}
+
+// SpendableBalance returns the fixed balance of the test wallet.
+func (testWallet) SpendableBalance(context.Context) (dcrutil.Amount, error) {
+	return dcrutil.Amount(1e8), nil
+}
+
+// PublishTransaction is not served by test wallets, it always returns an
+// error.
+func (testWallet) PublishTransaction(context.Context, map[dcrutil.Address]dcrutil.Amount, dcrutil.Amount) (string, error) {
+	desc := "test hubs do not publish transactions"
+	return "", MakeError(ErrNotSupported, desc, nil)
+}
+
+// TestHub represents a pool hub run in-process against a stubbed consensus
+// daemon and wallet, for testing. The hub is not in-memory, its bolt
+// database is file-backed since bolt has no in-memory mode. The database
+// file is created in a temporary directory which Close removes, callers
+// must close the hub to clean it up. Its CPU endpoint listens on a random
+// local port so test hubs of different networks can run in the same
+// process.
+type TestHub struct {
+	*Pool
+	dir string
+}
+
+// testFeeAddress returns a random pool fee address of the provided network.
+func testFeeAddress(net *chaincfg.Params) (dcrutil.Address, error) {
+	pkHash := make([]byte, 20)
+	_, err := rand.Read(pkHash)
+	if err != nil {
+		return nil, err
+	}
+	return dcrutil.NewAddressPubKeyHash(pkHash, net, dcrec.STEcdsaSecp256k1)
+}
+
+// testNonceIterations returns the possible header nonce iterations of the
+// provided network.
+func testNonceIterations(net *chaincfg.Params) float64 {
+	powLimitF, _ := new(big.Float).SetInt(net.PowLimit).Float64()
+	return math.Pow(2, 256-math.Floor(math.Log2(powLimitF)))
+}
+
+// NewTestHub creates a test hub mining on the configured network. The hub
+// is connected to its stubs and listening once NewTestHub returns, it
+// serves miners once run.
+func NewTestHub(cfg *TestHubConfig) (*TestHub, error) {
+	if cfg.ActiveNet == nil || cfg.GetWork == nil {
+		desc := "test hubs require a network and a work stub"
+		return nil, MakeError(ErrOther, desc, nil)
+	}
+	feeAddr, err := testFeeAddress(cfg.ActiveNet)
+	if err != nil {
+		return nil, err
+	}
+	hcfg := &HubConfig{
+		ActiveNet:       cfg.ActiveNet,
+		ChainClient:     &testChain{cfg: cfg},
+		Wallet:          testWallet{},
+		PoolFee:         0.1,
+		PoolFeeAddrs:    []dcrutil.Address{feeAddr},
+		PaymentMethod:   PPS,
+		LastNPeriod:     120,
+		MinPayment:      dcrutil.Amount(2e8),
+		MaxTxFeeReserve: dcrutil.Amount(1e7),
+		MaxGenTime:      20,
+		NonceIterations: testNonceIterations(cfg.ActiveNet),
+		// Test miners all connect from the local host.
+		MaxConnectionsPerHost: 16,
+		MinerPorts:            map[string]uint32{CPU: 0},
+		ListenAddrs: map[uint32][]string{
+			0: {"127.0.0.1:0"},
+		},
+	}
+	if cfg.Configure != nil {
+		cfg.Configure(hcfg)
+	}
+	dir, err := ioutil.TempDir("", "eacrpool_testhub")
+	if err != nil {
+		return nil, err
+	}
+	p, err := New(&Config{
+		Hub:    hcfg,
+		DBFile: filepath.Join(dir, "pool.kv"),
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &TestHub{Pool: p, dir: dir}, nil
+}
+
+// Addr returns the address the endpoint of the provided miner listens on,
+// empty if the hub has no listening endpoint for the miner.
+func (th *TestHub) Addr(miner string) string {
+	for _, e := range th.hub.endpoints {
+		if e.miner != miner {
+			continue
+		}
+		for _, l := range e.listeners {
+			if listener := l.fetchListener(); listener != nil {
+				return listener.Addr().String()
+			}
+		}
+	}
+	return ""
+}
+
+// SetWork delivers the provided hex encoded work to the hub as a work
+// notification of a new parent block.
+func (th *TestHub) SetWork(work string) error {
+	if len(work) < wire.MaxBlockHeaderPayload*2 {
+		desc := fmt.Sprintf("work of %d characters is shorter than a "+
+			"block header", len(work))
+		return MakeError(ErrWrongInputLength, desc, nil)
+	}
+	header, err := hex.DecodeString(work[:wire.MaxBlockHeaderPayload*2])
+	if err != nil {
+		return err
+	}
+	th.hub.HandleWork(header, NewParent)
+	return nil
+}
+
+// Close shuts the hub down and removes its database.
+func (th *TestHub) Close() error {
+	th.Shutdown()
+	return os.RemoveAll(th.dir)
+}
@@ -0,0 +1,108 @@
+package pool
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/Eacred/eacrd/chaincfg"
+)
+
+// TestHubNetworks runs a simnet and a testnet hub in the same process,
+// ensuring each serves miners of its own network only.
+func TestHubNetworks(t *testing.T) {
+	var submitted []string
+	var submittedMtx sync.Mutex
+	nets := []*chaincfg.Params{chaincfg.SimNetParams(),
+		chaincfg.TestNet3Params()}
+	hubs := make([]*TestHub, len(nets))
+	for idx, params := range nets {
+		th, err := NewTestHub(&TestHubConfig{
+			ActiveNet: params,
+			GetWork: func() (string, error) {
+				return fastPathWorkE, nil
+			},
+			SubmitWork: func(data string) (bool, error) {
+				submittedMtx.Lock()
+				submitted = append(submitted, data)
+				submittedMtx.Unlock()
+				return false, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("[NewTestHub] unexpected error: %v", err)
+		}
+		defer th.Close()
+		hubs[idx] = th
+		go th.Run(context.Background())
+	}
+	_, err := NewTestHub(&TestHubConfig{ActiveNet: nets[0]})
+	if err == nil {
+		t.Fatal("expected a test hub without a work stub to be refused")
+	}
+	err = hubs[0].SetWork("07000000")
+	if !IsError(err, ErrWrongInputLength) {
+		t.Fatalf("expected a wrong input length error, got %v", err)
+	}
+
+	for idx, th := range hubs {
+		params := nets[idx]
+		if th.Hub().cfg.ActiveNet.Name != params.Name {
+			t.Fatalf("expected a %s hub, got %s", params.Name,
+				th.Hub().cfg.ActiveNet.Name)
+		}
+		connect := func() *testMiner {
+			conn, err := net.Dial("tcp", th.Addr(CPU))
+			if err != nil {
+				t.Fatalf("[Dial] unexpected error: %v", err)
+			}
+			m := newTestMiner(t, conn, CPU)
+			m.net = params
+			m.subscribe()
+			return m
+		}
+
+		// Ensure miners of the network of the hub are authorized and
+		// sent work.
+		_, address := newSigningKey(t, params)
+		m := connect()
+		defer m.conn.Close()
+		status, sErr := m.authorize("rig1", address)
+		if !status {
+			t.Fatalf("expected a %s address to be authorized, got %v",
+				params.Name, sErr)
+		}
+		job := m.awaitWork()
+
+		// Ensure work notified to the hub reaches its miners.
+		err = th.SetWork(fastPathWorkE)
+		if err != nil {
+			t.Fatalf("[SetWork] unexpected error: %v", err)
+		}
+		job = m.awaitWork()
+
+		// Ensure miners of the other network are refused.
+		_, address = newSigningKey(t, nets[(idx+1)%len(nets)])
+		other := connect()
+		defer other.conn.Close()
+		status, _ = other.authorize("rig1", address)
+		if status {
+			t.Fatalf("expected a foreign address to be refused by the %s "+
+				"hub", params.Name)
+		}
+
+		// Ensure blocks solved on simnet are submitted to the stubbed
+		// consensus daemon.
+		if params.Name != chaincfg.SimNetParams().Name {
+			continue
+		}
+		extraNonce2, nTime, nonce := m.solveBlock(job)
+		m.submit(job, extraNonce2, nTime, nonce)
+		submittedMtx.Lock()
+		if len(submitted) != 1 {
+			t.Fatalf("expected 1 submitted block, got %d", len(submitted))
+		}
+		submittedMtx.Unlock()
+	}
+}
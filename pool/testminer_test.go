@@ -0,0 +1,543 @@
+package pool
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/Eacred/eacrd/blockchain/standalone"
+	"github.com/Eacred/eacrd/chaincfg"
+	"github.com/Eacred/eacrd/dcrutil"
+)
+
+// testMinerTimeout is the period a test miner waits for a message from the
+// pool client before failing the test.
+const testMinerTimeout = time.Second * 5
+
+// testMinerJob represents work notified to a test miner. The header is the
+// block header the miner reconstructed from the notification, in the byte
+// order used by the pool.
+type testMinerJob struct {
+	id     string
+	header string
+	clean  bool
+}
+
+// testMiner is a simulated mining client for end-to-end stratum tests. It
+// speaks stratum to a pool client in the format of its miner type, tracks
+// the subscription, difficulty and work notified to it and produces shares
+// for notified work.
+type testMiner struct {
+	t      *testing.T
+	miner  string
+	net    *chaincfg.Params
+	conn   net.Conn
+	recvCh chan []byte
+	id     uint64
+	nonce  uint32
+
+	// writeDelay delays every frame written to the pool client, simulating
+	// a slow or stalling miner.
+	writeDelay time.Duration
+
+	// requestedSize represents the extraNonce2 size requested by the
+	// miner when subscribing, zero to request none.
+	requestedSize int
+
+	extraNonce1     string
+	extraNonce2Size uint64
+	difficulty      uint64
+	job             *testMinerJob
+	notified        int
+	messages        []string
+}
+
+// newTestMiner creates a test miner of the provided miner type speaking
+// stratum over the provided connection.
+func newTestMiner(t *testing.T, conn net.Conn, miner string) *testMiner {
+	m := &testMiner{
+		t:      t,
+		miner:  miner,
+		net:    testNet,
+		conn:   conn,
+		recvCh: make(chan []byte, 16),
+	}
+	go func() {
+		defer close(m.recvCh)
+		r := bufio.NewReaderSize(conn, MaxReadMessageSize)
+		for {
+			data, err := r.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			m.recvCh <- data
+		}
+	}()
+	return m
+}
+
+// pipeMiner runs a pool client with the provided config connected to a test
+// miner of the provided miner type over an in-memory connection.
+func pipeMiner(t *testing.T, cfg *ClientConfig, miner string) (*Client, *testMiner) {
+	server, conn := net.Pipe()
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4000}
+	client, err := NewClient(server, addr, cfg)
+	if err != nil {
+		t.Fatalf("[NewClient] unexpected error: %v", err)
+	}
+	go client.run(client.ctx)
+	return client, newTestMiner(t, conn, miner)
+}
+
+// nextID returns the id of the next request sent by the miner.
+func (m *testMiner) nextID() uint64 {
+	m.id++
+	return m.id
+}
+
+// sendRaw writes the provided frame to the pool client as is, allowing
+// malformed frames to be injected.
+func (m *testMiner) sendRaw(data []byte) {
+	if m.writeDelay > 0 {
+		time.Sleep(m.writeDelay)
+	}
+	err := m.conn.SetWriteDeadline(time.Now().Add(testMinerTimeout))
+	if err != nil {
+		m.t.Fatalf("[SetWriteDeadline] unexpected error: %v", err)
+	}
+	_, err = m.conn.Write(data)
+	if err != nil {
+		m.t.Fatalf("[Write] unexpected error: %v", err)
+	}
+}
+
+// send writes the provided request to the pool client.
+func (m *testMiner) send(req *Request) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		m.t.Fatalf("[Marshal] unexpected error: %v", err)
+	}
+	m.sendRaw(append(data, '\n'))
+}
+
+// next returns the next message received from the pool client. Received
+// notifications update the state of the miner before being returned.
+func (m *testMiner) next() (Message, int) {
+	var data []byte
+	select {
+	case d, ok := <-m.recvCh:
+		if !ok {
+			m.t.Fatal("the pool client closed the connection")
+		}
+		data = d
+	case <-time.After(testMinerTimeout):
+		m.t.Fatal("timed out waiting for a message from the pool client")
+	}
+	msg, mType, err := IdentifyMessage(data)
+	if err != nil {
+		m.t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+	}
+	if mType == NotificationMessage {
+		m.handleNotification(msg.(*Request))
+	}
+	return msg, mType
+}
+
+// handleNotification updates the state of the miner from the provided
+// notification.
+func (m *testMiner) handleNotification(req *Request) {
+	switch req.Method {
+	case SetDifficulty:
+		diff, err := ParseSetDifficultyNotification(req)
+		if err != nil {
+			m.t.Fatalf("[ParseSetDifficultyNotification] unexpected "+
+				"error: %v", err)
+		}
+		m.difficulty = diff
+
+	case Notify:
+		jobID, prevBlock, genTx1, genTx2, blockVersion, nBits, nTime,
+			clean, err := ParseWorkNotification(req)
+		if err != nil {
+			m.t.Fatalf("[ParseWorkNotification] unexpected error: %v", err)
+		}
+
+		// Miners other than the cpu miner receive the previous block hash
+		// with its words reversed and, except for the D1, the nBits and
+		// nTime fields as big endian.
+		if m.miner != CPU {
+			prevBlock = reversePrevBlockWords(prevBlock)
+		}
+		switch m.miner {
+		case AntminerDR3, AntminerDR5, InnosiliconD9:
+			nBits, err = hexReversed(nBits)
+			if err != nil {
+				m.t.Fatalf("[hexReversed] unexpected error: %v", err)
+			}
+			nTime, err = hexReversed(nTime)
+			if err != nil {
+				m.t.Fatalf("[hexReversed] unexpected error: %v", err)
+			}
+		}
+		header := blockVersion + prevBlock + genTx1 +
+			strings.Repeat("0", 64) + genTx2
+		if len(header) != 360 {
+			m.t.Fatalf("expected a 180-byte header, got %d bytes",
+				len(header)/2)
+		}
+		if header[232:240] != nBits || header[272:280] != nTime {
+			m.t.Fatalf("notified nBits %s and nTime %s do not match the "+
+				"header fields %s and %s", nBits, nTime, header[232:240],
+				header[272:280])
+		}
+		m.job = &testMinerJob{id: jobID, header: header, clean: clean}
+		m.notified++
+
+	case ShowMessage:
+		message, err := ParseShowMessageNotification(req)
+		if err != nil {
+			m.t.Fatalf("[ParseShowMessageNotification] unexpected "+
+				"error: %v", err)
+		}
+		m.messages = append(m.messages, message)
+
+	default:
+		m.t.Fatalf("unexpected notification method %s", req.Method)
+	}
+}
+
+// awaitResponse returns the response to the request with the provided id,
+// processing the notifications received before it.
+func (m *testMiner) awaitResponse(id uint64) *Response {
+	for {
+		msg, mType := m.next()
+		if mType != ResponseMessage {
+			continue
+		}
+		resp := msg.(*Response)
+		if resp.ID != id {
+			m.t.Fatalf("expected a response with id %d, got %d", id, resp.ID)
+		}
+		return resp
+	}
+}
+
+// awaitWork returns the next work notified to the miner.
+func (m *testMiner) awaitWork() *testMinerJob {
+	for {
+		msg, mType := m.next()
+		if mType == NotificationMessage && msg.(*Request).Method == Notify {
+			return m.job
+		}
+	}
+}
+
+// awaitDisconnect asserts the pool client closes the connection, messages
+// received before are discarded.
+func (m *testMiner) awaitDisconnect() {
+	timeout := time.After(testMinerTimeout)
+	for {
+		select {
+		case _, ok := <-m.recvCh:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			m.t.Fatal("expected the pool client to close the connection")
+		}
+	}
+}
+
+// subscribe subscribes the miner to the pool client.
+func (m *testMiner) subscribe() {
+	id := m.nextID()
+	req := SubscribeRequest(&id, "mcpu", "1.0.1", "")
+	if m.requestedSize > 0 {
+		req = ExtraNonce2SubscribeRequest(&id, "mcpu", "1.0.1", "",
+			m.requestedSize)
+	}
+	m.send(req)
+	resp := m.awaitResponse(id)
+	if resp.Error != nil {
+		m.t.Fatalf("unexpected subscribe error: %v", resp.Error)
+	}
+	_, _, extraNonce1, extraNonce2Size, err := ParseSubscribeResponse(resp)
+	if err != nil {
+		m.t.Fatalf("[ParseSubscribeResponse] unexpected error: %v", err)
+	}
+	m.extraNonce1 = extraNonce1
+	m.extraNonce2Size = extraNonce2Size
+}
+
+// authorize authorizes the provided worker of the provided address with the
+// pool client.
+func (m *testMiner) authorize(name string, address string) (bool, *StratumError) {
+	id := m.nextID()
+	m.send(AuthorizeRequest(&id, name, address))
+	status, sErr, err := ParseAuthorizeResponse(m.awaitResponse(id))
+	if err != nil {
+		m.t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+	}
+	return status, sErr
+}
+
+// solve grinds a nonce for the provided job meeting the difficulty notified
+// to the miner, continuing from the last nonce tried so every share solved
+// is distinct. The extraNonce2, nTime and nonce of the share are returned in
+// the format submitted by the miner.
+func (m *testMiner) solve(job *testMinerJob) (string, string, string) {
+	return m.grind(job, false)
+}
+
+// solveBlock grinds a nonce for the provided job meeting both the difficulty
+// notified to the miner and the network target of the job.
+func (m *testMiner) solveBlock(job *testMinerJob) (string, string, string) {
+	return m.grind(job, true)
+}
+
+// grind searches for a nonce solving the provided job, optionally at the
+// network target of the job as well.
+func (m *testMiner) grind(job *testMinerJob, block bool) (string, string, string) {
+	// Miners using a padded extraNonce1 overwrite the padding with their
+	// extraNonce2 and submit it along with the extraNonce1.
+	extraNonce1 := m.extraNonce1[len(m.extraNonce1)-8:]
+	extraNonce2 := strings.Repeat("0", int(m.extraNonce2Size)*2)
+	if padding := len(m.extraNonce1) - 8; padding > 0 {
+		extraNonce2 = strings.Repeat("0", padding) + extraNonce1
+	}
+	diff := new(big.Int).SetUint64(m.difficulty)
+	if diff.Sign() == 0 {
+		diff.SetInt64(1)
+	}
+	target := new(big.Int).Div(m.net.PowLimit, diff)
+	nTime := job.header[272:280]
+	if m.miner != CPU {
+		var err error
+		nTime, err = hexReversed(nTime)
+		if err != nil {
+			m.t.Fatalf("[hexReversed] unexpected error: %v", err)
+		}
+	}
+	for i := 0; i < 1<<20; i++ {
+		nonce := fmt.Sprintf("%08x", m.nonce)
+		m.nonce++
+		header, err := GenerateSolvedBlockHeader(job.header, extraNonce1,
+			extraNonce2, int(m.extraNonce2Size), nTime, nonce, m.miner)
+		if err != nil {
+			m.t.Fatalf("[GenerateSolvedBlockHeader] unexpected error: %v", err)
+		}
+		hash := header.BlockHash()
+		hashNum := standalone.HashToBig(&hash)
+		if hashNum.Cmp(target) > 0 {
+			continue
+		}
+		if block && hashNum.Cmp(standalone.CompactToBig(header.Bits)) > 0 {
+			continue
+		}
+		return extraNonce2, nTime, nonce
+	}
+	m.t.Fatalf("unable to solve job %s", job.id)
+	return "", "", ""
+}
+
+// submit submits the provided share of the provided job to the pool client.
+func (m *testMiner) submit(job *testMinerJob, extraNonce2 string, nTime string, nonce string) (bool, *StratumError) {
+	id := m.nextID()
+	m.send(SubmitWorkRequest(&id, "tm", job.id, extraNonce2, nTime, nonce))
+	status, sErr, err := ParseSubmitWorkResponse(m.awaitResponse(id))
+	if err != nil {
+		m.t.Fatalf("[ParseSubmitWorkResponse] unexpected error: %v", err)
+	}
+	return status, sErr
+}
+
+func testMinerQuirks(t *testing.T, db *bolt.DB) {
+	powLimit := chaincfg.SimNetParams().PowLimit
+	workE := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579a" +
+		"f4e3881fc619ec52d64d83e0000bd646e312ff574bc90e08ed91f1" +
+		"d99a85b318cb4464f2a24f9ad2bf3b9881c2bc9c344adde75e89b1" +
+		"4b627acce606e6d652915bdb71dcf5351e8ad6128faab9e0100000" +
+		"00000000000000000000000003e133920204e00000000000029000" +
+		"000a6030000954cee5d00000000000000000000000000000000000" +
+		"000000000000000000000000000000000000000000000800000010" +
+		"0000000000005a0"
+
+	// Lower the network target of the work so shares are not blocks.
+	workE = workE[:232] + "ffff001e" + workE[240:]
+	diff := int64(1 << 8)
+	registry := newClientRegistry()
+	var submitted int
+	var submittedMtx sync.Mutex
+	newConfig := func(miner string) *ClientConfig {
+		return &ClientConfig{
+			ActiveNet:   chaincfg.SimNetParams(),
+			DB:          db,
+			SoloPool:    true,
+			Blake256Pad: generateBlake256Pad(),
+			DifficultyInfo: &DifficultyInfo{
+				target:     new(big.Rat).SetFrac(powLimit, big.NewInt(diff)),
+				difficulty: new(big.Rat).SetInt64(diff),
+				powLimit:   new(big.Rat).SetInt(powLimit),
+				multiplier: new(big.Rat).SetInt64(1),
+			},
+			FetchMiner: func() string {
+				return miner
+			},
+			FetchMinerPolicy: func() string {
+				return PolicyAllow
+			},
+			RegisterClient:   registry.register,
+			DeregisterClient: registry.deregister,
+			RemoveClient:     func(*Client) {},
+			SubmitWork: func(*string) (bool, string, error) {
+				submittedMtx.Lock()
+				submitted++
+				submittedMtx.Unlock()
+				return false, "", nil
+			},
+			FetchCurrentWork: func() *CurrentWork {
+				return &CurrentWork{Header: workE, Height: 41}
+			},
+			WithinLimit: func(string, int, float64) bool {
+				return true
+			},
+			HashCalcThreshold: 1,
+			WorkSubsidy: func(uint32, uint16) dcrutil.Amount {
+				return 0
+			},
+			IsTraced: func(string, string) bool {
+				return false
+			},
+			Events:   NewEventBus(),
+			Sessions: NewSessionStore(),
+		}
+	}
+
+	tests := []struct {
+		miner           string
+		extraNonce1Len  int
+		extraNonce2Size uint64
+		instanceBits    uint32
+		requestedSize   int
+	}{
+		{CPU, 8, ExtraNonce2Size, 0, 0},
+		{AntminerDR3, 24, 8, 0, 0},
+		{WhatsminerD1, 16, ExtraNonce2Size, 0, 0},
+		{InnosiliconD9, 8, ExtraNonce2Size, 0, 0},
+		{CPU, 8, ExtraNonce2Size, MaxInstanceBits, 0},
+		{AntminerDR3, 24, 8, MaxInstanceBits, 0},
+		{WhatsminerD1, 16, ExtraNonce2Size, MaxInstanceBits, 0},
+		{InnosiliconD9, 8, ExtraNonce2Size, MaxInstanceBits, 0},
+
+		// A stratum proxy subdividing the extraNonce2 space among its
+		// workers requests the maximum size, requested sizes out of the
+		// supported range are clamped and miners ignoring the size keep
+		// their size.
+		{CPU, 8, MaxExtraNonce2Size, 0, MaxExtraNonce2Size},
+		{CPU, 8, MaxExtraNonce2Size, 0, MaxExtraNonce2Size + 4},
+		{InnosiliconD9, 8, MinExtraNonce2Size, 0, 1},
+		{AntminerDR3, 24, 8, 0, 16},
+		{WhatsminerD1, 16, ExtraNonce2Size, 0, 16},
+	}
+	for _, test := range tests {
+		cfg := newConfig(test.miner)
+		if test.instanceBits > 0 {
+			cfg.InstanceID = 0xa5
+			cfg.InstanceBits = test.instanceBits
+		}
+		client, m := pipeMiner(t, cfg, test.miner)
+		m.requestedSize = test.requestedSize
+
+		// Ensure the subscription is in the format expected by the miner.
+		m.subscribe()
+		if len(m.extraNonce1) != test.extraNonce1Len ||
+			!strings.HasSuffix(m.extraNonce1, client.extraNonce1) ||
+			m.extraNonce2Size != test.extraNonce2Size {
+			t.Fatalf("%s: expected a %d character extraNonce1 and an "+
+				"extraNonce2 size of %d, got %q and %d", test.miner,
+				test.extraNonce1Len, test.extraNonce2Size, m.extraNonce1,
+				m.extraNonce2Size)
+		}
+
+		// Ensure partitioned extraNonce1s lead with the instance id.
+		if test.instanceBits > 0 &&
+			!strings.HasPrefix(client.extraNonce1, "a5") {
+			t.Fatalf("%s: expected an extraNonce1 of instance a5, got %s",
+				test.miner, client.extraNonce1)
+		}
+		status, sErr := m.authorize("tm", xAddr)
+		if !status {
+			t.Fatalf("%s: unexpected authorize error: %v", test.miner, sErr)
+		}
+
+		// Ensure the initial work is notified in the byte order expected by
+		// the miner and shares solved from it are accepted.
+		job := m.awaitWork()
+		if !job.clean {
+			t.Fatalf("%s: expected a clean job", test.miner)
+		}
+		if m.difficulty != uint64(diff) {
+			t.Fatalf("%s: expected a difficulty of %d, got %d", test.miner,
+				diff, m.difficulty)
+		}
+		for i := 0; i < 3; i++ {
+			extraNonce2, nTime, nonce := m.solve(job)
+			status, sErr = m.submit(job, extraNonce2, nTime, nonce)
+			if !status {
+				t.Fatalf("%s: expected an accepted share, got %v",
+					test.miner, sErr)
+			}
+		}
+
+		// Ensure work rolled after accepted shares is notified as a
+		// non-clean job and shares of the pre-roll job remain accepted.
+		rolled := m.job
+		if m.notified == 1 {
+			rolled = m.awaitWork()
+		}
+		if rolled.clean {
+			t.Fatalf("%s: expected a non-clean rolled job", test.miner)
+		}
+		extraNonce2, nTime, nonce := m.solve(job)
+		status, sErr = m.submit(job, extraNonce2, nTime, nonce)
+		if !status {
+			t.Fatalf("%s: expected an accepted pre-roll share, got %v",
+				test.miner, sErr)
+		}
+
+		// Ensure a slow miner's shares are accepted and a malformed frame
+		// disconnects it.
+		m.writeDelay = time.Millisecond * 50
+		extraNonce2, nTime, nonce = m.solve(job)
+		status, sErr = m.submit(job, extraNonce2, nTime, nonce)
+		if !status {
+			t.Fatalf("%s: expected an accepted share, got %v", test.miner,
+				sErr)
+		}
+		m.writeDelay = 0
+		m.sendRaw([]byte("{\"id\": 1, \"method\": [}\n"))
+		m.awaitDisconnect()
+	}
+	if !registry.wait(testMinerTimeout) {
+		t.Fatal("expected all clients to shut down")
+	}
+	if submitted != 0 {
+		t.Fatalf("expected no block submissions, got %d", submitted)
+	}
+
+	err := emptyBucket(db, jobBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+	err = emptyBucket(db, submissionBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
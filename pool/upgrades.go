@@ -15,21 +15,65 @@ const (
 	// transactionId field to the payments struct for payment tracking purposes.
 	transactionIDVersion = 1
 
+	// paymentTotalVersion is the third version of the database. It tracks
+	// the total amount paid to each account.
+	paymentTotalVersion = 2
+
+	// acceptedWorkRewardVersion is the fourth version of the database. It
+	// adds the reward field to accepted work. Rewards of existing work are
+	// left zero and filled from their blocks when next fetched, since the
+	// consensus daemon may not be reachable during upgrades.
+	acceptedWorkRewardVersion = 3
+
+	// paymentSourceVersion is the fifth version of the database. It adds
+	// the source block hash and share percentage fields to payments. Block
+	// hashes of existing payments are backfilled from confirmed mined work
+	// still on record, share percentages cannot be inferred and are left
+	// unset.
+	paymentSourceVersion = 4
+
+	// workerNameVersion is the sixth version of the database. It rekeys
+	// worker states by their normalized worker names, states of worker
+	// names normalizing to the same name are merged. Workers without a
+	// name are renamed to the first default worker name.
+	workerNameVersion = 5
+
+	// accountIndexVersion is the seventh version of the database. It
+	// indexes pending payments, archived payments and shares by account so
+	// the records of an account are read without scanning the records of
+	// all accounts.
+	accountIndexVersion = 6
+
 	// DBVersion is the latest version of the database that is understood by the
 	// program. Databases with recorded versions higher than this will fail to
 	// open (meaning any upgrades prevent reverting to older software).
-	DBVersion = transactionIDVersion
+	DBVersion = accountIndexVersion
 )
 
-// upgrades maps between old database versions and the upgrade function to
-// upgrade the database to the next version.
-var upgrades = [...]func(tx *bolt.Tx) error{
-	transactionIDVersion - 1: transactionIDUpgrade,
+// migration represents a database schema migration. A migration upgrades
+// the database from the version preceding its version to its version.
+type migration struct {
+	version uint32
+	name    string
+	migrate func(tx *bolt.Tx) error
+}
+
+// migrations represents the registered database migrations, ordered by
+// version. New migrations are appended with the next version and DBVersion
+// updated to match.
+var migrations = []migration{
+	{transactionIDVersion, "transaction id", transactionIDUpgrade},
+	{paymentTotalVersion, "payment total", paymentTotalUpgrade},
+	{acceptedWorkRewardVersion, "accepted work reward",
+		acceptedWorkRewardUpgrade},
+	{paymentSourceVersion, "payment source", paymentSourceUpgrade},
+	{workerNameVersion, "worker name", workerNameUpgrade},
+	{accountIndexVersion, "account index", accountIndexUpgrade},
 }
 
 func fetchDBVersion(tx *bolt.Tx) (uint32, error) {
 	pbkt := tx.Bucket(poolBkt)
-	if poolBkt == nil {
+	if pbkt == nil {
 		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
 		return 0, MakeError(ErrBucketNotFound, desc, nil)
 	}
@@ -43,7 +87,7 @@ func fetchDBVersion(tx *bolt.Tx) (uint32, error) {
 
 func setDBVersion(tx *bolt.Tx, newVersion uint32) error {
 	pbkt := tx.Bucket(poolBkt)
-	if poolBkt == nil {
+	if pbkt == nil {
 		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
 		return MakeError(ErrBucketNotFound, desc, nil)
 	}
@@ -59,19 +103,6 @@ func setDBVersion(tx *bolt.Tx, newVersion uint32) error {
 }
 
 func transactionIDUpgrade(tx *bolt.Tx) error {
-	const oldVersion = 0
-	const newVersion = 1
-
-	dbVersion, err := fetchDBVersion(tx)
-	if err != nil {
-		return err
-	}
-
-	if dbVersion != oldVersion {
-		desc := "transactionIDUpgrade inappropriately called"
-		return MakeError(ErrDBUpgrade, desc, nil)
-	}
-
 	pbkt := tx.Bucket(poolBkt)
 	if pbkt == nil {
 		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
@@ -133,48 +164,340 @@ func transactionIDUpgrade(tx *bolt.Tx) error {
 		}
 	}
 
-	return setDBVersion(tx, newVersion)
+	return nil
 }
 
-// upgradeDB checks whether the any upgrades are necessary before the database is
-// ready for application usage.  If any are, they are performed.
-func upgradeDB(db *bolt.DB) error {
-	var version uint32
-	err := db.View(func(tx *bolt.Tx) error {
-		pbkt := tx.Bucket(poolBkt)
-		if poolBkt == nil {
-			desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+func paymentTotalUpgrade(tx *bolt.Tx) error {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+
+	abkt := pbkt.Bucket(paymentArchiveBkt)
+	if abkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(paymentArchiveBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+
+	tbkt, err := pbkt.CreateBucketIfNotExists(paymentTotalBkt)
+	if err != nil {
+		desc := fmt.Sprintf("failed to create %s bucket",
+			string(paymentTotalBkt))
+		return MakeError(ErrBucketCreate, desc, err)
+	}
+
+	// Tally the totals paid to accounts from all archived payments.
+	aCursor := abkt.Cursor()
+	for k, v := aCursor.First(); k != nil; k, v = aCursor.Next() {
+		var payment Payment
+		err := json.Unmarshal(v, &payment)
+		if err != nil {
+			return err
+		}
+
+		err = addPaymentTotal(tbkt, payment.Account, payment.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func acceptedWorkRewardUpgrade(tx *bolt.Tx) error {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+
+	// Update all entries in the work bucket.
+	//
+	// All rewards for work before the upgrade will be set to zero.
+
+	wbkt := pbkt.Bucket(workBkt)
+	if wbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(workBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+
+	wCursor := wbkt.Cursor()
+	for k, v := wCursor.First(); k != nil; k, v = wCursor.Next() {
+		var work AcceptedWork
+		err := json.Unmarshal(v, &work)
+		if err != nil {
+			return err
+		}
+
+		wBytes, err := json.Marshal(work)
+		if err != nil {
+			return err
+		}
+
+		err = wbkt.Put(k, wBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func paymentSourceUpgrade(tx *bolt.Tx) error {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+
+	wbkt := pbkt.Bucket(workBkt)
+	if wbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(workBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+
+	// Index the block hashes of confirmed mined work by height.
+	hashes := make(map[uint32]string)
+	wCursor := wbkt.Cursor()
+	for k, v := wCursor.First(); k != nil; k, v = wCursor.Next() {
+		var work AcceptedWork
+		err := json.Unmarshal(v, &work)
+		if err != nil {
+			return err
+		}
+		if work.Confirmed {
+			hashes[work.Height] = work.BlockHash
+		}
+	}
+
+	// Backfill the block hashes of entries in the payment and payment
+	// archive buckets funded by mined work still on record.
+	for _, bucket := range [][]byte{paymentBkt, paymentArchiveBkt} {
+		bkt := pbkt.Bucket(bucket)
+		if bkt == nil {
+			desc := fmt.Sprintf("bucket %s not found", string(bucket))
+			return MakeError(ErrBucketNotFound, desc, nil)
+		}
+
+		cursor := bkt.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var payment Payment
+			err := json.Unmarshal(v, &payment)
+			if err != nil {
+				return err
+			}
+			hash, ok := hashes[payment.Height]
+			if !ok || payment.BlockHash != "" {
+				continue
+			}
+			payment.BlockHash = hash
+
+			pBytes, err := json.Marshal(payment)
+			if err != nil {
+				return err
+			}
+
+			// Updating the value of the current key does not
+			// invalidate the cursor.
+			err = bkt.Put(k, pBytes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func workerNameUpgrade(tx *bolt.Tx) error {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+
+	bkt := pbkt.Bucket(workerBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(workerBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+
+	// Normalize the names of all worker states with the default maximum
+	// length, merging states whose names normalize to the same name.
+	workers := make(map[string]*WorkerState)
+	var keys [][]byte
+	cursor := bkt.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		var worker WorkerState
+		err := json.Unmarshal(v, &worker)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, append([]byte(nil), k...))
+		name, _ := NormalizeWorkerName(worker.Name, 0, false)
+		if name == "" {
+			name = defaultWorkerName + "1"
+		}
+		worker.Name = name
+		id := workerID(worker.Account, name)
+		if existing, ok := workers[id]; ok {
+			mergeWorkerState(existing, &worker)
+			continue
+		}
+		workers[id] = &worker
+	}
+
+	for _, k := range keys {
+		err := bkt.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	for id, worker := range workers {
+		wBytes, err := json.Marshal(worker)
+		if err != nil {
+			return err
+		}
+		err = bkt.Put([]byte(id), wBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func accountIndexUpgrade(tx *bolt.Tx) error {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+
+	// Index the entries of the payment, payment archive and share buckets
+	// by the accounts they belong to.
+	indexes := []struct {
+		bucket []byte
+		index  []byte
+	}{
+		{paymentBkt, accountPaymentBkt},
+		{paymentArchiveBkt, accountPaymentArchiveBkt},
+		{shareBkt, accountShareBkt},
+	}
+	for _, idx := range indexes {
+		bkt := pbkt.Bucket(idx.bucket)
+		if bkt == nil {
+			desc := fmt.Sprintf("bucket %s not found", string(idx.bucket))
 			return MakeError(ErrBucketNotFound, desc, nil)
 		}
-		v := pbkt.Get(versionK)
-		if v == nil {
-			return MakeError(ErrValueNotFound, "db version not set", nil)
+		ibkt, err := pbkt.CreateBucketIfNotExists(idx.index)
+		if err != nil {
+			desc := fmt.Sprintf("failed to create %s bucket",
+				string(idx.index))
+			return MakeError(ErrBucketCreate, desc, err)
+		}
+
+		cursor := bkt.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var entry struct {
+				Account string `json:"account"`
+			}
+			err := json.Unmarshal(v, &entry)
+			if err != nil {
+				return err
+			}
+			err = ibkt.Put(append([]byte(entry.Account), k...), []byte{})
+			if err != nil {
+				return err
+			}
 		}
+	}
 
-		version = binary.LittleEndian.Uint32(v)
+	return nil
+}
 
-		return nil
-	})
+// validateMigrations ensures the provided migrations have consecutive
+// versions starting from the version following the initial version.
+func validateMigrations(migrations []migration) error {
+	for idx, m := range migrations {
+		if m.version != uint32(initialVersion+idx+1) {
+			desc := fmt.Sprintf("%s migration has version %d, expected "+
+				"version %d", m.name, m.version, initialVersion+idx+1)
+			return MakeError(ErrDBUpgrade, desc, nil)
+		}
+	}
+	return nil
+}
+
+// applyMigrations upgrades the database to the latest version of the
+// provided migrations. Each migration runs in its own transaction which
+// also bumps the database version, a failed migration is rolled back and
+// leaves the database at the version of the last successful migration.
+// Databases with versions newer than the latest migration are refused.
+func applyMigrations(db *bolt.DB, migrations []migration) error {
+	err := validateMigrations(migrations)
+	if err != nil {
+		return err
+	}
+	latest := uint32(initialVersion + len(migrations))
 
+	var version uint32
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = fetchDBVersion(tx)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	if version >= DBVersion {
+	if version > latest {
+		desc := fmt.Sprintf("database version %d is newer than the "+
+			"latest supported version %d", version, latest)
+		return MakeError(ErrDBUpgrade, desc, nil)
+	}
+
+	if version == latest {
 		// No upgrades necessary.
 		return nil
 	}
 
-	log.Infof("Upgrading database from version %d to %d", version, DBVersion)
+	log.Infof("Upgrading database from version %d to %d", version, latest)
+
+	for _, m := range migrations[version-initialVersion:] {
+		err := db.Update(func(tx *bolt.Tx) error {
+			// Ensure the migration has not been applied in the
+			// meantime.
+			dbVersion, err := fetchDBVersion(tx)
+			if err != nil {
+				return err
+			}
+			if dbVersion != m.version-1 {
+				desc := fmt.Sprintf("%s migration to version %d "+
+					"inappropriately called at version %d", m.name,
+					m.version, dbVersion)
+				return MakeError(ErrDBUpgrade, desc, nil)
+			}
 
-	return db.Update(func(tx *bolt.Tx) error {
-		// Execute all necessary upgrades in order.
-		for _, upgrade := range upgrades[version:] {
-			err := upgrade(tx)
+			err = m.migrate(tx)
 			if err != nil {
 				return err
 			}
+			return setDBVersion(tx, m.version)
+		})
+		if err != nil {
+			desc := fmt.Sprintf("%s migration to version %d failed",
+				m.name, m.version)
+			return MakeError(ErrDBUpgrade, desc, err)
 		}
-		return nil
-	})
+		log.Infof("Database upgraded to version %d (%s)", m.version, m.name)
+	}
+	return nil
+}
+
+// upgradeDB checks whether the any upgrades are necessary before the database is
+// ready for application usage.  If any are, they are performed.
+func upgradeDB(db *bolt.DB) error {
+	return applyMigrations(db, migrations)
 }
@@ -1,22 +1,326 @@
 package pool
 
 import (
-	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	bolt "github.com/coreos/bbolt"
 )
 
+// dbFixture represents the raw records of the nested buckets of the pool
+// database, keyed by bucket and record key.
+type dbFixture map[string]map[string]string
+
+// createVersionedDB creates a database at the provided version holding the
+// records of the provided fixture.
+func createVersionedDB(t *testing.T, dbPath string, version uint32, fixture dbFixture) *bolt.DB {
+	db, err := openDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		pbkt, err := tx.CreateBucketIfNotExists(poolBkt)
+		if err != nil {
+			return err
+		}
+		vBytes := make([]byte, 4)
+		binary.LittleEndian.PutUint32(vBytes, version)
+		err = pbkt.Put(versionK, vBytes)
+		if err != nil {
+			return err
+		}
+		for bucket, records := range fixture {
+			bkt, err := pbkt.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+			for k, v := range records {
+				err = bkt.Put([]byte(k), []byte(v))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		t.Fatalf("unable to create version %d database: %v", version, err)
+	}
+	return db
+}
+
+// fetchRecord returns the raw record of the provided bucket and key.
+func fetchRecord(t *testing.T, db *bolt.DB, bucket []byte, key string) string {
+	var record string
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(poolBkt).Bucket(bucket)
+		if bkt == nil {
+			return fmt.Errorf("bucket %s not found", string(bucket))
+		}
+		v := bkt.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("record %s not found in bucket %s", key,
+				string(bucket))
+		}
+		record = string(v)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+// fetchVersion returns the version of the provided database.
+func fetchVersion(t *testing.T, db *bolt.DB) uint32 {
+	var version uint32
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = fetchDBVersion(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("[fetchDBVersion] unexpected error: %v", err)
+	}
+	return version
+}
+
 var dbUpgradeTests = [...]struct {
-	verify   func(*testing.T, *bolt.DB)
-	filename string // in testdata directory
+	name    string
+	version uint32
+	fixture dbFixture
+	verify  func(*testing.T, *bolt.DB)
 }{
-	// No upgrade test for V1, it is a backwards-compatible upgrade
+	{
+		name:    "transaction id",
+		version: initialVersion,
+		fixture: dbFixture{
+			string(paymentBkt): {
+				"a": `{"account":"a","estimatedmaturity":26,"height":10,"amount":100,"createdon":1,"paidonheight":0}`,
+			},
+			string(paymentArchiveBkt): {
+				"b": `{"account":"b","estimatedmaturity":26,"height":10,"amount":50,"createdon":2,"paidonheight":30}`,
+			},
+		},
+		verify: func(t *testing.T, db *bolt.DB) {
+			for bucket, key := range map[string]string{
+				string(paymentBkt): "a", string(paymentArchiveBkt): "b"} {
+				record := fetchRecord(t, db, []byte(bucket), key)
+				if !strings.Contains(record, `"transactionid":""`) {
+					t.Fatalf("expected a transaction id in %s "+
+						"record %s, got %s", bucket, key, record)
+				}
+			}
+		},
+	},
+	{
+		name:    "payment total",
+		version: transactionIDVersion,
+		fixture: dbFixture{
+			string(paymentArchiveBkt): {
+				"a": `{"account":"a","amount":100,"createdon":1,"transactionid":"x"}`,
+				"b": `{"account":"a","amount":50,"createdon":2,"transactionid":"y"}`,
+				"c": `{"account":"c","amount":10,"createdon":3,"transactionid":"y"}`,
+			},
+		},
+		verify: func(t *testing.T, db *bolt.DB) {
+			total, err := fetchPaymentTotal(db, "a")
+			if err != nil {
+				t.Fatalf("[fetchPaymentTotal] unexpected error: %v", err)
+			}
+			if total != 150 {
+				t.Fatalf("expected a payment total of 150, got %v",
+					int64(total))
+			}
+			total, err = fetchPaymentTotal(db, "c")
+			if err != nil {
+				t.Fatalf("[fetchPaymentTotal] unexpected error: %v", err)
+			}
+			if total != 10 {
+				t.Fatalf("expected a payment total of 10, got %v",
+					int64(total))
+			}
+		},
+	},
+	{
+		name:    "accepted work reward",
+		version: paymentTotalVersion,
+		fixture: dbFixture{
+			string(workBkt): {
+				"a": `{"uuid":"a","blockhash":"h","prevhash":"p","height":10,"minedby":"m","miner":"cpu","createdon":1,"confirmed":true}`,
+			},
+		},
+		verify: func(t *testing.T, db *bolt.DB) {
+			record := fetchRecord(t, db, workBkt, "a")
+			if !strings.Contains(record, `"reward":0`) {
+				t.Fatalf("expected a reward in work record, got %s",
+					record)
+			}
+		},
+	},
+	{
+		name:    "payment source",
+		version: acceptedWorkRewardVersion,
+		fixture: dbFixture{
+			string(workBkt): {
+				"a": `{"uuid":"a","blockhash":"h","prevhash":"p","height":10,"minedby":"m","miner":"cpu","createdon":1,"confirmed":true}`,
+				"b": `{"uuid":"b","blockhash":"u","prevhash":"h","height":11,"minedby":"m","miner":"cpu","createdon":2,"confirmed":false}`,
+			},
+			string(paymentBkt): {
+				"a": `{"account":"a","height":10,"amount":100,"createdon":1}`,
+				"b": `{"account":"a","height":11,"amount":100,"createdon":2}`,
+			},
+			string(paymentArchiveBkt): {
+				"c": `{"account":"a","height":10,"amount":50,"createdon":3,"transactionid":"x"}`,
+			},
+		},
+		verify: func(t *testing.T, db *bolt.DB) {
+			for bucket, key := range map[string]string{
+				string(paymentBkt): "a", string(paymentArchiveBkt): "c"} {
+				record := fetchRecord(t, db, []byte(bucket), key)
+				if !strings.Contains(record, `"blockhash":"h"`) {
+					t.Fatalf("expected a backfilled block hash in %s "+
+						"record %s, got %s", bucket, key, record)
+				}
+			}
+			record := fetchRecord(t, db, paymentBkt, "b")
+			if strings.Contains(record, `"blockhash"`) {
+				t.Fatalf("expected no block hash for unconfirmed work, "+
+					"got %s", record)
+			}
+		},
+	},
+	{
+		name:    "worker name",
+		version: paymentSourceVersion,
+		fixture: dbFixture{
+			string(workerBkt): {
+				"a.rig 1": `{"account":"a","name":"rig 1","lastseen":1,"lastshare":1,"offline":true,"uptime":10,"accepted":2,"rejected":1,"hashrates":[{"time":1,"hashrate":"5"}]}`,
+				"a.rig?1": `{"account":"a","name":"rig?1","lastseen":2,"lastshare":2,"offline":false,"uptime":20,"accepted":3,"rejected":0,"hashrates":[{"time":2,"hashrate":"7"}]}`,
+				"a.":      `{"account":"a","name":"","lastseen":3,"lastshare":3,"offline":true,"uptime":5,"accepted":1,"rejected":0,"hashrates":[]}`,
+				"b.rig_1": `{"account":"b","name":"rig_1","lastseen":4,"lastshare":4,"offline":true,"uptime":1,"accepted":1,"rejected":0,"hashrates":[]}`,
+			},
+		},
+		verify: func(t *testing.T, db *bolt.DB) {
+			states := make(map[string]*WorkerState)
+			err := db.View(func(tx *bolt.Tx) error {
+				bkt, err := fetchWorkerBucket(tx)
+				if err != nil {
+					return err
+				}
+				return bkt.ForEach(func(k, v []byte) error {
+					var worker WorkerState
+					err := json.Unmarshal(v, &worker)
+					if err != nil {
+						return err
+					}
+					states[string(k)] = &worker
+					return nil
+				})
+			})
+			if err != nil {
+				t.Fatalf("unable to fetch worker states: %v", err)
+			}
+			if len(states) != 3 {
+				t.Fatalf("expected 3 worker states, got %d", len(states))
+			}
+			rig, ok := states[workerID("a", "rig_1")]
+			if !ok {
+				t.Fatal("expected the merged state of worker rig_1")
+			}
+			if rig.Name != "rig_1" || rig.Uptime != 30 ||
+				rig.Accepted != 5 || rig.Rejected != 1 {
+				t.Fatalf("expected merged activity of worker rig_1, "+
+					"got %+v", rig)
+			}
+			if rig.LastShare != 2 || rig.Offline {
+				t.Fatal("expected the latest share of worker rig_1 " +
+					"to mark it online")
+			}
+			if len(rig.HashRates) != 2 ||
+				rig.HashRates[0].Time > rig.HashRates[1].Time {
+				t.Fatalf("expected 2 ordered hash rate samples, got %d",
+					len(rig.HashRates))
+			}
+			unnamed, ok := states[workerID("a", defaultWorkerName+"1")]
+			if !ok || unnamed.Name != defaultWorkerName+"1" {
+				t.Fatal("expected the unnamed worker to be renamed " +
+					"to the first default worker name")
+			}
+			if _, ok := states[workerID("b", "rig_1")]; !ok {
+				t.Fatal("expected the state of worker rig_1 of " +
+					"account b to be kept")
+			}
+		},
+	},
+	{
+		name:    "account index",
+		version: workerNameVersion,
+		fixture: dbFixture{
+			string(paymentBkt): {
+				"0000000000000001a":  `{"account":"a","height":10,"amount":100,"createdon":1}`,
+				"0000000000000002ab": `{"account":"ab","height":10,"amount":40,"createdon":2}`,
+				"0000000000000003a":  `{"account":"a","height":11,"amount":20,"createdon":3,"donation":true}`,
+			},
+			string(paymentArchiveBkt): {
+				"0000000000000004a":  `{"account":"a","height":8,"amount":50,"createdon":4,"paidonheight":20,"transactionid":"x"}`,
+				"0000000000000005ab": `{"account":"ab","height":8,"amount":10,"createdon":5,"paidonheight":20,"transactionid":"x"}`,
+			},
+			string(shareBkt): {
+				"\x00\x00\x00\x00\x00\x00\x00\x06": `{"account":"a","weight":"1","createdOn":6}`,
+				"\x00\x00\x00\x00\x00\x00\x00\x07": `{"account":"ab","weight":"4","createdOn":7}`,
+				"\x00\x00\x00\x00\x00\x00\x00\x08": `{"account":"a","weight":"2","createdOn":8}`,
+			},
+		},
+		verify: func(t *testing.T, db *bolt.DB) {
+			balance, err := fetchPendingBalance(db, "a")
+			if err != nil {
+				t.Fatalf("[fetchPendingBalance] unexpected error: %v", err)
+			}
+			if balance != 100 {
+				t.Fatalf("expected a pending balance of 100, got %v",
+					balance)
+			}
+			pmts, err := fetchPaymentsForAccount(db, "a", 10)
+			if err != nil {
+				t.Fatalf("[fetchPaymentsForAccount] unexpected error: %v",
+					err)
+			}
+			if len(pmts) != 3 || pmts[0].CreatedOn != 3 ||
+				pmts[1].CreatedOn != 1 || pmts[2].CreatedOn != 4 {
+				t.Fatalf("expected the 3 payments of account a most "+
+					"recent first, got %d payments", len(pmts))
+			}
+			summary, err := fetchAccountShareSummary(db, "a", 0)
+			if err != nil {
+				t.Fatalf("[fetchAccountShareSummary] unexpected error: %v",
+					err)
+			}
+			if summary.Count != 2 || summary.LastShare != 8 ||
+				summary.Weight.Cmp(new(big.Rat).SetInt64(3)) != 0 {
+				t.Fatalf("expected 2 shares of weight 3 for account a, "+
+					"got %d of weight %v", summary.Count, summary.Weight)
+			}
+			summary, err = fetchAccountShareSummary(db, "a", 7)
+			if err != nil {
+				t.Fatalf("[fetchAccountShareSummary] unexpected error: %v",
+					err)
+			}
+			if summary.Count != 1 {
+				t.Fatalf("expected 1 share of account a created after 7, "+
+					"got %d", summary.Count)
+			}
+		},
+	},
 }
 
 func TestUpgrades(t *testing.T) {
@@ -33,33 +337,25 @@ func TestUpgrades(t *testing.T) {
 			name := fmt.Sprintf("test%d", i)
 			t.Run(name, func(t *testing.T) {
 				t.Parallel()
-				testFile, err := os.Open(filepath.Join("testdata", test.filename))
-				if err != nil {
-					t.Fatal(err)
-				}
-				defer testFile.Close()
-				r, err := gzip.NewReader(testFile)
-				if err != nil {
-					t.Fatal(err)
-				}
 				dbPath := filepath.Join(d, name+".db")
-				fi, err := os.Create(dbPath)
-				if err != nil {
-					t.Fatal(err)
-				}
-				_, err = io.Copy(fi, r)
-				fi.Close()
-				if err != nil {
-					t.Fatal(err)
-				}
-				db, err := openDB(dbPath)
+				db := createVersionedDB(t, dbPath, test.version,
+					test.fixture)
+				defer db.Close()
+
+				// Mirror the database initialization, buckets are
+				// created before upgrading.
+				err := createBuckets(db)
 				if err != nil {
 					t.Fatal(err)
 				}
-				defer db.Close()
 				err = upgradeDB(db)
 				if err != nil {
-					t.Fatalf("Upgrade failed: %v", err)
+					t.Fatalf("%s upgrade failed: %v", test.name, err)
+				}
+				version := fetchVersion(t, db)
+				if version != DBVersion {
+					t.Fatalf("expected database version %d after the "+
+						"%s upgrade, got %d", DBVersion, test.name, version)
 				}
 				test.verify(t, db)
 			})
@@ -68,3 +364,101 @@ func TestUpgrades(t *testing.T) {
 
 	os.RemoveAll(d)
 }
+
+func TestMigrations(t *testing.T) {
+	t.Parallel()
+
+	d, err := ioutil.TempDir("", "eacrpool_test_migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	// Ensure the registered migrations are valid and match the latest
+	// database version.
+	err = validateMigrations(migrations)
+	if err != nil {
+		t.Fatalf("[validateMigrations] unexpected error: %v", err)
+	}
+	if migrations[len(migrations)-1].version != DBVersion {
+		t.Fatalf("expected the last migration to be at version %d, got %d",
+			DBVersion, migrations[len(migrations)-1].version)
+	}
+
+	// Ensure migrations with gaps in their versions are refused.
+	db := createVersionedDB(t, filepath.Join(d, "gap.db"), initialVersion,
+		nil)
+	defer db.Close()
+	noop := func(tx *bolt.Tx) error { return nil }
+	err = applyMigrations(db, []migration{{1, "one", noop},
+		{3, "three", noop}})
+	if !IsError(err, ErrDBUpgrade) {
+		t.Fatalf("expected a database upgrade error, got %v", err)
+	}
+
+	// Ensure a failed migration is rolled back while preceding migrations
+	// remain applied.
+	put := func(key string) func(tx *bolt.Tx) error {
+		return func(tx *bolt.Tx) error {
+			return tx.Bucket(poolBkt).Put([]byte(key), []byte{1})
+		}
+	}
+	failing := []migration{
+		{1, "one", put("one")},
+		{2, "two", func(tx *bolt.Tx) error {
+			err := put("two")(tx)
+			if err != nil {
+				return err
+			}
+			return errors.New("migration failure")
+		}},
+	}
+	err = applyMigrations(db, failing)
+	if !IsError(err, ErrDBUpgrade) {
+		t.Fatalf("expected a database upgrade error, got %v", err)
+	}
+	if version := fetchVersion(t, db); version != 1 {
+		t.Fatalf("expected database version 1, got %d", version)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		pbkt := tx.Bucket(poolBkt)
+		if pbkt.Get([]byte("one")) == nil {
+			return fmt.Errorf("expected the first migration to be applied")
+		}
+		if pbkt.Get([]byte("two")) != nil {
+			return fmt.Errorf("expected the failed migration to be " +
+				"rolled back")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure applying migrations resumes from the current version and is
+	// a no-op once the database is at the latest version.
+	applied := 0
+	count := func(tx *bolt.Tx) error {
+		applied++
+		return nil
+	}
+	resumed := []migration{{1, "one", count}, {2, "two", count}}
+	for i := 0; i < 2; i++ {
+		err = applyMigrations(db, resumed)
+		if err != nil {
+			t.Fatalf("[applyMigrations] unexpected error: %v", err)
+		}
+	}
+	if applied != 1 {
+		t.Fatalf("expected 1 migration to be applied, got %d", applied)
+	}
+	if version := fetchVersion(t, db); version != 2 {
+		t.Fatalf("expected database version 2, got %d", version)
+	}
+
+	// Ensure databases newer than the latest migration are refused.
+	err = applyMigrations(db, resumed[:1])
+	if !IsError(err, ErrDBUpgrade) {
+		t.Fatalf("expected a database upgrade error, got %v", err)
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// verifyBatchSize is the maximum number of records checked per database
+// transaction by the integrity check.
+const verifyBatchSize = 500
+
+var (
+	// verifyProgressK is the key of the progress of an unfinished
+	// integrity check, it is stored in the diagnostics bucket.
+	verifyProgressK = []byte("verifyprogress")
+
+	// quarantineSeparator separates the source bucket and key of
+	// quarantined record keys.
+	quarantineSeparator = []byte("/")
+)
+
+// recordCheck checks a record of a bucket, returning a description of the
+// inconsistency found or an empty string if the record is consistent.
+type recordCheck func(pbkt *bolt.Bucket, k, v []byte, solo bool) string
+
+// verifiedBucket pairs a bucket with the check of its records.
+type verifiedBucket struct {
+	name  []byte
+	check recordCheck
+}
+
+// verifiedBuckets represents the buckets cross-checked by the integrity
+// check, in the order they are checked.
+var verifiedBuckets = []verifiedBucket{
+	{jobBkt, checkJob},
+	{workBkt, checkAcceptedWork},
+	{shareBkt, checkShare},
+	{paymentBkt, checkPayment},
+}
+
+// VerifyReport represents the outcome of a database integrity check.
+type VerifyReport struct {
+	// Resumed indicates the check resumed an unfinished check.
+	Resumed bool
+	// Checked represents the number of records checked.
+	Checked uint64
+	// Inconsistencies represents the number of inconsistent records found.
+	Inconsistencies uint64
+	// Quarantined represents the number of inconsistent records moved to
+	// the diagnostics bucket.
+	Quarantined uint64
+}
+
+// verifyProgress represents the progress of an unfinished integrity check.
+type verifyProgress struct {
+	Bucket string `json:"bucket"`
+	Key    []byte `json:"key"`
+}
+
+// QuarantinedRecord represents an inconsistent record moved out of its
+// bucket by the integrity check.
+type QuarantinedRecord struct {
+	Bucket        string `json:"bucket"`
+	Key           []byte `json:"key"`
+	Value         []byte `json:"value"`
+	Reason        string `json:"reason"`
+	QuarantinedOn int64  `json:"quarantinedon"`
+}
+
+// fetchDiagnosticsBucket is a helper function for getting the diagnostics
+// bucket.
+func fetchDiagnosticsBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(diagnosticsBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(diagnosticsBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+// displayKey returns a printable representation of the provided key.
+func displayKey(k []byte) string {
+	for _, r := range string(k) {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return hex.EncodeToString(k)
+		}
+	}
+	return string(k)
+}
+
+// accountExists returns whether the provided account is persisted.
+func accountExists(pbkt *bolt.Bucket, account string) bool {
+	bkt := pbkt.Bucket(accountBkt)
+	return bkt != nil && bkt.Get([]byte(account)) != nil
+}
+
+// checkJob ensures a job is keyed by its id and that its id encodes its
+// height.
+func checkJob(pbkt *bolt.Bucket, k, v []byte, solo bool) string {
+	var job Job
+	err := json.Unmarshal(v, &job)
+	if err != nil {
+		return fmt.Sprintf("undecodable job: %v", err)
+	}
+	if job.UUID != string(k) {
+		return fmt.Sprintf("job id %s does not match its key", job.UUID)
+	}
+	id, err := hex.DecodeString(job.UUID)
+	if err != nil || len(id) != 12 {
+		return fmt.Sprintf("malformed job id %s", job.UUID)
+	}
+	height := bigEndianBytesToHeight(id)
+	if height != job.Height {
+		return fmt.Sprintf("job id references height #%d, job is at "+
+			"height #%d", height, job.Height)
+	}
+	_, err = hex.DecodeString(job.Header)
+	if err != nil {
+		return fmt.Sprintf("undecodable job header: %v", err)
+	}
+	return ""
+}
+
+// checkAcceptedWork ensures accepted work is keyed by its id and, in pool
+// mode, references an existing account.
+func checkAcceptedWork(pbkt *bolt.Bucket, k, v []byte, solo bool) string {
+	var work AcceptedWork
+	err := json.Unmarshal(v, &work)
+	if err != nil {
+		return fmt.Sprintf("undecodable accepted work: %v", err)
+	}
+	id := AcceptedWorkID(work.BlockHash, work.Height)
+	if !bytes.Equal(id, k) {
+		return fmt.Sprintf("accepted work for block %s at height #%d "+
+			"does not match its key", work.BlockHash, work.Height)
+	}
+	if !solo && !accountExists(pbkt, work.MinedBy) {
+		return fmt.Sprintf("accepted work for block %s references "+
+			"missing account %s", work.BlockHash, work.MinedBy)
+	}
+	return ""
+}
+
+// checkShare ensures a share is keyed by its creation time and references
+// an existing account.
+func checkShare(pbkt *bolt.Bucket, k, v []byte, solo bool) string {
+	var share Share
+	err := json.Unmarshal(v, &share)
+	if err != nil {
+		return fmt.Sprintf("undecodable share: %v", err)
+	}
+	if !bytes.Equal(nanoToBigEndianBytes(share.CreatedOn), k) {
+		return fmt.Sprintf("share created on %d does not match its key",
+			share.CreatedOn)
+	}
+	if share.Weight == nil {
+		return fmt.Sprintf("share of account %s has no weight",
+			share.Account)
+	}
+	if !accountExists(pbkt, share.Account) {
+		return fmt.Sprintf("share references missing account %s",
+			share.Account)
+	}
+	return ""
+}
+
+// checkPayment ensures a pending payment references an existing account
+// and the confirmed mined work it pays for.
+func checkPayment(pbkt *bolt.Bucket, k, v []byte, solo bool) string {
+	var pmt Payment
+	err := json.Unmarshal(v, &pmt)
+	if err != nil {
+		return fmt.Sprintf("undecodable payment: %v", err)
+	}
+	if pmt.Account != poolFeesK && !accountExists(pbkt, pmt.Account) {
+		return fmt.Sprintf("payment at height #%d references missing "+
+			"account %s", pmt.Height, pmt.Account)
+	}
+
+	// Mined work is keyed by its height first, seek the confirmed work
+	// at the payment height.
+	bkt := pbkt.Bucket(workBkt)
+	if bkt == nil {
+		return fmt.Sprintf("payment at height #%d references missing "+
+			"mined work", pmt.Height)
+	}
+	prefix := []byte(hex.EncodeToString(heightToBigEndianBytes(pmt.Height)))
+	c := bkt.Cursor()
+	for wk, wv := c.Seek(prefix); wk != nil && bytes.HasPrefix(wk, prefix); wk, wv = c.Next() {
+		var work AcceptedWork
+		err := json.Unmarshal(wv, &work)
+		if err == nil && work.Confirmed {
+			return ""
+		}
+	}
+	return fmt.Sprintf("payment of account %s references missing mined "+
+		"work at height #%d", pmt.Account, pmt.Height)
+}
+
+// quarantine moves the provided record of the provided bucket to the
+// diagnostics bucket.
+func quarantine(pbkt *bolt.Bucket, bucket, k, v []byte, reason string) error {
+	dbkt := pbkt.Bucket(diagnosticsBkt)
+	if dbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(diagnosticsBkt))
+		return MakeError(ErrBucketNotFound, desc, nil)
+	}
+	record := &QuarantinedRecord{
+		Bucket:        string(bucket),
+		Key:           k,
+		Value:         v,
+		Reason:        reason,
+		QuarantinedOn: time.Now().UnixNano(),
+	}
+	rBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	qk := make([]byte, 0, len(bucket)+len(quarantineSeparator)+len(k))
+	qk = append(qk, bucket...)
+	qk = append(qk, quarantineSeparator...)
+	qk = append(qk, k...)
+	err = dbkt.Put(qk, rBytes)
+	if err != nil {
+		return err
+	}
+	return pbkt.Bucket(bucket).Delete(k)
+}
+
+// fetchVerifyProgress returns the progress of an unfinished integrity
+// check, nil if there is none.
+func fetchVerifyProgress(db *bolt.DB) (*verifyProgress, error) {
+	var progress *verifyProgress
+	err := db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchDiagnosticsBucket(tx)
+		if err != nil {
+			return err
+		}
+		v := bkt.Get(verifyProgressK)
+		if v == nil {
+			return nil
+		}
+		var p verifyProgress
+		err = json.Unmarshal(v, &p)
+		if err != nil {
+			log.Warnf("Discarding undecodable integrity check "+
+				"progress: %v", err)
+			return nil
+		}
+		progress = &p
+		return nil
+	})
+	return progress, err
+}
+
+// verifyBatch checks the next batch of records of the provided bucket
+// following the provided key, persisting the progress of the check. It
+// returns the key of the last record checked, nil once the bucket has been
+// fully checked.
+func verifyBatch(db *bolt.DB, vb verifiedBucket, after []byte, fix bool, report *VerifyReport) ([]byte, error) {
+	var last []byte
+	err := db.Update(func(tx *bolt.Tx) error {
+		pbkt := tx.Bucket(poolBkt)
+		if pbkt == nil {
+			desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+			return MakeError(ErrBucketNotFound, desc, nil)
+		}
+		bkt := pbkt.Bucket(vb.name)
+		if bkt == nil {
+			desc := fmt.Sprintf("bucket %s not found", string(vb.name))
+			return MakeError(ErrBucketNotFound, desc, nil)
+		}
+		dbkt, err := fetchDiagnosticsBucket(tx)
+		if err != nil {
+			return err
+		}
+		v := pbkt.Get(soloPool)
+		solo := v != nil && binary.LittleEndian.Uint32(v) == 1
+
+		// Records are quarantined once the cursor is done with the batch
+		// since bolt cursors do not support deletions while iterating.
+		type inconsistency struct {
+			k, v   []byte
+			reason string
+		}
+		var found []inconsistency
+		var checked int
+		c := bkt.Cursor()
+		k, v := c.First()
+		if after != nil {
+			k, v = c.Seek(after)
+			if k != nil && bytes.Equal(k, after) {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil && checked < verifyBatchSize; k, v = c.Next() {
+			checked++
+			last = append([]byte(nil), k...)
+			reason := vb.check(pbkt, k, v, solo)
+			if reason == "" {
+				continue
+			}
+			log.Warnf("Integrity check: %s record %s: %s",
+				string(vb.name), displayKey(k), reason)
+			found = append(found, inconsistency{
+				k:      last,
+				v:      append([]byte(nil), v...),
+				reason: reason,
+			})
+		}
+		if k == nil {
+			last = nil
+		}
+
+		if fix {
+			for _, entry := range found {
+				err := quarantine(pbkt, vb.name, entry.k, entry.v,
+					entry.reason)
+				if err != nil {
+					return err
+				}
+				report.Quarantined++
+			}
+		}
+		report.Checked += uint64(checked)
+		report.Inconsistencies += uint64(len(found))
+
+		// Persist the progress of the check so an interrupted check
+		// resumes from the last batch checked.
+		progress := &verifyProgress{Bucket: string(vb.name), Key: last}
+		pBytes, err := json.Marshal(progress)
+		if err != nil {
+			return err
+		}
+		return dbkt.Put(verifyProgressK, pBytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return last, nil
+}
+
+// VerifyDB cross-checks the referential integrity of the jobs, accepted
+// work, shares and payments of the pool database, logging each
+// inconsistent record found. Inconsistent records are moved to the
+// diagnostics bucket if fix is true.
+//
+// Records are checked in bounded batches and the progress of the check is
+// persisted, a check interrupted before completion resumes where it
+// stopped.
+func VerifyDB(db *bolt.DB, fix bool) (*VerifyReport, error) {
+	report := new(VerifyReport)
+	progress, err := fetchVerifyProgress(db)
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+	var after []byte
+	if progress != nil {
+		for idx, vb := range verifiedBuckets {
+			if string(vb.name) == progress.Bucket {
+				start = idx
+				after = progress.Key
+				report.Resumed = true
+				break
+			}
+		}
+		if report.Resumed {
+			log.Infof("Resuming integrity check at %s bucket",
+				progress.Bucket)
+		}
+	}
+
+	for _, vb := range verifiedBuckets[start:] {
+		for {
+			after, err = verifyBatch(db, vb, after, fix, report)
+			if err != nil {
+				return nil, err
+			}
+			if after == nil {
+				break
+			}
+		}
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchDiagnosticsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.Delete(verifyProgressK)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,165 @@
+package pool
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func testVerifyDB(t *testing.T, db *bolt.DB) {
+	header := "07000000022b580ca96146e9c85fa1ee2ec02e0e2579af" +
+		strings.Repeat("00", 157)
+	now := time.Now().UnixNano()
+	verified := [][]byte{jobBkt, workBkt, shareBkt, paymentBkt,
+		diagnosticsBkt}
+	emptyBuckets := func() {
+		for _, bkt := range verified {
+			err := emptyBucket(db, bkt)
+			if err != nil {
+				t.Fatalf("emptyBucket error: %v", err)
+			}
+		}
+	}
+
+	// Clear records left by previous tests.
+	emptyBuckets()
+
+	// Persist consistent records.
+	_, err := persistJob(db, header, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := NewAcceptedWork("00000000000000001e2065a7248a9b4d3886fe3ca3128eebedddaf35fb26e58c",
+		"000000000000000022d95f9fc9ab9fed0b8fb2f2ab5dd0e4a24f5d6e0fda7c5d",
+		10, xID, CPU, 0)
+	work.Confirmed = true
+	err = work.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	err = persistShare(db, xID, new(big.Rat).SetInt64(1), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewPayment(xID, 100, 10, 26).Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+
+	// Persist inconsistent records.
+	job, err := NewJob(header, 5)
+	if err != nil {
+		t.Fatalf("[NewJob] unexpected error: %v", err)
+	}
+	job.Height = 6
+	err = job.Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+	_, err = persistAcceptedWork(db,
+		"0000000000000000141e4fa8b2dc0e3a2c4f3ab9b7bd43bd7d9db8ed7c10e6ec",
+		"00000000000000001e2065a7248a9b4d3886fe3ca3128eebedddaf35fb26e58c",
+		11, "missing", CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = persistShare(db, "missing", new(big.Rat).SetInt64(1), now+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewPayment(xID, 100, 20, 36).Create(db)
+	if err != nil {
+		t.Fatalf("[Create] unexpected error: %v", err)
+	}
+
+	// Ensure inconsistencies are reported but not quarantined when not
+	// fixing.
+	report, err := VerifyDB(db, false)
+	if err != nil {
+		t.Fatalf("[VerifyDB] unexpected error: %v", err)
+	}
+	if report.Resumed || report.Checked != 8 ||
+		report.Inconsistencies != 4 || report.Quarantined != 0 {
+		t.Fatalf("unexpected verification report: %+v", report)
+	}
+
+	// Ensure an unfinished check resumes from its persisted progress.
+	err = db.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchDiagnosticsBucket(tx)
+		if err != nil {
+			return err
+		}
+		pBytes, err := json.Marshal(&verifyProgress{
+			Bucket: string(shareBkt),
+		})
+		if err != nil {
+			return err
+		}
+		return bkt.Put(verifyProgressK, pBytes)
+	})
+	if err != nil {
+		t.Fatalf("unable to persist verification progress: %v", err)
+	}
+	report, err = VerifyDB(db, false)
+	if err != nil {
+		t.Fatalf("[VerifyDB] unexpected error: %v", err)
+	}
+	if !report.Resumed || report.Checked != 4 ||
+		report.Inconsistencies != 2 {
+		t.Fatalf("unexpected resumed verification report: %+v", report)
+	}
+
+	// Ensure inconsistent records are quarantined when fixing.
+	report, err = VerifyDB(db, true)
+	if err != nil {
+		t.Fatalf("[VerifyDB] unexpected error: %v", err)
+	}
+	if report.Inconsistencies != 4 || report.Quarantined != 4 {
+		t.Fatalf("unexpected repair report: %+v", report)
+	}
+	report, err = VerifyDB(db, false)
+	if err != nil {
+		t.Fatalf("[VerifyDB] unexpected error: %v", err)
+	}
+	if report.Checked != 4 || report.Inconsistencies != 0 {
+		t.Fatalf("unexpected verification report after repair: %+v",
+			report)
+	}
+
+	var quarantined []*QuarantinedRecord
+	err = db.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchDiagnosticsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var record QuarantinedRecord
+			err := json.Unmarshal(v, &record)
+			if err != nil {
+				return err
+			}
+			quarantined = append(quarantined, &record)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("unable to fetch quarantined records: %v", err)
+	}
+	if len(quarantined) != 4 {
+		t.Fatalf("expected 4 quarantined records, got %d",
+			len(quarantined))
+	}
+	for _, record := range quarantined {
+		if record.Reason == "" || len(record.Value) == 0 {
+			t.Fatalf("expected quarantined %s record %s to have a "+
+				"reason and value", record.Bucket, displayKey(record.Key))
+		}
+	}
+
+	// Empty the buckets.
+	emptyBuckets()
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Eacred/eacrd/chaincfg/chainhash"
+	"github.com/Eacred/eacrd/dcrutil"
+	"github.com/Eacred/eacrwallet/rpc/walletrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Wallet represents the wallet pool payments are dispatched from.
+type Wallet interface {
+	// Ping asserts the wallet is reachable.
+	Ping(ctx context.Context) error
+	// SpendableBalance fetches the spendable balance of the account
+	// payments are dispatched from.
+	SpendableBalance(ctx context.Context) (dcrutil.Amount, error)
+	// PublishTransaction creates, signs and publishes a transaction paying
+	// the provided payouts. It returns the hash of the published
+	// transaction.
+	PublishTransaction(ctx context.Context, payouts map[dcrutil.Address]dcrutil.Amount, targetAmt dcrutil.Amount) (string, error)
+}
+
+// grpcWallet is a wallet reached through the gRPC server of eacrwallet.
+type grpcWallet struct {
+	conn   *grpc.ClientConn
+	client walletrpc.WalletServiceClient
+	pass   []byte
+	mtx    sync.Mutex
+}
+
+// dialWallet establishes a gRPC connection with the wallet at the provided
+// host.
+func dialWallet(host string, certFile string, pass string) (*grpcWallet, error) {
+	creds, err := credentials.NewClientTLSFromFile(certFile, "localhost")
+	if err != nil {
+		desc := "grpc tls error (eacrwallet)"
+		return nil, MakeError(ErrOther, desc, err)
+	}
+	conn, err := grpc.Dial(host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		desc := "grpc dial error (eacrwallet)"
+		return nil, MakeError(ErrOther, desc, err)
+	}
+	if conn == nil {
+		desc := "unable to establish grpc with eacrwallet"
+		return nil, MakeError(ErrOther, desc, nil)
+	}
+	return &grpcWallet{
+		conn:   conn,
+		client: walletrpc.NewWalletServiceClient(conn),
+		pass:   []byte(pass),
+	}, nil
+}
+
+// Ping asserts the wallet is reachable.
+func (w *grpcWallet) Ping(ctx context.Context) error {
+	w.mtx.Lock()
+	_, err := w.client.Ping(ctx, &walletrpc.PingRequest{})
+	w.mtx.Unlock()
+	return err
+}
+
+// SpendableBalance fetches the spendable balance of the default account.
+func (w *grpcWallet) SpendableBalance(ctx context.Context) (dcrutil.Amount, error) {
+	req := &walletrpc.BalanceRequest{
+		AccountNumber:         0,
+		RequiredConfirmations: 1,
+	}
+	w.mtx.Lock()
+	resp, err := w.client.Balance(ctx, req)
+	w.mtx.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return dcrutil.Amount(resp.Spendable), nil
+}
+
+// PublishTransaction creates a transaction paying pool accounts for work
+// done from the default account.
+func (w *grpcWallet) PublishTransaction(ctx context.Context, payouts map[dcrutil.Address]dcrutil.Amount, targetAmt dcrutil.Amount) (string, error) {
+	outs := make([]*walletrpc.ConstructTransactionRequest_Output, 0, len(payouts))
+	for addr, amt := range payouts {
+		out := &walletrpc.ConstructTransactionRequest_Output{
+			Destination: &walletrpc.ConstructTransactionRequest_OutputDestination{
+				Address: addr.String(),
+			},
+			Amount: int64(amt),
+		}
+		outs = append(outs, out)
+	}
+
+	constructTxReq := &walletrpc.ConstructTransactionRequest{
+		SourceAccount:            0,
+		RequiredConfirmations:    1,
+		OutputSelectionAlgorithm: walletrpc.ConstructTransactionRequest_ALL,
+		NonChangeOutputs:         outs,
+	}
+	w.mtx.Lock()
+	constructTxResp, err := w.client.ConstructTransaction(ctx, constructTxReq)
+	w.mtx.Unlock()
+	if err != nil {
+		return "", err
+	}
+	signTxReq := &walletrpc.SignTransactionRequest{
+		SerializedTransaction: constructTxResp.UnsignedTransaction,
+		Passphrase:            w.pass,
+	}
+	w.mtx.Lock()
+	signedTxResp, err := w.client.SignTransaction(ctx, signTxReq)
+	w.mtx.Unlock()
+	if err != nil {
+		return "", err
+	}
+	pubTxReq := &walletrpc.PublishTransactionRequest{
+		SignedTransaction: signedTxResp.Transaction,
+	}
+	w.mtx.Lock()
+	pubTxResp, err := w.client.PublishTransaction(ctx, pubTxReq)
+	w.mtx.Unlock()
+	if err != nil {
+		return "", err
+	}
+	txid, err := chainhash.NewHash(pubTxResp.TransactionHash)
+	if err != nil {
+		return "", err
+	}
+	return txid.String(), nil
+}
+
+// close terminates the gRPC connection with the wallet.
+func (w *grpcWallet) close() {
+	w.conn.Close()
+}
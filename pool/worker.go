@@ -0,0 +1,592 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+var (
+	// workerCheckInterval represents the interval workers are checked for
+	// inactivity.
+	workerCheckInterval = time.Second * 30
+
+	// workerPersistInterval represents the interval worker states are
+	// persisted to the database.
+	workerPersistInterval = time.Minute * 5
+
+	// workerSampleInterval represents the interval worker hash rates are
+	// sampled at.
+	workerSampleInterval = time.Minute * 5
+
+	// workerSampleWindow represents the period worker hash rate samples
+	// are kept for, the average hash rate of a worker is taken over it.
+	workerSampleWindow = time.Hour * 24
+
+	// workerEventQueueSize represents the number of client events queued
+	// for the worker monitor, events are dropped once the queue is full.
+	workerEventQueueSize = 1024
+)
+
+// HashRateSample represents the hash rate of a worker at a point in time.
+type HashRateSample struct {
+	Time     int64    `json:"time"`
+	HashRate *big.Rat `json:"hashrate"`
+}
+
+// WorkerState represents the activity of a named worker of an account.
+// Workers are identified by their account and name, reconnecting clients
+// resume the state of their worker. The uptime of a worker is the
+// cumulative number of seconds its clients have been connected for.
+type WorkerState struct {
+	Account   string            `json:"account"`
+	Name      string            `json:"name"`
+	LastSeen  int64             `json:"lastseen"`
+	LastShare int64             `json:"lastshare"`
+	Offline   bool              `json:"offline"`
+	Uptime    int64             `json:"uptime"`
+	Accepted  uint64            `json:"accepted"`
+	Rejected  uint64            `json:"rejected"`
+	HashRates []*HashRateSample `json:"hashrates"`
+}
+
+// sumHashRates returns the sum and number of the worker's hash rate
+// samples taken within the sample window ending at the provided time.
+func (w *WorkerState) sumHashRates(now time.Time) (*big.Rat, int64) {
+	min := now.Add(-workerSampleWindow).UnixNano()
+	sum := new(big.Rat)
+	var count int64
+	for _, sample := range w.HashRates {
+		if sample.Time < min {
+			continue
+		}
+		sum.Add(sum, sample.HashRate)
+		count++
+	}
+	return sum, count
+}
+
+// AverageHashRate returns the average of the worker's hash rate samples
+// taken within the sample window ending at the provided time.
+func (w *WorkerState) AverageHashRate(now time.Time) *big.Rat {
+	sum, count := w.sumHashRates(now)
+	if count == 0 {
+		return sum
+	}
+	return sum.Quo(sum, new(big.Rat).SetInt64(count))
+}
+
+// workerSession represents the connected period of an authorized client
+// not yet added to the uptime of its worker.
+type workerSession struct {
+	worker string
+	since  int64
+}
+
+// workerID generates the unique id of a worker.
+func workerID(account string, name string) string {
+	return fmt.Sprintf("%s.%s", account, name)
+}
+
+// fetchWorkerBucket is a helper function for getting the worker bucket.
+func fetchWorkerBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	pbkt := tx.Bucket(poolBkt)
+	if pbkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(poolBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	bkt := pbkt.Bucket(workerBkt)
+	if bkt == nil {
+		desc := fmt.Sprintf("bucket %s not found", string(workerBkt))
+		return nil, MakeError(ErrBucketNotFound, desc, nil)
+	}
+	return bkt, nil
+}
+
+type WorkerMonitorConfig struct {
+	// DB represents the pool database.
+	DB *bolt.DB
+	// OfflinePeriod represents the period without shares after which an
+	// active worker is considered offline.
+	OfflinePeriod time.Duration
+	// Retention represents the period after which workers no longer seen
+	// are pruned, zero to keep all workers.
+	Retention time.Duration
+	// NotifyWorkerStatus publishes a worker offline or recovery event for
+	// the provided worker.
+	NotifyWorkerStatus func(*WorkerState)
+	// ClientConnected returns if the client with the provided id is
+	// connected to the pool.
+	ClientConnected func(string) bool
+	// FetchWorkerHashRates returns the hash rates of workers with
+	// connected clients, keyed by worker id.
+	FetchWorkerHashRates func() map[string]*big.Rat
+	// Events represents the hub's event bus worker activity is tracked
+	// through.
+	Events *EventBus
+	// HubWg represents the hub's waitgroup.
+	HubWg *sync.WaitGroup
+}
+
+// WorkerMonitor tracks the activity and session metrics of pool workers
+// and flags workers that stop submitting shares as offline.
+type WorkerMonitor struct {
+	cfg        *WorkerMonitorConfig
+	cfgMtx     sync.RWMutex
+	events     *Subscription
+	workers    map[string]*WorkerState
+	sessions   map[string]*workerSession
+	workersMtx sync.RWMutex
+}
+
+// NewWorkerMonitor creates a worker monitor, loading persisted worker states.
+func NewWorkerMonitor(wCfg *WorkerMonitorConfig) (*WorkerMonitor, error) {
+	wm := &WorkerMonitor{
+		cfg:      wCfg,
+		workers:  make(map[string]*WorkerState),
+		sessions: make(map[string]*workerSession),
+	}
+	err := wm.config().DB.View(func(tx *bolt.Tx) error {
+		bkt, err := fetchWorkerBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var worker WorkerState
+			err := json.Unmarshal(v, &worker)
+			if err != nil {
+				return err
+			}
+			wm.workers[string(k)] = &worker
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	wm.events = wCfg.Events.Subscribe(workerEventQueueSize,
+		EventClientAuthorized, EventClientDisconnected, EventShareAccepted,
+		EventShareRejected)
+	return wm, nil
+}
+
+// config returns the current configuration of the worker monitor, the
+// returned configuration must not be modified.
+func (wm *WorkerMonitor) config() *WorkerMonitorConfig {
+	wm.cfgMtx.RLock()
+	defer wm.cfgMtx.RUnlock()
+	return wm.cfg
+}
+
+// ApplyConfig applies the offline period and retention of the provided
+// configuration to the worker monitor at runtime, they take effect on the
+// next worker check and prune. Other fields of the provided configuration
+// are ignored.
+func (wm *WorkerMonitor) ApplyConfig(wCfg *WorkerMonitorConfig) {
+	wm.cfgMtx.Lock()
+	cfg := *wm.cfg
+	cfg.OfflinePeriod = wCfg.OfflinePeriod
+	cfg.Retention = wCfg.Retention
+	wm.cfg = &cfg
+	wm.cfgMtx.Unlock()
+}
+
+// fetchWorker returns the state of the provided worker, creating it if it
+// does not exist. This must be called with the workers mutex held.
+func (wm *WorkerMonitor) fetchWorker(account string, name string) *WorkerState {
+	id := workerID(account, name)
+	worker, ok := wm.workers[id]
+	if !ok {
+		worker = &WorkerState{
+			Account: account,
+			Name:    name,
+		}
+		wm.workers[id] = worker
+	}
+	return worker
+}
+
+// recordActivity updates the last seen time of the provided worker and its
+// last share time if a share was submitted. An offline worker submitting a
+// share is flagged as recovered.
+func (wm *WorkerMonitor) recordActivity(account string, name string, share bool) {
+	now := time.Now().UnixNano()
+	id := workerID(account, name)
+	var recovered *WorkerState
+	wm.workersMtx.Lock()
+	worker := wm.fetchWorker(account, name)
+	worker.LastSeen = now
+	if share {
+		worker.LastShare = now
+		worker.Accepted++
+		if worker.Offline {
+			worker.Offline = false
+			state := *worker
+			recovered = &state
+		}
+	}
+	wm.workersMtx.Unlock()
+
+	if recovered != nil {
+		log.Infof("Worker %s is back online", id)
+		wm.config().NotifyWorkerStatus(recovered)
+	}
+}
+
+// fetchShares returns the number of accepted and rejected shares recorded
+// for the provided worker.
+func (wm *WorkerMonitor) fetchShares(account string, name string) (uint64, uint64) {
+	wm.workersMtx.RLock()
+	defer wm.workersMtx.RUnlock()
+	worker, ok := wm.workers[workerID(account, name)]
+	if !ok {
+		return 0, 0
+	}
+	return worker.Accepted, worker.Rejected
+}
+
+// recordRejection counts a rejected share of the provided worker.
+func (wm *WorkerMonitor) recordRejection(account string, name string) {
+	wm.workersMtx.Lock()
+	wm.fetchWorker(account, name).Rejected++
+	wm.workersMtx.Unlock()
+}
+
+// endSession adds the connected period of the provided session up to the
+// provided time to the uptime of its worker. This must be called with the
+// workers mutex held.
+func (wm *WorkerMonitor) endSession(clientID string, now int64) {
+	session, ok := wm.sessions[clientID]
+	if !ok {
+		return
+	}
+	delete(wm.sessions, clientID)
+	worker, ok := wm.workers[session.worker]
+	if ok && now > session.since {
+		worker.Uptime += (now - session.since) / int64(time.Second)
+	}
+}
+
+// startSession starts tracking the connected period of the provided client
+// as a session of the provided worker, ending any previous session of the
+// client.
+func (wm *WorkerMonitor) startSession(clientID string, account string, name string, now int64) {
+	wm.workersMtx.Lock()
+	wm.endSession(clientID, now)
+	wm.fetchWorker(account, name)
+	wm.sessions[clientID] = &workerSession{
+		worker: workerID(account, name),
+		since:  now,
+	}
+	wm.workersMtx.Unlock()
+}
+
+// handleEvent records the worker activity of the provided client event.
+func (wm *WorkerMonitor) handleEvent(event *HubEvent) {
+	switch event.Kind {
+	case EventClientAuthorized:
+		wm.recordActivity(event.Account, event.Worker, false)
+		wm.startSession(event.ClientID, event.Account, event.Worker,
+			event.Timestamp)
+	case EventClientDisconnected:
+		wm.workersMtx.Lock()
+		wm.endSession(event.ClientID, event.Timestamp)
+		wm.workersMtx.Unlock()
+	case EventShareAccepted:
+		wm.recordActivity(event.Account, event.Worker, true)
+	case EventShareRejected:
+		if event.Account != "" {
+			wm.recordRejection(event.Account, event.Worker)
+		}
+	}
+}
+
+// settleSessions adds the connected periods of ongoing sessions up to the
+// provided time to the uptime of their workers. Sessions of clients no
+// longer connected are ended.
+func (wm *WorkerMonitor) settleSessions(now time.Time) {
+	wm.workersMtx.RLock()
+	clientIDs := make([]string, 0, len(wm.sessions))
+	for clientID := range wm.sessions {
+		clientIDs = append(clientIDs, clientID)
+	}
+	wm.workersMtx.RUnlock()
+	disconnected := make(map[string]struct{})
+	if wm.config().ClientConnected != nil {
+		for _, clientID := range clientIDs {
+			if !wm.config().ClientConnected(clientID) {
+				disconnected[clientID] = struct{}{}
+			}
+		}
+	}
+
+	nowNano := now.UnixNano()
+	wm.workersMtx.Lock()
+	for clientID, session := range wm.sessions {
+		if _, ok := disconnected[clientID]; ok {
+			wm.endSession(clientID, nowNano)
+			continue
+		}
+		worker, ok := wm.workers[session.worker]
+		if !ok || nowNano <= session.since {
+			continue
+		}
+		secs := (nowNano - session.since) / int64(time.Second)
+		worker.Uptime += secs
+		session.since += secs * int64(time.Second)
+	}
+	wm.workersMtx.Unlock()
+}
+
+// sampleHashRates records the current hash rates of workers seen within
+// the sample window and discards samples older than the window. Workers
+// without connected clients are sampled with a zero hash rate.
+func (wm *WorkerMonitor) sampleHashRates(now time.Time) {
+	hashRates := make(map[string]*big.Rat)
+	if wm.config().FetchWorkerHashRates != nil {
+		hashRates = wm.config().FetchWorkerHashRates()
+	}
+	min := now.Add(-workerSampleWindow).UnixNano()
+	wm.workersMtx.Lock()
+	for id, worker := range wm.workers {
+		samples := make([]*HashRateSample, 0, len(worker.HashRates)+1)
+		for _, sample := range worker.HashRates {
+			if sample.Time >= min {
+				samples = append(samples, sample)
+			}
+		}
+		hashRate, ok := hashRates[id]
+		if ok || worker.LastSeen >= min {
+			if !ok {
+				hashRate = new(big.Rat)
+			}
+			samples = append(samples, &HashRateSample{
+				Time:     now.UnixNano(),
+				HashRate: hashRate,
+			})
+		}
+		worker.HashRates = samples
+	}
+	wm.workersMtx.Unlock()
+}
+
+// prune removes workers not seen within the retention period and without
+// connected clients from the monitor and the database.
+func (wm *WorkerMonitor) prune(now time.Time) error {
+	retention := wm.config().Retention
+	if retention == 0 {
+		return nil
+	}
+	min := now.Add(-retention).UnixNano()
+	wm.workersMtx.Lock()
+	defer wm.workersMtx.Unlock()
+	active := make(map[string]struct{}, len(wm.sessions))
+	for _, session := range wm.sessions {
+		active[session.worker] = struct{}{}
+	}
+	pruned := make([]string, 0)
+	for id, worker := range wm.workers {
+		if _, ok := active[id]; ok || worker.LastSeen >= min {
+			continue
+		}
+		pruned = append(pruned, id)
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+	err := wm.config().DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchWorkerBucket(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range pruned {
+			err := bkt.Delete([]byte(id))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range pruned {
+		delete(wm.workers, id)
+	}
+	log.Infof("Pruned %d workers not seen within %v", len(pruned),
+		retention)
+	return nil
+}
+
+// checkWorkers flags workers with no shares within the offline period
+// as offline.
+func (wm *WorkerMonitor) checkWorkers(now time.Time) {
+	min := now.Add(-wm.config().OfflinePeriod).UnixNano()
+	offline := make([]*WorkerState, 0)
+	wm.workersMtx.Lock()
+	for _, worker := range wm.workers {
+		if worker.Offline || worker.LastShare == 0 || worker.LastShare >= min {
+			continue
+		}
+		worker.Offline = true
+		state := *worker
+		offline = append(offline, &state)
+	}
+	wm.workersMtx.Unlock()
+
+	for _, worker := range offline {
+		log.Infof("Worker %s is offline", workerID(worker.Account, worker.Name))
+		wm.config().NotifyWorkerStatus(worker)
+	}
+}
+
+// fetchAccountWorkers returns the workers of the provided account ordered
+// by name. The uptime of the workers includes the ongoing sessions of
+// their connected clients.
+func (wm *WorkerMonitor) fetchAccountWorkers(account string) []*WorkerState {
+	now := time.Now().UnixNano()
+	workers := make([]*WorkerState, 0)
+	wm.workersMtx.RLock()
+	states := make(map[string]*WorkerState)
+	for id, worker := range wm.workers {
+		if worker.Account == account {
+			state := *worker
+			states[id] = &state
+			workers = append(workers, &state)
+		}
+	}
+	for _, session := range wm.sessions {
+		state, ok := states[session.worker]
+		if ok && now > session.since {
+			state.Uptime += (now - session.since) / int64(time.Second)
+		}
+	}
+	wm.workersMtx.RUnlock()
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].Name < workers[j].Name
+	})
+	return workers
+}
+
+// fetchOnlineWorkers returns the number of online workers of each account.
+// Workers that have not submitted shares are not considered online.
+func (wm *WorkerMonitor) fetchOnlineWorkers() map[string]uint32 {
+	online := make(map[string]uint32)
+	wm.workersMtx.RLock()
+	for _, worker := range wm.workers {
+		if worker.Offline || worker.LastShare == 0 {
+			continue
+		}
+		online[worker.Account]++
+	}
+	wm.workersMtx.RUnlock()
+	return online
+}
+
+// mergeAccount runs the provided merge of the persisted history of an
+// account into another and merges the workers tracked for the accounts
+// alike, the workers of the account merged into combine the activity of
+// same named workers. Worker activity is not recorded while the merge runs.
+func (wm *WorkerMonitor) mergeAccount(fromID string, toID string, merge func() error) error {
+	wm.workersMtx.Lock()
+	defer wm.workersMtx.Unlock()
+	err := merge()
+	if err != nil {
+		return err
+	}
+	mergeWorkers(wm.workers, fromID, toID)
+	prefix := workerID(fromID, "")
+	for _, session := range wm.sessions {
+		if strings.HasPrefix(session.worker, prefix) {
+			session.worker = workerID(toID,
+				strings.TrimPrefix(session.worker, prefix))
+		}
+	}
+	return wm.persistWorkers()
+}
+
+// persist saves the current worker states to the database.
+func (wm *WorkerMonitor) persist() error {
+	wm.workersMtx.RLock()
+	defer wm.workersMtx.RUnlock()
+	return wm.persistWorkers()
+}
+
+// persistWorkers saves the current worker states to the database. This
+// must be called with the workers mutex held.
+func (wm *WorkerMonitor) persistWorkers() error {
+	return wm.config().DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := fetchWorkerBucket(tx)
+		if err != nil {
+			return err
+		}
+		for id, worker := range wm.workers {
+			workerBytes, err := json.Marshal(worker)
+			if err != nil {
+				return err
+			}
+			err = bkt.Put([]byte(id), workerBytes)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// run records worker activity published on the hub's event bus,
+// periodically checks workers for inactivity, samples worker hash rates
+// and persists worker states. It must be run as a goroutine.
+func (wm *WorkerMonitor) run(ctx context.Context) {
+	checkTicker := time.NewTicker(workerCheckInterval)
+	sampleTicker := time.NewTicker(workerSampleInterval)
+	persistTicker := time.NewTicker(workerPersistInterval)
+	defer checkTicker.Stop()
+	defer sampleTicker.Stop()
+	defer persistTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wm.config().Events.Unsubscribe(wm.events)
+			wm.settleSessions(time.Now())
+			err := wm.persist()
+			if err != nil {
+				log.Errorf("unable to persist worker states: %v", err)
+			}
+			wm.config().HubWg.Done()
+			return
+
+		case event := <-wm.events.Events():
+			wm.handleEvent(event)
+
+		case <-checkTicker.C:
+			wm.checkWorkers(time.Now())
+
+		case <-sampleTicker.C:
+			wm.sampleHashRates(time.Now())
+
+		case <-persistTicker.C:
+			now := time.Now()
+			wm.settleSessions(now)
+			err := wm.prune(now)
+			if err != nil {
+				log.Errorf("unable to prune workers: %v", err)
+			}
+			err = wm.persist()
+			if err != nil {
+				log.Errorf("unable to persist worker states: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func testWorkerMonitor(t *testing.T, db *bolt.DB) {
+	statuses := make([]*WorkerState, 0)
+	wCfg := &WorkerMonitorConfig{
+		DB:            db,
+		OfflinePeriod: time.Minute,
+		NotifyWorkerStatus: func(worker *WorkerState) {
+			statuses = append(statuses, worker)
+		},
+		Events: NewEventBus(),
+		HubWg:  new(sync.WaitGroup),
+	}
+	wm, err := NewWorkerMonitor(wCfg)
+	if err != nil {
+		t.Fatalf("[NewWorkerMonitor] unexpected error: %v", err)
+	}
+
+	// Ensure workers without shares are not flagged offline.
+	wm.recordActivity(xID, "rig1", false)
+	wm.recordActivity(xID, "rig2", true)
+	wm.recordActivity(yID, "rig1", true)
+	wm.checkWorkers(time.Now().Add(time.Minute * 2))
+	workers := wm.fetchAccountWorkers(xID)
+	if len(workers) != 2 {
+		t.Fatalf("expected 2 workers for account X, got %d", len(workers))
+	}
+	if workers[0].Name != "rig1" || workers[0].Offline {
+		t.Fatalf("expected worker rig1 of account X to be online")
+	}
+	if workers[1].Name != "rig2" || !workers[1].Offline {
+		t.Fatalf("expected worker rig2 of account X to be offline")
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 offline events, got %d", len(statuses))
+	}
+
+	// Ensure offline workers are not flagged offline again.
+	wm.checkWorkers(time.Now().Add(time.Minute * 3))
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 offline events, got %d", len(statuses))
+	}
+
+	// Ensure a reconnecting worker recovers once it submits shares.
+	wm.recordActivity(xID, "rig2", false)
+	if len(statuses) != 2 {
+		t.Fatalf("expected no recovery event without shares")
+	}
+	wm.recordActivity(xID, "rig2", true)
+	if len(statuses) != 3 {
+		t.Fatalf("expected a recovery event, got %d events", len(statuses))
+	}
+	if statuses[2].Offline || statuses[2].Name != "rig2" {
+		t.Fatalf("expected a recovery event for worker rig2")
+	}
+
+	// Ensure active workers are not flagged offline.
+	wm.checkWorkers(time.Now())
+	if len(statuses) != 3 {
+		t.Fatalf("expected 3 worker events, got %d", len(statuses))
+	}
+
+	// Ensure worker activity is recorded from client events.
+	wm.handleEvent(&HubEvent{
+		Kind:    EventShareAccepted,
+		Account: xID,
+		Worker:  "rig3",
+	})
+	workers = wm.fetchAccountWorkers(xID)
+	if len(workers) != 3 || workers[2].Name != "rig3" ||
+		workers[2].LastShare == 0 {
+		t.Fatalf("expected a share recorded for worker rig3 of account X")
+	}
+
+	// Ensure worker states persist across monitor restarts.
+	err = wm.persist()
+	if err != nil {
+		t.Fatalf("[persist] unexpected error: %v", err)
+	}
+	wm, err = NewWorkerMonitor(wCfg)
+	if err != nil {
+		t.Fatalf("[NewWorkerMonitor] unexpected error: %v", err)
+	}
+	workers = wm.fetchAccountWorkers(yID)
+	if len(workers) != 1 || workers[0].Name != "rig1" ||
+		workers[0].LastShare == 0 {
+		t.Fatalf("expected a persisted worker for account Y")
+	}
+
+	// Ensure worker uptime accumulates across client sessions and
+	// ongoing sessions are included in fetched worker states.
+	now := time.Now()
+	wm.handleEvent(&HubEvent{
+		Kind:      EventClientAuthorized,
+		Timestamp: now.Add(-time.Minute * 10).UnixNano(),
+		ClientID:  "00000001/cpu",
+		Account:   yID,
+		Worker:    "rig2",
+	})
+	wm.handleEvent(&HubEvent{
+		Kind:      EventClientDisconnected,
+		Timestamp: now.Add(-time.Minute * 5).UnixNano(),
+		ClientID:  "00000001/cpu",
+	})
+	wm.handleEvent(&HubEvent{
+		Kind:      EventClientAuthorized,
+		Timestamp: now.Add(-time.Minute).UnixNano(),
+		ClientID:  "00000002/cpu",
+		Account:   yID,
+		Worker:    "rig2",
+	})
+	wm.handleEvent(&HubEvent{
+		Kind:     EventShareRejected,
+		ClientID: "00000002/cpu",
+		Account:  yID,
+		Worker:   "rig2",
+	})
+	workers = wm.fetchAccountWorkers(yID)
+	if len(workers) != 2 || workers[1].Name != "rig2" {
+		t.Fatalf("expected worker rig2 of account Y")
+	}
+	if workers[1].Uptime < 360 || workers[1].Rejected != 1 {
+		t.Fatalf("expected an uptime of at least 360s and 1 rejected "+
+			"share, got %ds and %d", workers[1].Uptime, workers[1].Rejected)
+	}
+
+	// Ensure settled sessions are not counted twice and sessions of
+	// disconnected clients are ended.
+	connected := true
+	wCfg.ClientConnected = func(string) bool {
+		return connected
+	}
+	wm.settleSessions(now)
+	workers = wm.fetchAccountWorkers(yID)
+	if workers[1].Uptime < 360 || workers[1].Uptime > 370 {
+		t.Fatalf("expected an uptime of about 360s, got %ds",
+			workers[1].Uptime)
+	}
+	connected = false
+	wm.settleSessions(now.Add(time.Minute))
+	if len(wm.sessions) != 0 {
+		t.Fatalf("expected no sessions, got %d", len(wm.sessions))
+	}
+	workers = wm.fetchAccountWorkers(yID)
+	if workers[1].Uptime < 420 || workers[1].Uptime > 430 {
+		t.Fatalf("expected an uptime of about 420s, got %ds",
+			workers[1].Uptime)
+	}
+
+	// Ensure hash rates are sampled for recently seen workers and averaged
+	// over the sample window.
+	wCfg.FetchWorkerHashRates = func() map[string]*big.Rat {
+		return map[string]*big.Rat{
+			workerID(yID, "rig2"): new(big.Rat).SetInt64(100),
+		}
+	}
+	wm.sampleHashRates(now)
+	wCfg.FetchWorkerHashRates = nil
+	wm.sampleHashRates(now.Add(time.Minute))
+	workers = wm.fetchAccountWorkers(yID)
+	if len(workers[1].HashRates) != 2 {
+		t.Fatalf("expected 2 hash rate samples, got %d",
+			len(workers[1].HashRates))
+	}
+	avg := workers[1].AverageHashRate(now.Add(time.Minute))
+	if avg.Cmp(new(big.Rat).SetInt64(50)) != 0 {
+		t.Fatalf("expected an average hash rate of 50, got %v", avg)
+	}
+	wm.sampleHashRates(now.Add(workerSampleWindow + time.Minute*2))
+	workers = wm.fetchAccountWorkers(yID)
+	if len(workers[1].HashRates) != 0 {
+		t.Fatalf("expected expired hash rate samples to be discarded, "+
+			"got %d", len(workers[1].HashRates))
+	}
+
+	// Ensure session metrics persist across monitor restarts.
+	err = wm.persist()
+	if err != nil {
+		t.Fatalf("[persist] unexpected error: %v", err)
+	}
+	wm, err = NewWorkerMonitor(wCfg)
+	if err != nil {
+		t.Fatalf("[NewWorkerMonitor] unexpected error: %v", err)
+	}
+	workers = wm.fetchAccountWorkers(yID)
+	if len(workers) != 2 || workers[1].Uptime < 420 ||
+		workers[1].Rejected != 1 {
+		t.Fatalf("expected persisted session metrics for worker rig2")
+	}
+
+	// Ensure an applied retention period and offline period take effect
+	// and other fields of the applied configuration are ignored.
+	wm.ApplyConfig(&WorkerMonitorConfig{
+		OfflinePeriod: time.Minute * 5,
+		Retention:     time.Hour * 3,
+	})
+	if wm.config().OfflinePeriod != time.Minute*5 || wm.config().DB != db {
+		t.Fatal("expected only the offline period and retention applied")
+	}
+	err = wm.prune(now.Add(time.Hour * 2))
+	if err != nil {
+		t.Fatalf("[prune] unexpected error: %v", err)
+	}
+	if len(wm.fetchAccountWorkers(yID)) != 2 {
+		t.Fatal("expected workers within the retention period to remain")
+	}
+
+	// Ensure workers not seen within the retention period are pruned.
+	wm.ApplyConfig(&WorkerMonitorConfig{Retention: time.Hour})
+	err = wm.prune(now.Add(time.Hour * 2))
+	if err != nil {
+		t.Fatalf("[prune] unexpected error: %v", err)
+	}
+	if len(wm.fetchAccountWorkers(xID)) != 0 ||
+		len(wm.fetchAccountWorkers(yID)) != 0 {
+		t.Fatal("expected all workers to be pruned")
+	}
+	wm, err = NewWorkerMonitor(wCfg)
+	if err != nil {
+		t.Fatalf("[NewWorkerMonitor] unexpected error: %v", err)
+	}
+	if len(wm.fetchAccountWorkers(yID)) != 0 {
+		t.Fatal("expected pruned workers to be removed from the database")
+	}
+
+	// Empty the worker bucket.
+	err = emptyBucket(db, workerBkt)
+	if err != nil {
+		t.Fatalf("emptyBucket error: %v", err)
+	}
+}
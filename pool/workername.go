@@ -0,0 +1,171 @@
+// Copyright (c) 2019 The Eacred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// MaxWorkerNameLength represents the default maximum length of worker
+	// names, in characters.
+	MaxWorkerNameLength = 32
+
+	// defaultWorkerName represents the prefix of the names assigned to
+	// workers authorizing without a name.
+	defaultWorkerName = "worker"
+)
+
+// isWorkerNameChar returns if the provided character is allowed in worker
+// names.
+func isWorkerNameChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+		(r >= '0' && r <= '9') || r == '-' || r == '_'
+}
+
+// NormalizeWorkerName trims the provided worker name and restricts it to
+// letters, digits, dashes and underscores of at most the provided length,
+// zero for the default length. Disallowed characters are replaced by
+// underscores and names exceeding the length truncated, strict
+// normalization refuses such names instead. An empty name is returned for
+// names that are empty once trimmed.
+func NormalizeWorkerName(name string, maxLength uint32, strict bool) (string, error) {
+	if maxLength == 0 {
+		maxLength = MaxWorkerNameLength
+	}
+	name = strings.TrimSpace(name)
+	var b strings.Builder
+	var length uint32
+	for _, r := range name {
+		if !isWorkerNameChar(r) {
+			if strict {
+				desc := fmt.Sprintf("worker name %q contains %q, only "+
+					"letters, digits, dashes and underscores are allowed",
+					name, r)
+				return "", MakeError(ErrParse, desc, nil)
+			}
+			r = '_'
+		}
+		if length == maxLength {
+			if strict {
+				desc := fmt.Sprintf("worker name %q exceeds %d "+
+					"characters", name, maxLength)
+				return "", MakeError(ErrParse, desc, nil)
+			}
+			break
+		}
+		b.WriteRune(r)
+		length++
+	}
+	return b.String(), nil
+}
+
+// defaultName represents a default worker name assigned to a client.
+type defaultName struct {
+	account string
+	suffix  int
+}
+
+// DefaultWorkerNames assigns default names to workers authorizing without
+// a name. Connected workers of an account are assigned distinct names,
+// worker1 through workerN, names are reused once their clients disconnect.
+type DefaultWorkerNames struct {
+	assigned map[string]map[int]struct{}
+	clients  map[string]defaultName
+	mtx      sync.Mutex
+}
+
+// NewDefaultWorkerNames creates a default worker name registry.
+func NewDefaultWorkerNames() *DefaultWorkerNames {
+	return &DefaultWorkerNames{
+		assigned: make(map[string]map[int]struct{}),
+		clients:  make(map[string]defaultName),
+	}
+}
+
+// assign returns the default worker name of the client with the provided
+// id, assigning the lowest unassigned name of the provided account if the
+// client has none.
+func (d *DefaultWorkerNames) assign(account string, clientID string) string {
+	if d == nil {
+		return defaultWorkerName + "1"
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if name, ok := d.clients[clientID]; ok && name.account == account {
+		return fmt.Sprintf("%s%d", defaultWorkerName, name.suffix)
+	}
+	d.releaseClient(clientID)
+	suffixes := d.assigned[account]
+	if suffixes == nil {
+		suffixes = make(map[int]struct{})
+		d.assigned[account] = suffixes
+	}
+	suffix := 1
+	for {
+		if _, ok := suffixes[suffix]; !ok {
+			break
+		}
+		suffix++
+	}
+	suffixes[suffix] = struct{}{}
+	d.clients[clientID] = defaultName{account: account, suffix: suffix}
+	return fmt.Sprintf("%s%d", defaultWorkerName, suffix)
+}
+
+// reserve assigns the provided default worker name of the provided account
+// to the client with the provided id, it returns false if the name is not
+// a default name or is assigned to another client.
+func (d *DefaultWorkerNames) reserve(account string, name string, clientID string) bool {
+	if d == nil || !strings.HasPrefix(name, defaultWorkerName) {
+		return false
+	}
+	var suffix int
+	_, err := fmt.Sscanf(name[len(defaultWorkerName):], "%d", &suffix)
+	if err != nil || suffix < 1 ||
+		fmt.Sprintf("%s%d", defaultWorkerName, suffix) != name {
+		return false
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if _, ok := d.assigned[account][suffix]; ok {
+		current, ok := d.clients[clientID]
+		return ok && current.account == account && current.suffix == suffix
+	}
+	d.releaseClient(clientID)
+	if d.assigned[account] == nil {
+		d.assigned[account] = make(map[int]struct{})
+	}
+	d.assigned[account][suffix] = struct{}{}
+	d.clients[clientID] = defaultName{account: account, suffix: suffix}
+	return true
+}
+
+// release releases the default worker name of the client with the provided
+// id.
+func (d *DefaultWorkerNames) release(clientID string) {
+	if d == nil {
+		return
+	}
+	d.mtx.Lock()
+	d.releaseClient(clientID)
+	d.mtx.Unlock()
+}
+
+// releaseClient releases the default worker name of the client with the
+// provided id. This must be called with the registry lock held.
+func (d *DefaultWorkerNames) releaseClient(clientID string) {
+	name, ok := d.clients[clientID]
+	if !ok {
+		return
+	}
+	delete(d.clients, clientID)
+	delete(d.assigned[name.account], name.suffix)
+	if len(d.assigned[name.account]) == 0 {
+		delete(d.assigned, name.account)
+	}
+}
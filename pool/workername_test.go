@@ -0,0 +1,194 @@
+package pool
+
+import (
+	"encoding/json"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/Eacred/eacrd/chaincfg"
+	bolt "github.com/coreos/bbolt"
+)
+
+func testWorkerNames(t *testing.T, db *bolt.DB) {
+	normalizeTests := []struct {
+		name      string
+		maxLength uint32
+		strict    bool
+		want      string
+		valid     bool
+	}{
+		{name: " rig-1_a ", want: "rig-1_a", valid: true},
+		{name: "rig 1", want: "rig_1", valid: true},
+		{name: "rig/ü", want: "rig__", valid: true},
+		{name: "abcdefgh", maxLength: 4, want: "abcd", valid: true},
+		{name: "   ", want: "", valid: true},
+		{name: " rig-1 ", strict: true, want: "rig-1", valid: true},
+		{name: "rig 1", strict: true, valid: false},
+		{name: "abcdefgh", maxLength: 4, strict: true, valid: false},
+		{name: "abcd", maxLength: 4, strict: true, want: "abcd", valid: true},
+	}
+
+	// Ensure worker names are trimmed, sanitized and truncated, or refused
+	// when normalized strictly.
+	for _, test := range normalizeTests {
+		name, err := NormalizeWorkerName(test.name, test.maxLength,
+			test.strict)
+		if !test.valid {
+			if !IsError(err, ErrParse) {
+				t.Fatalf("%q: expected a parse error, got %v", test.name,
+					err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: [NormalizeWorkerName] unexpected error: %v",
+				test.name, err)
+		}
+		if name != test.want {
+			t.Fatalf("%q: expected %q, got %q", test.name, test.want, name)
+		}
+	}
+
+	// Ensure names longer than the default maximum length are truncated
+	// to it.
+	long := make([]byte, MaxWorkerNameLength*2)
+	for i := range long {
+		long[i] = 'a'
+	}
+	name, err := NormalizeWorkerName(string(long), 0, false)
+	if err != nil {
+		t.Fatalf("[NormalizeWorkerName] unexpected error: %v", err)
+	}
+	if len(name) != MaxWorkerNameLength {
+		t.Fatalf("expected a name of %d characters, got %d",
+			MaxWorkerNameLength, len(name))
+	}
+
+	// Ensure default names are distinct per account, stable per client and
+	// reused once released.
+	names := NewDefaultWorkerNames()
+	if n := names.assign("a", "c1"); n != "worker1" {
+		t.Fatalf("expected worker1, got %s", n)
+	}
+	if n := names.assign("a", "c2"); n != "worker2" {
+		t.Fatalf("expected worker2, got %s", n)
+	}
+	if n := names.assign("b", "c3"); n != "worker1" {
+		t.Fatalf("expected worker1 for another account, got %s", n)
+	}
+	if n := names.assign("a", "c1"); n != "worker1" {
+		t.Fatalf("expected the assigned name to be kept, got %s", n)
+	}
+	names.release("c1")
+	if n := names.assign("a", "c4"); n != "worker1" {
+		t.Fatalf("expected the released name to be reused, got %s", n)
+	}
+
+	// Ensure only unassigned default names can be reserved.
+	if names.reserve("a", "worker2", "c5") {
+		t.Fatal("expected an assigned name not to be reserved")
+	}
+	if !names.reserve("a", "worker2", "c2") {
+		t.Fatal("expected the client's own name to be reserved")
+	}
+	if names.reserve("a", "rig1", "c5") || names.reserve("a", "worker01", "c5") {
+		t.Fatal("expected non-default names not to be reserved")
+	}
+	if !names.reserve("a", "worker7", "c5") {
+		t.Fatal("expected an unassigned default name to be reserved")
+	}
+	if n := names.assign("a", "c6"); n != "worker3" {
+		t.Fatalf("expected worker3, got %s", n)
+	}
+
+	// Ensure a nil registry assigns the first default name.
+	var nilNames *DefaultWorkerNames
+	if n := nilNames.assign("a", "c1"); n != "worker1" {
+		t.Fatalf("expected worker1, got %s", n)
+	}
+	nilNames.release("c1")
+
+	cCfg := &ClientConfig{
+		ActiveNet:   chaincfg.SimNetParams(),
+		DB:          db,
+		Blake256Pad: generateBlake256Pad(),
+		DifficultyInfo: &DifficultyInfo{
+			target:     new(big.Rat).SetInt64(1),
+			difficulty: new(big.Rat).SetInt64(1),
+			powLimit:   new(big.Rat).SetInt(chaincfg.SimNetParams().PowLimit),
+			multiplier: new(big.Rat).SetInt64(1),
+		},
+		FetchMiner: func() string {
+			return CPU
+		},
+		FetchMinerPolicy: func() string {
+			return PolicyAllow
+		},
+		RemoveClient:       func(*Client) {},
+		RecordAuthFailure:  func(string) {},
+		Events:             NewEventBus(),
+		Sessions:           NewSessionStore(),
+		AuthRejects:        NewAuthRejectCache(),
+		DefaultWorkerNames: NewDefaultWorkerNames(),
+	}
+	id := uint64(1)
+	authorize := func(name string) (*Client, *StratumError) {
+		data, err := json.Marshal(AuthorizeRequest(&id, name, xAddr))
+		if err != nil {
+			t.Fatalf("[Marshal] unexpected error: %v", err)
+		}
+		msg, _, err := IdentifyMessage(data)
+		if err != nil {
+			t.Fatalf("[IdentifyMessage] unexpected error: %v", err)
+		}
+		conn, _ := net.Pipe()
+		addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+		client, err := NewClient(conn, addr, cCfg)
+		if err != nil {
+			t.Fatalf("[NewClient] unexpected error: %v", err)
+		}
+		client.handleAuthorizeRequest(msg.(*Request), true)
+		resp := (<-client.ch).(*Response)
+		_, sErr, err := ParseAuthorizeResponse(resp)
+		if err != nil {
+			t.Fatalf("[ParseAuthorizeResponse] unexpected error: %v", err)
+		}
+		return client, sErr
+	}
+
+	// Ensure workers authorizing without a name are assigned distinct
+	// default names and other names are sanitized.
+	first, sErr := authorize(" ")
+	if sErr != nil {
+		t.Fatalf("expected the unnamed worker to be authorized, got %v", sErr)
+	}
+	second, sErr := authorize("")
+	if sErr != nil {
+		t.Fatalf("expected the unnamed worker to be authorized, got %v", sErr)
+	}
+	if first.name != "worker1" || second.name != "worker2" {
+		t.Fatalf("expected default names worker1 and worker2, got %s "+
+			"and %s", first.name, second.name)
+	}
+	sanitized, sErr := authorize("rig 1")
+	if sErr != nil {
+		t.Fatalf("expected the worker to be authorized, got %v", sErr)
+	}
+	if sanitized.name != "rig_1" || sanitized.defaultName {
+		t.Fatalf("expected the sanitized name rig_1, got %s",
+			sanitized.name)
+	}
+
+	// Ensure strict normalization refuses the authorization with a
+	// descriptive error.
+	cCfg.StrictWorkerNames = true
+	_, sErr = authorize("rig 1")
+	if sErr == nil || sErr.Code != InvalidWorkerName ||
+		sErr.Traceback == nil || *sErr.Traceback == "" {
+		t.Fatalf("expected an invalid worker name error, got %v", sErr)
+	}
+
+	cCfg.DefaultWorkerNames.release(first.id)
+	cCfg.DefaultWorkerNames.release(second.id)
+}